@@ -17,6 +17,7 @@ limitations under the License.
 package localnetv1
 
 import (
+	"fmt"
 	"net"
 )
 
@@ -29,19 +30,89 @@ func (ep *Endpoint) AddAddress(s string) (ip net.IP) {
 	return ep.IPs.Add(s)
 }
 
+// BalancingWeight returns the weight of the endpoint in the balancing of its service, DefaultEndpointWeight if not
+// set.
+func (ep *Endpoint) BalancingWeight() int32 {
+	if ep.GetWeight() <= 0 {
+		return DefaultEndpointWeight
+	}
+	return ep.Weight
+}
+
+// PortMapping returns the target port of the endpoint for the given service port, or 0 if there's none
+// (including when the endpoint advertises the port with another protocol).
+//
+// The target ports resolved by the server (see ResolvePorts) are used when present, so the backends don't resolve
+// the named ports themselves.
 func (ep *Endpoint) PortMapping(port *PortMapping) (target int32) {
-	target = port.TargetPort
-	if port.TargetPortName != "" {
-		for _, override := range ep.PortOverrides {
-			if override.Name == port.Name {
-				target = override.Port
-				break
-			}
+	for _, resolved := range ep.TargetPorts {
+		if resolved.Name == port.Name {
+			return resolved.TargetPort
 		}
 	}
+
+	return ep.resolvePort(port)
+}
+
+// ResolvePorts sets the TargetPorts of the endpoint for the given service ports, resolving the named target ports
+// with the ports the endpoint advertises.
+func (ep *Endpoint) ResolvePorts(ports []*PortMapping) {
+	ep.TargetPorts = make([]*PortMapping, 0, len(ports))
+	for _, port := range ports {
+		ep.TargetPorts = append(ep.TargetPorts, &PortMapping{
+			Name:           port.Name,
+			Protocol:       port.Protocol,
+			Port:           port.Port,
+			TargetPort:     ep.resolvePort(port),
+			TargetPortName: port.TargetPortName,
+		})
+	}
+}
+
+func (ep *Endpoint) resolvePort(port *PortMapping) (target int32) {
+	override := ep.portOverride(port)
+
+	if override != nil && !override.protocolMatches(port) {
+		return 0
+	}
+
+	target = port.TargetPort
+	if port.TargetPortName != "" && override != nil {
+		target = override.Port
+	}
 	return
 }
 
+// PortMismatch returns why the endpoint can't be a target of the given service port, or "" if it can.
+func (ep *Endpoint) PortMismatch(port *PortMapping) string {
+	override := ep.portOverride(port)
+
+	switch {
+	case override != nil && !override.protocolMatches(port):
+		return fmt.Sprintf("port %q is advertised with protocol %s instead of %s", port.Name, override.Protocol, port.Protocol)
+
+	case override == nil && port.TargetPortName != "" && port.TargetPort == 0:
+		return fmt.Sprintf("named port %q is not advertised", port.TargetPortName)
+	}
+
+	return ""
+}
+
+func (ep *Endpoint) portOverride(port *PortMapping) *PortName {
+	for _, override := range ep.PortOverrides {
+		if override.Name == port.Name {
+			return override
+		}
+	}
+	return nil
+}
+
+func (pn *PortName) protocolMatches(port *PortMapping) bool {
+	return pn.Protocol == Protocol_UnknownProtocol ||
+		port.Protocol == Protocol_UnknownProtocol ||
+		pn.Protocol == port.Protocol
+}
+
 func (ep *Endpoint) PortMappings(ports []*PortMapping) (mapping map[int32]int32) {
 	mapping = make(map[int32]int32, len(ports))
 	for _, port := range ports {
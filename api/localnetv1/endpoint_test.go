@@ -41,3 +41,54 @@ func ExampleEndpointPortMapping() {
 	// http2 888
 	// metrics 1011
 }
+
+func ExampleEndpoint_portMismatch() {
+	ports := []*PortMapping{
+		{Name: "dns", Protocol: Protocol_UDP, TargetPortName: "dns"},
+		{Name: "dns-tcp", Protocol: Protocol_TCP, TargetPortName: "dns-tcp"},
+		{Name: "metrics", Protocol: Protocol_TCP, TargetPortName: "metrics"},
+	}
+
+	ep := &Endpoint{
+		PortOverrides: []*PortName{
+			{Name: "dns", Port: 53, Protocol: Protocol_TCP},
+			{Name: "dns-tcp", Port: 53, Protocol: Protocol_TCP},
+		},
+	}
+
+	for _, port := range ports {
+		fmt.Printf("%s %d %q\n", port.Name, ep.PortMapping(port), ep.PortMismatch(port))
+	}
+
+	// Output:
+	// dns 0 "port \"dns\" is advertised with protocol TCP instead of UDP"
+	// dns-tcp 53 ""
+	// metrics 0 "named port \"metrics\" is not advertised"
+}
+
+func ExampleEndpoint_ResolvePorts() {
+	ports := []*PortMapping{
+		{Name: "http", Protocol: Protocol_TCP, Port: 80, TargetPort: 8080},
+		{Name: "metrics", Protocol: Protocol_TCP, Port: 9090, TargetPortName: "t-metrics"},
+		{Name: "admin", Protocol: Protocol_TCP, Port: 81, TargetPortName: "t-admin"},
+	}
+
+	ep := &Endpoint{
+		PortOverrides: []*PortName{
+			{Name: "metrics", Port: 1011},
+		},
+	}
+	ep.ResolvePorts(ports)
+
+	// the overrides are no longer used once resolved
+	ep.PortOverrides = nil
+
+	for _, port := range ep.TargetPorts {
+		fmt.Printf("%s %d->%d %q %d\n", port.Name, port.Port, port.TargetPort, port.TargetPortName, ep.PortMapping(port))
+	}
+
+	// Output:
+	// http 80->8080 "" 8080
+	// metrics 9090->1011 "t-metrics" 1011
+	// admin 81->0 "t-admin" 0
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package localnetv1
+
+import "fmt"
+
+// Name returns the name of the range, unique in the service (valid port names are at most 15 characters long).
+func (r *PortRange) Name() string {
+	return fmt.Sprintf("range-%d-%d", r.Port, r.EndPort)
+}
+
+// Validate returns why the range is invalid, if it is.
+func (r *PortRange) Validate() error {
+	switch {
+	case r.Protocol == Protocol_UnknownProtocol:
+		return fmt.Errorf("unknown protocol")
+	case r.Port <= 0 || r.Port > 65535:
+		return fmt.Errorf("invalid port %d", r.Port)
+	case r.EndPort <= r.Port || r.EndPort > 65535:
+		return fmt.Errorf("invalid end port %d", r.EndPort)
+	case r.TargetPort <= 0 || r.TargetPort+r.EndPort-r.Port > 65535:
+		return fmt.Errorf("invalid target port %d", r.TargetPort)
+	}
+	return nil
+}
+
+// Overlaps returns true if the range has ports in common with the ports from port to endPort, with the protocol.
+func (r *PortRange) Overlaps(protocol Protocol, port, endPort int32) bool {
+	return r.Protocol == protocol && r.Port <= endPort && port <= r.EndPort
+}
@@ -0,0 +1,32 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package localnetv1
+
+import "strings"
+
+// ServicePath returns the path of the service the ref belongs to: the path of an endpoint without its key
+// (namespace/name/key => namespace/name), the path itself for the other sets.
+func (r *Ref) ServicePath() string {
+	if r.Set != Set_EndpointsSet {
+		return r.Path
+	}
+
+	if idx := strings.LastIndexByte(r.Path, '/'); idx != -1 {
+		return r.Path[:idx]
+	}
+	return r.Path
+}
@@ -0,0 +1,34 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package localnetv1
+
+import "testing"
+
+func TestRefServicePath(t *testing.T) {
+	for _, tc := range []struct {
+		ref      *Ref
+		expected string
+	}{
+		{&Ref{Set: Set_EndpointsSet, Path: "ns/svc/abcd"}, "ns/svc"},
+		{&Ref{Set: Set_ServicesSet, Path: "ns/svc"}, "ns/svc"},
+		{&Ref{Set: Set_EndpointsSet, Path: "invalid"}, "invalid"},
+	} {
+		if path := tc.ref.ServicePath(); path != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.ref, tc.expected, path)
+		}
+	}
+}
@@ -16,6 +16,136 @@ limitations under the License.
 
 package localnetv1
 
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// TrafficDistributionPreferClose prefers the endpoints in the zone of the node, falling back to all the endpoints when
+// the zone has none (see Service.TrafficDistribution).
+const TrafficDistributionPreferClose = "PreferClose"
+
+const (
+	// NodePortRateLimitAnnotation limits the new connections per second to each node port of the service, on each
+	// node, to protect the nodes from floods on their exposed ports. The backends only get it when the server sends
+	// the annotation (see --with-service-annotations).
+	NodePortRateLimitAnnotation = "kpng.sigs.k8s.io/node-port-rate-limit"
+	// NodePortRateLimitBurstAnnotation is the number of connections allowed above the rate in a burst (the rate by
+	// default).
+	NodePortRateLimitBurstAnnotation = "kpng.sigs.k8s.io/node-port-rate-limit-burst"
+
+	// MaxNodePortRate is the max rate and burst of NodePortRateLimitAnnotation, supported by all the backends.
+	MaxNodePortRate = 10000
+)
+
+const (
+	// EndpointWeightsAnnotation sets the weights of the service's endpoints, by the name of their pods, as comma
+	// separated <pattern>=<weight> (shell patterns, the first matching one applies), ie: "web-canary-*=1,*=9". The
+	// endpoints matching no pattern have the default weight. Only applied by the server with the annotation (see
+	// --with-service-annotations).
+	EndpointWeightsAnnotation = "kpng.sigs.k8s.io/endpoint-weights"
+
+	// DefaultEndpointWeight is the weight of the endpoints without one (see Endpoint.Weight).
+	DefaultEndpointWeight = 1
+	// MaxEndpointWeight is the max weight of an endpoint, supported by all the backends.
+	MaxEndpointWeight = 100
+)
+
+// EndpointWeight is the weight of the endpoints whose pod name matches the pattern.
+type EndpointWeight struct {
+	Pattern string
+	Weight  int32
+}
+
+// EndpointWeights are the weights of a service's endpoints (see EndpointWeightsAnnotation).
+type EndpointWeights []EndpointWeight
+
+// Of returns the weight of the endpoint of the pod, 0 if no pattern matches.
+func (w EndpointWeights) Of(podName string) int32 {
+	for _, weight := range w {
+		if ok, _ := path.Match(weight.Pattern, podName); ok {
+			return weight.Weight
+		}
+	}
+	return 0
+}
+
+// NodePortRateLimit is the max rate of new connections to each node port of a service.
+type NodePortRateLimit struct {
+	// PerSecond is the rate of new connections, and Burst the connections allowed above it in a burst.
+	PerSecond int
+	Burst     int
+}
+
 func (s *Service) NamespacedName() string {
 	return s.Namespace + "/" + s.Name
 }
+
+// PrefersClose returns true if the service prefers the endpoints in the zone of the node.
+func (s *Service) PrefersClose() bool {
+	return s.GetTrafficDistribution() == TrafficDistributionPreferClose
+}
+
+// GetNodePortRateLimit returns the rate limit of the service's node ports, nil if it has none (see
+// NodePortRateLimitAnnotation), or an error if the annotations are invalid.
+func (s *Service) GetNodePortRateLimit() (*NodePortRateLimit, error) {
+	value, ok := s.GetAnnotations()[NodePortRateLimitAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	rate, err := parseNodePortRate(NodePortRateLimitAnnotation, value)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := &NodePortRateLimit{PerSecond: rate, Burst: rate}
+
+	if value, ok := s.GetAnnotations()[NodePortRateLimitBurstAnnotation]; ok {
+		if limit.Burst, err = parseNodePortRate(NodePortRateLimitBurstAnnotation, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return limit, nil
+}
+
+func parseNodePortRate(annotation, value string) (int, error) {
+	rate, err := strconv.Atoi(value)
+	if err != nil || rate < 1 || rate > MaxNodePortRate {
+		return 0, fmt.Errorf("invalid %s %q: must be an integer between 1 and %d", annotation, value, MaxNodePortRate)
+	}
+	return rate, nil
+}
+
+// GetEndpointWeights returns the weights of the service's endpoints, nil if it has none (see
+// EndpointWeightsAnnotation), or an error if the annotation is invalid.
+func (s *Service) GetEndpointWeights() (EndpointWeights, error) {
+	value, ok := s.GetAnnotations()[EndpointWeightsAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	weights := EndpointWeights{}
+	for _, item := range strings.Split(value, ",") {
+		pattern, weightValue, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid %s item %q: must be <pattern>=<weight>", EndpointWeightsAnnotation, item)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %w", EndpointWeightsAnnotation, pattern, err)
+		}
+
+		weight, err := strconv.Atoi(weightValue)
+		if err != nil || weight < 1 || weight > MaxEndpointWeight {
+			return nil, fmt.Errorf("invalid %s weight %q: must be an integer between 1 and %d", EndpointWeightsAnnotation,
+				weightValue, MaxEndpointWeight)
+		}
+
+		weights = append(weights, EndpointWeight{Pattern: pattern, Weight: int32(weight)})
+	}
+
+	return weights, nil
+}
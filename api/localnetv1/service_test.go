@@ -17,6 +17,7 @@ limitations under the License.
 package localnetv1
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/golang/protobuf/proto"
@@ -42,3 +43,68 @@ func TestHashService(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestGetNodePortRateLimit(t *testing.T) {
+	for _, test := range []struct {
+		annotations map[string]string
+		expected    *NodePortRateLimit
+		invalid     bool
+	}{
+		{nil, nil, false},
+		{map[string]string{NodePortRateLimitAnnotation: "100"}, &NodePortRateLimit{PerSecond: 100, Burst: 100}, false},
+		{map[string]string{NodePortRateLimitAnnotation: "100", NodePortRateLimitBurstAnnotation: "20"}, &NodePortRateLimit{PerSecond: 100, Burst: 20}, false},
+		{map[string]string{NodePortRateLimitBurstAnnotation: "20"}, nil, false},
+		{map[string]string{NodePortRateLimitAnnotation: "0"}, nil, true},
+		{map[string]string{NodePortRateLimitAnnotation: "100/s"}, nil, true},
+		{map[string]string{NodePortRateLimitAnnotation: "100", NodePortRateLimitBurstAnnotation: "100000"}, nil, true},
+	} {
+		limit, err := (&Service{Annotations: test.annotations}).GetNodePortRateLimit()
+		if (err != nil) != test.invalid {
+			t.Errorf("%v: expected invalid=%v, got error %v", test.annotations, test.invalid, err)
+			continue
+		}
+		if (limit == nil) != (test.expected == nil) || (limit != nil && *limit != *test.expected) {
+			t.Errorf("%v: expected %+v, got %+v", test.annotations, test.expected, limit)
+		}
+	}
+}
+
+func TestGetEndpointWeights(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected EndpointWeights
+		invalid  bool
+	}{
+		{"web-canary-*=1,*=9", EndpointWeights{{"web-canary-*", 1}, {"*", 9}}, false},
+		{" web-canary-* = 1 ", nil, true},
+		{"web-canary-*=1, *=9", EndpointWeights{{"web-canary-*", 1}, {"*", 9}}, false},
+		{"web-*", nil, true},
+		{"=1", nil, true},
+		{"web-[=1", nil, true},
+		{"web-*=0", nil, true},
+		{"web-*=101", nil, true},
+	} {
+		weights, err := (&Service{Annotations: map[string]string{EndpointWeightsAnnotation: test.value}}).GetEndpointWeights()
+		if (err != nil) != test.invalid {
+			t.Errorf("%q: expected invalid=%v, got error %v", test.value, test.invalid, err)
+			continue
+		}
+		if !reflect.DeepEqual(weights, test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.value, test.expected, weights)
+		}
+	}
+
+	if weights, err := (&Service{}).GetEndpointWeights(); weights != nil || err != nil {
+		t.Errorf("expected no weights without annotation, got %v, %v", weights, err)
+	}
+
+	weights := EndpointWeights{{"web-canary-*", 1}, {"*", 9}}
+	for pod, expected := range map[string]int32{"web-canary-abc12": 1, "web-7d9f8c-xyz": 9} {
+		if w := weights.Of(pod); w != expected {
+			t.Errorf("%s: expected weight %d, got %d", pod, expected, w)
+		}
+	}
+	if w := (EndpointWeights{{"web-canary-*", 1}}).Of("web-abc"); w != 0 {
+		t.Errorf("expected no weight without matching pattern, got %d", w)
+	}
+}
@@ -37,9 +37,12 @@ const (
 type Set int32
 
 const (
-	Set_UnknownSet          Set = 0
-	Set_ServicesSet         Set = 1
-	Set_EndpointsSet        Set = 2
+	Set_UnknownSet   Set = 0
+	Set_ServicesSet  Set = 1
+	Set_EndpointsSet Set = 2
+	// NodeSet holds the Node the state is computed for (path: the node's name), so the backends get its topology
+	// and labels without watching the nodes themselves.
+	Set_NodeSet             Set = 3
 	Set_GlobalServiceInfos  Set = 10
 	Set_GlobalEndpointInfos Set = 11
 	Set_GlobalNodeInfos     Set = 12
@@ -51,6 +54,7 @@ var (
 		0:  "UnknownSet",
 		1:  "ServicesSet",
 		2:  "EndpointsSet",
+		3:  "NodeSet",
 		10: "GlobalServiceInfos",
 		11: "GlobalEndpointInfos",
 		12: "GlobalNodeInfos",
@@ -59,6 +63,7 @@ var (
 		"UnknownSet":          0,
 		"ServicesSet":         1,
 		"EndpointsSet":        2,
+		"NodeSet":             3,
 		"GlobalServiceInfos":  10,
 		"GlobalEndpointInfos": 11,
 		"GlobalNodeInfos":     12,
@@ -151,6 +156,12 @@ type WatchReq struct {
 
 	// NodeName of the requester
 	NodeName string `protobuf:"bytes,1,opt,name=NodeName,proto3" json:"NodeName,omitempty"`
+	// ServiceTypes restricts the services sent to the requester to those types (ie: ClusterIP, NodePort, LoadBalancer).
+	// All types are sent if empty.
+	ServiceTypes []string `protobuf:"bytes,2,rep,name=ServiceTypes,proto3" json:"ServiceTypes,omitempty"`
+	// Revision is the last revision applied by the requester, to resume from it instead of receiving the whole
+	// state again (0 if none). Only the first request of a watch is considered.
+	Revision uint64 `protobuf:"varint,3,opt,name=Revision,proto3" json:"Revision,omitempty"`
 }
 
 func (x *WatchReq) Reset() {
@@ -192,13 +203,26 @@ func (x *WatchReq) GetNodeName() string {
 	return ""
 }
 
+func (x *WatchReq) GetServiceTypes() []string {
+	if x != nil {
+		return x.ServiceTypes
+	}
+	return nil
+}
+
+func (x *WatchReq) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
 type OpItem struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
 	// Types that are assignable to Op:
-	//
 	//	*OpItem_Sync
 	//	*OpItem_Reset_
 	//	*OpItem_Set
@@ -245,7 +269,7 @@ func (m *OpItem) GetOp() isOpItem_Op {
 	return nil
 }
 
-func (x *OpItem) GetSync() *EmptyOp {
+func (x *OpItem) GetSync() *SyncOp {
 	if x, ok := x.GetOp().(*OpItem_Sync); ok {
 		return x.Sync
 	}
@@ -279,7 +303,7 @@ type isOpItem_Op interface {
 
 type OpItem_Sync struct {
 	// Sync signals that the change set is complete (especially useful to know when the initial state is complete)
-	Sync *EmptyOp `protobuf:"bytes,1,opt,name=Sync,proto3,oneof"`
+	Sync *SyncOp `protobuf:"bytes,1,opt,name=Sync,proto3,oneof"`
 }
 
 type OpItem_Reset_ struct {
@@ -343,6 +367,65 @@ func (*EmptyOp) Descriptor() ([]byte, []int) {
 	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{2}
 }
 
+type SyncOp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Revision identifies the state the requester has once this change set is applied. It depends only on the
+	// state's content, so it remains valid across server restarts.
+	Revision uint64 `protobuf:"varint,1,opt,name=Revision,proto3" json:"Revision,omitempty"`
+	// TraceParent is the W3C trace context of the brain's diff span, when the change set is traced (see the
+	// tracing package).
+	TraceParent string `protobuf:"bytes,2,opt,name=TraceParent,proto3" json:"TraceParent,omitempty"`
+}
+
+func (x *SyncOp) Reset() {
+	*x = SyncOp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_localnetv1_services_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SyncOp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncOp) ProtoMessage() {}
+
+func (x *SyncOp) ProtoReflect() protoreflect.Message {
+	mi := &file_api_localnetv1_services_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncOp.ProtoReflect.Descriptor instead.
+func (*SyncOp) Descriptor() ([]byte, []int) {
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SyncOp) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *SyncOp) GetTraceParent() string {
+	if x != nil {
+		return x.TraceParent
+	}
+	return ""
+}
+
 type Ref struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -355,7 +438,7 @@ type Ref struct {
 func (x *Ref) Reset() {
 	*x = Ref{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[3]
+		mi := &file_api_localnetv1_services_proto_msgTypes[4]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -368,7 +451,7 @@ func (x *Ref) String() string {
 func (*Ref) ProtoMessage() {}
 
 func (x *Ref) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[3]
+	mi := &file_api_localnetv1_services_proto_msgTypes[4]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -381,7 +464,7 @@ func (x *Ref) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Ref.ProtoReflect.Descriptor instead.
 func (*Ref) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{3}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *Ref) GetSet() Set {
@@ -410,7 +493,7 @@ type Value struct {
 func (x *Value) Reset() {
 	*x = Value{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[4]
+		mi := &file_api_localnetv1_services_proto_msgTypes[5]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -423,7 +506,7 @@ func (x *Value) String() string {
 func (*Value) ProtoMessage() {}
 
 func (x *Value) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[4]
+	mi := &file_api_localnetv1_services_proto_msgTypes[5]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -436,7 +519,7 @@ func (x *Value) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Value.ProtoReflect.Descriptor instead.
 func (*Value) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{4}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *Value) GetRef() *Ref {
@@ -471,16 +554,33 @@ type Service struct {
 	Ports                  []*PortMapping `protobuf:"bytes,6,rep,name=Ports,proto3" json:"Ports,omitempty"`
 	ExternalTrafficToLocal bool           `protobuf:"varint,7,opt,name=ExternalTrafficToLocal,proto3" json:"ExternalTrafficToLocal,omitempty"`
 	// Types that are assignable to SessionAffinity:
-	//
 	//	*Service_ClientIP
 	SessionAffinity        isService_SessionAffinity `protobuf_oneof:"SessionAffinity"`
 	InternalTrafficToLocal bool                      `protobuf:"varint,12,opt,name=InternalTrafficToLocal,proto3" json:"InternalTrafficToLocal,omitempty"`
+	// HealthCheckNodePort is the node port serving the service's health checks (0 if none)
+	HealthCheckNodePort int32 `protobuf:"varint,13,opt,name=HealthCheckNodePort,proto3" json:"HealthCheckNodePort,omitempty"`
+	// ExternalTrafficPolicy and InternalTrafficPolicy are the service's traffic policies ("Cluster" or "Local")
+	ExternalTrafficPolicy string `protobuf:"bytes,14,opt,name=ExternalTrafficPolicy,proto3" json:"ExternalTrafficPolicy,omitempty"`
+	InternalTrafficPolicy string `protobuf:"bytes,15,opt,name=InternalTrafficPolicy,proto3" json:"InternalTrafficPolicy,omitempty"`
+	// ForceMasquerade requests the traffic to this service to always be SNATed, overriding the local traffic
+	// detection and the traffic policies (set by the kpng.k8s.io/masquerade annotation)
+	ForceMasquerade bool `protobuf:"varint,16,opt,name=ForceMasquerade,proto3" json:"ForceMasquerade,omitempty"`
+	// PortRanges are the ranges of ports mapped for this service, in addition to Ports (set by the
+	// kpng.k8s.io/port-ranges annotation)
+	PortRanges []*PortRange `protobuf:"bytes,17,rep,name=PortRanges,proto3" json:"PortRanges,omitempty"`
+	// ExternalExposureSuspended is true when the service is outside of its exposure windows (set by the
+	// kpng.k8s.io/exposure-windows annotation): the brain publishes it as a ClusterIP service, without node
+	// ports, external and load balancer IPs, until its next window.
+	ExternalExposureSuspended bool `protobuf:"varint,18,opt,name=ExternalExposureSuspended,proto3" json:"ExternalExposureSuspended,omitempty"`
+	// TrafficDistribution is the service's preference for distributing the traffic to its endpoints ("PreferClose"
+	// to prefer the endpoints in the zone of the node, or empty for no preference)
+	TrafficDistribution string `protobuf:"bytes,19,opt,name=TrafficDistribution,proto3" json:"TrafficDistribution,omitempty"`
 }
 
 func (x *Service) Reset() {
 	*x = Service{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[5]
+		mi := &file_api_localnetv1_services_proto_msgTypes[6]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -493,7 +593,7 @@ func (x *Service) String() string {
 func (*Service) ProtoMessage() {}
 
 func (x *Service) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[5]
+	mi := &file_api_localnetv1_services_proto_msgTypes[6]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -506,7 +606,7 @@ func (x *Service) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Service.ProtoReflect.Descriptor instead.
 func (*Service) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{5}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *Service) GetNamespace() string {
@@ -600,6 +700,55 @@ func (x *Service) GetInternalTrafficToLocal() bool {
 	return false
 }
 
+func (x *Service) GetHealthCheckNodePort() int32 {
+	if x != nil {
+		return x.HealthCheckNodePort
+	}
+	return 0
+}
+
+func (x *Service) GetExternalTrafficPolicy() string {
+	if x != nil {
+		return x.ExternalTrafficPolicy
+	}
+	return ""
+}
+
+func (x *Service) GetInternalTrafficPolicy() string {
+	if x != nil {
+		return x.InternalTrafficPolicy
+	}
+	return ""
+}
+
+func (x *Service) GetForceMasquerade() bool {
+	if x != nil {
+		return x.ForceMasquerade
+	}
+	return false
+}
+
+func (x *Service) GetPortRanges() []*PortRange {
+	if x != nil {
+		return x.PortRanges
+	}
+	return nil
+}
+
+func (x *Service) GetExternalExposureSuspended() bool {
+	if x != nil {
+		return x.ExternalExposureSuspended
+	}
+	return false
+}
+
+func (x *Service) GetTrafficDistribution() string {
+	if x != nil {
+		return x.TrafficDistribution
+	}
+	return ""
+}
+
 type isService_SessionAffinity interface {
 	isService_SessionAffinity()
 }
@@ -624,7 +773,7 @@ type IPFilter struct {
 func (x *IPFilter) Reset() {
 	*x = IPFilter{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[6]
+		mi := &file_api_localnetv1_services_proto_msgTypes[7]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -637,7 +786,7 @@ func (x *IPFilter) String() string {
 func (*IPFilter) ProtoMessage() {}
 
 func (x *IPFilter) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[6]
+	mi := &file_api_localnetv1_services_proto_msgTypes[7]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -650,7 +799,7 @@ func (x *IPFilter) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use IPFilter.ProtoReflect.Descriptor instead.
 func (*IPFilter) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{6}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *IPFilter) GetTargetIPs() *IPSet {
@@ -681,7 +830,7 @@ type ServiceIPs struct {
 func (x *ServiceIPs) Reset() {
 	*x = ServiceIPs{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[7]
+		mi := &file_api_localnetv1_services_proto_msgTypes[8]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -694,7 +843,7 @@ func (x *ServiceIPs) String() string {
 func (*ServiceIPs) ProtoMessage() {}
 
 func (x *ServiceIPs) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[7]
+	mi := &file_api_localnetv1_services_proto_msgTypes[8]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -707,7 +856,7 @@ func (x *ServiceIPs) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ServiceIPs.ProtoReflect.Descriptor instead.
 func (*ServiceIPs) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{7}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *ServiceIPs) GetClusterIPs() *IPSet {
@@ -743,17 +892,34 @@ type Endpoint struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Hostname      string          `protobuf:"bytes,1,opt,name=Hostname,proto3" json:"Hostname,omitempty"`
-	IPs           *IPSet          `protobuf:"bytes,2,opt,name=IPs,proto3" json:"IPs,omitempty"`
+	Hostname string `protobuf:"bytes,1,opt,name=Hostname,proto3" json:"Hostname,omitempty"`
+	IPs      *IPSet `protobuf:"bytes,2,opt,name=IPs,proto3" json:"IPs,omitempty"`
+	// Local is set by the server when the endpoint is on the node receiving it (its NodeName is the node's name),
+	// so backends don't have to match the endpoint IPs with the node's addresses.
 	Local         bool            `protobuf:"varint,3,opt,name=Local,proto3" json:"Local,omitempty"`
 	PortOverrides []*PortName     `protobuf:"bytes,4,rep,name=PortOverrides,proto3" json:"PortOverrides,omitempty"`
 	Scopes        *EndpointScopes `protobuf:"bytes,5,opt,name=Scopes,proto3" json:"Scopes,omitempty"`
+	// Conditions, Topology and Hints are copied from the EndpointSlice
+	Conditions *EndpointConditions `protobuf:"bytes,6,opt,name=Conditions,proto3" json:"Conditions,omitempty"`
+	Topology   *TopologyInfo       `protobuf:"bytes,7,opt,name=Topology,proto3" json:"Topology,omitempty"`
+	Hints      *TopologyHints      `protobuf:"bytes,8,opt,name=Hints,proto3" json:"Hints,omitempty"`
+	// TargetPorts are the ports of the service with their TargetPort resolved for this endpoint by the server (0 if
+	// the endpoint doesn't advertise the port), keeping the original TargetPortName for debugging.
+	TargetPorts []*PortMapping `protobuf:"bytes,9,rep,name=TargetPorts,proto3" json:"TargetPorts,omitempty"`
+	// NodeName is the name of the node hosting the endpoint, set by the server (empty if unknown).
+	NodeName string `protobuf:"bytes,10,opt,name=NodeName,proto3" json:"NodeName,omitempty"`
+	// Weight is the relative weight of the endpoint in the balancing of the service, set by the server (the default
+	// weight, 1, if 0).
+	Weight int32 `protobuf:"varint,11,opt,name=Weight,proto3" json:"Weight,omitempty"`
+	// FQDN is the domain name of the endpoints published by name (ie: FQDN EndpointSlices), their IPs being set by the
+	// server from its resolution.
+	FQDN string `protobuf:"bytes,12,opt,name=FQDN,proto3" json:"FQDN,omitempty"`
 }
 
 func (x *Endpoint) Reset() {
 	*x = Endpoint{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[8]
+		mi := &file_api_localnetv1_services_proto_msgTypes[9]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -766,7 +932,7 @@ func (x *Endpoint) String() string {
 func (*Endpoint) ProtoMessage() {}
 
 func (x *Endpoint) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[8]
+	mi := &file_api_localnetv1_services_proto_msgTypes[9]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -779,7 +945,7 @@ func (x *Endpoint) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Endpoint.ProtoReflect.Descriptor instead.
 func (*Endpoint) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{8}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *Endpoint) GetHostname() string {
@@ -817,6 +983,55 @@ func (x *Endpoint) GetScopes() *EndpointScopes {
 	return nil
 }
 
+func (x *Endpoint) GetConditions() *EndpointConditions {
+	if x != nil {
+		return x.Conditions
+	}
+	return nil
+}
+
+func (x *Endpoint) GetTopology() *TopologyInfo {
+	if x != nil {
+		return x.Topology
+	}
+	return nil
+}
+
+func (x *Endpoint) GetHints() *TopologyHints {
+	if x != nil {
+		return x.Hints
+	}
+	return nil
+}
+
+func (x *Endpoint) GetTargetPorts() []*PortMapping {
+	if x != nil {
+		return x.TargetPorts
+	}
+	return nil
+}
+
+func (x *Endpoint) GetNodeName() string {
+	if x != nil {
+		return x.NodeName
+	}
+	return ""
+}
+
+func (x *Endpoint) GetWeight() int32 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+func (x *Endpoint) GetFQDN() string {
+	if x != nil {
+		return x.FQDN
+	}
+	return ""
+}
+
 type EndpointScopes struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -829,7 +1044,7 @@ type EndpointScopes struct {
 func (x *EndpointScopes) Reset() {
 	*x = EndpointScopes{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[9]
+		mi := &file_api_localnetv1_services_proto_msgTypes[10]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -842,7 +1057,7 @@ func (x *EndpointScopes) String() string {
 func (*EndpointScopes) ProtoMessage() {}
 
 func (x *EndpointScopes) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[9]
+	mi := &file_api_localnetv1_services_proto_msgTypes[10]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -855,7 +1070,7 @@ func (x *EndpointScopes) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use EndpointScopes.ProtoReflect.Descriptor instead.
 func (*EndpointScopes) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{9}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{10}
 }
 
 func (x *EndpointScopes) GetInternal() bool {
@@ -884,7 +1099,7 @@ type IPSet struct {
 func (x *IPSet) Reset() {
 	*x = IPSet{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[10]
+		mi := &file_api_localnetv1_services_proto_msgTypes[11]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -897,7 +1112,7 @@ func (x *IPSet) String() string {
 func (*IPSet) ProtoMessage() {}
 
 func (x *IPSet) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[10]
+	mi := &file_api_localnetv1_services_proto_msgTypes[11]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -910,7 +1125,7 @@ func (x *IPSet) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use IPSet.ProtoReflect.Descriptor instead.
 func (*IPSet) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{10}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{11}
 }
 
 func (x *IPSet) GetV4() []string {
@@ -932,14 +1147,15 @@ type PortName struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Name string `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
-	Port int32  `protobuf:"varint,2,opt,name=Port,proto3" json:"Port,omitempty"`
+	Name     string   `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	Port     int32    `protobuf:"varint,2,opt,name=Port,proto3" json:"Port,omitempty"`
+	Protocol Protocol `protobuf:"varint,3,opt,name=Protocol,proto3,enum=localnetv1.Protocol" json:"Protocol,omitempty"`
 }
 
 func (x *PortName) Reset() {
 	*x = PortName{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[11]
+		mi := &file_api_localnetv1_services_proto_msgTypes[12]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -952,7 +1168,7 @@ func (x *PortName) String() string {
 func (*PortName) ProtoMessage() {}
 
 func (x *PortName) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[11]
+	mi := &file_api_localnetv1_services_proto_msgTypes[12]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -965,7 +1181,7 @@ func (x *PortName) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PortName.ProtoReflect.Descriptor instead.
 func (*PortName) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{11}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{12}
 }
 
 func (x *PortName) GetName() string {
@@ -982,6 +1198,13 @@ func (x *PortName) GetPort() int32 {
 	return 0
 }
 
+func (x *PortName) GetProtocol() Protocol {
+	if x != nil {
+		return x.Protocol
+	}
+	return Protocol_UnknownProtocol
+}
+
 type PortMapping struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -998,7 +1221,7 @@ type PortMapping struct {
 func (x *PortMapping) Reset() {
 	*x = PortMapping{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[12]
+		mi := &file_api_localnetv1_services_proto_msgTypes[13]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1011,7 +1234,7 @@ func (x *PortMapping) String() string {
 func (*PortMapping) ProtoMessage() {}
 
 func (x *PortMapping) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[12]
+	mi := &file_api_localnetv1_services_proto_msgTypes[13]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1024,7 +1247,7 @@ func (x *PortMapping) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PortMapping.ProtoReflect.Descriptor instead.
 func (*PortMapping) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{12}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{13}
 }
 
 func (x *PortMapping) GetName() string {
@@ -1069,6 +1292,80 @@ func (x *PortMapping) GetTargetPortName() string {
 	return ""
 }
 
+// PortRange maps a range of ports to a range of the same size on the endpoints
+type PortRange struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Protocol Protocol `protobuf:"varint,1,opt,name=Protocol,proto3,enum=localnetv1.Protocol" json:"Protocol,omitempty"`
+	// Port and EndPort are the first and last ports of the range
+	Port    int32 `protobuf:"varint,2,opt,name=Port,proto3" json:"Port,omitempty"`
+	EndPort int32 `protobuf:"varint,3,opt,name=EndPort,proto3" json:"EndPort,omitempty"`
+	// TargetPort is the endpoints' port of the first port of the range
+	TargetPort int32 `protobuf:"varint,4,opt,name=TargetPort,proto3" json:"TargetPort,omitempty"`
+}
+
+func (x *PortRange) Reset() {
+	*x = PortRange{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_localnetv1_services_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PortRange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PortRange) ProtoMessage() {}
+
+func (x *PortRange) ProtoReflect() protoreflect.Message {
+	mi := &file_api_localnetv1_services_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PortRange.ProtoReflect.Descriptor instead.
+func (*PortRange) Descriptor() ([]byte, []int) {
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *PortRange) GetProtocol() Protocol {
+	if x != nil {
+		return x.Protocol
+	}
+	return Protocol_UnknownProtocol
+}
+
+func (x *PortRange) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *PortRange) GetEndPort() int32 {
+	if x != nil {
+		return x.EndPort
+	}
+	return 0
+}
+
+func (x *PortRange) GetTargetPort() int32 {
+	if x != nil {
+		return x.TargetPort
+	}
+	return 0
+}
+
 type ClientIPAffinity struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -1080,7 +1377,7 @@ type ClientIPAffinity struct {
 func (x *ClientIPAffinity) Reset() {
 	*x = ClientIPAffinity{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[13]
+		mi := &file_api_localnetv1_services_proto_msgTypes[15]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1093,7 +1390,7 @@ func (x *ClientIPAffinity) String() string {
 func (*ClientIPAffinity) ProtoMessage() {}
 
 func (x *ClientIPAffinity) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[13]
+	mi := &file_api_localnetv1_services_proto_msgTypes[15]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1106,7 +1403,7 @@ func (x *ClientIPAffinity) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ClientIPAffinity.ProtoReflect.Descriptor instead.
 func (*ClientIPAffinity) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{13}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{15}
 }
 
 func (x *ClientIPAffinity) GetTimeoutSeconds() int32 {
@@ -1128,7 +1425,7 @@ type ServiceInfo struct {
 func (x *ServiceInfo) Reset() {
 	*x = ServiceInfo{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[14]
+		mi := &file_api_localnetv1_services_proto_msgTypes[16]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1141,7 +1438,7 @@ func (x *ServiceInfo) String() string {
 func (*ServiceInfo) ProtoMessage() {}
 
 func (x *ServiceInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[14]
+	mi := &file_api_localnetv1_services_proto_msgTypes[16]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1154,7 +1451,7 @@ func (x *ServiceInfo) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ServiceInfo.ProtoReflect.Descriptor instead.
 func (*ServiceInfo) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{14}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{16}
 }
 
 func (x *ServiceInfo) GetHash() uint64 {
@@ -1190,7 +1487,7 @@ type EndpointInfo struct {
 func (x *EndpointInfo) Reset() {
 	*x = EndpointInfo{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[15]
+		mi := &file_api_localnetv1_services_proto_msgTypes[17]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1203,7 +1500,7 @@ func (x *EndpointInfo) String() string {
 func (*EndpointInfo) ProtoMessage() {}
 
 func (x *EndpointInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[15]
+	mi := &file_api_localnetv1_services_proto_msgTypes[17]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1216,7 +1513,7 @@ func (x *EndpointInfo) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use EndpointInfo.ProtoReflect.Descriptor instead.
 func (*EndpointInfo) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{15}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{17}
 }
 
 func (x *EndpointInfo) GetHash() uint64 {
@@ -1287,13 +1584,15 @@ type EndpointConditions struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Ready bool `protobuf:"varint,1,opt,name=Ready,proto3" json:"Ready,omitempty"`
+	Ready       bool `protobuf:"varint,1,opt,name=Ready,proto3" json:"Ready,omitempty"`
+	Serving     bool `protobuf:"varint,2,opt,name=Serving,proto3" json:"Serving,omitempty"`
+	Terminating bool `protobuf:"varint,3,opt,name=Terminating,proto3" json:"Terminating,omitempty"`
 }
 
 func (x *EndpointConditions) Reset() {
 	*x = EndpointConditions{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[16]
+		mi := &file_api_localnetv1_services_proto_msgTypes[18]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1306,7 +1605,7 @@ func (x *EndpointConditions) String() string {
 func (*EndpointConditions) ProtoMessage() {}
 
 func (x *EndpointConditions) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[16]
+	mi := &file_api_localnetv1_services_proto_msgTypes[18]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1319,7 +1618,7 @@ func (x *EndpointConditions) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use EndpointConditions.ProtoReflect.Descriptor instead.
 func (*EndpointConditions) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{16}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{18}
 }
 
 func (x *EndpointConditions) GetReady() bool {
@@ -1329,6 +1628,20 @@ func (x *EndpointConditions) GetReady() bool {
 	return false
 }
 
+func (x *EndpointConditions) GetServing() bool {
+	if x != nil {
+		return x.Serving
+	}
+	return false
+}
+
+func (x *EndpointConditions) GetTerminating() bool {
+	if x != nil {
+		return x.Terminating
+	}
+	return false
+}
+
 type TopologyInfo struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -1336,12 +1649,14 @@ type TopologyInfo struct {
 
 	Node string `protobuf:"bytes,1,opt,name=Node,proto3" json:"Node,omitempty"`
 	Zone string `protobuf:"bytes,2,opt,name=Zone,proto3" json:"Zone,omitempty"`
+	// Region is only set for nodes (from the topology.kubernetes.io/region label)
+	Region string `protobuf:"bytes,3,opt,name=Region,proto3" json:"Region,omitempty"`
 }
 
 func (x *TopologyInfo) Reset() {
 	*x = TopologyInfo{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[17]
+		mi := &file_api_localnetv1_services_proto_msgTypes[19]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1354,7 +1669,7 @@ func (x *TopologyInfo) String() string {
 func (*TopologyInfo) ProtoMessage() {}
 
 func (x *TopologyInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[17]
+	mi := &file_api_localnetv1_services_proto_msgTypes[19]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1367,7 +1682,7 @@ func (x *TopologyInfo) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TopologyInfo.ProtoReflect.Descriptor instead.
 func (*TopologyInfo) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{17}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{19}
 }
 
 func (x *TopologyInfo) GetNode() string {
@@ -1384,6 +1699,13 @@ func (x *TopologyInfo) GetZone() string {
 	return ""
 }
 
+func (x *TopologyInfo) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
 type TopologyHints struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -1395,7 +1717,7 @@ type TopologyHints struct {
 func (x *TopologyHints) Reset() {
 	*x = TopologyHints{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[18]
+		mi := &file_api_localnetv1_services_proto_msgTypes[20]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1408,7 +1730,7 @@ func (x *TopologyHints) String() string {
 func (*TopologyHints) ProtoMessage() {}
 
 func (x *TopologyHints) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[18]
+	mi := &file_api_localnetv1_services_proto_msgTypes[20]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1421,7 +1743,7 @@ func (x *TopologyHints) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TopologyHints.ProtoReflect.Descriptor instead.
 func (*TopologyHints) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{18}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{20}
 }
 
 func (x *TopologyHints) GetZones() []string {
@@ -1443,7 +1765,7 @@ type NodeInfo struct {
 func (x *NodeInfo) Reset() {
 	*x = NodeInfo{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[19]
+		mi := &file_api_localnetv1_services_proto_msgTypes[21]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1456,7 +1778,7 @@ func (x *NodeInfo) String() string {
 func (*NodeInfo) ProtoMessage() {}
 
 func (x *NodeInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[19]
+	mi := &file_api_localnetv1_services_proto_msgTypes[21]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1469,7 +1791,7 @@ func (x *NodeInfo) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use NodeInfo.ProtoReflect.Descriptor instead.
 func (*NodeInfo) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{19}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{21}
 }
 
 func (x *NodeInfo) GetHash() uint64 {
@@ -1500,7 +1822,7 @@ type Node struct {
 func (x *Node) Reset() {
 	*x = Node{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[20]
+		mi := &file_api_localnetv1_services_proto_msgTypes[22]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1513,7 +1835,7 @@ func (x *Node) String() string {
 func (*Node) ProtoMessage() {}
 
 func (x *Node) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[20]
+	mi := &file_api_localnetv1_services_proto_msgTypes[22]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1526,7 +1848,7 @@ func (x *Node) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Node.ProtoReflect.Descriptor instead.
 func (*Node) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{20}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{22}
 }
 
 func (x *Node) GetName() string {
@@ -1557,16 +1879,130 @@ func (x *Node) GetAnnotations() map[string]string {
 	return nil
 }
 
+// NodeLocalState is the whole local state of a node, as exported by the file backend.
+type NodeLocalState struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	NodeName string              `protobuf:"bytes,1,opt,name=NodeName,proto3" json:"NodeName,omitempty"`
+	Services []*ServiceEndpoints `protobuf:"bytes,2,rep,name=Services,proto3" json:"Services,omitempty"`
+}
+
+func (x *NodeLocalState) Reset() {
+	*x = NodeLocalState{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_localnetv1_services_proto_msgTypes[23]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *NodeLocalState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NodeLocalState) ProtoMessage() {}
+
+func (x *NodeLocalState) ProtoReflect() protoreflect.Message {
+	mi := &file_api_localnetv1_services_proto_msgTypes[23]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NodeLocalState.ProtoReflect.Descriptor instead.
+func (*NodeLocalState) Descriptor() ([]byte, []int) {
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *NodeLocalState) GetNodeName() string {
+	if x != nil {
+		return x.NodeName
+	}
+	return ""
+}
+
+func (x *NodeLocalState) GetServices() []*ServiceEndpoints {
+	if x != nil {
+		return x.Services
+	}
+	return nil
+}
+
+type ServiceEndpoints struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Service   *Service    `protobuf:"bytes,1,opt,name=Service,proto3" json:"Service,omitempty"`
+	Endpoints []*Endpoint `protobuf:"bytes,2,rep,name=Endpoints,proto3" json:"Endpoints,omitempty"`
+}
+
+func (x *ServiceEndpoints) Reset() {
+	*x = ServiceEndpoints{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_localnetv1_services_proto_msgTypes[24]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ServiceEndpoints) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServiceEndpoints) ProtoMessage() {}
+
+func (x *ServiceEndpoints) ProtoReflect() protoreflect.Message {
+	mi := &file_api_localnetv1_services_proto_msgTypes[24]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServiceEndpoints.ProtoReflect.Descriptor instead.
+func (*ServiceEndpoints) Descriptor() ([]byte, []int) {
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *ServiceEndpoints) GetService() *Service {
+	if x != nil {
+		return x.Service
+	}
+	return nil
+}
+
+func (x *ServiceEndpoints) GetEndpoints() []*Endpoint {
+	if x != nil {
+		return x.Endpoints
+	}
+	return nil
+}
+
 type GlobalWatchReq struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
+
+	// Revision is the last revision applied by the requester (see WatchReq.Revision).
+	Revision uint64 `protobuf:"varint,1,opt,name=Revision,proto3" json:"Revision,omitempty"`
 }
 
 func (x *GlobalWatchReq) Reset() {
 	*x = GlobalWatchReq{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_localnetv1_services_proto_msgTypes[21]
+		mi := &file_api_localnetv1_services_proto_msgTypes[25]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -1579,7 +2015,7 @@ func (x *GlobalWatchReq) String() string {
 func (*GlobalWatchReq) ProtoMessage() {}
 
 func (x *GlobalWatchReq) ProtoReflect() protoreflect.Message {
-	mi := &file_api_localnetv1_services_proto_msgTypes[21]
+	mi := &file_api_localnetv1_services_proto_msgTypes[25]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1592,7 +2028,315 @@ func (x *GlobalWatchReq) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GlobalWatchReq.ProtoReflect.Descriptor instead.
 func (*GlobalWatchReq) Descriptor() ([]byte, []int) {
-	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{21}
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *GlobalWatchReq) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+type JournalRevisionsReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Since restricts the revisions to those recorded after this time (unix nanoseconds, all if 0).
+	Since int64 `protobuf:"varint,1,opt,name=Since,proto3" json:"Since,omitempty"`
+	// Service restricts the changes to those of a service (namespace/name, all if empty).
+	Service string `protobuf:"bytes,2,opt,name=Service,proto3" json:"Service,omitempty"`
+}
+
+func (x *JournalRevisionsReq) Reset() {
+	*x = JournalRevisionsReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_localnetv1_services_proto_msgTypes[26]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *JournalRevisionsReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JournalRevisionsReq) ProtoMessage() {}
+
+func (x *JournalRevisionsReq) ProtoReflect() protoreflect.Message {
+	mi := &file_api_localnetv1_services_proto_msgTypes[26]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JournalRevisionsReq.ProtoReflect.Descriptor instead.
+func (*JournalRevisionsReq) Descriptor() ([]byte, []int) {
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *JournalRevisionsReq) GetSince() int64 {
+	if x != nil {
+		return x.Since
+	}
+	return 0
+}
+
+func (x *JournalRevisionsReq) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+type JournalRevisionsReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Entries []*JournalEntry `protobuf:"bytes,1,rep,name=Entries,proto3" json:"Entries,omitempty"`
+}
+
+func (x *JournalRevisionsReply) Reset() {
+	*x = JournalRevisionsReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_localnetv1_services_proto_msgTypes[27]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *JournalRevisionsReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JournalRevisionsReply) ProtoMessage() {}
+
+func (x *JournalRevisionsReply) ProtoReflect() protoreflect.Message {
+	mi := &file_api_localnetv1_services_proto_msgTypes[27]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JournalRevisionsReply.ProtoReflect.Descriptor instead.
+func (*JournalRevisionsReply) Descriptor() ([]byte, []int) {
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *JournalRevisionsReply) GetEntries() []*JournalEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+type JournalEntry struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Revision uint64 `protobuf:"varint,1,opt,name=Revision,proto3" json:"Revision,omitempty"`
+	// Time is the time the revision was recorded (unix nanoseconds).
+	Time int64 `protobuf:"varint,2,opt,name=Time,proto3" json:"Time,omitempty"`
+	// FullState is true if Ops is the whole state instead of the changes from the previous revision.
+	FullState bool `protobuf:"varint,3,opt,name=FullState,proto3" json:"FullState,omitempty"`
+	// Ops are the Set and Delete operations of the revision.
+	Ops []*OpItem `protobuf:"bytes,4,rep,name=Ops,proto3" json:"Ops,omitempty"`
+}
+
+func (x *JournalEntry) Reset() {
+	*x = JournalEntry{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_localnetv1_services_proto_msgTypes[28]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *JournalEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JournalEntry) ProtoMessage() {}
+
+func (x *JournalEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_api_localnetv1_services_proto_msgTypes[28]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JournalEntry.ProtoReflect.Descriptor instead.
+func (*JournalEntry) Descriptor() ([]byte, []int) {
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *JournalEntry) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *JournalEntry) GetTime() int64 {
+	if x != nil {
+		return x.Time
+	}
+	return 0
+}
+
+func (x *JournalEntry) GetFullState() bool {
+	if x != nil {
+		return x.FullState
+	}
+	return false
+}
+
+func (x *JournalEntry) GetOps() []*OpItem {
+	if x != nil {
+		return x.Ops
+	}
+	return nil
+}
+
+type JournalDiffReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// From is the revision held by the requester.
+	From uint64 `protobuf:"varint,1,opt,name=From,proto3" json:"From,omitempty"`
+	// To is the revision to diff to (the latest if 0).
+	To uint64 `protobuf:"varint,2,opt,name=To,proto3" json:"To,omitempty"`
+	// Service restricts the changes to those of a service (namespace/name, all if empty).
+	Service string `protobuf:"bytes,3,opt,name=Service,proto3" json:"Service,omitempty"`
+}
+
+func (x *JournalDiffReq) Reset() {
+	*x = JournalDiffReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_localnetv1_services_proto_msgTypes[29]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *JournalDiffReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JournalDiffReq) ProtoMessage() {}
+
+func (x *JournalDiffReq) ProtoReflect() protoreflect.Message {
+	mi := &file_api_localnetv1_services_proto_msgTypes[29]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JournalDiffReq.ProtoReflect.Descriptor instead.
+func (*JournalDiffReq) Descriptor() ([]byte, []int) {
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *JournalDiffReq) GetFrom() uint64 {
+	if x != nil {
+		return x.From
+	}
+	return 0
+}
+
+func (x *JournalDiffReq) GetTo() uint64 {
+	if x != nil {
+		return x.To
+	}
+	return 0
+}
+
+func (x *JournalDiffReq) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+type JournalDiffReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Revision is the revision the diff leads to.
+	Revision uint64 `protobuf:"varint,1,opt,name=Revision,proto3" json:"Revision,omitempty"`
+	// Ops are the Set and Delete operations to apply to the From revision to get Revision.
+	Ops []*OpItem `protobuf:"bytes,2,rep,name=Ops,proto3" json:"Ops,omitempty"`
+}
+
+func (x *JournalDiffReply) Reset() {
+	*x = JournalDiffReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_localnetv1_services_proto_msgTypes[30]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *JournalDiffReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JournalDiffReply) ProtoMessage() {}
+
+func (x *JournalDiffReply) ProtoReflect() protoreflect.Message {
+	mi := &file_api_localnetv1_services_proto_msgTypes[30]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JournalDiffReply.ProtoReflect.Descriptor instead.
+func (*JournalDiffReply) Descriptor() ([]byte, []int) {
+	return file_api_localnetv1_services_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *JournalDiffReply) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *JournalDiffReply) GetOps() []*OpItem {
+	if x != nil {
+		return x.Ops
+	}
+	return nil
 }
 
 var File_api_localnetv1_services_proto protoreflect.FileDescriptor
@@ -1600,105 +2344,155 @@ var File_api_localnetv1_services_proto protoreflect.FileDescriptor
 var file_api_localnetv1_services_proto_rawDesc = []byte{
 	0x0a, 0x1d, 0x61, 0x70, 0x69, 0x2f, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31,
 	0x2f, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12,
-	0x0a, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x22, 0x26, 0x0a, 0x08, 0x57,
+	0x0a, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x22, 0x66, 0x0a, 0x08, 0x57,
 	0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71, 0x12, 0x1a, 0x0a, 0x08, 0x4e, 0x6f, 0x64, 0x65, 0x4e,
 	0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x4e, 0x6f, 0x64, 0x65, 0x4e,
-	0x61, 0x6d, 0x65, 0x22, 0xb8, 0x01, 0x0a, 0x06, 0x4f, 0x70, 0x49, 0x74, 0x65, 0x6d, 0x12, 0x29,
-	0x0a, 0x04, 0x53, 0x79, 0x6e, 0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x6c,
-	0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x4f,
-	0x70, 0x48, 0x00, 0x52, 0x04, 0x53, 0x79, 0x6e, 0x63, 0x12, 0x2b, 0x0a, 0x05, 0x52, 0x65, 0x73,
-	0x65, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c,
-	0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x4f, 0x70, 0x48, 0x00, 0x52,
-	0x05, 0x52, 0x65, 0x73, 0x65, 0x74, 0x12, 0x25, 0x0a, 0x03, 0x53, 0x65, 0x74, 0x18, 0x02, 0x20,
+	0x61, 0x6d, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x54, 0x79,
+	0x70, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0c, 0x53, 0x65, 0x72, 0x76, 0x69,
+	0x63, 0x65, 0x54, 0x79, 0x70, 0x65, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73,
+	0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73,
+	0x69, 0x6f, 0x6e, 0x22, 0xb7, 0x01, 0x0a, 0x06, 0x4f, 0x70, 0x49, 0x74, 0x65, 0x6d, 0x12, 0x28,
+	0x0a, 0x04, 0x53, 0x79, 0x6e, 0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x6c,
+	0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x53, 0x79, 0x6e, 0x63, 0x4f, 0x70,
+	0x48, 0x00, 0x52, 0x04, 0x53, 0x79, 0x6e, 0x63, 0x12, 0x2b, 0x0a, 0x05, 0x52, 0x65, 0x73, 0x65,
+	0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e,
+	0x65, 0x74, 0x76, 0x31, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x4f, 0x70, 0x48, 0x00, 0x52, 0x05,
+	0x52, 0x65, 0x73, 0x65, 0x74, 0x12, 0x25, 0x0a, 0x03, 0x53, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e,
+	0x56, 0x61, 0x6c, 0x75, 0x65, 0x48, 0x00, 0x52, 0x03, 0x53, 0x65, 0x74, 0x12, 0x29, 0x0a, 0x06,
+	0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x6c,
+	0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x66, 0x48, 0x00, 0x52,
+	0x06, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x42, 0x04, 0x0a, 0x02, 0x4f, 0x70, 0x22, 0x09, 0x0a,
+	0x07, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x4f, 0x70, 0x22, 0x46, 0x0a, 0x06, 0x53, 0x79, 0x6e, 0x63,
+	0x4f, 0x70, 0x12, 0x1a, 0x0a, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x20,
+	0x0a, 0x0b, 0x54, 0x72, 0x61, 0x63, 0x65, 0x50, 0x61, 0x72, 0x65, 0x6e, 0x74, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0b, 0x54, 0x72, 0x61, 0x63, 0x65, 0x50, 0x61, 0x72, 0x65, 0x6e, 0x74,
+	0x22, 0x3c, 0x0a, 0x03, 0x52, 0x65, 0x66, 0x12, 0x21, 0x0a, 0x03, 0x53, 0x65, 0x74, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0e, 0x32, 0x0f, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76,
+	0x31, 0x2e, 0x53, 0x65, 0x74, 0x52, 0x03, 0x53, 0x65, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x50, 0x61,
+	0x74, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x50, 0x61, 0x74, 0x68, 0x22, 0x40,
+	0x0a, 0x05, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x21, 0x0a, 0x03, 0x52, 0x65, 0x66, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76,
+	0x31, 0x2e, 0x52, 0x65, 0x66, 0x52, 0x03, 0x52, 0x65, 0x66, 0x12, 0x14, 0x0a, 0x05, 0x42, 0x79,
+	0x74, 0x65, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x42, 0x79, 0x74, 0x65, 0x73,
+	0x22, 0x9c, 0x08, 0x0a, 0x07, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x1c, 0x0a, 0x09,
+	0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x09, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61,
+	0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x12,
+	0x0a, 0x04, 0x54, 0x79, 0x70, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x54, 0x79,
+	0x70, 0x65, 0x12, 0x37, 0x0a, 0x06, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x18, 0x08, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x1f, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e,
+	0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x45, 0x6e,
+	0x74, 0x72, 0x79, 0x52, 0x06, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x12, 0x46, 0x0a, 0x0b, 0x41,
+	0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x09, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x24, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x53, 0x65,
+	0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x41, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x0b, 0x41, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x73, 0x12, 0x28, 0x0a, 0x03, 0x49, 0x50, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x16, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x53, 0x65,
+	0x72, 0x76, 0x69, 0x63, 0x65, 0x49, 0x50, 0x73, 0x52, 0x03, 0x49, 0x50, 0x73, 0x12, 0x32, 0x0a,
+	0x09, 0x49, 0x50, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x73, 0x18, 0x0a, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x14, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x49, 0x50,
+	0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x52, 0x09, 0x49, 0x50, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72,
+	0x73, 0x12, 0x14, 0x0a, 0x05, 0x4d, 0x61, 0x70, 0x49, 0x50, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x05, 0x4d, 0x61, 0x70, 0x49, 0x50, 0x12, 0x2d, 0x0a, 0x05, 0x50, 0x6f, 0x72, 0x74, 0x73,
+	0x18, 0x06, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65,
+	0x74, 0x76, 0x31, 0x2e, 0x50, 0x6f, 0x72, 0x74, 0x4d, 0x61, 0x70, 0x70, 0x69, 0x6e, 0x67, 0x52,
+	0x05, 0x50, 0x6f, 0x72, 0x74, 0x73, 0x12, 0x36, 0x0a, 0x16, 0x45, 0x78, 0x74, 0x65, 0x72, 0x6e,
+	0x61, 0x6c, 0x54, 0x72, 0x61, 0x66, 0x66, 0x69, 0x63, 0x54, 0x6f, 0x4c, 0x6f, 0x63, 0x61, 0x6c,
+	0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52, 0x16, 0x45, 0x78, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c,
+	0x54, 0x72, 0x61, 0x66, 0x66, 0x69, 0x63, 0x54, 0x6f, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x12, 0x3a,
+	0x0a, 0x08, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49, 0x50, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x1c, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x43, 0x6c,
+	0x69, 0x65, 0x6e, 0x74, 0x49, 0x50, 0x41, 0x66, 0x66, 0x69, 0x6e, 0x69, 0x74, 0x79, 0x48, 0x00,
+	0x52, 0x08, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49, 0x50, 0x12, 0x36, 0x0a, 0x16, 0x49, 0x6e,
+	0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x54, 0x72, 0x61, 0x66, 0x66, 0x69, 0x63, 0x54, 0x6f, 0x4c,
+	0x6f, 0x63, 0x61, 0x6c, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x08, 0x52, 0x16, 0x49, 0x6e, 0x74, 0x65,
+	0x72, 0x6e, 0x61, 0x6c, 0x54, 0x72, 0x61, 0x66, 0x66, 0x69, 0x63, 0x54, 0x6f, 0x4c, 0x6f, 0x63,
+	0x61, 0x6c, 0x12, 0x30, 0x0a, 0x13, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68, 0x43, 0x68, 0x65, 0x63,
+	0x6b, 0x4e, 0x6f, 0x64, 0x65, 0x50, 0x6f, 0x72, 0x74, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x13, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x4e, 0x6f, 0x64, 0x65,
+	0x50, 0x6f, 0x72, 0x74, 0x12, 0x34, 0x0a, 0x15, 0x45, 0x78, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c,
+	0x54, 0x72, 0x61, 0x66, 0x66, 0x69, 0x63, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x18, 0x0e, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x15, 0x45, 0x78, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x54, 0x72, 0x61,
+	0x66, 0x66, 0x69, 0x63, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x34, 0x0a, 0x15, 0x49, 0x6e,
+	0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x54, 0x72, 0x61, 0x66, 0x66, 0x69, 0x63, 0x50, 0x6f, 0x6c,
+	0x69, 0x63, 0x79, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x09, 0x52, 0x15, 0x49, 0x6e, 0x74, 0x65, 0x72,
+	0x6e, 0x61, 0x6c, 0x54, 0x72, 0x61, 0x66, 0x66, 0x69, 0x63, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79,
+	0x12, 0x28, 0x0a, 0x0f, 0x46, 0x6f, 0x72, 0x63, 0x65, 0x4d, 0x61, 0x73, 0x71, 0x75, 0x65, 0x72,
+	0x61, 0x64, 0x65, 0x18, 0x10, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0f, 0x46, 0x6f, 0x72, 0x63, 0x65,
+	0x4d, 0x61, 0x73, 0x71, 0x75, 0x65, 0x72, 0x61, 0x64, 0x65, 0x12, 0x35, 0x0a, 0x0a, 0x50, 0x6f,
+	0x72, 0x74, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x73, 0x18, 0x11, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x15,
+	0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x50, 0x6f, 0x72, 0x74,
+	0x52, 0x61, 0x6e, 0x67, 0x65, 0x52, 0x0a, 0x50, 0x6f, 0x72, 0x74, 0x52, 0x61, 0x6e, 0x67, 0x65,
+	0x73, 0x12, 0x3c, 0x0a, 0x19, 0x45, 0x78, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x45, 0x78, 0x70,
+	0x6f, 0x73, 0x75, 0x72, 0x65, 0x53, 0x75, 0x73, 0x70, 0x65, 0x6e, 0x64, 0x65, 0x64, 0x18, 0x12,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x19, 0x45, 0x78, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x45, 0x78,
+	0x70, 0x6f, 0x73, 0x75, 0x72, 0x65, 0x53, 0x75, 0x73, 0x70, 0x65, 0x6e, 0x64, 0x65, 0x64, 0x12,
+	0x30, 0x0a, 0x13, 0x54, 0x72, 0x61, 0x66, 0x66, 0x69, 0x63, 0x44, 0x69, 0x73, 0x74, 0x72, 0x69,
+	0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x13, 0x20, 0x01, 0x28, 0x09, 0x52, 0x13, 0x54, 0x72,
+	0x61, 0x66, 0x66, 0x69, 0x63, 0x44, 0x69, 0x73, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f,
+	0x6e, 0x1a, 0x39, 0x0a, 0x0b, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79,
+	0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b,
+	0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a, 0x3e, 0x0a, 0x10,
+	0x41, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79,
+	0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b,
+	0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x42, 0x11, 0x0a, 0x0f,
+	0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x41, 0x66, 0x66, 0x69, 0x6e, 0x69, 0x74, 0x79, 0x22,
+	0x5f, 0x0a, 0x08, 0x49, 0x50, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x12, 0x2f, 0x0a, 0x09, 0x54,
+	0x61, 0x72, 0x67, 0x65, 0x74, 0x49, 0x50, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11,
+	0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x53, 0x65,
+	0x74, 0x52, 0x09, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x49, 0x50, 0x73, 0x12, 0x22, 0x0a, 0x0c,
+	0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03,
+	0x28, 0x09, 0x52, 0x0c, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x73,
+	0x22, 0xcd, 0x01, 0x0a, 0x0a, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x49, 0x50, 0x73, 0x12,
+	0x31, 0x0a, 0x0a, 0x43, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x49, 0x50, 0x73, 0x18, 0x01, 0x20,
 	0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31,
-	0x2e, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x48, 0x00, 0x52, 0x03, 0x53, 0x65, 0x74, 0x12, 0x29, 0x0a,
-	0x06, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e,
-	0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x66, 0x48, 0x00,
-	0x52, 0x06, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x42, 0x04, 0x0a, 0x02, 0x4f, 0x70, 0x22, 0x09,
-	0x0a, 0x07, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x4f, 0x70, 0x22, 0x3c, 0x0a, 0x03, 0x52, 0x65, 0x66,
-	0x12, 0x21, 0x0a, 0x03, 0x53, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0f, 0x2e,
-	0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x53, 0x65, 0x74, 0x52, 0x03,
-	0x53, 0x65, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x50, 0x61, 0x74, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x04, 0x50, 0x61, 0x74, 0x68, 0x22, 0x40, 0x0a, 0x05, 0x56, 0x61, 0x6c, 0x75, 0x65,
-	0x12, 0x21, 0x0a, 0x03, 0x52, 0x65, 0x66, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e,
-	0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x66, 0x52, 0x03,
-	0x52, 0x65, 0x66, 0x12, 0x14, 0x0a, 0x05, 0x42, 0x79, 0x74, 0x65, 0x73, 0x18, 0x02, 0x20, 0x01,
-	0x28, 0x0c, 0x52, 0x05, 0x42, 0x79, 0x74, 0x65, 0x73, 0x22, 0xad, 0x05, 0x0a, 0x07, 0x53, 0x65,
-	0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61,
-	0x63, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70,
-	0x61, 0x63, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x54, 0x79, 0x70, 0x65, 0x18,
-	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x54, 0x79, 0x70, 0x65, 0x12, 0x37, 0x0a, 0x06, 0x4c,
-	0x61, 0x62, 0x65, 0x6c, 0x73, 0x18, 0x08, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1f, 0x2e, 0x6c, 0x6f,
-	0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65,
-	0x2e, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x06, 0x4c, 0x61,
-	0x62, 0x65, 0x6c, 0x73, 0x12, 0x46, 0x0a, 0x0b, 0x41, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69,
-	0x6f, 0x6e, 0x73, 0x18, 0x09, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x24, 0x2e, 0x6c, 0x6f, 0x63, 0x61,
-	0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x41,
-	0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52,
-	0x0b, 0x41, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x28, 0x0a, 0x03,
-	0x49, 0x50, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x6c, 0x6f, 0x63, 0x61,
-	0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x49, 0x50,
-	0x73, 0x52, 0x03, 0x49, 0x50, 0x73, 0x12, 0x32, 0x0a, 0x09, 0x49, 0x50, 0x46, 0x69, 0x6c, 0x74,
-	0x65, 0x72, 0x73, 0x18, 0x0a, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x6c, 0x6f, 0x63, 0x61,
-	0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x52,
-	0x09, 0x49, 0x50, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x4d, 0x61,
-	0x70, 0x49, 0x50, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x4d, 0x61, 0x70, 0x49, 0x50,
-	0x12, 0x2d, 0x0a, 0x05, 0x50, 0x6f, 0x72, 0x74, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x0b, 0x32,
-	0x17, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x50, 0x6f, 0x72,
-	0x74, 0x4d, 0x61, 0x70, 0x70, 0x69, 0x6e, 0x67, 0x52, 0x05, 0x50, 0x6f, 0x72, 0x74, 0x73, 0x12,
-	0x36, 0x0a, 0x16, 0x45, 0x78, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x54, 0x72, 0x61, 0x66, 0x66,
-	0x69, 0x63, 0x54, 0x6f, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52,
-	0x16, 0x45, 0x78, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x54, 0x72, 0x61, 0x66, 0x66, 0x69, 0x63,
-	0x54, 0x6f, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x12, 0x3a, 0x0a, 0x08, 0x43, 0x6c, 0x69, 0x65, 0x6e,
-	0x74, 0x49, 0x50, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x6c, 0x6f, 0x63, 0x61,
-	0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49, 0x50, 0x41,
-	0x66, 0x66, 0x69, 0x6e, 0x69, 0x74, 0x79, 0x48, 0x00, 0x52, 0x08, 0x43, 0x6c, 0x69, 0x65, 0x6e,
-	0x74, 0x49, 0x50, 0x12, 0x36, 0x0a, 0x16, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x54,
-	0x72, 0x61, 0x66, 0x66, 0x69, 0x63, 0x54, 0x6f, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x18, 0x0c, 0x20,
-	0x01, 0x28, 0x08, 0x52, 0x16, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x54, 0x72, 0x61,
-	0x66, 0x66, 0x69, 0x63, 0x54, 0x6f, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x1a, 0x39, 0x0a, 0x0b, 0x4c,
-	0x61, 0x62, 0x65, 0x6c, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65,
-	0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05,
-	0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c,
-	0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a, 0x3e, 0x0a, 0x10, 0x41, 0x6e, 0x6e, 0x6f, 0x74, 0x61,
-	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65,
-	0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05,
-	0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c,
-	0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x42, 0x11, 0x0a, 0x0f, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f,
-	0x6e, 0x41, 0x66, 0x66, 0x69, 0x6e, 0x69, 0x74, 0x79, 0x22, 0x5f, 0x0a, 0x08, 0x49, 0x50, 0x46,
-	0x69, 0x6c, 0x74, 0x65, 0x72, 0x12, 0x2f, 0x0a, 0x09, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x49,
-	0x50, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c,
-	0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x53, 0x65, 0x74, 0x52, 0x09, 0x54, 0x61, 0x72,
-	0x67, 0x65, 0x74, 0x49, 0x50, 0x73, 0x12, 0x22, 0x0a, 0x0c, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65,
-	0x52, 0x61, 0x6e, 0x67, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0c, 0x53, 0x6f,
-	0x75, 0x72, 0x63, 0x65, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x73, 0x22, 0xcd, 0x01, 0x0a, 0x0a, 0x53,
-	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x49, 0x50, 0x73, 0x12, 0x31, 0x0a, 0x0a, 0x43, 0x6c, 0x75,
-	0x73, 0x74, 0x65, 0x72, 0x49, 0x50, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e,
-	0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x53, 0x65, 0x74,
-	0x52, 0x0a, 0x43, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x49, 0x50, 0x73, 0x12, 0x33, 0x0a, 0x0b,
-	0x45, 0x78, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x49, 0x50, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x0b, 0x32, 0x11, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x49,
-	0x50, 0x53, 0x65, 0x74, 0x52, 0x0b, 0x45, 0x78, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x49, 0x50,
-	0x73, 0x12, 0x3b, 0x0a, 0x0f, 0x4c, 0x6f, 0x61, 0x64, 0x42, 0x61, 0x6c, 0x61, 0x6e, 0x63, 0x65,
-	0x72, 0x49, 0x50, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6c, 0x6f, 0x63,
-	0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x53, 0x65, 0x74, 0x52, 0x0f, 0x4c,
-	0x6f, 0x61, 0x64, 0x42, 0x61, 0x6c, 0x61, 0x6e, 0x63, 0x65, 0x72, 0x49, 0x50, 0x73, 0x12, 0x1a,
-	0x0a, 0x08, 0x48, 0x65, 0x61, 0x64, 0x6c, 0x65, 0x73, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08,
-	0x52, 0x08, 0x48, 0x65, 0x61, 0x64, 0x6c, 0x65, 0x73, 0x73, 0x22, 0xd1, 0x01, 0x0a, 0x08, 0x45,
-	0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x48, 0x6f, 0x73, 0x74, 0x6e,
-	0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x48, 0x6f, 0x73, 0x74, 0x6e,
-	0x61, 0x6d, 0x65, 0x12, 0x23, 0x0a, 0x03, 0x49, 0x50, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b,
+	0x2e, 0x49, 0x50, 0x53, 0x65, 0x74, 0x52, 0x0a, 0x43, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x49,
+	0x50, 0x73, 0x12, 0x33, 0x0a, 0x0b, 0x45, 0x78, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x49, 0x50,
+	0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e,
+	0x65, 0x74, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x53, 0x65, 0x74, 0x52, 0x0b, 0x45, 0x78, 0x74, 0x65,
+	0x72, 0x6e, 0x61, 0x6c, 0x49, 0x50, 0x73, 0x12, 0x3b, 0x0a, 0x0f, 0x4c, 0x6f, 0x61, 0x64, 0x42,
+	0x61, 0x6c, 0x61, 0x6e, 0x63, 0x65, 0x72, 0x49, 0x50, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b,
 	0x32, 0x11, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x49, 0x50,
-	0x53, 0x65, 0x74, 0x52, 0x03, 0x49, 0x50, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x4c, 0x6f, 0x63, 0x61,
-	0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x12, 0x3a,
-	0x0a, 0x0d, 0x50, 0x6f, 0x72, 0x74, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65, 0x73, 0x18,
-	0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74,
-	0x76, 0x31, 0x2e, 0x50, 0x6f, 0x72, 0x74, 0x4e, 0x61, 0x6d, 0x65, 0x52, 0x0d, 0x50, 0x6f, 0x72,
-	0x74, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65, 0x73, 0x12, 0x32, 0x0a, 0x06, 0x53, 0x63,
-	0x6f, 0x70, 0x65, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x6c, 0x6f, 0x63,
-	0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74,
-	0x53, 0x63, 0x6f, 0x70, 0x65, 0x73, 0x52, 0x06, 0x53, 0x63, 0x6f, 0x70, 0x65, 0x73, 0x22, 0x48,
+	0x53, 0x65, 0x74, 0x52, 0x0f, 0x4c, 0x6f, 0x61, 0x64, 0x42, 0x61, 0x6c, 0x61, 0x6e, 0x63, 0x65,
+	0x72, 0x49, 0x50, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x48, 0x65, 0x61, 0x64, 0x6c, 0x65, 0x73, 0x73,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x48, 0x65, 0x61, 0x64, 0x6c, 0x65, 0x73, 0x73,
+	0x22, 0xfb, 0x03, 0x0a, 0x08, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x12, 0x1a, 0x0a,
+	0x08, 0x48, 0x6f, 0x73, 0x74, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x08, 0x48, 0x6f, 0x73, 0x74, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x23, 0x0a, 0x03, 0x49, 0x50, 0x73,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65,
+	0x74, 0x76, 0x31, 0x2e, 0x49, 0x50, 0x53, 0x65, 0x74, 0x52, 0x03, 0x49, 0x50, 0x73, 0x12, 0x14,
+	0x0a, 0x05, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x4c,
+	0x6f, 0x63, 0x61, 0x6c, 0x12, 0x3a, 0x0a, 0x0d, 0x50, 0x6f, 0x72, 0x74, 0x4f, 0x76, 0x65, 0x72,
+	0x72, 0x69, 0x64, 0x65, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x6c, 0x6f,
+	0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x50, 0x6f, 0x72, 0x74, 0x4e, 0x61, 0x6d,
+	0x65, 0x52, 0x0d, 0x50, 0x6f, 0x72, 0x74, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65, 0x73,
+	0x12, 0x32, 0x0a, 0x06, 0x53, 0x63, 0x6f, 0x70, 0x65, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x1a, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x45, 0x6e,
+	0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x53, 0x63, 0x6f, 0x70, 0x65, 0x73, 0x52, 0x06, 0x53, 0x63,
+	0x6f, 0x70, 0x65, 0x73, 0x12, 0x3e, 0x0a, 0x0a, 0x43, 0x6f, 0x6e, 0x64, 0x69, 0x74, 0x69, 0x6f,
+	0x6e, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1e, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c,
+	0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x43, 0x6f,
+	0x6e, 0x64, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x0a, 0x43, 0x6f, 0x6e, 0x64, 0x69, 0x74,
+	0x69, 0x6f, 0x6e, 0x73, 0x12, 0x34, 0x0a, 0x08, 0x54, 0x6f, 0x70, 0x6f, 0x6c, 0x6f, 0x67, 0x79,
+	0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65,
+	0x74, 0x76, 0x31, 0x2e, 0x54, 0x6f, 0x70, 0x6f, 0x6c, 0x6f, 0x67, 0x79, 0x49, 0x6e, 0x66, 0x6f,
+	0x52, 0x08, 0x54, 0x6f, 0x70, 0x6f, 0x6c, 0x6f, 0x67, 0x79, 0x12, 0x2f, 0x0a, 0x05, 0x48, 0x69,
+	0x6e, 0x74, 0x73, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x6c, 0x6f, 0x63, 0x61,
+	0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x54, 0x6f, 0x70, 0x6f, 0x6c, 0x6f, 0x67, 0x79, 0x48,
+	0x69, 0x6e, 0x74, 0x73, 0x52, 0x05, 0x48, 0x69, 0x6e, 0x74, 0x73, 0x12, 0x39, 0x0a, 0x0b, 0x54,
+	0x61, 0x72, 0x67, 0x65, 0x74, 0x50, 0x6f, 0x72, 0x74, 0x73, 0x18, 0x09, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x17, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x50, 0x6f,
+	0x72, 0x74, 0x4d, 0x61, 0x70, 0x70, 0x69, 0x6e, 0x67, 0x52, 0x0b, 0x54, 0x61, 0x72, 0x67, 0x65,
+	0x74, 0x50, 0x6f, 0x72, 0x74, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x4e, 0x6f, 0x64, 0x65, 0x4e, 0x61,
+	0x6d, 0x65, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x4e, 0x6f, 0x64, 0x65, 0x4e, 0x61,
+	0x6d, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x57, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x0b, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x06, 0x57, 0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x46, 0x51,
+	0x44, 0x4e, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x46, 0x51, 0x44, 0x4e, 0x22, 0x48,
 	0x0a, 0x0e, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x53, 0x63, 0x6f, 0x70, 0x65, 0x73,
 	0x12, 0x1a, 0x0a, 0x08, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x18, 0x01, 0x20, 0x01,
 	0x28, 0x08, 0x52, 0x08, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x12, 0x1a, 0x0a, 0x08,
@@ -1706,23 +2500,35 @@ var file_api_localnetv1_services_proto_rawDesc = []byte{
 	0x45, 0x78, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x22, 0x27, 0x0a, 0x05, 0x49, 0x50, 0x53, 0x65,
 	0x74, 0x12, 0x0e, 0x0a, 0x02, 0x56, 0x34, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x02, 0x56,
 	0x34, 0x12, 0x0e, 0x0a, 0x02, 0x56, 0x36, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x02, 0x56,
-	0x36, 0x22, 0x32, 0x0a, 0x08, 0x50, 0x6f, 0x72, 0x74, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x12, 0x0a,
+	0x36, 0x22, 0x64, 0x0a, 0x08, 0x50, 0x6f, 0x72, 0x74, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x12, 0x0a,
 	0x04, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d,
 	0x65, 0x12, 0x12, 0x0a, 0x04, 0x50, 0x6f, 0x72, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52,
-	0x04, 0x50, 0x6f, 0x72, 0x74, 0x22, 0xcb, 0x01, 0x0a, 0x0b, 0x50, 0x6f, 0x72, 0x74, 0x4d, 0x61,
-	0x70, 0x70, 0x69, 0x6e, 0x67, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x30, 0x0a, 0x08, 0x50, 0x72, 0x6f,
-	0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x14, 0x2e, 0x6c, 0x6f,
-	0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f,
-	0x6c, 0x52, 0x08, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x50,
-	0x6f, 0x72, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x50, 0x6f, 0x72, 0x74, 0x12,
-	0x1a, 0x0a, 0x08, 0x4e, 0x6f, 0x64, 0x65, 0x50, 0x6f, 0x72, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28,
-	0x05, 0x52, 0x08, 0x4e, 0x6f, 0x64, 0x65, 0x50, 0x6f, 0x72, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x54,
-	0x61, 0x72, 0x67, 0x65, 0x74, 0x50, 0x6f, 0x72, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x05, 0x52,
-	0x0a, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x50, 0x6f, 0x72, 0x74, 0x12, 0x26, 0x0a, 0x0e, 0x54,
-	0x61, 0x72, 0x67, 0x65, 0x74, 0x50, 0x6f, 0x72, 0x74, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x06, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x0e, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x50, 0x6f, 0x72, 0x74, 0x4e,
-	0x61, 0x6d, 0x65, 0x22, 0x3a, 0x0a, 0x10, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49, 0x50, 0x41,
+	0x04, 0x50, 0x6f, 0x72, 0x74, 0x12, 0x30, 0x0a, 0x08, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f,
+	0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x14, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e,
+	0x65, 0x74, 0x76, 0x31, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x52, 0x08, 0x50,
+	0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x22, 0xcb, 0x01, 0x0a, 0x0b, 0x50, 0x6f, 0x72, 0x74,
+	0x4d, 0x61, 0x70, 0x70, 0x69, 0x6e, 0x67, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x30, 0x0a, 0x08, 0x50,
+	0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x14, 0x2e,
+	0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f,
+	0x63, 0x6f, 0x6c, 0x52, 0x08, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x12, 0x12, 0x0a,
+	0x04, 0x50, 0x6f, 0x72, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x50, 0x6f, 0x72,
+	0x74, 0x12, 0x1a, 0x0a, 0x08, 0x4e, 0x6f, 0x64, 0x65, 0x50, 0x6f, 0x72, 0x74, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x08, 0x4e, 0x6f, 0x64, 0x65, 0x50, 0x6f, 0x72, 0x74, 0x12, 0x1e, 0x0a,
+	0x0a, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x50, 0x6f, 0x72, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x0a, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x50, 0x6f, 0x72, 0x74, 0x12, 0x26, 0x0a,
+	0x0e, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x50, 0x6f, 0x72, 0x74, 0x4e, 0x61, 0x6d, 0x65, 0x18,
+	0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x50, 0x6f, 0x72,
+	0x74, 0x4e, 0x61, 0x6d, 0x65, 0x22, 0x8b, 0x01, 0x0a, 0x09, 0x50, 0x6f, 0x72, 0x74, 0x52, 0x61,
+	0x6e, 0x67, 0x65, 0x12, 0x30, 0x0a, 0x08, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x14, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74,
+	0x76, 0x31, 0x2e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x52, 0x08, 0x50, 0x72, 0x6f,
+	0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x50, 0x6f, 0x72, 0x74, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x04, 0x50, 0x6f, 0x72, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x45, 0x6e, 0x64,
+	0x50, 0x6f, 0x72, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x07, 0x45, 0x6e, 0x64, 0x50,
+	0x6f, 0x72, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x50, 0x6f, 0x72,
+	0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0a, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x50,
+	0x6f, 0x72, 0x74, 0x22, 0x3a, 0x0a, 0x10, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49, 0x50, 0x41,
 	0x66, 0x66, 0x69, 0x6e, 0x69, 0x74, 0x79, 0x12, 0x26, 0x0a, 0x0e, 0x54, 0x69, 0x6d, 0x65, 0x6f,
 	0x75, 0x74, 0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52,
 	0x0e, 0x54, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x22,
@@ -1755,65 +2561,129 @@ var file_api_localnetv1_services_proto_rawDesc = []byte{
 	0x73, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e,
 	0x65, 0x74, 0x76, 0x31, 0x2e, 0x54, 0x6f, 0x70, 0x6f, 0x6c, 0x6f, 0x67, 0x79, 0x48, 0x69, 0x6e,
 	0x74, 0x73, 0x52, 0x05, 0x48, 0x69, 0x6e, 0x74, 0x73, 0x4a, 0x04, 0x08, 0x05, 0x10, 0x06, 0x22,
-	0x2a, 0x0a, 0x12, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x43, 0x6f, 0x6e, 0x64, 0x69,
+	0x66, 0x0a, 0x12, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x43, 0x6f, 0x6e, 0x64, 0x69,
 	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x52, 0x65, 0x61, 0x64, 0x79, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x52, 0x65, 0x61, 0x64, 0x79, 0x22, 0x36, 0x0a, 0x0c, 0x54,
-	0x6f, 0x70, 0x6f, 0x6c, 0x6f, 0x67, 0x79, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x12, 0x0a, 0x04, 0x4e,
-	0x6f, 0x64, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x6f, 0x64, 0x65, 0x12,
-	0x12, 0x0a, 0x04, 0x5a, 0x6f, 0x6e, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x5a,
-	0x6f, 0x6e, 0x65, 0x22, 0x25, 0x0a, 0x0d, 0x54, 0x6f, 0x70, 0x6f, 0x6c, 0x6f, 0x67, 0x79, 0x48,
-	0x69, 0x6e, 0x74, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x5a, 0x6f, 0x6e, 0x65, 0x73, 0x18, 0x01, 0x20,
-	0x03, 0x28, 0x09, 0x52, 0x05, 0x5a, 0x6f, 0x6e, 0x65, 0x73, 0x22, 0x44, 0x0a, 0x08, 0x4e, 0x6f,
-	0x64, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x12, 0x0a, 0x04, 0x48, 0x61, 0x73, 0x68, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x04, 0x52, 0x04, 0x48, 0x61, 0x73, 0x68, 0x12, 0x24, 0x0a, 0x04, 0x4e, 0x6f,
-	0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c,
-	0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x4e, 0x6f, 0x64, 0x65, 0x52, 0x04, 0x4e, 0x6f, 0x64, 0x65,
-	0x22, 0xc6, 0x02, 0x0a, 0x04, 0x4e, 0x6f, 0x64, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61, 0x6d,
-	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x34, 0x0a,
-	0x08, 0x54, 0x6f, 0x70, 0x6f, 0x6c, 0x6f, 0x67, 0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32,
-	0x18, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x54, 0x6f, 0x70,
-	0x6f, 0x6c, 0x6f, 0x67, 0x79, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x08, 0x54, 0x6f, 0x70, 0x6f, 0x6c,
-	0x6f, 0x67, 0x79, 0x12, 0x34, 0x0a, 0x06, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x18, 0x02, 0x20,
-	0x03, 0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31,
-	0x2e, 0x4e, 0x6f, 0x64, 0x65, 0x2e, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x45, 0x6e, 0x74, 0x72,
-	0x79, 0x52, 0x06, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x12, 0x43, 0x0a, 0x0b, 0x41, 0x6e, 0x6e,
-	0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x21,
-	0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x4e, 0x6f, 0x64, 0x65,
-	0x2e, 0x41, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x45, 0x6e, 0x74, 0x72,
-	0x79, 0x52, 0x0b, 0x41, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x1a, 0x39,
-	0x0a, 0x0b, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a,
-	0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12,
-	0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
-	0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a, 0x3e, 0x0a, 0x10, 0x41, 0x6e, 0x6e,
-	0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a,
-	0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12,
-	0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
-	0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x10, 0x0a, 0x0e, 0x47, 0x6c, 0x6f,
-	0x62, 0x61, 0x6c, 0x57, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71, 0x2a, 0x7e, 0x0a, 0x03, 0x53,
-	0x65, 0x74, 0x12, 0x0e, 0x0a, 0x0a, 0x55, 0x6e, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x53, 0x65, 0x74,
-	0x10, 0x00, 0x12, 0x0f, 0x0a, 0x0b, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x73, 0x53, 0x65,
-	0x74, 0x10, 0x01, 0x12, 0x10, 0x0a, 0x0c, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x73,
-	0x53, 0x65, 0x74, 0x10, 0x02, 0x12, 0x16, 0x0a, 0x12, 0x47, 0x6c, 0x6f, 0x62, 0x61, 0x6c, 0x53,
-	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x73, 0x10, 0x0a, 0x12, 0x17, 0x0a,
-	0x13, 0x47, 0x6c, 0x6f, 0x62, 0x61, 0x6c, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x49,
-	0x6e, 0x66, 0x6f, 0x73, 0x10, 0x0b, 0x12, 0x13, 0x0a, 0x0f, 0x47, 0x6c, 0x6f, 0x62, 0x61, 0x6c,
-	0x4e, 0x6f, 0x64, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x73, 0x10, 0x0c, 0x2a, 0x3b, 0x0a, 0x08, 0x50,
-	0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x12, 0x13, 0x0a, 0x0f, 0x55, 0x6e, 0x6b, 0x6e, 0x6f,
-	0x77, 0x6e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x10, 0x00, 0x12, 0x07, 0x0a, 0x03,
-	0x54, 0x43, 0x50, 0x10, 0x01, 0x12, 0x07, 0x0a, 0x03, 0x55, 0x44, 0x50, 0x10, 0x02, 0x12, 0x08,
-	0x0a, 0x04, 0x53, 0x43, 0x54, 0x50, 0x10, 0x03, 0x32, 0x42, 0x0a, 0x09, 0x45, 0x6e, 0x64, 0x70,
-	0x6f, 0x69, 0x6e, 0x74, 0x73, 0x12, 0x35, 0x0a, 0x05, 0x57, 0x61, 0x74, 0x63, 0x68, 0x12, 0x14,
-	0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x57, 0x61, 0x74, 0x63,
-	0x68, 0x52, 0x65, 0x71, 0x1a, 0x12, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76,
-	0x31, 0x2e, 0x4f, 0x70, 0x49, 0x74, 0x65, 0x6d, 0x28, 0x01, 0x30, 0x01, 0x32, 0x45, 0x0a, 0x06,
-	0x47, 0x6c, 0x6f, 0x62, 0x61, 0x6c, 0x12, 0x3b, 0x0a, 0x05, 0x57, 0x61, 0x74, 0x63, 0x68, 0x12,
-	0x1a, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x47, 0x6c, 0x6f,
-	0x62, 0x61, 0x6c, 0x57, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71, 0x1a, 0x12, 0x2e, 0x6c, 0x6f,
-	0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x4f, 0x70, 0x49, 0x74, 0x65, 0x6d, 0x28,
-	0x01, 0x30, 0x01, 0x42, 0x2c, 0x5a, 0x2a, 0x73, 0x69, 0x67, 0x73, 0x2e, 0x6b, 0x38, 0x73, 0x2e,
-	0x69, 0x6f, 0x2f, 0x6b, 0x70, 0x6e, 0x67, 0x2f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2f, 0x70,
-	0x6b, 0x67, 0x2f, 0x61, 0x70, 0x69, 0x2f, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76,
-	0x31, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x52, 0x65, 0x61, 0x64, 0x79, 0x12, 0x18, 0x0a, 0x07, 0x53,
+	0x65, 0x72, 0x76, 0x69, 0x6e, 0x67, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x53, 0x65,
+	0x72, 0x76, 0x69, 0x6e, 0x67, 0x12, 0x20, 0x0a, 0x0b, 0x54, 0x65, 0x72, 0x6d, 0x69, 0x6e, 0x61,
+	0x74, 0x69, 0x6e, 0x67, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0b, 0x54, 0x65, 0x72, 0x6d,
+	0x69, 0x6e, 0x61, 0x74, 0x69, 0x6e, 0x67, 0x22, 0x4e, 0x0a, 0x0c, 0x54, 0x6f, 0x70, 0x6f, 0x6c,
+	0x6f, 0x67, 0x79, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x6f, 0x64, 0x65, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x6f, 0x64, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x5a,
+	0x6f, 0x6e, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x5a, 0x6f, 0x6e, 0x65, 0x12,
+	0x16, 0x0a, 0x06, 0x52, 0x65, 0x67, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x06, 0x52, 0x65, 0x67, 0x69, 0x6f, 0x6e, 0x22, 0x25, 0x0a, 0x0d, 0x54, 0x6f, 0x70, 0x6f, 0x6c,
+	0x6f, 0x67, 0x79, 0x48, 0x69, 0x6e, 0x74, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x5a, 0x6f, 0x6e, 0x65,
+	0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x05, 0x5a, 0x6f, 0x6e, 0x65, 0x73, 0x22, 0x44,
+	0x0a, 0x08, 0x4e, 0x6f, 0x64, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x12, 0x0a, 0x04, 0x48, 0x61,
+	0x73, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x04, 0x48, 0x61, 0x73, 0x68, 0x12, 0x24,
+	0x0a, 0x04, 0x4e, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x6c,
+	0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x4e, 0x6f, 0x64, 0x65, 0x52, 0x04,
+	0x4e, 0x6f, 0x64, 0x65, 0x22, 0xc6, 0x02, 0x0a, 0x04, 0x4e, 0x6f, 0x64, 0x65, 0x12, 0x12, 0x0a,
+	0x04, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d,
+	0x65, 0x12, 0x34, 0x0a, 0x08, 0x54, 0x6f, 0x70, 0x6f, 0x6c, 0x6f, 0x67, 0x79, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31,
+	0x2e, 0x54, 0x6f, 0x70, 0x6f, 0x6c, 0x6f, 0x67, 0x79, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x08, 0x54,
+	0x6f, 0x70, 0x6f, 0x6c, 0x6f, 0x67, 0x79, 0x12, 0x34, 0x0a, 0x06, 0x4c, 0x61, 0x62, 0x65, 0x6c,
+	0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e,
+	0x65, 0x74, 0x76, 0x31, 0x2e, 0x4e, 0x6f, 0x64, 0x65, 0x2e, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73,
+	0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x06, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x12, 0x43, 0x0a,
+	0x0b, 0x41, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x03, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x21, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e,
+	0x4e, 0x6f, 0x64, 0x65, 0x2e, 0x41, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73,
+	0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x0b, 0x41, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x73, 0x1a, 0x39, 0x0a, 0x0b, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x45, 0x6e, 0x74, 0x72,
+	0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03,
+	0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a, 0x3e, 0x0a,
+	0x10, 0x41, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x45, 0x6e, 0x74, 0x72,
+	0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03,
+	0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x66, 0x0a,
+	0x0e, 0x4e, 0x6f, 0x64, 0x65, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12,
+	0x1a, 0x0a, 0x08, 0x4e, 0x6f, 0x64, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x08, 0x4e, 0x6f, 0x64, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x38, 0x0a, 0x08, 0x53,
+	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1c, 0x2e,
+	0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x53, 0x65, 0x72, 0x76, 0x69,
+	0x63, 0x65, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x73, 0x52, 0x08, 0x53, 0x65, 0x72,
+	0x76, 0x69, 0x63, 0x65, 0x73, 0x22, 0x75, 0x0a, 0x10, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65,
+	0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x73, 0x12, 0x2d, 0x0a, 0x07, 0x53, 0x65, 0x72,
+	0x76, 0x69, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x6c, 0x6f, 0x63,
+	0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x52,
+	0x07, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x32, 0x0a, 0x09, 0x45, 0x6e, 0x64, 0x70,
+	0x6f, 0x69, 0x6e, 0x74, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x6c, 0x6f,
+	0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e,
+	0x74, 0x52, 0x09, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x73, 0x22, 0x2c, 0x0a, 0x0e,
+	0x47, 0x6c, 0x6f, 0x62, 0x61, 0x6c, 0x57, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71, 0x12, 0x1a,
+	0x0a, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04,
+	0x52, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x22, 0x45, 0x0a, 0x13, 0x4a, 0x6f,
+	0x75, 0x72, 0x6e, 0x61, 0x6c, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x65,
+	0x71, 0x12, 0x14, 0x0a, 0x05, 0x53, 0x69, 0x6e, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x05, 0x53, 0x69, 0x6e, 0x63, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x53, 0x65, 0x72, 0x76, 0x69,
+	0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63,
+	0x65, 0x22, 0x4b, 0x0a, 0x15, 0x4a, 0x6f, 0x75, 0x72, 0x6e, 0x61, 0x6c, 0x52, 0x65, 0x76, 0x69,
+	0x73, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x32, 0x0a, 0x07, 0x45, 0x6e,
+	0x74, 0x72, 0x69, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x6c, 0x6f,
+	0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x4a, 0x6f, 0x75, 0x72, 0x6e, 0x61, 0x6c,
+	0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x07, 0x45, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x22, 0x82,
+	0x01, 0x0a, 0x0c, 0x4a, 0x6f, 0x75, 0x72, 0x6e, 0x61, 0x6c, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12,
+	0x1a, 0x0a, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x54,
+	0x69, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x54, 0x69, 0x6d, 0x65, 0x12,
+	0x1c, 0x0a, 0x09, 0x46, 0x75, 0x6c, 0x6c, 0x53, 0x74, 0x61, 0x74, 0x65, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x09, 0x46, 0x75, 0x6c, 0x6c, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x24, 0x0a,
+	0x03, 0x4f, 0x70, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x6c, 0x6f, 0x63,
+	0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x4f, 0x70, 0x49, 0x74, 0x65, 0x6d, 0x52, 0x03,
+	0x4f, 0x70, 0x73, 0x22, 0x4e, 0x0a, 0x0e, 0x4a, 0x6f, 0x75, 0x72, 0x6e, 0x61, 0x6c, 0x44, 0x69,
+	0x66, 0x66, 0x52, 0x65, 0x71, 0x12, 0x12, 0x0a, 0x04, 0x46, 0x72, 0x6f, 0x6d, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x04, 0x46, 0x72, 0x6f, 0x6d, 0x12, 0x0e, 0x0a, 0x02, 0x54, 0x6f, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x02, 0x54, 0x6f, 0x12, 0x18, 0x0a, 0x07, 0x53, 0x65, 0x72,
+	0x76, 0x69, 0x63, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x53, 0x65, 0x72, 0x76,
+	0x69, 0x63, 0x65, 0x22, 0x54, 0x0a, 0x10, 0x4a, 0x6f, 0x75, 0x72, 0x6e, 0x61, 0x6c, 0x44, 0x69,
+	0x66, 0x66, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x1a, 0x0a, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73,
+	0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x52, 0x65, 0x76, 0x69, 0x73,
+	0x69, 0x6f, 0x6e, 0x12, 0x24, 0x0a, 0x03, 0x4f, 0x70, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x12, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x4f, 0x70,
+	0x49, 0x74, 0x65, 0x6d, 0x52, 0x03, 0x4f, 0x70, 0x73, 0x2a, 0x8b, 0x01, 0x0a, 0x03, 0x53, 0x65,
+	0x74, 0x12, 0x0e, 0x0a, 0x0a, 0x55, 0x6e, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x53, 0x65, 0x74, 0x10,
+	0x00, 0x12, 0x0f, 0x0a, 0x0b, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x73, 0x53, 0x65, 0x74,
+	0x10, 0x01, 0x12, 0x10, 0x0a, 0x0c, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x73, 0x53,
+	0x65, 0x74, 0x10, 0x02, 0x12, 0x0b, 0x0a, 0x07, 0x4e, 0x6f, 0x64, 0x65, 0x53, 0x65, 0x74, 0x10,
+	0x03, 0x12, 0x16, 0x0a, 0x12, 0x47, 0x6c, 0x6f, 0x62, 0x61, 0x6c, 0x53, 0x65, 0x72, 0x76, 0x69,
+	0x63, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x73, 0x10, 0x0a, 0x12, 0x17, 0x0a, 0x13, 0x47, 0x6c, 0x6f,
+	0x62, 0x61, 0x6c, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x73,
+	0x10, 0x0b, 0x12, 0x13, 0x0a, 0x0f, 0x47, 0x6c, 0x6f, 0x62, 0x61, 0x6c, 0x4e, 0x6f, 0x64, 0x65,
+	0x49, 0x6e, 0x66, 0x6f, 0x73, 0x10, 0x0c, 0x2a, 0x3b, 0x0a, 0x08, 0x50, 0x72, 0x6f, 0x74, 0x6f,
+	0x63, 0x6f, 0x6c, 0x12, 0x13, 0x0a, 0x0f, 0x55, 0x6e, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x50, 0x72,
+	0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x10, 0x00, 0x12, 0x07, 0x0a, 0x03, 0x54, 0x43, 0x50, 0x10,
+	0x01, 0x12, 0x07, 0x0a, 0x03, 0x55, 0x44, 0x50, 0x10, 0x02, 0x12, 0x08, 0x0a, 0x04, 0x53, 0x43,
+	0x54, 0x50, 0x10, 0x03, 0x32, 0x42, 0x0a, 0x09, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74,
+	0x73, 0x12, 0x35, 0x0a, 0x05, 0x57, 0x61, 0x74, 0x63, 0x68, 0x12, 0x14, 0x2e, 0x6c, 0x6f, 0x63,
+	0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x57, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71,
+	0x1a, 0x12, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x4f, 0x70,
+	0x49, 0x74, 0x65, 0x6d, 0x28, 0x01, 0x30, 0x01, 0x32, 0x45, 0x0a, 0x06, 0x47, 0x6c, 0x6f, 0x62,
+	0x61, 0x6c, 0x12, 0x3b, 0x0a, 0x05, 0x57, 0x61, 0x74, 0x63, 0x68, 0x12, 0x1a, 0x2e, 0x6c, 0x6f,
+	0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x47, 0x6c, 0x6f, 0x62, 0x61, 0x6c, 0x57,
+	0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71, 0x1a, 0x12, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e,
+	0x65, 0x74, 0x76, 0x31, 0x2e, 0x4f, 0x70, 0x49, 0x74, 0x65, 0x6d, 0x28, 0x01, 0x30, 0x01, 0x32,
+	0x9c, 0x01, 0x0a, 0x07, 0x4a, 0x6f, 0x75, 0x72, 0x6e, 0x61, 0x6c, 0x12, 0x4f, 0x0a, 0x09, 0x52,
+	0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x1f, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c,
+	0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x4a, 0x6f, 0x75, 0x72, 0x6e, 0x61, 0x6c, 0x52, 0x65, 0x76,
+	0x69, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x65, 0x71, 0x1a, 0x21, 0x2e, 0x6c, 0x6f, 0x63, 0x61,
+	0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x4a, 0x6f, 0x75, 0x72, 0x6e, 0x61, 0x6c, 0x52, 0x65,
+	0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x40, 0x0a, 0x04,
+	0x44, 0x69, 0x66, 0x66, 0x12, 0x1a, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76,
+	0x31, 0x2e, 0x4a, 0x6f, 0x75, 0x72, 0x6e, 0x61, 0x6c, 0x44, 0x69, 0x66, 0x66, 0x52, 0x65, 0x71,
+	0x1a, 0x1c, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x4a, 0x6f,
+	0x75, 0x72, 0x6e, 0x61, 0x6c, 0x44, 0x69, 0x66, 0x66, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x32, 0x3d,
+	0x0a, 0x06, 0x50, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x12, 0x33, 0x0a, 0x05, 0x41, 0x70, 0x70, 0x6c,
+	0x79, 0x12, 0x12, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x2e, 0x4f,
+	0x70, 0x49, 0x74, 0x65, 0x6d, 0x1a, 0x12, 0x2e, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74,
+	0x76, 0x31, 0x2e, 0x53, 0x79, 0x6e, 0x63, 0x4f, 0x70, 0x28, 0x01, 0x30, 0x01, 0x42, 0x2c, 0x5a,
+	0x2a, 0x73, 0x69, 0x67, 0x73, 0x2e, 0x6b, 0x38, 0x73, 0x2e, 0x69, 0x6f, 0x2f, 0x6b, 0x70, 0x6e,
+	0x67, 0x2f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x61, 0x70, 0x69,
+	0x2f, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x6e, 0x65, 0x74, 0x76, 0x31, 0x62, 0x06, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x33,
 }
 
 var (
@@ -1829,76 +2699,104 @@ func file_api_localnetv1_services_proto_rawDescGZIP() []byte {
 }
 
 var file_api_localnetv1_services_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
-var file_api_localnetv1_services_proto_msgTypes = make([]protoimpl.MessageInfo, 26)
+var file_api_localnetv1_services_proto_msgTypes = make([]protoimpl.MessageInfo, 35)
 var file_api_localnetv1_services_proto_goTypes = []interface{}{
-	(Set)(0),                   // 0: localnetv1.Set
-	(Protocol)(0),              // 1: localnetv1.Protocol
-	(*WatchReq)(nil),           // 2: localnetv1.WatchReq
-	(*OpItem)(nil),             // 3: localnetv1.OpItem
-	(*EmptyOp)(nil),            // 4: localnetv1.EmptyOp
-	(*Ref)(nil),                // 5: localnetv1.Ref
-	(*Value)(nil),              // 6: localnetv1.Value
-	(*Service)(nil),            // 7: localnetv1.Service
-	(*IPFilter)(nil),           // 8: localnetv1.IPFilter
-	(*ServiceIPs)(nil),         // 9: localnetv1.ServiceIPs
-	(*Endpoint)(nil),           // 10: localnetv1.Endpoint
-	(*EndpointScopes)(nil),     // 11: localnetv1.EndpointScopes
-	(*IPSet)(nil),              // 12: localnetv1.IPSet
-	(*PortName)(nil),           // 13: localnetv1.PortName
-	(*PortMapping)(nil),        // 14: localnetv1.PortMapping
-	(*ClientIPAffinity)(nil),   // 15: localnetv1.ClientIPAffinity
-	(*ServiceInfo)(nil),        // 16: localnetv1.ServiceInfo
-	(*EndpointInfo)(nil),       // 17: localnetv1.EndpointInfo
-	(*EndpointConditions)(nil), // 18: localnetv1.EndpointConditions
-	(*TopologyInfo)(nil),       // 19: localnetv1.TopologyInfo
-	(*TopologyHints)(nil),      // 20: localnetv1.TopologyHints
-	(*NodeInfo)(nil),           // 21: localnetv1.NodeInfo
-	(*Node)(nil),               // 22: localnetv1.Node
-	(*GlobalWatchReq)(nil),     // 23: localnetv1.GlobalWatchReq
-	nil,                        // 24: localnetv1.Service.LabelsEntry
-	nil,                        // 25: localnetv1.Service.AnnotationsEntry
-	nil,                        // 26: localnetv1.Node.LabelsEntry
-	nil,                        // 27: localnetv1.Node.AnnotationsEntry
+	(Set)(0),                      // 0: localnetv1.Set
+	(Protocol)(0),                 // 1: localnetv1.Protocol
+	(*WatchReq)(nil),              // 2: localnetv1.WatchReq
+	(*OpItem)(nil),                // 3: localnetv1.OpItem
+	(*EmptyOp)(nil),               // 4: localnetv1.EmptyOp
+	(*SyncOp)(nil),                // 5: localnetv1.SyncOp
+	(*Ref)(nil),                   // 6: localnetv1.Ref
+	(*Value)(nil),                 // 7: localnetv1.Value
+	(*Service)(nil),               // 8: localnetv1.Service
+	(*IPFilter)(nil),              // 9: localnetv1.IPFilter
+	(*ServiceIPs)(nil),            // 10: localnetv1.ServiceIPs
+	(*Endpoint)(nil),              // 11: localnetv1.Endpoint
+	(*EndpointScopes)(nil),        // 12: localnetv1.EndpointScopes
+	(*IPSet)(nil),                 // 13: localnetv1.IPSet
+	(*PortName)(nil),              // 14: localnetv1.PortName
+	(*PortMapping)(nil),           // 15: localnetv1.PortMapping
+	(*PortRange)(nil),             // 16: localnetv1.PortRange
+	(*ClientIPAffinity)(nil),      // 17: localnetv1.ClientIPAffinity
+	(*ServiceInfo)(nil),           // 18: localnetv1.ServiceInfo
+	(*EndpointInfo)(nil),          // 19: localnetv1.EndpointInfo
+	(*EndpointConditions)(nil),    // 20: localnetv1.EndpointConditions
+	(*TopologyInfo)(nil),          // 21: localnetv1.TopologyInfo
+	(*TopologyHints)(nil),         // 22: localnetv1.TopologyHints
+	(*NodeInfo)(nil),              // 23: localnetv1.NodeInfo
+	(*Node)(nil),                  // 24: localnetv1.Node
+	(*NodeLocalState)(nil),        // 25: localnetv1.NodeLocalState
+	(*ServiceEndpoints)(nil),      // 26: localnetv1.ServiceEndpoints
+	(*GlobalWatchReq)(nil),        // 27: localnetv1.GlobalWatchReq
+	(*JournalRevisionsReq)(nil),   // 28: localnetv1.JournalRevisionsReq
+	(*JournalRevisionsReply)(nil), // 29: localnetv1.JournalRevisionsReply
+	(*JournalEntry)(nil),          // 30: localnetv1.JournalEntry
+	(*JournalDiffReq)(nil),        // 31: localnetv1.JournalDiffReq
+	(*JournalDiffReply)(nil),      // 32: localnetv1.JournalDiffReply
+	nil,                           // 33: localnetv1.Service.LabelsEntry
+	nil,                           // 34: localnetv1.Service.AnnotationsEntry
+	nil,                           // 35: localnetv1.Node.LabelsEntry
+	nil,                           // 36: localnetv1.Node.AnnotationsEntry
 }
 var file_api_localnetv1_services_proto_depIdxs = []int32{
-	4,  // 0: localnetv1.OpItem.Sync:type_name -> localnetv1.EmptyOp
+	5,  // 0: localnetv1.OpItem.Sync:type_name -> localnetv1.SyncOp
 	4,  // 1: localnetv1.OpItem.Reset:type_name -> localnetv1.EmptyOp
-	6,  // 2: localnetv1.OpItem.Set:type_name -> localnetv1.Value
-	5,  // 3: localnetv1.OpItem.Delete:type_name -> localnetv1.Ref
+	7,  // 2: localnetv1.OpItem.Set:type_name -> localnetv1.Value
+	6,  // 3: localnetv1.OpItem.Delete:type_name -> localnetv1.Ref
 	0,  // 4: localnetv1.Ref.Set:type_name -> localnetv1.Set
-	5,  // 5: localnetv1.Value.Ref:type_name -> localnetv1.Ref
-	24, // 6: localnetv1.Service.Labels:type_name -> localnetv1.Service.LabelsEntry
-	25, // 7: localnetv1.Service.Annotations:type_name -> localnetv1.Service.AnnotationsEntry
-	9,  // 8: localnetv1.Service.IPs:type_name -> localnetv1.ServiceIPs
-	8,  // 9: localnetv1.Service.IPFilters:type_name -> localnetv1.IPFilter
-	14, // 10: localnetv1.Service.Ports:type_name -> localnetv1.PortMapping
-	15, // 11: localnetv1.Service.ClientIP:type_name -> localnetv1.ClientIPAffinity
-	12, // 12: localnetv1.IPFilter.TargetIPs:type_name -> localnetv1.IPSet
-	12, // 13: localnetv1.ServiceIPs.ClusterIPs:type_name -> localnetv1.IPSet
-	12, // 14: localnetv1.ServiceIPs.ExternalIPs:type_name -> localnetv1.IPSet
-	12, // 15: localnetv1.ServiceIPs.LoadBalancerIPs:type_name -> localnetv1.IPSet
-	12, // 16: localnetv1.Endpoint.IPs:type_name -> localnetv1.IPSet
-	13, // 17: localnetv1.Endpoint.PortOverrides:type_name -> localnetv1.PortName
-	11, // 18: localnetv1.Endpoint.Scopes:type_name -> localnetv1.EndpointScopes
-	1,  // 19: localnetv1.PortMapping.Protocol:type_name -> localnetv1.Protocol
-	7,  // 20: localnetv1.ServiceInfo.Service:type_name -> localnetv1.Service
-	10, // 21: localnetv1.EndpointInfo.Endpoint:type_name -> localnetv1.Endpoint
-	18, // 22: localnetv1.EndpointInfo.Conditions:type_name -> localnetv1.EndpointConditions
-	19, // 23: localnetv1.EndpointInfo.Topology:type_name -> localnetv1.TopologyInfo
-	20, // 24: localnetv1.EndpointInfo.Hints:type_name -> localnetv1.TopologyHints
-	22, // 25: localnetv1.NodeInfo.Node:type_name -> localnetv1.Node
-	19, // 26: localnetv1.Node.Topology:type_name -> localnetv1.TopologyInfo
-	26, // 27: localnetv1.Node.Labels:type_name -> localnetv1.Node.LabelsEntry
-	27, // 28: localnetv1.Node.Annotations:type_name -> localnetv1.Node.AnnotationsEntry
-	2,  // 29: localnetv1.Endpoints.Watch:input_type -> localnetv1.WatchReq
-	23, // 30: localnetv1.Global.Watch:input_type -> localnetv1.GlobalWatchReq
-	3,  // 31: localnetv1.Endpoints.Watch:output_type -> localnetv1.OpItem
-	3,  // 32: localnetv1.Global.Watch:output_type -> localnetv1.OpItem
-	31, // [31:33] is the sub-list for method output_type
-	29, // [29:31] is the sub-list for method input_type
-	29, // [29:29] is the sub-list for extension type_name
-	29, // [29:29] is the sub-list for extension extendee
-	0,  // [0:29] is the sub-list for field type_name
+	6,  // 5: localnetv1.Value.Ref:type_name -> localnetv1.Ref
+	33, // 6: localnetv1.Service.Labels:type_name -> localnetv1.Service.LabelsEntry
+	34, // 7: localnetv1.Service.Annotations:type_name -> localnetv1.Service.AnnotationsEntry
+	10, // 8: localnetv1.Service.IPs:type_name -> localnetv1.ServiceIPs
+	9,  // 9: localnetv1.Service.IPFilters:type_name -> localnetv1.IPFilter
+	15, // 10: localnetv1.Service.Ports:type_name -> localnetv1.PortMapping
+	17, // 11: localnetv1.Service.ClientIP:type_name -> localnetv1.ClientIPAffinity
+	16, // 12: localnetv1.Service.PortRanges:type_name -> localnetv1.PortRange
+	13, // 13: localnetv1.IPFilter.TargetIPs:type_name -> localnetv1.IPSet
+	13, // 14: localnetv1.ServiceIPs.ClusterIPs:type_name -> localnetv1.IPSet
+	13, // 15: localnetv1.ServiceIPs.ExternalIPs:type_name -> localnetv1.IPSet
+	13, // 16: localnetv1.ServiceIPs.LoadBalancerIPs:type_name -> localnetv1.IPSet
+	13, // 17: localnetv1.Endpoint.IPs:type_name -> localnetv1.IPSet
+	14, // 18: localnetv1.Endpoint.PortOverrides:type_name -> localnetv1.PortName
+	12, // 19: localnetv1.Endpoint.Scopes:type_name -> localnetv1.EndpointScopes
+	20, // 20: localnetv1.Endpoint.Conditions:type_name -> localnetv1.EndpointConditions
+	21, // 21: localnetv1.Endpoint.Topology:type_name -> localnetv1.TopologyInfo
+	22, // 22: localnetv1.Endpoint.Hints:type_name -> localnetv1.TopologyHints
+	15, // 23: localnetv1.Endpoint.TargetPorts:type_name -> localnetv1.PortMapping
+	1,  // 24: localnetv1.PortName.Protocol:type_name -> localnetv1.Protocol
+	1,  // 25: localnetv1.PortMapping.Protocol:type_name -> localnetv1.Protocol
+	1,  // 26: localnetv1.PortRange.Protocol:type_name -> localnetv1.Protocol
+	8,  // 27: localnetv1.ServiceInfo.Service:type_name -> localnetv1.Service
+	11, // 28: localnetv1.EndpointInfo.Endpoint:type_name -> localnetv1.Endpoint
+	20, // 29: localnetv1.EndpointInfo.Conditions:type_name -> localnetv1.EndpointConditions
+	21, // 30: localnetv1.EndpointInfo.Topology:type_name -> localnetv1.TopologyInfo
+	22, // 31: localnetv1.EndpointInfo.Hints:type_name -> localnetv1.TopologyHints
+	24, // 32: localnetv1.NodeInfo.Node:type_name -> localnetv1.Node
+	21, // 33: localnetv1.Node.Topology:type_name -> localnetv1.TopologyInfo
+	35, // 34: localnetv1.Node.Labels:type_name -> localnetv1.Node.LabelsEntry
+	36, // 35: localnetv1.Node.Annotations:type_name -> localnetv1.Node.AnnotationsEntry
+	26, // 36: localnetv1.NodeLocalState.Services:type_name -> localnetv1.ServiceEndpoints
+	8,  // 37: localnetv1.ServiceEndpoints.Service:type_name -> localnetv1.Service
+	11, // 38: localnetv1.ServiceEndpoints.Endpoints:type_name -> localnetv1.Endpoint
+	30, // 39: localnetv1.JournalRevisionsReply.Entries:type_name -> localnetv1.JournalEntry
+	3,  // 40: localnetv1.JournalEntry.Ops:type_name -> localnetv1.OpItem
+	3,  // 41: localnetv1.JournalDiffReply.Ops:type_name -> localnetv1.OpItem
+	2,  // 42: localnetv1.Endpoints.Watch:input_type -> localnetv1.WatchReq
+	27, // 43: localnetv1.Global.Watch:input_type -> localnetv1.GlobalWatchReq
+	28, // 44: localnetv1.Journal.Revisions:input_type -> localnetv1.JournalRevisionsReq
+	31, // 45: localnetv1.Journal.Diff:input_type -> localnetv1.JournalDiffReq
+	3,  // 46: localnetv1.Plugin.Apply:input_type -> localnetv1.OpItem
+	3,  // 47: localnetv1.Endpoints.Watch:output_type -> localnetv1.OpItem
+	3,  // 48: localnetv1.Global.Watch:output_type -> localnetv1.OpItem
+	29, // 49: localnetv1.Journal.Revisions:output_type -> localnetv1.JournalRevisionsReply
+	32, // 50: localnetv1.Journal.Diff:output_type -> localnetv1.JournalDiffReply
+	5,  // 51: localnetv1.Plugin.Apply:output_type -> localnetv1.SyncOp
+	47, // [47:52] is the sub-list for method output_type
+	42, // [42:47] is the sub-list for method input_type
+	42, // [42:42] is the sub-list for extension type_name
+	42, // [42:42] is the sub-list for extension extendee
+	0,  // [0:42] is the sub-list for field type_name
 }
 
 func init() { file_api_localnetv1_services_proto_init() }
@@ -1944,7 +2842,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Ref); i {
+			switch v := v.(*SyncOp); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1956,7 +2854,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Value); i {
+			switch v := v.(*Ref); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1968,7 +2866,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Service); i {
+			switch v := v.(*Value); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1980,7 +2878,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*IPFilter); i {
+			switch v := v.(*Service); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1992,7 +2890,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*ServiceIPs); i {
+			switch v := v.(*IPFilter); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2004,7 +2902,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Endpoint); i {
+			switch v := v.(*ServiceIPs); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2016,7 +2914,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*EndpointScopes); i {
+			switch v := v.(*Endpoint); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2028,7 +2926,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*IPSet); i {
+			switch v := v.(*EndpointScopes); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2040,7 +2938,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PortName); i {
+			switch v := v.(*IPSet); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2052,7 +2950,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PortMapping); i {
+			switch v := v.(*PortName); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2064,7 +2962,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*ClientIPAffinity); i {
+			switch v := v.(*PortMapping); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2076,7 +2974,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*ServiceInfo); i {
+			switch v := v.(*PortRange); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2088,7 +2986,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*EndpointInfo); i {
+			switch v := v.(*ClientIPAffinity); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2100,7 +2998,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*EndpointConditions); i {
+			switch v := v.(*ServiceInfo); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2112,7 +3010,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*TopologyInfo); i {
+			switch v := v.(*EndpointInfo); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2124,7 +3022,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[18].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*TopologyHints); i {
+			switch v := v.(*EndpointConditions); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2136,7 +3034,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[19].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*NodeInfo); i {
+			switch v := v.(*TopologyInfo); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2148,7 +3046,7 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[20].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Node); i {
+			switch v := v.(*TopologyHints); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2160,6 +3058,54 @@ func file_api_localnetv1_services_proto_init() {
 			}
 		}
 		file_api_localnetv1_services_proto_msgTypes[21].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*NodeInfo); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_localnetv1_services_proto_msgTypes[22].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Node); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_localnetv1_services_proto_msgTypes[23].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*NodeLocalState); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_localnetv1_services_proto_msgTypes[24].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ServiceEndpoints); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_localnetv1_services_proto_msgTypes[25].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*GlobalWatchReq); i {
 			case 0:
 				return &v.state
@@ -2171,6 +3117,66 @@ func file_api_localnetv1_services_proto_init() {
 				return nil
 			}
 		}
+		file_api_localnetv1_services_proto_msgTypes[26].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*JournalRevisionsReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_localnetv1_services_proto_msgTypes[27].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*JournalRevisionsReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_localnetv1_services_proto_msgTypes[28].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*JournalEntry); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_localnetv1_services_proto_msgTypes[29].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*JournalDiffReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_localnetv1_services_proto_msgTypes[30].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*JournalDiffReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	file_api_localnetv1_services_proto_msgTypes[1].OneofWrappers = []interface{}{
 		(*OpItem_Sync)(nil),
@@ -2178,7 +3184,7 @@ func file_api_localnetv1_services_proto_init() {
 		(*OpItem_Set)(nil),
 		(*OpItem_Delete)(nil),
 	}
-	file_api_localnetv1_services_proto_msgTypes[5].OneofWrappers = []interface{}{
+	file_api_localnetv1_services_proto_msgTypes[6].OneofWrappers = []interface{}{
 		(*Service_ClientIP)(nil),
 	}
 	type x struct{}
@@ -2187,9 +3193,9 @@ func file_api_localnetv1_services_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_api_localnetv1_services_proto_rawDesc,
 			NumEnums:      2,
-			NumMessages:   26,
+			NumMessages:   35,
 			NumExtensions: 0,
-			NumServices:   2,
+			NumServices:   4,
 		},
 		GoTypes:           file_api_localnetv1_services_proto_goTypes,
 		DependencyIndexes: file_api_localnetv1_services_proto_depIdxs,
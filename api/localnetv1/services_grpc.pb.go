@@ -255,3 +255,251 @@ var Global_ServiceDesc = grpc.ServiceDesc{
 	},
 	Metadata: "api/localnetv1/services.proto",
 }
+
+// JournalClient is the client API for Journal service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type JournalClient interface {
+	// Revisions lists the revisions kept in the journal, oldest first.
+	Revisions(ctx context.Context, in *JournalRevisionsReq, opts ...grpc.CallOption) (*JournalRevisionsReply, error)
+	// Diff returns the changes from a revision held by the requester to a more recent one.
+	Diff(ctx context.Context, in *JournalDiffReq, opts ...grpc.CallOption) (*JournalDiffReply, error)
+}
+
+type journalClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewJournalClient(cc grpc.ClientConnInterface) JournalClient {
+	return &journalClient{cc}
+}
+
+func (c *journalClient) Revisions(ctx context.Context, in *JournalRevisionsReq, opts ...grpc.CallOption) (*JournalRevisionsReply, error) {
+	out := new(JournalRevisionsReply)
+	err := c.cc.Invoke(ctx, "/localnetv1.Journal/Revisions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *journalClient) Diff(ctx context.Context, in *JournalDiffReq, opts ...grpc.CallOption) (*JournalDiffReply, error) {
+	out := new(JournalDiffReply)
+	err := c.cc.Invoke(ctx, "/localnetv1.Journal/Diff", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// JournalServer is the server API for Journal service.
+// All implementations must embed UnimplementedJournalServer
+// for forward compatibility
+type JournalServer interface {
+	// Revisions lists the revisions kept in the journal, oldest first.
+	Revisions(context.Context, *JournalRevisionsReq) (*JournalRevisionsReply, error)
+	// Diff returns the changes from a revision held by the requester to a more recent one.
+	Diff(context.Context, *JournalDiffReq) (*JournalDiffReply, error)
+	mustEmbedUnimplementedJournalServer()
+}
+
+// UnimplementedJournalServer must be embedded to have forward compatible implementations.
+type UnimplementedJournalServer struct {
+}
+
+func (UnimplementedJournalServer) Revisions(context.Context, *JournalRevisionsReq) (*JournalRevisionsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Revisions not implemented")
+}
+func (UnimplementedJournalServer) Diff(context.Context, *JournalDiffReq) (*JournalDiffReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Diff not implemented")
+}
+func (UnimplementedJournalServer) mustEmbedUnimplementedJournalServer() {}
+
+// UnsafeJournalServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to JournalServer will
+// result in compilation errors.
+type UnsafeJournalServer interface {
+	mustEmbedUnimplementedJournalServer()
+}
+
+func RegisterJournalServer(s grpc.ServiceRegistrar, srv JournalServer) {
+	s.RegisterService(&Journal_ServiceDesc, srv)
+}
+
+func _Journal_Revisions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JournalRevisionsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JournalServer).Revisions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/localnetv1.Journal/Revisions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JournalServer).Revisions(ctx, req.(*JournalRevisionsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Journal_Diff_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JournalDiffReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JournalServer).Diff(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/localnetv1.Journal/Diff",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JournalServer).Diff(ctx, req.(*JournalDiffReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Journal_ServiceDesc is the grpc.ServiceDesc for Journal service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Journal_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "localnetv1.Journal",
+	HandlerType: (*JournalServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Revisions",
+			Handler:    _Journal_Revisions_Handler,
+		},
+		{
+			MethodName: "Diff",
+			Handler:    _Journal_Diff_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "api/localnetv1/services.proto",
+}
+
+// PluginClient is the client API for Plugin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PluginClient interface {
+	// Apply streams the node-local state to a backend plugin: a Reset and the full state on connection, then the
+	// changes. The plugin answers each Sync once the change set is applied.
+	Apply(ctx context.Context, opts ...grpc.CallOption) (Plugin_ApplyClient, error)
+}
+
+type pluginClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPluginClient(cc grpc.ClientConnInterface) PluginClient {
+	return &pluginClient{cc}
+}
+
+func (c *pluginClient) Apply(ctx context.Context, opts ...grpc.CallOption) (Plugin_ApplyClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Plugin_ServiceDesc.Streams[0], "/localnetv1.Plugin/Apply", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pluginApplyClient{stream}
+	return x, nil
+}
+
+type Plugin_ApplyClient interface {
+	Send(*OpItem) error
+	Recv() (*SyncOp, error)
+	grpc.ClientStream
+}
+
+type pluginApplyClient struct {
+	grpc.ClientStream
+}
+
+func (x *pluginApplyClient) Send(m *OpItem) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *pluginApplyClient) Recv() (*SyncOp, error) {
+	m := new(SyncOp)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// PluginServer is the server API for Plugin service.
+// All implementations must embed UnimplementedPluginServer
+// for forward compatibility
+type PluginServer interface {
+	// Apply streams the node-local state to a backend plugin: a Reset and the full state on connection, then the
+	// changes. The plugin answers each Sync once the change set is applied.
+	Apply(Plugin_ApplyServer) error
+	mustEmbedUnimplementedPluginServer()
+}
+
+// UnimplementedPluginServer must be embedded to have forward compatible implementations.
+type UnimplementedPluginServer struct {
+}
+
+func (UnimplementedPluginServer) Apply(Plugin_ApplyServer) error {
+	return status.Errorf(codes.Unimplemented, "method Apply not implemented")
+}
+func (UnimplementedPluginServer) mustEmbedUnimplementedPluginServer() {}
+
+// UnsafePluginServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PluginServer will
+// result in compilation errors.
+type UnsafePluginServer interface {
+	mustEmbedUnimplementedPluginServer()
+}
+
+func RegisterPluginServer(s grpc.ServiceRegistrar, srv PluginServer) {
+	s.RegisterService(&Plugin_ServiceDesc, srv)
+}
+
+func _Plugin_Apply_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PluginServer).Apply(&pluginApplyServer{stream})
+}
+
+type Plugin_ApplyServer interface {
+	Send(*SyncOp) error
+	Recv() (*OpItem, error)
+	grpc.ServerStream
+}
+
+type pluginApplyServer struct {
+	grpc.ServerStream
+}
+
+func (x *pluginApplyServer) Send(m *SyncOp) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *pluginApplyServer) Recv() (*OpItem, error) {
+	m := new(OpItem)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Plugin_ServiceDesc is the grpc.ServiceDesc for Plugin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Plugin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "localnetv1.Plugin",
+	HandlerType: (*PluginServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Apply",
+			Handler:       _Plugin_Apply_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "api/localnetv1/services.proto",
+}
@@ -0,0 +1,21 @@
+module sigs.k8s.io/kpng/backends/api
+
+go 1.19
+
+require (
+	github.com/spf13/pflag v1.0.5
+	google.golang.org/grpc v1.50.0
+	k8s.io/klog/v2 v2.80.1
+	sigs.k8s.io/kpng/api v0.0.0-20220824013548-88b8a1d9bc62
+	sigs.k8s.io/kpng/client v0.0.0-20221011133104-469299451522
+)
+
+require (
+	github.com/go-logr/logr v1.2.3 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	golang.org/x/net v0.0.0-20220722155237-a158d28d115b // indirect
+	golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f // indirect
+	golang.org/x/text v0.3.7 // indirect
+	google.golang.org/genproto v0.0.0-20220502173005-c8bf987b8c21 // indirect
+	google.golang.org/protobuf v1.28.0 // indirect
+)
@@ -0,0 +1,260 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apisink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/backendcmd"
+	"sigs.k8s.io/kpng/client/connpolicy"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+// pluginsBackend streams the node-local state to the backend plugins registered in a directory (see the
+// backendplugin package for the plugin side).
+type pluginsBackend struct {
+	cfg localsink.Config
+
+	dir            string
+	timeout        time.Duration
+	livenessPeriod time.Duration
+}
+
+func init() {
+	backendcmd.Register("to-plugins", func() backendcmd.Cmd { return &pluginsBackend{} })
+}
+
+func (b *pluginsBackend) BindFlags(flags *pflag.FlagSet) {
+	b.cfg.BindFlags(flags)
+
+	flags.StringVar(&b.dir, "plugins-dir", "/run/kpng/plugins", "directory the backend plugins register their UNIX socket (*.sock) in")
+	flags.DurationVar(&b.timeout, "plugin-timeout", time.Minute, "how long a plugin has to answer a change set or a liveness check before it's reconnected")
+	flags.DurationVar(&b.livenessPeriod, "plugin-liveness-period", 10*time.Second, "interval of the liveness checks of the plugins when the state doesn't change")
+}
+
+func (b *pluginsBackend) Sink() localsink.Sink {
+	return &pluginsSink{
+		sink: &sink{
+			Config: &b.cfg,
+			state:  newState(),
+			values: map[ref][]byte{},
+		},
+		dir:             b.dir,
+		timeout:         b.timeout,
+		livenessPeriod:  b.livenessPeriod,
+		discoveryPeriod: time.Second,
+	}
+}
+
+var resetItem = &localnetv1.OpItem{Op: &localnetv1.OpItem_Reset_{Reset_: &localnetv1.EmptyOp{}}}
+
+type pluginsSink struct {
+	*sink
+
+	dir             string
+	timeout         time.Duration
+	livenessPeriod  time.Duration
+	discoveryPeriod time.Duration
+}
+
+var _ localsink.Sink = &pluginsSink{}
+
+func (s *pluginsSink) Setup() {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		klog.Fatal("failed to create the plugins directory: ", err)
+	}
+
+	klog.Info("watching the backend plugins in ", s.dir)
+
+	go s.discover(context.Background())
+}
+
+// discover starts streaming the state to the plugins when their socket appears in the directory, and stops when
+// it's removed.
+func (s *pluginsSink) discover(ctx context.Context) {
+	plugins := map[string]context.CancelFunc{}
+
+	ticker := time.NewTicker(s.discoveryPeriod)
+	defer ticker.Stop()
+
+	for {
+		sockets, err := filepath.Glob(filepath.Join(s.dir, "*.sock"))
+		if err != nil {
+			klog.Error("failed to list the plugins: ", err)
+		}
+
+		seen := make(map[string]bool, len(sockets))
+		for _, socket := range sockets {
+			seen[socket] = true
+
+			if _, ok := plugins[socket]; ok {
+				continue
+			}
+
+			klog.Info("plugin registered: ", socket)
+
+			pluginCtx, cancel := context.WithCancel(ctx)
+			plugins[socket] = cancel
+			go s.run(pluginCtx, socket)
+		}
+
+		for socket, cancel := range plugins {
+			if !seen[socket] {
+				klog.Info("plugin unregistered: ", socket)
+				cancel()
+				delete(plugins, socket)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run streams the state to a plugin until the context is done, reconnecting after failures. Each connection
+// starts with the full state, so a restarted plugin gets it back.
+func (s *pluginsSink) run(ctx context.Context, socket string) {
+	policy := connpolicy.Default()
+	backoff := policy.NewBackoff(0)
+
+	for {
+		err := s.stream(ctx, socket, backoff.Reset)
+		if ctx.Err() != nil {
+			return
+		}
+
+		delay := backoff.Next()
+		klog.Warningf("plugin %s failed, reconnecting in %v: %v", socket, delay.Round(time.Millisecond), err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// stream sends a Reset and the full state to the plugin, then the changes of each synced state. When the state
+// doesn't change for the liveness period, an empty change set is sent. onApplied is called each time the plugin
+// answered.
+func (s *pluginsSink) stream(ctx context.Context, socket string, onApplied func()) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, "unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	apply, err := localnetv1.NewPluginClient(conn).Apply(ctx)
+	if err != nil {
+		return err
+	}
+
+	answers := make(chan *localnetv1.SyncOp)
+	answerErr := make(chan error, 1)
+	go func() {
+		for {
+			answer, err := apply.Recv()
+			if err != nil {
+				answerErr <- err
+				return
+			}
+
+			select {
+			case answers <- answer:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	send := func(ops ...*localnetv1.OpItem) error {
+		for _, op := range ops {
+			if err := apply.Send(op); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var prev map[ref][]byte
+	revision := uint64(0)
+
+	for {
+		waitCtx, waitCancel := context.WithTimeout(ctx, s.livenessPeriod)
+		snap, err := s.state.wait(waitCtx, revision)
+		waitCancel()
+
+		switch {
+		case err == nil:
+			ops := snap.diff(prev)
+			if prev == nil {
+				ops = append([]*localnetv1.OpItem{resetItem}, ops...)
+			}
+
+			if err := send(ops...); err != nil {
+				return err
+			}
+
+			prev, revision = snap.values, snap.revision
+
+		case ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded):
+			// liveness check
+
+		default:
+			return err
+		}
+
+		if err := send(&localnetv1.OpItem{Op: &localnetv1.OpItem_Sync{Sync: &localnetv1.SyncOp{Revision: revision}}}); err != nil {
+			return err
+		}
+
+		select {
+		case answer := <-answers:
+			if answer.Revision != revision {
+				return fmt.Errorf("plugin answered revision %d, expected %d", answer.Revision, revision)
+			}
+			klog.V(2).Infof("plugin %s applied revision %d", socket, revision)
+			onApplied()
+
+		case err := <-answerErr:
+			return err
+
+		case <-time.After(s.timeout):
+			return fmt.Errorf("plugin didn't answer revision %d in %v", revision, s.timeout)
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apisink
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/backendplugin"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+// recordingSink records the change sets applied by a plugin.
+type recordingSink struct {
+	localsink.Config
+
+	mu      sync.Mutex
+	ops     []string
+	applied []string
+}
+
+func (s *recordingSink) Setup() {}
+
+func (s *recordingSink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ops = append(s.ops, "reset")
+}
+
+func (s *recordingSink) Send(op *localnetv1.OpItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch v := op.Op.(type) {
+	case *localnetv1.OpItem_Set:
+		s.ops = append(s.ops, "set:"+v.Set.Ref.Path)
+	case *localnetv1.OpItem_Delete:
+		s.ops = append(s.ops, "del:"+v.Delete.Path)
+	case *localnetv1.OpItem_Sync:
+		s.applied = append(s.applied, strings.Join(s.ops, " "))
+		s.ops = nil
+	}
+	return nil
+}
+
+func (s *recordingSink) waitApplied(t *testing.T, expected ...string) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		s.mu.Lock()
+		applied := strings.Join(s.applied, " | ")
+		s.mu.Unlock()
+
+		if applied == strings.Join(expected, " | ") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the change sets %q, got %q", expected, applied)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPlugins(t *testing.T) {
+	dir := t.TempDir()
+
+	b := &pluginsBackend{
+		cfg:            localsink.Config{NodeName: "node-1"},
+		dir:            dir,
+		timeout:        5 * time.Second,
+		livenessPeriod: 50 * time.Millisecond,
+	}
+	s := b.Sink().(*pluginsSink)
+	s.discoveryPeriod = 10 * time.Millisecond
+	s.Setup()
+
+	send := func(ops ...*localnetv1.OpItem) {
+		for _, op := range ops {
+			if err := s.Send(op); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	send(
+		setOp(localnetv1.Set_EndpointsSet, "ns/svc/a", "ep-a"),
+		setOp(localnetv1.Set_ServicesSet, "ns/svc", "svc"),
+		syncItem,
+	)
+
+	socket := filepath.Join(dir, "test.sock")
+
+	startPlugin := func() (*recordingSink, context.CancelFunc) {
+		plugin := &recordingSink{}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := backendplugin.Serve(ctx, socket, plugin); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		return plugin, func() { cancel(); <-done }
+	}
+
+	// registration: the full state is sent
+	plugin, stop := startPlugin()
+	plugin.waitApplied(t, "reset set:ns/svc set:ns/svc/a")
+
+	send(
+		deleteOp(localnetv1.Set_EndpointsSet, "ns/svc/a"),
+		setOp(localnetv1.Set_EndpointsSet, "ns/svc/b", "ep-b"),
+		syncItem,
+	)
+	plugin.waitApplied(t, "reset set:ns/svc set:ns/svc/a", "del:ns/svc/a set:ns/svc/b")
+
+	// the liveness checks don't reach the sink
+	time.Sleep(200 * time.Millisecond)
+	plugin.waitApplied(t, "reset set:ns/svc set:ns/svc/a", "del:ns/svc/a set:ns/svc/b")
+
+	// restart: the full state is sent again
+	stop()
+	plugin, stop = startPlugin()
+	defer stop()
+
+	plugin.waitApplied(t, "reset set:ns/svc set:ns/svc/b")
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apisink
+
+import (
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+)
+
+type server struct {
+	localnetv1.UnimplementedEndpointsServer
+
+	state *state
+}
+
+var syncItem = &localnetv1.OpItem{Op: &localnetv1.OpItem_Sync{Sync: &localnetv1.SyncOp{}}}
+
+// Watch serves the synced state. Watches are not resumable (the sync has no revision), so clients restart
+// from an empty state on reconnection.
+func (s *server) Watch(res localnetv1.Endpoints_WatchServer) error {
+	ctx := res.Context()
+
+	var prev map[ref][]byte
+	revision := uint64(0)
+
+	for {
+		req, err := res.Recv()
+		if err != nil {
+			return err
+		}
+
+		klog.V(2).Infof("watch request from node %q", req.NodeName)
+
+		snap, err := s.state.wait(ctx, revision)
+		if err != nil {
+			return err
+		}
+
+		for _, op := range snap.diff(prev) {
+			if err := res.Send(op); err != nil {
+				return err
+			}
+		}
+
+		if err := res.Send(syncItem); err != nil {
+			return err
+		}
+
+		prev, revision = snap.values, snap.revision
+	}
+}
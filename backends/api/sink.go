@@ -0,0 +1,127 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package apisink re-serves the node-local state as a localnetv1 gRPC service on a UNIX socket, so consumers
+// on the same node (ie: a CNI agent) can subscribe to it without talking to the kpng server.
+package apisink
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/backendcmd"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+type backend struct {
+	cfg localsink.Config
+
+	socket string
+}
+
+func init() {
+	backendcmd.Register("to-api", func() backendcmd.Cmd { return &backend{} })
+}
+
+func (b *backend) BindFlags(flags *pflag.FlagSet) {
+	b.cfg.BindFlags(flags)
+
+	flags.StringVar(&b.socket, "api-socket", "/run/kpng/local.sock", "UNIX socket to serve the node-local state on")
+}
+
+func (b *backend) Sink() localsink.Sink {
+	return &sink{
+		Config: &b.cfg,
+		socket: b.socket,
+		state:  newState(),
+		values: map[ref][]byte{},
+	}
+}
+
+type sink struct {
+	*localsink.Config
+
+	socket string
+	state  *state
+
+	// values is the state being received, published on sync
+	values map[ref][]byte
+}
+
+var _ localsink.Sink = &sink{}
+
+func (s *sink) Setup() {
+	lis, err := listen(s.socket)
+	if err != nil {
+		klog.Fatal("failed to listen on the API socket: ", err)
+	}
+
+	srv := grpc.NewServer()
+	localnetv1.RegisterEndpointsServer(srv, &server{state: s.state})
+
+	klog.Info("serving the node-local state on ", s.socket)
+
+	go func() {
+		klog.Fatal(srv.Serve(lis))
+	}()
+}
+
+func (s *sink) Reset() {
+	s.values = map[ref][]byte{}
+}
+
+func (s *sink) Send(op *localnetv1.OpItem) error {
+	switch v := op.Op.(type) {
+	case *localnetv1.OpItem_Set:
+		s.values[ref{v.Set.Ref.Set, v.Set.Ref.Path}] = v.Set.Bytes
+
+	case *localnetv1.OpItem_Delete:
+		delete(s.values, ref{v.Delete.Set, v.Delete.Path})
+
+	case *localnetv1.OpItem_Sync:
+		// the published values are shared with the watchers, continue on a copy
+		values := make(map[ref][]byte, len(s.values))
+		for r, value := range s.values {
+			values[r] = value
+		}
+
+		s.state.publish(s.values)
+		s.values = values
+	}
+
+	return nil
+}
+
+// listen listens on the UNIX socket, removing a stale one left by a previous run.
+func listen(socket string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+		return nil, err
+	}
+
+	if err := os.Remove(socket); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return net.Listen("unix", socket)
+}
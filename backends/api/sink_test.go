@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apisink
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+func setOp(set localnetv1.Set, path, value string) *localnetv1.OpItem {
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Set{Set: &localnetv1.Value{
+		Ref:   &localnetv1.Ref{Set: set, Path: path},
+		Bytes: []byte(value),
+	}}}
+}
+
+func deleteOp(set localnetv1.Set, path string) *localnetv1.OpItem {
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Delete{Delete: &localnetv1.Ref{Set: set, Path: path}}}
+}
+
+func TestWatch(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "local.sock")
+
+	s := (&backend{cfg: localsink.Config{NodeName: "node-1"}, socket: socket}).Sink()
+	s.Setup()
+
+	send := func(ops ...*localnetv1.OpItem) {
+		for _, op := range ops {
+			if err := s.Send(op); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	send(
+		setOp(localnetv1.Set_EndpointsSet, "ns/svc/a", "ep-a"),
+		setOp(localnetv1.Set_ServicesSet, "ns/svc", "svc"),
+		syncItem,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, "unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	watch, err := localnetv1.NewEndpointsClient(conn).Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := func() (ops []string) {
+		if err := watch.Send(&localnetv1.WatchReq{NodeName: "node-1"}); err != nil {
+			t.Fatal(err)
+		}
+
+		for {
+			op, err := watch.Recv()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch v := op.Op.(type) {
+			case *localnetv1.OpItem_Set:
+				ops = append(ops, "set:"+v.Set.Ref.Path+"="+string(v.Set.Bytes))
+			case *localnetv1.OpItem_Delete:
+				ops = append(ops, "del:"+v.Delete.Path)
+			case *localnetv1.OpItem_Sync:
+				return
+			}
+		}
+	}
+
+	expect := func(ops []string, expected ...string) {
+		t.Helper()
+		if len(ops) != len(expected) {
+			t.Fatalf("expected %q, got %q", expected, ops)
+		}
+		for i := range ops {
+			if ops[i] != expected[i] {
+				t.Fatalf("expected %q, got %q", expected, ops)
+			}
+		}
+	}
+
+	expect(next(), "set:ns/svc=svc", "set:ns/svc/a=ep-a")
+
+	send(
+		deleteOp(localnetv1.Set_EndpointsSet, "ns/svc/a"),
+		setOp(localnetv1.Set_EndpointsSet, "ns/svc/b", "ep-b"),
+		syncItem,
+	)
+
+	expect(next(), "del:ns/svc/a", "set:ns/svc/b=ep-b")
+
+	// unchanged state: the watch waits for the next sync
+	go s.Send(syncItem)
+
+	expect(next())
+}
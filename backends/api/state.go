@@ -0,0 +1,131 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apisink
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+)
+
+type ref struct {
+	set  localnetv1.Set
+	path string
+}
+
+// snapshot is an immutable synced state.
+type snapshot struct {
+	revision uint64
+	values   map[ref][]byte
+}
+
+// state holds the last synced state and notifies the watchers when it changes.
+type state struct {
+	mu      sync.Mutex
+	current *snapshot
+	changed chan struct{}
+}
+
+func newState() *state {
+	return &state{
+		current: &snapshot{values: map[ref][]byte{}},
+		changed: make(chan struct{}),
+	}
+}
+
+func (s *state) publish(values map[ref][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.current = &snapshot{
+		revision: s.current.revision + 1,
+		values:   values,
+	}
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// wait returns the first snapshot after the given revision.
+func (s *state) wait(ctx context.Context, after uint64) (*snapshot, error) {
+	for {
+		s.mu.Lock()
+		current, changed := s.current, s.changed
+		s.mu.Unlock()
+
+		if current.revision > after {
+			return current, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// diff returns the operations going from the previous values to the snapshot's, ordered so the node and services
+// are set before the endpoints and deleted after them.
+func (snap *snapshot) diff(prev map[ref][]byte) (ops []*localnetv1.OpItem) {
+	sets := map[localnetv1.Set][]string{}
+	deletes := map[localnetv1.Set][]string{}
+
+	for r, value := range snap.values {
+		if prevValue, ok := prev[r]; !ok || !bytes.Equal(prevValue, value) {
+			sets[r.set] = append(sets[r.set], r.path)
+		}
+	}
+	for r := range prev {
+		if _, ok := snap.values[r]; !ok {
+			deletes[r.set] = append(deletes[r.set], r.path)
+		}
+	}
+
+	addSets := func(set localnetv1.Set) {
+		paths := sets[set]
+		sort.Strings(paths)
+		for _, path := range paths {
+			ops = append(ops, &localnetv1.OpItem{Op: &localnetv1.OpItem_Set{Set: &localnetv1.Value{
+				Ref:   &localnetv1.Ref{Set: set, Path: path},
+				Bytes: snap.values[ref{set, path}],
+			}}})
+		}
+	}
+	addDeletes := func(set localnetv1.Set) {
+		paths := deletes[set]
+		sort.Strings(paths)
+		for _, path := range paths {
+			ops = append(ops, &localnetv1.OpItem{Op: &localnetv1.OpItem_Delete{Delete: &localnetv1.Ref{
+				Set:  set,
+				Path: path,
+			}}})
+		}
+	}
+
+	addSets(localnetv1.Set_NodeSet)
+	addSets(localnetv1.Set_ServicesSet)
+	addDeletes(localnetv1.Set_EndpointsSet)
+	addSets(localnetv1.Set_EndpointsSet)
+	addDeletes(localnetv1.Set_ServicesSet)
+	addDeletes(localnetv1.Set_NodeSet)
+
+	return
+}
@@ -0,0 +1,11 @@
+module sigs.k8s.io/kpng/backends/dns
+
+go 1.19
+
+require (
+	github.com/spf13/pflag v1.0.5
+	golang.org/x/net v0.0.0-20221004154528-8021a29435af
+	k8s.io/klog/v2 v2.80.1
+	sigs.k8s.io/kpng/api v0.0.0-20220824013548-88b8a1d9bc62
+	sigs.k8s.io/kpng/client v0.0.0-20221011133104-469299451522
+)
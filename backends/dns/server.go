@@ -0,0 +1,276 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dnssink
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// maxUDPSize is the maximum size of an UDP response without EDNS.
+	maxUDPSize = 512
+	// maxTCPSize is the maximum size of a TCP response, given by its 16 bits length.
+	maxTCPSize = 65535
+
+	// tcpIdleTimeout closes the TCP connections idle for longer.
+	tcpIdleTimeout = 10 * time.Second
+)
+
+// server answers DNS queries from the latest zone.
+type server struct {
+	tracker *ttlTracker
+	zone    atomic.Value // *zone
+	now     func() time.Time
+}
+
+func newServer(domain string, tracker *ttlTracker) *server {
+	s := &server{tracker: tracker, now: time.Now}
+	s.zone.Store(&zone{domain: domain})
+	return s
+}
+
+func (s *server) setZone(z *zone) {
+	s.zone.Store(z)
+}
+
+// ListenAndServe serves UDP and TCP queries on addr until a listener fails.
+func (s *server) ListenAndServe(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	klog.Info("serving DNS on ", conn.LocalAddr(), " (UDP and TCP)")
+
+	errs := make(chan error, 2)
+	go func() { errs <- s.serveUDP(conn) }()
+	go func() { errs <- s.serveTCP(l) }()
+
+	return <-errs
+}
+
+func (s *server) serveUDP(conn net.PacketConn) error {
+	buf := make([]byte, 65536)
+	for {
+		n, remote, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		res, err := s.handle(buf[:n], maxUDPSize)
+		if err != nil {
+			klog.V(1).Info("invalid query from ", remote, ": ", err)
+			continue
+		}
+
+		if _, err = conn.WriteTo(res, remote); err != nil {
+			klog.V(1).Info("failed to answer ", remote, ": ", err)
+		}
+	}
+}
+
+func (s *server) serveTCP(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn answers the queries of a TCP connection, each prefixed by its length (RFC 1035 section 4.2.2), until
+// the client closes it or stays idle for tcpIdleTimeout.
+func (s *server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	remote := conn.RemoteAddr()
+	r := bufio.NewReader(conn)
+
+	for {
+		conn.SetDeadline(time.Now().Add(tcpIdleTimeout))
+
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			if err != io.EOF {
+				klog.V(1).Info("failed to read from ", remote, ": ", err)
+			}
+			return
+		}
+
+		msg := make([]byte, length)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			klog.V(1).Info("failed to read from ", remote, ": ", err)
+			return
+		}
+
+		res, err := s.handle(msg, maxTCPSize)
+		if err != nil {
+			klog.V(1).Info("invalid query from ", remote, ": ", err)
+			return
+		}
+
+		out := make([]byte, 2, 2+len(res))
+		binary.BigEndian.PutUint16(out, uint16(len(res)))
+		if _, err = conn.Write(append(out, res...)); err != nil {
+			klog.V(1).Info("failed to answer ", remote, ": ", err)
+			return
+		}
+	}
+}
+
+// handle returns the response to the query msg, truncated if it's over maxSize.
+func (s *server) handle(msg []byte, maxSize int) ([]byte, error) {
+	var p dnsmessage.Parser
+
+	h, err := p.Start(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.answer(h, q, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res) > maxSize {
+		// let the client retry on TCP (or another server)
+		return s.answer(h, q, true)
+	}
+
+	return res, nil
+}
+
+func (s *server) answer(h dnsmessage.Header, q dnsmessage.Question, truncated bool) ([]byte, error) {
+	z := s.zone.Load().(*zone)
+
+	res := dnsmessage.Header{
+		ID:               h.ID,
+		Response:         true,
+		OpCode:           h.OpCode,
+		RecursionDesired: h.RecursionDesired,
+		Authoritative:    true,
+		Truncated:        truncated,
+		RCode:            dnsmessage.RCodeSuccess,
+	}
+
+	name := strings.ToLower(q.Name.String())
+
+	var e *entry
+	switch {
+	case h.OpCode != 0 || q.Class != dnsmessage.ClassINET:
+		res.RCode = dnsmessage.RCodeNotImplemented
+	case !z.contains(name):
+		res.Authoritative = false
+		res.RCode = dnsmessage.RCodeRefused
+	default:
+		if e = z.lookup(name); e == nil {
+			res.RCode = dnsmessage.RCodeNameError
+		}
+	}
+
+	b := dnsmessage.NewBuilder(make([]byte, 0, maxUDPSize), res)
+	b.EnableCompression()
+
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	if e != nil && !truncated {
+		rh := dnsmessage.ResourceHeader{
+			Name:  q.Name,
+			Class: dnsmessage.ClassINET,
+			TTL:   s.tracker.TTL(e.changed, s.now()),
+		}
+
+		if err := e.build(&b, rh, q.Type); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.Finish()
+}
+
+func (e *entry) build(b *dnsmessage.Builder, rh dnsmessage.ResourceHeader, qType dnsmessage.Type) error {
+	any := qType == dnsmessage.TypeALL
+
+	if any || qType == dnsmessage.TypeA {
+		for _, ip := range e.a {
+			r := dnsmessage.AResource{}
+			copy(r.A[:], ip.To4())
+
+			if err := b.AResource(rh, r); err != nil {
+				return err
+			}
+		}
+	}
+
+	if any || qType == dnsmessage.TypeAAAA {
+		for _, ip := range e.aaaa {
+			r := dnsmessage.AAAAResource{}
+			copy(r.AAAA[:], ip.To16())
+
+			if err := b.AAAAResource(rh, r); err != nil {
+				return err
+			}
+		}
+	}
+
+	if any || qType == dnsmessage.TypeSRV {
+		for _, srv := range e.srv {
+			target, err := dnsmessage.NewName(srv.target)
+			if err != nil {
+				return err
+			}
+
+			r := dnsmessage.SRVResource{Weight: 100, Port: srv.port, Target: target}
+			if err := b.SRVResource(rh, r); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dnssink serves the services' DNS records directly from kpng's state, as a lightweight
+// cluster DNS for deployments without CoreDNS.
+package dnssink
+
+import (
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/client/backendcmd"
+	"sigs.k8s.io/kpng/client/localsink"
+	"sigs.k8s.io/kpng/client/localsink/fullstate"
+)
+
+type backend struct {
+	cfg localsink.Config
+
+	listen string
+	domain string
+	minTTL time.Duration
+	maxTTL time.Duration
+}
+
+func init() {
+	backendcmd.Register("to-dns", func() backendcmd.Cmd { return &backend{} })
+}
+
+func (b *backend) BindFlags(flags *pflag.FlagSet) {
+	b.cfg.BindFlags(flags)
+
+	flags.StringVar(&b.listen, "dns-listen", ":53", "address to serve DNS on (UDP and TCP)")
+	flags.StringVar(&b.domain, "dns-domain", "cluster.local", "cluster domain")
+	flags.DurationVar(&b.minTTL, "dns-min-ttl", 5*time.Second, "TTL of the records of recently changed services")
+	flags.DurationVar(&b.maxTTL, "dns-max-ttl", 5*time.Minute, "TTL of the records of stable services")
+}
+
+func (b *backend) Sink() localsink.Sink {
+	if b.maxTTL < b.minTTL {
+		klog.Fatalf("--dns-max-ttl (%v) must not be lower than --dns-min-ttl (%v)", b.maxTTL, b.minTTL)
+	}
+
+	domain := strings.ToLower(strings.TrimSuffix(b.domain, ".")) + "."
+
+	tracker := newTTLTracker(b.minTTL, b.maxTTL)
+	srv := newServer(domain, tracker)
+
+	sink := fullstate.New(&b.cfg)
+
+	sink.SetupFunc = func() {
+		go func() {
+			klog.Fatal(srv.ListenAndServe(b.listen))
+		}()
+	}
+
+	sink.Callback = fullstate.ArrayCallback(func(items []*fullstate.ServiceEndpoints) {
+		z := buildZone(domain, items, tracker, time.Now())
+		srv.setZone(z)
+
+		klog.V(1).Infof("serving %d DNS names", len(z.entries))
+	})
+
+	return sink
+}
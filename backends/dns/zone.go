@@ -0,0 +1,249 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dnssink
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink/fullstate"
+)
+
+type srvRecord struct {
+	target string
+	port   uint16
+}
+
+// entry holds the records of a name.
+type entry struct {
+	a    []net.IP
+	aaaa []net.IP
+	srv  []srvRecord
+
+	// changed is the last time the records of the owning service changed.
+	changed time.Time
+}
+
+// zone is an immutable view of the records served for the cluster domain.
+type zone struct {
+	domain  string // fully qualified, ie "cluster.local."
+	entries map[string]*entry
+}
+
+// contains returns true if name is in the zone's domain.
+func (z *zone) contains(name string) bool {
+	return name == z.domain || strings.HasSuffix(name, "."+z.domain)
+}
+
+func (z *zone) lookup(name string) *entry {
+	return z.entries[strings.ToLower(name)]
+}
+
+// ttlTracker tracks the changes of services' records so stable services get longer TTLs than
+// frequently changing ones.
+type ttlTracker struct {
+	minTTL, maxTTL time.Duration
+
+	services map[string]*serviceHistory
+}
+
+type serviceHistory struct {
+	fingerprint string
+	changed     time.Time
+}
+
+func newTTLTracker(minTTL, maxTTL time.Duration) *ttlTracker {
+	return &ttlTracker{
+		minTTL:   minTTL,
+		maxTTL:   maxTTL,
+		services: map[string]*serviceHistory{},
+	}
+}
+
+// TTL returns the TTL of records last changed at the given time: half the time they have been
+// stable, bounded by the configured min and max TTLs.
+func (t *ttlTracker) TTL(changed, now time.Time) uint32 {
+	ttl := now.Sub(changed) / 2
+
+	if ttl < t.minTTL {
+		ttl = t.minTTL
+	}
+	if ttl > t.maxTTL {
+		ttl = t.maxTTL
+	}
+
+	return uint32(ttl / time.Second)
+}
+
+// update records the current fingerprints of the services, returning the last change time of each.
+func (t *ttlTracker) update(fingerprints map[string]string, now time.Time) map[string]time.Time {
+	changed := make(map[string]time.Time, len(fingerprints))
+
+	for key, fp := range fingerprints {
+		h := t.services[key]
+		if h == nil {
+			h = &serviceHistory{}
+			t.services[key] = h
+		}
+
+		if h.fingerprint != fp || h.changed.IsZero() {
+			h.fingerprint = fp
+			h.changed = now
+		}
+
+		changed[key] = h.changed
+	}
+
+	for key := range t.services {
+		if _, ok := fingerprints[key]; !ok {
+			delete(t.services, key)
+		}
+	}
+
+	return changed
+}
+
+// buildZone computes the zone's records from the full state, following the Kubernetes DNS
+// specification for services:
+//   - <svc>.<ns>.svc.<domain> A/AAAA: the cluster IPs, or the endpoints' IPs for headless services,
+//   - <hostname>.<svc>.<ns>.svc.<domain> A/AAAA: the endpoints with a hostname, for headless services,
+//   - _<port>._<proto>.<svc>.<ns>.svc.<domain> SRV: the named ports.
+func buildZone(domain string, items []*fullstate.ServiceEndpoints, tracker *ttlTracker, now time.Time) *zone {
+	z := &zone{
+		domain:  domain,
+		entries: map[string]*entry{},
+	}
+
+	// names of each service, to fingerprint their records once all built
+	serviceNames := map[string][]string{}
+
+	for _, seps := range items {
+		svc := seps.Service
+		if svc.IPs == nil {
+			continue
+		}
+
+		key := svc.NamespacedName()
+		svcName := strings.ToLower(fmt.Sprintf("%s.%s.svc.%s", svc.Name, svc.Namespace, domain))
+
+		get := func(name string) *entry {
+			e := z.entries[name]
+			if e == nil {
+				e = &entry{}
+				z.entries[name] = e
+				serviceNames[key] = append(serviceNames[key], name)
+			}
+			return e
+		}
+
+		svcEntry := get(svcName)
+
+		if svc.IPs.Headless {
+			for _, ep := range seps.Endpoints {
+				if ep.IPs == nil {
+					continue
+				}
+
+				var hostEntry *entry
+				if ep.Hostname != "" {
+					hostEntry = get(strings.ToLower(ep.Hostname) + "." + svcName)
+				}
+
+				for _, e := range []*entry{svcEntry, hostEntry} {
+					if e != nil {
+						e.addIPs(ep.IPs)
+					}
+				}
+			}
+		} else {
+			svcEntry.addIPs(svc.IPs.ClusterIPs)
+		}
+
+		for _, port := range svc.Ports {
+			if port.Name == "" {
+				continue
+			}
+
+			name := strings.ToLower(fmt.Sprintf("_%s._%s.%s", port.Name, port.Protocol, svcName))
+			e := get(name)
+			e.srv = append(e.srv, srvRecord{target: svcName, port: uint16(port.Port)})
+		}
+	}
+
+	fingerprints := make(map[string]string, len(serviceNames))
+	for key, names := range serviceNames {
+		fingerprints[key] = z.fingerprint(names)
+	}
+
+	changed := tracker.update(fingerprints, now)
+
+	for key, names := range serviceNames {
+		for _, name := range names {
+			z.entries[name].changed = changed[key]
+		}
+	}
+
+	return z
+}
+
+func (e *entry) addIPs(set *localnetv1.IPSet) {
+	if set == nil {
+		return
+	}
+
+	for _, s := range set.V4 {
+		if ip := net.ParseIP(s).To4(); ip != nil {
+			e.a = append(e.a, ip)
+		}
+	}
+	for _, s := range set.V6 {
+		if ip := net.ParseIP(s); ip != nil {
+			e.aaaa = append(e.aaaa, ip)
+		}
+	}
+}
+
+// fingerprint returns a stable representation of the records of the given names.
+func (z *zone) fingerprint(names []string) string {
+	names = append([]string{}, names...)
+	sort.Strings(names)
+
+	b := &strings.Builder{}
+	for _, name := range names {
+		e := z.entries[name]
+
+		values := make([]string, 0, len(e.a)+len(e.aaaa)+len(e.srv))
+		for _, ip := range e.a {
+			values = append(values, ip.String())
+		}
+		for _, ip := range e.aaaa {
+			values = append(values, ip.String())
+		}
+		for _, srv := range e.srv {
+			values = append(values, fmt.Sprintf("%s:%d", srv.target, srv.port))
+		}
+		sort.Strings(values)
+
+		fmt.Fprintf(b, "%s=%s;", name, strings.Join(values, ","))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dnssink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink/fullstate"
+)
+
+func testState(dnsIP string) []*fullstate.ServiceEndpoints {
+	return []*fullstate.ServiceEndpoints{
+		{
+			Service: &localnetv1.Service{
+				Namespace: "kube-system",
+				Name:      "dns",
+				IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet(dnsIP, "fd00::10")},
+				Ports: []*localnetv1.PortMapping{
+					{Name: "dns", Protocol: localnetv1.Protocol_UDP, Port: 53},
+				},
+			},
+		},
+		{
+			Service: &localnetv1.Service{
+				Namespace: "default",
+				Name:      "db",
+				IPs:       &localnetv1.ServiceIPs{Headless: true},
+			},
+			Endpoints: []*localnetv1.Endpoint{
+				{Hostname: "db-0", IPs: localnetv1.NewIPSet("10.1.0.1")},
+				{IPs: localnetv1.NewIPSet("10.1.0.2")},
+			},
+		},
+	}
+}
+
+func query(t *testing.T, s *server, name string, qType dnsmessage.Type) *dnsmessage.Message {
+	q := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 42},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: qType, Class: dnsmessage.ClassINET}},
+	}
+
+	req, err := q.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.handle(req, maxUDPSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &dnsmessage.Message{}
+	if err = msg.Unpack(res); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.ID != 42 {
+		t.Errorf("%s: wrong ID %d", name, msg.ID)
+	}
+
+	return msg
+}
+
+func TestServe(t *testing.T) {
+	now := time.Now()
+
+	tracker := newTTLTracker(5*time.Second, time.Minute)
+	s := newServer("cluster.local.", tracker)
+	s.now = func() time.Time { return now }
+
+	s.setZone(buildZone("cluster.local.", testState("10.0.0.10"), tracker, now))
+
+	msg := query(t, s, "dns.kube-system.svc.cluster.local.", dnsmessage.TypeA)
+	if len(msg.Answers) != 1 || msg.Answers[0].Body.(*dnsmessage.AResource).A != [4]byte{10, 0, 0, 10} {
+		t.Errorf("wrong A answers: %v", msg.Answers)
+	}
+
+	msg = query(t, s, "DNS.kube-system.svc.cluster.local.", dnsmessage.TypeAAAA)
+	if len(msg.Answers) != 1 {
+		t.Errorf("wrong AAAA answers: %v", msg.Answers)
+	}
+
+	msg = query(t, s, "_dns._udp.dns.kube-system.svc.cluster.local.", dnsmessage.TypeSRV)
+	if len(msg.Answers) != 1 || msg.Answers[0].Body.(*dnsmessage.SRVResource).Port != 53 {
+		t.Errorf("wrong SRV answers: %v", msg.Answers)
+	}
+
+	msg = query(t, s, "db.default.svc.cluster.local.", dnsmessage.TypeA)
+	if len(msg.Answers) != 2 {
+		t.Errorf("headless service should resolve to its endpoints: %v", msg.Answers)
+	}
+
+	msg = query(t, s, "db-0.db.default.svc.cluster.local.", dnsmessage.TypeA)
+	if len(msg.Answers) != 1 {
+		t.Errorf("wrong endpoint answers: %v", msg.Answers)
+	}
+
+	msg = query(t, s, "unknown.default.svc.cluster.local.", dnsmessage.TypeA)
+	if msg.RCode != dnsmessage.RCodeNameError {
+		t.Errorf("expected NXDOMAIN, got %v", msg.RCode)
+	}
+
+	msg = query(t, s, "example.com.", dnsmessage.TypeA)
+	if msg.RCode != dnsmessage.RCodeRefused {
+		t.Errorf("expected REFUSED, got %v", msg.RCode)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	now := time.Now()
+
+	tracker := newTTLTracker(5*time.Second, time.Minute)
+	s := newServer("cluster.local.", tracker)
+	s.now = func() time.Time { return now }
+
+	ttl := func() uint32 {
+		msg := query(t, s, "dns.kube-system.svc.cluster.local.", dnsmessage.TypeA)
+		return msg.Answers[0].Header.TTL
+	}
+
+	s.setZone(buildZone("cluster.local.", testState("10.0.0.10"), tracker, now))
+
+	if v := ttl(); v != 5 {
+		t.Errorf("new service should have the min TTL, got %d", v)
+	}
+
+	// stable service
+	now = now.Add(30 * time.Second)
+	s.setZone(buildZone("cluster.local.", testState("10.0.0.10"), tracker, now))
+
+	if v := ttl(); v != 15 {
+		t.Errorf("service stable for 30s should have a TTL of 15, got %d", v)
+	}
+
+	now = now.Add(time.Hour)
+	if v := ttl(); v != 60 {
+		t.Errorf("TTL should be capped to the max TTL, got %d", v)
+	}
+
+	// changed service
+	s.setZone(buildZone("cluster.local.", testState("10.0.0.11"), tracker, now))
+
+	if v := ttl(); v != 5 {
+		t.Errorf("changed service should have the min TTL, got %d", v)
+	}
+}
+
+func TestServeTCP(t *testing.T) {
+	tracker := newTTLTracker(5*time.Second, time.Minute)
+	s := newServer("cluster.local.", tracker)
+
+	// a headless service with too many endpoints for an UDP response
+	items := testState("10.0.0.10")
+	for i := 3; i < 100; i++ {
+		items[1].Endpoints = append(items[1].Endpoints, &localnetv1.Endpoint{IPs: localnetv1.NewIPSet(fmt.Sprintf("10.1.0.%d", i))})
+	}
+	s.setZone(buildZone("cluster.local.", items, tracker, time.Now()))
+
+	msg := query(t, s, "db.default.svc.cluster.local.", dnsmessage.TypeA)
+	if !msg.Truncated || len(msg.Answers) != 0 {
+		t.Fatalf("UDP response should be truncated: %v", msg.Header)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go s.serveTCP(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	q := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 42},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("db.default.svc.cluster.local."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}
+	req, err := q.AppendPack(make([]byte, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.BigEndian.PutUint16(req, uint16(len(req)-2))
+
+	// queries are answered until the connection is closed
+	for i := 0; i < 2; i++ {
+		if _, err = conn.Write(req); err != nil {
+			t.Fatal(err)
+		}
+
+		var length uint16
+		if err = binary.Read(conn, binary.BigEndian, &length); err != nil {
+			t.Fatal(err)
+		}
+		res := make([]byte, length)
+		if _, err = io.ReadFull(conn, res); err != nil {
+			t.Fatal(err)
+		}
+
+		msg = &dnsmessage.Message{}
+		if err = msg.Unpack(res); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Truncated || len(msg.Answers) != 99 {
+			t.Errorf("TCP response should have all the endpoints, got %d (truncated: %v)", len(msg.Answers), msg.Truncated)
+		}
+	}
+}
@@ -6,56 +6,14 @@
 #include <stdbool.h>
 #include <errno.h>
 
+#include "lb4.h"
+
 #define SYS_REJECT 0
 #define SYS_PROCEED 1
-#define DEFAULT_MAX_EBPF_MAP_ENTRIES 65536
 #define IPPROTO_TCP 6
 
 char __license[] SEC("license") = "Dual BSD/GPL";
 
-struct V4_key {
-  __be32 address;     /* Service virtual IPv4 address  4*/
-  __be16 dport;       /* L4 port filter, if unset, all ports apply   */
-  __u16 backend_slot; /* Backend iterator, 0 indicates the svc frontend  2*/
-};
-
-struct lb4_service {
-  union {
-    __u32 backend_id;       /* Backend ID in lb4_backends */
-    __u32 affinity_timeout; /* In seconds, only for svc frontend */
-    __u32 l7_lb_proxy_port; /* In host byte order, only when flags2 &&
-                               SVC_FLAG_L7LOADBALANCER */
-  };
-  /* For the service frontend, count denotes number of service backend
-   * slots (otherwise zero).
-   */
-  __u16 count;
-  __u16 rev_nat_index; /* Reverse NAT ID in lb4_reverse_nat */
-  __u8 flags;
-  __u8 flags2;
-  __u8 pad[2];
-};
-
-struct lb4_backend {
-  __be32 address; /* Service endpoint IPv4 address */
-  __be16 port;    /* L4 port filter */
-  __u8 flags;
-};
-
-struct {
-  __uint(type, BPF_MAP_TYPE_HASH); 
-  __type(key, struct V4_key);
-  __type(value, struct lb4_service); 
-  __uint(max_entries, DEFAULT_MAX_EBPF_MAP_ENTRIES);
-} v4_svc_map SEC(".maps");
-
-struct {
-  __uint(type, BPF_MAP_TYPE_HASH); 
-  __type(key, __u32);
-  __type(value, struct lb4_backend); 
-  __uint(max_entries, DEFAULT_MAX_EBPF_MAP_ENTRIES);
-} v4_backend_map SEC(".maps");
-
 static __always_inline struct lb4_service *
 lb4_lookup_service(struct V4_key *key) {
   struct lb4_service *svc;
@@ -79,6 +37,16 @@ static __always_inline __u64 sock_select_slot(struct bpf_sock_addr *ctx) {
   return ctx->protocol == IPPROTO_TCP ? bpf_get_prandom_u32() : 0;
 }
 
+/* The Maglev table is indexed by a hash of the client's network namespace, so
+ * a client keeps its backend as long as the table entry doesn't change, which
+ * the Maglev table guarantees for most entries when the backends change.
+ */
+static __always_inline __u64 sock_select_maglev_slot(struct bpf_sock_addr *ctx) {
+  __u64 cookie = bpf_get_netns_cookie(ctx);
+
+  return (cookie * 0x9E3779B97F4A7C15ULL) >> 32;
+}
+
 static __always_inline struct lb4_backend *
 __lb4_lookup_backend(__u32 backend_id) {
   return bpf_map_lookup_elem(&v4_backend_map, &backend_id);
@@ -166,7 +134,11 @@ static __always_inline int __sock4_fwd(struct bpf_sock_addr *ctx) {
   bpf_trace_printk(debug_str, sizeof(debug_str),  key.address, key.dport, svc->backend_id);
 
   if (backend_id == 0) {
-    key.backend_slot = (sock_select_slot(ctx) % svc->count) + 1;
+    if (svc->flags & SVC_FLAG_MAGLEV) {
+      key.backend_slot = (sock_select_maglev_slot(ctx) % svc->count) + 1;
+    } else {
+      key.backend_slot = (sock_select_slot(ctx) % svc->count) + 1;
+    }
     backend_slot = __lb4_lookup_backend_slot(&key);
     if (!backend_slot) {
       return -ENOENT;
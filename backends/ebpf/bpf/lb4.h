@@ -0,0 +1,63 @@
+/* SPDX-License-Identifier: (LGPL-2.1 OR BSD-2-Clause) */
+/* Copyright Authors of Cilium */
+#ifndef __KPNG_LB4_H
+#define __KPNG_LB4_H
+
+/* The service and backend maps, shared by the programs */
+
+#define DEFAULT_MAX_EBPF_MAP_ENTRIES 65536
+
+/* Set on the service frontend when its backend slots are a Maglev table */
+#define SVC_FLAG_MAGLEV 0x1
+/* Set on the node port frontend when its remote backends reply directly to
+ * the clients (DSR)
+ */
+#define SVC_FLAG_DSR 0x2
+
+/* Set on the backends of the node */
+#define BACKEND_FLAG_LOCAL 0x1
+
+struct V4_key {
+  __be32 address;     /* Service virtual IPv4 address  4*/
+  __be16 dport;       /* L4 port filter, if unset, all ports apply   */
+  __u16 backend_slot; /* Backend iterator, 0 indicates the svc frontend  2*/
+};
+
+struct lb4_service {
+  union {
+    __u32 backend_id;       /* Backend ID in lb4_backends */
+    __u32 affinity_timeout; /* In seconds, only for svc frontend */
+    __u32 l7_lb_proxy_port; /* In host byte order, only when flags2 &&
+                               SVC_FLAG_L7LOADBALANCER */
+  };
+  /* For the service frontend, count denotes number of service backend
+   * slots (otherwise zero).
+   */
+  __u16 count;
+  __u16 rev_nat_index; /* Reverse NAT ID in lb4_reverse_nat */
+  __u8 flags;
+  __u8 flags2;
+  __u8 pad[2];
+};
+
+struct lb4_backend {
+  __be32 address; /* Service endpoint IPv4 address */
+  __be16 port;    /* L4 port filter */
+  __u8 flags;
+};
+
+struct {
+  __uint(type, BPF_MAP_TYPE_HASH); 
+  __type(key, struct V4_key);
+  __type(value, struct lb4_service); 
+  __uint(max_entries, DEFAULT_MAX_EBPF_MAP_ENTRIES);
+} v4_svc_map SEC(".maps");
+
+struct {
+  __uint(type, BPF_MAP_TYPE_HASH); 
+  __type(key, __u32);
+  __type(value, struct lb4_backend); 
+  __uint(max_entries, DEFAULT_MAX_EBPF_MAP_ENTRIES);
+} v4_backend_map SEC(".maps");
+
+#endif /* __KPNG_LB4_H */
@@ -0,0 +1,587 @@
+/* SPDX-License-Identifier: (GPL-2.0-only OR BSD-2-Clause) */
+/* Copyright 2022 The Kubernetes Authors */
+#include "uapi/linux/bpf.h"
+#include "bpf/bpf_helpers.h"
+#include "bpf/bpf_endian.h"
+#include <linux/types.h>
+#include <linux/if_ether.h>
+#include <linux/in.h>
+#include <linux/ip.h>
+#include <linux/pkt_cls.h>
+#include <linux/tcp.h>
+#include <linux/udp.h>
+#include <stdbool.h>
+
+#include "lb4.h"
+
+/* The node ports are translated to their backends when the packets enter the
+ * node's interfaces, without masquerading the clients: the replies of the
+ * backends are translated back to the node port when they leave them, with
+ * the conntrack entries recorded on the first packet of the connections.
+ *
+ * With DSR, the connections to the backends of the other nodes are forwarded
+ * to them, with the node port in an IP option: the backend's node records the
+ * translation of the replies from the option, and they go to the clients
+ * without going through this node. The packets are forwarded to the next hop
+ * to the backend on the interface they came in on, or IPIP encapsulated to the
+ * gateway of the backend when it's routed through another device (an overlay).
+ */
+
+#define IP_OFF sizeof(struct ethhdr) /* offset of the IPv4 header */
+#define IP_FRAGMENTED 0x3fff /* more fragments flag and fragment offset */
+
+#define TCP_FLAGS_OFF 13 /* offset of the flags byte in the TCP header */
+#define TCP_SYN 0x02
+
+#define IPOPT_DSR 0x9a /* copied, control class, number 26 */
+#define IPDEFTTL 64
+
+#ifndef AF_INET
+#define AF_INET 2
+#endif
+
+#define NSEC_PER_SEC 1000000000ULL
+/* The time to fill the largest bucket (a burst of 10000 at 1/s) */
+#define MAX_REFILL_NS (10000 * NSEC_PER_SEC)
+
+/* Set on the entries translating the replies */
+#define CT_FLAG_REPLY 0x1
+/* Set on the entries of the connections forwarded to the backend's node */
+#define CT_FLAG_DSR 0x2
+
+char __license[] SEC("license") = "Dual BSD/GPL";
+
+struct ct4_key {
+  __be32 saddr;
+  __be32 daddr;
+  __be16 sport;
+  __be16 dport;
+  __u8 proto;
+  __u8 pad[3];
+};
+
+struct ct4_entry {
+  __be32 address; /* Backend address, or node port address for the replies */
+  __be16 port;
+  __u8 flags;
+  __u8 pad;
+};
+
+/* The connections to the node ports, by the tuple of their packets */
+struct {
+  __uint(type, BPF_MAP_TYPE_LRU_HASH);
+  __type(key, struct ct4_key);
+  __type(value, struct ct4_entry);
+  __uint(max_entries, DEFAULT_MAX_EBPF_MAP_ENTRIES);
+} v4_ct_map SEC(".maps");
+
+/* The addresses of the node, where the node ports are open */
+struct {
+  __uint(type, BPF_MAP_TYPE_HASH);
+  __type(key, __be32);
+  __type(value, __u8);
+  __uint(max_entries, 256);
+} v4_node_addr_map SEC(".maps");
+
+/* The token bucket limiting the new connections to a node port, with a token
+ * per connection, in nanoseconds of its rate
+ */
+struct token_bucket {
+  struct bpf_spin_lock lock;
+  __u32 rate;  /* per second */
+  __u32 burst;
+  __u32 pad;
+  __u64 tokens;
+  __u64 last_ns;
+};
+
+/* The rate limits of the node ports, by port */
+struct {
+  __uint(type, BPF_MAP_TYPE_HASH);
+  __type(key, __be16);
+  __type(value, struct token_bucket);
+  __uint(max_entries, DEFAULT_MAX_EBPF_MAP_ENTRIES);
+} v4_nodeport_limit_map SEC(".maps");
+
+struct l4_ports {
+  __be16 source;
+  __be16 dest;
+};
+
+/* The option carrying the node port of a DSR connection */
+struct dsr_opt {
+  __u8 type;
+  __u8 len;
+  __be16 port;
+  __be32 address;
+};
+
+struct iphdr_dsr {
+  struct iphdr ip;
+  struct dsr_opt opt;
+};
+
+static __always_inline __sum16 csum_fold(__s64 csum) {
+  __u32 sum = csum;
+
+  sum = (sum & 0xffff) + (sum >> 16);
+  sum = (sum & 0xffff) + (sum >> 16);
+  return ~sum;
+}
+
+/* parse_ipv4 returns the IPv4 header of the TCP and UDP packets, and their
+ * ports, NULL for the other packets (and the fragments after the first one).
+ */
+static __always_inline struct iphdr *parse_ipv4(struct __sk_buff *skb,
+                                                struct l4_ports **ports) {
+  void *data = (void *)(long)skb->data;
+  void *data_end = (void *)(long)skb->data_end;
+  struct ethhdr *eth = data;
+  struct iphdr *ip = data + sizeof(*eth);
+
+  if ((void *)(ip + 1) > data_end || eth->h_proto != bpf_htons(ETH_P_IP)) {
+    return NULL;
+  }
+  /* the options would move the ports */
+  if (ip->ihl != 5 || (ip->frag_off & bpf_htons(IP_FRAGMENTED))) {
+    return NULL;
+  }
+  if (ip->protocol != IPPROTO_TCP && ip->protocol != IPPROTO_UDP) {
+    return NULL;
+  }
+
+  *ports = (void *)(ip + 1);
+  if ((void *)(*ports + 1) > data_end) {
+    return NULL;
+  }
+  return ip;
+}
+
+/* nat4_rewrite translates the destination (or source) address and port of the
+ * packet, and updates its checksums.
+ */
+static __always_inline int nat4_rewrite(struct __sk_buff *skb, __u8 proto,
+                                        bool dst, __be32 old_addr,
+                                        __be32 new_addr, __be16 old_port,
+                                        __be16 new_port) {
+  __u32 ip_off = sizeof(struct ethhdr);
+  __u32 l4_off = ip_off + sizeof(struct iphdr);
+  __u32 addr_off = ip_off + (dst ? offsetof(struct iphdr, daddr)
+                                 : offsetof(struct iphdr, saddr));
+  __u32 port_off = l4_off + (dst ? offsetof(struct l4_ports, dest)
+                                 : offsetof(struct l4_ports, source));
+  __u32 csum_off;
+  __u64 csum_flags = 0;
+  bool l4_csum = true;
+
+  if (proto == IPPROTO_TCP) {
+    csum_off = l4_off + offsetof(struct tcphdr, check);
+  } else {
+    __sum16 check;
+
+    csum_off = l4_off + offsetof(struct udphdr, check);
+    csum_flags = BPF_F_MARK_MANGLED_0;
+    /* the checksum is optional with UDP */
+    if (bpf_skb_load_bytes(skb, csum_off, &check, sizeof(check)) < 0) {
+      return TC_ACT_SHOT;
+    }
+    l4_csum = check != 0;
+  }
+
+  if (l4_csum) {
+    if (bpf_l4_csum_replace(skb, csum_off, old_addr, new_addr,
+                            csum_flags | BPF_F_PSEUDO_HDR | sizeof(new_addr)) < 0 ||
+        bpf_l4_csum_replace(skb, csum_off, old_port, new_port,
+                            csum_flags | sizeof(new_port)) < 0) {
+      return TC_ACT_SHOT;
+    }
+  }
+  if (bpf_l3_csum_replace(skb, ip_off + offsetof(struct iphdr, check), old_addr,
+                          new_addr, sizeof(new_addr)) < 0) {
+    return TC_ACT_SHOT;
+  }
+
+  if (bpf_skb_store_bytes(skb, addr_off, &new_addr, sizeof(new_addr), 0) < 0 ||
+      bpf_skb_store_bytes(skb, port_off, &new_port, sizeof(new_port), 0) < 0) {
+    return TC_ACT_SHOT;
+  }
+  return TC_ACT_OK;
+}
+
+/* nodeport_allow_connection takes a token from the bucket of the node port, if
+ * it's rate limited, and returns whether a new connection is allowed.
+ */
+static __always_inline bool nodeport_allow_connection(__be16 dport) {
+  struct token_bucket *bucket =
+      bpf_map_lookup_elem(&v4_nodeport_limit_map, &dport);
+  __u64 now = bpf_ktime_get_ns();
+  __u64 elapsed, max_tokens;
+  bool allow = false;
+
+  if (!bucket) {
+    return true;
+  }
+
+  bpf_spin_lock(&bucket->lock);
+
+  elapsed = now - bucket->last_ns;
+  if (elapsed > MAX_REFILL_NS) {
+    elapsed = MAX_REFILL_NS;
+  }
+  max_tokens = bucket->burst * NSEC_PER_SEC;
+  bucket->tokens += elapsed * bucket->rate;
+  if (bucket->tokens > max_tokens) {
+    bucket->tokens = max_tokens;
+  }
+  bucket->last_ns = now;
+
+  if (bucket->tokens >= NSEC_PER_SEC) {
+    bucket->tokens -= NSEC_PER_SEC;
+    allow = true;
+  }
+
+  bpf_spin_unlock(&bucket->lock);
+  return allow;
+}
+
+/* nodeport_select_backend returns the backend of a new connection to a node
+ * port of the node, NULL if the packet isn't sent to a node port. The verdict
+ * is set to drop the connections to the node ports without reachable backends,
+ * and the connections over their rate limit.
+ */
+static __always_inline struct lb4_backend *
+nodeport_select_backend(struct __sk_buff *skb, __be32 daddr, __be16 dport,
+                        int *verdict) {
+  struct V4_key key = {
+      .address = 0, /* the node ports are open on all the node addresses */
+      .dport = dport,
+      .backend_slot = 0,
+  };
+  struct lb4_service *svc;
+  struct lb4_service *backend_slot;
+  struct lb4_backend *backend;
+
+  if (!bpf_map_lookup_elem(&v4_node_addr_map, &daddr)) {
+    return NULL;
+  }
+  svc = bpf_map_lookup_elem(&v4_svc_map, &key);
+  if (!svc) {
+    return NULL;
+  }
+
+  *verdict = TC_ACT_SHOT;
+  if (svc->count == 0 || !nodeport_allow_connection(dport)) {
+    return NULL;
+  }
+
+  if (svc->flags & SVC_FLAG_MAGLEV) {
+    key.backend_slot = (bpf_get_hash_recalc(skb) % svc->count) + 1;
+  } else {
+    key.backend_slot = (bpf_get_prandom_u32() % svc->count) + 1;
+  }
+  backend_slot = bpf_map_lookup_elem(&v4_svc_map, &key);
+  if (!backend_slot) {
+    return NULL;
+  }
+  backend = bpf_map_lookup_elem(&v4_backend_map, &backend_slot->backend_id);
+  /* without DSR, only the node's backends are reachable without masquerading */
+  if (backend && !(backend->flags & BACKEND_FLAG_LOCAL) &&
+      !(svc->flags & SVC_FLAG_DSR)) {
+    return NULL;
+  }
+  return backend;
+}
+
+/* dsr_add_option adds the node port of the connection in an option of the
+ * packet, the backend's node translating the replies from it.
+ */
+static __always_inline int dsr_add_option(struct __sk_buff *skb, __be32 address,
+                                          __be16 port) {
+  struct iphdr_dsr hdr;
+
+  if (bpf_skb_load_bytes(skb, IP_OFF, &hdr.ip, sizeof(hdr.ip)) < 0) {
+    return TC_ACT_SHOT;
+  }
+
+  hdr.ip.ihl = sizeof(hdr) / 4;
+  hdr.ip.tot_len = bpf_htons(bpf_ntohs(hdr.ip.tot_len) + sizeof(hdr.opt));
+  hdr.ip.check = 0;
+  hdr.opt.type = IPOPT_DSR;
+  hdr.opt.len = sizeof(hdr.opt);
+  hdr.opt.port = port;
+  hdr.opt.address = address;
+  hdr.ip.check =
+      csum_fold(bpf_csum_diff(NULL, 0, (void *)&hdr, sizeof(hdr), 0));
+
+  /* the room is made after the IPv4 header (without options) */
+  if (bpf_skb_adjust_room(skb, sizeof(hdr.opt), BPF_ADJ_ROOM_NET, 0) < 0 ||
+      bpf_skb_store_bytes(skb, IP_OFF, &hdr, sizeof(hdr), 0) < 0) {
+    return TC_ACT_SHOT;
+  }
+  return TC_ACT_OK;
+}
+
+/* ipip_encap encapsulates the packet in an IPv4 header from saddr to daddr. */
+static __always_inline int ipip_encap(struct __sk_buff *skb, __be32 saddr,
+                                      __be32 daddr) {
+  struct iphdr inner;
+  struct iphdr outer = {};
+
+  if (bpf_skb_load_bytes(skb, IP_OFF, &inner, sizeof(inner)) < 0) {
+    return TC_ACT_SHOT;
+  }
+
+  outer.version = 4;
+  outer.ihl = sizeof(outer) / 4;
+  outer.tos = inner.tos;
+  outer.tot_len = bpf_htons(bpf_ntohs(inner.tot_len) + sizeof(outer));
+  outer.ttl = IPDEFTTL;
+  outer.protocol = IPPROTO_IPIP;
+  outer.saddr = saddr;
+  outer.daddr = daddr;
+  outer.check =
+      csum_fold(bpf_csum_diff(NULL, 0, (void *)&outer, sizeof(outer), 0));
+
+  if (bpf_skb_adjust_room(skb, sizeof(outer), BPF_ADJ_ROOM_MAC,
+                          BPF_F_ADJ_ROOM_ENCAP_L3_IPV4) < 0 ||
+      bpf_skb_store_bytes(skb, IP_OFF, &outer, sizeof(outer), 0) < 0) {
+    return TC_ACT_SHOT;
+  }
+  return TC_ACT_OK;
+}
+
+/* dsr_forward translates a packet of a DSR connection to its backend, and
+ * forwards it to the backend's node. The first packet of the TCP connections,
+ * and the UDP packets, carry the node port.
+ */
+static __always_inline int dsr_forward(struct __sk_buff *skb,
+                                       struct ct4_key *key,
+                                       struct ct4_entry *entry) {
+  struct bpf_fib_lookup fib = {};
+  bool add_option = key->proto == IPPROTO_UDP;
+  int ret;
+
+  if (key->proto == IPPROTO_TCP) {
+    __u8 flags;
+
+    if (bpf_skb_load_bytes(skb,
+                           IP_OFF + sizeof(struct iphdr) + TCP_FLAGS_OFF,
+                           &flags, sizeof(flags)) < 0) {
+      return TC_ACT_SHOT;
+    }
+    add_option = flags & TCP_SYN;
+  }
+
+  ret = nat4_rewrite(skb, key->proto, true, key->daddr, entry->address,
+                     key->dport, entry->port);
+  if (ret != TC_ACT_OK) {
+    return ret;
+  }
+  if (add_option) {
+    ret = dsr_add_option(skb, key->daddr, key->dport);
+    if (ret != TC_ACT_OK) {
+      return ret;
+    }
+  }
+
+  fib.family = AF_INET;
+  fib.l4_protocol = key->proto;
+  fib.sport = key->sport;
+  fib.dport = entry->port;
+  fib.tot_len = skb->len - IP_OFF;
+  fib.ipv4_src = key->saddr;
+  fib.ipv4_dst = entry->address;
+  fib.ifindex = skb->ifindex;
+
+  ret = bpf_fib_lookup(skb, &fib, sizeof(fib), 0);
+  if (ret != BPF_FIB_LKUP_RET_SUCCESS && ret != BPF_FIB_LKUP_RET_NO_NEIGH) {
+    return TC_ACT_SHOT;
+  }
+
+  /* the lookup sets ipv4_dst to the gateway, if the backend is routed through
+   * one
+   */
+  if (fib.ifindex != skb->ifindex && fib.ipv4_dst != entry->address) {
+    ret = ipip_encap(skb, key->daddr, fib.ipv4_dst);
+    if (ret != TC_ACT_OK) {
+      return ret;
+    }
+    return bpf_redirect_neigh(fib.ifindex, NULL, 0, 0);
+  }
+
+  if (ret == BPF_FIB_LKUP_RET_NO_NEIGH) {
+    return bpf_redirect_neigh(fib.ifindex, NULL, 0, 0);
+  }
+  if (bpf_skb_store_bytes(skb, offsetof(struct ethhdr, h_dest), fib.dmac,
+                          ETH_ALEN, 0) < 0 ||
+      bpf_skb_store_bytes(skb, offsetof(struct ethhdr, h_source), fib.smac,
+                          ETH_ALEN, 0) < 0) {
+    return TC_ACT_SHOT;
+  }
+  return bpf_redirect(fib.ifindex, 0);
+}
+
+/* load_dsr_header loads the IPv4 header at off, if it has the DSR option. */
+static __always_inline bool load_dsr_header(struct __sk_buff *skb, __u32 off,
+                                            struct iphdr_dsr *hdr) {
+  return bpf_skb_load_bytes(skb, off, hdr, sizeof(*hdr)) == 0 &&
+         hdr->ip.version == 4 && hdr->ip.ihl == sizeof(*hdr) / 4 &&
+         hdr->opt.type == IPOPT_DSR && hdr->opt.len == sizeof(hdr->opt) &&
+         !(hdr->ip.frag_off & bpf_htons(IP_FRAGMENTED)) &&
+         (hdr->ip.protocol == IPPROTO_TCP || hdr->ip.protocol == IPPROTO_UDP);
+}
+
+/* dsr_receive records the translation of the replies of the DSR connections
+ * forwarded to the backends of the node by the other nodes, and removes their
+ * option (and their IPIP header). The other packets pass.
+ */
+static __always_inline int dsr_receive(struct __sk_buff *skb) {
+  struct iphdr outer;
+  struct iphdr_dsr hdr;
+  struct l4_ports ports;
+  struct ct4_key key = {};
+  struct ct4_entry reply = {};
+
+  if (skb->protocol != bpf_htons(ETH_P_IP) ||
+      bpf_skb_load_bytes(skb, IP_OFF, &outer, sizeof(outer)) < 0) {
+    return TC_ACT_OK;
+  }
+
+  if (outer.protocol == IPPROTO_IPIP) {
+    if (outer.ihl != sizeof(outer) / 4 ||
+        !bpf_map_lookup_elem(&v4_node_addr_map, &outer.daddr) ||
+        !load_dsr_header(skb, IP_OFF + sizeof(outer), &hdr)) {
+      return TC_ACT_OK;
+    }
+    if (bpf_skb_adjust_room(skb, -(__s32)sizeof(outer), BPF_ADJ_ROOM_MAC,
+                            0) < 0) {
+      return TC_ACT_SHOT;
+    }
+  } else if (!load_dsr_header(skb, IP_OFF, &hdr)) {
+    return TC_ACT_OK;
+  }
+
+  if (bpf_skb_load_bytes(skb, IP_OFF + sizeof(hdr), &ports, sizeof(ports)) <
+      0) {
+    return TC_ACT_SHOT;
+  }
+
+  key.saddr = hdr.ip.daddr;
+  key.daddr = hdr.ip.saddr;
+  key.sport = ports.dest;
+  key.dport = ports.source;
+  key.proto = hdr.ip.protocol;
+  reply.address = hdr.opt.address;
+  reply.port = hdr.opt.port;
+  reply.flags = CT_FLAG_REPLY;
+
+  if (bpf_map_update_elem(&v4_ct_map, &key, &reply, BPF_ANY) < 0) {
+    return TC_ACT_SHOT;
+  }
+
+  /* the room is removed after the IPv4 header (without options) */
+  hdr.ip.ihl = sizeof(hdr.ip) / 4;
+  hdr.ip.tot_len = bpf_htons(bpf_ntohs(hdr.ip.tot_len) - sizeof(hdr.opt));
+  hdr.ip.check = 0;
+  hdr.ip.check =
+      csum_fold(bpf_csum_diff(NULL, 0, (void *)&hdr.ip, sizeof(hdr.ip), 0));
+
+  if (bpf_skb_adjust_room(skb, -(__s32)sizeof(hdr.opt), BPF_ADJ_ROOM_NET,
+                          0) < 0 ||
+      bpf_skb_store_bytes(skb, IP_OFF, &hdr.ip, sizeof(hdr.ip), 0) < 0) {
+    return TC_ACT_SHOT;
+  }
+  return TC_ACT_OK;
+}
+
+SEC("tc")
+int tc_nodeport_ingress(struct __sk_buff *skb) {
+  struct l4_ports *ports;
+  struct iphdr *ip = parse_ipv4(skb, &ports);
+  struct ct4_key key = {};
+  struct ct4_entry entry = {};
+  struct ct4_entry *ct;
+  int verdict = TC_ACT_OK;
+
+  if (!ip) {
+    return dsr_receive(skb);
+  }
+
+  key.saddr = ip->saddr;
+  key.daddr = ip->daddr;
+  key.sport = ports->source;
+  key.dport = ports->dest;
+  key.proto = ip->protocol;
+
+  ct = bpf_map_lookup_elem(&v4_ct_map, &key);
+  if (ct && !(ct->flags & CT_FLAG_REPLY)) {
+    entry = *ct;
+  } else {
+    struct lb4_backend *backend =
+        nodeport_select_backend(skb, key.daddr, key.dport, &verdict);
+    struct ct4_key reply_key = {};
+    struct ct4_entry reply = {};
+
+    if (!backend) {
+      return verdict;
+    }
+
+    entry.address = backend->address;
+    entry.port = backend->port;
+
+    /* the remote backends reply directly to the clients */
+    if (!(backend->flags & BACKEND_FLAG_LOCAL)) {
+      entry.flags = CT_FLAG_DSR;
+      if (bpf_map_update_elem(&v4_ct_map, &key, &entry, BPF_ANY) < 0) {
+        return TC_ACT_SHOT;
+      }
+      return dsr_forward(skb, &key, &entry);
+    }
+
+    reply_key.saddr = entry.address;
+    reply_key.daddr = key.saddr;
+    reply_key.sport = entry.port;
+    reply_key.dport = key.sport;
+    reply_key.proto = key.proto;
+    reply.address = key.daddr;
+    reply.port = key.dport;
+    reply.flags = CT_FLAG_REPLY;
+
+    if (bpf_map_update_elem(&v4_ct_map, &reply_key, &reply, BPF_ANY) < 0 ||
+        bpf_map_update_elem(&v4_ct_map, &key, &entry, BPF_ANY) < 0) {
+      return TC_ACT_SHOT;
+    }
+  }
+
+  if (entry.flags & CT_FLAG_DSR) {
+    return dsr_forward(skb, &key, &entry);
+  }
+  return nat4_rewrite(skb, key.proto, true, key.daddr, entry.address,
+                      key.dport, entry.port);
+}
+
+SEC("tc")
+int tc_nodeport_egress(struct __sk_buff *skb) {
+  struct l4_ports *ports;
+  struct iphdr *ip = parse_ipv4(skb, &ports);
+  struct ct4_key key = {};
+  struct ct4_entry *ct;
+
+  if (!ip) {
+    return TC_ACT_OK;
+  }
+
+  key.saddr = ip->saddr;
+  key.daddr = ip->daddr;
+  key.sport = ports->source;
+  key.dport = ports->dest;
+  key.proto = ip->protocol;
+
+  ct = bpf_map_lookup_elem(&v4_ct_map, &key);
+  if (!ct || !(ct->flags & CT_FLAG_REPLY)) {
+    return TC_ACT_OK;
+  }
+
+  return nat4_rewrite(skb, key.proto, false, key.saddr, ct->address, key.sport,
+                      ct->port);
+}
@@ -0,0 +1,63 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ebpf
+
+import (
+	cebpf "github.com/cilium/ebpf"
+
+	"sigs.k8s.io/kpng/client/backendcmd"
+	"sigs.k8s.io/kpng/client/capacity"
+)
+
+var _ backendcmd.CapacityEstimator = &backend{}
+
+// Capacity see backendcmd.CapacityEstimator: the limits are the max entries of the maps loaded in the kernel.
+func (b *backend) Capacity() []capacity.Resource {
+	return []capacity.Resource{
+		{
+			// a root entry per service port and node port, and an entry per backend slot (the Maglev table entries
+			// with maglev); weighted endpoints take more slots than estimated with random selection, as the node
+			// ports' slots of the local endpoints
+			Name:  "bpf-service-map-entries",
+			Limit: maxEntries(ebc.objs.V4SvcMap),
+			Estimate: func(stats capacity.Stats) int {
+				if b.loadBalancing == lbMaglev {
+					return (stats.Ports + stats.NodePorts) * (1 + b.maglevTableSize)
+				}
+				return stats.Ports + stats.NodePorts + stats.PortEndpoints
+			},
+		},
+		{
+			Name:  "bpf-backend-map-entries",
+			Limit: maxEntries(ebc.objs.V4BackendMap),
+			Estimate: func(stats capacity.Stats) int {
+				return stats.PortEndpoints
+			},
+		},
+	}
+}
+
+// maxEntries returns the max entries of the map, 0 if it's not loaded.
+func maxEntries(m *cebpf.Map) int {
+	if m == nil {
+		return 0
+	}
+	return int(m.MaxEntries())
+}
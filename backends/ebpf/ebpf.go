@@ -1,3 +1,6 @@
+//go:build linux
+// +build linux
+
 /*
 Copyright 2022 The Kubernetes Authors.
 
@@ -42,8 +45,9 @@ import (
 	"github.com/cespare/xxhash"
 )
 
-//go:generate bpf2go -cc $BPF_CLANG -cflags $BPF_CFLAGS bpf ./bpf/cgroup_connect4.c
-func ebpfSetup() ebpfController {
+//go:generate bpf2go -tags linux -cc $BPF_CLANG -cflags $BPF_CFLAGS bpf ./bpf/cgroup_connect4.c
+//go:generate bpf2go -tags linux -cc $BPF_CLANG -cflags $BPF_CFLAGS nodeport ./bpf/tc_nodeport.c
+func ebpfSetup(loadBalancing string, maglevTableSize int, nodePortInterfaceNames []string, dsr bool) ebpfController {
 	var err error
 
 	// Allow the current process to lock memory for eBPF resources.
@@ -87,9 +91,29 @@ func ebpfSetup() ebpfController {
 		klog.Fatal(err)
 	}
 
+	// Load the node port programs, sharing the maps, and attach them to the interfaces.
+	nodePortObjs, err := loadNodePortObjects(&objs)
+	if err != nil {
+		klog.Fatalf("loading node port objects: %v", err)
+	}
+
+	if err := syncNodeAddresses(nodePortObjs.V4NodeAddrMap); err != nil {
+		klog.Fatalf("Cannot set the node addresses: %v", err)
+	}
+
+	interfaces, err := nodePortInterfaces(nodePortInterfaceNames)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	for _, linkIndex := range interfaces {
+		if err := attachNodePortPrograms(&nodePortObjs, linkIndex); err != nil {
+			klog.Fatalf("Cannot attach the node port programs to interface %d: %v", linkIndex, err)
+		}
+	}
+
 	klog.Infof("Proxying packets in kernel...")
 
-	return NewEBPFController(objs, l, v1.IPv4Protocol)
+	return NewEBPFController(objs, l, nodePortObjs, interfaces, v1.IPv4Protocol, loadBalancing, maglevTableSize, dsr)
 }
 
 // detectCgroupPath returns the first-found mount point of type cgroup2
@@ -116,6 +140,10 @@ func detectRootCgroupPath() (string, error) {
 
 func (ebc *ebpfController) Cleanup() {
 	klog.Info("Cleaning Up EBPF resources")
+	for _, linkIndex := range ebc.nodePortInterfaces {
+		detachNodePortPrograms(&ebc.nodePortObjs, linkIndex)
+	}
+	ebc.nodePortObjs.Close()
 	ebc.bpfLink.Close()
 	ebc.objs.Close()
 }
@@ -128,8 +156,10 @@ func (ebc *ebpfController) Callback(ch <-chan *client.ServiceEndpoints) {
 	for serviceEndpoints := range ch {
 		klog.V(5).Infof("Iterating fullstate channel, got: %+v", serviceEndpoints)
 
-		if serviceEndpoints.Service.Type != "ClusterIP" {
-			klog.Warning("Ebpf Proxy not yet implemented for svc types other than clusterIP")
+		switch serviceEndpoints.Service.Type {
+		case "ClusterIP", "NodePort", "LoadBalancer":
+		default:
+			klog.Warning("Ebpf Proxy not yet implemented for svc types other than ClusterIP, NodePort and LoadBalancer")
 			continue
 		}
 
@@ -139,11 +169,29 @@ func (ebc *ebpfController) Callback(ch <-chan *client.ServiceEndpoints) {
 			servicePort := serviceEndpoints.Service.Ports[i]
 			svcKey := fmt.Sprintf("%s/%d/%s", svcUniqueName, servicePort.Port, servicePort.Protocol)
 			baseSvcInfo := ebc.newBaseServiceInfo(servicePort, serviceEndpoints.Service)
+			if baseSvcInfo.nodePort != 0 && !baseSvcInfo.nodeLocalExternal && !ebc.dsr {
+				klog.V(2).Infof("Not proxying the node port of %s: only the services with a Local external traffic policy are proxied without masquerading (see --dsr)", svcKey)
+			}
 
 			svcEndptRelation := svcEndpointMapping{Svc: baseSvcInfo, Endpoint: serviceEndpoints.Endpoints}
+			if ebc.dsr && !baseSvcInfo.nodeLocalExternal {
+				svcEndptRelation.DSR = true
+			}
+			if svcEndptRelation.proxiesNodePort() {
+				limit, err := serviceEndpoints.Service.GetNodePortRateLimit()
+				if err != nil {
+					klog.Errorf("not limiting the node ports of service %s: %v", svcUniqueName, err)
+				}
+				svcEndptRelation.NodePortRateLimit = limit
+			}
+			if useMaglev(serviceEndpoints.Service, ebc.loadBalancing) {
+				svcEndptRelation.MaglevTableSize = ebc.maglevTableSize
+			}
 			// JSON encoding of our services + EP information
 			svcEndptRelationBytes := new(bytes.Buffer)
 			json.NewEncoder(svcEndptRelationBytes).Encode(svcEndptRelation)
+			// the service info isn't exported, add the fields of its frontends
+			fmt.Fprintf(svcEndptRelationBytes, "%s %d %t", baseSvcInfo, baseSvcInfo.nodePort, baseSvcInfo.nodeLocalExternal)
 
 			// Always update cache regardless of if sync is needed
 			// Eventually we'll spawn multiple go routines to handle this
@@ -156,6 +204,11 @@ func (ebc *ebpfController) Callback(ch <-chan *client.ServiceEndpoints) {
 
 	}
 
+	// The node ports are open on the node addresses, that may have changed
+	if err := syncNodeAddresses(ebc.nodePortObjs.V4NodeAddrMap); err != nil {
+		klog.Errorf("Failed to sync the node addresses: %v", err)
+	}
+
 	// Reconcile what we have in ebc.svcInfo to internal cache and ebpf maps
 	// The diffstore will let us know if anything changed or was deleted.
 	if len(ebc.svcMap.Updated()) != 0 || len(ebc.svcMap.Deleted()) != 0 {
@@ -184,8 +237,15 @@ func (ebc *ebpfController) Sync() {
 			ebc.Cleanup()
 		}
 
+		if svcInfo.NodePortRateLimit != nil {
+			if err := setNodePortRateLimit(ebc.nodePortObjs.V4NodeportLimitMap, svcInfo.Svc.nodePort, nil); err != nil {
+				klog.Errorf("Failed Deleting the node port rate limit: %v", err)
+			}
+		}
+
 		// Remove service entry from cache
 		ebc.svcMap.Delete(KV.Key)
+		delete(ebc.frontends, string(KV.Key))
 	}
 
 	for _, KV := range ebc.svcMap.Updated() {
@@ -195,6 +255,23 @@ func (ebc *ebpfController) Sync() {
 
 		svcKeys, svcValues, backendKeys, backendValues := makeEbpfMaps(svcInfo)
 
+		// Delete the frontends not programmed anymore (a node port whose traffic policy isn't Local anymore), their
+		// backend slots aren't reachable without their root entry
+		roots := []bpfV4Key{}
+		for _, key := range svcKeys {
+			if key.BackendSlot == 0 {
+				roots = append(roots, key)
+			}
+		}
+		for _, key := range ebc.frontends[string(KV.Key)] {
+			if !containsKey(roots, key) {
+				if err := ebc.objs.V4SvcMap.Delete(key); err != nil && !errors.Is(err, cebpf.ErrKeyNotExist) {
+					klog.Errorf("Failed Deleting service entry %+v: %v", key, err)
+				}
+			}
+		}
+		ebc.frontends[string(KV.Key)] = roots
+
 		if _, err := ebc.objs.V4SvcMap.BatchUpdate(svcKeys, svcValues, &cebpf.BatchOptions{}); err != nil {
 			klog.Fatalf("Failed Loading service entries: %v", err)
 			ebc.Cleanup()
@@ -204,14 +281,18 @@ func (ebc *ebpfController) Sync() {
 			klog.Fatalf("Failed Loading service backend entries: %v", err)
 			ebc.Cleanup()
 		}
+
+		if svcInfo.Svc.nodePort != 0 {
+			if err := setNodePortRateLimit(ebc.nodePortObjs.V4NodeportLimitMap, svcInfo.Svc.nodePort, svcInfo.NodePortRateLimit); err != nil {
+				klog.Errorf("Failed Loading the node port rate limit: %v", err)
+			}
+		}
 	}
 }
 
 func makeEbpfMaps(svcMapping svcEndpointMapping) (svcKeys []bpfV4Key, svcValues []bpfLb4Service,
 	backendKeys []uint32, backendValues []bpfLb4Backend) {
-	var svcPort [2]byte
 	var targetPort [2]byte
-	var backendAddress [4]byte
 	var ID uint32
 	var err error
 	addresses := []string{}
@@ -219,34 +300,20 @@ func makeEbpfMaps(svcMapping svcEndpointMapping) (svcKeys []bpfV4Key, svcValues
 	// Encode Port in LE and then Load in NE to ensure the int value that's loaded
 	// is in fact in Network Endian
 	binary.BigEndian.PutUint16(targetPort[:], uint16(svcMapping.Svc.targetPort))
-	binary.BigEndian.PutUint16(svcPort[:], uint16(svcMapping.Svc.port))
 
+	weights := []int32{}
+	local := []bool{}
 	for _, endpoint := range svcMapping.Endpoint {
 		addresses = append(addresses, endpoint.IPs.V4...)
+		for range endpoint.IPs.V4 {
+			weights = append(weights, endpoint.BalancingWeight())
+			local = append(local, endpoint.Local)
+		}
 	}
 
-	// Make root (backendID 0, count != # of backends) key/value for service
-	svcKeys = append(svcKeys, bpfV4Key{
-		// Load to map in network endian
-		// net package automatically represents in NE, no need to convert
-		Address:     binary.LittleEndian.Uint32(svcMapping.Svc.clusterIP.To4()),
-		Dport:       binary.LittleEndian.Uint16(svcPort[:]),
-		BackendSlot: 0,
-	})
-
-	svcValues = append(svcValues, bpfLb4Service{Count: uint16(len(addresses))})
-
-	// Make rest of svc and backend entries for service
+	// Make the backend entries, one per backend
+	backendIDs := make([]uint32, 0, len(addresses))
 	for i, address := range addresses {
-		i := i
-		copy(backendAddress[:], net.ParseIP(address).To4())
-
-		svcKeys = append(svcKeys, bpfV4Key{
-			Address:     binary.LittleEndian.Uint32(svcMapping.Svc.clusterIP.To4()),
-			Dport:       binary.LittleEndian.Uint16(svcPort[:]),
-			BackendSlot: uint16(i + 1),
-		})
-
 		// Make backendID the int value of the string version of the address + int protocol value
 		err = binary.Read(bytes.NewBuffer(net.ParseIP(address).To4()), binary.BigEndian, &ID)
 		if err != nil {
@@ -255,25 +322,110 @@ func makeEbpfMaps(svcMapping svcEndpointMapping) (svcKeys []bpfV4Key, svcValues
 		}
 		// Increment by port to have unique backend value for each svcPort
 		ID = ID + uint32(svcMapping.Svc.port)
-
-		svcValues = append(svcValues, bpfLb4Service{
-			Count:     0,
-			BackendId: ID,
-		})
+		backendIDs = append(backendIDs, ID)
 
 		backendKeys = append(backendKeys, uint32(ID))
 
-		backendValues = append(backendValues, bpfLb4Backend{
+		backend := bpfLb4Backend{
 			Address: binary.LittleEndian.Uint32(net.ParseIP(address).To4()),
 			Port:    binary.LittleEndian.Uint16(targetPort[:]),
-		})
+		}
+		if local[i] {
+			backend.Flags = backendFlagLocal
+		}
+		backendValues = append(backendValues, backend)
 	}
+
+	// The cluster IP frontend, to all the backends
+	svcKeys, svcValues = appendFrontend(svcKeys, svcValues, svcMapping.Svc.clusterIP, svcMapping.Svc.port, 0,
+		backendIDs, addresses, weights, svcMapping.MaglevTableSize)
+
+	// The node port frontend, open on all the node addresses, to all the backends with DSR, the other backends
+	// replying directly to the clients
+	if svcMapping.Svc.nodePort != 0 && svcMapping.DSR {
+		svcKeys, svcValues = appendFrontend(svcKeys, svcValues, net.IPv4zero, svcMapping.Svc.nodePort, svcFlagDSR,
+			backendIDs, addresses, weights, svcMapping.MaglevTableSize)
+	}
+
+	// Otherwise to the backends of the node: the other backends would need the clients to be masqueraded
+	if svcMapping.Svc.nodePort != 0 && svcMapping.Svc.nodeLocalExternal {
+		localIDs, localAddresses, localWeights := []uint32{}, []string{}, []int32{}
+		for i := range addresses {
+			if local[i] {
+				localIDs = append(localIDs, backendIDs[i])
+				localAddresses = append(localAddresses, addresses[i])
+				localWeights = append(localWeights, weights[i])
+			}
+		}
+
+		svcKeys, svcValues = appendFrontend(svcKeys, svcValues, net.IPv4zero, svcMapping.Svc.nodePort, 0,
+			localIDs, localAddresses, localWeights, svcMapping.MaglevTableSize)
+	}
+
 	klog.V(5).Infof("Writing svcKeys %+v \nsvcValues %+v \nbackendKeys %+v \nbackendValues %+v",
 		svcKeys, svcValues, backendKeys, backendValues)
 
 	return svcKeys, svcValues, backendKeys, backendValues
 }
 
+// proxiesNodePort returns whether the node port of the service is proxied: to its local backends with a Local
+// external traffic policy, and to all its backends with DSR.
+func (m svcEndpointMapping) proxiesNodePort() bool {
+	return m.Svc.nodePort != 0 && (m.Svc.nodeLocalExternal || m.DSR)
+}
+
+// appendFrontend appends the entries of a frontend of the service to the service map entries: its root entry (backend
+// slot 0, with the flags), and its backend slots.
+func appendFrontend(svcKeys []bpfV4Key, svcValues []bpfLb4Service, address net.IP, port int, flags uint8,
+	backendIDs []uint32, addresses []string, weights []int32, maglevTableSize int) ([]bpfV4Key, []bpfLb4Service) {
+	var svcPort [2]byte
+	binary.BigEndian.PutUint16(svcPort[:], uint16(port))
+
+	key := func(slot int) bpfV4Key {
+		return bpfV4Key{
+			// Load to map in network endian
+			// net package automatically represents in NE, no need to convert
+			Address:     binary.LittleEndian.Uint32(address.To4()),
+			Dport:       binary.LittleEndian.Uint16(svcPort[:]),
+			BackendSlot: uint16(slot),
+		}
+	}
+
+	// a backend has a number of slots proportional to its weight, with random selection as with maglev
+	slots := weightedSlots(addresses, weights)
+
+	// Make root (backendID 0, count != # of backends) key/value for the frontend
+	root := bpfLb4Service{Flags: flags}
+	if maglevTableSize != 0 && len(addresses) != 0 {
+		slots = maglevTable(addresses, weights, maglevTableSize)
+		root.Flags |= svcFlagMaglev
+	}
+	root.Count = uint16(len(slots))
+
+	svcKeys = append(svcKeys, key(0))
+	svcValues = append(svcValues, root)
+
+	// Make rest of svc entries for the frontend
+	for i, backend := range slots {
+		svcKeys = append(svcKeys, key(i+1))
+		svcValues = append(svcValues, bpfLb4Service{
+			Count:     0,
+			BackendId: backendIDs[backend],
+		})
+	}
+
+	return svcKeys, svcValues
+}
+
+func containsKey(keys []bpfV4Key, key bpfV4Key) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
 // // mapToEbpfProto takes a proto as defined by KPNG and maps it to those defined by
 // // linux in https://github.com/torvalds/linux/blob/master/include/uapi/linux/in.h#L27
 // func mapToEbpfProto(kpngProto int) U8proto {
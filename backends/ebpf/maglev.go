@@ -0,0 +1,188 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ebpf
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/cespare/xxhash"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+)
+
+const (
+	// loadBalancingAnnotation selects the backend selection of a service, overriding --load-balancing.
+	loadBalancingAnnotation = "kpng.sigs.k8s.io/ebpf-load-balancing"
+
+	lbRandom = "random"
+	lbMaglev = "maglev"
+
+	defaultMaglevTableSize = 251
+
+	// maxWeightedSlots is the max number of backend slots of a service port with random selection and weighted
+	// backends
+	maxWeightedSlots = 1024
+
+	// svcFlagMaglev is set on the frontend entry of the service ports using a Maglev table (SVC_FLAG_MAGLEV in the
+	// bpf program)
+	svcFlagMaglev = 0x1
+)
+
+// validateLoadBalancing checks the backend selection and the Maglev table size.
+func validateLoadBalancing(loadBalancing string, maglevTableSize int) error {
+	switch loadBalancing {
+	case lbRandom, lbMaglev:
+	default:
+		return fmt.Errorf("invalid load balancing %q (must be %s or %s)", loadBalancing, lbRandom, lbMaglev)
+	}
+
+	if !isPrime(maglevTableSize) {
+		return fmt.Errorf("invalid Maglev table size %d (must be a prime number)", maglevTableSize)
+	}
+	return nil
+}
+
+// useMaglev returns true if the service selects its backends with a Maglev table.
+func useMaglev(service *localnetv1.Service, loadBalancing string) bool {
+	if lb, ok := service.Annotations[loadBalancingAnnotation]; ok {
+		return lb == lbMaglev
+	}
+	return loadBalancing == lbMaglev
+}
+
+// maglevTable returns the Maglev lookup table of the backends (see "Maglev: A Fast and Reliable Software Network Load
+// Balancer"): each entry is the index of a backend, each backend having a number of entries proportional to its
+// weight (the same for all if weights is nil). Adding or removing a backend changes the entries of about
+// size/len(backends) entries only, so the other clients keep their backend. The table only depends on the set of
+// backends, not on their order.
+func maglevTable(backends []string, weights []int32, size int) []int {
+	if len(backends) == 0 {
+		return nil
+	}
+
+	turns := normalizedWeights(backends, weights)
+
+	// fill the table in the order of the backends' names, so the ties don't depend on the order of the endpoints
+	order := make([]int, len(backends))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return backends[order[i]] < backends[order[j]] })
+
+	// the preference list of a backend is offset, offset+skip, offset+2*skip... (mod size)
+	offsets := make([]uint64, len(backends))
+	skips := make([]uint64, len(backends))
+	for i, backend := range backends {
+		offsets[i] = xxhash.Sum64String(backend) % uint64(size)
+		skips[i] = xxhash.Sum64String(backend+"/skip")%uint64(size-1) + 1
+	}
+
+	table := make([]int, size)
+	for i := range table {
+		table[i] = -1
+	}
+
+	// each round, a backend fills as many entries as its weight
+	next := make([]uint64, len(backends))
+	for filled := 0; ; {
+		for _, i := range order {
+			for turn := 0; turn < turns[i]; turn++ {
+				entry := (offsets[i] + next[i]*skips[i]) % uint64(size)
+				for table[entry] >= 0 {
+					next[i]++
+					entry = (offsets[i] + next[i]*skips[i]) % uint64(size)
+				}
+
+				table[entry] = i
+				next[i]++
+
+				filled++
+				if filled == size {
+					return table
+				}
+			}
+		}
+	}
+}
+
+// weightedSlots returns the backend slots of the random selection: each backend has a number of slots proportional
+// to its weight (one if weights is nil), up to maxWeightedSlots slots in total (at least one per backend).
+func weightedSlots(backends []string, weights []int32) []int {
+	turns := normalizedWeights(backends, weights)
+
+	total := 0
+	for _, n := range turns {
+		total += n
+	}
+
+	slots := make([]int, 0, total)
+	for i, n := range turns {
+		if total > maxWeightedSlots {
+			// scale down, keeping the ratios as much as possible
+			n = n * maxWeightedSlots / total
+			if n == 0 {
+				n = 1
+			}
+		}
+		for ; n != 0; n-- {
+			slots = append(slots, i)
+		}
+	}
+	return slots
+}
+
+// normalizedWeights returns the weights of the backends divided by their greatest common divisor, 1 for each backend if
+// weights is nil.
+func normalizedWeights(backends []string, weights []int32) []int {
+	turns := make([]int, len(backends))
+	divisor := 0
+	for i := range turns {
+		turns[i] = 1
+		if weights != nil && weights[i] > 0 {
+			turns[i] = int(weights[i])
+		}
+		divisor = gcd(divisor, turns[i])
+	}
+
+	for i := range turns {
+		turns[i] /= divisor
+	}
+	return turns
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for d := 2; d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ebpf
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMaglevTable(t *testing.T) {
+	const size = 251
+
+	backends := []string{}
+	for i := 1; i <= 10; i++ {
+		backends = append(backends, fmt.Sprintf("10.1.0.%d", i))
+	}
+
+	table := maglevTable(backends, nil, size)
+	if len(table) != size {
+		t.Fatalf("expected %d entries, got %d", size, len(table))
+	}
+
+	// each backend gets size/len(backends) entries, rounded either way
+	counts := make([]int, len(backends))
+	for _, backend := range table {
+		counts[backend]++
+	}
+	for i, count := range counts {
+		if count < size/len(backends) || count > size/len(backends)+1 {
+			t.Errorf("backend %s has %d entries", backends[i], count)
+		}
+	}
+
+	// the order of the backends doesn't change the table
+	reversed := make([]string, len(backends))
+	for i, backend := range backends {
+		reversed[len(backends)-1-i] = backend
+	}
+	for entry, backend := range maglevTable(reversed, nil, size) {
+		if reversed[backend] != backends[table[entry]] {
+			t.Fatalf("entry %d: %s with reversed backends, %s otherwise", entry, reversed[backend], backends[table[entry]])
+		}
+	}
+
+	// removing a backend changes its entries, and few others
+	removed := maglevTable(backends[1:], nil, size)
+	moved := 0
+	for entry, backend := range removed {
+		if table[entry] != 0 && backends[1:][backend] != backends[table[entry]] {
+			moved++
+		}
+	}
+	if moved > size/10 {
+		t.Errorf("%d entries of the remaining backends moved", moved)
+	}
+}
+
+func TestMaglevTableWeights(t *testing.T) {
+	const size = 251
+
+	backends := []string{"10.1.0.1", "10.1.0.2", "10.1.0.3"}
+	weights := []int32{20, 10, 10}
+
+	counts := make([]int, len(backends))
+	for _, backend := range maglevTable(backends, weights, size) {
+		counts[backend]++
+	}
+
+	// the first backend gets about half of the entries
+	if counts[0] < size/2-2 || counts[0] > size/2+2 {
+		t.Errorf("the backend of weight 20 has %d entries: %v", counts[0], counts)
+	}
+	if diff := counts[1] - counts[2]; diff < -1 || diff > 1 {
+		t.Errorf("the backends of weight 10 have %d and %d entries", counts[1], counts[2])
+	}
+}
+
+func TestWeightedSlots(t *testing.T) {
+	backends := []string{"10.1.0.1", "10.1.0.2", "10.1.0.3"}
+
+	for _, tc := range []struct {
+		weights []int32
+		slots   []int
+	}{
+		{nil, []int{0, 1, 2}},
+		{[]int32{1, 1, 1}, []int{0, 1, 2}},
+		{[]int32{10, 10, 10}, []int{0, 1, 2}},
+		{[]int32{4, 2, 2}, []int{0, 0, 1, 2}},
+		{[]int32{2, 0, 1}, []int{0, 0, 1, 2}}, // 0 is the default weight, 1
+		{[]int32{3, 1, 2}, []int{0, 0, 0, 1, 2, 2}},
+	} {
+		slots := weightedSlots(backends, tc.weights)
+		if fmt.Sprint(slots) != fmt.Sprint(tc.slots) {
+			t.Errorf("weights %v: expected slots %v, got %v", tc.weights, tc.slots, slots)
+		}
+	}
+
+	// the slots are capped, with at least one per backend
+	many := make([]string, 200)
+	weights := make([]int32, len(many))
+	for i := range many {
+		many[i] = fmt.Sprintf("10.1.%d.%d", i/256, i%256)
+		weights[i] = 1
+	}
+	weights[0] = 100
+
+	slots := weightedSlots(many, weights)
+	if len(slots) > maxWeightedSlots+len(many) {
+		t.Errorf("%d slots for %d backends", len(slots), len(many))
+	}
+	counts := make([]int, len(many))
+	for _, backend := range slots {
+		counts[backend]++
+	}
+	for i, count := range counts {
+		if count == 0 {
+			t.Fatalf("backend %d has no slot", i)
+		}
+	}
+}
+
+func TestValidateLoadBalancing(t *testing.T) {
+	for _, tc := range []struct {
+		loadBalancing string
+		size          int
+		valid         bool
+	}{
+		{lbRandom, defaultMaglevTableSize, true},
+		{lbMaglev, 65537, true},
+		{lbMaglev, 256, false},
+		{lbMaglev, 1, false},
+		{"round-robin", defaultMaglevTableSize, false},
+	} {
+		err := validateLoadBalancing(tc.loadBalancing, tc.size)
+		if (err == nil) != tc.valid {
+			t.Errorf("%s with table size %d: unexpected error %v", tc.loadBalancing, tc.size, err)
+		}
+	}
+}
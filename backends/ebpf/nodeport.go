@@ -0,0 +1,251 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ebpf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	cebpf "github.com/cilium/ebpf"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"k8s.io/klog"
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+)
+
+// The node ports are translated by TC programs attached to the interfaces of the node (see bpf/tc_nodeport.c):
+// tc_nodeport_ingress translates the connections to their backends, recording them in v4_ct_map, and
+// tc_nodeport_egress translates the replies back, so the clients aren't masqueraded. With DSR, the connections to the
+// backends of the other nodes are forwarded to them, and their replies are translated by their node.
+
+const (
+	// tcFilterPriority and tcFilterHandle identify the filters of the programs on the interfaces
+	tcFilterPriority = 1
+	tcFilterHandle   = 0x1
+
+	// backendFlagLocal is set on the backends of the node (BACKEND_FLAG_LOCAL in the bpf programs), the only ones the
+	// node ports are translated to
+	backendFlagLocal = 0x1
+
+	// svcFlagDSR is set on the node port frontends proxied to the backends of the other nodes (SVC_FLAG_DSR in the bpf
+	// programs)
+	svcFlagDSR = 0x2
+)
+
+// nodePortObjects are the programs and maps of the node ports. They share the service and backend maps of the
+// bpfObjects.
+type nodePortObjects struct {
+	nodeportPrograms
+
+	V4CtMap            *cebpf.Map `ebpf:"v4_ct_map"`
+	V4NodeAddrMap      *cebpf.Map `ebpf:"v4_node_addr_map"`
+	V4NodeportLimitMap *cebpf.Map `ebpf:"v4_nodeport_limit_map"`
+}
+
+func (o *nodePortObjects) Close() error {
+	return _NodeportClose(
+		&o.nodeportPrograms,
+		o.V4CtMap,
+		o.V4NodeAddrMap,
+		o.V4NodeportLimitMap,
+	)
+}
+
+// loadNodePortObjects loads the programs and maps of the node ports, using the service and backend maps of objs.
+func loadNodePortObjects(objs *bpfObjects) (nodePortObjects, error) {
+	nodePortObjs := nodePortObjects{}
+
+	spec, err := loadNodeport()
+	if err != nil {
+		return nodePortObjs, err
+	}
+
+	err = spec.RewriteMaps(map[string]*cebpf.Map{
+		"v4_svc_map":     objs.V4SvcMap,
+		"v4_backend_map": objs.V4BackendMap,
+	})
+	if err != nil {
+		return nodePortObjs, err
+	}
+
+	err = spec.LoadAndAssign(&nodePortObjs, nil)
+	return nodePortObjs, err
+}
+
+// nodePortInterfaces returns the indexes of the named interfaces, or of the interface of the default route if there
+// are none.
+func nodePortInterfaces(names []string) ([]int, error) {
+	if len(names) == 0 {
+		routes, err := netlink.RouteList(nil, netlink.FAMILY_V4)
+		if err != nil {
+			return nil, err
+		}
+		for _, route := range routes {
+			if route.Dst == nil && route.LinkIndex != 0 {
+				return []int{route.LinkIndex}, nil
+			}
+		}
+		return nil, errors.New("no default route to find the node port interface, set it with --nodeport-interfaces")
+	}
+
+	indexes := make([]int, 0, len(names))
+	for _, name := range names {
+		link, err := netlink.LinkByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("node port interface %s: %w", name, err)
+		}
+		indexes = append(indexes, link.Attrs().Index)
+	}
+	return indexes, nil
+}
+
+// attachNodePortPrograms attaches the programs to the ingress and egress of the interface, in its clsact qdisc.
+func attachNodePortPrograms(objs *nodePortObjects, linkIndex int) error {
+	qdisc := &netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: linkIndex,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	}
+	if err := netlink.QdiscReplace(qdisc); err != nil {
+		return fmt.Errorf("failed to add the clsact qdisc: %w", err)
+	}
+
+	for _, filter := range nodePortFilters(objs, linkIndex) {
+		if err := netlink.FilterReplace(filter); err != nil {
+			return fmt.Errorf("failed to attach %s: %w", filter.Name, err)
+		}
+	}
+	return nil
+}
+
+// detachNodePortPrograms removes the filters of the programs from the interface. The clsact qdisc is left, it may be
+// used by others.
+func detachNodePortPrograms(objs *nodePortObjects, linkIndex int) {
+	for _, filter := range nodePortFilters(objs, linkIndex) {
+		if err := netlink.FilterDel(filter); err != nil {
+			klog.Errorf("failed to detach %s from interface %d: %v", filter.Name, linkIndex, err)
+		}
+	}
+}
+
+func nodePortFilters(objs *nodePortObjects, linkIndex int) []*netlink.BpfFilter {
+	filter := func(parent uint32, name string, program *cebpf.Program) *netlink.BpfFilter {
+		return &netlink.BpfFilter{
+			FilterAttrs: netlink.FilterAttrs{
+				LinkIndex: linkIndex,
+				Parent:    parent,
+				Handle:    tcFilterHandle,
+				Protocol:  unix.ETH_P_ALL,
+				Priority:  tcFilterPriority,
+			},
+			Fd:           program.FD(),
+			Name:         name,
+			DirectAction: true,
+		}
+	}
+
+	return []*netlink.BpfFilter{
+		filter(netlink.HANDLE_MIN_INGRESS, "kpng-nodeport-ingress", objs.TcNodeportIngress),
+		filter(netlink.HANDLE_MIN_EGRESS, "kpng-nodeport-egress", objs.TcNodeportEgress),
+	}
+}
+
+// syncNodeAddresses sets the addresses of the node, where the node ports are open, in v4_node_addr_map.
+func syncNodeAddresses(m *cebpf.Map) error {
+	addrs, err := netlink.AddrList(nil, netlink.FAMILY_V4)
+	if err != nil {
+		return err
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if !addr.IP.IsLoopback() {
+			ips = append(ips, addr.IP)
+		}
+	}
+	return setNodeAddresses(m, ips)
+}
+
+// setNodeAddresses replaces the addresses in v4_node_addr_map.
+func setNodeAddresses(m *cebpf.Map, ips []net.IP) error {
+	nodeAddrs := map[uint32]bool{}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			// the map is in network endian, as the addresses of the packets
+			nodeAddrs[binary.LittleEndian.Uint32(ip4)] = true
+		}
+	}
+
+	var (
+		addr  uint32
+		value uint8
+		stale []uint32
+	)
+	entries := m.Iterate()
+	for entries.Next(&addr, &value) {
+		if !nodeAddrs[addr] {
+			stale = append(stale, addr)
+		}
+	}
+	if err := entries.Err(); err != nil {
+		return err
+	}
+
+	for _, addr := range stale {
+		if err := m.Delete(addr); err != nil && !errors.Is(err, cebpf.ErrKeyNotExist) {
+			return err
+		}
+	}
+	for addr := range nodeAddrs {
+		if err := m.Put(addr, uint8(1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setNodePortRateLimit sets the rate limit of the new connections to the node port in v4_nodeport_limit_map, with a
+// full bucket, or removes it if limit is nil.
+func setNodePortRateLimit(m *cebpf.Map, nodePort int, limit *localnetv1.NodePortRateLimit) error {
+	var port [2]byte
+	binary.BigEndian.PutUint16(port[:], uint16(nodePort))
+	// the map is in network endian, as the ports of the packets
+	key := binary.LittleEndian.Uint16(port[:])
+
+	if limit == nil {
+		if err := m.Delete(key); err != nil && !errors.Is(err, cebpf.ErrKeyNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	return m.Put(key, nodeportTokenBucket{
+		Rate:   uint32(limit.PerSecond),
+		Burst:  uint32(limit.Burst),
+		Tokens: uint64(limit.Burst) * uint64(time.Second),
+	})
+}
@@ -0,0 +1,501 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ebpf
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"runtime"
+	"testing"
+
+	cebpf "github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/rlimit"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+)
+
+const (
+	tcActOK       = 0
+	tcActShot     = 2
+	tcActRedirect = 7
+
+	tcpSYN = 0x02
+	tcpACK = 0x10
+)
+
+func TestMakeEbpfMapsNodePort(t *testing.T) {
+	endpoints := []*localnetv1.Endpoint{
+		{IPs: &localnetv1.IPSet{V4: []string{"10.1.0.1"}}, Local: true},
+		{IPs: &localnetv1.IPSet{V4: []string{"10.1.0.2"}}},
+	}
+
+	for _, tc := range []struct {
+		name              string
+		nodeLocalExternal bool
+		dsr               bool
+		frontends         int
+	}{
+		{"local", true, false, 2},
+		{"cluster", false, false, 1},
+		{"cluster with DSR", false, true, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := svcEndpointMapping{
+				Svc: &BaseServiceInfo{
+					clusterIP:         net.ParseIP("10.0.0.1"),
+					port:              80,
+					targetPort:        8080,
+					nodePort:          30080,
+					nodeLocalExternal: tc.nodeLocalExternal,
+				},
+				Endpoint: endpoints,
+				DSR:      tc.dsr,
+			}
+
+			svcKeys, svcValues, _, backendValues := makeEbpfMaps(svc)
+
+			if len(backendValues) != 2 || backendValues[0].Flags != backendFlagLocal || backendValues[1].Flags != 0 {
+				t.Fatalf("expected the first backend only to be local: %+v", backendValues)
+			}
+
+			roots := map[uint16]bpfLb4Service{} // port -> root entry
+			for i, key := range svcKeys {
+				if key.BackendSlot == 0 {
+					roots[ntohs(key.Dport)] = svcValues[i]
+				}
+			}
+			if len(roots) != tc.frontends {
+				t.Fatalf("expected %d frontends, got %+v", tc.frontends, roots)
+			}
+			if roots[80].Count != 2 {
+				t.Errorf("expected the cluster IP to have the 2 backends, got %d", roots[80].Count)
+			}
+			if tc.nodeLocalExternal && roots[30080].Count != 1 {
+				t.Errorf("expected the node port to have the local backend only, got %d", roots[30080].Count)
+			}
+			if tc.dsr && (roots[30080].Count != 2 || roots[30080].Flags != svcFlagDSR) {
+				t.Errorf("expected the node port to have the 2 backends with DSR, got %+v", roots[30080])
+			}
+		})
+	}
+}
+
+func TestNodePortPrograms(t *testing.T) {
+	objs, nodePortObjs := loadTestObjects(t)
+
+	nodeIP := net.ParseIP("192.168.0.10")
+	clientIP := net.ParseIP("192.168.0.1")
+	backendIP := net.ParseIP("10.1.0.1")
+
+	if err := setNodeAddresses(nodePortObjs.V4NodeAddrMap, []net.IP{nodeIP}); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := svcEndpointMapping{
+		Svc: &BaseServiceInfo{
+			clusterIP:         net.ParseIP("10.0.0.1"),
+			port:              80,
+			targetPort:        8080,
+			nodePort:          30080,
+			nodeLocalExternal: true,
+		},
+		Endpoint: []*localnetv1.Endpoint{{IPs: &localnetv1.IPSet{V4: []string{backendIP.String()}}, Local: true}},
+	}
+	putMaps(t, objs, svc)
+
+	// to the node port: translated to the backend
+	ret, out := runProgram(t, nodePortObjs.TcNodeportIngress, tcpPacket(clientIP, nodeIP, 40000, 30080, tcpSYN))
+	if ret != tcActOK {
+		t.Fatalf("expected the packet to pass, got %d", ret)
+	}
+	checkPacket(t, out, clientIP, backendIP, 40000, 8080)
+
+	// the next packets of the connection too
+	ret, out = runProgram(t, nodePortObjs.TcNodeportIngress, tcpPacket(clientIP, nodeIP, 40000, 30080, tcpSYN))
+	if ret != tcActOK {
+		t.Fatalf("expected the packet to pass, got %d", ret)
+	}
+	checkPacket(t, out, clientIP, backendIP, 40000, 8080)
+
+	// the replies are translated back
+	ret, out = runProgram(t, nodePortObjs.TcNodeportEgress, tcpPacket(backendIP, clientIP, 8080, 40000, tcpACK))
+	if ret != tcActOK {
+		t.Fatalf("expected the reply to pass, got %d", ret)
+	}
+	checkPacket(t, out, nodeIP, clientIP, 30080, 40000)
+
+	// the other ports aren't translated
+	ret, out = runProgram(t, nodePortObjs.TcNodeportIngress, tcpPacket(clientIP, nodeIP, 40000, 22, tcpSYN))
+	if ret != tcActOK {
+		t.Fatalf("expected the packet to pass, got %d", ret)
+	}
+	checkPacket(t, out, clientIP, nodeIP, 40000, 22)
+
+	// without local backends, the connections are dropped
+	svc.Endpoint[0].Local = false
+	putMaps(t, objs, svc)
+
+	ret, _ = runProgram(t, nodePortObjs.TcNodeportIngress, tcpPacket(clientIP, nodeIP, 40001, 30080, tcpSYN))
+	if ret != tcActShot {
+		t.Fatalf("expected the packet to be dropped, got %d", ret)
+	}
+}
+
+func TestNodePortRateLimit(t *testing.T) {
+	objs, nodePortObjs := loadTestObjects(t)
+
+	nodeIP := net.ParseIP("192.168.0.10")
+	clientIP := net.ParseIP("192.168.0.1")
+
+	if err := setNodeAddresses(nodePortObjs.V4NodeAddrMap, []net.IP{nodeIP}); err != nil {
+		t.Fatal(err)
+	}
+	putMaps(t, objs, svcEndpointMapping{
+		Svc: &BaseServiceInfo{
+			clusterIP:         net.ParseIP("10.0.0.1"),
+			port:              80,
+			targetPort:        8080,
+			nodePort:          30080,
+			nodeLocalExternal: true,
+		},
+		Endpoint: []*localnetv1.Endpoint{{IPs: &localnetv1.IPSet{V4: []string{"10.1.0.1"}}, Local: true}},
+	})
+
+	limit := &localnetv1.NodePortRateLimit{PerSecond: 1, Burst: 2}
+	if err := setNodePortRateLimit(nodePortObjs.V4NodeportLimitMap, 30080, limit); err != nil {
+		t.Fatal(err)
+	}
+
+	// the burst is allowed, then the rate (too slow to refill during the test)
+	for i, expected := range []uint32{tcActOK, tcActOK, tcActShot} {
+		ret, _ := runProgram(t, nodePortObjs.TcNodeportIngress, tcpPacket(clientIP, nodeIP, uint16(40000+i), 30080, tcpSYN))
+		if ret != expected {
+			t.Fatalf("connection %d: expected %d, got %d", i, expected, ret)
+		}
+	}
+
+	// the established connections aren't limited
+	ret, _ := runProgram(t, nodePortObjs.TcNodeportIngress, tcpPacket(clientIP, nodeIP, 40000, 30080, tcpACK))
+	if ret != tcActOK {
+		t.Fatalf("expected the packet of the connection to pass, got %d", ret)
+	}
+
+	// without the limit, the new connections are allowed
+	if err := setNodePortRateLimit(nodePortObjs.V4NodeportLimitMap, 30080, nil); err != nil {
+		t.Fatal(err)
+	}
+	ret, _ = runProgram(t, nodePortObjs.TcNodeportIngress, tcpPacket(clientIP, nodeIP, 40003, 30080, tcpSYN))
+	if ret != tcActOK {
+		t.Fatalf("expected the connection to be allowed, got %d", ret)
+	}
+}
+
+func TestNodePortDSR(t *testing.T) {
+	objs, nodePortObjs := loadTestObjects(t)
+	enterTestNetns(t)
+
+	nodeIP := net.ParseIP("192.168.0.10")
+	gatewayIP := net.ParseIP("192.168.0.20")
+	clientIP := net.ParseIP("192.168.0.1")
+	l2BackendIP := net.ParseIP("10.1.0.2")    // on the link of the node
+	encapBackendIP := net.ParseIP("10.2.0.2") // routed through the gateway
+	backendMAC, _ := net.ParseMAC("02:00:00:00:00:02")
+
+	link := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "kpng-test"}, PeerName: "kpng-test-peer"}
+	if err := netlink.LinkAdd(link); err != nil {
+		t.Skipf("can't create the test interface: %v", err)
+	}
+	for _, err := range []error{
+		netlink.LinkSetUp(link),
+		netlink.AddrAdd(link, &netlink.Addr{IPNet: &net.IPNet{IP: nodeIP, Mask: net.CIDRMask(24, 32)}}),
+		netlink.RouteAdd(&netlink.Route{LinkIndex: link.Index, Dst: &net.IPNet{IP: l2BackendIP.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}}),
+		netlink.RouteAdd(&netlink.Route{LinkIndex: link.Index, Dst: &net.IPNet{IP: encapBackendIP.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}, Gw: gatewayIP}),
+		netlink.NeighAdd(&netlink.Neigh{LinkIndex: link.Index, Family: netlink.FAMILY_V4, State: netlink.NUD_PERMANENT, IP: l2BackendIP, HardwareAddr: backendMAC}),
+		os.WriteFile("/proc/sys/net/ipv4/conf/all/forwarding", []byte("1"), 0644),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := setNodeAddresses(nodePortObjs.V4NodeAddrMap, []net.IP{nodeIP}); err != nil {
+		t.Fatal(err)
+	}
+	for nodePort, backendIP := range map[int]net.IP{30081: l2BackendIP, 30082: encapBackendIP} {
+		putMaps(t, objs, svcEndpointMapping{
+			Svc: &BaseServiceInfo{
+				clusterIP:  net.ParseIP("10.0.0.1"),
+				port:       80,
+				targetPort: 8080,
+				nodePort:   nodePort,
+			},
+			Endpoint: []*localnetv1.Endpoint{{IPs: &localnetv1.IPSet{V4: []string{backendIP.String()}}}},
+			DSR:      true,
+		})
+	}
+
+	// to a backend on the link: translated, with the node port in the option, and sent to the backend
+	ret, out := runProgram(t, nodePortObjs.TcNodeportIngress, tcpPacket(clientIP, nodeIP, 40000, 30081, tcpSYN))
+	if ret != tcActRedirect {
+		t.Fatalf("expected the packet to be redirected, got %d", ret)
+	}
+	if dst := net.HardwareAddr(out[0:6]); dst.String() != backendMAC.String() {
+		t.Errorf("expected the packet to be sent to %s, got %s", backendMAC, dst)
+	}
+	checkPacket(t, out, clientIP, l2BackendIP, 40000, 8080)
+	checkDSROption(t, out, nodeIP, 30081)
+	l2Packet := out
+
+	// the next packets of the connection don't carry the option
+	ret, out = runProgram(t, nodePortObjs.TcNodeportIngress, tcpPacket(clientIP, nodeIP, 40000, 30081, tcpACK))
+	if ret != tcActRedirect {
+		t.Fatalf("expected the packet to be redirected, got %d", ret)
+	}
+	checkPacket(t, out, clientIP, l2BackendIP, 40000, 8080)
+	if ihl := out[14] & 0xf; ihl != 5 {
+		t.Errorf("expected no option, got a header of %d words", ihl)
+	}
+
+	// to a backend routed through the gateway: encapsulated to the gateway
+	ret, out = runProgram(t, nodePortObjs.TcNodeportIngress, tcpPacket(clientIP, nodeIP, 40000, 30082, tcpSYN))
+	if ret != tcActRedirect {
+		t.Fatalf("expected the packet to be redirected, got %d", ret)
+	}
+	outer := out[14:34]
+	if outer[9] != 4 || !net.IP(outer[12:16]).Equal(nodeIP) || !net.IP(outer[16:20]).Equal(gatewayIP) || checksum(outer) != 0 {
+		t.Fatalf("expected an IPIP header from %s to %s, got % x", nodeIP, gatewayIP, outer)
+	}
+	inner := append(append([]byte{}, out[:14]...), out[34:]...)
+	checkPacket(t, inner, clientIP, encapBackendIP, 40000, 8080)
+	checkDSROption(t, inner, nodeIP, 30082)
+	encapPacket := out
+
+	// on the backend's node, the option is removed and the replies are translated to the node port
+	if err := setNodeAddresses(nodePortObjs.V4NodeAddrMap, []net.IP{gatewayIP}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		packet    []byte
+		backendIP net.IP
+		nodePort  uint16
+	}{
+		{l2Packet, l2BackendIP, 30081},
+		{encapPacket, encapBackendIP, 30082},
+	} {
+		ret, out = runProgram(t, nodePortObjs.TcNodeportIngress, tc.packet)
+		if ret != tcActOK {
+			t.Fatalf("expected the packet to pass, got %d", ret)
+		}
+		if ihl := out[14] & 0xf; ihl != 5 {
+			t.Errorf("expected the option to be removed, got a header of %d words", ihl)
+		}
+		checkPacket(t, out, clientIP, tc.backendIP, 40000, 8080)
+
+		ret, out = runProgram(t, nodePortObjs.TcNodeportEgress, tcpPacket(tc.backendIP, clientIP, 8080, 40000, tcpACK))
+		if ret != tcActOK {
+			t.Fatalf("expected the reply to pass, got %d", ret)
+		}
+		checkPacket(t, out, nodeIP, clientIP, tc.nodePort, 40000)
+	}
+}
+
+// enterTestNetns runs the test in a new network namespace, or skips it if it can't be created.
+func enterTestNetns(t *testing.T) {
+	runtime.LockOSThread()
+
+	origin, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		t.Skipf("can't get the network namespace: %v", err)
+	}
+	ns, err := netns.New()
+	if err != nil {
+		origin.Close()
+		runtime.UnlockOSThread()
+		t.Skipf("can't create a network namespace: %v", err)
+	}
+
+	t.Cleanup(func() {
+		netns.Set(origin)
+		origin.Close()
+		ns.Close()
+		runtime.UnlockOSThread()
+	})
+
+	lo, err := netlink.LinkByName("lo")
+	if err == nil {
+		err = netlink.LinkSetUp(lo)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkDSROption checks the option of a packet of a DSR connection.
+func checkDSROption(t *testing.T, packet []byte, address net.IP, port uint16) {
+	t.Helper()
+
+	opt := packet[34:42]
+	if packet[14]&0xf != 7 || opt[0] != 0x9a || opt[1] != 8 {
+		t.Fatalf("expected the DSR option, got % x", packet[14:42])
+	}
+	if p := binary.BigEndian.Uint16(opt[2:]); p != port || !net.IP(opt[4:8]).Equal(address) {
+		t.Errorf("expected %s:%d in the option, got %s:%d", address, port, net.IP(opt[4:8]), p)
+	}
+}
+
+// loadTestObjects loads the programs and maps, or skips the test if they can't be.
+func loadTestObjects(t *testing.T) (*bpfObjects, *nodePortObjects) {
+	if err := rlimit.RemoveMemlock(); err != nil {
+		t.Skipf("can't load the bpf programs: %v", err)
+	}
+
+	objs := &bpfObjects{}
+	if err := loadBpfObjects(objs, nil); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			t.Skipf("can't load the bpf programs: %v", err)
+		}
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { objs.Close() })
+
+	nodePortObjs, err := loadNodePortObjects(objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nodePortObjs.Close() })
+
+	return objs, &nodePortObjs
+}
+
+func putMaps(t *testing.T, objs *bpfObjects, svc svcEndpointMapping) {
+	svcKeys, svcValues, backendKeys, backendValues := makeEbpfMaps(svc)
+	for i := range svcKeys {
+		if err := objs.V4SvcMap.Put(svcKeys[i], svcValues[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range backendKeys {
+		if err := objs.V4BackendMap.Put(backendKeys[i], backendValues[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func runProgram(t *testing.T, prog *cebpf.Program, packet []byte) (uint32, []byte) {
+	ret, out, err := prog.Test(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret, out
+}
+
+// tcpPacket returns an ethernet frame of a TCP segment.
+func tcpPacket(src, dst net.IP, sport, dport uint16, flags byte) []byte {
+	packet := make([]byte, 14+20+20)
+
+	binary.BigEndian.PutUint16(packet[12:], 0x0800) // IPv4
+
+	ip := packet[14:34]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], 40)
+	ip[8] = 64
+	ip[9] = 6 // TCP
+	copy(ip[12:16], src.To4())
+	copy(ip[16:20], dst.To4())
+	binary.BigEndian.PutUint16(ip[10:], checksum(ip))
+
+	tcp := packet[34:]
+	binary.BigEndian.PutUint16(tcp[0:], sport)
+	binary.BigEndian.PutUint16(tcp[2:], dport)
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	binary.BigEndian.PutUint16(tcp[14:], 65535)
+	binary.BigEndian.PutUint16(tcp[16:], tcpChecksum(ip, tcp))
+
+	return packet
+}
+
+// checkPacket checks the addresses and ports of a packet from tcpPacket, and its checksums.
+func checkPacket(t *testing.T, packet []byte, src, dst net.IP, sport, dport uint16) {
+	t.Helper()
+
+	ipEnd := 14 + int(packet[14]&0xf)*4
+	ip := packet[14:ipEnd]
+	tcp := packet[ipEnd:]
+
+	if !net.IP(ip[12:16]).Equal(src) || !net.IP(ip[16:20]).Equal(dst) {
+		t.Errorf("expected %s -> %s, got %s -> %s", src, dst, net.IP(ip[12:16]), net.IP(ip[16:20]))
+	}
+	if p := binary.BigEndian.Uint16(tcp[0:]); p != sport {
+		t.Errorf("expected source port %d, got %d", sport, p)
+	}
+	if p := binary.BigEndian.Uint16(tcp[2:]); p != dport {
+		t.Errorf("expected destination port %d, got %d", dport, p)
+	}
+	if checksum(ip) != 0 {
+		t.Error("invalid IP checksum")
+	}
+	if tcpChecksum(ip, tcp) != 0 {
+		t.Error("invalid TCP checksum")
+	}
+}
+
+// checksum returns the internet checksum of the data, 0 if the data includes its valid checksum.
+func checksum(data []byte) uint16 {
+	return ^fold(sum(0, data))
+}
+
+func tcpChecksum(ip, tcp []byte) uint16 {
+	pseudo := make([]byte, 12)
+	copy(pseudo[0:8], ip[12:20])
+	pseudo[9] = ip[9]
+	binary.BigEndian.PutUint16(pseudo[10:], uint16(len(tcp)))
+	return ^fold(sum(sum(0, pseudo), tcp))
+}
+
+func sum(s uint32, data []byte) uint32 {
+	for i := 0; i+1 < len(data); i += 2 {
+		s += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		s += uint32(data[len(data)-1]) << 8
+	}
+	return s
+}
+
+func fold(s uint32) uint16 {
+	for s > 0xffff {
+		s = (s >> 16) + (s & 0xffff)
+	}
+	return uint16(s)
+}
+
+// ntohs returns the port of a map entry, stored in network endian.
+func ntohs(port uint16) uint16 {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], port)
+	return binary.BigEndian.Uint16(b[:])
+}
@@ -1,3 +1,6 @@
+//go:build linux
+// +build linux
+
 /*
 Copyright 2022 The Kubernetes Authors.
 
@@ -28,8 +31,15 @@ import (
 
 var ebc ebpfController
 
+var _ backendcmd.Cleaner = &backend{}
+
 type backend struct {
 	cfg localsink.Config
+
+	loadBalancing      string
+	maglevTableSize    int
+	nodePortInterfaces []string
+	dsr                bool
 }
 
 func init() {
@@ -37,6 +47,20 @@ func init() {
 }
 
 func (s *backend) BindFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&s.loadBalancing, "load-balancing", lbRandom,
+		"backend selection of the services: random, or maglev for consistent hashing (overridden by the "+loadBalancingAnnotation+" annotation)")
+	flags.IntVar(&s.maglevTableSize, "maglev-table-size", defaultMaglevTableSize,
+		"size of the Maglev table of a service port (a prime number, much larger than the number of endpoints)")
+	flags.StringSliceVar(&s.nodePortInterfaces, "nodeport-interfaces", nil,
+		"interfaces where the node ports are proxied (default: the interface of the default route)")
+	flags.BoolVar(&s.dsr, "dsr", false,
+		"proxy the node ports of the services with a Cluster external traffic policy, the backends of the other nodes replying directly to the clients")
+}
+
+// Scope see backendcmd.Scoped: only IPv4 is implemented for now, with the cluster IPs, and the node ports of the
+// services with a Local external traffic policy (all of them with --dsr).
+func (s *backend) Scope() (serviceTypes, families []string) {
+	return []string{"ClusterIP", "NodePort", "LoadBalancer"}, []string{"IPv4"}
 }
 
 func (s *backend) Reset() { /* noop */ }
@@ -48,12 +72,27 @@ func (s *backend) Reset() { /* noop */ }
 // }
 
 func (s *backend) Setup() {
-	ebc = ebpfSetup()
+	if err := validateLoadBalancing(s.loadBalancing, s.maglevTableSize); err != nil {
+		klog.Fatal(err)
+	}
+
+	ebc = ebpfSetup(s.loadBalancing, s.maglevTableSize, s.nodePortInterfaces, s.dsr)
 	klog.Infof("Loading ebpf maps and program %+v", ebc)
 }
 
 func (b *backend) Sync() { /* no-op */ }
 
+// Cleanup see backendcmd.Cleaner: the program is detached and the maps are released. The objects aren't pinned, so
+// they're released when the process exits anyway: the dataplane can't be retained.
+func (b *backend) Cleanup() error {
+	if ebc.bpfLink == nil {
+		// not setup
+		return nil
+	}
+	ebc.Cleanup()
+	return nil
+}
+
 func (b *backend) Sink() localsink.Sink {
 	sink := fullstate.New(&b.cfg)
 
@@ -1,3 +1,6 @@
+//go:build linux
+// +build linux
+
 /*
 Copyright 2022 The Kubernetes Authors.
 
@@ -34,6 +37,15 @@ type svcEndpointMapping struct {
 	Svc *BaseServiceInfo
 
 	Endpoint []*localnetv1.Endpoint
+
+	// MaglevTableSize is the size of the Maglev table of the backend slots, 0 to select the backends randomly
+	MaglevTableSize int
+
+	// DSR is set to proxy the node port to the backends of the other nodes, replying directly to the clients
+	DSR bool
+
+	// NodePortRateLimit limits the new connections to the node port, if it's proxied
+	NodePortRateLimit *localnetv1.NodePortRateLimit
 }
 
 type ebpfController struct {
@@ -46,18 +58,40 @@ type ebpfController struct {
 	// Program Link,
 	bpfLink cebpflink.Link
 
+	// Node port programs and maps, and the interfaces they're attached to
+	nodePortObjs       nodePortObjects
+	nodePortInterfaces []int
+
+	// <namespacedName>/<port>/<protocol> -> root keys of the frontends in the service map, to delete the frontends
+	// not programmed anymore
+	frontends map[string][]bpfV4Key
+
 	ipFamily v1.IPFamily
 
 	// <namespacedName>/<port>/<protocol> -> serviceEndpoints
 	svcMap *lightdiffstore.DiffStore
+
+	// backend selection of the services without the load balancing annotation, and size of the Maglev tables
+	loadBalancing   string
+	maglevTableSize int
+
+	// dsr is set to proxy the node ports of the services with a Cluster external traffic policy
+	dsr bool
 }
 
-func NewEBPFController(objs bpfObjects, bpfProgLink cebpflink.Link, ipFamily v1.IPFamily) ebpfController {
+func NewEBPFController(objs bpfObjects, bpfProgLink cebpflink.Link, nodePortObjs nodePortObjects,
+	nodePortInterfaces []int, ipFamily v1.IPFamily, loadBalancing string, maglevTableSize int, dsr bool) ebpfController {
 	return ebpfController{
-		objs:     objs,
-		bpfLink:  bpfProgLink,
-		ipFamily: ipFamily,
-		svcMap:   lightdiffstore.New(),
+		objs:               objs,
+		bpfLink:            bpfProgLink,
+		nodePortObjs:       nodePortObjs,
+		nodePortInterfaces: nodePortInterfaces,
+		ipFamily:           ipFamily,
+		svcMap:             lightdiffstore.New(),
+		frontends:          map[string][]bpfV4Key{},
+		loadBalancing:      loadBalancing,
+		maglevTableSize:    maglevTableSize,
+		dsr:                dsr,
 	}
 }
 
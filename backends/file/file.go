@@ -0,0 +1,121 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filesink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"sigs.k8s.io/yaml"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink/fullstate"
+)
+
+const (
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+	formatProto = "proto"
+)
+
+type encoder func(state *localnetv1.NodeLocalState) ([]byte, error)
+
+func encoderFor(format string) (encoder, error) {
+	switch format {
+	case formatJSON:
+		return func(state *localnetv1.NodeLocalState) ([]byte, error) {
+			data, err := protojson.Marshal(state)
+			if err != nil {
+				return nil, err
+			}
+
+			// protojson's output is purposely unstable, normalize it so unchanged states give identical files
+			buf := &bytes.Buffer{}
+			if err = json.Indent(buf, data, "", "  "); err != nil {
+				return nil, err
+			}
+			buf.WriteByte('\n')
+			return buf.Bytes(), nil
+		}, nil
+
+	case formatYAML:
+		return func(state *localnetv1.NodeLocalState) ([]byte, error) {
+			data, err := protojson.Marshal(state)
+			if err != nil {
+				return nil, err
+			}
+			return yaml.JSONToYAML(data)
+		}, nil
+
+	case formatProto:
+		return func(state *localnetv1.NodeLocalState) ([]byte, error) {
+			return proto.MarshalOptions{Deterministic: true}.Marshal(state)
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown file format %q (expected %s, %s or %s)", format, formatJSON, formatYAML, formatProto)
+}
+
+func buildState(nodeName string, items []*fullstate.ServiceEndpoints) *localnetv1.NodeLocalState {
+	state := &localnetv1.NodeLocalState{
+		NodeName: nodeName,
+		Services: make([]*localnetv1.ServiceEndpoints, 0, len(items)),
+	}
+
+	for _, item := range items {
+		state.Services = append(state.Services, &localnetv1.ServiceEndpoints{
+			Service:   item.Service,
+			Endpoints: item.Endpoints,
+		})
+	}
+
+	return state
+}
+
+// writeFile replaces the file atomically, so readers never see a partial state.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
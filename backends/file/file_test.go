@@ -0,0 +1,132 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filesink
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink/fullstate"
+)
+
+func testState() *localnetv1.NodeLocalState {
+	return buildState("node-1", []*fullstate.ServiceEndpoints{
+		{
+			Service: &localnetv1.Service{
+				Namespace: "default",
+				Name:      "kubernetes",
+				Type:      "ClusterIP",
+				IPs: &localnetv1.ServiceIPs{
+					ClusterIPs: localnetv1.NewIPSet("10.96.0.1"),
+				},
+				Ports: []*localnetv1.PortMapping{
+					{Name: "https", Protocol: localnetv1.Protocol_TCP, Port: 443, TargetPort: 6443},
+				},
+			},
+			Endpoints: []*localnetv1.Endpoint{
+				{IPs: localnetv1.NewIPSet("192.168.0.10")},
+			},
+		},
+	})
+}
+
+func TestEncoders(t *testing.T) {
+	state := testState()
+
+	for format, want := range map[string]string{
+		formatJSON: `"NodeName": "node-1"`,
+		formatYAML: "NodeName: node-1",
+	} {
+		encode, err := encoderFor(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := encode(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !containsLine(string(data), want) {
+			t.Errorf("%s: expected %q in:\n%s", format, want, data)
+		}
+	}
+
+	encode, err := encoderFor(formatProto)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := encode(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &localnetv1.NodeLocalState{}
+	if err := proto.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(state, decoded) {
+		t.Errorf("proto round-trip mismatch: %v != %v", decoded, state)
+	}
+
+	if _, err := encoderFor("xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	for _, content := range []string{"first", "second"} {
+		if err := writeFile(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("expected %q, got %q", content, data)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the state file, got %d entries", len(entries))
+	}
+}
+
+func containsLine(s, line string) bool {
+	for _, l := range strings.Split(s, "\n") {
+		l = strings.TrimSuffix(strings.TrimSpace(l), ",")
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,12 @@
+module sigs.k8s.io/kpng/backends/file
+
+go 1.19
+
+require (
+	github.com/spf13/pflag v1.0.5
+	google.golang.org/protobuf v1.28.1
+	k8s.io/klog/v2 v2.80.1
+	sigs.k8s.io/kpng/api v0.0.0-20220824013548-88b8a1d9bc62
+	sigs.k8s.io/kpng/client v0.0.0-20221011133104-469299451522
+	sigs.k8s.io/yaml v1.3.0
+)
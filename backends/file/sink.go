@@ -0,0 +1,74 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package filesink writes the node-local state to a file on each sync, so external dataplanes (hardware load
+// balancers, DPDK applications...) can consume kpng's state without speaking gRPC.
+package filesink
+
+import (
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/client/backendcmd"
+	"sigs.k8s.io/kpng/client/localsink"
+	"sigs.k8s.io/kpng/client/localsink/fullstate"
+)
+
+type backend struct {
+	cfg localsink.Config
+
+	path   string
+	format string
+}
+
+func init() {
+	backendcmd.Register("to-file", func() backendcmd.Cmd { return &backend{} })
+}
+
+func (b *backend) BindFlags(flags *pflag.FlagSet) {
+	b.cfg.BindFlags(flags)
+
+	flags.StringVar(&b.path, "file-path", "local-state.json", "file to write the node-local state to")
+	flags.StringVar(&b.format, "file-format", formatJSON, "format of the file (json, yaml or proto)")
+}
+
+func (b *backend) Sink() localsink.Sink {
+	encode, err := encoderFor(b.format)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	sink := fullstate.New(&b.cfg)
+
+	sink.Callback = fullstate.ArrayCallback(func(items []*fullstate.ServiceEndpoints) {
+		state := buildState(b.cfg.NodeName, items)
+
+		data, err := encode(state)
+		if err != nil {
+			klog.Error("failed to encode the local state: ", err)
+			return
+		}
+
+		if err := writeFile(b.path, data); err != nil {
+			klog.Error("failed to write the local state: ", err)
+			return
+		}
+
+		klog.V(1).Infof("wrote %d services to %s", len(state.Services), b.path)
+	})
+
+	return sink
+}
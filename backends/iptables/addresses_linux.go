@@ -0,0 +1,73 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"k8s.io/klog/v2"
+)
+
+// watchNodeAddresses calls resync when the node's addresses or links change (ie: DHCP renew, secondary IP
+// added), as the node port and external IP rules depend on them. Events are batched for the given delay.
+func watchNodeAddresses(delay time.Duration, resync func()) error {
+	done := make(chan struct{}) // never closed, the watch lasts as long as the process
+
+	onError := func(err error) {
+		klog.Error("netlink subscription error: ", err)
+	}
+
+	addrUpdates := make(chan netlink.AddrUpdate, 64)
+	err := netlink.AddrSubscribeWithOptions(addrUpdates, done, netlink.AddrSubscribeOptions{ErrorCallback: onError})
+	if err != nil {
+		return err
+	}
+
+	linkUpdates := make(chan netlink.LinkUpdate, 64)
+	err = netlink.LinkSubscribeWithOptions(linkUpdates, done, netlink.LinkSubscribeOptions{ErrorCallback: onError})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			select {
+			case u := <-addrUpdates:
+				klog.V(1).Info("node address changed: ", u.LinkAddress.String(), " (new: ", u.NewAddr, ")")
+			case u := <-linkUpdates:
+				klog.V(1).Info("node link changed: ", u.Link.Attrs().Name)
+			}
+
+			// batch the events
+			timeout := time.After(delay)
+		batch:
+			for {
+				select {
+				case <-addrUpdates:
+				case <-linkUpdates:
+				case <-timeout:
+					break batch
+				}
+			}
+
+			resync()
+		}
+	}()
+
+	return nil
+}
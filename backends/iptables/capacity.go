@@ -0,0 +1,48 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"sigs.k8s.io/kpng/client/backendcmd"
+	"sigs.k8s.io/kpng/client/capacity"
+)
+
+var _ backendcmd.CapacityEstimator = &Backend{}
+
+// Capacity see backendcmd.CapacityEstimator. The rules are counted like they're written by sync(); iptables has no
+// hard limit, but iptables-restore gets slower with the size of the tables, so the limits are set by the operators
+// (with --capacity-limits).
+func (s *Backend) Capacity() []capacity.Resource {
+	return []capacity.Resource{
+		{
+			Name: "iptables-rules",
+			Estimate: func(stats capacity.Stats) int {
+				// KUBE-SERVICES (and external) jumps per service IP and port, masquerade and reject rules per
+				// port, the KUBE-SVC jump and the KUBE-SEP masquerade and DNAT rules per endpoint, and the
+				// KUBE-NODEPORTS rules
+				return 2*stats.IPPorts + 2*stats.Ports + 3*stats.PortEndpoints + 2*stats.NodePorts
+			},
+		},
+		{
+			Name: "iptables-chains",
+			Estimate: func(stats capacity.Stats) int {
+				// a KUBE-SVC chain per port, a KUBE-SEP chain per endpoint of the port
+				return stats.Ports + stats.PortEndpoints
+			},
+		},
+	}
+}
@@ -56,6 +56,13 @@ func serviceLBChainName(servicePortName string, protocol string) util.Chain {
 	return util.Chain("KUBE-XLB-" + portProtoHash(servicePortName, protocol))
 }
 
+// serviceRateLimitName takes the ServicePortName for a service and returns the
+// name of the hashlimit table limiting its node port. Hashlimit names must be
+// <= 15 chars long, so the hash is truncated further with the prefix "KUBE-NP-".
+func serviceRateLimitName(servicePortName string, protocol string) string {
+	return "KUBE-NP-" + portProtoHash(servicePortName, protocol)[:7]
+}
+
 // This is the same as servicePortChainName but with the endpoint included.
 func servicePortEndpointChainName(servicePortName string, protocol string, endpoint string) util.Chain {
 	hash := sha256.Sum256([]byte(servicePortName + protocol + endpoint))
@@ -0,0 +1,108 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/backends/iptables/util"
+)
+
+// kubeChainPrefix is the prefix of the chains written by the backend.
+const kubeChainPrefix = "KUBE-"
+
+// cleanup removes the rules of the IP family: the jumps from the built-in chains to the kube chains, the kube chains
+// (KUBE-*), and then the ipsets they matched.
+func (t *iptables) cleanup() error {
+	var errs []string
+
+	for _, jump := range append(iptablesJumpChains, iptablesCleanupOnlyChains...) {
+		args := append(append([]string{}, jump.extraArgs...),
+			"-m", "comment", "--comment", jump.comment,
+			"-j", string(jump.dstChain),
+		)
+		if err := t.iptInterface.DeleteRule(jump.table, jump.srcChain, args...); err != nil && !util.IsNotFoundError(err) {
+			errs = append(errs, fmt.Sprintf("failed to delete the jump from %s to %s: %v", jump.srcChain, jump.dstChain, err))
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	for _, table := range []util.Table{util.TableNAT, util.TableFilter} {
+		buf.Reset()
+		if err := t.iptInterface.SaveInto(table, buf); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to read the %s table: %v", table, err))
+			continue
+		}
+
+		data := cleanupRules(table, util.GetChainLines(table, buf.Bytes()))
+		if data == nil {
+			continue
+		}
+
+		klog.V(2).InfoS("Deleting the chains", "ipFamily", t.iptInterface.Protocol(), "table", table)
+		if err := t.iptInterface.Restore(table, data, util.NoFlushTables, util.RestoreCounters); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to delete the chains of the %s table: %v", table, err))
+		}
+	}
+
+	if t.ipsets != nil {
+		// forget all the sets, the rules matching them are gone
+		t.ipsets.Retain(sets.NewString())
+		if err := t.ipsets.DestroyStale(); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to destroy the ipsets: %v", err))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// cleanupRules returns the iptables-restore input flushing and deleting the kube chains of the table (nil if none).
+func cleanupRules(table util.Table, existingChains map[util.Chain][]byte) []byte {
+	chains := make([]string, 0, len(existingChains))
+	for chain := range existingChains {
+		if strings.HasPrefix(string(chain), kubeChainPrefix) {
+			chains = append(chains, string(chain))
+		}
+	}
+	if len(chains) == 0 {
+		return nil
+	}
+	sort.Strings(chains)
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "*%s\n", table)
+
+	// flushed first, as they jump to each other
+	for _, chain := range chains {
+		buf.WriteString(util.MakeChainLine(util.Chain(chain)) + "\n")
+	}
+	for _, chain := range chains {
+		fmt.Fprintf(buf, "-X %s\n", chain)
+	}
+
+	buf.WriteString("COMMIT\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"testing"
+
+	"sigs.k8s.io/kpng/backends/iptables/util"
+)
+
+func TestCleanupRules(t *testing.T) {
+	save := []byte(`*nat
+:PREROUTING ACCEPT [0:0]
+:OUTPUT ACCEPT [0:0]
+:KUBE-SERVICES - [0:0]
+:KUBE-SVC-ABCD - [0:0]
+:CNI-HOSTPORT-DNAT - [0:0]
+-A PREROUTING -m comment --comment "kubernetes service portals" -j KUBE-SERVICES
+-A KUBE-SERVICES -d 10.0.0.1/32 -p tcp --dport 80 -j KUBE-SVC-ABCD
+COMMIT
+`)
+
+	expected := `*nat
+:KUBE-SERVICES - [0:0]
+:KUBE-SVC-ABCD - [0:0]
+-X KUBE-SERVICES
+-X KUBE-SVC-ABCD
+COMMIT
+`
+	if rules := string(cleanupRules(util.TableNAT, util.GetChainLines(util.TableNAT, save))); rules != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, rules)
+	}
+
+	if rules := cleanupRules(util.TableFilter, util.GetChainLines(util.TableFilter, save)); rules != nil {
+		t.Errorf("expected nothing to delete in the filter table, got:\n%s", rules)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/backends/iptables/util"
+)
+
+// Drift detection: once the rules are applied, the checksum of the chains owned by the backend (and of the jumps to
+// them) is computed from iptables-save; every --verify-period, it's computed again and compared, so chains flushed
+// or mangled by another agent are detected and repaired by a resync.
+
+// ownedChains are the chains created by the backend, in addition to the per-service chains (ownedChainPrefixes).
+// KUBE-MARK-DROP and KUBE-FIREWALL are left out, they're (also) managed by the kubelet.
+var ownedChains = map[string]bool{
+	string(kubeServicesChain):         true,
+	string(kubeExternalServicesChain): true,
+	string(kubeNodePortsChain):        true,
+	string(kubePostroutingChain):      true,
+	string(KubeMarkMasqChain):         true,
+	string(kubeForwardChain):          true,
+}
+
+var ownedChainPrefixes = []string{"KUBE-SVC-", "KUBE-FW-", "KUBE-XLB-", "KUBE-SEP-", splitChainPrefix}
+
+func isOwnedChain(chain string) bool {
+	if ownedChains[chain] {
+		return true
+	}
+	for _, prefix := range ownedChainPrefixes {
+		if strings.HasPrefix(chain, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// rulesChecksum returns the checksum of the owned chains and of the rules in or jumping to them, in the given
+// iptables-save output. The counters are ignored.
+func rulesChecksum(save []byte) string {
+	h := sha256.New()
+
+	for _, line := range bytes.Split(save, []byte{'\n'}) {
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+		case fields[0][0] == '*':
+			h.Write(line)
+
+		case fields[0][0] == ':':
+			chain := fields[0][1:]
+			if !isOwnedChain(chain) {
+				continue
+			}
+			h.Write([]byte(":" + chain))
+
+		case fields[0] == "-A" && len(fields) > 1:
+			owned := isOwnedChain(fields[1])
+			for i := 2; !owned && i < len(fields)-1; i++ {
+				if fields[i] == "-j" {
+					owned = isOwnedChain(fields[i+1])
+				}
+			}
+			if !owned {
+				continue
+			}
+			h.Write(line)
+
+		default:
+			continue
+		}
+
+		h.Write([]byte{'\n'})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// liveChecksum returns the checksum of the rules currently in the filter and nat tables.
+func (t *iptables) liveChecksum() (string, error) {
+	t.verifyData.Reset()
+
+	for _, table := range []util.Table{util.TableFilter, util.TableNAT} {
+		if err := t.iptInterface.SaveInto(table, t.verifyData); err != nil {
+			return "", err
+		}
+	}
+
+	return rulesChecksum(t.verifyData.Bytes()), nil
+}
+
+// recordChecksum records the checksum of the rules just applied, as the reference for the next verifications.
+func (t *iptables) recordChecksum() {
+	checksum, err := t.liveChecksum()
+	if err != nil {
+		klog.ErrorS(err, "Failed to execute iptables-save, the rules won't be verified until the next sync")
+		checksum = ""
+	}
+	t.checksum = checksum
+}
+
+// verify returns true if the rules drifted from the ones applied by the last sync.
+func (t *iptables) verify() bool {
+	if !t.applied || t.checksum == "" {
+		return false
+	}
+
+	checksum, err := t.liveChecksum()
+	if err != nil {
+		klog.ErrorS(err, "Failed to execute iptables-save, skipping the rules verification")
+		return false
+	}
+
+	if checksum == t.checksum {
+		return false
+	}
+
+	klog.InfoS("Rules drifted from the last sync, resyncing", "ipFamily", t.iptInterface.Protocol(), "expected", t.checksum, "found", checksum)
+	IptablesDriftTotal.WithLabelValues(string(t.iptInterface.Protocol())).Inc()
+	emitNodeWarning(t.recorder, "IPTablesDrift", "VerifyProxyRules", "%s rules changed outside of kpng, resyncing", t.iptInterface.Protocol())
+	return true
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"strings"
+	"testing"
+)
+
+const savedNAT = `# Generated by iptables-save v1.8.7 on Mon Jan  3 10:00:00 2022
+*nat
+:PREROUTING ACCEPT [10:600]
+:KUBE-SERVICES - [0:0]
+:KUBE-SVC-ABCDEF - [0:0]
+:KUBE-SEP-123456 - [0:0]
+:CNI-HOSTPORT-DNAT - [0:0]
+-A PREROUTING -m comment --comment "kubernetes service portals" -j KUBE-SERVICES
+-A PREROUTING -j CNI-HOSTPORT-DNAT
+-A KUBE-SERVICES -d 10.0.0.1/32 -p tcp -m tcp --dport 80 -j KUBE-SVC-ABCDEF
+-A KUBE-SVC-ABCDEF -j KUBE-SEP-123456
+-A KUBE-SEP-123456 -p tcp -m tcp -j DNAT --to-destination 10.1.0.2:8080
+COMMIT
+# Completed on Mon Jan  3 10:00:00 2022
+`
+
+func TestRulesChecksum(t *testing.T) {
+	expected := rulesChecksum([]byte(savedNAT))
+
+	for _, test := range []struct {
+		name    string
+		old     string
+		new     string
+		drifted bool
+	}{
+		{"same rules", "", "", false},
+		{"other counters", ":PREROUTING ACCEPT [10:600]", ":PREROUTING ACCEPT [42:4200]", false},
+		{"other timestamp", "Completed on Mon Jan  3 10:00:00", "Completed on Mon Jan  3 11:00:00", false},
+		{"foreign rule changed", "-A PREROUTING -j CNI-HOSTPORT-DNAT\n", "", false},
+		{"foreign chain added", ":CNI-HOSTPORT-DNAT - [0:0]\n", ":CNI-HOSTPORT-DNAT - [0:0]\n:CNI-OTHER - [0:0]\n", false},
+		{"jump removed", "-A PREROUTING -m comment --comment \"kubernetes service portals\" -j KUBE-SERVICES\n", "", true},
+		{"service rule removed", "-A KUBE-SVC-ABCDEF -j KUBE-SEP-123456\n", "", true},
+		{"endpoint rule changed", "10.1.0.2:8080", "10.1.0.3:8080", true},
+		{"chain flushed", "-A KUBE-SEP-123456 -p tcp -m tcp -j DNAT --to-destination 10.1.0.2:8080\n", "", true},
+		{"chain deleted", ":KUBE-SEP-123456 - [0:0]\n", "", true},
+	} {
+		save := strings.Replace(savedNAT, test.old, test.new, 1)
+		if test.old != "" && save == savedNAT {
+			t.Fatalf("%s: %q not found in the test rules", test.name, test.old)
+		}
+
+		if drifted := rulesChecksum([]byte(save)) != expected; drifted != test.drifted {
+			t.Errorf("%s: expected drifted=%v, got %v", test.name, test.drifted, drifted)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/kpng/backends/iptables/ipset"
+	"sigs.k8s.io/kpng/backends/iptables/util"
+)
+
+var (
+	// dryRunOutput receives the rules computed in --dry-run mode.
+	dryRunOutput io.Writer = os.Stdout
+	// dryRunLock keeps the rules of the IP families, synced in parallel, from interleaving.
+	dryRunLock sync.Mutex
+)
+
+// dryRunInterface is the util.Interface used in --dry-run mode: it leaves the tables untouched and prints the
+// iptables-restore input of each sync instead. The existing rules are read as empty, so every sync prints the
+// full rule set as it would be written on a node without any.
+type dryRunInterface struct {
+	util.Interface
+}
+
+var _ util.Interface = dryRunInterface{}
+
+func (i dryRunInterface) EnsureChain(table util.Table, chain util.Chain) (bool, error) {
+	return true, nil
+}
+
+func (i dryRunInterface) FlushChain(table util.Table, chain util.Chain) error {
+	return nil
+}
+
+func (i dryRunInterface) DeleteChain(table util.Table, chain util.Chain) error {
+	return nil
+}
+
+func (i dryRunInterface) EnsureRule(position util.RulePosition, table util.Table, chain util.Chain, args ...string) (bool, error) {
+	return true, nil
+}
+
+func (i dryRunInterface) DeleteRule(table util.Table, chain util.Chain, args ...string) error {
+	return nil
+}
+
+func (i dryRunInterface) SaveInto(table util.Table, buffer *bytes.Buffer) error {
+	return nil
+}
+
+func (i dryRunInterface) Restore(table util.Table, data []byte, flush util.FlushFlag, counters util.RestoreCountersFlag) error {
+	return i.print(data)
+}
+
+func (i dryRunInterface) RestoreAll(data []byte, flush util.FlushFlag, counters util.RestoreCountersFlag) error {
+	return i.print(data)
+}
+
+func (i dryRunInterface) Monitor(canary util.Chain, tables []util.Table, reloadFunc func(), interval time.Duration, stopCh <-chan struct{}) {
+}
+
+func (i dryRunInterface) print(data []byte) error {
+	dryRunLock.Lock()
+	defer dryRunLock.Unlock()
+
+	if _, err := fmt.Fprintf(dryRunOutput, "# %s rules (dry run, not applied)\n", i.Protocol()); err != nil {
+		return err
+	}
+	_, err := dryRunOutput.Write(data)
+	return err
+}
+
+// dryRunIPSet is the ipset.Interface used in --dry-run mode: it prints the ipset restore input of each sync instead
+// of applying it.
+type dryRunIPSet struct {
+	protocol util.Protocol
+}
+
+var _ ipset.Interface = dryRunIPSet{}
+
+func (i dryRunIPSet) Restore(data []byte) error {
+	dryRunLock.Lock()
+	defer dryRunLock.Unlock()
+
+	if _, err := fmt.Fprintf(dryRunOutput, "# %s ipsets (dry run, not applied)\n", i.protocol); err != nil {
+		return err
+	}
+	_, err := dryRunOutput.Write(data)
+	return err
+}
+
+func (i dryRunIPSet) ListSets() ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/kpng/backends/iptables/util"
+)
+
+func TestDryRunPrintsTheRules(t *testing.T) {
+	out := &bytes.Buffer{}
+	defer func(w io.Writer) { dryRunOutput = w }(dryRunOutput)
+	dryRunOutput = out
+
+	ipt := NewIptables()
+	// any call reaching the embedded interface, but the IP family ones, panics
+	ipt.iptInterface = dryRunInterface{ipFamilyOnly{protocol: util.ProtocolIPv4}}
+
+	ipt.ensureTopLevelChains()
+	if chains := ipt.getExistingChains(util.TableNAT, ipt.iptablesData); len(chains) != 0 {
+		t.Errorf("expected no existing chain, got %v", chains)
+	}
+
+	ipt.resetAllChains()
+	ipt.filterChains.Write("*filter")
+	ipt.natChains.Write("*nat")
+	ipt.writePostRoutingMasqRules()
+
+	if err := ipt.applyAllRules(); err != nil {
+		t.Fatal(err)
+	}
+
+	printed := out.String()
+	if !strings.HasPrefix(printed, "# IPv4 rules") {
+		t.Errorf("expected the rules to start with the IP family, got:\n%s", printed)
+	}
+	for _, expected := range []string{"*filter", "*nat", "-A " + string(kubePostroutingChain), "COMMIT"} {
+		if !strings.Contains(printed, expected) {
+			t.Errorf("expected %q in the printed rules:\n%s", expected, printed)
+		}
+	}
+}
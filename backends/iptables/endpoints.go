@@ -17,6 +17,8 @@ limitations under the License.
 package iptables
 
 import (
+	"net"
+	"strconv"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
@@ -102,6 +104,22 @@ func (ect *EndpointChangeTracker) EndpointUpdate(namespace, serviceName, key str
 	ect.endpointsCache.updatePending(namespacedName, key, endpoint)
 }
 
+// PendingChanges returns the names of the services having endpoint changes not yet applied.
+func (ect *EndpointChangeTracker) PendingChanges() sets.String {
+	pending := sets.NewString()
+	for svcName := range ect.endpointsCache.trackerByServiceMap {
+		pending.Insert(svcName.String())
+	}
+	return pending
+}
+
+// endpointsChange contains the endpoints of a service before (previous) and after (current) applying
+// the changes accumulated since the last sync.
+type endpointsChange struct {
+	previous endpointsInfoByName
+	current  endpointsInfoByName
+}
+
 // checkoutTriggerTimes applies the locally cached trigger times to a map of
 // trigger times that have been passed in and empties the local cache.
 func (ect *EndpointChangeTracker) checkoutTriggerTimes(lastChangeTriggerTimes *map[types.NamespacedName][]time.Time) {
@@ -151,13 +169,13 @@ type UpdateEndpointMapResult struct {
 	LastChangeTriggerTimes map[types.NamespacedName][]time.Time
 }
 
-// Update updates endpointsMap base on the given changes.
-func (em EndpointsMap) Update(changes *EndpointChangeTracker) (result UpdateEndpointMapResult) {
+// Update updates endpointsMap base on the given changes. The services are used to detect stale UDP connections.
+func (em EndpointsMap) Update(changes *EndpointChangeTracker, services ServicesSnapshot) (result UpdateEndpointMapResult) {
 	result.StaleEndpoints = make([]ServiceEndpoint, 0)
 	result.StaleServiceNames = make([]ServicePortName, 0)
 	result.LastChangeTriggerTimes = make(map[types.NamespacedName][]time.Time)
 	em.apply(
-		changes, &result.StaleEndpoints, &result.StaleServiceNames, &result.LastChangeTriggerTimes)
+		changes, services, &result.StaleEndpoints, &result.StaleServiceNames, &result.LastChangeTriggerTimes)
 	// TODO: If this will appear to be computationally expensive, consider
 	// computing this incrementally similarly to endpointsMap.
 	result.HCEndpointsLocalIPSize = make(map[types.NamespacedName]int)
@@ -174,16 +192,20 @@ func (em EndpointsMap) Update(changes *EndpointChangeTracker) (result UpdateEndp
 // The changes map is cleared after applying them.
 // In addition it returns (via argument) and resets the lastChangeTriggerTimes for all endpoints
 // that were changed and will result in syncing the proxy rules.
-// apply triggers processEndpointsMapChange on every change.
-func (em EndpointsMap) apply(ect *EndpointChangeTracker, staleEndpoints *[]ServiceEndpoint,
+func (em EndpointsMap) apply(ect *EndpointChangeTracker, services ServicesSnapshot, staleEndpoints *[]ServiceEndpoint,
 	staleServiceNames *[]ServicePortName, lastChangeTriggerTimes *map[types.NamespacedName][]time.Time) {
 	if ect == nil {
 		return
 	}
-	em.merge(ect.endpointsCache.trackerByServiceMap)
-	// TODO: CHECK detect stale later
-	// detectStaleConnections(change.previous, change.current, staleEndpoints, staleServiceNames)
-	// }
+
+	for svcName, pending := range ect.endpointsCache.trackerByServiceMap {
+		change := &endpointsChange{previous: em[svcName].clone()}
+		em.merge(EndpointsMap{svcName: pending})
+		change.current = em[svcName].clone()
+
+		change.detectStaleConnections(svcName, services[svcName], ect.ipFamily, staleEndpoints, staleServiceNames)
+	}
+
 	ect.checkoutTriggerTimes(lastChangeTriggerTimes)
 }
 
@@ -192,8 +214,9 @@ func (em EndpointsMap) merge(other EndpointsMap) {
 	for service, endpoints := range other {
 		for hash, endpointEntry := range *(endpoints) {
 			if endpointEntry == nil {
-				//TODO : if servicemap contains UDP port , then save the namespace, name ,protocol and epip
-				//  in cache as stale
+				if em[service] == nil {
+					continue
+				}
 				delete(*(em[service]), hash)
 				if len(*em[service]) <= 0 {
 					delete(em, service)
@@ -238,37 +261,58 @@ func (em EndpointsMap) getLocalReadyEndpointIPs() map[types.NamespacedName]sets.
 	return localIPs
 }
 
-// TODO:detectStaleConnections modifies <staleEndpoints> and <staleServices> with detected stale connections. <staleServiceNames>
-// is used to store stale udp service in order to clear udp conntrack later.
-// func detectStaleConnections(oldEndpointsMap, newEndpointsMap EndpointsMap, staleEndpoints *[]ServiceEndpoint, staleServiceNames *[]ServicePortName) {
-// 	for service, endpoint := range oldEndpointsMap {
-// 		if service.Protocol != v1.ProtocolUDP {
-// 			continue
-// 		}
-
-// 		for _, ep := range endpoint {
-// 			stale := true
-// 			for i := range newEndpointsMap[service] {
-// 				if newEndpointsMap[service][i].Equal(ep) {
-// 					stale = false
-// 					break
-// 				}
-// 			}
-// 			if stale {
-// 				klog.V(4).Infof("Stale endpoint %v -> %v", service, ep.String())
-// 				*staleEndpoints = append(*staleEndpoints, ServiceEndpoint{Endpoint: ep.String(), ServicePortName: service})
-// 			}
-// 		}
-// 	}
-
-// 	for service, endpoint := range newEndpointsMap {
-// 		if service.Protocol != v1.ProtocolUDP {
-// 			continue
-// 		}
-
-// 		// For udp service, if its backend changes from 0 to non-0. There may exist a conntrack entry that could blackhole traffic to the service.
-// 		if len(endpoint) > 0 && len(oldEndpointsMap[service]) == 0 {
-// 			*staleServiceNames = append(*staleServiceNames, service)
-// 		}
-// 	}
-// }
+// detectStaleConnections adds the UDP <service port, endpoint> pairs removed by the change to <staleEndpoints>, and the UDP
+// service ports going from no endpoint to some endpoints to <staleServiceNames>, so their conntrack entries can be cleared.
+func (change *endpointsChange) detectStaleConnections(svcName types.NamespacedName, svcPorts serviceChange, ipFamily v1.IPFamily,
+	staleEndpoints *[]ServiceEndpoint, staleServiceNames *[]ServicePortName) {
+	for svcPortName, svcPort := range svcPorts {
+		svcInfo, ok := svcPort.(*serviceInfo)
+		if !ok || svcInfo.Protocol() != localnetv1.Protocol_UDP {
+			continue
+		}
+
+		portMapping := &localnetv1.PortMapping{
+			Name:           svcInfo.PortName(),
+			Protocol:       svcInfo.Protocol(),
+			TargetPort:     int32(svcInfo.TargetPort()),
+			TargetPortName: svcInfo.TargetPortName(),
+		}
+
+		for key, ep := range change.previous {
+			prevEndpoint := endpointString(ep, ipFamily, portMapping)
+			if prevEndpoint == "" {
+				continue
+			}
+
+			if current, ok := change.current[key]; ok && endpointString(current, ipFamily, portMapping) == prevEndpoint {
+				continue
+			}
+
+			klog.V(4).Infof("Stale endpoint %v -> %v", svcPortName, prevEndpoint)
+			*staleEndpoints = append(*staleEndpoints, ServiceEndpoint{Endpoint: prevEndpoint, ServicePortName: svcPortName})
+		}
+
+		// For udp service, if its backend changes from 0 to non-0. There may exist a conntrack entry that could blackhole traffic to the service.
+		if len(change.previous) == 0 && len(change.current) != 0 {
+			*staleServiceNames = append(*staleServiceNames, svcPortName)
+		}
+	}
+}
+
+// endpointString returns the `IP:port` of the endpoint for the given family and service port, or "" if it has none.
+func endpointString(ep *localnetv1.Endpoint, ipFamily v1.IPFamily, port *localnetv1.PortMapping) string {
+	ips := ep.IPs.GetV4()
+	if ipFamily == v1.IPv6Protocol {
+		ips = ep.IPs.GetV6()
+	}
+	if len(ips) == 0 {
+		return ""
+	}
+
+	targetPort := ep.PortMapping(port)
+	if targetPort == 0 {
+		return ""
+	}
+
+	return net.JoinHostPort(ips[0], strconv.Itoa(int(targetPort)))
+}
@@ -17,6 +17,10 @@ limitations under the License.
 */
 
 import (
+	"bytes"
+	"net"
+	"sort"
+
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/events"
@@ -41,6 +45,66 @@ type EndpointsCache struct {
 // corresponding Endpoint.
 type endpointsInfoByName map[string]*localnetv1.Endpoint
 
+// clone returns a shallow copy of the endpoints (nil if there's none).
+func (eps *endpointsInfoByName) clone() endpointsInfoByName {
+	if eps == nil {
+		return nil
+	}
+
+	c := make(endpointsInfoByName, len(*eps))
+	for name, ep := range *eps {
+		c[name] = ep
+	}
+	return c
+}
+
+// sortedEndpoint is an endpoint with its IP in a family.
+type sortedEndpoint struct {
+	ip       string
+	endpoint *localnetv1.Endpoint
+}
+
+// sorted returns the endpoints having an IP of the given family, sorted by IP (then by name), so the same set of
+// endpoints produces the same rules whatever the order it was received in (ie: after a slice rebalancing).
+func (eps *endpointsInfoByName) sorted(ipv6 bool) []sortedEndpoint {
+	if eps == nil {
+		return nil
+	}
+
+	type entry struct {
+		sortedEndpoint
+		name  string
+		ipKey []byte
+	}
+
+	entries := make([]entry, 0, len(*eps))
+	for name, ep := range *eps {
+		ips := ep.GetIPs().GetV4()
+		if ipv6 {
+			ips = ep.GetIPs().GetV6()
+		}
+		if len(ips) == 0 {
+			continue
+		}
+
+		ipKey := []byte(net.ParseIP(ips[0]).To16())
+		entries = append(entries, entry{sortedEndpoint{ips[0], ep}, name, ipKey})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if c := bytes.Compare(entries[i].ipKey, entries[j].ipKey); c != 0 {
+			return c < 0
+		}
+		return entries[i].name < entries[j].name
+	})
+
+	sorted := make([]sortedEndpoint, len(entries))
+	for i, e := range entries {
+		sorted[i] = e.sortedEndpoint
+	}
+	return sorted
+}
+
 // NewEndpointsCache initializes an EndpointCache.
 func NewEndpointsCache(hostname string, ipFamily v1.IPFamily, recorder events.EventRecorder) *EndpointsCache {
 	return &EndpointsCache{
@@ -0,0 +1,220 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/kpng/backends/iptables/util"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+)
+
+func TestEndpointsMapUpdateStaleness(t *testing.T) {
+	svcChanges := NewServiceChangeTracker(newServiceInfo, v1.IPv4Protocol, nil)
+	epChanges := NewEndpointChangeTracker("node-1", v1.IPv4Protocol, nil)
+
+	services := ServicesSnapshot{}
+	endpoints := EndpointsMap{}
+
+	svcChanges.Update(&localnetv1.Service{
+		Namespace: "kube-system",
+		Name:      "dns",
+		IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.0.0.10"), ExternalIPs: &localnetv1.IPSet{}},
+		Ports: []*localnetv1.PortMapping{
+			{Name: "dns", Protocol: localnetv1.Protocol_UDP, Port: 53, TargetPort: 5353},
+			{Name: "dns-tcp", Protocol: localnetv1.Protocol_TCP, Port: 53, TargetPort: 5353},
+		},
+	})
+	services.Update(svcChanges)
+
+	// first endpoint: the service goes from 0 to 1 endpoint
+	epChanges.EndpointUpdate("kube-system", "dns", "ep1", &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.1.0.1")})
+
+	if pending := epChanges.PendingChanges(); !pending.Has("kube-system/dns") {
+		t.Errorf("expected pending changes for kube-system/dns, got %v", pending.List())
+	}
+
+	result := endpoints.Update(epChanges, services)
+
+	if len(result.StaleServiceNames) != 1 || result.StaleServiceNames[0].Port != "dns" {
+		t.Errorf("expected the dns UDP port to be stale, got %v", result.StaleServiceNames)
+	}
+	if len(result.StaleEndpoints) != 0 {
+		t.Errorf("expected no stale endpoint, got %v", result.StaleEndpoints)
+	}
+	if pending := epChanges.PendingChanges(); pending.Len() != 0 {
+		t.Errorf("expected no pending changes after update, got %v", pending.List())
+	}
+
+	// endpoint replaced: the previous one is stale
+	epChanges.EndpointUpdate("kube-system", "dns", "ep1", nil)
+	epChanges.EndpointUpdate("kube-system", "dns", "ep2", &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.1.0.2")})
+
+	result = endpoints.Update(epChanges, services)
+
+	if len(result.StaleServiceNames) != 0 {
+		t.Errorf("expected no stale service, got %v", result.StaleServiceNames)
+	}
+	if len(result.StaleEndpoints) != 1 || result.StaleEndpoints[0].Endpoint != "10.1.0.1:5353" {
+		t.Errorf("expected 10.1.0.1:5353 to be stale, got %v", result.StaleEndpoints)
+	}
+}
+
+func TestEndpointRulesOrder(t *testing.T) {
+	svcName := types.NamespacedName{Namespace: "default", Name: "web"}
+	port := &localnetv1.PortMapping{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 8080}
+	svc := &localnetv1.Service{
+		Namespace: "default",
+		Name:      "web",
+		IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.0.0.1"), ExternalIPs: &localnetv1.IPSet{}},
+	}
+
+	svcChanges := NewServiceChangeTracker(newServiceInfo, v1.IPv4Protocol, nil)
+	svcInfo := newServiceInfo(port, svc, svcChanges.newBaseServiceInfo(port, svc)).(*serviceInfo)
+
+	// the same endpoints, in other slices (so under other names)
+	endpointSets := []endpointsInfoByName{
+		{
+			"slice-a/ep1": &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.1.0.10")},
+			"slice-a/ep2": &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.1.0.9")},
+			"slice-b/ep3": &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.1.0.100")},
+		},
+		{
+			"slice-c/ep3": &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.1.0.100")},
+			"slice-c/ep1": &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.1.0.10")},
+			"slice-d/ep2": &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.1.0.9")},
+		},
+	}
+
+	rules := make([]string, 0, len(endpointSets))
+	for _, endpoints := range endpointSets {
+		for i := 0; i < 5; i++ { // maps are iterated in random order
+			ipt := NewIptables()
+			ipt.iptInterface = ipFamilyOnly{protocol: util.ProtocolIPv4}
+
+			eps, chains, _, portMap := ipt.createEndpointsChain(svcInfo, &endpoints, map[util.Chain][]byte{}, map[util.Chain]bool{})
+			args := make([]string, 0, 64)
+			ipt.writeEndpointRules(svcInfo, svcName, chains, eps, &args, portMap)
+
+			rules = append(rules, string(ipt.natChains.Bytes())+string(ipt.natRules.Bytes()))
+		}
+	}
+
+	for i, r := range rules[1:] {
+		if r != rules[0] {
+			t.Fatalf("rules %d differ from the first ones:\n%s\nvs:\n%s", i+1, r, rules[0])
+		}
+	}
+
+	dnats := make([]string, 0)
+	for _, rule := range strings.Split(rules[0], "\n") {
+		if i := strings.Index(rule, "--to-destination "); i != -1 {
+			dnats = append(dnats, rule[i+len("--to-destination "):])
+		}
+	}
+	if s := strings.Join(dnats, ","); s != "10.1.0.9:8080,10.1.0.10:8080,10.1.0.100:8080" {
+		t.Errorf("expected the endpoints sorted by IP, got %s", s)
+	}
+}
+
+func TestNoUsableEndpointsRejected(t *testing.T) {
+	svcName := types.NamespacedName{Namespace: "default", Name: "web"}
+	port := &localnetv1.PortMapping{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 8080}
+	svc := &localnetv1.Service{
+		Namespace: "default",
+		Name:      "web",
+		IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.0.0.1"), ExternalIPs: &localnetv1.IPSet{}},
+	}
+
+	svcChanges := NewServiceChangeTracker(newServiceInfo, v1.IPv4Protocol, nil)
+	svcInfo := newServiceInfo(port, svc, svcChanges.newBaseServiceInfo(port, svc)).(*serviceInfo)
+
+	// endpoints exist, but none of them is usable by the IPv4 rules
+	endpoints := endpointsInfoByName{
+		"slice-a/ep1": &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("fd00::1")},
+	}
+
+	ipt := NewIptables()
+	ipt.iptInterface = ipFamilyOnly{protocol: util.ProtocolIPv4}
+
+	activeNATChains := map[util.Chain]bool{}
+	eps, _, _, _ := ipt.createServiceSpecificChains(svcInfo, activeNATChains, map[util.Chain][]byte{}, &endpoints)
+	if len(eps) != 0 {
+		t.Fatalf("expected no usable endpoint, got %d", len(eps))
+	}
+	if activeNATChains[svcInfo.servicePortChainName] {
+		t.Errorf("expected no service chain without usable endpoints")
+	}
+
+	ipt.writeClusterIPRules(svcInfo, svcName, len(eps) > 0, make([]string, 0, 64))
+
+	filterRules := string(ipt.filterRules.Bytes())
+	if !strings.Contains(filterRules, "-d 10.0.0.1 --dport 80 -j REJECT") {
+		t.Errorf("expected the cluster IP to be rejected, got filter rules:\n%s", filterRules)
+	}
+	if natRules := string(ipt.natRules.Bytes()); strings.Contains(natRules, string(svcInfo.servicePortChainName)) {
+		t.Errorf("expected no jump to the service chain, got nat rules:\n%s", natRules)
+	}
+}
+
+func TestDeleteStaleChainsDefersEndpointChains(t *testing.T) {
+	existing := map[util.Chain][]byte{
+		"KUBE-SEP-GONE":     []byte(":KUBE-SEP-GONE - [0:0]"),
+		"KUBE-SEP-BACK":     []byte(":KUBE-SEP-BACK - [0:0]"),
+		"KUBE-SVC-GONE":     []byte(":KUBE-SVC-GONE - [0:0]"),
+		"OTHER-AGENT-CHAIN": []byte(":OTHER-AGENT-CHAIN - [0:0]"),
+	}
+
+	ipt := NewIptables()
+	deferred := ipt.deleteStaleChains(existing, map[util.Chain]bool{})
+
+	natRules := string(ipt.natRules.Bytes())
+	if !strings.Contains(natRules, "-X KUBE-SVC-GONE") {
+		t.Errorf("expected the stale service chain to be deleted, got nat rules:\n%s", natRules)
+	}
+	if strings.Contains(natRules, "KUBE-SEP-") || strings.Contains(string(ipt.natChains.Bytes()), "KUBE-SEP-") {
+		t.Errorf("expected the stale endpoint chains to be left in place, got:\n%s%s", ipt.natChains.Bytes(), natRules)
+	}
+	if strings.Contains(natRules, "OTHER-AGENT-CHAIN") {
+		t.Errorf("expected chains of other agents to be ignored, got nat rules:\n%s", natRules)
+	}
+	if len(deferred) != 2 || !deferred["KUBE-SEP-GONE"] || !deferred["KUBE-SEP-BACK"] {
+		t.Fatalf("expected both endpoint chains to be deferred, got %v", deferred)
+	}
+
+	// the next sync deletes the chains still stale, and forgets the ones in use again
+	ipt.deferredSEPChains = deferred
+	ipt.resetAllChains()
+	delete(existing, "KUBE-SVC-GONE")
+	deferred = ipt.deleteStaleChains(existing, map[util.Chain]bool{"KUBE-SEP-BACK": true})
+
+	natRules = string(ipt.natRules.Bytes())
+	if !strings.Contains(natRules, "-X KUBE-SEP-GONE") {
+		t.Errorf("expected the deferred endpoint chain to be deleted, got nat rules:\n%s", natRules)
+	}
+	if strings.Contains(natRules, "KUBE-SEP-BACK") {
+		t.Errorf("expected the endpoint chain in use to be kept, got nat rules:\n%s", natRules)
+	}
+	if len(deferred) != 0 {
+		t.Errorf("expected no deferred chain, got %v", deferred)
+	}
+}
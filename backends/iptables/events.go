@@ -0,0 +1,62 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/events"
+)
+
+// newEventRecorder returns a recorder sending events to the API server. An empty kubeconfig
+// uses the in-cluster configuration.
+func newEventRecorder(kubeconfig string) (events.EventRecorder, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	broadcaster := events.NewEventBroadcasterAdapter(client)
+	broadcaster.StartRecordingToSink(wait.NeverStop)
+
+	return broadcaster.NewRecorder("kpng-iptables"), nil
+}
+
+// nodeRef is the object the backend's events are attributed to.
+func nodeRef() *v1.ObjectReference {
+	return &v1.ObjectReference{
+		Kind: "Node",
+		Name: hostname,
+		UID:  types.UID(hostname),
+	}
+}
+
+// emitNodeWarning records a warning event on the node, if events are enabled.
+func emitNodeWarning(recorder events.EventRecorder, reason, action, note string, args ...interface{}) {
+	if recorder == nil {
+		return
+	}
+	recorder.Eventf(nodeRef(), nil, v1.EventTypeWarning, reason, action, note, args...)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+
+	"sigs.k8s.io/kpng/backends/iptables/portopener"
+)
+
+// External IPs assigned to the node: their ports are held open (see --external-ip-open-ports) so no other process
+// binds them, and a port already bound by another process is a conflict, reported and resolved with
+// --external-ip-conflicts: the service takes the traffic anyway, or it's delivered to the local process.
+
+const (
+	// externalIPConflictService DNATs the traffic of the conflicting external IP port to the service.
+	externalIPConflictService = "service"
+	// externalIPConflictLocal delivers the traffic of the conflicting external IP port to the local process.
+	externalIPConflictLocal = "local"
+)
+
+var (
+	externalIPOpenPorts bool
+	externalIPConflicts string
+)
+
+func validateExternalIPConflicts(policy string) error {
+	switch policy {
+	case externalIPConflictService, externalIPConflictLocal:
+		return nil
+	default:
+		return fmt.Errorf("invalid --external-ip-conflicts %q (expected %q or %q)", policy, externalIPConflictService, externalIPConflictLocal)
+	}
+}
+
+// isAddrInUse returns true if the error is a failure to bind a port already bound by another process.
+func isAddrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
+}
+
+// claimExternalIP holds the port of an external IP open if it's assigned to the node (or only checks that no other
+// process holds it, without --external-ip-open-ports). Returns true if the port is held by another process, and its
+// traffic should be delivered to it.
+func (t *iptables) claimExternalIP(svcInfo *serviceInfo, externalIP string, localAddrSet utilnet.IPSet, localPorts *portopener.Sync) (deliverLocally bool) {
+	protocol := svcInfo.Protocol().String()
+	if v1.Protocol(protocol) == v1.ProtocolSCTP || !localAddrSet.Has(net.ParseIP(externalIP)) {
+		return false
+	}
+
+	ipFamily := utilnet.IPv4
+	if t.iptInterface.IsIPv6() {
+		ipFamily = utilnet.IPv6
+	}
+
+	description := "externalIP for " + svcInfo.serviceNameString
+	lp := utilnet.LocalPort{
+		Description: description,
+		IP:          externalIP,
+		IPFamily:    ipFamily,
+		Port:        svcInfo.Port(),
+		Protocol:    utilnet.Protocol(protocol),
+	}
+
+	var err error
+	if externalIPOpenPorts {
+		err = localPorts.Claim(lp, description)
+	} else {
+		err = localPorts.Probe(lp)
+	}
+
+	if err == nil {
+		return false
+	}
+
+	if !isAddrInUse(err) {
+		emitNodeWarning(t.recorder, "PortOpenFailed", "SyncProxyRules", "can't open port %s, skipping it: %v", lp.String(), err)
+		klog.ErrorS(err, "can't open port, skipping it", "port", lp.String())
+		return false
+	}
+
+	t.externalIPConflicts++
+	deliverLocally = externalIPConflicts == externalIPConflictLocal
+
+	action := "its traffic is sent to the service"
+	if deliverLocally {
+		action = "its traffic is left to the local process"
+	}
+
+	klog.ErrorS(err, "External IP port held by another process on the node", "port", lp.String(), "service", svcInfo.serviceNameString, "deliverLocally", deliverLocally)
+	emitNodeWarning(t.recorder, "ExternalIPConflict", "SyncProxyRules", "port %s is held by another process on the node, %s", lp.String(), action)
+
+	return deliverLocally
+}
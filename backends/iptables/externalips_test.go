@@ -0,0 +1,107 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilnet "k8s.io/utils/net"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/backends/iptables/portopener"
+	"sigs.k8s.io/kpng/backends/iptables/util"
+)
+
+func TestExternalIPConflicts(t *testing.T) {
+	svcName := types.NamespacedName{Namespace: "default", Name: "web"}
+	svc := &localnetv1.Service{
+		Namespace: "default",
+		Name:      "web",
+		IPs: &localnetv1.ServiceIPs{
+			ClusterIPs:  localnetv1.NewIPSet("10.0.0.1"),
+			ExternalIPs: localnetv1.NewIPSet("192.168.1.10", "203.0.113.10"),
+		},
+	}
+	port := &localnetv1.PortMapping{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 8080}
+
+	svcChanges := NewServiceChangeTracker(newServiceInfo, v1.IPv4Protocol, nil)
+	svcInfo := newServiceInfo(port, svc, svcChanges.newBaseServiceInfo(port, svc)).(*serviceInfo)
+
+	// 192.168.1.10 is assigned to the node, and another process holds its port 80
+	localAddrSet := utilnet.IPSet{}
+	localAddrSet.Insert(utilnet.ParseIPSloppy("192.168.1.10"))
+
+	opened := 0
+	opener := portopener.OpenerFunc(func(lp *utilnet.LocalPort) (utilnet.Closeable, error) {
+		if lp.IP != "192.168.1.10" {
+			t.Errorf("only the local external IP should be opened, got %s", lp)
+		}
+		opened++
+		return nil, &os.SyscallError{Syscall: "bind", Err: syscall.EADDRINUSE}
+	})
+
+	defer func() {
+		externalIPOpenPorts, externalIPConflicts = false, ""
+	}()
+
+	for _, test := range []struct {
+		openPorts     bool
+		policy        string
+		expectDNAT    bool
+		expectReturns bool
+	}{
+		{true, externalIPConflictService, true, false},
+		{false, externalIPConflictService, true, false},
+		{true, externalIPConflictLocal, false, true},
+	} {
+		if err := validateExternalIPConflicts(test.policy); err != nil {
+			t.Fatal(err)
+		}
+		externalIPOpenPorts, externalIPConflicts = test.openPorts, test.policy
+
+		ipt := NewIptables()
+		ipt.iptInterface = ipFamilyOnly{protocol: util.ProtocolIPv4}
+		ipt.localPorts = portopener.New(opener)
+
+		opened = 0
+		ipt.writeExternalIPRules(svcInfo, svcName, true, make([]string, 0, 64), localAddrSet, ipt.localPorts.Sync())
+
+		if opened != 1 || ipt.externalIPConflicts != 1 {
+			t.Errorf("%+v: expected the conflict to be detected once, got %d opens and %d conflicts", test, opened, ipt.externalIPConflicts)
+		}
+
+		rules := string(ipt.natRules.Bytes())
+		localDNAT := strings.Contains(rules, "-d 192.168.1.10/32 --dport 80 -j "+string(svcInfo.servicePortChainName))
+		localReturn := strings.Contains(rules, "-d 192.168.1.10/32 --dport 80 -j RETURN")
+
+		if localDNAT != test.expectDNAT || localReturn != test.expectReturns {
+			t.Errorf("%+v: expected DNAT %v and RETURN %v for the local external IP, got rules:\n%s", test, test.expectDNAT, test.expectReturns, rules)
+		}
+		if !strings.Contains(rules, "-d 203.0.113.10/32 --dport 80 -j "+string(svcInfo.servicePortChainName)) {
+			t.Errorf("%+v: the other external IP should be sent to the service, got rules:\n%s", test, rules)
+		}
+	}
+
+	if err := validateExternalIPConflicts("process"); err == nil {
+		t.Error("invalid conflict policy should be rejected")
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
+
 	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
 
 	v1 "k8s.io/api/core/v1"
@@ -87,18 +89,6 @@ func WriteRuleLine(buf *bytes.Buffer, chainName string, words ...string) {
 	WriteLine(buf, words...)
 }
 
-// RevertPorts is closing ports in replacementPortsMap but not in originalPortsMap. In other words, it only
-// closes the ports opened in this sync.
-func RevertPorts(replacementPortsMap, originalPortsMap map[utilnet.LocalPort]utilnet.Closeable) {
-	for k, v := range replacementPortsMap {
-		// Only close newly opened local ports - leave ones that were open before this update
-		if originalPortsMap[k] == nil {
-			klog.V(2).Infof("Closing local port %s", k.String())
-			v.Close()
-		}
-	}
-}
-
 // GetLocalAddrs returns a list of all network addresses on the local system
 func GetLocalAddrs() ([]net.IP, error) {
 	var localAddrs []net.IP
@@ -221,14 +211,15 @@ func GetNodeAddresses(cidrs []string, nw NetworkInterfacer) (sets.String, error)
 
 // GetClusterIPByFamily returns a service clusterip by family
 func GetClusterIPByFamily(ipFamily v1.IPFamily, service *localnetv1.Service) string {
+	clusterIPs := service.GetIPs().GetClusterIPs()
 	if ipFamily == v1.IPv4Protocol {
-		if len(service.IPs.ClusterIPs.V4) > 0 {
-			return service.IPs.ClusterIPs.V4[0]
+		if v4 := clusterIPs.GetV4(); len(v4) > 0 {
+			return v4[0]
 		}
 	}
 	if ipFamily == v1.IPv6Protocol {
-		if len(service.IPs.ClusterIPs.V6) > 0 {
-			return service.IPs.ClusterIPs.V6[0]
+		if v6 := clusterIPs.GetV6(); len(v6) > 0 {
+			return v6[0]
 		}
 	}
 	return ""
@@ -243,14 +234,40 @@ func RequestsOnlyLocalTraffic(service *localnetv1.Service) bool {
 	return service.ExternalTrafficToLocal
 }
 
-// MapIPsByIPFamily maps a slice of IPs to their respective IP families (v4 or v6)
+// NeedsHealthCheck checks if service needs health check.
+func NeedsHealthCheck(service *localnetv1.Service) bool {
+	if service.Type != string(v1.ServiceTypeLoadBalancer) {
+		return false
+	}
+	return RequestsOnlyLocalTraffic(service)
+}
+
+// MapIPsByIPFamily maps a slice of IPs to their respective IP families (v4 or v6). Families without IPs (ie: v4 in
+// IPv6-only clusters) have no entry, and a nil set maps to no family.
 func MapIPsByIPFamily(ips *localnetv1.IPSet) map[v1.IPFamily][]string {
 	ipFamilyMap := map[v1.IPFamily][]string{}
-	ipFamilyMap[v1.IPv4Protocol] = append(ipFamilyMap[v1.IPv4Protocol], ips.V4...)
-	ipFamilyMap[v1.IPv6Protocol] = append(ipFamilyMap[v1.IPv6Protocol], ips.V6...)
+	if v4 := ips.GetV4(); len(v4) != 0 {
+		ipFamilyMap[v1.IPv4Protocol] = append([]string(nil), v4...)
+	}
+	if v6 := ips.GetV6(); len(v6) != 0 {
+		ipFamilyMap[v1.IPv6Protocol] = append([]string(nil), v6...)
+	}
 	return ipFamilyMap
 }
 
+// FilterNodeAddressesByFamily returns the node addresses (and zero CIDR) of the IP family.
+func FilterNodeAddressesByFamily(nodeAddresses sets.String, isIPv6 bool) sets.String {
+	filtered := sets.NewString()
+	for address := range nodeAddresses {
+		// the addresses are IPs, or zero CIDRs
+		ip := strings.SplitN(address, "/", 2)[0]
+		if utilnet.IsIPv6String(ip) == isIPv6 {
+			filtered.Insert(address)
+		}
+	}
+	return filtered
+}
+
 func getIPFamilyFromIP(ipStr string) (v1.IPFamily, error) {
 	netIP := net.ParseIP(ipStr)
 	if netIP == nil {
@@ -0,0 +1,228 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/backends/iptables/util"
+)
+
+// Guardrails: the packets traverse the rules of a chain one by one, and iptables-restore rejects the lines longer
+// than its input buffer or with too many arguments. Before the rules are applied, the chains with more than
+// --max-chain-rules rules are split in KUBE-SPLIT-* continuation chains, each one jumped to by the last rule of the
+// previous one so the rules are still evaluated in the same order, and the lines over the iptables-restore limits are
+// reported with the service that wrote them (iptables-restore fails on them, quarantining the service).
+
+const (
+	// maxRestoreLineLength is the size of the iptables-restore input buffer, including the newline.
+	maxRestoreLineLength = 10240
+	// maxRestoreArgs is the max number of arguments of an iptables-restore line, including the program name.
+	maxRestoreArgs = 255
+
+	// minMaxChainRules is the lowest --max-chain-rules, so the chains with a few rules (ie: the KUBE-SEP chains,
+	// whose deletion may be deferred along with their continuations) are never split.
+	minMaxChainRules = 100
+
+	splitChainPrefix = "KUBE-SPLIT-"
+
+	limitLineLength = "line-length"
+	limitArgs       = "arguments"
+)
+
+var maxChainRules int
+
+func validateMaxChainRules(max int) error {
+	if max != 0 && max < minMaxChainRules {
+		return fmt.Errorf("--max-chain-rules must be 0 (disabled) or at least %d (got %d)", minMaxChainRules, max)
+	}
+	return nil
+}
+
+// splitChainName returns the name of the n-th continuation chain of a chain of the table.
+func splitChainName(table util.Table, chain string, n int) util.Chain {
+	hash := sha256.Sum256([]byte(string(table) + "/" + chain + "/" + strconv.Itoa(n)))
+	encoded := base32.StdEncoding.EncodeToString(hash[:])
+	return util.Chain(splitChainPrefix + encoded[:16])
+}
+
+// lineViolation is a line of the restore data over an iptables-restore limit.
+type lineViolation struct {
+	// line is the number of the line in its buffer, starting at 1.
+	line  int
+	limit string
+	value int
+}
+
+// splitChains splits the chains of the rules with more than max rules (if max isn't 0), returning the continuation
+// chains written. The rules keep their line numbers (see serviceLines); the continuation chains and the jumps to them
+// are appended to the chains and rules. The stale continuation chains among the existing ones are deleted.
+//
+// It also returns the rules over the iptables-restore limits.
+func splitChains(table util.Table, chains, rules *util.LineBuffer, existing map[util.Chain][]byte, max int) (split []util.Chain, violations []lineViolation) {
+	data := rules.Bytes()
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte{'\n'}), []byte{'\n'})
+
+	counts := map[string]int{}
+	for i, line := range lines {
+		if len(line)+1 > maxRestoreLineLength {
+			violations = append(violations, lineViolation{line: i + 1, limit: limitLineLength, value: len(line) + 1})
+		} else if args := len(bytes.Fields(line)) + 1; args > maxRestoreArgs {
+			violations = append(violations, lineViolation{line: i + 1, limit: limitArgs, value: args})
+		}
+
+		if chain, ok := appendedChain(line); ok {
+			counts[chain]++
+		}
+	}
+
+	// each chain keeps max-1 rules and the jump to its continuation, the last one keeps the rest
+	segments := map[string]int{}
+	if max != 0 {
+		for chain, count := range counts {
+			if count > max {
+				segments[chain] = (count + max - 2) / (max - 1)
+			}
+		}
+	}
+
+	active := map[util.Chain]bool{}
+
+	if len(segments) != 0 {
+		data = append([]byte(nil), data...) // the buffer is reused by the rewrite
+		lines = bytes.Split(bytes.TrimSuffix(data, []byte{'\n'}), []byte{'\n'})
+
+		rules.Reset()
+
+		index := map[string]int{}
+		for _, line := range lines {
+			chain, ok := appendedChain(line)
+			if !ok || segments[chain] == 0 {
+				rules.WriteBytes(line)
+				continue
+			}
+
+			segment := index[chain] / (max - 1)
+			index[chain]++
+
+			if segment == 0 {
+				rules.WriteBytes(line)
+				continue
+			}
+
+			rest := line[len("-A ")+len(chain):]
+			rules.Write("-A", string(splitChainName(table, chain, segment))+string(rest))
+		}
+
+		names := make([]string, 0, len(segments))
+		for chain := range segments {
+			names = append(names, chain)
+		}
+		sort.Strings(names)
+
+		for _, chain := range names {
+			previous := util.Chain(chain)
+			for segment := 1; segment < segments[chain]; segment++ {
+				next := splitChainName(table, chain, segment)
+
+				if existingChain, ok := existing[next]; ok {
+					chains.WriteBytes(existingChain)
+				} else {
+					chains.Write(util.MakeChainLine(next))
+				}
+				rules.Write("-A", string(previous), "-j", string(next))
+
+				active[next] = true
+				split = append(split, next)
+				previous = next
+			}
+		}
+	}
+
+	for chain := range existing {
+		if !strings.HasPrefix(string(chain), splitChainPrefix) || active[chain] {
+			continue
+		}
+		// flushed by its chain line, then deleted
+		chains.WriteBytes(existing[chain])
+		rules.Write("-X", string(chain))
+	}
+
+	return
+}
+
+// appendedChain returns the chain of a "-A <chain> ..." line.
+func appendedChain(line []byte) (chain string, ok bool) {
+	if !bytes.HasPrefix(line, []byte("-A ")) {
+		return "", false
+	}
+
+	rest := line[len("-A "):]
+	if idx := bytes.IndexByte(rest, ' '); idx != -1 {
+		rest = rest[:idx]
+	}
+	return string(rest), true
+}
+
+// enforceGuardrails splits the chains over --max-chain-rules and reports the lines over the iptables-restore limits,
+// before the rules are applied.
+func (t *iptables) enforceGuardrails(existingFilterChains, existingNATChains map[util.Chain][]byte) {
+	family := string(t.iptInterface.Protocol())
+
+	for _, table := range []struct {
+		name           util.Table
+		buffer         int // see lineBuffers
+		chains, rules  *util.LineBuffer
+		existingChains map[util.Chain][]byte
+	}{
+		{util.TableFilter, 1, &t.filterChains, &t.filterRules, existingFilterChains},
+		{util.TableNAT, 3, &t.natChains, &t.natRules, existingNATChains},
+	} {
+		split, violations := splitChains(table.name, table.chains, table.rules, table.existingChains, maxChainRules)
+
+		IptablesSplitChains.WithLabelValues(family, string(table.name)).Set(float64(len(split)))
+		if len(split) != t.splitCounts[table.name] {
+			// reported when it changes, not on every sync
+			if len(split) != 0 {
+				klog.InfoS("Split the chains over the max number of rules", "ipFamily", family, "table", table.name, "continuationChains", len(split), "maxChainRules", maxChainRules)
+				emitNodeWarning(t.recorder, "IPTablesChainSplit", "SyncProxyRules", "%s %s chains over %d rules split in %d continuation chains", family, table.name, maxChainRules, len(split))
+			}
+			t.splitCounts[table.name] = len(split)
+		}
+
+		for _, v := range violations {
+			service, found := t.serviceLines.serviceIn(table.buffer, v.line)
+
+			klog.ErrorS(nil, "Rule over the iptables-restore limits, it will fail to apply", "ipFamily", family, "table", table.name, "limit", v.limit, "value", v.value, "service", service, "serviceFound", found)
+			IptablesGuardrailViolationsTotal.WithLabelValues(family, v.limit).Inc()
+
+			if found {
+				emitNodeWarning(t.recorder, "IPTablesRestoreLimit", "SyncProxyRules", "a %s rule of service %s exceeds the iptables-restore %s limit (%d)", table.name, service, v.limit, v.value)
+			} else {
+				emitNodeWarning(t.recorder, "IPTablesRestoreLimit", "SyncProxyRules", "a %s rule exceeds the iptables-restore %s limit (%d)", table.name, v.limit, v.value)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/kpng/backends/iptables/util"
+)
+
+func TestSplitChains(t *testing.T) {
+	chains, rules := &util.LineBuffer{}, &util.LineBuffer{}
+
+	chains.Write("*nat")
+	chains.Write(util.MakeChainLine(kubeServicesChain))
+	for i := 0; i < 5; i++ {
+		rules.Write("-A", string(kubeServicesChain), "-d", fmt.Sprintf("10.0.0.%d/32", i), "-j", "KUBE-SVC-"+fmt.Sprint(i))
+	}
+	rules.Write("-A", string(kubeNodePortsChain), "-j", "ACCEPT")
+	rules.Write("-A", string(kubeServicesChain), "-j", string(kubeNodePortsChain))
+
+	stale := splitChainName(util.TableNAT, "KUBE-OLD", 1)
+	existing := map[util.Chain][]byte{
+		stale:             []byte(util.MakeChainLine(stale)),
+		kubeServicesChain: []byte(util.MakeChainLine(kubeServicesChain)),
+	}
+
+	lines := rules.Lines()
+	split, violations := splitChains(util.TableNAT, chains, rules, existing, 3)
+
+	first, second := splitChainName(util.TableNAT, string(kubeServicesChain), 1), splitChainName(util.TableNAT, string(kubeServicesChain), 2)
+	if len(split) != 2 || split[0] != first || split[1] != second {
+		t.Fatalf("expected KUBE-SERVICES to be split in 2 continuation chains, got %v", split)
+	}
+	if len(violations) != 0 {
+		t.Errorf("expected no violation, got %v", violations)
+	}
+
+	expectedRules := strings.Join([]string{
+		// the rules keep their lines
+		"-A KUBE-SERVICES -d 10.0.0.0/32 -j KUBE-SVC-0",
+		"-A KUBE-SERVICES -d 10.0.0.1/32 -j KUBE-SVC-1",
+		"-A " + string(first) + " -d 10.0.0.2/32 -j KUBE-SVC-2",
+		"-A " + string(first) + " -d 10.0.0.3/32 -j KUBE-SVC-3",
+		"-A " + string(second) + " -d 10.0.0.4/32 -j KUBE-SVC-4",
+		"-A KUBE-NODEPORTS -j ACCEPT",
+		"-A " + string(second) + " -j KUBE-NODEPORTS",
+		// the jumps are the last rules of their chains
+		"-A KUBE-SERVICES -j " + string(first),
+		"-A " + string(first) + " -j " + string(second),
+		"-X " + string(stale),
+	}, "\n") + "\n"
+
+	if got := string(rules.Bytes()); got != expectedRules {
+		t.Errorf("expected rules:\n%s\ngot:\n%s", expectedRules, got)
+	}
+	if rules.Lines() != lines+3 {
+		t.Errorf("expected 3 lines appended to the rules, got %d", rules.Lines()-lines)
+	}
+
+	expectedChains := strings.Join([]string{
+		"*nat",
+		util.MakeChainLine(kubeServicesChain),
+		util.MakeChainLine(first),
+		util.MakeChainLine(second),
+		util.MakeChainLine(stale),
+	}, "\n") + "\n"
+
+	if got := string(chains.Bytes()); got != expectedChains {
+		t.Errorf("expected chains:\n%s\ngot:\n%s", expectedChains, got)
+	}
+}
+
+func TestSplitChainsDisabled(t *testing.T) {
+	chains, rules := &util.LineBuffer{}, &util.LineBuffer{}
+
+	for i := 0; i < 5; i++ {
+		rules.Write("-A", string(kubeServicesChain), "-j", "KUBE-SVC-"+fmt.Sprint(i))
+	}
+	rules.Write("-A", string(kubeServicesChain), "-m", "comment", "--comment", strings.Repeat("x", maxRestoreLineLength))
+	rules.Write("-A", string(kubeServicesChain), strings.Repeat("-s 10.0.0.1 ", maxRestoreArgs/2))
+
+	before := string(rules.Bytes())
+	split, violations := splitChains(util.TableFilter, chains, rules, nil, 0)
+
+	if len(split) != 0 || string(rules.Bytes()) != before || chains.Lines() != 0 {
+		t.Errorf("expected the rules to be left as is, got %v:\n%s", split, rules.Bytes())
+	}
+
+	if len(violations) != 2 || violations[0].line != 6 || violations[0].limit != limitLineLength ||
+		violations[1].line != 7 || violations[1].limit != limitArgs {
+		t.Errorf("expected the lines 6 and 7 to be over the line length and arguments limits, got %+v", violations)
+	}
+}
+
+func TestValidateMaxChainRules(t *testing.T) {
+	for max, valid := range map[int]bool{0: true, 1: false, minMaxChainRules - 1: false, minMaxChainRules: true, 10000: true} {
+		if err := validateMaxChainRules(max); (err == nil) != valid {
+			t.Errorf("%d: expected valid=%v, got %v", max, valid, err)
+		}
+	}
+}
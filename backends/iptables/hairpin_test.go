@@ -0,0 +1,75 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/backends/iptables/util"
+)
+
+func TestHairpinMasquerade(t *testing.T) {
+	svc := &localnetv1.Service{
+		Namespace: "default",
+		Name:      "web",
+		IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.0.0.1"), ExternalIPs: &localnetv1.IPSet{}},
+	}
+	port := &localnetv1.PortMapping{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 8080}
+
+	svcChanges := NewServiceChangeTracker(newServiceInfo, v1.IPv4Protocol, nil)
+	svcInfo := newServiceInfo(port, svc, svcChanges.newBaseServiceInfo(port, svc)).(*serviceInfo)
+
+	epIP := "10.1.0.1"
+	chains := []util.Chain{"KUBE-SEP-TEST"}
+
+	for _, test := range []struct {
+		mode       string
+		expectMasq bool
+	}{
+		{hairpinMasquerade, true},
+		{hairpinNone, false},
+	} {
+		if err := validateHairpinMode(test.mode); err != nil {
+			t.Fatal(err)
+		}
+
+		hairpinMode = test.mode
+		ipt := NewIptables()
+
+		ipt.writeDNATRules(svcInfo, types.NamespacedName{Namespace: "default", Name: "web"},
+			[]*string{&epIP}, &chains, make([]string, 0, 64), nil)
+
+		rules := string(ipt.natRules.Bytes())
+		if hasMasq := strings.Contains(rules, "-s 10.1.0.1/32 -j "+string(KubeMarkMasqChain)); hasMasq != test.expectMasq {
+			t.Errorf("mode %q: expected hairpin masquerade %v, got rules:\n%s", test.mode, test.expectMasq, rules)
+		}
+		if !strings.Contains(rules, "--to-destination 10.1.0.1:8080") {
+			t.Errorf("mode %q: missing DNAT rule:\n%s", test.mode, rules)
+		}
+	}
+
+	hairpinMode = ""
+
+	if err := validateHairpinMode("bridge"); err == nil {
+		t.Error("invalid hairpin mode should be rejected")
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ipset manages the ipsets of a backend, to match large lists of IPs, CIDRs or ports with one rule.
+//
+// The members of each set are diffed with the ones programmed by the previous sync, so only the changes are applied.
+// A set whose programmed members are unknown (first sync, failed sync) or changing more than it keeps is rebuilt: the
+// new version is filled in a temporary set, swapped with the live one, then destroyed, so the rules matching the set
+// never see it partially filled. All the changes of a sync are applied with one ipset restore.
+package ipset
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	utilexec "k8s.io/utils/exec"
+)
+
+// Type is the type of a set.
+type Type string
+
+const (
+	HashIP        Type = "hash:ip"
+	HashNet       Type = "hash:net"
+	HashIPPort    Type = "hash:ip,port"
+	HashIPPortIP  Type = "hash:ip,port,ip"
+	HashIPPortNet Type = "hash:ip,port,net"
+	BitmapPort    Type = "bitmap:port"
+)
+
+// Family is the IP family of a hash set.
+type Family string
+
+const (
+	FamilyIPv4 Family = "inet"
+	FamilyIPv6 Family = "inet6"
+)
+
+// MaxNameLength is the maximum length of a set name.
+const MaxNameLength = 31
+
+// Set describes a set. Its type and family can't change while it's programmed (the live set can only be swapped with
+// a set of the same type), another name must be used.
+type Set struct {
+	Name string
+	Type Type
+	// Family is the IP family of the hash sets.
+	Family Family
+	// Range is the port range of the bitmap sets, ie: "0-65535".
+	Range string
+	// HashSize and MaxElem are the sizes of the hash sets, ipset's defaults if 0.
+	HashSize int
+	MaxElem  int
+}
+
+// createLine returns the ipset restore line creating the set with the given name.
+func (s Set) createLine(name string) string {
+	b := &strings.Builder{}
+	b.WriteString("create " + name + " " + string(s.Type))
+
+	if strings.HasPrefix(string(s.Type), "hash:") {
+		if s.Family != "" {
+			b.WriteString(" family " + string(s.Family))
+		}
+		if s.HashSize != 0 {
+			b.WriteString(" hashsize " + strconv.Itoa(s.HashSize))
+		}
+		if s.MaxElem != 0 {
+			b.WriteString(" maxelem " + strconv.Itoa(s.MaxElem))
+		}
+	} else if s.Range != "" {
+		b.WriteString(" range " + s.Range)
+	}
+
+	return b.String()
+}
+
+// versionName returns the name of the temporary set holding a new version of the set.
+func versionName(name string, version int) string {
+	suffix := "-v" + strconv.Itoa(version)
+	if len(name)+len(suffix) > MaxNameLength {
+		name = name[:MaxNameLength-len(suffix)]
+	}
+	return name + suffix
+}
+
+// Interface runs the ipset commands.
+type Interface interface {
+	// Restore applies the ipset restore input (ignoring the errors of existing sets and entries).
+	Restore(data []byte) error
+	// ListSets returns the names of the sets of the node.
+	ListSets() ([]string, error)
+}
+
+const ipsetCmd = "ipset"
+
+type runner struct {
+	exec utilexec.Interface
+}
+
+// New returns the Interface running the ipset command.
+func New(exec utilexec.Interface) Interface {
+	return runner{exec: exec}
+}
+
+func (r runner) Restore(data []byte) error {
+	cmd := r.exec.Command(ipsetCmd, "restore", "-exist")
+	cmd.SetStdin(bytes.NewReader(data))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ipset restore failed: %v (%s)", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func (r runner) ListSets() ([]string, error) {
+	out, err := r.exec.Command(ipsetCmd, "list", "-n").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ipset list failed: %v (%s)", err, bytes.TrimSpace(out))
+	}
+	return strings.Fields(string(out)), nil
+}
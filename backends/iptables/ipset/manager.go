@@ -0,0 +1,243 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipset
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// Manager keeps the members of the sets of a backend, and applies their changes with Sync.
+type Manager struct {
+	mu     sync.Mutex
+	ipset  Interface
+	prefix string
+	sets   map[string]*managedSet
+	buf    bytes.Buffer
+}
+
+type managedSet struct {
+	Set
+	desired sets.String
+	// programmed are the members applied by the last sync, nil if unknown (the set is rebuilt by the next sync)
+	programmed sets.String
+	// version is the version of the set's last rebuild
+	version int
+}
+
+// NewManager returns a Manager of the sets whose names start with prefix: the ones it doesn't manage anymore are
+// destroyed by DestroyStale.
+func NewManager(ipset Interface, prefix string) *Manager {
+	return &Manager{
+		ipset:  ipset,
+		prefix: prefix,
+		sets:   map[string]*managedSet{},
+	}
+}
+
+// Ensure declares a set, created by the next sync if needed.
+func (m *Manager) Ensure(set Set) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ensure(set)
+}
+
+func (m *Manager) ensure(set Set) *managedSet {
+	s, ok := m.sets[set.Name]
+	if !ok {
+		s = &managedSet{desired: sets.NewString()}
+		m.sets[set.Name] = s
+	} else if s.Set != set {
+		// the set must be created again with its new parameters
+		s.programmed = nil
+	}
+	s.Set = set
+	return s
+}
+
+// Add adds an entry to a set declared with Ensure.
+func (m *Manager) Add(name, entry string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sets[name]; ok {
+		s.desired.Insert(entry)
+	} else {
+		klog.Warning("ignoring the entry ", entry, " of the unknown ipset ", name)
+	}
+}
+
+// Del removes an entry from a set.
+func (m *Manager) Del(name, entry string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sets[name]; ok {
+		s.desired.Delete(entry)
+	}
+}
+
+// Clear removes all the entries of a set.
+func (m *Manager) Clear(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sets[name]; ok {
+		s.desired = sets.NewString()
+	}
+}
+
+// Replace declares a set with the given entries.
+func (m *Manager) Replace(set Set, entries []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ensure(set).desired = sets.NewString(entries...)
+}
+
+// Forget stops managing a set, destroyed by the next DestroyStale.
+func (m *Manager) Forget(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sets, name)
+}
+
+// Retain forgets the sets not in names.
+func (m *Manager) Retain(names sets.String) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name := range m.sets {
+		if !names.Has(name) {
+			delete(m.sets, name)
+		}
+	}
+}
+
+// Invalidate forgets the members applied by the previous syncs, so the next sync rebuilds all the sets.
+func (m *Manager) Invalidate() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.sets {
+		s.programmed = nil
+	}
+}
+
+// Has returns true if the set is managed.
+func (m *Manager) Has(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.sets[name]
+	return ok
+}
+
+// Sync applies the changes of the sets since the last sync. If it fails, the sets are rebuilt by the next sync.
+func (m *Manager) Sync() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.buf.Reset()
+	for _, name := range sets.StringKeySet(m.sets).List() {
+		m.writeSet(&m.buf, m.sets[name])
+	}
+
+	if m.buf.Len() == 0 {
+		return nil
+	}
+
+	if err := m.ipset.Restore(m.buf.Bytes()); err != nil {
+		// the restore stops at the first error, the members are unknown
+		for _, s := range m.sets {
+			s.programmed = nil
+		}
+		return err
+	}
+
+	for _, s := range m.sets {
+		s.programmed = sets.NewString(s.desired.UnsortedList()...)
+	}
+	return nil
+}
+
+// writeSet writes the ipset restore input applying the changes of the set.
+func (m *Manager) writeSet(buf *bytes.Buffer, s *managedSet) {
+	if s.programmed != nil {
+		added := s.desired.Difference(s.programmed)
+		deleted := s.programmed.Difference(s.desired)
+
+		if added.Len()+deleted.Len() <= s.desired.Len() {
+			for _, entry := range deleted.List() {
+				buf.WriteString("del " + s.Name + " " + entry + "\n")
+			}
+			for _, entry := range added.List() {
+				buf.WriteString("add " + s.Name + " " + entry + "\n")
+			}
+			return
+		}
+	}
+
+	// rebuild the set in its next version, then swap it with the live one
+	s.version++
+	tmp := versionName(s.Name, s.version)
+
+	buf.WriteString(s.createLine(s.Name) + "\n")
+	buf.WriteString(s.createLine(tmp) + "\n")
+	buf.WriteString("flush " + tmp + "\n")
+	for _, entry := range s.desired.List() {
+		buf.WriteString("add " + tmp + " " + entry + "\n")
+	}
+	buf.WriteString("swap " + tmp + " " + s.Name + "\n")
+	buf.WriteString("destroy " + tmp + "\n")
+}
+
+// DestroyStale destroys the sets with the Manager's prefix it doesn't manage. It must be called once the rules don't
+// match them anymore, since the sets referenced by rules can't be destroyed.
+func (m *Manager) DestroyStale() error {
+	names, err := m.ipset.ListSets()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []error
+	for _, name := range names {
+		if !strings.HasPrefix(name, m.prefix) {
+			continue
+		}
+		if _, ok := m.sets[name]; ok {
+			continue
+		}
+
+		klog.V(1).Info("destroying the stale ipset ", name)
+		if err := m.ipset.Restore([]byte("destroy " + name + "\n")); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipset
+
+import (
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+type fakeIPSet struct {
+	restored []string
+	sets     []string
+	err      error
+}
+
+func (f *fakeIPSet) Restore(data []byte) error {
+	f.restored = append(f.restored, string(data))
+	return f.err
+}
+
+func (f *fakeIPSet) ListSets() ([]string, error) {
+	return f.sets, nil
+}
+
+var sourceRanges = Set{Name: "KPNG-SRC-TEST", Type: HashNet, Family: FamilyIPv4}
+
+func (f *fakeIPSet) expect(t *testing.T, expected string) {
+	t.Helper()
+
+	if len(f.restored) != 1 {
+		t.Fatalf("expected 1 restore, got %q", f.restored)
+	}
+	if f.restored[0] != expected {
+		t.Errorf("unexpected restore input:\n%s\nexpected:\n%s", f.restored[0], expected)
+	}
+	f.restored = nil
+}
+
+func TestSyncDiff(t *testing.T) {
+	f := &fakeIPSet{}
+	m := NewManager(f, "KPNG-")
+
+	// the first sync rebuilds the set, its members are unknown
+	m.Replace(sourceRanges, []string{"10.0.0.0/8", "192.168.0.0/16"})
+	if err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	f.expect(t, `create KPNG-SRC-TEST hash:net family inet
+create KPNG-SRC-TEST-v1 hash:net family inet
+flush KPNG-SRC-TEST-v1
+add KPNG-SRC-TEST-v1 10.0.0.0/8
+add KPNG-SRC-TEST-v1 192.168.0.0/16
+swap KPNG-SRC-TEST-v1 KPNG-SRC-TEST
+destroy KPNG-SRC-TEST-v1
+`)
+
+	// then only the changes are applied
+	m.Del(sourceRanges.Name, "192.168.0.0/16")
+	m.Add(sourceRanges.Name, "172.16.0.0/12")
+	if err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	f.expect(t, `del KPNG-SRC-TEST 192.168.0.0/16
+add KPNG-SRC-TEST 172.16.0.0/12
+`)
+
+	// nothing to apply without changes
+	if err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.restored) != 0 {
+		t.Errorf("expected no restore, got %q", f.restored)
+	}
+}
+
+func TestSyncRebuild(t *testing.T) {
+	f := &fakeIPSet{}
+	m := NewManager(f, "KPNG-")
+
+	m.Replace(sourceRanges, []string{"10.0.0.0/8"})
+	if err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	f.restored = nil
+
+	// replacing most members rebuilds the set in its next version
+	m.Replace(sourceRanges, []string{"172.16.0.0/12", "192.168.0.0/16"})
+	if err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	f.expect(t, `create KPNG-SRC-TEST hash:net family inet
+create KPNG-SRC-TEST-v2 hash:net family inet
+flush KPNG-SRC-TEST-v2
+add KPNG-SRC-TEST-v2 172.16.0.0/12
+add KPNG-SRC-TEST-v2 192.168.0.0/16
+swap KPNG-SRC-TEST-v2 KPNG-SRC-TEST
+destroy KPNG-SRC-TEST-v2
+`)
+
+	// a failed sync leaves the members unknown, so the set is rebuilt
+	f.err = errors.New("ipset restore failed")
+	m.Add(sourceRanges.Name, "10.0.0.0/8")
+	if err := m.Sync(); err == nil {
+		t.Fatal("expected the sync to fail")
+	}
+	f.restored, f.err = nil, nil
+
+	if err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	f.expect(t, `create KPNG-SRC-TEST hash:net family inet
+create KPNG-SRC-TEST-v3 hash:net family inet
+flush KPNG-SRC-TEST-v3
+add KPNG-SRC-TEST-v3 10.0.0.0/8
+add KPNG-SRC-TEST-v3 172.16.0.0/12
+add KPNG-SRC-TEST-v3 192.168.0.0/16
+swap KPNG-SRC-TEST-v3 KPNG-SRC-TEST
+destroy KPNG-SRC-TEST-v3
+`)
+}
+
+func TestDestroyStale(t *testing.T) {
+	f := &fakeIPSet{sets: []string{"KPNG-SRC-A", "KPNG-SRC-B", "OTHER"}}
+	m := NewManager(f, "KPNG-")
+
+	m.Ensure(Set{Name: "KPNG-SRC-A", Type: HashNet})
+	m.Ensure(Set{Name: "KPNG-SRC-B", Type: HashNet})
+	m.Retain(sets.NewString("KPNG-SRC-A"))
+
+	if err := m.DestroyStale(); err != nil {
+		t.Fatal(err)
+	}
+	f.expect(t, "destroy KPNG-SRC-B\n")
+}
+
+func TestVersionName(t *testing.T) {
+	if name := versionName("KPNG-SRC-TEST", 12); name != "KPNG-SRC-TEST-v12" {
+		t.Errorf("unexpected version name %q", name)
+	}
+	// the name is truncated to fit the version
+	if name := versionName("KPNG-SRC-0123456789ABCDEF012345", 12); name != "KPNG-SRC-0123456789ABCDEF01-v12" {
+		t.Errorf("unexpected version name %q", name)
+	}
+}
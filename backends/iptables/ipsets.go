@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"net"
+
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/backends/iptables/ipset"
+)
+
+// sourceRangesIPSetMin is the number of loadBalancerSourceRanges from which a service's ranges are matched with an
+// ipset instead of one rule each, disabled if 0.
+var sourceRangesIPSetMin int
+
+const (
+	// the ipsets are shared by the IP families, their names are prefixed by the family
+	sourceRangesSetPrefix   = "KPNG-SRC-"
+	sourceRangesSetPrefixV6 = "KPNG6-SRC-"
+)
+
+// newIPSets returns the manager of the ipsets of an IP family.
+func newIPSets(ipsetInterface ipset.Interface, ipv6 bool) *ipset.Manager {
+	if ipv6 {
+		return ipset.NewManager(ipsetInterface, sourceRangesSetPrefixV6)
+	}
+	return ipset.NewManager(ipsetInterface, sourceRangesSetPrefix)
+}
+
+// sourceRangesSet returns the ipset matching the loadBalancerSourceRanges of the service port (the ranges of the
+// sync's IP family), or "" if the ranges are matched with one rule each.
+func (t *iptables) sourceRangesSet(svcInfo *serviceInfo, protocol string) string {
+	ranges := svcInfo.LoadBalancerSourceRanges()
+	if t.ipsets == nil || sourceRangesIPSetMin <= 0 || len(ranges) < sourceRangesIPSetMin {
+		return ""
+	}
+
+	ipv6 := t.iptInterface.IsIPv6()
+	set := ipset.Set{
+		Name:   sourceRangesSetPrefix + portProtoHash(svcInfo.serviceNameString, protocol),
+		Type:   ipset.HashNet,
+		Family: ipset.FamilyIPv4,
+	}
+	if ipv6 {
+		set.Name = sourceRangesSetPrefixV6 + portProtoHash(svcInfo.serviceNameString, protocol)
+		set.Family = ipset.FamilyIPv6
+	}
+
+	entries := make([]string, 0, len(ranges))
+	for _, src := range ranges {
+		_, cidr, err := net.ParseCIDR(src)
+		if err != nil || (cidr.IP.To4() == nil) != ipv6 {
+			continue
+		}
+		entries = append(entries, cidr.String())
+	}
+
+	t.ipsets.Replace(set, entries)
+	t.activeIPSets.Insert(set.Name)
+	return set.Name
+}
+
+// syncIPSets applies the ipsets of the sync, before the rules matching them.
+func (t *iptables) syncIPSets() {
+	if t.ipsets == nil {
+		return
+	}
+
+	t.ipsets.Retain(t.activeIPSets)
+	if err := t.ipsets.Sync(); err != nil {
+		// the rules matching the sets fail to be restored, their services are quarantined
+		klog.ErrorS(err, "Failed to sync the ipsets")
+	}
+
+	if dryRun {
+		// print the full sets at every sync, like the rules
+		t.ipsets.Invalidate()
+	}
+}
+
+// destroyStaleIPSets destroys the ipsets the rules don't match anymore.
+func (t *iptables) destroyStaleIPSets() {
+	if t.ipsets == nil {
+		return
+	}
+
+	if err := t.ipsets.DestroyStale(); err != nil {
+		klog.ErrorS(err, "Failed to destroy the stale ipsets")
+	}
+}
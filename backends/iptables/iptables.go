@@ -18,7 +18,7 @@ package iptables
 
 import (
 	"bytes"
-	"flag"
+	"context"
 	"fmt"
 	"net"
 	"strconv"
@@ -29,25 +29,139 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/events"
 	"k8s.io/klog/v2"
 	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/backends/iptables/ipset"
+	"sigs.k8s.io/kpng/backends/iptables/portopener"
 	"sigs.k8s.io/kpng/backends/iptables/util"
+	"sigs.k8s.io/kpng/client/featuregate"
+	"sigs.k8s.io/kpng/client/syncrunner"
+	"sigs.k8s.io/kpng/client/tracing"
 
 	utilnet "k8s.io/utils/net"
 )
 
 var (
-	onlyOutput    bool
-	masqueradeAll bool
+	dryRun           bool
+	masqueradeAll    bool
+	masqueradeBit    int
+	emitEvents       bool
+	eventsKubeconfig string
+	hairpinMode      string
+	ipFamilies       []string
+	nodeKubeconfig   string
+
+	nodePortAddresses []string
+
+	detectLocalMode        string
+	clusterCIDRs           []string
+	podBridgeInterface     string
+	podInterfaceNamePrefix string
+
+	watchAddresses       bool
+	addressesResyncDelay time.Duration
+
+	syncConfig        syncrunner.Config
+	serviceBackoffMax time.Duration
+	verifyPeriod      time.Duration
+)
+
+const (
+	// hairpinMasquerade SNATs the connections from endpoints to their own service, so the replies go back through the node.
+	hairpinMasquerade = "masquerade"
+	// hairpinNone leaves hairpin connections to the CNI (ie: bridge ports in hairpin mode).
+	hairpinNone = "none"
+
+	ipFamilyIPv4 = "ipv4"
+	ipFamilyIPv6 = "ipv6"
 )
 
 func BindFlags(flags *pflag.FlagSet) {
-	flag.BoolVar(&onlyOutput, "only-output", false, "Only output the ipvsadm-restore file instead of calling ipvsadm-restore")
-	flag.BoolVar(&masqueradeAll, "masquerade-all", false, "Set this flag to set the masq rule for all traffic")
+	flags.BoolVar(&dryRun, "dry-run", false, "Print the iptables-restore input of each sync instead of applying it, to review the full rule set")
+	flags.BoolVar(&dryRun, "only-output", false, "Deprecated alias of --dry-run")
+	flags.MarkDeprecated("only-output", "use --dry-run instead")
+	flags.BoolVar(&masqueradeAll, "masquerade-all", false, "SNAT all traffic sent via Service cluster IPs (this not commonly needed)")
+	flags.IntVar(&masqueradeBit, "iptables-masquerade-bit", 14, "The bit of the fwmark space to mark packets requiring SNAT with. Must be within the range [0, 31] and not collide with other agents using fwmarks")
+	flags.BoolVar(&emitEvents, "emit-events", false, "Emit Kubernetes events on the node for backend failures (iptables-restore errors, port conflicts, invalid services)")
+	flags.StringVar(&eventsKubeconfig, "events-kubeconfig", "", "kubeconfig used to emit events (in-cluster configuration if empty)")
+	flags.BoolVar(&watchAddresses, "watch-node-addresses", true, "Resync the rules when the node's addresses or links change (netlink events) instead of waiting for the next change set")
+	flags.DurationVar(&addressesResyncDelay, "node-addresses-resync-delay", time.Second, "Delay to batch node address changes before resyncing the rules")
+	syncConfig.BindFlags(flags)
+	flags.DurationVar(&verifyPeriod, "verify-period", time.Minute, "Interval to verify the rules against iptables-save, resyncing them if they were changed by another agent (disabled if 0)")
+	flags.DurationVar(&serviceBackoffMax, "service-backoff-max", 5*time.Minute, "Max time a service making iptables-restore fail is left out of the rules before being tried again (the backoff starts at --min-sync-period)")
+	flags.StringVar(&detectLocalMode, "detect-local-mode", detectLocalNone, "How to detect the traffic from the local pods, that isn't masqueraded: \""+detectLocalClusterCIDR+"\" (by source IP, in --cluster-cidr), \""+detectLocalBridgeInterface+"\" (by input interface, --pod-bridge-interface) or \""+detectLocalInterfaceNamePrefix+"\" (by input interface, named --pod-interface-name-prefix*). Not detected if empty")
+	flags.StringSliceVar(&clusterCIDRs, "cluster-cidr", nil, "CIDRs of the pods in the cluster (one per IP family), for --detect-local-mode="+detectLocalClusterCIDR)
+	flags.StringVar(&podBridgeInterface, "pod-bridge-interface", "", "Bridge the local pods are connected to, for --detect-local-mode="+detectLocalBridgeInterface)
+	flags.StringVar(&podInterfaceNamePrefix, "pod-interface-name-prefix", "", "Name prefix of the local pods' interfaces, for --detect-local-mode="+detectLocalInterfaceNamePrefix)
+	flags.StringSliceVar(&ipFamilies, "ip-families", []string{ipFamilyIPv4, ipFamilyIPv6}, "IP families to write the rules of: \""+ipFamilyIPv4+"\" (iptables) and/or \""+ipFamilyIPv6+"\" (ip6tables), ie: only \""+ipFamilyIPv6+"\" on IPv6-only nodes, or \""+ipFamilyAuto+"\" to detect the families of the node")
+	flags.StringVar(&nodeKubeconfig, "node-kubeconfig", "", "kubeconfig used to read the node with --ip-families="+ipFamilyAuto+" (in-cluster configuration if empty)")
+	flags.IntVar(&sourceRangesIPSetMin, "ipset-source-ranges-min", 0, "Match the loadBalancerSourceRanges of a service with an ipset instead of one rule per range when it has at least this many ranges (disabled if 0, requires the ipset command)")
+	flags.BoolVar(&externalIPOpenPorts, "external-ip-open-ports", true, "Hold the ports of the external IPs assigned to the node open, so no other process can bind them")
+	flags.StringVar(&externalIPConflicts, "external-ip-conflicts", externalIPConflictService, "What to do with the traffic of an external IP assigned to the node when its port is held by another process: \""+externalIPConflictService+"\" to send it to the service anyway, or \""+externalIPConflictLocal+"\" to leave it to the local process")
+	flags.IntVar(&maxChainRules, "max-chain-rules", 10000, fmt.Sprintf("Split the chains with more rules than this in continuation chains, evaluated in the same order (disabled if 0, at least %d otherwise)", minMaxChainRules))
+	flags.StringSliceVar(&nodePortAddresses, "nodeport-addresses", nil, "CIDRs of the node addresses the node ports are opened on (all the node addresses if empty)")
+	flags.StringVar(&hairpinMode, "hairpin-mode", hairpinMasquerade, "How to handle pods connecting to a service that resolves back to themselves: \""+hairpinMasquerade+"\" to SNAT them, or \""+hairpinNone+"\" if the CNI handles them")
+}
+
+func validateMasqueradeBit(bit int) error {
+	if bit < 0 || bit > 31 {
+		return fmt.Errorf("iptables-masquerade-bit must be within the range [0, 31], got %d", bit)
+	}
+	return nil
+}
+
+// parseIPFamilies returns the IP families of the --ip-families values.
+func parseIPFamilies(families []string) ([]v1.IPFamily, error) {
+	if len(families) == 0 {
+		return nil, fmt.Errorf("ip-families must have at least one IP family")
+	}
+	if len(families) == 1 && strings.ToLower(strings.TrimSpace(families[0])) == ipFamilyAuto {
+		// detected in Setup
+		return nil, nil
+	}
+
+	var parsed []v1.IPFamily
+	for _, family := range families {
+		var ipFamily v1.IPFamily
+		switch strings.ToLower(strings.TrimSpace(family)) {
+		case ipFamilyIPv4:
+			ipFamily = v1.IPv4Protocol
+		case ipFamilyIPv6:
+			ipFamily = v1.IPv6Protocol
+		default:
+			return nil, fmt.Errorf("ip-families must be %q or %q (or only %q), got %q", ipFamilyIPv4, ipFamilyIPv6, ipFamilyAuto, family)
+		}
+		for _, f := range parsed {
+			if f == ipFamily {
+				return nil, fmt.Errorf("ip-families has %q twice", family)
+			}
+		}
+		parsed = append(parsed, ipFamily)
+	}
+	return parsed, nil
+}
 
+func validateHairpinMode(mode string) error {
+	switch mode {
+	case hairpinMasquerade, hairpinNone:
+		return nil
+	}
+	return fmt.Errorf("hairpin-mode must be %q or %q, got %q", hairpinMasquerade, hairpinNone, mode)
+}
+
+func validateNodePortAddresses(cidrs []string) error {
+	for _, cidr := range cidrs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid nodeport-addresses %q: %w", cidr, err)
+		}
+	}
+	return nil
 }
 
 type iptables struct {
@@ -61,14 +175,50 @@ type iptables struct {
 	endpointSlicesSynced bool
 	servicesSynced       bool
 	initialized          int32
-	syncPeriod           time.Duration
 
 	// These are effectively const and do not need the mutex to be held.
-	masqueradeAll  bool
-	masqueradeMark string
+	masqueradeAll     bool
+	masqueradeMark    string
+	hairpinMasquerade bool
+	// strictNoMasquerade leaves the off-cluster traffic to the cluster IPs unmasqueraded (StrictNoMasquerade).
+	strictNoMasquerade bool
+
+	nodeIP   net.IP
+	recorder events.EventRecorder
+
+	// applied is true if the last sync applied the rules successfully.
+	applied bool
+	// isolated is true if the last sync failed because of a service, now quarantined.
+	isolated bool
+
+	// quarantine holds the services failing iptables-restore, and serviceLines the lines written for each service.
+	quarantine   *syncrunner.Breaker
+	serviceLines serviceLines
+	// quarantineErrors are the iptables-restore errors of the quarantined services.
+	quarantineErrors map[string]string
+
+	// deferredSEPChains are the stale KUBE-SEP chains left in place by the last sync, deleted by the next one.
+	deferredSEPChains map[util.Chain]bool
+
+	// externalIPConflicts is the number of external IP ports held by other processes, found by the current sync.
+	externalIPConflicts int
+
+	// splitCounts are the numbers of continuation chains written by the last sync, by table (see guardrails.go).
+	splitCounts map[util.Table]int
 
-	nodeIP       net.IP
-	recorder     events.EventRecorder
+	// programmedObjects are the objects applied by the last successful sync, see Backend.ProgrammedObjects.
+	programmedObjects map[string]int
+
+	// ipsets are the ipsets matched by the rules (nil if disabled), and activeIPSets the ones of the current sync.
+	ipsets       *ipset.Manager
+	activeIPSets sets.String
+
+	// traceCtx is the context of the current sync, for its spans (see the tracing package).
+	traceCtx context.Context
+
+	// checksum is the checksum of the rules applied by the last sync, see verify.
+	checksum     string
+	verifyData   *bytes.Buffer
 	serviceMap   ServicesSnapshot
 	endpointsMap EndpointsMap
 
@@ -100,14 +250,13 @@ type iptables struct {
 	serviceChanges    *ServiceChangeTracker
 	endpointsChanges  *EndpointChangeTracker
 	localDetector     LocalTrafficDetector
-	portsMap          map[utilnet.LocalPort]utilnet.Closeable
+	localPorts        *portopener.Manager
 	iptInterface      util.Interface
 }
 
-var portMapper = &utilnet.ListenPortOpener
+var portMapper utilnet.PortOpener = &utilnet.ListenPortOpener
 
 func NewIptables() *iptables {
-	masqueradeBit := 14 //TODO: should it be fetched as flag etc?
 	masqueradeValue := 1 << uint(masqueradeBit)
 
 	return &iptables{
@@ -115,14 +264,23 @@ func NewIptables() *iptables {
 		endpointsMap:             make(EndpointsMap),
 		iptablesData:             bytes.NewBuffer(nil),
 		existingFilterChainsData: bytes.NewBuffer(nil),
+		verifyData:               bytes.NewBuffer(nil),
 		filterChains:             util.LineBuffer{},
 		filterRules:              util.LineBuffer{},
 		natChains:                util.LineBuffer{},
 		natRules:                 util.LineBuffer{},
-		portsMap:                 make(map[utilnet.LocalPort]utilnet.Closeable),
+		localPorts:               portopener.New(portMapper),
+		quarantine:               syncrunner.NewBreaker(syncConfig.Backoff().Min, serviceBackoffMax),
+		quarantineErrors:         map[string]string{},
+		splitCounts:              map[util.Table]int{},
 		masqueradeAll:            masqueradeAll,
 		masqueradeMark:           fmt.Sprintf("%#08x", masqueradeValue),
+		hairpinMasquerade:        hairpinMode != hairpinNone,
+		strictNoMasquerade:       featuregate.Enabled(featuregate.StrictNoMasquerade),
+		nodePortAddresses:        nodePortAddresses,
+		networkInterfacer:        RealNetwork{},
 		localDetector:            NewNoOpLocalDetector(),
+		traceCtx:                 context.Background(),
 	}
 }
 
@@ -133,18 +291,18 @@ func (t *iptables) sync() {
 	// We assume that if this was called, we really want to sync them,
 	// even if nothing changed in the meantime. In other words, callers are
 	// responsible for detecting no-op changes and not calling this function.
-	t.serviceMap.Update(t.serviceChanges)
-	endpointUpdateResult := t.endpointsMap.Update(t.endpointsChanges)
+	serviceUpdateResult := t.serviceMap.Update(t.serviceChanges)
+	endpointUpdateResult := t.endpointsMap.Update(t.endpointsChanges, t.serviceMap)
 
-	klog.InfoS("Syncing iptables rules")
+	klog.V(2).InfoS("Detected stale UDP connections", "clusterIPs", serviceUpdateResult.UDPStaleClusterIP.Len(),
+		"endpoints", len(endpointUpdateResult.StaleEndpoints), "services", len(endpointUpdateResult.StaleServiceNames))
+
+	if len(serviceUpdateResult.Errors) != 0 {
+		klog.ErrorS(nil, "Some services or ports were left out of the rules", "count", len(serviceUpdateResult.Errors),
+			"first", serviceUpdateResult.Errors[0].Error())
+	}
 
-	// success := false
-	// defer func() {
-	// 	if !success {
-	// 		klog.InfoS("Sync failed", "retryingTime", proxier.syncPeriod)
-	// 		proxier.syncRunner.RetryAfter(proxier.syncPeriod)
-	// 	}
-	// }()
+	klog.InfoS("Syncing iptables rules")
 
 	t.ensureTopLevelChains()
 
@@ -173,9 +331,10 @@ func (t *iptables) sync() {
 
 	// Accumulate NAT chains to keep.
 	activeNATChains := map[util.Chain]bool{} // use a map as a set
+	t.activeIPSets = sets.NewString()
 
 	// Accumulate the set of local ports that we will be holding open once this update is complete
-	replacementPortsMap := map[utilnet.LocalPort]utilnet.Closeable{}
+	localPorts := t.localPorts.Sync()
 
 	// // To avoid growing this slice, we arbitrarily set its size to 64,
 	// // there is never more than that many arguments for a single line.
@@ -196,9 +355,20 @@ func (t *iptables) sync() {
 	if err != nil {
 		klog.ErrorS(err, "Failed to get node ip address matching nodeport cidrs, services with nodeport may not work as intended", "CIDRs", t.nodePortAddresses)
 	}
+	// the node ports are only held open and matched on the addresses of this IP family
+	nodeAddresses = FilterNodeAddressesByFamily(nodeAddresses, t.iptInterface.IsIPv6())
 
 	// Build rules for each service.
+	t.serviceLines.reset()
+	t.externalIPConflicts = 0
+	programmed := map[types.NamespacedName]bool{}
 	for svcName, svcPortMap := range t.serviceMap {
+		if !t.quarantine.Allow(svcName.String()) {
+			klog.V(2).InfoS("Skipping quarantined service", "service", svcName)
+			continue
+		}
+
+		from := t.lineMarks()
 		for _, svc := range svcPortMap {
 			svcInfo, ok := svc.(*serviceInfo)
 			if !ok {
@@ -213,16 +383,16 @@ func (t *iptables) sync() {
 			// Service does not have conflicting configuration such as
 			// externalTrafficPolicy=Local.
 			// allEndpoints = FilterEndpoints(allEndpoints, svcInfo, proxier.nodeLabels)
-			var hasEndpoints bool
-			if allEndpoints != nil {
-				hasEndpoints = len(*allEndpoints) > 0
-			}
 			endpoints, endpointChains, localEndpointChains, endpointPortMap := t.createServiceSpecificChains(svcInfo, activeNATChains, existingNATChains, allEndpoints)
 
-			t.writeClusterIPRules(svcInfo, svcName, args[:0])
-			t.writeExternalIPRules(svcInfo, svcName, args[:0], localAddrSet, replacementPortsMap)
-			t.writeLoadBalancerRules(svcInfo, svcName, args[:0])
-			t.writeNodePortsRules(svcInfo, nodeAddresses, svcName, localAddrSet, replacementPortsMap, args[:0])
+			// Only the endpoints of this family serving the port count: without any, the traffic is rejected
+			// instead of escaping to the default gateway.
+			hasEndpoints := len(endpoints) > 0
+
+			t.writeClusterIPRules(svcInfo, svcName, hasEndpoints, args[:0])
+			t.writeExternalIPRules(svcInfo, svcName, hasEndpoints, args[:0], localAddrSet, localPorts)
+			t.writeLoadBalancerRules(svcInfo, svcName, hasEndpoints, args[:0])
+			t.writeNodePortsRules(svcInfo, nodeAddresses, svcName, hasEndpoints, localAddrSet, localPorts, args[:0])
 
 			if !hasEndpoints {
 				continue
@@ -235,24 +405,40 @@ func (t *iptables) sync() {
 				t.writeLocalExtTrafficPolicyRules(svcInfo, svcName, localEndpointChains, args[:0])
 			}
 		}
+		t.serviceLines.add(svcName, from, t.lineMarks())
+		programmed[svcName] = true
 	}
 	// Delete chains no longer in use.
-	t.deleteStaleChains(existingNATChains, activeNATChains)
+	deferredSEPChains := t.deleteStaleChains(existingNATChains, activeNATChains)
 
 	// Finally, tail-call to the nodeports chain.  This needs to be after all
 	// other service portal rules.
 	t.writeNodePortJumpRule(nodeAddresses, args[:0])
 	t.writeMiscFilterRules()
+	t.syncIPSets()
+	t.enforceGuardrails(existingFilterChains, existingNATChains)
 	err = t.applyAllRules()
 	if err != nil {
 		klog.ErrorS(err, "Failed to execute iptables-restore")
 		IptablesRestoreFailuresTotal.Inc()
+		emitNodeWarning(t.recorder, "IPTablesRestoreFailed", "SyncProxyRules", "failed to execute iptables-restore: %v", err)
 		// Revert new local ports.
 		klog.V(2).InfoS("Closing local ports after iptables-restore failure")
-		RevertPorts(replacementPortsMap, t.portsMap)
+		localPorts.Abort()
+		t.applied = false
+		t.isolated = t.quarantineFailedService(err, t.lineMarks())
 		return
 	}
-	//	success = true
+	t.applied = true
+	t.isolated = false
+	t.deferredSEPChains = deferredSEPChains
+	t.programmedObjects = t.countObjects(len(programmed))
+	IptablesExternalIPConflicts.WithLabelValues(string(t.iptInterface.Protocol())).Set(float64(t.externalIPConflicts))
+	t.releaseQuarantine(programmed)
+
+	if verifyPeriod > 0 {
+		t.recordChecksum()
+	}
 
 	for name, lastChangeTriggerTimes := range endpointUpdateResult.LastChangeTriggerTimes {
 		for _, lastChangeTriggerTime := range lastChangeTriggerTimes {
@@ -263,18 +449,16 @@ func (t *iptables) sync() {
 	}
 
 	// Close old local ports and save new ones.
-	for k, v := range t.portsMap {
-		if replacementPortsMap[k] == nil {
-			v.Close()
-		}
-	}
-	t.portsMap = replacementPortsMap
+	localPorts.Commit()
+	t.destroyStaleIPSets()
 	t.cleanUp()
 }
 
 func (t *iptables) createServiceSpecificChains(svcInfo *serviceInfo, activeNATChains map[util.Chain]bool,
 	existingNATChains map[util.Chain][]byte, allEndpoints *endpointsInfoByName) ([]*string, *[]util.Chain, *[]util.Chain, map[string]int32) {
-	if allEndpoints != nil && len(*allEndpoints) > 0 {
+	endpoints, endpointChains, localEndpointChains, endpointPortMap := t.createEndpointsChain(svcInfo, allEndpoints, existingNATChains, activeNATChains)
+
+	if len(endpoints) > 0 {
 		// Create the per-service chain, retaining counters if possible.
 		t.copyExistingChains([]util.Chain{svcInfo.servicePortChainName}, existingNATChains, &t.natChains)
 		activeNATChains[svcInfo.servicePortChainName] = true
@@ -292,7 +476,7 @@ func (t *iptables) createServiceSpecificChains(svcInfo *serviceInfo, activeNATCh
 		t.copyExistingChains([]util.Chain{svcInfo.serviceFirewallChainName}, existingNATChains, &t.natChains)
 		activeNATChains[svcInfo.serviceFirewallChainName] = true
 	}
-	return t.createEndpointsChain(svcInfo, allEndpoints, existingNATChains, activeNATChains)
+	return endpoints, endpointChains, localEndpointChains, endpointPortMap
 }
 
 func (t *iptables) createTopLevelChains(existingFilterChains map[util.Chain][]byte, existingNATChains map[util.Chain][]byte) {
@@ -339,8 +523,11 @@ func (t *iptables) writePostRoutingMasqRules() {
 	)
 }
 
-func (t *iptables) deleteStaleChains(existingNATChains map[util.Chain][]byte, activeNATChains map[util.Chain]bool) {
-	// Delete chains no longer in use.
+// deleteStaleChains deletes the chains no longer in use, returning the KUBE-SEP chains whose deletion is deferred.
+// A removed endpoint isn't selected anymore, but its chain is left in place for one sync, so the packets already
+// sent to it while the rules are being replaced don't hit a missing chain.
+func (t *iptables) deleteStaleChains(existingNATChains map[util.Chain][]byte, activeNATChains map[util.Chain]bool) map[util.Chain]bool {
+	deferred := map[util.Chain]bool{}
 	for chain := range existingNATChains {
 		if !activeNATChains[chain] {
 			chainString := string(chain)
@@ -348,6 +535,13 @@ func (t *iptables) deleteStaleChains(existingNATChains map[util.Chain][]byte, ac
 				// Ignore chains that aren't ours.
 				continue
 			}
+			if strings.HasPrefix(chainString, "KUBE-SEP-") && !t.deferredSEPChains[chain] {
+				// Not writing the chain-line leaves the chain and its rules
+				// untouched, since the tables aren't flushed.
+				klog.V(4).InfoS("Deferring the deletion of a stale endpoint chain", "chain", chainString)
+				deferred[chain] = true
+				continue
+			}
 			// We must (as per iptables) write a chain-line for it, which has
 			// the nice effect of flushing the chain.  Then we can remove the
 			// chain.
@@ -355,7 +549,7 @@ func (t *iptables) deleteStaleChains(existingNATChains map[util.Chain][]byte, ac
 			t.natRules.Write("-X", chainString)
 		}
 	}
-
+	return deferred
 }
 
 func (t *iptables) copyExistingChains(chains []util.Chain, existingChainData map[util.Chain][]byte, newChainData *util.LineBuffer) {
@@ -370,20 +564,20 @@ func (t *iptables) copyExistingChains(chains []util.Chain, existingChainData map
 	}
 }
 
-//writeClusterIPRules writes rules to reach svc chain from kube-services
-func (t *iptables) writeClusterIPRules(svcInfo *serviceInfo, svcName types.NamespacedName, args []string) {
+// writeClusterIPRules writes rules to reach svc chain from kube-services
+func (t *iptables) writeClusterIPRules(svcInfo *serviceInfo, svcName types.NamespacedName, hasEndpoints bool, args []string) {
 	svcChain := svcInfo.servicePortChainName
 	protocol := strings.ToLower(svcInfo.Protocol().String())
-	if val, ok := t.endpointsMap[svcName]; ok && len(*val) > 0 {
+	if hasEndpoints {
 		args = append(args[:0],
 			"-m", "comment", "--comment", fmt.Sprintf(`"%s cluster IP"`, svcInfo.serviceNameString),
 			"-m", protocol, "-p", protocol,
 			"-d", ToCIDR(svcInfo.ClusterIP()),
-			"--dport", strconv.Itoa(svcInfo.Port()),
+			"--dport", svcInfo.dport(),
 		)
-		if t.masqueradeAll {
+		if t.masqueradeAll || svcInfo.ForceMasquerade() {
 			t.natRules.Write("-A", string(svcChain), args, "-j", string(KubeMarkMasqChain))
-		} else if t.localDetector.IsImplemented() { //TODO is this required?
+		} else if t.localDetector.IsImplemented() && !t.strictNoMasquerade {
 			// This masquerades off-cluster traffic to a service VIP.  The idea
 			// is that you can establish a static route for your Service range,
 			// routing to any node, and that node will bridge into the Service
@@ -399,15 +593,15 @@ func (t *iptables) writeClusterIPRules(svcInfo *serviceInfo, svcName types.Names
 			"-m", "comment", "--comment", fmt.Sprintf(`"%s has no endpoints"`, svcInfo.serviceNameString),
 			"-m", protocol, "-p", protocol,
 			"-d", svcInfo.ClusterIP().String(),
-			"--dport", strconv.Itoa(svcInfo.Port()),
+			"--dport", svcInfo.dport(),
 			"-j", "REJECT",
 		)
 	}
 }
 
-//writeExternalIPRules writes rules in kube-services to jump to xlb/svc chain
-func (t *iptables) writeExternalIPRules(svcInfo *serviceInfo, svcName types.NamespacedName, args []string,
-	localAddrSet utilnet.IPSet, replacementPortsMap map[utilnet.LocalPort]utilnet.Closeable) {
+// writeExternalIPRules writes rules in kube-services to jump to xlb/svc chain
+func (t *iptables) writeExternalIPRules(svcInfo *serviceInfo, svcName types.NamespacedName, hasEndpoints bool, args []string,
+	localAddrSet utilnet.IPSet, localPorts *portopener.Sync) {
 	svcChain := svcInfo.servicePortChainName
 	svcXlbChain := svcInfo.serviceLBChainName
 	protocol := strings.ToLower(svcInfo.Protocol().String())
@@ -415,19 +609,26 @@ func (t *iptables) writeExternalIPRules(svcInfo *serviceInfo, svcName types.Name
 		// If the "external" IP happens to be an IP that is local to this
 		// machine, hold the local port open so no other process can open it
 		// (because the socket might open but it would never work).
-		ipFamily := utilnet.IPv4
-		if t.iptInterface.IsIPv6() {
-			ipFamily = utilnet.IPv6
+		// (the port ranges are not held open)
+		if svcInfo.EndPort() == 0 && t.claimExternalIP(svcInfo, externalIP, localAddrSet, localPorts) {
+			// Another process holds the port: leave its traffic to it.
+			t.natRules.Write(
+				"-A", string(kubeServicesChain),
+				"-m", "comment", "--comment", fmt.Sprintf(`"%s external IP held by a local process"`, svcInfo.serviceNameString),
+				"-m", protocol, "-p", protocol,
+				"-d", ToCIDR(net.ParseIP(externalIP)),
+				"--dport", svcInfo.dport(),
+				"-j", "RETURN",
+			)
+			continue
 		}
-		t.openPortLocally(protocol, localAddrSet, externalIP, svcInfo.Port(),
-			ipFamily, "externalIP for "+svcInfo.serviceNameString, replacementPortsMap)
 
-		if val, ok := t.endpointsMap[svcName]; ok && len(*val) > 0 {
+		if hasEndpoints {
 			args = append(args[:0],
 				"-m", "comment", "--comment", fmt.Sprintf(`"%s external IP"`, svcInfo.serviceNameString),
 				"-m", protocol, "-p", protocol,
 				"-d", ToCIDR(net.ParseIP(externalIP)),
-				"--dport", strconv.Itoa(svcInfo.Port()),
+				"--dport", svcInfo.dport(),
 			)
 
 			destChain := svcXlbChain
@@ -438,8 +639,8 @@ func (t *iptables) writeExternalIPRules(svcInfo *serviceInfo, svcName types.Name
 			if !svcInfo.NodeLocalExternal() {
 				appendTo := []string{"-A", string(svcChain)}
 				destChain = svcChain
-				// This masquerades off-cluster traffic to a External IP.
-				if t.localDetector.IsImplemented() {
+				// This masquerades off-cluster traffic to a External IP (or all of it, if forced).
+				if t.localDetector.IsImplemented() && !svcInfo.ForceMasquerade() {
 					t.natRules.Write(appendTo, t.localDetector.JumpIfNotLocal(args, string(KubeMarkMasqChain)))
 				} else {
 					t.natRules.Write(appendTo, args, "-j", string(KubeMarkMasqChain))
@@ -455,7 +656,7 @@ func (t *iptables) writeExternalIPRules(svcInfo *serviceInfo, svcName types.Name
 				"-m", "comment", "--comment", fmt.Sprintf(`"%s has no endpoints"`, svcInfo.serviceNameString),
 				"-m", protocol, "-p", protocol,
 				"-d", ToCIDR(net.ParseIP(externalIP)),
-				"--dport", strconv.Itoa(svcInfo.Port()),
+				"--dport", svcInfo.dport(),
 				"-j", "REJECT",
 			)
 		}
@@ -464,14 +665,14 @@ func (t *iptables) writeExternalIPRules(svcInfo *serviceInfo, svcName types.Name
 
 // writeLoadBalancerRules writes rules to FW chain to jump to svc/xlb and writes rule to jump to FW
 // in kube-services
-func (t *iptables) writeLoadBalancerRules(svcInfo *serviceInfo, svcName types.NamespacedName, args []string) {
+func (t *iptables) writeLoadBalancerRules(svcInfo *serviceInfo, svcName types.NamespacedName, hasEndpoints bool, args []string) {
 	svcChain := svcInfo.servicePortChainName
 	fwChain := svcInfo.serviceFirewallChainName
 	svcXlbChain := svcInfo.serviceLBChainName
 	protocol := strings.ToLower(svcInfo.Protocol().String())
 	for _, ingress := range svcInfo.LoadBalancerIPStrings() {
 		if ingress != "" {
-			if val, ok := t.endpointsMap[svcName]; ok && len(*val) > 0 {
+			if hasEndpoints {
 
 				// The service firewall rules are created based on ServiceSpec.loadBalancerSourceRanges field.
 				// This currently works for loadbalancers that preserves source ips.
@@ -482,7 +683,7 @@ func (t *iptables) writeLoadBalancerRules(svcInfo *serviceInfo, svcName types.Na
 					"-m", "comment", "--comment", fmt.Sprintf(`"%s loadbalancer IP"`, svcInfo.serviceNameString),
 					"-m", protocol, "-p", protocol,
 					"-d", ToCIDR(net.ParseIP(ingress)),
-					"--dport", strconv.Itoa(svcInfo.Port()),
+					"--dport", svcInfo.dport(),
 				)
 				// jump to service firewall chain
 				t.natRules.Write(args, "-j", string(fwChain))
@@ -505,10 +706,16 @@ func (t *iptables) writeLoadBalancerRules(svcInfo *serviceInfo, svcName types.Na
 					// allow all sources, so jump directly to the KUBE-SVC or KUBE-XLB chain
 					t.natRules.Write(args, "-j", string(chosenChain))
 				} else {
-					// firewall filter based on each source range
+					// firewall filter based on each source range, or on the ipset of the ranges
 					allowFromNode := false
+					srcSet := t.sourceRangesSet(svcInfo, protocol)
+					if srcSet != "" {
+						t.natRules.Write(args, "-m", "set", "--match-set", srcSet, "src", "-j", string(chosenChain))
+					}
 					for _, src := range svcInfo.LoadBalancerSourceRanges() {
-						t.natRules.Write(args, "-s", src, "-j", string(chosenChain))
+						if srcSet == "" {
+							t.natRules.Write(args, "-s", src, "-j", string(chosenChain))
+						}
 						_, cidr, err := net.ParseCIDR(src)
 						if err != nil {
 							klog.ErrorS(err, "Error parsing CIDR in LoadBalancerSourceRanges, dropping it", "cidr", cidr)
@@ -534,7 +741,7 @@ func (t *iptables) writeLoadBalancerRules(svcInfo *serviceInfo, svcName types.Na
 					"-m", "comment", "--comment", fmt.Sprintf(`"%s has no endpoints"`, svcInfo.serviceNameString),
 					"-m", protocol, "-p", protocol,
 					"-d", ToCIDR(net.ParseIP(ingress)),
-					"--dport", strconv.Itoa(svcInfo.Port()),
+					"--dport", svcInfo.dport(),
 					"-j", "REJECT",
 				)
 			}
@@ -542,10 +749,10 @@ func (t *iptables) writeLoadBalancerRules(svcInfo *serviceInfo, svcName types.Na
 	}
 }
 
-//writeNodePortsRules write rules to nodeports to jump to xlb/svc.
+// writeNodePortsRules write rules to nodeports to jump to xlb/svc.
 func (t *iptables) writeNodePortsRules(svcInfo *serviceInfo, nodeAddresses sets.String,
-	svcName types.NamespacedName, localAddrSet utilnet.IPSet,
-	replacementPortsMap map[utilnet.LocalPort]utilnet.Closeable, args []string) {
+	svcName types.NamespacedName, hasEndpoints bool, localAddrSet utilnet.IPSet,
+	localPorts *portopener.Sync, args []string) {
 	//If we had more than 2 rules it might be
 	// worthwhile to make a new per-service chain for nodeport rules, but
 	// with just 2 rules it ends up being a waste and a cognitive burden.
@@ -562,15 +769,24 @@ func (t *iptables) writeNodePortsRules(svcInfo *serviceInfo, nodeAddresses sets.
 		// (because the socket might open but it would never work).
 		for address := range nodeAddresses {
 			t.openPortLocally(protocol, localAddrSet, address, svcInfo.NodePort(),
-				ipFamily, "nodePort for "+svcInfo.serviceNameString, replacementPortsMap)
+				ipFamily, "nodePort for "+svcInfo.serviceNameString, localPorts)
 		}
 
-		if val, ok := t.endpointsMap[svcName]; ok && len(*val) > 0 {
+		if hasEndpoints {
 			args = append(args[:0],
 				"-m", "comment", "--comment", svcInfo.serviceNameString,
 				"-m", protocol, "-p", protocol,
 				"--dport", strconv.Itoa(svcInfo.NodePort()),
 			)
+			if limit := svcInfo.NodePortRateLimit(); limit != nil {
+				// Drop the new connections above the rate, all the clients sharing the same bucket.
+				t.natRules.Write("-A", string(kubeNodePortsChain), args,
+					"-m", "hashlimit",
+					"--hashlimit-above", strconv.Itoa(limit.PerSecond)+"/sec",
+					"--hashlimit-burst", strconv.Itoa(limit.Burst),
+					"--hashlimit-name", svcInfo.serviceRateLimitName,
+					"-j", string(KubeMarkDropChain))
+			}
 			if !svcInfo.NodeLocalExternal() {
 				// Nodeports need SNAT, unless they're local.
 				t.natRules.Write("-A", string(svcChain), args, "-j", string(KubeMarkMasqChain))
@@ -615,7 +831,7 @@ func (t *iptables) writeNodePortsRules(svcInfo *serviceInfo, nodeAddresses sets.
 	}
 }
 
-//createEndpointsChain creates chains for each ep
+// createEndpointsChain creates chains for each ep
 func (t *iptables) createEndpointsChain(svcInfo *serviceInfo, allEndpoints *endpointsInfoByName,
 	existingNATChains map[util.Chain][]byte, activeNATChains map[util.Chain]bool) ([]*string, *[]util.Chain, *[]util.Chain, map[string]int32) {
 	endpoints := make([]*string, 0)
@@ -628,29 +844,20 @@ func (t *iptables) createEndpointsChain(svcInfo *serviceInfo, allEndpoints *endp
 		return nil, nil, nil, nil
 	}
 
-	for _, epInfo := range *allEndpoints {
-		// epInfo, ok := ep.(*endpointsInfo)
-		// if !ok {
-		// 	klog.ErrorS(err, "Failed to cast endpointsInfo", "endpointsInfo", ep.String())
-		// 	continue
-		// }
-		var ep string
-		if t.iptInterface.IsIPv6() {
-			if len(epInfo.IPs.V6) <= 0 {
-				continue
-			}
-			ep = epInfo.IPs.V6[0]
-		} else {
-			if len(epInfo.IPs.V4) <= 0 {
-				continue
-			}
-			ep = epInfo.IPs.V4[0]
-		}
+	// Endpoints are sorted so an unchanged set gives the same chains and probability rules, whatever its order.
+	for _, sortedEp := range allEndpoints.sorted(t.iptInterface.IsIPv6()) {
+		ep, epInfo := sortedEp.ip, sortedEp.endpoint
 
 		targetPort := epInfo.PortMapping(&localnetv1.PortMapping{
+			Name:           svcInfo.portName,
+			Protocol:       svcInfo.protocol,
 			TargetPortName: svcInfo.targetPortName,
 			TargetPort:     int32(svcInfo.targetPort),
 		})
+		if targetPort == 0 {
+			// the endpoint doesn't advertise this port (or with another protocol)
+			continue
+		}
 		endpointPortMap[ep] = targetPort
 		endpoints = append(endpoints, &ep)
 
@@ -667,7 +874,7 @@ func (t *iptables) createEndpointsChain(svcInfo *serviceInfo, allEndpoints *endp
 	return endpoints, &endpointChains, &localEndpointChains, endpointPortMap
 }
 
-//writeEndpointRules writes rules to svc to jump to sep and rules to sep to dnat and loadbalance to actual ep ip
+// writeEndpointRules writes rules to svc to jump to sep and rules to sep to dnat and loadbalance to actual ep ip
 func (t *iptables) writeEndpointRules(svcInfo *serviceInfo, svcName types.NamespacedName, endpointChains *[]util.Chain,
 	endpoints []*string, args *[]string, endpointPortMap map[string]int32) {
 	// First write session affinity rules, if applicable.
@@ -738,9 +945,11 @@ func (t *iptables) writeDNATRules(svcInfo *serviceInfo, svcName types.Namespaced
 		args = append(args[:0], "-A", string(endpointChain))
 		args = t.appendServiceCommentLocked(args, svcInfo.serviceNameString)
 		// Handle traffic that loops back to the originator with SNAT.
-		t.natRules.Write(args,
-			"-s", ToCIDR(net.ParseIP(*epIP)),
-			"-j", string(KubeMarkMasqChain))
+		if t.hairpinMasquerade {
+			t.natRules.Write(args,
+				"-s", ToCIDR(net.ParseIP(*epIP)),
+				"-j", string(KubeMarkMasqChain))
+		}
 		// Update client-affinity lists.
 		if svcInfo.SessionAffinity().ClientIP != nil {
 			args = append(args, "-m", "recent", "--name", string(endpointChain), "--set")
@@ -755,7 +964,7 @@ func (t *iptables) writeDNATRules(svcInfo *serviceInfo, svcName types.Namespaced
 			continue
 		}
 		// DNAT to final destination.
-		args = append(args, "-m", protocol, "-p", protocol, "-j", "DNAT", "--to-destination", net.JoinHostPort(*epIP, strconv.Itoa(targetPort)))
+		args = append(args, "-m", protocol, "-p", protocol, "-j", "DNAT", "--to-destination", net.JoinHostPort(*epIP, svcInfo.dnatPort(targetPort)))
 		t.natRules.Write(args)
 	}
 }
@@ -786,6 +995,13 @@ func (t *iptables) writeLocalExtTrafficPolicyRules(svcInfo *serviceInfo, svcName
 		t.natRules.Write(t.localDetector.JumpIfLocal(args, string(svcChain)))
 	}
 
+	// The service requested all its traffic to be SNATed, even with externalTrafficPolicy=Local
+	if svcInfo.ForceMasquerade() {
+		t.natRules.Write("-A", string(svcXlbChain),
+			"-m", "comment", "--comment", fmt.Sprintf(`"forced masquerade for %s"`, svcInfo.serviceNameString),
+			"-j", string(KubeMarkMasqChain))
+	}
+
 	// Next, redirect all src-type=LOCAL -> LB IP to the service chain for externalTrafficPolicy=Local
 	// This allows traffic originating from the host to be redirected to the service correctly,
 	// otherwise traffic to LB IPs are dropped if there are no local endpoints.
@@ -797,12 +1013,8 @@ func (t *iptables) writeLocalExtTrafficPolicyRules(svcInfo *serviceInfo, svcName
 		"-m", "comment", "--comment", fmt.Sprintf(`"route LOCAL traffic for %s LB IP to service chain"`, svcInfo.serviceNameString),
 		"-m", "addrtype", "--src-type", "LOCAL", "-j", string(svcChain))
 
-	// Prefer local ready endpoint chains, but fall back to ready terminating if none exist
+	// The serving terminating endpoints are sent by the server when there are no ready ones (ProxyTerminatingEndpoints)
 	localEndpointChains := localReadyEndpointChains
-	// TODO: uncomment once 1.22 released
-	// if utilfeature.DefaultFeatureGate.Enabled(features.ProxyTerminatingEndpoints) && len(localEndpointChains) == 0 {
-	// 	localEndpointChains = localServingTerminatingEndpointChains
-	// }
 
 	numLocalEndpoints := len(*localEndpointChains)
 	if numLocalEndpoints == 0 {
@@ -850,7 +1062,7 @@ func (t *iptables) writeLocalExtTrafficPolicyRules(svcInfo *serviceInfo, svcName
 	}
 }
 
-//writeNodePortJumpRule writes rules to jump to NODEPORTS from kube-service for nodeips/zerocidr
+// writeNodePortJumpRule writes rules to jump to NODEPORTS from kube-service for nodeips/zerocidr
 func (t *iptables) writeNodePortJumpRule(nodeAddresses sets.String, args []string) {
 	isIPv6 := t.iptInterface.IsIPv6()
 	for address := range nodeAddresses {
@@ -920,7 +1132,7 @@ func (t *iptables) writeMiscFilterRules() {
 	)
 }
 
-func (t *iptables) openPortLocally(protocol string, localAddrSet utilnet.IPSet, ip string, port int, ipFamily utilnet.IPFamily, description string, replacementPortsMap map[utilnet.LocalPort]utilnet.Closeable) {
+func (t *iptables) openPortLocally(protocol string, localAddrSet utilnet.IPSet, ip string, port int, ipFamily utilnet.IPFamily, description string, localPorts *portopener.Sync) {
 	if (v1.Protocol(protocol) != v1.ProtocolSCTP) && localAddrSet.Has(net.ParseIP(ip)) {
 		lp := utilnet.LocalPort{
 			Description: description,
@@ -929,25 +1141,9 @@ func (t *iptables) openPortLocally(protocol string, localAddrSet utilnet.IPSet,
 			Port:        port,
 			Protocol:    utilnet.Protocol(protocol),
 		}
-		if t.portsMap[lp] != nil {
-			klog.V(4).InfoS("Port was open before and is still needed", "port", lp.String())
-			replacementPortsMap[lp] = t.portsMap[lp]
-		} else {
-			socket, err := portMapper.OpenLocalPort(&lp)
-			if err != nil {
-				// msg := fmt.Sprintf("can't open port %s, skipping it", lp.String())
-
-				// 	t.recorder.Eventf(
-				// 		&v1.ObjectReference{
-				// 			Kind:      "Node",
-				// 			Name:      hostname, //TODO how to assign this
-				// 			UID:       types.UID(hostname),
-				// 			Namespace: "",
-				// 		}, nil, v1.EventTypeWarning, err.Error(), "SyncProxyRules", msg)
-				klog.ErrorS(err, "can't open port, skipping it", "port", lp.String())
-			}
-			klog.V(2).InfoS("Opened local port", "port", lp.String())
-			replacementPortsMap[lp] = socket
+		if err := localPorts.Claim(lp, description); err != nil {
+			emitNodeWarning(t.recorder, "PortOpenFailed", "SyncProxyRules", "can't open port %s, skipping it: %v", lp.String(), err)
+			klog.ErrorS(err, "can't open port, skipping it", "port", lp.String())
 		}
 	}
 }
@@ -968,11 +1164,33 @@ func (t *iptables) applyAllRules() error {
 	numberNatIptablesRules := CountBytesLines(t.natRules.Bytes())
 	IptablesRulesTotal.WithLabelValues(string(util.TableNAT)).Set(float64(numberNatIptablesRules))
 
+	_, span := tracing.Tracer().Start(t.traceCtx, "iptables-restore", trace.WithAttributes(
+		attribute.String("kpng.family", string(t.iptInterface.Protocol())),
+		attribute.Int("kpng.rules", numberFilterIptablesRules+numberNatIptablesRules),
+	))
+	defer span.End()
+
 	klog.InfoS("Restoring iptables", "rules", string(t.iptablesData.Bytes()))
 	err := t.iptInterface.RestoreAll(t.iptablesData.Bytes(), util.NoFlushTables, util.RestoreCounters)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
 	return err
 }
 
+// countObjects returns the number of services, chains and rules written by the sync (without the table headers and
+// COMMIT lines).
+func (t *iptables) countObjects(services int) map[string]int {
+	return map[string]int{
+		"services":      services,
+		"filter-chains": CountBytesLines(t.filterChains.Bytes()) - 1,
+		"filter-rules":  CountBytesLines(t.filterRules.Bytes()) - 1,
+		"nat-chains":    CountBytesLines(t.natChains.Bytes()) - 1,
+		"nat-rules":     CountBytesLines(t.natRules.Bytes()) - 1,
+	}
+}
+
 func (t *iptables) resetAllChains() {
 	t.filterChains.Reset()
 	t.filterRules.Reset()
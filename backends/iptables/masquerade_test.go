@@ -0,0 +1,97 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+)
+
+func TestForceMasquerade(t *testing.T) {
+	svcName := types.NamespacedName{Namespace: "default", Name: "web"}
+	port := &localnetv1.PortMapping{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 8080}
+
+	for _, force := range []bool{false, true} {
+		svc := &localnetv1.Service{
+			Namespace:       "default",
+			Name:            "web",
+			IPs:             &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.0.0.1"), ExternalIPs: &localnetv1.IPSet{}},
+			ForceMasquerade: force,
+		}
+
+		svcChanges := NewServiceChangeTracker(newServiceInfo, v1.IPv4Protocol, nil)
+		svcInfo := newServiceInfo(port, svc, svcChanges.newBaseServiceInfo(port, svc)).(*serviceInfo)
+
+		ipt := NewIptables()
+		ipt.endpointsMap[svcName] = &endpointsInfoByName{"ep": &localnetv1.Endpoint{}}
+
+		ipt.writeClusterIPRules(svcInfo, svcName, true, make([]string, 0, 64))
+
+		masq := "-A " + string(svcInfo.servicePortChainName)
+		rules := string(ipt.natRules.Bytes())
+
+		hasMasq := false
+		for _, rule := range strings.Split(rules, "\n") {
+			if strings.HasPrefix(rule, masq) && strings.HasSuffix(rule, "-j "+string(KubeMarkMasqChain)) {
+				hasMasq = true
+			}
+		}
+
+		if hasMasq != force {
+			t.Errorf("force=%v: expected masquerade %v, got rules:\n%s", force, force, rules)
+		}
+	}
+}
+
+func TestStrictNoMasquerade(t *testing.T) {
+	svcName := types.NamespacedName{Namespace: "default", Name: "web"}
+	port := &localnetv1.PortMapping{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 8080}
+	svc := &localnetv1.Service{
+		Namespace: "default",
+		Name:      "web",
+		IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.0.0.1"), ExternalIPs: &localnetv1.IPSet{}},
+	}
+
+	svcChanges := NewServiceChangeTracker(newServiceInfo, v1.IPv4Protocol, nil)
+	svcInfo := newServiceInfo(port, svc, svcChanges.newBaseServiceInfo(port, svc)).(*serviceInfo)
+
+	detector, err := NewDetectLocalByBridgeInterface("cni0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, strict := range []bool{false, true} {
+		ipt := NewIptables()
+		ipt.localDetector = detector
+		ipt.strictNoMasquerade = strict
+		ipt.endpointsMap[svcName] = &endpointsInfoByName{"ep": &localnetv1.Endpoint{}}
+
+		ipt.writeClusterIPRules(svcInfo, svcName, true, make([]string, 0, 64))
+
+		rules := string(ipt.natRules.Bytes())
+		hasMasq := strings.Contains(rules, "! -i cni0") && strings.Contains(rules, "-j "+string(KubeMarkMasqChain))
+
+		if hasMasq == strict {
+			t.Errorf("strict=%v: expected the off-cluster masquerade %v, got rules:\n%s", strict, !strict, rules)
+		}
+	}
+}
@@ -126,6 +126,77 @@ var (
 		},
 	)
 
+	// IptablesServiceFailuresTotal is the number of iptables restore failures caused by a service, that was then
+	// quarantined.
+	IptablesServiceFailuresTotal = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Subsystem:      kubeProxySubsystem,
+			Name:           "sync_proxy_rules_iptables_service_failures_total",
+			Help:           "Cumulative proxy iptables restore failures caused by a service",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+
+	// IptablesQuarantinedServices is the number of services left out of the rules because they made iptables
+	// restore fail.
+	IptablesQuarantinedServices = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Subsystem:      kubeProxySubsystem,
+			Name:           "sync_proxy_rules_quarantined_services",
+			Help:           "Number of services left out of the proxy iptables rules after making iptables restore fail",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"ip_family"},
+	)
+
+	// IptablesDriftTotal is the number of times the iptables rules were found changed by another agent since
+	// they were synced.
+	IptablesDriftTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      kubeProxySubsystem,
+			Name:           "sync_proxy_rules_iptables_drift_total",
+			Help:           "Cumulative proxy iptables rules found changed by another agent",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"ip_family"},
+	)
+
+	// IptablesSplitChains is the number of continuation chains written by the last sync for the chains over
+	// --max-chain-rules.
+	IptablesSplitChains = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Subsystem:      kubeProxySubsystem,
+			Name:           "sync_proxy_rules_iptables_split_chains",
+			Help:           "Number of continuation chains of the proxy iptables chains over the max number of rules",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"ip_family", "table"},
+	)
+
+	// IptablesGuardrailViolationsTotal is the number of rules found over an iptables-restore limit (line length or
+	// number of arguments) before being applied.
+	IptablesGuardrailViolationsTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      kubeProxySubsystem,
+			Name:           "sync_proxy_rules_iptables_guardrail_violations_total",
+			Help:           "Cumulative proxy iptables rules over an iptables-restore limit",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"ip_family", "limit"},
+	)
+
+	// IptablesExternalIPConflicts is the number of ports of external IPs assigned to the node found held by
+	// another process by the last sync.
+	IptablesExternalIPConflicts = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Subsystem:      kubeProxySubsystem,
+			Name:           "sync_proxy_rules_external_ip_conflicts",
+			Help:           "Number of ports of the local external IPs held by another process on the node",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"ip_family"},
+	)
+
 	// IptablesRulesTotal is the number of iptables rules that the iptables proxy installs.
 	IptablesRulesTotal = metrics.NewGaugeVec(
 		&metrics.GaugeOpts{
@@ -164,6 +235,12 @@ func RegisterMetrics() {
 		legacyregistry.MustRegister(ServiceChangesTotal)
 		legacyregistry.MustRegister(IptablesRulesTotal)
 		legacyregistry.MustRegister(IptablesRestoreFailuresTotal)
+		legacyregistry.MustRegister(IptablesServiceFailuresTotal)
+		legacyregistry.MustRegister(IptablesQuarantinedServices)
+		legacyregistry.MustRegister(IptablesDriftTotal)
+		legacyregistry.MustRegister(IptablesSplitChains)
+		legacyregistry.MustRegister(IptablesGuardrailViolationsTotal)
+		legacyregistry.MustRegister(IptablesExternalIPConflicts)
 		legacyregistry.MustRegister(SyncProxyRulesLastQueuedTimestamp)
 	})
 }
@@ -30,16 +30,16 @@ type NetworkInterfacer interface {
 
 // RealNetwork implements the NetworkInterfacer interface for production code, just
 // wrapping the underlying net library function calls.
-//type RealNetwork struct{}
+type RealNetwork struct{}
 
 // Addrs wraps net.Interface.Addrs(), it's a part of NetworkInterfacer interface.
-//func (RealNetwork) Addrs(intf *net.Interface) ([]net.Addr, error) {
-//	return intf.Addrs()
-//}
+func (RealNetwork) Addrs(intf *net.Interface) ([]net.Addr, error) {
+	return intf.Addrs()
+}
 
 // Interfaces wraps net.Interfaces(), it's a part of NetworkInterfacer interface.
-//func (RealNetwork) Interfaces() ([]net.Interface, error) {
-//	return net.Interfaces()
-//}
+func (RealNetwork) Interfaces() ([]net.Interface, error) {
+	return net.Interfaces()
+}
 
-//var _ NetworkInterfacer = &RealNetwork{}
+var _ NetworkInterfacer = &RealNetwork{}
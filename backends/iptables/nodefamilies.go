@@ -0,0 +1,152 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+// ipFamilyAuto detects the IP families of the node, see detectNodeFamilies.
+const ipFamilyAuto = "auto"
+
+// nodeFamilies are the IP families of the node, the primary one first, and the pod CIDRs assigned to the node.
+type nodeFamilies struct {
+	families []v1.IPFamily
+	podCIDRs []string
+}
+
+// detectNodeFamilies returns the IP families of the Node object, from its addresses and pod CIDRs. If the Node
+// can't be read (ie: no access to the API server), the families of the global unicast addresses of the local
+// interfaces are returned, IPv4 first.
+func detectNodeFamilies(kubeconfig, nodeName string) (nodeFamilies, error) {
+	node, err := getNode(kubeconfig, nodeName)
+	if err == nil {
+		if nf := familiesOfNode(node); len(nf.families) != 0 {
+			klog.InfoS("Detected the IP families of the node", "node", nodeName, "families", nf.families, "podCIDRs", nf.podCIDRs)
+			return nf, nil
+		}
+		err = fmt.Errorf("no address or pod CIDR in the status of node %s", nodeName)
+	}
+	klog.Warning("failed to detect the IP families from the node, using the local interfaces: ", err)
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nodeFamilies{}, err
+	}
+
+	nf := nodeFamilies{families: familiesOfAddresses(addrs)}
+	if len(nf.families) == 0 {
+		return nodeFamilies{}, fmt.Errorf("no global unicast address on the local interfaces")
+	}
+
+	klog.InfoS("Detected the IP families of the local interfaces", "families", nf.families)
+	return nf, nil
+}
+
+// getNode reads the node from the API server. An empty kubeconfig uses the in-cluster configuration.
+func getNode(kubeconfig, nodeName string) (*v1.Node, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+}
+
+// familiesOfNode returns the families of the node's pod CIDRs, or of its internal and external addresses if it has
+// none. As set by the kubelet, the first one is the primary family.
+func familiesOfNode(node *v1.Node) (nf nodeFamilies) {
+	add := func(family v1.IPFamily) {
+		for _, f := range nf.families {
+			if f == family {
+				return
+			}
+		}
+		nf.families = append(nf.families, family)
+	}
+
+	podCIDRs := node.Spec.PodCIDRs
+	if len(podCIDRs) == 0 && node.Spec.PodCIDR != "" {
+		podCIDRs = []string{node.Spec.PodCIDR}
+	}
+
+	for _, cidr := range podCIDRs {
+		family, err := getIPFamilyFromCIDR(cidr)
+		if err != nil {
+			klog.Warningf("ignoring the pod CIDR %q of node %s: %v", cidr, node.Name, err)
+			continue
+		}
+		add(family)
+		nf.podCIDRs = append(nf.podCIDRs, cidr)
+	}
+
+	if len(nf.families) != 0 {
+		return
+	}
+
+	for _, addr := range node.Status.Addresses {
+		if addr.Type != v1.NodeInternalIP && addr.Type != v1.NodeExternalIP {
+			continue
+		}
+		if family, err := getIPFamilyFromIP(addr.Address); err == nil {
+			add(family)
+		}
+	}
+	return
+}
+
+// familiesOfAddresses returns the families of the global unicast addresses, IPv4 first.
+func familiesOfAddresses(addrs []net.Addr) (families []v1.IPFamily) {
+	hasV4, hasV6 := false, false
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || !ipNet.IP.IsGlobalUnicast() {
+			continue
+		}
+		if utilnet.IsIPv6(ipNet.IP) {
+			hasV6 = true
+		} else {
+			hasV4 = true
+		}
+	}
+
+	if hasV4 {
+		families = append(families, v1.IPv4Protocol)
+	}
+	if hasV6 {
+		families = append(families, v1.IPv6Protocol)
+	}
+	return
+}
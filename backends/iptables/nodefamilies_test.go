@@ -0,0 +1,96 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestFamiliesOfNode(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		node     *v1.Node
+		expected nodeFamilies
+	}{
+		{
+			name: "dual-stack pod CIDRs, IPv6 primary",
+			node: &v1.Node{Spec: v1.NodeSpec{PodCIDRs: []string{"fd00:10::/64", "10.244.1.0/24"}}},
+			expected: nodeFamilies{
+				families: []v1.IPFamily{v1.IPv6Protocol, v1.IPv4Protocol},
+				podCIDRs: []string{"fd00:10::/64", "10.244.1.0/24"},
+			},
+		},
+		{
+			name: "legacy pod CIDR",
+			node: &v1.Node{Spec: v1.NodeSpec{PodCIDR: "10.244.1.0/24"}},
+			expected: nodeFamilies{
+				families: []v1.IPFamily{v1.IPv4Protocol},
+				podCIDRs: []string{"10.244.1.0/24"},
+			},
+		},
+		{
+			name: "addresses without pod CIDR",
+			node: &v1.Node{Status: v1.NodeStatus{Addresses: []v1.NodeAddress{
+				{Type: v1.NodeHostName, Address: "node-1"},
+				{Type: v1.NodeInternalIP, Address: "192.168.0.10"},
+				{Type: v1.NodeInternalIP, Address: "fd00::10"},
+				{Type: v1.NodeExternalIP, Address: "203.0.113.10"},
+			}}},
+			expected: nodeFamilies{families: []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}},
+		},
+		{
+			name:     "nothing",
+			node:     &v1.Node{},
+			expected: nodeFamilies{},
+		},
+	} {
+		if nf := familiesOfNode(test.node); !reflect.DeepEqual(nf, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, nf)
+		}
+	}
+}
+
+func TestFamiliesOfAddresses(t *testing.T) {
+	addrs := func(cidrs ...string) (addrs []net.Addr) {
+		for _, cidr := range cidrs {
+			ip, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ipNet.IP = ip
+			addrs = append(addrs, ipNet)
+		}
+		return
+	}
+
+	for _, test := range []struct {
+		addrs    []net.Addr
+		expected []v1.IPFamily
+	}{
+		{addrs("127.0.0.1/8", "::1/128", "fe80::1/64", "fd00::10/64"), []v1.IPFamily{v1.IPv6Protocol}},
+		{addrs("fd00::10/64", "192.168.0.10/24"), []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}},
+		{addrs("127.0.0.1/8"), nil},
+	} {
+		if families := familiesOfAddresses(test.addrs); !reflect.DeepEqual(families, test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.addrs, test.expected, families)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package portopener holds local ports (NodePorts, external IPs resolving to
+// the node) open with dummy listeners, so no other process on the node can
+// bind a port the backend redirects traffic from.
+package portopener
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+// OpenerFunc is a function implementing utilnet.PortOpener.
+type OpenerFunc func(lp *utilnet.LocalPort) (utilnet.Closeable, error)
+
+// OpenLocalPort calls f(lp).
+func (f OpenerFunc) OpenLocalPort(lp *utilnet.LocalPort) (utilnet.Closeable, error) {
+	return f(lp)
+}
+
+type heldPort struct {
+	owner  string
+	socket utilnet.Closeable
+}
+
+// Manager tracks the local ports held open and the service owning each of them.
+type Manager struct {
+	opener utilnet.PortOpener
+
+	mu    sync.Mutex
+	ports map[utilnet.LocalPort]heldPort
+}
+
+// New returns a Manager opening ports with the given opener (bind() and listen() if nil).
+func New(opener utilnet.PortOpener) *Manager {
+	if opener == nil {
+		opener = &utilnet.ListenPortOpener
+	}
+
+	return &Manager{
+		opener: opener,
+		ports:  make(map[utilnet.LocalPort]heldPort),
+	}
+}
+
+// key returns the LocalPort identifying the port, the description is not part of it.
+func key(lp utilnet.LocalPort) utilnet.LocalPort {
+	lp.Description = ""
+	return lp
+}
+
+// Claim holds the port open for the owner. It's idempotent, but fails if the
+// port is already held for another owner.
+func (m *Manager) Claim(lp utilnet.LocalPort, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := key(lp)
+	if held, ok := m.ports[k]; ok {
+		if held.owner == owner {
+			return nil
+		}
+		return fmt.Errorf("port conflict on %s: %s vs %s", lp.String(), owner, held.owner)
+	}
+
+	socket, err := m.opener.OpenLocalPort(&lp)
+	if err != nil {
+		return fmt.Errorf("can't open local port %s: %w", lp.String(), err)
+	}
+
+	klog.V(2).InfoS("Opened local port", "port", lp.String(), "owner", owner)
+	m.ports[k] = heldPort{owner: owner, socket: socket}
+	return nil
+}
+
+// Release closes the port held for the owner. Releasing a port not held is
+// not an error, releasing it for another owner is.
+func (m *Manager) Release(lp utilnet.LocalPort, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := key(lp)
+	held, ok := m.ports[k]
+	if !ok {
+		klog.V(4).InfoS("Ignoring release of a port not held", "port", lp.String())
+		return nil
+	}
+	if held.owner != owner {
+		return fmt.Errorf("port conflict on %s (release): %s vs %s", lp.String(), owner, held.owner)
+	}
+
+	delete(m.ports, k)
+	klog.V(2).InfoS("Closing local port", "port", lp.String(), "owner", owner)
+	return held.socket.Close()
+}
+
+// Len returns the number of ports held open.
+func (m *Manager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.ports)
+}
+
+// Sync starts a full synchronization of the held ports: ports claimed in it
+// are kept (or opened), and Commit closes the others.
+func (m *Manager) Sync() *Sync {
+	return &Sync{
+		m:      m,
+		ports:  make(map[utilnet.LocalPort]heldPort),
+		opened: make(map[utilnet.LocalPort]bool),
+	}
+}
+
+// Sync is a full synchronization of the ports held by a Manager.
+type Sync struct {
+	m      *Manager
+	ports  map[utilnet.LocalPort]heldPort
+	opened map[utilnet.LocalPort]bool
+}
+
+// Claim keeps the port open for the owner, opening it if it wasn't already.
+func (s *Sync) Claim(lp utilnet.LocalPort, owner string) error {
+	k := key(lp)
+	if held, ok := s.ports[k]; ok {
+		if held.owner == owner {
+			return nil
+		}
+		return fmt.Errorf("port conflict on %s: %s vs %s", lp.String(), owner, held.owner)
+	}
+
+	s.m.mu.Lock()
+	held, ok := s.m.ports[k]
+	s.m.mu.Unlock()
+
+	if ok {
+		klog.V(4).InfoS("Port was open before and is still needed", "port", lp.String())
+		held.owner = owner
+		s.ports[k] = held
+		return nil
+	}
+
+	socket, err := s.m.opener.OpenLocalPort(&lp)
+	if err != nil {
+		return fmt.Errorf("can't open local port %s: %w", lp.String(), err)
+	}
+
+	klog.V(2).InfoS("Opened local port", "port", lp.String(), "owner", owner)
+	s.ports[k] = heldPort{owner: owner, socket: socket}
+	s.opened[k] = true
+	return nil
+}
+
+// Probe checks that the port could be opened, without holding it (ie: that no other process on the node holds it).
+// The ports held by the manager can be.
+func (s *Sync) Probe(lp utilnet.LocalPort) error {
+	k := key(lp)
+	if _, ok := s.ports[k]; ok {
+		return nil
+	}
+
+	s.m.mu.Lock()
+	_, ok := s.m.ports[k]
+	s.m.mu.Unlock()
+
+	if ok {
+		return nil
+	}
+
+	socket, err := s.m.opener.OpenLocalPort(&lp)
+	if err != nil {
+		return fmt.Errorf("can't open local port %s: %w", lp.String(), err)
+	}
+	return socket.Close()
+}
+
+// Commit makes the ports claimed in this sync the held ports, closing the ones not claimed anymore.
+func (s *Sync) Commit() {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for lp, held := range s.m.ports {
+		if _, ok := s.ports[lp]; !ok {
+			klog.V(2).InfoS("Closing local port", "port", lp.String(), "owner", held.owner)
+			held.socket.Close()
+		}
+	}
+
+	s.m.ports = s.ports
+}
+
+// Abort closes the ports opened by this sync, leaving the held ports as they were.
+func (s *Sync) Abort() {
+	for lp := range s.opened {
+		klog.V(2).InfoS("Closing local port", "port", lp.String())
+		s.ports[lp].socket.Close()
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package portopener
+
+import (
+	"testing"
+
+	utilnet "k8s.io/utils/net"
+)
+
+type fakeSocket struct {
+	open map[utilnet.LocalPort]bool
+	lp   utilnet.LocalPort
+}
+
+func (s fakeSocket) Close() error {
+	delete(s.open, s.lp)
+	return nil
+}
+
+func fakeOpener(open map[utilnet.LocalPort]bool) OpenerFunc {
+	return func(lp *utilnet.LocalPort) (utilnet.Closeable, error) {
+		k := key(*lp)
+		open[k] = true
+		return fakeSocket{open, k}, nil
+	}
+}
+
+func nodePort(port int) utilnet.LocalPort {
+	return utilnet.LocalPort{Description: "nodePort", Port: port, Protocol: utilnet.TCP}
+}
+
+func TestClaimRelease(t *testing.T) {
+	open := map[utilnet.LocalPort]bool{}
+	m := New(fakeOpener(open))
+
+	if err := m.Claim(nodePort(30080), "default/web:http"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Claim(nodePort(30080), "default/web:http"); err != nil {
+		t.Error("claims should be idempotent: ", err)
+	}
+	if err := m.Claim(nodePort(30080), "default/other:http"); err == nil {
+		t.Error("claiming a port held by another owner should fail")
+	}
+	if err := m.Release(nodePort(30080), "default/other:http"); err == nil {
+		t.Error("releasing a port held by another owner should fail")
+	}
+	if len(open) != 1 {
+		t.Errorf("expected 1 open port, got %v", open)
+	}
+
+	if err := m.Release(nodePort(30080), "default/web:http"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Release(nodePort(30080), "default/web:http"); err != nil {
+		t.Error("releasing a port not held should be tolerated: ", err)
+	}
+	if len(open) != 0 || m.Len() != 0 {
+		t.Errorf("expected no open port, got %v", open)
+	}
+}
+
+func TestSync(t *testing.T) {
+	open := map[utilnet.LocalPort]bool{}
+	m := New(fakeOpener(open))
+
+	s := m.Sync()
+	s.Claim(nodePort(30080), "default/web:http")
+	s.Claim(nodePort(30443), "default/web:https")
+	s.Commit()
+
+	if len(open) != 2 || m.Len() != 2 {
+		t.Fatalf("expected 2 open ports, got %v", open)
+	}
+
+	// aborted syncs only close the ports they opened
+	s = m.Sync()
+	s.Claim(nodePort(30080), "default/web:http")
+	s.Claim(nodePort(30081), "default/web:alt")
+	if len(open) != 3 {
+		t.Fatalf("expected 3 open ports, got %v", open)
+	}
+	s.Abort()
+
+	if len(open) != 2 || !open[key(nodePort(30443))] || open[key(nodePort(30081))] {
+		t.Fatalf("abort should have closed only 30081, got %v", open)
+	}
+
+	// committed syncs close the ports not claimed anymore
+	s = m.Sync()
+	s.Claim(nodePort(30080), "default/web:http")
+	if err := s.Claim(nodePort(30080), "default/other:http"); err == nil {
+		t.Error("claiming a port held by another owner should fail")
+	}
+	s.Commit()
+
+	if len(open) != 1 || !open[key(nodePort(30080))] || m.Len() != 1 {
+		t.Fatalf("expected only 30080 to be open, got %v", open)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	open := map[utilnet.LocalPort]bool{}
+	m := New(fakeOpener(open))
+
+	s := m.Sync()
+	s.Claim(nodePort(30080), "default/web:http")
+
+	if err := s.Probe(nodePort(30080)); err != nil {
+		t.Error("probing a held port should succeed: ", err)
+	}
+	if err := s.Probe(nodePort(30081)); err != nil {
+		t.Error("probing a free port should succeed: ", err)
+	}
+	if len(open) != 1 || open[key(nodePort(30081))] {
+		t.Errorf("probing should not hold the port open, got %v", open)
+	}
+}
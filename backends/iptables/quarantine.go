@@ -0,0 +1,155 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"errors"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/backends/iptables/util"
+)
+
+// A service whose rules make iptables-restore fail is quarantined: its rules are left out of the next syncs, so it
+// doesn't fail the whole transaction for all the services, until its backoff (see --service-backoff-max) expires
+// and it's tried again.
+
+// lineMarks are the numbers of lines in the buffers of the restore data, in the order they're written in it.
+type lineMarks [4]int
+
+func (t *iptables) lineBuffers() [4]*util.LineBuffer {
+	return [4]*util.LineBuffer{&t.filterChains, &t.filterRules, &t.natChains, &t.natRules}
+}
+
+func (t *iptables) lineMarks() (marks lineMarks) {
+	for i, buf := range t.lineBuffers() {
+		marks[i] = buf.Lines()
+	}
+	return
+}
+
+// serviceLines records the lines of the restore data written for each service.
+type serviceLines struct {
+	ranges []serviceLinesRange
+}
+
+type serviceLinesRange struct {
+	service  types.NamespacedName
+	from, to lineMarks
+}
+
+func (l *serviceLines) reset() {
+	l.ranges = l.ranges[:0]
+}
+
+// add records the lines written for a service, between the from and to marks.
+func (l *serviceLines) add(service types.NamespacedName, from, to lineMarks) {
+	l.ranges = append(l.ranges, serviceLinesRange{service, from, to})
+}
+
+// serviceAt returns the service that wrote the given line (starting at 1) of the restore data, given the
+// final numbers of lines in the buffers.
+func (l *serviceLines) serviceAt(line int, final lineMarks) (service types.NamespacedName, found bool) {
+	buffer := -1
+	for i, lines := range final {
+		if line <= lines {
+			buffer = i
+			break
+		}
+		line -= lines
+	}
+
+	if buffer == -1 {
+		return
+	}
+
+	return l.serviceIn(buffer, line)
+}
+
+// serviceIn returns the service that wrote the given line (starting at 1) of a buffer (see lineBuffers).
+func (l *serviceLines) serviceIn(buffer, line int) (service types.NamespacedName, found bool) {
+	for _, r := range l.ranges {
+		if r.from[buffer] < line && line <= r.to[buffer] {
+			return r.service, true
+		}
+	}
+	return
+}
+
+// quarantineFailedService quarantines the service whose rules made iptables-restore fail, if known. Returns true
+// if a service was quarantined, in which case the sync may be retried without it right away.
+func (t *iptables) quarantineFailedService(err error, final lineMarks) bool {
+	var restoreErr *util.RestoreError
+	if !errors.As(err, &restoreErr) || restoreErr.Line() == 0 {
+		return false
+	}
+
+	service, found := t.serviceLines.serviceAt(restoreErr.Line(), final)
+	if !found {
+		return false
+	}
+
+	delay := t.quarantine.Failed(service.String())
+	t.quarantineErrors[service.String()] = err.Error()
+
+	klog.ErrorS(err, "Quarantining service failing iptables-restore", "service", service, "line", restoreErr.Line(), "retryingTime", delay)
+	IptablesServiceFailuresTotal.Inc()
+	emitNodeWarning(t.recorder, "ServiceQuarantined", "SyncProxyRules", "service %s makes iptables-restore fail, skipping it for %v: %v", service, delay, err)
+
+	return true
+}
+
+// releaseQuarantine ends the quarantine of the services programmed by a successful sync, and of the deleted ones.
+func (t *iptables) releaseQuarantine(programmed map[types.NamespacedName]bool) {
+	for _, key := range t.quarantine.Keys() {
+		parts := strings.SplitN(key, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		service := types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+		if programmed[service] {
+			t.quarantine.Succeeded(key)
+			klog.InfoS("Service no longer failing iptables-restore", "service", service)
+		} else if _, exists := t.serviceMap[service]; !exists {
+			t.quarantine.Succeeded(key)
+		}
+	}
+
+	IptablesQuarantinedServices.WithLabelValues(string(t.iptInterface.Protocol())).Set(float64(len(t.quarantine.Keys())))
+}
+
+// quarantinedServices returns the errors of the quarantined services, by "namespace/name".
+func (t *iptables) quarantinedServices() map[string]string {
+	keys := t.quarantine.Keys()
+
+	failures := make(map[string]string, len(keys))
+	for _, key := range keys {
+		failures[key] = t.quarantineErrors[key]
+	}
+
+	// forget the errors of the released services
+	for key := range t.quarantineErrors {
+		if _, quarantined := failures[key]; !quarantined {
+			delete(t.quarantineErrors, key)
+		}
+	}
+
+	return failures
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestServiceLines(t *testing.T) {
+	web := types.NamespacedName{Namespace: "default", Name: "web"}
+	db := types.NamespacedName{Namespace: "default", Name: "db"}
+
+	ipt := NewIptables()
+	ipt.filterChains.Write("*filter")
+	ipt.natChains.Write("*nat")
+
+	from := ipt.lineMarks()
+	ipt.natChains.Write(":KUBE-SVC-WEB - [0:0]")
+	ipt.natRules.Write("-A KUBE-SERVICES -j KUBE-SVC-WEB")
+	ipt.filterRules.Write("-A KUBE-EXTERNAL-SERVICES -j REJECT")
+	ipt.serviceLines.add(web, from, ipt.lineMarks())
+
+	from = ipt.lineMarks()
+	ipt.natChains.Write(":KUBE-SVC-DB - [0:0]")
+	ipt.natRules.Write("-A KUBE-SERVICES -j KUBE-SVC-DB")
+	ipt.serviceLines.add(db, from, ipt.lineMarks())
+
+	ipt.natRules.Write("-A KUBE-NODEPORTS -j ACCEPT")
+	ipt.filterRules.Write("COMMIT")
+	ipt.natRules.Write("COMMIT")
+
+	data := strings.Join([]string{
+		string(ipt.filterChains.Bytes()),
+		string(ipt.filterRules.Bytes()),
+		string(ipt.natChains.Bytes()),
+		string(ipt.natRules.Bytes()),
+	}, "")
+	lines := strings.Split(data, "\n")
+
+	for line, expected := range map[int]string{
+		1:  "",
+		2:  "default/web", // -A KUBE-EXTERNAL-SERVICES -j REJECT
+		3:  "",            // COMMIT
+		5:  "default/web", // :KUBE-SVC-WEB
+		6:  "default/db",  // :KUBE-SVC-DB
+		7:  "default/web", // -A KUBE-SERVICES -j KUBE-SVC-WEB
+		8:  "default/db",  // -A KUBE-SERVICES -j KUBE-SVC-DB
+		9:  "",            // -A KUBE-NODEPORTS -j ACCEPT
+		42: "",
+	} {
+		service, found := ipt.serviceLines.serviceAt(line, ipt.lineMarks())
+
+		result := ""
+		if found {
+			result = service.String()
+		}
+
+		if result != expected {
+			lineText := ""
+			if line <= len(lines) {
+				lineText = lines[line-1]
+			}
+			t.Errorf("line %d (%q): expected service %q, got %q", line, lineText, expected, result)
+		}
+	}
+}
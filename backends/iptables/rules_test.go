@@ -0,0 +1,340 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	utilnet "k8s.io/utils/net"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/backends/iptables/portopener"
+	"sigs.k8s.io/kpng/backends/iptables/util"
+	iptablestest "sigs.k8s.io/kpng/backends/iptables/util/testing"
+)
+
+// ruleTest syncs services on a fake iptables and compares the resulting chains, with the hashed chain names
+// replaced by readable ones: KUBE-SVC[default/web:http], KUBE-FW[...], KUBE-XLB[...] and
+// KUBE-SEP[default/web:http@10.1.0.1].
+type ruleTest struct {
+	t    *testing.T
+	fake *iptablestest.FakeIPTables
+	ipt  *iptables
+
+	names map[util.Chain]string
+}
+
+func newRuleTest(t *testing.T) *ruleTest {
+	fake := iptablestest.NewIPv4()
+
+	ipt := NewIptables()
+	ipt.iptInterface = fake
+	ipt.serviceChanges = NewServiceChangeTracker(newServiceInfo, v1.IPv4Protocol, nil)
+	ipt.endpointsChanges = NewEndpointChangeTracker("node-1", v1.IPv4Protocol, nil)
+	ipt.localPorts = portopener.New(portopener.OpenerFunc(func(lp *utilnet.LocalPort) (utilnet.Closeable, error) {
+		t.Errorf("unexpected port opened: %s", lp)
+		return nil, nil
+	}))
+	ipt.nodePortAddresses = nil
+	ipt.nodeIP = net.ParseIP("192.168.0.10")
+	ipt.masqueradeAll = false
+	ipt.hairpinMasquerade = true
+	ipt.strictNoMasquerade = false
+
+	return &ruleTest{t: t, fake: fake, ipt: ipt, names: map[util.Chain]string{}}
+}
+
+// sync applies the service and its endpoints (keyed by their first IP), and syncs the rules.
+func (rt *ruleTest) sync(svc *localnetv1.Service, endpoints ...*localnetv1.Endpoint) {
+	rt.t.Helper()
+
+	if svc != nil {
+		rt.ipt.serviceChanges.Update(svc)
+	}
+	for _, ep := range endpoints {
+		rt.ipt.endpointsChanges.EndpointUpdate(svc.Namespace, svc.Name, ep.IPs.First(), ep)
+	}
+
+	wg.Add(1)
+	rt.ipt.sync()
+
+	if !rt.ipt.applied {
+		restores := rt.fake.Restores()
+		rt.t.Fatalf("rules not applied:\n%s", restores[len(restores)-1])
+	}
+
+	for svcName, svcPorts := range rt.ipt.serviceMap {
+		for _, svcPort := range svcPorts {
+			svcInfo := svcPort.(*serviceInfo)
+			name := svcInfo.serviceNameString
+
+			rt.names[svcInfo.servicePortChainName] = "KUBE-SVC[" + name + "]"
+			rt.names[svcInfo.serviceFirewallChainName] = "KUBE-FW[" + name + "]"
+			rt.names[svcInfo.serviceLBChainName] = "KUBE-XLB[" + name + "]"
+			rt.names[util.Chain(svcInfo.serviceRateLimitName)] = "KUBE-NP[" + name + "]"
+
+			protocol := strings.ToLower(svcInfo.Protocol().String())
+			for _, ep := range rt.ipt.endpointsMap[svcName].sorted(false) {
+				rt.names[servicePortEndpointChainName(name, protocol, ep.ip)] = "KUBE-SEP[" + name + "@" + ep.ip + "]"
+			}
+		}
+	}
+}
+
+func (rt *ruleTest) readable(s string) string {
+	for chain, name := range rt.names {
+		s = strings.ReplaceAll(s, string(chain), name)
+	}
+	return s
+}
+
+// chains returns the readable names of the service and endpoint chains of the nat table.
+func (rt *ruleTest) chains() []string {
+	chains := []string{}
+	for _, chain := range rt.fake.Chains(util.TableNAT) {
+		for _, prefix := range []string{"KUBE-SVC-", "KUBE-FW-", "KUBE-XLB-", "KUBE-SEP-"} {
+			if strings.HasPrefix(string(chain), prefix) {
+				chains = append(chains, rt.readable(string(chain)))
+				break
+			}
+		}
+	}
+	sort.Strings(chains)
+	return chains
+}
+
+// expectRules checks the rules of a chain, given by its readable name.
+func (rt *ruleTest) expectRules(table util.Table, chain string, expected ...string) {
+	rt.t.Helper()
+
+	actual := util.Chain(chain)
+	for hashed, name := range rt.names {
+		if name == chain {
+			actual = hashed
+		}
+	}
+
+	rules := []string{}
+	for _, rule := range rt.fake.Rules(table, actual) {
+		rules = append(rules, rt.readable(rule))
+	}
+
+	if strings.Join(rules, "\n") != strings.Join(expected, "\n") {
+		rt.t.Errorf("%s %s: expected rules:\n%s\ngot:\n%s", table, chain, strings.Join(expected, "\n"), strings.Join(rules, "\n"))
+	}
+}
+
+func (rt *ruleTest) expectChains(expected ...string) {
+	rt.t.Helper()
+
+	if chains := rt.chains(); strings.Join(chains, " ") != strings.Join(expected, " ") {
+		rt.t.Errorf("expected the chains %q, got %q", expected, chains)
+	}
+}
+
+func ruleTestService(mutate func(svc *localnetv1.Service)) *localnetv1.Service {
+	svc := &localnetv1.Service{
+		Namespace: "default",
+		Name:      "web",
+		Type:      "ClusterIP",
+		IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.0.0.1"), ExternalIPs: &localnetv1.IPSet{}},
+		Ports: []*localnetv1.PortMapping{
+			{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 8080},
+		},
+	}
+	if mutate != nil {
+		mutate(svc)
+	}
+	return svc
+}
+
+func ruleTestEndpoint(ip string) *localnetv1.Endpoint {
+	ep := &localnetv1.Endpoint{}
+	ep.AddAddress(ip)
+	return ep
+}
+
+const nodePortsJump = `-A KUBE-SERVICES -m comment --comment "kubernetes service nodeports; NOTE: this must be the last rule in this chain" -m addrtype --dst-type LOCAL -j KUBE-NODEPORTS`
+
+func TestRules(t *testing.T) {
+	const (
+		svcChain = "KUBE-SVC[default/web:http]"
+		fwChain  = "KUBE-FW[default/web:http]"
+		sep1     = "KUBE-SEP[default/web:http@10.1.0.1]"
+		sep2     = "KUBE-SEP[default/web:http@10.1.0.2]"
+	)
+
+	clusterIPJump := `-A KUBE-SERVICES -m comment --comment "default/web:http cluster IP" -m tcp -p tcp -d 10.0.0.1/32 --dport 80 -j ` + svcChain
+	balancing := []string{
+		"-A " + svcChain + " -m comment --comment default/web:http -m statistic --mode random --probability 0.5000000000 -j " + sep1,
+		"-A " + svcChain + " -m comment --comment default/web:http -j " + sep2,
+	}
+	dnat := func(sep, ip string) []string {
+		return []string{
+			"-A " + sep + " -m comment --comment default/web:http -s " + ip + "/32 -j KUBE-MARK-MASQ",
+			"-A " + sep + " -m comment --comment default/web:http -m tcp -p tcp -j DNAT --to-destination " + ip + ":8080",
+		}
+	}
+
+	type chainRules struct {
+		table util.Table
+		chain string
+		rules []string
+	}
+
+	for _, tc := range []struct {
+		name   string
+		mutate func(svc *localnetv1.Service)
+		chains []string
+		rules  []chainRules
+	}{
+		{
+			name:   "cluster IP",
+			chains: []string{sep1, sep2, svcChain},
+			rules: []chainRules{
+				{util.TableNAT, "KUBE-SERVICES", []string{clusterIPJump, nodePortsJump}},
+				{util.TableNAT, "KUBE-NODEPORTS", nil},
+				{util.TableNAT, svcChain, balancing},
+				{util.TableNAT, sep1, dnat(sep1, "10.1.0.1")},
+				{util.TableNAT, sep2, dnat(sep2, "10.1.0.2")},
+			},
+		},
+		{
+			name: "node port",
+			mutate: func(svc *localnetv1.Service) {
+				svc.Type = "NodePort"
+				svc.Ports[0].NodePort = 30080
+			},
+			chains: []string{sep1, sep2, svcChain},
+			rules: []chainRules{
+				{util.TableNAT, "KUBE-SERVICES", []string{clusterIPJump, nodePortsJump}},
+				{util.TableNAT, "KUBE-NODEPORTS", []string{
+					"-A KUBE-NODEPORTS -m comment --comment default/web:http -m tcp -p tcp --dport 30080 -j " + svcChain,
+				}},
+				{util.TableNAT, svcChain, append([]string{
+					"-A " + svcChain + " -m comment --comment default/web:http -m tcp -p tcp --dport 30080 -j KUBE-MARK-MASQ",
+				}, balancing...)},
+				{util.TableNAT, sep1, dnat(sep1, "10.1.0.1")},
+				{util.TableNAT, sep2, dnat(sep2, "10.1.0.2")},
+			},
+		},
+		{
+			name: "node port with rate limit",
+			mutate: func(svc *localnetv1.Service) {
+				svc.Type = "NodePort"
+				svc.Ports[0].NodePort = 30080
+				svc.Annotations = map[string]string{
+					localnetv1.NodePortRateLimitAnnotation:      "100",
+					localnetv1.NodePortRateLimitBurstAnnotation: "20",
+				}
+			},
+			chains: []string{sep1, sep2, svcChain},
+			rules: []chainRules{
+				{util.TableNAT, "KUBE-NODEPORTS", []string{
+					"-A KUBE-NODEPORTS -m comment --comment default/web:http -m tcp -p tcp --dport 30080 -m hashlimit --hashlimit-above 100/sec --hashlimit-burst 20 --hashlimit-name KUBE-NP[default/web:http] -j KUBE-MARK-DROP",
+					"-A KUBE-NODEPORTS -m comment --comment default/web:http -m tcp -p tcp --dport 30080 -j " + svcChain,
+				}},
+			},
+		},
+		{
+			name: "load balancer with source ranges",
+			mutate: func(svc *localnetv1.Service) {
+				svc.Type = "LoadBalancer"
+				svc.IPs.LoadBalancerIPs = localnetv1.NewIPSet("203.0.113.10")
+				// the node IP is in the second range
+				svc.IPFilters = []*localnetv1.IPFilter{{SourceRanges: []string{"198.51.100.0/24", "192.168.0.0/24"}}}
+			},
+			chains: []string{fwChain, sep1, sep2, svcChain},
+			rules: []chainRules{
+				{util.TableNAT, "KUBE-SERVICES", []string{
+					clusterIPJump,
+					`-A KUBE-SERVICES -m comment --comment "default/web:http loadbalancer IP" -m tcp -p tcp -d 203.0.113.10/32 --dport 80 -j ` + fwChain,
+					nodePortsJump,
+				}},
+				{util.TableNAT, fwChain, []string{
+					`-A ` + fwChain + ` -m comment --comment "default/web:http loadbalancer IP" -j KUBE-MARK-MASQ`,
+					`-A ` + fwChain + ` -m comment --comment "default/web:http loadbalancer IP" -s 198.51.100.0/24 -j ` + svcChain,
+					`-A ` + fwChain + ` -m comment --comment "default/web:http loadbalancer IP" -s 192.168.0.0/24 -j ` + svcChain,
+					`-A ` + fwChain + ` -m comment --comment "default/web:http loadbalancer IP" -s 203.0.113.10 -j ` + svcChain,
+					`-A ` + fwChain + ` -m comment --comment "default/web:http loadbalancer IP" -j KUBE-MARK-DROP`,
+				}},
+				{util.TableNAT, svcChain, balancing},
+				{util.TableNAT, sep1, dnat(sep1, "10.1.0.1")},
+				{util.TableNAT, sep2, dnat(sep2, "10.1.0.2")},
+			},
+		},
+		{
+			name: "session affinity",
+			mutate: func(svc *localnetv1.Service) {
+				svc.SessionAffinity = &localnetv1.Service_ClientIP{ClientIP: &localnetv1.ClientIPAffinity{TimeoutSeconds: 10800}}
+			},
+			chains: []string{sep1, sep2, svcChain},
+			rules: []chainRules{
+				{util.TableNAT, "KUBE-SERVICES", []string{clusterIPJump, nodePortsJump}},
+				{util.TableNAT, svcChain, append([]string{
+					"-A " + svcChain + " -m comment --comment default/web:http -m recent --name " + sep1 + " --rcheck --seconds 10800 --reap -j " + sep1,
+					"-A " + svcChain + " -m comment --comment default/web:http -m recent --name " + sep2 + " --rcheck --seconds 10800 --reap -j " + sep2,
+				}, balancing...)},
+				{util.TableNAT, sep1, []string{
+					"-A " + sep1 + " -m comment --comment default/web:http -s 10.1.0.1/32 -j KUBE-MARK-MASQ",
+					"-A " + sep1 + " -m comment --comment default/web:http -m recent --name " + sep1 + " --set -m tcp -p tcp -j DNAT --to-destination 10.1.0.1:8080",
+				}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rt := newRuleTest(t)
+			rt.sync(ruleTestService(tc.mutate), ruleTestEndpoint("10.1.0.2"), ruleTestEndpoint("10.1.0.1"))
+
+			rt.expectChains(tc.chains...)
+			for _, r := range tc.rules {
+				rt.expectRules(r.table, r.chain, r.rules...)
+			}
+
+			// the endpoints are reachable: nothing is rejected
+			rt.expectRules(util.TableFilter, "KUBE-SERVICES")
+			rt.expectRules(util.TableFilter, "KUBE-EXTERNAL-SERVICES")
+		})
+	}
+}
+
+func TestRulesStaleEndpointChain(t *testing.T) {
+	const (
+		sep1 = "KUBE-SEP[default/web:http@10.1.0.1]"
+		sep2 = "KUBE-SEP[default/web:http@10.1.0.2]"
+		svc  = "KUBE-SVC[default/web:http]"
+	)
+
+	rt := newRuleTest(t)
+	web := ruleTestService(nil)
+
+	rt.sync(web, ruleTestEndpoint("10.1.0.1"), ruleTestEndpoint("10.1.0.2"))
+	rt.expectChains(sep1, sep2, svc)
+
+	// the chain of the removed endpoint is kept for a sync, for the packets already jumping to it
+	rt.ipt.endpointsChanges.EndpointUpdate("default", "web", "10.1.0.2", nil)
+	rt.sync(nil)
+	rt.expectChains(sep1, sep2, svc)
+	rt.expectRules(util.TableNAT, svc, "-A "+svc+" -m comment --comment default/web:http -j "+sep1)
+
+	rt.sync(nil)
+	rt.expectChains(sep1, svc)
+}
@@ -19,8 +19,13 @@ package iptables
 import (
 	"fmt"
 	"net"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/cespare/xxhash"
+	"google.golang.org/protobuf/proto"
+
 	"sigs.k8s.io/kpng/backends/iptables/util"
 
 	v1 "k8s.io/api/core/v1"
@@ -41,6 +46,7 @@ import (
 type BaseServiceInfo struct {
 	clusterIP                net.IP
 	port                     int
+	endPort                  int
 	protocol                 localnetv1.Protocol
 	nodePort                 int
 	loadBalancerIPs          []string
@@ -56,6 +62,8 @@ type BaseServiceInfo struct {
 	targetPort               int
 	targetPortName           string
 	portName                 string
+	forceMasquerade          bool
+	nodePortRateLimit        *localnetv1.NodePortRateLimit
 }
 
 // SessionAffinity contains data about assinged session affinity
@@ -80,6 +88,28 @@ func (info *BaseServiceInfo) Port() int {
 	return info.port
 }
 
+// EndPort is part of ServicePort interface.
+func (info *BaseServiceInfo) EndPort() int {
+	return info.endPort
+}
+
+// dport returns the destination port match of the service port, a range if it's one (ie: "10000:10999").
+func (info *BaseServiceInfo) dport() string {
+	if info.endPort == 0 {
+		return strconv.Itoa(info.port)
+	}
+	return strconv.Itoa(info.port) + ":" + strconv.Itoa(info.endPort)
+}
+
+// dnatPort returns the endpoint port of the DNAT to the target port, a shifted range if the service port is one
+// (ie: "20000-20999/10000" maps 10000 to 20000, 10001 to 20001...).
+func (info *BaseServiceInfo) dnatPort(targetPort int) string {
+	if info.endPort == 0 {
+		return strconv.Itoa(targetPort)
+	}
+	return fmt.Sprintf("%d-%d/%d", targetPort, targetPort+info.endPort-info.port, info.port)
+}
+
 // Port is part of ServicePort interface.
 func (info *BaseServiceInfo) TargetPort() int {
 	return info.targetPort
@@ -148,6 +178,16 @@ func (info *BaseServiceInfo) InternalTrafficPolicy() *v1.ServiceInternalTrafficP
 	return info.internalTrafficPolicy
 }
 
+// ForceMasquerade is part of ServicePort interface.
+func (info *BaseServiceInfo) ForceMasquerade() bool {
+	return info.forceMasquerade
+}
+
+// NodePortRateLimit is part of ServicePort interface.
+func (info *BaseServiceInfo) NodePortRateLimit() *localnetv1.NodePortRateLimit {
+	return info.nodePortRateLimit
+}
+
 // HintsAnnotation is part of ServicePort interface.
 func (info *BaseServiceInfo) HintsAnnotation() string {
 	return info.hintsAnnotation
@@ -158,28 +198,30 @@ func (sct *ServiceChangeTracker) newBaseServiceInfo(port *localnetv1.PortMapping
 	if RequestsOnlyLocalTraffic(service) {
 		nodeLocalExternal = true
 	}
-	nodeLocalInternal := false
-	//TODO : CHECK InternalTrafficPolicy
-	// if utilfeature.DefaultFeatureGate.Enabled(features.ServiceInternalTrafficPolicy) {
-	// 	nodeLocalInternal = apiservice.RequestsOnlyLocalTrafficForInternal(service)
-	// }
+	internalTrafficPolicy := v1.ServiceInternalTrafficPolicyType(service.InternalTrafficPolicy)
+	nodeLocalInternal := internalTrafficPolicy == v1.ServiceInternalTrafficPolicyLocal
+
+	// an invalid limit is reported by serviceToServiceMap, and not applied
+	nodePortRateLimit, _ := service.GetNodePortRateLimit()
 
 	clusterIP := GetClusterIPByFamily(sct.ipFamily, service)
 	info := &BaseServiceInfo{
-		clusterIP:         net.ParseIP(clusterIP),
-		port:              int(port.Port),
-		portName:          port.Name,
-		targetPort:        int(port.TargetPort),
-		targetPortName:    port.TargetPortName,
-		protocol:          port.Protocol,
-		nodePort:          int(port.NodePort),
-		nodeLocalExternal: nodeLocalExternal,
-		nodeLocalInternal: nodeLocalInternal,
-		// internalTrafficPolicy: service.Spec.InternalTrafficPolicy, //TODO : CHECK InternalTrafficPolicy
+		clusterIP:                net.ParseIP(clusterIP),
+		port:                     int(port.Port),
+		portName:                 port.Name,
+		targetPort:               int(port.TargetPort),
+		targetPortName:           port.TargetPortName,
+		protocol:                 port.Protocol,
+		nodePort:                 int(port.NodePort),
+		nodeLocalExternal:        nodeLocalExternal,
+		nodeLocalInternal:        nodeLocalInternal,
+		internalTrafficPolicy:    &internalTrafficPolicy,
 		hintsAnnotation:          service.Annotations[v1.AnnotationTopologyAwareHints],
 		loadBalancerSourceRanges: getLoadbalancerSourceRanges(service.IPFilters),
 		loadBalancerIPs:          getLoadBalancerIPs(service.IPs.LoadBalancerIPs, sct.ipFamily),
 		sessionAffinity:          getSessionAffinity(service.SessionAffinity),
+		forceMasquerade:          service.ForceMasquerade,
+		nodePortRateLimit:        nodePortRateLimit,
 	}
 
 	// filter external ips, source ranges and ingress ips
@@ -187,7 +229,7 @@ func (sct *ServiceChangeTracker) newBaseServiceInfo(port *localnetv1.PortMapping
 	// services, this is actually expected. Hence we downgraded from reporting by events
 	// to just log lines with high verbosity
 
-	ipFamilyMap := MapIPsByIPFamily(service.IPs.ExternalIPs)
+	ipFamilyMap := MapIPsByIPFamily(service.GetIPs().GetExternalIPs())
 	info.externalIPs = ipFamilyMap[sct.ipFamily]
 
 	// Log the IPs not matching the ipFamily
@@ -195,15 +237,14 @@ func (sct *ServiceChangeTracker) newBaseServiceInfo(port *localnetv1.PortMapping
 		klog.V(4).Infof("service change tracker(%v) ignored the following external IPs(%s) for service %v/%v as they don't match IPFamily", sct.ipFamily, strings.Join(ips, ","), service.Namespace, service.Name)
 	}
 
-	//TODO : CHECK service.Spec.HealthCheckNodePort
-	// if apiservice.NeedsHealthCheck(service) {
-	// 	p := service.Spec.HealthCheckNodePort
-	// 	if p == 0 {
-	// 		klog.Errorf("Service %s/%s has no healthcheck nodeport", service.Namespace, service.Name)
-	// 	} else {
-	// 		info.healthCheckNodePort = int(p)
-	// 	}
-	// }
+	if NeedsHealthCheck(service) {
+		p := service.HealthCheckNodePort
+		if p == 0 {
+			klog.Errorf("Service %s/%s has no healthcheck nodeport", service.Namespace, service.Name)
+		} else {
+			info.healthCheckNodePort = int(p)
+		}
+	}
 
 	return info
 }
@@ -257,6 +298,7 @@ func newServiceInfo(port *localnetv1.PortMapping, service *localnetv1.Service, b
 	info.servicePortChainName = servicePortChainName(info.serviceNameString, protocol)
 	info.serviceFirewallChainName = serviceFirewallChainName(info.serviceNameString, protocol)
 	info.serviceLBChainName = serviceLBChainName(info.serviceNameString, protocol)
+	info.serviceRateLimitName = serviceRateLimitName(info.serviceNameString, protocol)
 
 	return info
 }
@@ -283,6 +325,17 @@ type ServiceChangeTracker struct {
 	ipFamily v1.IPFamily
 
 	recorder events.EventRecorder
+
+	// hashes holds the content hash of the last update of each service, so identical updates (ie: resyncs) are
+	// dropped without rebuilding the ServicePorts.
+	hashes map[types.NamespacedName]uint64
+	// hashService and hashBuf are reused to marshal the services being hashed.
+	hashService localnetv1.Service
+	hashBuf     []byte
+
+	// errors holds the ports of the pending changes that couldn't be translated, returned by the next
+	// ServicesSnapshot.Update.
+	errors map[types.NamespacedName][]*ServiceUpdateError
 }
 
 // NewServiceChangeTracker initializes a ServiceChangeTracker
@@ -292,6 +345,8 @@ func NewServiceChangeTracker(makeServiceInfo makeServicePortFunc, ipFamily v1.IP
 		makeServiceInfo: makeServiceInfo,
 		recorder:        recorder,
 		ipFamily:        ipFamily,
+		hashes:          make(map[types.NamespacedName]uint64),
+		errors:          make(map[types.NamespacedName][]*ServiceUpdateError),
 		// processServiceMapChange: processServiceMapChange,
 	}
 }
@@ -309,29 +364,124 @@ func (sct *ServiceChangeTracker) Update(current *localnetv1.Service) bool {
 	if svc == nil {
 		return false
 	}
-	//metrics.ServiceChangesTotal.Inc()
+	ServiceChangesTotal.Inc()
 	namespacedName := types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}
+
+	hash, hashed := sct.serviceHash(svc)
+	if prev, ok := sct.hashes[namespacedName]; hashed && ok && prev == hash {
+		// unchanged since the last update, pending or already applied
+		return len(sct.items) > 0
+	}
+
 	var change *serviceChange
 	var ok bool
 	if change, ok = sct.items[namespacedName]; !ok {
 		change = &serviceChange{}
 		sct.items[namespacedName] = change
 	}
+	delete(sct.errors, namespacedName)
 	*change = sct.serviceToServiceMap(current)
+	if hashed {
+		sct.hashes[namespacedName] = hash
+	} else {
+		delete(sct.hashes, namespacedName)
+	}
 	klog.V(2).Infof("Service %s updated: %d ports", namespacedName, len(*change))
-	//metrics.ServiceChangesPending.Set(float64(len(sct.items)))
+	ServiceChangesPending.Set(float64(len(sct.items)))
 	return len(sct.items) > 0
 }
 
 func (sct *ServiceChangeTracker) Delete(namespace, name string) bool {
-	//metrics.ServiceChangesTotal.Inc()
+	ServiceChangesTotal.Inc()
 	namespacedName := types.NamespacedName{Namespace: namespace, Name: name}
 	sct.items[namespacedName] = nil
+	delete(sct.hashes, namespacedName)
+	delete(sct.errors, namespacedName)
 	klog.V(2).Infof("Service %s updated for delete", namespacedName)
-	//metrics.ServiceChangesPending.Set(float64(len(sct.items)))
+	ServiceChangesPending.Set(float64(len(sct.items)))
 	return len(sct.items) > 0
 }
 
+// PendingChanges returns the names of the services having changes not yet applied, so a backend can skip a sync
+// without changes.
+func (sct *ServiceChangeTracker) PendingChanges() sets.String {
+	pending := sets.NewString()
+	for svcName := range sct.items {
+		pending.Insert(svcName.String())
+	}
+	return pending
+}
+
+// ServiceUpdateError is a service, or a port of a service, left out of the snapshot.
+type ServiceUpdateError struct {
+	Service types.NamespacedName
+	// Port is the name of the port or port range, empty if the whole service is left out
+	Port string
+	Err  error
+}
+
+func (e *ServiceUpdateError) Error() string {
+	if e.Port == "" {
+		return fmt.Sprintf("service %s: %v", e.Service, e.Err)
+	}
+	return fmt.Sprintf("port %q of service %s: %v", e.Port, e.Service, e.Err)
+}
+
+func (e *ServiceUpdateError) Unwrap() error {
+	return e.Err
+}
+
+// serviceHash returns the content hash of the service. It doesn't allocate once the buffer grew to the services'
+// size: the deterministic marshaling sorts the map fields in new slices, so the labels and annotations are hashed
+// entry by entry in an order independent way instead, and the other fields are marshaled from a reused copy of
+// the service. Returns false if the service couldn't be marshaled, in which case it's never considered unchanged.
+func (sct *ServiceChangeTracker) serviceHash(service *localnetv1.Service) (hash uint64, ok bool) {
+	// NOTE: fields added to localnetv1.Service must be added here (see TestServiceHashFields)
+	h := &sct.hashService
+	h.Namespace = service.Namespace
+	h.Name = service.Name
+	h.Type = service.Type
+	h.IPs = service.IPs
+	h.IPFilters = service.IPFilters
+	h.MapIP = service.MapIP
+	h.Ports = service.Ports
+	h.ExternalTrafficToLocal = service.ExternalTrafficToLocal
+	h.SessionAffinity = service.SessionAffinity
+	h.InternalTrafficToLocal = service.InternalTrafficToLocal
+	h.HealthCheckNodePort = service.HealthCheckNodePort
+	h.ExternalTrafficPolicy = service.ExternalTrafficPolicy
+	h.InternalTrafficPolicy = service.InternalTrafficPolicy
+	h.ForceMasquerade = service.ForceMasquerade
+	h.PortRanges = service.PortRanges
+	h.ExternalExposureSuspended = service.ExternalExposureSuspended
+	h.TrafficDistribution = service.TrafficDistribution
+
+	buf, err := proto.MarshalOptions{}.MarshalAppend(sct.hashBuf[:0], h)
+
+	// don't retain the service's messages
+	h.IPs, h.IPFilters, h.Ports, h.SessionAffinity, h.PortRanges = nil, nil, nil, nil, nil
+
+	if err != nil {
+		return 0, false
+	}
+	sct.hashBuf = buf
+
+	hash = xxhash.Sum64(buf)
+	for k, v := range service.Labels {
+		hash ^= mapEntryHash(1, k, v)
+	}
+	for k, v := range service.Annotations {
+		hash ^= mapEntryHash(2, k, v)
+	}
+	return hash, true
+}
+
+// mapEntryHash returns the hash of an entry of a map field, to be combined in an order independent way.
+func mapEntryHash(field uint64, key, value string) uint64 {
+	const prime1, prime2 = 11400714785074694791, 14029467366897019727 // xxhash's primes
+	return (xxhash.Sum64String(key)*prime1^xxhash.Sum64String(value))*prime2 + field
+}
+
 // UpdateServiceMapResult is the updated results after applying service changes.
 type UpdateServiceMapResult struct {
 	// HCServiceNodePorts is a map of Service names to node port numbers which indicate the health of that Service on this Node.
@@ -340,6 +490,8 @@ type UpdateServiceMapResult struct {
 	// UDPStaleClusterIP holds stale (no longer assigned to a Service) Service IPs that had UDP ports.
 	// Callers can use this to abort timeout-waits or clear connection-tracking information.
 	UDPStaleClusterIP sets.String
+	// Errors holds the services and ports of the applied changes left out of the snapshot, ordered by service.
+	Errors []*ServiceUpdateError
 }
 
 // ServiceMap maps a service to its ServicePort.
@@ -348,6 +500,7 @@ type ServicesSnapshot map[types.NamespacedName]serviceChange
 
 func (svcSnap *ServicesSnapshot) Update(changes *ServiceChangeTracker) (result UpdateServiceMapResult) {
 	result.UDPStaleClusterIP = sets.NewString()
+	result.Errors = changes.checkoutErrors()
 	svcSnap.apply(changes, result.UDPStaleClusterIP)
 
 	// TODO: If this will appear to be computationally expensive, consider
@@ -358,6 +511,10 @@ func (svcSnap *ServicesSnapshot) Update(changes *ServiceChangeTracker) (result U
 			svcInfo, ok := svc.(*serviceInfo)
 			if !ok {
 				klog.ErrorS(nil, "Failed to cast serviceInfo", "svcName", svcPortName.String())
+				result.Errors = append(result.Errors, &ServiceUpdateError{
+					Service: svcPortName,
+					Err:     fmt.Errorf("unexpected service port type %T", svc),
+				})
 				continue
 			}
 			if svcInfo.HealthCheckNodePort() != 0 {
@@ -374,7 +531,24 @@ func (svcSnap *ServicesSnapshot) apply(changes *ServiceChangeTracker, UDPStaleCl
 	}
 	// clear changes after applying them to ServiceMap.
 	changes.items = make(map[types.NamespacedName]*serviceChange)
-	//metrics.ServiceChangesPending.Set(0)
+	ServiceChangesPending.Set(0)
+}
+
+// checkoutErrors returns the errors of the pending changes, ordered by service, and forgets them.
+func (sct *ServiceChangeTracker) checkoutErrors() (errors []*ServiceUpdateError) {
+	if len(sct.errors) == 0 {
+		return nil
+	}
+
+	for _, svcErrors := range sct.errors {
+		errors = append(errors, svcErrors...)
+	}
+	sort.SliceStable(errors, func(i, j int) bool {
+		return errors[i].Service.String() < errors[j].Service.String()
+	})
+
+	sct.errors = make(map[types.NamespacedName][]*ServiceUpdateError)
+	return errors
 }
 
 func (svcSnap *ServicesSnapshot) merge(svcName types.NamespacedName, other *serviceChange, UDPStaleClusterIP sets.String) {
@@ -400,6 +574,7 @@ type serviceInfo struct {
 	servicePortChainName     util.Chain
 	serviceFirewallChainName util.Chain
 	serviceLBChainName       util.Chain
+	serviceRateLimitName     string
 }
 
 // serviceToServiceMap translates a single Service object to a ServiceMap.
@@ -415,19 +590,70 @@ func (sct *ServiceChangeTracker) serviceToServiceMap(service *localnetv1.Service
 	}
 	serviceMap := make(serviceChange)
 	svcName := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	if _, err := service.GetNodePortRateLimit(); err != nil {
+		klog.Errorf("not limiting the node ports of service %s: %v", svcName, err)
+		emitNodeWarning(sct.recorder, "InvalidService", "GatherServices", "not limiting the node ports of service %s: %v", svcName, err)
+		sct.errors[svcName] = append(sct.errors[svcName], &ServiceUpdateError{Service: svcName, Err: err})
+	}
 	for i := range service.Ports {
 		servicePort := service.Ports[i]
-		svcPortName := ServicePortName{NamespacedName: svcName, Port: servicePort.Name, Protocol: servicePort.Protocol}
-		baseSvcInfo := sct.newBaseServiceInfo(servicePort, service)
-		if sct.makeServiceInfo != nil {
-			serviceMap[svcPortName] = sct.makeServiceInfo(servicePort, service, baseSvcInfo)
-		} else {
-			serviceMap[svcPortName] = baseSvcInfo
+		if err := validateServicePort(servicePort); err != nil {
+			klog.Errorf("skipping port %q of service %s: %v", servicePort.Name, svcName, err)
+			emitNodeWarning(sct.recorder, "InvalidService", "GatherServices", "skipping port %q of service %s: %v", servicePort.Name, svcName, err)
+			sct.errors[svcName] = append(sct.errors[svcName], &ServiceUpdateError{Service: svcName, Port: servicePort.Name, Err: err})
+			continue
+		}
+		sct.addServicePort(serviceMap, servicePort, service, 0)
+	}
+	for _, portRange := range service.PortRanges {
+		if err := portRange.Validate(); err != nil {
+			klog.Errorf("skipping port range %s of service %s: %v", portRange.Name(), svcName, err)
+			emitNodeWarning(sct.recorder, "InvalidService", "GatherServices", "skipping port range %s of service %s: %v", portRange.Name(), svcName, err)
+			sct.errors[svcName] = append(sct.errors[svcName], &ServiceUpdateError{Service: svcName, Port: portRange.Name(), Err: err})
+			continue
 		}
+		// a port range is a service port DNATed to the shifted range of the endpoints
+		servicePort := &localnetv1.PortMapping{
+			Name:       portRange.Name(),
+			Protocol:   portRange.Protocol,
+			Port:       portRange.Port,
+			TargetPort: portRange.TargetPort,
+		}
+		sct.addServicePort(serviceMap, servicePort, service, int(portRange.EndPort))
 	}
 	return serviceMap
 }
 
+func (sct *ServiceChangeTracker) addServicePort(serviceMap serviceChange, servicePort *localnetv1.PortMapping, service *localnetv1.Service, endPort int) {
+	svcName := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	svcPortName := ServicePortName{NamespacedName: svcName, Port: servicePort.Name, Protocol: servicePort.Protocol}
+	baseSvcInfo := sct.newBaseServiceInfo(servicePort, service)
+	baseSvcInfo.endPort = endPort
+	if sct.makeServiceInfo != nil {
+		serviceMap[svcPortName] = sct.makeServiceInfo(servicePort, service, baseSvcInfo)
+	} else {
+		serviceMap[svcPortName] = baseSvcInfo
+	}
+}
+
+// validateServicePort returns why a service port can't be programmed, if it can't.
+func validateServicePort(port *localnetv1.PortMapping) error {
+	if port.Protocol == localnetv1.Protocol_UnknownProtocol {
+		return fmt.Errorf("unknown protocol")
+	}
+	if port.Port <= 0 || port.Port > 65535 {
+		return fmt.Errorf("invalid port %d", port.Port)
+	}
+	if port.NodePort < 0 || port.NodePort > 65535 {
+		return fmt.Errorf("invalid node port %d", port.NodePort)
+	}
+	if port.TargetPort < 0 || port.TargetPort > 65535 {
+		return fmt.Errorf("invalid target port %d", port.TargetPort)
+	}
+	return nil
+}
+
 func IsServiceIPSet(service *localnetv1.Service) bool {
-	return len(service.IPs.ClusterIPs.V4) > 0 || len(service.IPs.ClusterIPs.V6) > 0
+	clusterIPs := service.GetIPs().GetClusterIPs()
+	return len(clusterIPs.GetV4()) > 0 || len(clusterIPs.GetV6()) > 0
 }
@@ -0,0 +1,401 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	utilnet "k8s.io/utils/net"
+
+	"sigs.k8s.io/kpng/backends/iptables/util"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+)
+
+func TestServiceUpdateUnchanged(t *testing.T) {
+	svcName := types.NamespacedName{Namespace: "default", Name: "web"}
+	newService := func(port int32) *localnetv1.Service {
+		return &localnetv1.Service{
+			Namespace: "default",
+			Name:      "web",
+			Labels:    map[string]string{"app": "web", "tier": "front"},
+			IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.0.0.1"), ExternalIPs: &localnetv1.IPSet{}},
+			Ports:     []*localnetv1.PortMapping{{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: port, TargetPort: 8080}},
+		}
+	}
+
+	svcChanges := NewServiceChangeTracker(newServiceInfo, v1.IPv4Protocol, nil)
+	services := ServicesSnapshot{}
+
+	svcChanges.Update(newService(80))
+	services.Update(svcChanges)
+
+	// an identical update (ie: a resync) is dropped, the applied service is kept
+	if svcChanges.Update(newService(80)) {
+		t.Errorf("expected no pending change for an unchanged service")
+	}
+	if _, pending := svcChanges.items[svcName]; pending {
+		t.Errorf("expected no change recorded for an unchanged service")
+	}
+
+	svc := newService(80)
+	if allocs := testing.AllocsPerRun(100, func() { svcChanges.Update(svc) }); allocs != 0 {
+		t.Errorf("expected no allocation for an unchanged service, got %v", allocs)
+	}
+
+	// a changed service is rebuilt
+	if !svcChanges.Update(newService(81)) {
+		t.Fatalf("expected a pending change for a changed service")
+	}
+	services.Update(svcChanges)
+
+	for _, svcPort := range services[svcName] {
+		if svcPort.Port() != 81 {
+			t.Errorf("expected port 81, got %d", svcPort.Port())
+		}
+	}
+
+	// after a delete, the same service is added again
+	svcChanges.Delete("default", "web")
+	services.Update(svcChanges)
+
+	if !svcChanges.Update(newService(81)) {
+		t.Fatalf("expected a pending change for a re-added service")
+	}
+	services.Update(svcChanges)
+
+	if len(services[svcName]) != 1 {
+		t.Errorf("expected the re-added service in the snapshot, got %v", services[svcName])
+	}
+}
+
+func TestServiceHashFields(t *testing.T) {
+	// serviceHash copies the fields one by one, it must be updated when localnetv1.Service changes
+	fields := (&localnetv1.Service{}).ProtoReflect().Descriptor().Fields()
+	if fields.Len() != 19 {
+		t.Errorf("localnetv1.Service has %d fields, serviceHash must be updated", fields.Len())
+	}
+
+	svcChanges := NewServiceChangeTracker(newServiceInfo, v1.IPv4Protocol, nil)
+
+	hash := func(svc *localnetv1.Service) uint64 {
+		h, ok := svcChanges.serviceHash(svc)
+		if !ok {
+			t.Fatalf("failed to hash %v", svc)
+		}
+		return h
+	}
+
+	base := &localnetv1.Service{Namespace: "default", Name: "web", Labels: map[string]string{"a": "1", "b": "2"}}
+	baseHash := hash(base)
+
+	for i := 0; i < 5; i++ { // maps are iterated in random order
+		if h := hash(&localnetv1.Service{Namespace: "default", Name: "web", Labels: map[string]string{"b": "2", "a": "1"}}); h != baseHash {
+			t.Errorf("expected the same hash for equal services")
+		}
+	}
+
+	for _, svc := range []*localnetv1.Service{
+		{Namespace: "default", Name: "web", Labels: map[string]string{"a": "1", "b": "3"}},
+		{Namespace: "default", Name: "web", Labels: map[string]string{"a": "1"}},
+		{Namespace: "default", Name: "web", Labels: map[string]string{"a": "1"}, Annotations: map[string]string{"b": "2"}},
+		{Namespace: "default", Name: "web", Labels: map[string]string{"a": "1", "b": "2"}, ForceMasquerade: true},
+		{Namespace: "default", Name: "web", Labels: map[string]string{"a": "1", "b": "2"}, PortRanges: []*localnetv1.PortRange{{Port: 10000, EndPort: 10999}}},
+		{Namespace: "default", Name: "web", Labels: map[string]string{"a": "1", "b": "2"}, ExternalExposureSuspended: true},
+	} {
+		if hash(svc) == baseHash {
+			t.Errorf("expected another hash for %v", svc)
+		}
+	}
+
+}
+
+func TestServicePortRange(t *testing.T) {
+	svcName := types.NamespacedName{Namespace: "default", Name: "media"}
+	svcChanges := NewServiceChangeTracker(newServiceInfo, v1.IPv6Protocol, nil)
+
+	serviceMap := svcChanges.serviceToServiceMap(&localnetv1.Service{
+		Namespace: "default",
+		Name:      "media",
+		IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("fd00::10"), ExternalIPs: &localnetv1.IPSet{}},
+		Ports: []*localnetv1.PortMapping{
+			{Name: "sip", Protocol: localnetv1.Protocol_UDP, Port: 5060, TargetPort: 5060},
+		},
+		PortRanges: []*localnetv1.PortRange{
+			{Protocol: localnetv1.Protocol_UDP, Port: 10000, EndPort: 10999, TargetPort: 20000},
+			{Protocol: localnetv1.Protocol_UDP, Port: 11000, EndPort: 10000, TargetPort: 20000}, // invalid
+		},
+	})
+
+	if len(serviceMap) != 2 {
+		t.Fatalf("expected the port and the valid range, got %v", serviceMap)
+	}
+
+	svcInfo := serviceMap[ServicePortName{NamespacedName: svcName, Port: "range-10000-10999", Protocol: localnetv1.Protocol_UDP}].(*serviceInfo)
+
+	ipt := NewIptables()
+	ipt.iptInterface = ipFamilyOnly{protocol: util.ProtocolIPv6}
+
+	endpoints := endpointsInfoByName{
+		"slice-a/ep1": &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("fd00:1::1")},
+	}
+
+	activeNATChains := map[util.Chain]bool{}
+	eps, chains, _, portMap := ipt.createServiceSpecificChains(svcInfo, activeNATChains, map[util.Chain][]byte{}, &endpoints)
+
+	args := make([]string, 0, 64)
+	ipt.writeClusterIPRules(svcInfo, svcName, len(eps) > 0, args)
+	ipt.writeEndpointRules(svcInfo, svcName, chains, eps, &args, portMap)
+
+	natRules := string(ipt.natRules.Bytes())
+	for _, expected := range []string{
+		"-d fd00::10/128 --dport 10000:10999 -j " + string(svcInfo.servicePortChainName),
+		"-j DNAT --to-destination [fd00:1::1]:20000-20999/10000",
+	} {
+		if !strings.Contains(natRules, expected) {
+			t.Errorf("expected %q in the nat rules:\n%s", expected, natRules)
+		}
+	}
+}
+
+func TestServiceUpdateErrors(t *testing.T) {
+	svcName := types.NamespacedName{Namespace: "default", Name: "media"}
+	newService := func(sipPort int32) *localnetv1.Service {
+		return &localnetv1.Service{
+			Namespace: "default",
+			Name:      "media",
+			IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.0.0.10"), ExternalIPs: &localnetv1.IPSet{}},
+			Ports: []*localnetv1.PortMapping{
+				{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 8080},
+				{Name: "sip", Protocol: localnetv1.Protocol_UDP, Port: sipPort, TargetPort: 5060},
+			},
+		}
+	}
+
+	svcChanges := NewServiceChangeTracker(newServiceInfo, v1.IPv4Protocol, nil)
+	services := ServicesSnapshot{}
+
+	if pending := svcChanges.PendingChanges(); pending.Len() != 0 {
+		t.Errorf("expected no pending change, got %v", pending.List())
+	}
+
+	svcChanges.Update(newService(70000))
+
+	if pending := svcChanges.PendingChanges(); !pending.Equal(sets.NewString(svcName.String())) {
+		t.Errorf("expected %s pending, got %v", svcName, pending.List())
+	}
+
+	result := services.Update(svcChanges)
+
+	if len(result.Errors) != 1 {
+		t.Fatalf("expected 1 error, got %v", result.Errors)
+	}
+	if err := result.Errors[0]; err.Service != svcName || err.Port != "sip" {
+		t.Errorf("expected an error on the sip port of %s, got %v", svcName, err)
+	}
+	if len(services[svcName]) != 1 {
+		t.Errorf("expected the valid port in the snapshot, got %v", services[svcName])
+	}
+	if pending := svcChanges.PendingChanges(); pending.Len() != 0 {
+		t.Errorf("expected no pending change after the update, got %v", pending.List())
+	}
+
+	// errors are returned once, and forgotten when the service is fixed
+	svcChanges.Update(newService(70001))
+	svcChanges.Update(newService(5060))
+
+	if result := services.Update(svcChanges); len(result.Errors) != 0 {
+		t.Errorf("expected no error after the fix, got %v", result.Errors)
+	}
+	if len(services[svcName]) != 2 {
+		t.Errorf("expected both ports in the snapshot, got %v", services[svcName])
+	}
+}
+
+func TestIPv6OnlyService(t *testing.T) {
+	svcName := types.NamespacedName{Namespace: "default", Name: "web"}
+	svc := &localnetv1.Service{
+		Namespace: "default",
+		Name:      "web",
+		Type:      string(v1.ServiceTypeNodePort),
+		IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("fd00::10")}, // no external IPs
+		Ports: []*localnetv1.PortMapping{
+			{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, NodePort: 30080, TargetPort: 8080},
+		},
+	}
+
+	if serviceMap := NewServiceChangeTracker(newServiceInfo, v1.IPv4Protocol, nil).serviceToServiceMap(svc); len(serviceMap) != 0 {
+		t.Errorf("expected no IPv4 service port, got %v", serviceMap)
+	}
+
+	serviceMap := NewServiceChangeTracker(newServiceInfo, v1.IPv6Protocol, nil).serviceToServiceMap(svc)
+	if len(serviceMap) != 1 {
+		t.Fatalf("expected the IPv6 service port, got %v", serviceMap)
+	}
+	svcInfo := serviceMap[ServicePortName{NamespacedName: svcName, Port: "http", Protocol: localnetv1.Protocol_TCP}].(*serviceInfo)
+	if len(svcInfo.ExternalIPStrings()) != 0 {
+		t.Errorf("expected no external IP, got %v", svcInfo.ExternalIPStrings())
+	}
+
+	ipt := NewIptables()
+	ipt.iptInterface = ipFamilyOnly{protocol: util.ProtocolIPv6}
+
+	endpoints := endpointsInfoByName{
+		"slice-a/ep1": &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("fd00:1::1")},
+		"slice-a/ep2": &localnetv1.Endpoint{}, // no IPs
+	}
+	eps, _, _, _ := ipt.createServiceSpecificChains(svcInfo, map[util.Chain]bool{}, map[util.Chain][]byte{}, &endpoints)
+	if len(eps) != 1 {
+		t.Fatalf("expected the IPv6 endpoint, got %d endpoints", len(eps))
+	}
+
+	nodeAddresses := FilterNodeAddressesByFamily(sets.NewString(IPv4ZeroCIDR, IPv6ZeroCIDR, "10.0.0.1", "fd00:2::1"), true)
+	if !nodeAddresses.Equal(sets.NewString(IPv6ZeroCIDR, "fd00:2::1")) {
+		t.Fatalf("expected the IPv6 node addresses, got %v", nodeAddresses.List())
+	}
+
+	args := make([]string, 0, 64)
+	ipt.writePostRoutingMasqRules()
+	ipt.writeNodePortsRules(svcInfo, nodeAddresses, svcName, true, utilnet.IPSet{}, nil, args)
+	ipt.writeNodePortJumpRule(sets.NewString(IPv6ZeroCIDR), args)
+
+	natRules := string(ipt.natRules.Bytes())
+	for _, expected := range []string{
+		"-j MASQUERADE",
+		"--dport 30080 -j " + string(svcInfo.servicePortChainName),
+		"-m addrtype --dst-type LOCAL -j " + string(kubeNodePortsChain),
+	} {
+		if !strings.Contains(natRules, expected) {
+			t.Errorf("expected %q in the nat rules:\n%s", expected, natRules)
+		}
+	}
+}
+
+// restoredIPSets records the ipset restore inputs.
+type restoredIPSets struct{ data []string }
+
+func (r *restoredIPSets) Restore(data []byte) error {
+	r.data = append(r.data, string(data))
+	return nil
+}
+
+func (r *restoredIPSets) ListSets() ([]string, error) { return nil, nil }
+
+func TestSourceRangesIPSet(t *testing.T) {
+	defer func(min int) { sourceRangesIPSetMin = min }(sourceRangesIPSetMin)
+	sourceRangesIPSetMin = 2
+
+	svcName := types.NamespacedName{Namespace: "default", Name: "web"}
+	svc := &localnetv1.Service{
+		Namespace: "default",
+		Name:      "web",
+		Type:      string(v1.ServiceTypeLoadBalancer),
+		IPs: &localnetv1.ServiceIPs{
+			ClusterIPs:      localnetv1.NewIPSet("10.96.0.10"),
+			LoadBalancerIPs: localnetv1.NewIPSet("192.0.2.10"),
+		},
+		IPFilters: []*localnetv1.IPFilter{
+			{SourceRanges: []string{"10.0.0.0/8", "172.16.0.0/12", "fd00::/8"}},
+		},
+		Ports: []*localnetv1.PortMapping{
+			{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 8080},
+		},
+	}
+
+	serviceMap := NewServiceChangeTracker(newServiceInfo, v1.IPv4Protocol, nil).serviceToServiceMap(svc)
+	svcInfo := serviceMap[ServicePortName{NamespacedName: svcName, Port: "http", Protocol: localnetv1.Protocol_TCP}].(*serviceInfo)
+
+	ipsets := &restoredIPSets{}
+	ipt := NewIptables()
+	ipt.iptInterface = ipFamilyOnly{protocol: util.ProtocolIPv4}
+	ipt.ipsets = newIPSets(ipsets, false)
+	ipt.activeIPSets = sets.NewString()
+
+	ipt.writeLoadBalancerRules(svcInfo, svcName, true, make([]string, 0, 64))
+	ipt.syncIPSets()
+
+	setName := sourceRangesSetPrefix + portProtoHash(svcInfo.serviceNameString, "tcp")
+
+	natRules := string(ipt.natRules.Bytes())
+	if expected := "-m set --match-set " + setName + " src -j " + string(svcInfo.servicePortChainName); !strings.Contains(natRules, expected) {
+		t.Errorf("expected %q in the nat rules:\n%s", expected, natRules)
+	}
+	if strings.Contains(natRules, "-s 10.0.0.0/8") {
+		t.Errorf("expected the source ranges to be matched by the ipset only:\n%s", natRules)
+	}
+
+	if len(ipsets.data) != 1 {
+		t.Fatalf("expected 1 ipset restore, got %q", ipsets.data)
+	}
+	for _, expected := range []string{
+		"create " + setName + " hash:net family inet\n",
+		"add " + setName + "-v1 10.0.0.0/8\n",
+		"add " + setName + "-v1 172.16.0.0/12\n",
+		"swap " + setName + "-v1 " + setName + "\n",
+	} {
+		if !strings.Contains(ipsets.data[0], expected) {
+			t.Errorf("expected %q in the ipset restore input:\n%s", expected, ipsets.data[0])
+		}
+	}
+	if strings.Contains(ipsets.data[0], "fd00::/8") {
+		t.Errorf("expected only the IPv4 ranges in the ipset:\n%s", ipsets.data[0])
+	}
+}
+
+func TestParseIPFamilies(t *testing.T) {
+	for _, test := range []struct {
+		families []string
+		expected []v1.IPFamily
+	}{
+		{[]string{"ipv4", "ipv6"}, []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}},
+		{[]string{"IPv6"}, []v1.IPFamily{v1.IPv6Protocol}},
+		{nil, nil},
+		{[]string{"ipv6", "ipv6"}, nil},
+		{[]string{"ipv5"}, nil},
+		{[]string{"auto", "ipv4"}, nil},
+	} {
+		parsed, err := parseIPFamilies(test.families)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("%v: expected an error, got %v", test.families, parsed)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.families, err)
+		} else if !reflect.DeepEqual(parsed, test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.families, test.expected, parsed)
+		}
+	}
+
+	// detected in Setup
+	if parsed, err := parseIPFamilies([]string{"auto"}); err != nil || parsed != nil {
+		t.Errorf("auto: expected no family and no error, got %v, %v", parsed, err)
+	}
+
+	if families := MapIPsByIPFamily(localnetv1.NewIPSet("fd00::10")); len(families) != 1 || len(families[v1.IPv6Protocol]) != 1 {
+		t.Errorf("expected only IPv6 IPs, got %v", families)
+	}
+	if families := MapIPsByIPFamily(nil); len(families) != 0 {
+		t.Errorf("expected no IP family, got %v", families)
+	}
+}
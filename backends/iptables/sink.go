@@ -17,83 +17,378 @@ limitations under the License.
 package iptables
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"sync"
 
 	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/codes"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/klog/v2"
 	"k8s.io/utils/exec"
 
 	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/backends/iptables/ipset"
 	"sigs.k8s.io/kpng/backends/iptables/util"
+	"sigs.k8s.io/kpng/client/backendcmd"
 	"sigs.k8s.io/kpng/client/localsink"
 	"sigs.k8s.io/kpng/client/localsink/decoder"
 	"sigs.k8s.io/kpng/client/localsink/filterreset"
 	"sigs.k8s.io/kpng/client/localsink/filterreset/pipe"
 	"sigs.k8s.io/kpng/client/plugins/conntrack"
+	"sigs.k8s.io/kpng/client/syncrunner"
+	"sigs.k8s.io/kpng/client/tracing"
 )
 
 type Backend struct {
 	localsink.Config
+
+	onApplied         func()
+	onServiceFailures func(failures map[string]string)
 }
 
 var wg = sync.WaitGroup{}
+
+// syncLock serializes the syncs and the updates of the change trackers.
+var syncLock = sync.Mutex{}
+
+// synced is true once the first change set was received; before that, rules would be built from a partial state.
+var synced bool
+
+// syncRunner runs the syncs at a bounded frequency (see --sync-period, --min-sync-period and --sync-burst),
+// retrying the failed ones with syncBackoff.
+var syncRunner *syncrunner.BoundedFrequencyRunner
+var syncBackoff *syncrunner.Backoff
+
 var IptablesImpl map[v1.IPFamily]*iptables
 var hostname string
 var _ decoder.Interface = &Backend{}
+var _ backendcmd.StrictReadiness = &Backend{}
+var _ backendcmd.ServiceFailures = &Backend{}
+var _ backendcmd.ObjectCounter = &Backend{}
+var _ backendcmd.Resyncer = &Backend{}
+var _ backendcmd.Cleaner = &Backend{}
 
 func New() *Backend {
 	return &Backend{}
 }
 
 func (s *Backend) Sink() localsink.Sink {
+	if dryRun {
+		// nothing is applied, so there are no stale connections to clear either
+		return filterreset.New(decoder.New(s))
+	}
 	return filterreset.New(pipe.New(decoder.New(s), decoder.New(conntrack.NewSink())))
 }
 
+// OnApplied sets the function called once the rules of all the IP families are applied.
+func (s *Backend) OnApplied(onApplied func()) {
+	s.onApplied = onApplied
+}
+
+// OnServiceFailures sets the function called after each sync with the services quarantined in any IP family.
+func (s *Backend) OnServiceFailures(onServiceFailures func(failures map[string]string)) {
+	s.onServiceFailures = onServiceFailures
+}
+
 func (s *Backend) BindFlags(flags *pflag.FlagSet) {
+	BindFlags(flags)
 }
 
 func (s *Backend) Setup() {
+	if err := validateMasqueradeBit(masqueradeBit); err != nil {
+		klog.Fatal(err)
+	}
+	if err := validateHairpinMode(hairpinMode); err != nil {
+		klog.Fatal(err)
+	}
+	if err := validateNodePortAddresses(nodePortAddresses); err != nil {
+		klog.Fatal(err)
+	}
+	if err := syncConfig.Validate(); err != nil {
+		klog.Fatal(err)
+	}
+	if err := validateExternalIPConflicts(externalIPConflicts); err != nil {
+		klog.Fatal(err)
+	}
+	if err := validateMaxChainRules(maxChainRules); err != nil {
+		klog.Fatal(err)
+	}
+	if err := validateDetectLocalMode(detectLocalMode); err != nil {
+		klog.Fatal(err)
+	}
+	families, err := parseIPFamilies(ipFamilies)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if families == nil {
+		nf, err := detectNodeFamilies(nodeKubeconfig, s.NodeName)
+		if err != nil {
+			klog.Fatal("failed to detect the IP families of the node: ", err)
+		}
+		families = nf.families
+
+		if detectLocalMode == detectLocalClusterCIDR && len(clusterCIDRs) == 0 {
+			// the local pods are in the node's pod CIDRs
+			clusterCIDRs = nf.podCIDRs
+		}
+	}
+
+	if dryRun {
+		// the rules aren't applied, there's no drift to verify
+		verifyPeriod = 0
+	}
+
+	var recorder events.EventRecorder
+	if emitEvents {
+		var err error
+		if recorder, err = newEventRecorder(eventsKubeconfig); err != nil {
+			klog.Fatal("failed to setup events: ", err)
+		}
+	}
+
 	hostname = s.NodeName
 	IptablesImpl = make(map[v1.IPFamily]*iptables)
-	for _, protocol := range []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol} {
+	for _, protocol := range families {
 		iptable := NewIptables()
+		iptable.recorder = recorder
 		iptable.iptInterface = util.NewIPTableExec(exec.New(), util.Protocol(protocol))
+		if dryRun {
+			iptable.iptInterface = dryRunInterface{iptable.iptInterface}
+		}
+		if sourceRangesIPSetMin > 0 {
+			var ipsetInterface ipset.Interface = ipset.New(exec.New())
+			if dryRun {
+				ipsetInterface = dryRunIPSet{util.Protocol(protocol)}
+			}
+			iptable.ipsets = newIPSets(ipsetInterface, protocol == v1.IPv6Protocol)
+		}
+		localDetector, err := newLocalDetector(detectLocalMode, clusterCIDRs, podBridgeInterface, podInterfaceNamePrefix, iptable.iptInterface)
+		if err != nil {
+			klog.Fatalf("failed to setup the %s local traffic detection: %v", protocol, err)
+		}
+		iptable.localDetector = localDetector
 		iptable.serviceChanges = NewServiceChangeTracker(newServiceInfo, protocol, iptable.recorder)
 		iptable.endpointsChanges = NewEndpointChangeTracker(hostname, protocol, iptable.recorder)
 		IptablesImpl[protocol] = iptable
 	}
+
+	syncRunner = syncConfig.NewRunner("iptables-sync-runner", s.runSync)
+	syncBackoff = syncConfig.Backoff()
+	go syncRunner.Loop(context.Background())
+
+	if verifyPeriod > 0 {
+		go wait.Until(s.verify, verifyPeriod, wait.NeverStop)
+	}
+
+	if watchAddresses {
+		if err := watchNodeAddresses(addressesResyncDelay, func() { s.resync("node addresses changed") }); err != nil {
+			klog.Error("failed to watch node addresses, they will be updated with the next change set: ", err)
+		}
+	}
 }
 
 func (s *Backend) Reset() { /* noop, we're wrapped in filterreset */ }
 
 func (s *Backend) Sync() {
+	syncLock.Lock()
+	synced = true
+	syncLock.Unlock()
+
+	syncRunner.Run()
+}
+
+// Resync see backendcmd.Resyncer. Each sync restores all the rules, so it's only a sync without changes, coalesced
+// with the others by the syncRunner.
+func (s *Backend) Resync() {
+	s.resync("resync requested")
+}
+
+// resync rebuilds the rules from the current state, ie: when the node's addresses changed.
+func (s *Backend) resync(reason string) {
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
+	if !synced {
+		return
+	}
+
+	klog.Infof("%s, resyncing", reason)
+	syncRunner.Run()
+}
+
+// Cleanup see backendcmd.Cleaner. The syncs are stopped, so the rules aren't restored by a pending one.
+func (s *Backend) Cleanup() error {
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
+	synced = false
+
+	var errs []string
+	for protocol, impl := range IptablesImpl {
+		if err := impl.cleanup(); err != nil {
+			errs = append(errs, string(protocol)+": "+err.Error())
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// verify resyncs the rules if they drifted from the ones applied by the last sync.
+func (s *Backend) verify() {
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
+	if !synced {
+		return
+	}
+
+	drifted := false
+	for _, impl := range IptablesImpl {
+		if impl.verify() {
+			drifted = true
+		}
+	}
+
+	if drifted {
+		syncRunner.Run()
+	}
+}
+
+// runSync is called by the syncRunner, on change sets, node address changes, periodically and to retry failed syncs.
+func (s *Backend) runSync() {
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
+	if !synced {
+		return
+	}
+
+	if s.onServiceFailures != nil {
+		defer s.reportServiceFailures()
+	}
+
+	if s.syncAll() {
+		syncBackoff.Succeeded()
+
+		// try the quarantined services again once their backoff expires
+		for _, impl := range IptablesImpl {
+			if delay, ok := impl.quarantine.NextRetry(); ok {
+				syncRunner.RetryAfter(delay)
+			}
+		}
+		return
+	}
+
+	if s.isolated() {
+		// the failing services are quarantined, sync the others right away
+		syncRunner.Run()
+		return
+	}
+
+	delay := syncBackoff.Failed()
+	klog.InfoS("Sync failed", "retryingTime", delay)
+	syncRunner.RetryAfter(delay)
+}
+
+// syncAll syncs all the IP families, returning true if the rules of all of them were applied.
+func (s *Backend) syncAll() bool {
+	// traced as part of the last change set received, even when retried or resynced
+	ctx, span := tracing.Tracer().Start(tracing.SyncContext(), "iptables.sync")
+	defer span.End()
+
 	for _, impl := range IptablesImpl {
+		impl.traceCtx = ctx
 		wg.Add(1)
 		go impl.sync()
 	}
 	wg.Wait()
+
+	for _, impl := range IptablesImpl {
+		if !impl.applied {
+			span.SetStatus(codes.Error, "failed to apply the "+string(impl.iptInterface.Protocol())+" rules")
+			return false
+		}
+	}
+
+	if s.onApplied != nil {
+		s.onApplied()
+	}
+	return true
+}
+
+// reportServiceFailures reports the services quarantined in any IP family.
+func (s *Backend) reportServiceFailures() {
+	failures := map[string]string{}
+	for _, impl := range IptablesImpl {
+		for service, err := range impl.quarantinedServices() {
+			failures[service] = err
+		}
+	}
+	s.onServiceFailures(failures)
+}
+
+// ProgrammedObjects see backendcmd.ObjectCounter. The objects are counted by IP family, ie: "ipv4-nat-rules".
+func (s *Backend) ProgrammedObjects() map[string]int {
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
+	objects := map[string]int{}
+	for family, impl := range IptablesImpl {
+		for kind, count := range impl.programmedObjects {
+			objects[strings.ToLower(string(family))+"-"+kind] = count
+		}
+	}
+	return objects
+}
+
+// isolated returns true if all the IP families that failed to apply their rules quarantined the failing service.
+func (s *Backend) isolated() bool {
+	for _, impl := range IptablesImpl {
+		if !impl.applied && !impl.isolated {
+			return false
+		}
+	}
+	return true
 }
 
 func (s *Backend) SetService(svc *localnetv1.Service) {
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
 	for _, impl := range IptablesImpl {
 		impl.serviceChanges.Update(svc)
 	}
 }
 
 func (s *Backend) DeleteService(namespace, name string) {
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
 	for _, impl := range IptablesImpl {
 		impl.serviceChanges.Delete(namespace, name)
 	}
 }
 
 func (s *Backend) SetEndpoint(namespace, serviceName, key string, endpoint *localnetv1.Endpoint) {
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
 	for _, impl := range IptablesImpl {
 		impl.endpointsChanges.EndpointUpdate(namespace, serviceName, key, endpoint)
 	}
-
 }
 
 func (s *Backend) DeleteEndpoint(namespace, serviceName, key string) {
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
 	for _, impl := range IptablesImpl {
 		impl.endpointsChanges.EndpointUpdate(namespace, serviceName, key, nil)
 	}
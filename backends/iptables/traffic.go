@@ -91,3 +91,104 @@ func (d *detectLocalByCIDR) JumpIfNotLocal(args []string, toChain string) []stri
 	klog.V(4).Info("[DetectLocalByCIDR (", d.cidr, ")]", " Jump Not Local: ", line)
 	return line
 }
+
+type detectLocalByBridgeInterface struct {
+	ifaceName string
+}
+
+// NewDetectLocalByBridgeInterface implements the LocalTrafficDetector interface using a bridge interface name. This
+// can be used when the pods are all connected to a bridge (ie: the CNI bridge plugin), whatever their IPs.
+func NewDetectLocalByBridgeInterface(interfaceName string) (LocalTrafficDetector, error) {
+	if len(interfaceName) == 0 {
+		return nil, fmt.Errorf("no bridge interface name set")
+	}
+	return &detectLocalByBridgeInterface{ifaceName: interfaceName}, nil
+}
+
+func (d *detectLocalByBridgeInterface) IsImplemented() bool {
+	return true
+}
+
+func (d *detectLocalByBridgeInterface) JumpIfLocal(args []string, toChain string) []string {
+	line := append(args, "-i", d.ifaceName, "-j", toChain)
+	klog.V(4).Info("[DetectLocalByBridgeInterface (", d.ifaceName, ")", " Jump Local: ", line)
+	return line
+}
+
+func (d *detectLocalByBridgeInterface) JumpIfNotLocal(args []string, toChain string) []string {
+	line := append(args, "!", "-i", d.ifaceName, "-j", toChain)
+	klog.V(4).Info("[DetectLocalByBridgeInterface (", d.ifaceName, ")]", " Jump Not Local: ", line)
+	return line
+}
+
+type detectLocalByInterfaceNamePrefix struct {
+	ifacePrefix string
+}
+
+// NewDetectLocalByInterfaceNamePrefix implements the LocalTrafficDetector interface using a prefix of the name of the
+// pods' interfaces on the node. This can be used when the pods have an interface each (ie: veths named "cali*"
+// with Calico), whatever their IPs.
+func NewDetectLocalByInterfaceNamePrefix(interfacePrefix string) (LocalTrafficDetector, error) {
+	if len(interfacePrefix) == 0 {
+		return nil, fmt.Errorf("no interface name prefix set")
+	}
+	return &detectLocalByInterfaceNamePrefix{ifacePrefix: interfacePrefix}, nil
+}
+
+func (d *detectLocalByInterfaceNamePrefix) IsImplemented() bool {
+	return true
+}
+
+func (d *detectLocalByInterfaceNamePrefix) JumpIfLocal(args []string, toChain string) []string {
+	line := append(args, "-i", d.ifacePrefix+"+", "-j", toChain)
+	klog.V(4).Info("[DetectLocalByInterfaceNamePrefix (", d.ifacePrefix, ")", " Jump Local: ", line)
+	return line
+}
+
+func (d *detectLocalByInterfaceNamePrefix) JumpIfNotLocal(args []string, toChain string) []string {
+	line := append(args, "!", "-i", d.ifacePrefix+"+", "-j", toChain)
+	klog.V(4).Info("[DetectLocalByInterfaceNamePrefix (", d.ifacePrefix, ")]", " Jump Not Local: ", line)
+	return line
+}
+
+const (
+	// detectLocalNone doesn't detect the local traffic, so it's not masqueraded based on its origin.
+	detectLocalNone = ""
+	// detectLocalClusterCIDR detects the local traffic by its source IP, in --cluster-cidr.
+	detectLocalClusterCIDR = "ClusterCIDR"
+	// detectLocalBridgeInterface detects the local traffic by its input interface, --pod-bridge-interface.
+	detectLocalBridgeInterface = "BridgeInterface"
+	// detectLocalInterfaceNamePrefix detects the local traffic by its input interface, named --pod-interface-name-prefix*.
+	detectLocalInterfaceNamePrefix = "InterfaceNamePrefix"
+)
+
+func validateDetectLocalMode(mode string) error {
+	switch mode {
+	case detectLocalNone, detectLocalClusterCIDR, detectLocalBridgeInterface, detectLocalInterfaceNamePrefix:
+		return nil
+	}
+	return fmt.Errorf("detect-local-mode must be %q, %q or %q (or empty), got %q",
+		detectLocalClusterCIDR, detectLocalBridgeInterface, detectLocalInterfaceNamePrefix, mode)
+}
+
+// newLocalDetector returns the LocalTrafficDetector of the given mode for the IP family of ipt.
+func newLocalDetector(mode string, clusterCIDRs []string, bridgeInterface, interfacePrefix string, ipt utiliptables.Interface) (LocalTrafficDetector, error) {
+	switch mode {
+	case detectLocalClusterCIDR:
+		for _, cidr := range clusterCIDRs {
+			if utilnet.IsIPv6CIDRString(cidr) == ipt.IsIPv6() {
+				return NewDetectLocalByCIDR(cidr, ipt)
+			}
+		}
+		klog.Warningf("no %s cluster CIDR in %v, local traffic won't be detected for this family", ipt.Protocol(), clusterCIDRs)
+		return NewNoOpLocalDetector(), nil
+
+	case detectLocalBridgeInterface:
+		return NewDetectLocalByBridgeInterface(bridgeInterface)
+
+	case detectLocalInterfaceNamePrefix:
+		return NewDetectLocalByInterfaceNamePrefix(interfacePrefix)
+	}
+
+	return NewNoOpLocalDetector(), nil
+}
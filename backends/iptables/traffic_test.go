@@ -0,0 +1,85 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iptables
+
+import (
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/kpng/backends/iptables/util"
+)
+
+// ipFamilyOnly is an iptables interface only knowing its IP family.
+type ipFamilyOnly struct {
+	util.Interface
+	protocol util.Protocol
+}
+
+func (i ipFamilyOnly) IsIPv6() bool            { return i.protocol == util.ProtocolIPv6 }
+func (i ipFamilyOnly) Protocol() util.Protocol { return i.protocol }
+
+func TestLocalDetectors(t *testing.T) {
+	ipv4 := ipFamilyOnly{protocol: util.ProtocolIPv4}
+	ipv6 := ipFamilyOnly{protocol: util.ProtocolIPv6}
+	cidrs := []string{"10.244.0.0/16", "fd00:10:244::/64"}
+
+	for _, test := range []struct {
+		mode            string
+		ipt             util.Interface
+		local, notLocal string
+	}{
+		{detectLocalNone, ipv4, "", ""},
+		{detectLocalClusterCIDR, ipv4, "-s 10.244.0.0/16 -j X", "! -s 10.244.0.0/16 -j X"},
+		{detectLocalClusterCIDR, ipv6, "-s fd00:10:244::/64 -j X", "! -s fd00:10:244::/64 -j X"},
+		{detectLocalBridgeInterface, ipv4, "-i cni0 -j X", "! -i cni0 -j X"},
+		{detectLocalInterfaceNamePrefix, ipv6, "-i cali+ -j X", "! -i cali+ -j X"},
+	} {
+		detector, err := newLocalDetector(test.mode, cidrs, "cni0", "cali", test.ipt)
+		if err != nil {
+			t.Errorf("mode %q: %v", test.mode, err)
+			continue
+		}
+
+		if detector.IsImplemented() != (test.local != "") {
+			t.Errorf("mode %q: expected implemented=%v", test.mode, test.local != "")
+			continue
+		}
+		if !detector.IsImplemented() {
+			continue
+		}
+
+		if local := strings.Join(detector.JumpIfLocal(nil, "X"), " "); local != test.local {
+			t.Errorf("mode %q: expected local jump %q, got %q", test.mode, test.local, local)
+		}
+		if notLocal := strings.Join(detector.JumpIfNotLocal(nil, "X"), " "); notLocal != test.notLocal {
+			t.Errorf("mode %q: expected not local jump %q, got %q", test.mode, test.notLocal, notLocal)
+		}
+	}
+
+	// no CIDR for the family: local traffic not detected
+	if detector, err := newLocalDetector(detectLocalClusterCIDR, cidrs[:1], "", "", ipv6); err != nil || detector.IsImplemented() {
+		t.Errorf("expected no IPv6 detection without an IPv6 cluster CIDR, got %v, %v", detector, err)
+	}
+
+	if _, err := newLocalDetector(detectLocalBridgeInterface, nil, "", "", ipv4); err == nil {
+		t.Error("expected an error without bridge interface")
+	}
+
+	if err := validateDetectLocalMode("PodCIDR"); err == nil {
+		t.Error("expected an unknown mode to be rejected")
+	}
+}
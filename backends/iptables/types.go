@@ -54,6 +54,8 @@ type ServicePort interface {
 	ClusterIP() net.IP
 	// GetPort returns service port if present. If return 0 means not present.
 	Port() int
+	// EndPort returns the last port of the service port range, or 0 if it's not a range.
+	EndPort() int
 	// GetSessionAffinityType returns service session affinity type
 	SessionAffinity() SessionAffinity
 	// ExternalIPStrings returns service ExternalIPs as a string array.
@@ -76,6 +78,10 @@ type ServicePort interface {
 	InternalTrafficPolicy() *v1.ServiceInternalTrafficPolicyType
 	// HintsAnnotation returns the value of the v1.AnnotationTopologyAwareHints annotation.
 	HintsAnnotation() string
+	// ForceMasquerade returns if all the traffic to the service must be SNATed.
+	ForceMasquerade() bool
+	// NodePortRateLimit returns the max rate of new connections to the node port (nil if not limited).
+	NodePortRateLimit() *localnetv1.NodePortRateLimit
 }
 
 // Endpoint in an interface which abstracts information about an endpoint.
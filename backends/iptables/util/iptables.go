@@ -21,6 +21,7 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -429,11 +430,49 @@ func (runner *runner) restoreInternal(args []string, data []byte, flush FlushFla
 	cmd.SetStdin(bytes.NewBuffer(data))
 	b, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("%v (%s)", err, b)
+		return &RestoreError{err: err, output: b, line: restoreErrorLine(b)}
 	}
 	return nil
 }
 
+// RestoreError is returned by Restore and RestoreAll when iptables-restore fails.
+type RestoreError struct {
+	err    error
+	output []byte
+	line   int
+}
+
+func (e *RestoreError) Error() string {
+	return fmt.Sprintf("%v (%s)", e.err, e.output)
+}
+
+func (e *RestoreError) Unwrap() error {
+	return e.err
+}
+
+// Line returns the line of the restored data iptables-restore failed at (starting at 1), or 0 if unknown.
+func (e *RestoreError) Line() int {
+	return e.line
+}
+
+// restoreErrorLineRegexps match the failed line in the output of the legacy and nft iptables-restore.
+var restoreErrorLineRegexps = []*regexp.Regexp{
+	regexp.MustCompile(`line (\d+) failed`),
+	regexp.MustCompile(`Error occurred at line: (\d+)`),
+}
+
+func restoreErrorLine(output []byte) int {
+	for _, re := range restoreErrorLineRegexps {
+		if m := re.FindSubmatch(output); m != nil {
+			line, err := strconv.Atoi(string(m[1]))
+			if err == nil {
+				return line
+			}
+		}
+	}
+	return 0
+}
+
 func iptablesSaveCommand(protocol Protocol) string {
 	if protocol == ProtocolIPv6 {
 		return cmdIP6TablesSave
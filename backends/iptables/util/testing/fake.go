@@ -0,0 +1,380 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package testing provides a fake util.Interface, keeping the tables in memory, for the tests of the rules
+// generation.
+package testing
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/kpng/backends/iptables/util"
+)
+
+// FakeIPTables is a util.Interface keeping the tables in memory. The restores are applied like iptables-restore
+// would (the chains declared are created or flushed, the rules appended and the "-X" chains deleted) and recorded,
+// and SaveInto prints the tables like iptables-save, so consecutive syncs see the chains of the previous ones.
+type FakeIPTables struct {
+	protocol util.Protocol
+
+	// RandomFully is returned by HasRandomFully.
+	RandomFully bool
+
+	mu       sync.Mutex
+	tables   map[util.Table]*table
+	restores []string
+}
+
+type table struct {
+	// chains holds the rules of each chain, as "-A CHAIN args..." lines
+	chains map[util.Chain][]string
+}
+
+var builtinChains = map[util.Table][]util.Chain{
+	util.TableFilter: {util.ChainInput, util.ChainForward, util.ChainOutput},
+	util.TableNAT:    {util.ChainPrerouting, util.ChainInput, util.ChainOutput, util.ChainPostrouting},
+	util.TableMangle: {util.ChainPrerouting, util.ChainInput, util.ChainForward, util.ChainOutput, util.ChainPostrouting},
+}
+
+// New returns a fake of the protocol's iptables, with only the built-in chains.
+func New(protocol util.Protocol) *FakeIPTables {
+	f := &FakeIPTables{
+		protocol: protocol,
+		tables:   map[util.Table]*table{},
+	}
+	for name, chains := range builtinChains {
+		t := &table{chains: map[util.Chain][]string{}}
+		for _, chain := range chains {
+			t.chains[chain] = nil
+		}
+		f.tables[name] = t
+	}
+	return f
+}
+
+// NewIPv4 returns a fake iptables.
+func NewIPv4() *FakeIPTables {
+	return New(util.ProtocolIPv4)
+}
+
+// NewIPv6 returns a fake ip6tables.
+func NewIPv6() *FakeIPTables {
+	return New(util.ProtocolIPv6)
+}
+
+var _ util.Interface = &FakeIPTables{}
+
+func (f *FakeIPTables) table(name util.Table) (*table, error) {
+	t, ok := f.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown table %q", name)
+	}
+	return t, nil
+}
+
+func ruleLine(chain util.Chain, args []string) string {
+	return strings.Join(append([]string{"-A", string(chain)}, args...), " ")
+}
+
+func (f *FakeIPTables) EnsureChain(tableName util.Table, chain util.Chain) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, err := f.table(tableName)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := t.chains[chain]; ok {
+		return true, nil
+	}
+	t.chains[chain] = nil
+	return false, nil
+}
+
+func (f *FakeIPTables) FlushChain(tableName util.Table, chain util.Chain) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, err := f.table(tableName)
+	if err != nil {
+		return err
+	}
+	if _, ok := t.chains[chain]; !ok {
+		return fmt.Errorf("chain %s doesn't exist in table %s", chain, tableName)
+	}
+	t.chains[chain] = nil
+	return nil
+}
+
+func (f *FakeIPTables) DeleteChain(tableName util.Table, chain util.Chain) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, err := f.table(tableName)
+	if err != nil {
+		return err
+	}
+	if _, ok := t.chains[chain]; !ok {
+		return fmt.Errorf("chain %s doesn't exist in table %s", chain, tableName)
+	}
+	delete(t.chains, chain)
+	return nil
+}
+
+func (f *FakeIPTables) ChainExists(tableName util.Table, chain util.Chain) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, err := f.table(tableName)
+	if err != nil {
+		return false, err
+	}
+	_, ok := t.chains[chain]
+	return ok, nil
+}
+
+func (f *FakeIPTables) EnsureRule(position util.RulePosition, tableName util.Table, chain util.Chain, args ...string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, err := f.table(tableName)
+	if err != nil {
+		return false, err
+	}
+	rules, ok := t.chains[chain]
+	if !ok {
+		return false, fmt.Errorf("chain %s doesn't exist in table %s", chain, tableName)
+	}
+
+	rule := ruleLine(chain, args)
+	for _, existing := range rules {
+		if existing == rule {
+			return true, nil
+		}
+	}
+
+	if position == util.Prepend {
+		t.chains[chain] = append([]string{rule}, rules...)
+	} else {
+		t.chains[chain] = append(rules, rule)
+	}
+	return false, nil
+}
+
+func (f *FakeIPTables) DeleteRule(tableName util.Table, chain util.Chain, args ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, err := f.table(tableName)
+	if err != nil {
+		return err
+	}
+
+	rule := ruleLine(chain, args)
+	rules := t.chains[chain]
+	for i, existing := range rules {
+		if existing == rule {
+			t.chains[chain] = append(rules[:i:i], rules[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (f *FakeIPTables) IsIPv6() bool {
+	return f.protocol == util.ProtocolIPv6
+}
+
+func (f *FakeIPTables) Protocol() util.Protocol {
+	return f.protocol
+}
+
+// SaveInto prints the table like iptables-save, without the counters.
+func (f *FakeIPTables) SaveInto(tableName util.Table, buffer *bytes.Buffer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, err := f.table(tableName)
+	if err != nil {
+		return err
+	}
+
+	chains := t.sortedChains()
+
+	fmt.Fprintf(buffer, "*%s\n", tableName)
+	for _, chain := range chains {
+		buffer.WriteString(util.MakeChainLine(chain) + "\n")
+	}
+	for _, chain := range chains {
+		for _, rule := range t.chains[chain] {
+			buffer.WriteString(rule + "\n")
+		}
+	}
+	buffer.WriteString("COMMIT\n")
+	return nil
+}
+
+func (t *table) sortedChains() []util.Chain {
+	chains := make([]util.Chain, 0, len(t.chains))
+	for chain := range t.chains {
+		chains = append(chains, chain)
+	}
+	sort.Slice(chains, func(i, j int) bool { return chains[i] < chains[j] })
+	return chains
+}
+
+func (f *FakeIPTables) Restore(tableName util.Table, data []byte, flush util.FlushFlag, counters util.RestoreCountersFlag) error {
+	return f.restore(append([]byte(fmt.Sprintf("*%s\n", tableName)), data...), flush)
+}
+
+func (f *FakeIPTables) RestoreAll(data []byte, flush util.FlushFlag, counters util.RestoreCountersFlag) error {
+	return f.restore(data, flush)
+}
+
+// restore applies the restore data. Like iptables-restore, nothing is applied if a line is invalid.
+func (f *FakeIPTables) restore(data []byte, flush util.FlushFlag) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.restores = append(f.restores, string(data))
+
+	// apply on a copy, replacing the tables once all the lines are valid
+	tables := make(map[util.Table]*table, len(f.tables))
+	for name, t := range f.tables {
+		c := &table{chains: make(map[util.Chain][]string, len(t.chains))}
+		for chain, rules := range t.chains {
+			c.chains[chain] = append([]string(nil), rules...)
+		}
+		tables[name] = c
+	}
+
+	var t *table
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("line %d (%q): %s", n+1, line, fmt.Sprintf(format, args...))
+		}
+
+		switch {
+		case line == "" || line[0] == '#':
+			continue
+
+		case line[0] == '*':
+			var ok bool
+			if t, ok = tables[util.Table(line[1:])]; !ok {
+				return fail("unknown table")
+			}
+			if flush == util.FlushTables {
+				for chain := range t.chains {
+					t.chains[chain] = nil
+				}
+			}
+			continue
+
+		case t == nil:
+			return fail("no table")
+
+		case line == "COMMIT":
+			t = nil
+			continue
+
+		case line[0] == ':':
+			// the chain is created, or flushed
+			chain := util.Chain(strings.Fields(line[1:])[0])
+			t.chains[chain] = nil
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return fail("invalid rule")
+		}
+
+		chain := util.Chain(fields[1])
+		rules, ok := t.chains[chain]
+		if !ok {
+			return fail("chain %s doesn't exist", chain)
+		}
+
+		switch fields[0] {
+		case "-A":
+			t.chains[chain] = append(rules, line)
+		case "-I":
+			t.chains[chain] = append([]string{"-A" + strings.TrimPrefix(line, "-I")}, rules...)
+		case "-X":
+			delete(t.chains, chain)
+		case "-F":
+			t.chains[chain] = nil
+		default:
+			return fail("unsupported command %s", fields[0])
+		}
+	}
+
+	if t != nil {
+		return fmt.Errorf("missing COMMIT")
+	}
+
+	f.tables = tables
+	return nil
+}
+
+// Restores returns the data of each restore, in order.
+func (f *FakeIPTables) Restores() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.restores...)
+}
+
+// Chains returns the chains of the table, sorted.
+func (f *FakeIPTables) Chains(tableName util.Table) []util.Chain {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.tables[tableName]
+	if !ok {
+		return nil
+	}
+	return t.sortedChains()
+}
+
+// Rules returns the rules of a chain, as "-A CHAIN args..." lines in order, or nil if the chain doesn't exist.
+func (f *FakeIPTables) Rules(tableName util.Table, chain util.Chain) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.tables[tableName]
+	if !ok {
+		return nil
+	}
+	return append([]string(nil), t.chains[chain]...)
+}
+
+func (f *FakeIPTables) Monitor(canary util.Chain, tables []util.Table, reloadFunc func(), interval time.Duration, stopCh <-chan struct{}) {
+}
+
+func (f *FakeIPTables) HasRandomFully() bool {
+	return f.RandomFully
+}
+
+func (f *FakeIPTables) Present() bool {
+	return true
+}
@@ -22,7 +22,8 @@ import (
 )
 
 type LineBuffer struct {
-	b bytes.Buffer
+	b     bytes.Buffer
+	lines int
 }
 
 // Write takes a list of arguments, each a string or []string, joins all the
@@ -48,18 +49,30 @@ func (buf *LineBuffer) Write(args ...interface{}) {
 		}
 	}
 	buf.b.WriteByte('\n')
+	buf.lines++
 }
 
 // WriteBytes writes bytes to buffer, and terminates with newline.
 func (buf *LineBuffer) WriteBytes(bytes []byte) {
 	buf.b.Write(bytes)
 	buf.b.WriteByte('\n')
+	buf.lines += 1 + countLines(bytes)
 }
 
 func (buf *LineBuffer) Reset() {
 	buf.b.Reset()
+	buf.lines = 0
+}
+
+// Lines returns the number of lines written.
+func (buf *LineBuffer) Lines() int {
+	return buf.lines
 }
 
 func (buf *LineBuffer) Bytes() []byte {
 	return buf.b.Bytes()
 }
+
+func countLines(b []byte) int {
+	return bytes.Count(b, []byte{'\n'})
+}
@@ -1,3 +1,6 @@
+//go:build linux && cgo
+// +build linux,cgo
+
 /*
 Copyright 2021 The Kubernetes Authors.
 
@@ -88,13 +91,23 @@ func (b *BaseServicePortInfo) GetVirtualServer() ipvsLB {
 		NodePort:         uint16(b.nodePort),
 	}
 
+	// ClientIP session affinity is the IPVS persistence of the virtual server: the connections of a client go to the
+	// same real server until the persistence timeout expires.
 	if b.sessionAffinity.ClientIP != nil {
 		vs.Flags |= FlagPersistent
-		vs.Timeout = uint32(b.sessionAffinity.ClientIP.ClientIP.TimeoutSeconds)
+		vs.Timeout = b.persistenceTimeout()
 	}
 	return vs
 }
 
+// persistenceTimeout returns the timeout of the ClientIP session affinity, or the Kubernetes default if not set.
+func (b *BaseServicePortInfo) persistenceTimeout() uint32 {
+	if clientIP := b.sessionAffinity.ClientIP.ClientIP; clientIP != nil && clientIP.TimeoutSeconds > 0 {
+		return uint32(clientIP.TimeoutSeconds)
+	}
+	return uint32(v1.DefaultClientIPServiceAffinitySeconds)
+}
+
 func (b *BaseServicePortInfo) SetSessionAffinity(sa serviceevents.SessionAffinity) {
 	b.sessionAffinity = sa
 }
@@ -0,0 +1,69 @@
+//go:build linux && cgo
+// +build linux,cgo
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvssink
+
+import (
+	"sigs.k8s.io/kpng/client/backendcmd"
+	"sigs.k8s.io/kpng/client/capacity"
+
+	ipsetutil "sigs.k8s.io/kpng/backends/ipvs-as-sink/util"
+)
+
+var _ backendcmd.CapacityEstimator = &Backend{}
+
+// Capacity see backendcmd.CapacityEstimator. IPVS itself has no hard limit on the virtual and real servers, but the
+// ipsets are created with a max number of elements.
+func (s *Backend) Capacity() []capacity.Resource {
+	nodeAddresses := len(s.nodeAddresses)
+	if nodeAddresses == 0 {
+		nodeAddresses = 1
+	}
+
+	return []capacity.Resource{
+		{
+			Name: "ipvs-virtual-servers",
+			Estimate: func(stats capacity.Stats) int {
+				return stats.IPPorts + stats.NodePorts*nodeAddresses
+			},
+		},
+		{
+			Name: "ipvs-real-servers",
+			Estimate: func(stats capacity.Stats) int {
+				return stats.IPPortEndpoints
+			},
+		},
+		{
+			// KUBE-CLUSTER-IP has an entry per service IP and port
+			Name:  "ipset-cluster-ip-entries",
+			Limit: ipsetutil.DefaultMaxElem,
+			Estimate: func(stats capacity.Stats) int {
+				return stats.IPPorts
+			},
+		},
+		{
+			// KUBE-LOOP-BACK has an entry per endpoint and port (for the hairpin traffic)
+			Name:  "ipset-loopback-entries",
+			Limit: ipsetutil.DefaultMaxElem,
+			Estimate: func(stats capacity.Stats) int {
+				return stats.PortEndpoints
+			},
+		},
+	}
+}
@@ -0,0 +1,140 @@
+//go:build linux && cgo
+// +build linux,cgo
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvssink
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/backends/ipvs-as-sink/util"
+	"sigs.k8s.io/kpng/client/backendcmd"
+)
+
+var _ backendcmd.Cleaner = &Backend{}
+
+// Cleanup see backendcmd.Cleaner: the virtual servers, chains and ipsets of each IP family are removed, then the
+// dummy interface with the service IPs.
+func (s *Backend) Cleanup() error {
+	var errs []string
+	for ipFamily, proxier := range s.proxiers {
+		for _, err := range proxier.cleanup() {
+			errs = append(errs, string(ipFamily)+": "+err.Error())
+		}
+	}
+
+	if link := s.dummy.Link(); link != nil {
+		klog.Info("deleting dummy interface ", dummyName)
+		if err := netlink.LinkDel(link); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to delete the dummy interface %s: %v", dummyName, err))
+		}
+	}
+
+	if s.dryRun {
+		if err := s.dryRunState.print(dryRunOutput); err != nil {
+			klog.Error("failed to print the dry run state: ", err)
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// cleanup removes what the proxier programmed: its virtual servers, the jumps to the kube chains and the chains,
+// then the ipsets they matched. The virtual servers of other agents are left untouched.
+func (p *proxier) cleanup() (errs []error) {
+	for _, kv := range p.servicePorts.GetByPrefix(nil) {
+		portInfo := kv.Value.(BaseServicePortInfo)
+		if err := p.ipvs.DeleteService(portInfo.GetVirtualServer().ToService()); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete the virtual server %s: %w", kv.Key, err))
+		}
+	}
+
+	for _, jc := range iptablesJumpChain {
+		args := []string{"-m", "comment", "--comment", jc.comment, "-j", string(jc.to)}
+		if err := p.iptables.DeleteRule(jc.table, jc.from, args...); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete the jump from %s to %s: %w", jc.from, jc.to, err))
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	for _, table := range []util.Table{util.TableNAT, util.TableFilter} {
+		data := cleanupRules(table, p.getExistingChains(buf, table))
+		if data == nil {
+			continue
+		}
+
+		if err := p.iptables.Restore(table, data, util.NoFlushTables, util.RestoreCounters); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete the chains of the %s table: %w", table, err))
+		}
+	}
+
+	for _, set := range p.ipsetList {
+		if err := p.ipset.DestroySet(set.Name); err != nil {
+			errs = append(errs, fmt.Errorf("failed to destroy the ipset %s: %w", set.Name, err))
+		}
+	}
+
+	return
+}
+
+// cleanupRules returns the iptables-restore input flushing and deleting the existing chains of the proxier in the
+// table (nil if none).
+func cleanupRules(table util.Table, existingChains map[util.Chain][]byte) []byte {
+	var chains []string
+	add := func(chainTable util.Table, chain util.Chain) {
+		if _, ok := existingChains[chain]; ok && chainTable == table {
+			chains = append(chains, string(chain))
+		}
+	}
+
+	for _, ch := range iptablesChains {
+		add(ch.table, ch.chain)
+	}
+	for _, ch := range iptablesEnsureChains {
+		add(ch.table, ch.chain)
+	}
+
+	if len(chains) == 0 {
+		return nil
+	}
+	sort.Strings(chains)
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "*%s\n", table)
+
+	// flushed first, as they jump to each other
+	for _, chain := range chains {
+		buf.WriteString(util.MakeChainLine(util.Chain(chain)) + "\n")
+	}
+	for _, chain := range chains {
+		fmt.Fprintf(buf, "-X %s\n", chain)
+	}
+
+	buf.WriteString("COMMIT\n")
+	return buf.Bytes()
+}
@@ -1,3 +1,6 @@
+//go:build linux && cgo
+// +build linux,cgo
+
 /*
 Copyright 2021 The Kubernetes Authors.
 
@@ -21,10 +24,10 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/google/seesaw/ipvs"
 	"sigs.k8s.io/kpng/client/lightdiffstore"
 	"sigs.k8s.io/kpng/client/serviceevents"
 
+	"github.com/google/seesaw/ipvs"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
 	netutils "k8s.io/utils/net"
@@ -65,6 +68,7 @@ type endPointInfo struct {
 	endPointIP      string
 	isLocalEndPoint bool
 	portMap         map[string]int32
+	weight          int32
 }
 
 func asDummyIPs(ip string, ipFamily v1.IPFamily) string {
@@ -195,8 +199,15 @@ func (p *proxier) addRealServerForPort(serviceKey string, portList []*BaseServic
 				Svc: port.GetVirtualServer().ToService(),
 				Dst: ipvsDestination(epInfo, port),
 			}
+			if destination.Dst.Port == 0 {
+				klog.V(2).Infof("ep (%v) has no target port for %v, skipping", epInfo.endPointIP, port)
+				continue
+			}
 			klog.V(2).Infof("adding destination ep (%v)", epInfo.endPointIP)
-			if err := ipvs.AddDestination(destination.Svc, destination.Dst); err != nil && !strings.HasSuffix(err.Error(), "object exists") {
+			if p.gracefulTermination.CancelDeletion(destination.Svc, destination.Dst) {
+				continue
+			}
+			if err := p.addOrUpdateDestination(destination.Svc, destination.Dst); err != nil {
 				klog.Error("failed to add destination ", serviceKey, ": ", err)
 			}
 		}
@@ -216,7 +227,7 @@ func (p *proxier) deleteRealServerForPort(serviceKey string, portList []*BaseSer
 				Dst: ipvsDestination(epInfo, port),
 			}
 			klog.V(2).Infof("deleting destination ep (%v)", epInfo.endPointIP)
-			if err := ipvs.DeleteDestination(destination.Svc, destination.Dst); err != nil && !strings.HasSuffix(err.Error(), "object exists") {
+			if err := p.ipvs.DeleteDestination(destination.Svc, destination.Dst); err != nil && !strings.HasSuffix(err.Error(), "object exists") {
 				klog.Error("failed to delete destination ", serviceKey, ": ", err)
 			}
 		}
@@ -274,7 +285,7 @@ func (p *proxier) addVirtualServer(portInfo *BaseServicePortInfo) {
 	klog.V(2).Infof("adding AddVirtualServer: port: %v", portInfo)
 	// Programme virtual-server directly
 	ipvsSvc := vs.ToService()
-	err := ipvs.AddService(ipvsSvc)
+	err := p.ipvs.AddService(ipvsSvc)
 	if err != nil && !strings.HasSuffix(err.Error(), "object exists") {
 		klog.Error("failed to add service in IPVS", ": ", err)
 	}
@@ -282,7 +293,7 @@ func (p *proxier) addVirtualServer(portInfo *BaseServicePortInfo) {
 
 func (p *proxier) deleteVirtualServer(portInfo *BaseServicePortInfo) {
 	klog.V(2).Infof("deleting service , serviceIP (%v) , port (%v)", portInfo.serviceIP, portInfo.Port())
-	err := ipvs.DeleteService(portInfo.GetVirtualServer().ToService())
+	err := p.ipvs.DeleteService(portInfo.GetVirtualServer().ToService())
 	if err != nil {
 		klog.Error("failed to delete service from IPVS", portInfo.serviceIP, ": ", err)
 	}
@@ -377,37 +388,34 @@ func (s *Backend) disableSessionAffinityForServiceIPs(svc *localnetv1.Service) {
 }
 
 func (p *proxier) enableSessionAffinityForServiceIP(serviceKey string, sa serviceevents.SessionAffinity) {
-	for _, sp := range p.servicePorts.GetByPrefix([]byte(serviceKey)) {
-		portInfo := sp.Value.(BaseServicePortInfo)
-		// Set session affinity for port
+	p.updateSessionAffinityForServiceIP(serviceKey, func(portInfo *BaseServicePortInfo) {
 		portInfo.SetSessionAffinity(sa)
-
-		vs := portInfo.GetVirtualServer()
-		// Programme virtual-server directly
-		ipvsSvc := vs.ToService()
-		err := ipvs.UpdateService(ipvsSvc)
-		if err != nil && !strings.HasSuffix(err.Error(), "object exists") {
-			klog.Error("failed to add service in IPVS", serviceKey, ": ", err)
-		}
-		klog.V(2).Infof("enable sess-aff ipvsSvc: %v", ipvsSvc)
-		p.servicePorts.Set([]byte(serviceKey), 0, portInfo)
-	}
+	})
 }
 
 func (p *proxier) disableSessionAffinityForServiceIP(serviceKey string) {
-	for _, sp := range p.servicePorts.GetByPrefix([]byte(serviceKey)) {
-		portInfo := sp.Value.(BaseServicePortInfo)
+	p.updateSessionAffinityForServiceIP(serviceKey, func(portInfo *BaseServicePortInfo) {
 		portInfo.ResetSessionAffinity()
-		vs := portInfo.GetVirtualServer()
+	})
+}
+
+// updateSessionAffinityForServiceIP applies the session affinity change to each virtual server of the service
+// (cluster IPs, external IPs, node ports and load-balancer IPs), updating the persistence of the ones in IPVS.
+func (p *proxier) updateSessionAffinityForServiceIP(serviceKey string, update func(portInfo *BaseServicePortInfo)) {
+	for _, sp := range p.servicePorts.GetByPrefix([]byte(serviceKey + "/")) {
+		portInfo := sp.Value.(BaseServicePortInfo)
+		update(&portInfo)
 
 		// Programme virtual-server directly
-		ipvsSvc := vs.ToService()
-		err := ipvs.UpdateService(ipvsSvc)
-		if err != nil && !strings.HasSuffix(err.Error(), "object exists") {
-			klog.Error("failed to add service in IPVS", serviceKey, ": ", err)
+		ipvsSvc := portInfo.GetVirtualServer().ToService()
+		if err := p.ipvs.UpdateService(ipvsSvc); err != nil {
+			klog.Error("failed to update service persistence in IPVS ", serviceKey, ": ", err)
 		}
-		klog.V(2).Infof("disable sess-aff : %v", ipvsSvc)
-		p.servicePorts.Set([]byte(serviceKey), 0, portInfo)
+		klog.V(2).Infof("session affinity of %s: flags %v, timeout %d", sp.Key, ipvsSvc.Flags, ipvsSvc.Timeout)
+
+		// the port infos are stored with a zero hash, and Set keeps the value of an unchanged hash
+		p.servicePorts.Delete(sp.Key)
+		p.servicePorts.Set(sp.Key, 0, portInfo)
 	}
 }
 
@@ -416,11 +424,18 @@ func (p *proxier) addRealServer(serviceKey, prefix, endPointIP string, endpoint
 		endPointIP:      endPointIP,
 		isLocalEndPoint: endpoint.Local,
 		portMap:         make(map[string]int32),
+		weight:          endpoint.BalancingWeight(),
 	}
 
+	// the target ports are resolved by the server, the overrides are only used with servers not resolving them
 	for _, port := range endpoint.PortOverrides {
 		epInfo.portMap[port.Name] = port.Port
 	}
+	for _, port := range endpoint.TargetPorts {
+		epInfo.portMap[port.Name] = port.TargetPort
+	}
+	// the endpoint infos are stored with a zero hash, and Set keeps the value of an unchanged hash
+	p.endpoints.Delete([]byte(prefix))
 	p.endpoints.Set([]byte(prefix), 0, epInfo)
 	for _, sp := range p.servicePorts.GetByPrefix([]byte(serviceKey)) {
 		portInfo := sp.Value.(BaseServicePortInfo)
@@ -430,8 +445,15 @@ func (p *proxier) addRealServer(serviceKey, prefix, endPointIP string, endpoint
 			Svc: vs.ToService(),
 			Dst: ipvsDestination(epInfo, &portInfo),
 		}
+		if dest.Dst.Port == 0 {
+			klog.V(2).Infof("ep (%v) has no target port for %v, skipping", endPointIP, portInfo)
+			continue
+		}
 		klog.V(2).Infof("adding destination ep (%v)", endPointIP)
-		if err := ipvs.AddDestination(dest.Svc, dest.Dst); err != nil && !strings.HasSuffix(err.Error(), "object exists") {
+		if p.gracefulTermination.CancelDeletion(dest.Svc, dest.Dst) {
+			continue
+		}
+		if err := p.addOrUpdateDestination(dest.Svc, dest.Dst); err != nil {
 			klog.Error("failed to add destination ", dest, ": ", err)
 		}
 	}
@@ -442,6 +464,16 @@ func (p *proxier) addRealServer(serviceKey, prefix, endPointIP string, endpoint
 	}
 }
 
+// addOrUpdateDestination adds the destination to the virtual server, or updates it if it exists (ie: when the weight
+// of the endpoint changed).
+func (p *proxier) addOrUpdateDestination(svc ipvs.Service, dst ipvs.Destination) error {
+	err := p.ipvs.AddDestination(svc, dst)
+	if err != nil && strings.HasSuffix(err.Error(), "object exists") {
+		return p.ipvs.UpdateDestination(svc, dst)
+	}
+	return err
+}
+
 func (p *proxier) deleteRealServer(serviceKey, prefix string) {
 	for _, kv := range p.endpoints.GetByPrefix([]byte(prefix)) {
 		epInfo := kv.Value.(endPointInfo)
@@ -455,7 +487,7 @@ func (p *proxier) deleteRealServer(serviceKey, prefix string) {
 			}
 
 			klog.V(2).Infof("deleting destination : %v", dest)
-			if err := ipvs.DeleteDestination(dest.Svc, dest.Dst); err != nil {
+			if err := p.gracefulTermination.DeleteDestination(dest.Svc, dest.Dst); err != nil {
 				klog.Error("failed to delete destination ", dest, ": ", err)
 			}
 		}
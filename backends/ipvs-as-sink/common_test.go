@@ -0,0 +1,151 @@
+//go:build linux && cgo
+// +build linux,cgo
+
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvssink
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/google/seesaw/ipvs"
+	"github.com/stretchr/testify/assert"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/lightdiffstore"
+	"sigs.k8s.io/kpng/client/serviceevents"
+)
+
+func TestSessionAffinityPersistence(t *testing.T) {
+	p := &proxier{
+		schedulingMethod: "rr",
+		ipvs:             dryRunIPVS{newDryRunState()},
+		servicePorts:     lightdiffstore.New(),
+	}
+
+	svc := &localnetv1.Service{Namespace: "ns", Name: "svc"}
+	port := &localnetv1.PortMapping{Protocol: localnetv1.Protocol_TCP, Port: 80, NodePort: 30080}
+	serviceKey := getServiceKey(svc)
+
+	// another service sharing the key prefix must not be changed
+	other := &localnetv1.Service{Namespace: "ns", Name: "svc-other"}
+
+	for _, sp := range []struct {
+		svc         *localnetv1.Service
+		ip, svcType string
+	}{
+		{svc, "10.96.0.1", ClusterIPService},
+		{svc, "192.168.0.10", NodePortService},
+		{other, "10.96.0.2", ClusterIPService},
+	} {
+		portInfo := NewBaseServicePortInfo(sp.svc, port, sp.ip, sp.svcType, p.schedulingMethod, p.weight)
+		p.servicePorts.Set([]byte(getServicePortKey(getServiceKey(sp.svc), sp.ip, port)), 0, *portInfo)
+		p.addVirtualServer(portInfo)
+	}
+
+	persistence := func(ip string, port uint16) (bool, uint32) {
+		t.Helper()
+		svc, err := p.ipvs.GetService(&ipvs.Service{Address: net.ParseIP(ip), Port: port, Protocol: syscall.IPPROTO_TCP})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return svc.Flags&ipvs.SFPersistent != 0, svc.Timeout
+	}
+
+	assertPersistence := func(ip string, port uint16, persistent bool, timeout uint32) {
+		t.Helper()
+		gotPersistent, gotTimeout := persistence(ip, port)
+		assert.Equal(t, persistent, gotPersistent, "persistence of %s:%d", ip, port)
+		assert.Equal(t, timeout, gotTimeout, "timeout of %s:%d", ip, port)
+	}
+
+	p.enableSessionAffinityForServiceIP(serviceKey, serviceevents.SessionAffinity{
+		ClientIP: &localnetv1.Service_ClientIP{ClientIP: &localnetv1.ClientIPAffinity{TimeoutSeconds: 60}},
+	})
+
+	assertPersistence("10.96.0.1", 80, true, 60)
+	assertPersistence("192.168.0.10", 30080, true, 60)
+	assertPersistence("10.96.0.2", 80, false, 0)
+
+	// the port infos keep the affinity, for the virtual servers used by the destinations
+	for _, sp := range p.servicePorts.GetByPrefix([]byte(serviceKey + "/")) {
+		portInfo := sp.Value.(BaseServicePortInfo)
+		assert.Equal(t, uint32(60), portInfo.GetVirtualServer().Timeout, "port info %s", sp.Key)
+	}
+	assert.Len(t, p.servicePorts.GetByPrefix([]byte(serviceKey+"/")), 2)
+
+	// without timeout, the Kubernetes default applies
+	p.enableSessionAffinityForServiceIP(serviceKey, serviceevents.SessionAffinity{
+		ClientIP: &localnetv1.Service_ClientIP{ClientIP: &localnetv1.ClientIPAffinity{}},
+	})
+	assertPersistence("10.96.0.1", 80, true, 10800)
+
+	p.disableSessionAffinityForServiceIP(serviceKey)
+
+	assertPersistence("10.96.0.1", 80, false, 0)
+	assertPersistence("192.168.0.10", 30080, false, 0)
+}
+
+func TestEndpointWeights(t *testing.T) {
+	state := newDryRunState()
+	p := &proxier{
+		schedulingMethod:    "wrr",
+		weight:              2,
+		ipvs:                dryRunIPVS{state},
+		gracefulTermination: newGracefulTerminationManager(0, dryRunIPVS{state}),
+		endpoints:           lightdiffstore.New(),
+		servicePorts:        lightdiffstore.New(),
+		portMap:             map[string]map[string]localnetv1.PortMapping{},
+	}
+
+	svc := &localnetv1.Service{Namespace: "ns", Name: "svc"}
+	port := &localnetv1.PortMapping{Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 8080}
+	serviceKey := getServiceKey(svc)
+
+	portInfo := NewBaseServicePortInfo(svc, port, "10.96.0.1", ClusterIPService, p.schedulingMethod, p.weight)
+	p.servicePorts.Set([]byte(getServicePortKey(serviceKey, "10.96.0.1", port)), 0, *portInfo)
+	p.addVirtualServer(portInfo)
+
+	weights := func() map[string]int32 {
+		t.Helper()
+		vs, err := p.ipvs.GetService(&ipvs.Service{Address: net.ParseIP("10.96.0.1"), Port: 80, Protocol: syscall.IPPROTO_TCP})
+		if err != nil {
+			t.Fatal(err)
+		}
+		weights := map[string]int32{}
+		for _, dst := range vs.Destinations {
+			weights[dst.Address.String()] = dst.Weight
+		}
+		return weights
+	}
+
+	// the endpoint weights scale the --weight of the destinations
+	p.addRealServer(serviceKey, serviceKey+"/a/", "10.1.0.1", &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.1.0.1"), Weight: 3})
+	p.addRealServer(serviceKey, serviceKey+"/b/", "10.1.0.2", &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.1.0.2")})
+	assert.Equal(t, map[string]int32{"10.1.0.1": 6, "10.1.0.2": 2}, weights())
+
+	// a changed weight updates the destination
+	p.addRealServer(serviceKey, serviceKey+"/a/", "10.1.0.1", &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.1.0.1"), Weight: 1})
+	assert.Equal(t, map[string]int32{"10.1.0.1": 2, "10.1.0.2": 2}, weights())
+
+	// and is kept for the destinations of the new virtual servers
+	for _, kv := range p.endpoints.GetByPrefix([]byte(serviceKey + "/a/")) {
+		assert.Equal(t, int32(1), kv.Value.(endPointInfo).weight)
+	}
+}
@@ -0,0 +1,458 @@
+//go:build linux && cgo
+// +build linux,cgo
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvssink
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/seesaw/ipvs"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"sigs.k8s.io/kpng/backends/ipvs-as-sink/util"
+)
+
+// dryRunState records the IPVS servers, ipsets, iptables rules and dummy interface addresses programmed in dry run
+// mode, instead of the kernel, so they can be printed after each sync.
+type dryRunState struct {
+	mu sync.Mutex
+
+	services  map[string]*ipvs.Service
+	sets      map[string]*dryRunSet
+	rules     map[util.Protocol][]byte
+	addresses sets.String
+}
+
+type dryRunSet struct {
+	util.IPSet
+	entries sets.String
+}
+
+func newDryRunState() *dryRunState {
+	return &dryRunState{
+		services:  map[string]*ipvs.Service{},
+		sets:      map[string]*dryRunSet{},
+		rules:     map[util.Protocol][]byte{},
+		addresses: sets.NewString(),
+	}
+}
+
+func (d *dryRunState) addAddress(ip string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addresses.Insert(ip)
+}
+
+func (d *dryRunState) deleteAddress(ip string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addresses.Delete(ip)
+}
+
+// print writes the state in the input formats of ipvsadm-restore, ipset restore and iptables-restore.
+func (d *dryRunState) print(out io.Writer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	buf := &bytes.Buffer{}
+
+	buf.WriteString("# IPVS (dry run, not applied)\n")
+	keys := make([]string, 0, len(d.services))
+	for key := range d.services {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		svc := d.services[key]
+		fmt.Fprintf(buf, "-A %s -s %s", ipvsadmService(*svc), svc.Scheduler)
+		if svc.Flags&ipvs.SFPersistent != 0 {
+			fmt.Fprintf(buf, " -p %d", svc.Timeout)
+		}
+		buf.WriteByte('\n')
+
+		dsts := make([]string, 0, len(svc.Destinations))
+		for _, dst := range svc.Destinations {
+			dsts = append(dsts, fmt.Sprintf("-a %s -r %s %s -w %d", ipvsadmService(*svc), dst, ipvsadmForward(dst.Flags), dst.Weight))
+		}
+		sort.Strings(dsts)
+		for _, dst := range dsts {
+			buf.WriteString(dst + "\n")
+		}
+	}
+
+	buf.WriteString("# ipsets (dry run, not applied)\n")
+	for _, name := range d.setNames() {
+		set := d.sets[name]
+		fmt.Fprintf(buf, "create %s %s", set.Name, set.SetType)
+		if set.HashFamily != "" {
+			fmt.Fprintf(buf, " family %s", set.HashFamily)
+		}
+		if set.PortRange != "" {
+			fmt.Fprintf(buf, " range %s", set.PortRange)
+		}
+		buf.WriteByte('\n')
+		for _, entry := range set.entries.List() {
+			fmt.Fprintf(buf, "add %s %s\n", set.Name, entry)
+		}
+	}
+
+	for _, protocol := range []util.Protocol{util.ProtocolIPv4, util.ProtocolIPv6} {
+		if rules, ok := d.rules[protocol]; ok {
+			fmt.Fprintf(buf, "# %s iptables rules (dry run, not applied)\n", protocol)
+			buf.Write(rules)
+		}
+	}
+
+	buf.WriteString("# kube-ipvs0 addresses (dry run, not applied)\n")
+	for _, ip := range d.addresses.List() {
+		buf.WriteString(ip + "\n")
+	}
+
+	_, err := out.Write(buf.Bytes())
+	return err
+}
+
+// setNames returns the sorted names of the sets, d.mu must be held.
+func (d *dryRunState) setNames() []string {
+	names := make([]string, 0, len(d.sets))
+	for name := range d.sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ipvsadmService returns the ipvsadm service address of svc, ie: "-t 10.96.0.1:443".
+func ipvsadmService(svc ipvs.Service) string {
+	addr := net.JoinHostPort(svc.Address.String(), fmt.Sprint(svc.Port))
+	switch svc.Protocol {
+	case syscall.IPPROTO_UDP:
+		return "-u " + addr
+	case syscall.IPPROTO_SCTP:
+		return "--sctp-service " + addr
+	default:
+		return "-t " + addr
+	}
+}
+
+// ipvsadmForward returns the ipvsadm packet forwarding method option of the destination flags.
+func ipvsadmForward(flags ipvs.DestinationFlags) string {
+	switch flags & ipvs.DFForwardMask {
+	case ipvs.DFForwardRoute:
+		return "-g"
+	case ipvs.DFForwardTunnel:
+		return "-i"
+	default:
+		return "-m"
+	}
+}
+
+func dryRunServiceKey(svc ipvs.Service) string {
+	return ipvsadmService(svc)
+}
+
+var (
+	errDryRunExists   = errors.New("object exists")
+	errDryRunNotFound = errors.New("no such object")
+)
+
+// dryRunIPVS is the ipvsInterface of dry run mode.
+type dryRunIPVS struct{ *dryRunState }
+
+var _ ipvsInterface = dryRunIPVS{}
+
+func (d dryRunIPVS) AddService(svc ipvs.Service) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := dryRunServiceKey(svc)
+	if _, ok := d.services[key]; ok {
+		return errDryRunExists
+	}
+	svc.Destinations = nil
+	d.services[key] = &svc
+	return nil
+}
+
+func (d dryRunIPVS) UpdateService(svc ipvs.Service) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, ok := d.services[dryRunServiceKey(svc)]
+	if !ok {
+		return errDryRunNotFound
+	}
+	svc.Destinations = current.Destinations
+	*current = svc
+	return nil
+}
+
+func (d dryRunIPVS) DeleteService(svc ipvs.Service) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := dryRunServiceKey(svc)
+	if _, ok := d.services[key]; !ok {
+		return errDryRunNotFound
+	}
+	delete(d.services, key)
+	return nil
+}
+
+func (d dryRunIPVS) GetService(svc *ipvs.Service) (*ipvs.Service, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, ok := d.services[dryRunServiceKey(*svc)]
+	if !ok {
+		return nil, errDryRunNotFound
+	}
+	found := *current
+	found.Destinations = make([]*ipvs.Destination, 0, len(current.Destinations))
+	for _, dst := range current.Destinations {
+		dst := *dst
+		found.Destinations = append(found.Destinations, &dst)
+	}
+	return &found, nil
+}
+
+func (d dryRunIPVS) AddDestination(svc ipvs.Service, dst ipvs.Destination) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, ok := d.services[dryRunServiceKey(svc)]
+	if !ok {
+		return errDryRunNotFound
+	}
+	if dryRunDestination(current, dst) != -1 {
+		return errDryRunExists
+	}
+	current.Destinations = append(current.Destinations, &dst)
+	return nil
+}
+
+func (d dryRunIPVS) UpdateDestination(svc ipvs.Service, dst ipvs.Destination) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, ok := d.services[dryRunServiceKey(svc)]
+	if !ok {
+		return errDryRunNotFound
+	}
+	i := dryRunDestination(current, dst)
+	if i == -1 {
+		return errDryRunNotFound
+	}
+	current.Destinations[i] = &dst
+	return nil
+}
+
+func (d dryRunIPVS) DeleteDestination(svc ipvs.Service, dst ipvs.Destination) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, ok := d.services[dryRunServiceKey(svc)]
+	if !ok {
+		return errDryRunNotFound
+	}
+	i := dryRunDestination(current, dst)
+	if i == -1 {
+		return errDryRunNotFound
+	}
+	current.Destinations = append(current.Destinations[:i], current.Destinations[i+1:]...)
+	return nil
+}
+
+// dryRunDestination returns the index of dst in the destinations of svc, or -1.
+func dryRunDestination(svc *ipvs.Service, dst ipvs.Destination) int {
+	for i, d := range svc.Destinations {
+		if d.Address.Equal(dst.Address) && d.Port == dst.Port {
+			return i
+		}
+	}
+	return -1
+}
+
+// dryRunIPSet is the ipset util.Interface of dry run mode.
+type dryRunIPSet struct{ *dryRunState }
+
+var _ util.Interface = dryRunIPSet{}
+
+func (d dryRunIPSet) FlushSet(set string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sets[set]
+	if !ok {
+		return errDryRunNotFound
+	}
+	s.entries = sets.NewString()
+	return nil
+}
+
+func (d dryRunIPSet) DestroySet(set string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.sets, set)
+	return nil
+}
+
+func (d dryRunIPSet) DestroyAllSets() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sets = map[string]*dryRunSet{}
+	return nil
+}
+
+func (d dryRunIPSet) CreateSet(set *util.IPSet, ignoreExistErr bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.sets[set.Name]; ok {
+		if ignoreExistErr {
+			return nil
+		}
+		return errDryRunExists
+	}
+	d.sets[set.Name] = &dryRunSet{IPSet: *set, entries: sets.NewString()}
+	return nil
+}
+
+func (d dryRunIPSet) AddEntry(entry string, set *util.IPSet, ignoreExistErr bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sets[set.Name]
+	if !ok {
+		return errDryRunNotFound
+	}
+	if s.entries.Has(entry) && !ignoreExistErr {
+		return errDryRunExists
+	}
+	s.entries.Insert(entry)
+	return nil
+}
+
+func (d dryRunIPSet) DelEntry(entry string, set string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sets[set]
+	if !ok || !s.entries.Has(entry) {
+		return errDryRunNotFound
+	}
+	s.entries.Delete(entry)
+	return nil
+}
+
+func (d dryRunIPSet) TestEntry(entry string, set string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sets[set]
+	if !ok {
+		return false, errDryRunNotFound
+	}
+	return s.entries.Has(entry), nil
+}
+
+func (d dryRunIPSet) ListEntries(set string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.sets[set]
+	if !ok {
+		return nil, errDryRunNotFound
+	}
+	return s.entries.List(), nil
+}
+
+func (d dryRunIPSet) ListSets() ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.setNames(), nil
+}
+
+func (d dryRunIPSet) GetVersion() (string, error) {
+	return "", errors.New("no ipset version in dry run mode")
+}
+
+// dryRunIPTables is the util.IPTableInterface of dry run mode: it leaves the tables untouched, recording the
+// iptables-restore input instead. The existing rules are read as empty, so the full rule set is recorded.
+type dryRunIPTables struct {
+	util.IPTableInterface
+	state *dryRunState
+}
+
+var _ util.IPTableInterface = dryRunIPTables{}
+
+func (i dryRunIPTables) EnsureChain(table util.Table, chain util.Chain) (bool, error) {
+	return true, nil
+}
+
+func (i dryRunIPTables) FlushChain(table util.Table, chain util.Chain) error {
+	return nil
+}
+
+func (i dryRunIPTables) DeleteChain(table util.Table, chain util.Chain) error {
+	return nil
+}
+
+func (i dryRunIPTables) EnsureRule(position util.RulePosition, table util.Table, chain util.Chain, args ...string) (bool, error) {
+	return true, nil
+}
+
+func (i dryRunIPTables) DeleteRule(table util.Table, chain util.Chain, args ...string) error {
+	return nil
+}
+
+func (i dryRunIPTables) SaveInto(table util.Table, buffer *bytes.Buffer) error {
+	return nil
+}
+
+func (i dryRunIPTables) Restore(table util.Table, data []byte, flush util.FlushFlag, counters util.RestoreCountersFlag) error {
+	return i.RestoreAll(data, flush, counters)
+}
+
+func (i dryRunIPTables) RestoreAll(data []byte, flush util.FlushFlag, counters util.RestoreCountersFlag) error {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	i.state.rules[i.Protocol()] = append([]byte(nil), data...)
+	return nil
+}
+
+func (i dryRunIPTables) Monitor(canary util.Chain, tables []util.Table, reloadFunc func(), interval time.Duration, stopCh <-chan struct{}) {
+}
+
+// dryRunOutput receives the state printed after each sync in dry run mode.
+var dryRunOutput io.Writer = os.Stdout
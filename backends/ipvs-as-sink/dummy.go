@@ -0,0 +1,165 @@
+//go:build linux && cgo
+// +build linux,cgo
+
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvssink
+
+import (
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"k8s.io/klog/v2"
+)
+
+const dummyName = "kube-ipvs0"
+
+// dummyInterface manages the kube-ipvs0 dummy interface holding the services' IPs (cluster IPs, external IPs and load
+// balancer IPs), so the node accepts the traffic to them for IPVS. The addresses are counted since the same IP can be
+// used by several services, and the interface is reconciled with them after each sync.
+type dummyInterface struct {
+	link netlink.Link
+	// addresses counts the users of each address (as a CIDR)
+	addresses map[string]int
+}
+
+// ensureDummyInterface creates the dummy interface if needed, and sets it up.
+func ensureDummyInterface() *dummyInterface {
+	link, err := netlink.LinkByName(dummyName)
+	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); !ok {
+			klog.Fatal("failed to get dummy interface: ", err)
+		}
+
+		// not found => create the dummy
+		link = &netlink.Dummy{
+			LinkAttrs: netlink.LinkAttrs{Name: dummyName},
+		}
+
+		klog.Info("creating dummy interface ", dummyName)
+		if err = netlink.LinkAdd(link); err != nil {
+			klog.Fatal("failed to create dummy interface: ", err)
+		}
+
+		link, err = netlink.LinkByName(dummyName)
+		if err != nil {
+			klog.Fatal("failed to get link after create: ", err)
+		}
+	}
+
+	if link.Attrs().Flags&net.FlagUp == 0 {
+		klog.Info("setting dummy interface ", dummyName, " up")
+		if err = netlink.LinkSetUp(link); err != nil {
+			klog.Fatal("failed to set dummy interface up: ", err)
+		}
+	}
+
+	return &dummyInterface{
+		link:      link,
+		addresses: map[string]int{},
+	}
+}
+
+// Link returns the dummy interface's link, nil if it's not managed (ie: in dry run).
+func (d *dummyInterface) Link() netlink.Link {
+	if d == nil {
+		return nil
+	}
+	return d.link
+}
+
+// add binds the address to the interface, unless it's already bound for another service.
+func (d *dummyInterface) add(cidr string) {
+	d.addresses[cidr]++
+	if d.addresses[cidr] != 1 {
+		return
+	}
+
+	addr, err := netlink.ParseAddr(cidr)
+	if err != nil {
+		klog.Fatalf("failed to parse ip/net %q: %v", cidr, err)
+	}
+
+	klog.V(2).Info("adding dummy IP ", cidr)
+	if err = netlink.AddrReplace(d.link, addr); err != nil {
+		klog.Error("failed to add dummy IP ", cidr, ": ", err)
+	}
+}
+
+// del unbinds the address from the interface once no service uses it anymore.
+func (d *dummyInterface) del(cidr string) {
+	if d.addresses[cidr] == 0 {
+		return
+	}
+
+	d.addresses[cidr]--
+	if d.addresses[cidr] != 0 {
+		return
+	}
+	delete(d.addresses, cidr)
+
+	addr, err := netlink.ParseAddr(cidr)
+	if err != nil {
+		klog.Fatalf("failed to parse ip/net %q: %v", cidr, err)
+	}
+
+	klog.V(2).Info("deleting dummy IP ", cidr)
+	if err = netlink.AddrDel(d.link, addr); err != nil {
+		klog.Error("failed to delete dummy IP ", cidr, ": ", err)
+	}
+}
+
+// sync binds the missing addresses to the interface and prunes the stale ones (ie: left by a previous run, or
+// added by hand). The link-local addresses are kept.
+func (d *dummyInterface) sync() {
+	addrs, err := netlink.AddrList(d.link, netlink.FAMILY_ALL)
+	if err != nil {
+		klog.Error("failed to list dummy interface IPs: ", err)
+		return
+	}
+
+	bound := map[string]bool{}
+	for _, addr := range addrs {
+		cidr := addr.IPNet.String()
+		bound[cidr] = true
+
+		if addr.IP.IsLinkLocalUnicast() || d.addresses[cidr] != 0 {
+			continue
+		}
+
+		klog.V(1).Info("pruning stale dummy IP ", cidr)
+		if err = netlink.AddrDel(d.link, &addr); err != nil {
+			klog.Error("failed to delete stale dummy IP ", cidr, ": ", err)
+		}
+	}
+
+	for cidr := range d.addresses {
+		if bound[cidr] {
+			continue
+		}
+
+		addr, err := netlink.ParseAddr(cidr)
+		if err != nil {
+			klog.Fatalf("failed to parse ip/net %q: %v", cidr, err)
+		}
+
+		klog.V(1).Info("restoring missing dummy IP ", cidr)
+		if err = netlink.AddrReplace(d.link, addr); err != nil {
+			klog.Error("failed to add dummy IP ", cidr, ": ", err)
+		}
+	}
+}
@@ -1,3 +1,6 @@
+//go:build linux && cgo
+// +build linux,cgo
+
 /*
 Copyright 2021 The Kubernetes Authors.
 
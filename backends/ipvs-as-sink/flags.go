@@ -1,3 +1,6 @@
+//go:build linux && cgo
+// +build linux,cgo
+
 /*
 Copyright 2021 The Kubernetes Authors.
 
@@ -18,6 +21,7 @@ package ipvssink
 
 import (
 	"net"
+	"time"
 
 	"github.com/spf13/pflag"
 )
@@ -26,11 +30,15 @@ func (s *Backend) BindFlags(flags *pflag.FlagSet) {
 	s.Config.BindFlags(flags)
 
 	// real ipvs sink flags
-	flags.BoolVar(&s.dryRun, "dry-run", false, "dry run (print instead of applying)")
+	flags.BoolVar(&s.dryRun, "dry-run", false, "Print the IPVS servers, ipsets, iptables rules and dummy interface addresses after each sync instead of programming them")
 	flags.StringSliceVar(&s.nodeAddresses, "node-address", interfaceAddresses(), "A comma-separated list of IPs to associate when using NodePort type. Defaults to all the Node addresses")
 	flags.StringVar(&s.schedulingMethod, "scheduling-method", "rr", "Algorithm for allocating TCP conn & UDP datagrams to real servers. Values: rr,wrr,lc,wlc,lblc,lblcr,dh,sh,seq,nq")
 	flags.Int32Var(&s.weight, "weight", 1, "An integer specifying the capacity of server relative to others in the pool")
+	flags.DurationVar(&s.gracefulTerminationPeriod, "graceful-termination-period", 30*time.Second, "Max time to wait for the connections of a removed endpoint to drain before deleting it from IPVS (0 to delete immediately)")
 	//flags.Int32Var(s.masqueradeBit, "iptables-masquerade-bit", Int32PtrDerefOr(s.masqueradeBit, 14), "If using the pure iptables proxy, the bit of the fwmark space to mark packets requiring SNAT with.  Must be within the range [0, 31].")
+	flags.BoolVar(&s.strictARP, "strict-arp", true, "Set arp_ignore=1 and arp_announce=2 so the node doesn't answer ARP requests for the service IPs bound to "+dummyName)
+	flags.BoolVar(&s.skipSysctls, "skip-sysctls", false, "Don't change the sysctls (ie: on nodes where they're managed by the node's configuration), only warn when they don't have the expected values")
+	flags.BoolVar(&s.connectionStats, "connection-stats", false, "Export the connections and bytes of the IPVS virtual and real servers as metrics, read from IPVS on each sync")
 	flags.BoolVar(&s.masqueradeAll, "masquerade-all", s.masqueradeAll, "If using the pure iptables proxy, SNAT all traffic sent via Service cluster IPs (this not commonly needed)")
 }
 
@@ -0,0 +1,155 @@
+//go:build linux && cgo
+// +build linux,cgo
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvssink
+
+import (
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/seesaw/ipvs"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// drainCheckInterval is the interval between checks of the draining destinations' connections.
+const drainCheckInterval = 5 * time.Second
+
+type drainingDestination struct {
+	svc      ipvs.Service
+	dst      ipvs.Destination
+	deadline time.Time
+}
+
+// gracefulTerminationManager delays the deletion of IPVS destinations until their connections
+// are drained or the grace period expired. Draining destinations get a weight of 0 so they
+// don't receive new connections.
+type gracefulTerminationManager struct {
+	period time.Duration
+	ipvs   ipvsInterface
+
+	mu       sync.Mutex
+	draining map[string]*drainingDestination
+}
+
+func newGracefulTerminationManager(period time.Duration, ipvs ipvsInterface) *gracefulTerminationManager {
+	return &gracefulTerminationManager{
+		period:   period,
+		ipvs:     ipvs,
+		draining: map[string]*drainingDestination{},
+	}
+}
+
+func drainKey(svc ipvs.Service, dst ipvs.Destination) string {
+	return svc.String() + "/" + dst.String()
+}
+
+// Run checks the draining destinations until the stop channel is closed.
+func (m *gracefulTerminationManager) Run(stopCh <-chan struct{}) {
+	wait.Until(m.deleteDrained, drainCheckInterval, stopCh)
+}
+
+// DeleteDestination removes dst from svc once its connections are drained. UDP destinations
+// are removed immediately, as are all destinations when the grace period is 0.
+func (m *gracefulTerminationManager) DeleteDestination(svc ipvs.Service, dst ipvs.Destination) error {
+	if m.period <= 0 || svc.Protocol == syscall.IPPROTO_UDP {
+		return m.ipvs.DeleteDestination(svc, dst)
+	}
+
+	dst.Weight = 0
+	if err := m.ipvs.UpdateDestination(svc, dst); err != nil {
+		return err
+	}
+
+	klog.V(2).Infof("draining destination %v of %v", dst, svc)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := drainKey(svc, dst)
+	if _, ok := m.draining[key]; !ok {
+		m.draining[key] = &drainingDestination{
+			svc:      svc,
+			dst:      dst,
+			deadline: time.Now().Add(m.period),
+		}
+	}
+	return nil
+}
+
+// CancelDeletion stops draining dst and restores its weight. It returns false if dst wasn't draining.
+func (m *gracefulTerminationManager) CancelDeletion(svc ipvs.Service, dst ipvs.Destination) bool {
+	m.mu.Lock()
+	key := drainKey(svc, dst)
+	_, ok := m.draining[key]
+	delete(m.draining, key)
+	m.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	klog.V(2).Infof("destination %v of %v is back, stop draining", dst, svc)
+	if err := m.ipvs.UpdateDestination(svc, dst); err != nil {
+		klog.Error("failed to restore destination ", dst, ": ", err)
+	}
+	return true
+}
+
+func (m *gracefulTerminationManager) deleteDrained() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	for key, d := range m.draining {
+		svc, err := m.ipvs.GetService(&d.svc)
+		if err != nil {
+			// the virtual server is gone, and its destinations with it
+			klog.V(2).Infof("stop draining %v: %v", key, err)
+			delete(m.draining, key)
+			continue
+		}
+
+		if now.Before(d.deadline) && activeConnections(svc, d.dst) != 0 {
+			continue
+		}
+
+		klog.V(2).Infof("deleting drained destination %v of %v", d.dst, d.svc)
+		if err := m.ipvs.DeleteDestination(d.svc, d.dst); err != nil {
+			klog.Error("failed to delete destination ", d.dst, ": ", err)
+		}
+		delete(m.draining, key)
+	}
+}
+
+// activeConnections returns the number of connections of dst in the svc stats.
+func activeConnections(svc *ipvs.Service, dst ipvs.Destination) uint32 {
+	for _, d := range svc.Destinations {
+		if !d.Address.Equal(dst.Address) || d.Port != dst.Port {
+			continue
+		}
+		if d.Statistics == nil {
+			return 0
+		}
+		return d.Statistics.ActiveConns + d.Statistics.InactiveConns
+	}
+	return 0
+}
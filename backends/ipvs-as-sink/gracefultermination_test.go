@@ -0,0 +1,223 @@
+//go:build linux && cgo
+// +build linux,cgo
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvssink
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/seesaw/ipvs"
+)
+
+// drainIPVS is a dry run IPVS returning the connections of its destinations, by address.
+type drainIPVS struct {
+	dryRunIPVS
+	conns map[string]uint32
+}
+
+func (d drainIPVS) GetService(svc *ipvs.Service) (*ipvs.Service, error) {
+	found, err := d.dryRunIPVS.GetService(svc)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dst := range found.Destinations {
+		dst.Statistics = &ipvs.DestinationStats{ActiveConns: d.conns[dst.Address.String()]}
+	}
+	return found, nil
+}
+
+func TestActiveConnections(t *testing.T) {
+	svc := &ipvs.Service{
+		Destinations: []*ipvs.Destination{
+			{
+				Address:    net.ParseIP("10.1.0.1"),
+				Port:       8080,
+				Statistics: &ipvs.DestinationStats{ActiveConns: 2, InactiveConns: 3},
+			},
+			{
+				Address: net.ParseIP("10.1.0.2"),
+				Port:    8080,
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		ip       string
+		port     uint16
+		expected uint32
+	}{
+		{"10.1.0.1", 8080, 5},
+		{"10.1.0.1", 8081, 0}, // other port
+		{"10.1.0.2", 8080, 0}, // no statistics
+		{"10.1.0.3", 8080, 0}, // unknown
+	} {
+		dst := ipvs.Destination{Address: net.ParseIP(tc.ip), Port: tc.port}
+		if n := activeConnections(svc, dst); n != tc.expected {
+			t.Errorf("%s:%d: expected %d connections, got %d", tc.ip, tc.port, tc.expected, n)
+		}
+	}
+}
+
+func TestGracefulTermination(t *testing.T) {
+	d := drainIPVS{dryRunIPVS{newDryRunState()}, map[string]uint32{}}
+
+	svc := ipvs.Service{Address: net.ParseIP("10.96.0.1"), Protocol: syscall.IPPROTO_TCP, Port: 80, Scheduler: "rr"}
+	if err := d.AddService(svc); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := ipvs.Destination{Address: net.ParseIP("10.1.0.1"), Port: 8080, Weight: 1}
+	if err := d.AddDestination(svc, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	// weight returns the weight of dst, or -1 if it was deleted
+	weight := func() int {
+		found, err := d.GetService(&svc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i := dryRunDestination(found, dst); i != -1 {
+			return int(found.Destinations[i].Weight)
+		}
+		return -1
+	}
+
+	m := newGracefulTerminationManager(time.Minute, d)
+
+	// draining
+	d.conns["10.1.0.1"] = 2
+
+	if err := m.DeleteDestination(svc, dst); err != nil {
+		t.Fatal(err)
+	}
+	if w := weight(); w != 0 {
+		t.Errorf("draining destination should have a weight of 0, got %d", w)
+	}
+
+	m.deleteDrained()
+	if w := weight(); w != 0 {
+		t.Errorf("destination with connections should still be draining, got weight %d", w)
+	}
+
+	d.conns["10.1.0.1"] = 0
+
+	m.deleteDrained()
+	if w := weight(); w != -1 {
+		t.Errorf("drained destination should be deleted, got weight %d", w)
+	}
+	if len(m.draining) != 0 {
+		t.Errorf("drained destination should not be tracked anymore: %v", m.draining)
+	}
+
+	// cancel
+	if err := d.AddDestination(svc, dst); err != nil {
+		t.Fatal(err)
+	}
+	d.conns["10.1.0.1"] = 2
+
+	if err := m.DeleteDestination(svc, dst); err != nil {
+		t.Fatal(err)
+	}
+	if !m.CancelDeletion(svc, dst) {
+		t.Error("draining destination deletion should be canceled")
+	}
+	if w := weight(); w != 1 {
+		t.Errorf("canceled destination should get its weight back, got %d", w)
+	}
+	if m.CancelDeletion(svc, dst) {
+		t.Error("destination not draining should not be canceled")
+	}
+
+	d.conns["10.1.0.1"] = 0
+
+	m.deleteDrained()
+	if w := weight(); w != 1 {
+		t.Errorf("canceled destination should not be deleted, got weight %d", w)
+	}
+
+	// deadline
+	d.conns["10.1.0.1"] = 2
+
+	if err := m.DeleteDestination(svc, dst); err != nil {
+		t.Fatal(err)
+	}
+	m.draining[drainKey(svc, dst)].deadline = time.Now().Add(-time.Second)
+
+	m.deleteDrained()
+	if w := weight(); w != -1 {
+		t.Errorf("destination past the grace period should be deleted, got weight %d", w)
+	}
+
+	// virtual server deleted while draining
+	if err := d.AddDestination(svc, dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteDestination(svc, dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeleteService(svc); err != nil {
+		t.Fatal(err)
+	}
+
+	m.deleteDrained()
+	if len(m.draining) != 0 {
+		t.Errorf("destinations of a deleted virtual server should not be tracked anymore: %v", m.draining)
+	}
+}
+
+func TestGracefulTerminationImmediate(t *testing.T) {
+	d := drainIPVS{dryRunIPVS{newDryRunState()}, map[string]uint32{"10.1.0.1": 2}}
+
+	dst := ipvs.Destination{Address: net.ParseIP("10.1.0.1"), Port: 53, Weight: 1}
+
+	for _, tc := range []struct {
+		name   string
+		period time.Duration
+		proto  ipvs.IPProto
+	}{
+		{"udp", time.Minute, syscall.IPPROTO_UDP},
+		{"no grace period", 0, syscall.IPPROTO_TCP},
+	} {
+		svc := ipvs.Service{Address: net.ParseIP("10.96.0.10"), Protocol: tc.proto, Port: 53, Scheduler: "rr"}
+		if err := d.AddService(svc); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.AddDestination(svc, dst); err != nil {
+			t.Fatal(err)
+		}
+
+		m := newGracefulTerminationManager(tc.period, d)
+		if err := m.DeleteDestination(svc, dst); err != nil {
+			t.Fatal(err)
+		}
+
+		found, err := d.GetService(&svc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found.Destinations) != 0 || len(m.draining) != 0 {
+			t.Errorf("%s: destination should be deleted immediately", tc.name)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+//go:build linux && cgo
+// +build linux,cgo
+
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvssink
+
+import (
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/backends/iptables/ipset"
+	"sigs.k8s.io/kpng/backends/ipvs-as-sink/util"
+)
+
+// batchedIPSet is the ipset util.Interface of the proxiers: the entries of the sets are recorded in an ipset.Manager
+// and applied after each sync with one ipset restore (see Backend.Sync), instead of running ipset for each entry.
+type batchedIPSet struct {
+	util.Interface
+	sets *ipset.Manager
+}
+
+var _ util.Interface = batchedIPSet{}
+
+func newBatchedIPSet(handle util.Interface, ipsetInterface ipset.Interface) batchedIPSet {
+	// the stale sets are never destroyed, the prefix is the one of all the sets
+	return batchedIPSet{Interface: handle, sets: ipset.NewManager(ipsetInterface, "KUBE-")}
+}
+
+func (b batchedIPSet) CreateSet(set *util.IPSet, ignoreExistErr bool) error {
+	if err := b.Interface.CreateSet(set, ignoreExistErr); err != nil {
+		return err
+	}
+
+	// the set's defaults are set by CreateSet
+	managed := ipset.Set{
+		Name:     set.Name,
+		Type:     ipset.Type(set.SetType),
+		Family:   ipset.Family(set.HashFamily),
+		HashSize: set.HashSize,
+		MaxElem:  set.MaxElem,
+	}
+	if set.SetType == util.BitmapPort {
+		managed = ipset.Set{Name: set.Name, Type: ipset.BitmapPort, Range: set.PortRange}
+	}
+	b.sets.Ensure(managed)
+	return nil
+}
+
+func (b batchedIPSet) AddEntry(entry string, set *util.IPSet, ignoreExistErr bool) error {
+	b.sets.Add(set.Name, entry)
+	return nil
+}
+
+func (b batchedIPSet) DelEntry(entry string, set string) error {
+	b.sets.Del(set, entry)
+	return nil
+}
+
+func (b batchedIPSet) FlushSet(set string) error {
+	if !b.sets.Has(set) {
+		return b.Interface.FlushSet(set)
+	}
+	b.sets.Clear(set)
+	return nil
+}
+
+func (b batchedIPSet) DestroySet(set string) error {
+	b.sets.Forget(set)
+	return b.Interface.DestroySet(set)
+}
+
+// sync applies the entries recorded since the last sync.
+func (b batchedIPSet) sync() {
+	if err := b.sets.Sync(); err != nil {
+		klog.Error("failed to sync the ipsets: ", err)
+	}
+}
@@ -1,3 +1,6 @@
+//go:build linux && cgo
+// +build linux,cgo
+
 /*
 Copyright 2021 The Kubernetes Authors.
 
@@ -19,6 +22,8 @@ package ipvssink
 import (
 	"bytes"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"k8s.io/klog/v2"
 
@@ -68,6 +73,7 @@ var iptablesChains = []struct {
 	{util.TableNAT, KubeNodePortChain},
 	{util.TableNAT, KubeLoadBalancerChain},
 	{util.TableNAT, KubeMarkMasqChain},
+	{util.TableFilter, kubeServicesChain},
 	{util.TableFilter, KubeForwardChain},
 	{util.TableFilter, KubeNodePortChain},
 }
@@ -84,6 +90,9 @@ var iptablesJumpChain = []struct {
 	{util.TableNAT, util.ChainOutput, kubeServicesChain, "kubernetes service portals"},
 	{util.TableNAT, util.ChainPrerouting, kubeServicesChain, "kubernetes service portals"},
 	{util.TableNAT, util.ChainPostrouting, kubePostroutingChain, "kubernetes postrouting rules"},
+	{util.TableFilter, util.ChainInput, kubeServicesChain, "kubernetes service portals"},
+	{util.TableFilter, util.ChainOutput, kubeServicesChain, "kubernetes service portals"},
+	{util.TableFilter, util.ChainForward, kubeServicesChain, "kubernetes service portals"},
 	{util.TableFilter, util.ChainForward, KubeForwardChain, "kubernetes forwarding rules"},
 	{util.TableFilter, util.ChainInput, KubeNodePortChain, "kubernetes health check rules"},
 }
@@ -311,6 +320,9 @@ func (p *proxier) writeIptablesRules() {
 		"-j", "ACCEPT",
 	)
 
+	// Reject the traffic to the services without endpoints, instead of letting it reach the default gateway.
+	p.writeNoEndpointsRules(args)
+
 	// Add rule to accept traffic towards health check node port
 	p.filterRules.Write(
 		"-A", string(KubeNodePortChain),
@@ -359,6 +371,46 @@ func (p *proxier) writeIptablesRules() {
 	p.natRules.Write("COMMIT")
 }
 
+// writeNoEndpointsRules writes the rules rejecting the traffic to the service ports without endpoints (ICMP port
+// unreachable), counting only the endpoints of the proxier's IP family serving the port.
+func (p *proxier) writeNoEndpointsRules(args []string) {
+	for _, kv := range p.servicePorts.GetByPrefix(nil) {
+		portInfo := kv.Value.(BaseServicePortInfo)
+
+		// <namespace>/<service-name>/<ip>/<protocol>:<port>
+		parts := strings.SplitN(string(kv.Key), "/", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		serviceKey := parts[0] + "/" + parts[1]
+
+		if p.hasEndpoints(serviceKey, &portInfo) {
+			continue
+		}
+
+		protocol := strings.ToLower(portInfo.Protocol().String())
+		args = append(args[:0],
+			"-A", string(kubeServicesChain),
+			"-m", "comment", "--comment", fmt.Sprintf(`"%s:%s has no endpoints"`, serviceKey, portInfo.TargetPortName()),
+			"-m", protocol, "-p", protocol,
+			"-d", portInfo.ServiceIP(),
+			"--dport", strconv.Itoa(int(portInfo.Port())),
+			"-j", "REJECT",
+		)
+		p.filterRules.Write(args)
+	}
+}
+
+// hasEndpoints returns true if the service has an endpoint serving the port.
+func (p *proxier) hasEndpoints(serviceKey string, portInfo *BaseServicePortInfo) bool {
+	for _, ep := range p.endpoints.GetByPrefix([]byte(serviceKey + "/")) {
+		if ipvsDestination(ep.Value.(endPointInfo), portInfo).Port != 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *proxier) acceptIPVSTraffic() {
 	sets := []string{kubeClusterIPSet, kubeLoadBalancerSet}
 	for _, set := range sets {
@@ -1,3 +1,6 @@
+//go:build linux && cgo
+// +build linux,cgo
+
 /*
 Copyright 2021 The Kubernetes Authors.
 
@@ -18,7 +21,6 @@ package ipvssink
 
 import (
 	"fmt"
-	"net"
 	"net/http"
 	"os"
 
@@ -27,15 +29,17 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apiserver/pkg/server/mux"
 	"k8s.io/klog/v2"
+	utilexec "k8s.io/utils/exec"
 
 	"time"
 
+	"sigs.k8s.io/kpng/backends/iptables/ipset"
 	"sigs.k8s.io/kpng/backends/ipvs-as-sink/exec"
 	"sigs.k8s.io/kpng/backends/ipvs-as-sink/util"
 	"sigs.k8s.io/kpng/client/serviceevents"
 
 	"github.com/google/seesaw/ipvs"
-	"github.com/vishvananda/netlink"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"sigs.k8s.io/kpng/api/localnetv1"
 	"sigs.k8s.io/kpng/client/backendcmd"
@@ -74,9 +78,26 @@ type Backend struct {
 	schedulingMethod string
 	weight           int32
 
-	dummy netlink.Link
+	strictARP   bool
+	skipSysctls bool
+
+	dummy *dummyInterface
+
+	// ipsets batches the changes of the ipsets (not used in dry run)
+	ipsets batchedIPSet
+
+	// ipvs programs the virtual servers, in the kernel or in dryRunState
+	ipvs        ipvsInterface
+	dryRunState *dryRunState
 
 	masqueradeAll bool
+
+	gracefulTerminationPeriod time.Duration
+	gracefulTermination       *gracefulTerminationManager
+
+	// connectionStats enables the export of the IPVS statistics, read in stats on each sync
+	connectionStats bool
+	stats           *statsCollector
 }
 
 var _ decoder.Interface = &Backend{}
@@ -220,16 +241,23 @@ func (s *Backend) DeleteEndpoint(namespace, serviceName, key string) {
 }
 
 func (s *Backend) Setup() {
-	kernelHandler := util.NewLinuxKernelHandler()
-	err := s.initializeKernelConfig(kernelHandler)
-	if err != nil {
-		klog.Info(err)
-		return
-	}
+	if s.dryRun {
+		// nothing is programmed in the kernel, the state is printed after each sync
+		s.dryRunState = newDryRunState()
+		s.ipvs = dryRunIPVS{s.dryRunState}
+	} else {
+		kernelHandler := util.NewLinuxKernelHandler()
+		err := s.initializeKernelConfig(kernelHandler)
+		if err != nil {
+			klog.Info(err)
+			return
+		}
 
-	ipvs.Init()
+		ipvs.Init()
 
-	s.createIPVSDummyInterface()
+		s.dummy = ensureDummyInterface()
+		s.ipvs = kernelIPVS{}
+	}
 
 	// Generate the masquerade mark to use for SNAT rules.
 	//TODO fetch masqueradeBit from config
@@ -239,7 +267,21 @@ func (s *Backend) Setup() {
 
 	// Create a ipset utils.
 	execer := exec.New()
-	ipsetInterface := util.New(execer)
+	var ipsetInterface util.Interface
+	if s.dryRun {
+		ipsetInterface = dryRunIPSet{s.dryRunState}
+	} else {
+		s.ipsets = newBatchedIPSet(util.New(execer), ipset.New(utilexec.New()))
+		ipsetInterface = s.ipsets
+	}
+
+	if s.connectionStats {
+		s.stats = &statsCollector{}
+		prometheus.MustRegister(s.stats)
+	}
+
+	s.gracefulTermination = newGracefulTerminationManager(s.gracefulTerminationPeriod, s.ipvs)
+	go s.gracefulTermination.Run(wait.NeverStop)
 
 	for _, ipFamily := range []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol} {
 		var nodeIPs []string
@@ -251,10 +293,14 @@ func (s *Backend) Setup() {
 		}
 
 		iptInterface := util.NewIPTableInterface(execer, util.Protocol(ipFamily))
+		if s.dryRun {
+			iptInterface = dryRunIPTables{iptInterface, s.dryRunState}
+		}
 
 		s.proxiers[ipFamily] = NewProxier(
 			ipFamily,
-			s.dummy,
+			s.dummy.Link(),
+			s.ipvs,
 			ipsetInterface,
 			iptInterface,
 			nodeIPs,
@@ -264,6 +310,7 @@ func (s *Backend) Setup() {
 			s.weight,
 		)
 
+		s.proxiers[ipFamily].gracefulTermination = s.gracefulTermination
 		s.proxiers[ipFamily].initializeIPSets()
 	}
 
@@ -304,63 +351,6 @@ func (s *Backend) ServeProxyMode(errCh chan error) {
 	go wait.Until(fn, 5*time.Second, wait.NeverStop)
 }
 
-func (s *Backend) createIPVSDummyInterface() {
-	// populate dummyIPs
-	const dummyName = "kube-ipvs0"
-
-	dummy, err := netlink.LinkByName(dummyName)
-	if err != nil {
-		if _, ok := err.(netlink.LinkNotFoundError); !ok {
-			klog.Fatal("failed to get dummy interface: ", err)
-		}
-
-		// not found => create the dummy
-		dummy = &netlink.Dummy{
-			LinkAttrs: netlink.LinkAttrs{Name: dummyName},
-		}
-
-		klog.Info("creating dummy interface ", dummyName)
-		if err = netlink.LinkAdd(dummy); err != nil {
-			klog.Fatal("failed to create dummy interface: ", err)
-		}
-
-		dummy, err = netlink.LinkByName(dummyName)
-		if err != nil {
-			klog.Fatal("failed to get link after create: ", err)
-		}
-	}
-
-	if dummy.Attrs().Flags&net.FlagUp == 0 {
-		klog.Info("setting dummy interface ", dummyName, " up")
-		if err = netlink.LinkSetUp(dummy); err != nil {
-			klog.Fatal("failed to set dummy interface up: ", err)
-		}
-	}
-
-	s.dummy = dummy
-
-	dummyIface, err := net.InterfaceByName(dummyName)
-	if err != nil {
-		klog.Fatal("failed to get dummy interface: ", err)
-	}
-
-	addrs, err := dummyIface.Addrs()
-	if err != nil {
-		klog.Fatal("failed to list dummy interface IPs: ", err)
-	}
-
-	for _, ip := range addrs {
-		cidr := ip.String()
-		ip, _, err := net.ParseCIDR(cidr)
-		if err != nil {
-			klog.Fatalf("failed to parse ip/net %q: %v", ip, err)
-		}
-		if ip.IsLinkLocalUnicast() {
-			continue
-		}
-	}
-}
-
 // WaitRequest see localsink.Sink#WaitRequest
 func (s *Backend) WaitRequest() (nodeName string, err error) {
 	name, _ := os.Hostname()
@@ -377,49 +367,62 @@ func (s *Backend) Sync() {
 		defer klog.Info("sync took ", time.Now().Sub(start))
 	}
 
+	if s.ipsets.sets != nil {
+		// the sets are filled before the rules matching them
+		s.ipsets.sync()
+	}
+
 	for _, proxier := range s.proxiers {
 		proxier.sync()
 	}
+
+	if s.dummy != nil {
+		s.dummy.sync()
+	}
+
+	if s.stats != nil {
+		var virtualServers []virtualServerStats
+		for _, proxier := range s.proxiers {
+			virtualServers = append(virtualServers, proxier.readStats()...)
+		}
+		s.stats.set(virtualServers)
+	}
+
+	if s.dryRun {
+		if err := s.dryRunState.print(dryRunOutput); err != nil {
+			klog.Error("failed to print the dry run state: ", err)
+		}
+	}
 }
 
 func (s *Backend) addServiceIPToKubeIPVSIntf(serviceIP string) {
-	ipFamily := getIPFamily(serviceIP)
-
-	ip := asDummyIPs(serviceIP, ipFamily)
+	ip := asDummyIPs(serviceIP, getIPFamily(serviceIP))
 
-	_, ipNet, err := net.ParseCIDR(ip)
-	if err != nil {
-		klog.Fatalf("failed to parse ip/net %q: %v", ip, err)
+	if s.dryRun {
+		s.dryRunState.addAddress(ip)
+		return
 	}
 
 	if s.dummy == nil {
-		klog.Fatalf("exit early while adding dummy IP ", ip, "; dummy link device not found")
+		klog.Fatal("exit early while adding dummy IP ", ip, "; dummy link device not found")
 		return
 	}
-	klog.V(2).Info("adding dummy IP ", ip)
-	if err = netlink.AddrAdd(s.dummy, &netlink.Addr{IPNet: ipNet}); err != nil {
-		klog.Error("failed to add dummy IP ", ip, ": ", err)
-	}
+	s.dummy.add(ip)
 }
 
 func (s *Backend) deleteServiceIPToKubeIPVSIntf(serviceIP string) {
-	ipFamily := getIPFamily(serviceIP)
+	ip := asDummyIPs(serviceIP, getIPFamily(serviceIP))
 
-	ip := asDummyIPs(serviceIP, ipFamily)
-
-	_, ipNet, err := net.ParseCIDR(ip)
-	if err != nil {
-		klog.Fatalf("failed to parse ip/net %q: %v", ip, err)
+	if s.dryRun {
+		s.dryRunState.deleteAddress(ip)
+		return
 	}
 
 	if s.dummy == nil {
-		klog.Fatalf("exit early while deleting dummy IP ", ip, "; dummy link device not found")
+		klog.Fatal("exit early while deleting dummy IP ", ip, "; dummy link device not found")
 		return
 	}
-	klog.V(2).Info("deleting dummy IP ", ip)
-	if err = netlink.AddrDel(s.dummy, &netlink.Addr{IPNet: ipNet}); err != nil {
-		klog.Error("failed to delete dummy IP ", ip, ": ", err)
-	}
+	s.dummy.del(ip)
 }
 
 func (s *Backend) initializeKernelConfig(kernelHandler util.KernelHandler) error {
@@ -431,8 +434,21 @@ func (s *Backend) initializeKernelConfig(kernelHandler util.KernelHandler) error
 		klog.Info("Missing br-netfilter module or unset sysctl br-nf-call-iptables, proxy may not work as intended")
 	}
 
+	// with --skip-sysctls, the sysctls are managed by the node's configuration: only warn when they differ
+	ensureSysctl := func(name string, value int) error {
+		if !s.skipSysctls {
+			return util.EnsureSysctl(sysctl, name, value)
+		}
+		if current, err := sysctl.GetSysctl(name); err != nil {
+			klog.Warningf("can't read sysctl %s (expected %d): %v", name, value, err)
+		} else if current != value {
+			klog.Warningf("sysctl %s is %d instead of %d, proxy may not work as intended", name, current, value)
+		}
+		return nil
+	}
+
 	// Set the conntrack sysctl we need for
-	if err := util.EnsureSysctl(sysctl, sysctlVSConnTrack, 1); err != nil {
+	if err := ensureSysctl(sysctlVSConnTrack, 1); err != nil {
 		return err
 	}
 
@@ -451,36 +467,36 @@ func (s *Backend) initializeKernelConfig(kernelHandler util.KernelHandler) error
 		klog.V(2).Info("Left as-is", "sysctl", sysctlConnReuse)
 	} else {
 		// Set the connection reuse mode
-		if err := util.EnsureSysctl(sysctl, sysctlConnReuse, 0); err != nil {
+		if err := ensureSysctl(sysctlConnReuse, 0); err != nil {
 			return err
 		}
 	}
 
 	// Set the expire_nodest_conn sysctl we need for
-	if err := util.EnsureSysctl(sysctl, sysctlExpireNoDestConn, 1); err != nil {
+	if err := ensureSysctl(sysctlExpireNoDestConn, 1); err != nil {
 		return err
 	}
 
 	// Set the expire_quiescent_template sysctl we need for
-	if err := util.EnsureSysctl(sysctl, sysctlExpireQuiescentTemplate, 1); err != nil {
+	if err := ensureSysctl(sysctlExpireQuiescentTemplate, 1); err != nil {
 		return err
 	}
 
 	// Set the ip_forward sysctl we need for
-	if err := util.EnsureSysctl(sysctl, sysctlForward, 1); err != nil {
+	if err := ensureSysctl(sysctlForward, 1); err != nil {
 		return err
 	}
 
-	//if strictARP {
-	//	// Set the arp_ignore sysctl we need for
-	//	if err := utilproxy.EnsureSysctl(sysctl, sysctlArpIgnore, 1); err != nil {
-	//		return err
-	//	}
-	//
-	//	// Set the arp_announce sysctl we need for
-	//	if err := utilproxy.EnsureSysctl(sysctl, sysctlArpAnnounce, 2); err != nil {
-	//		return err
-	//	}
-	//}
+	if s.strictARP {
+		// Only answer ARP requests for the addresses of the receiving interface, and announce them as source: the
+		// service IPs bound to the dummy interface must not be announced by the node
+		if err := ensureSysctl(sysctlArpIgnore, 1); err != nil {
+			return err
+		}
+
+		if err := ensureSysctl(sysctlArpAnnounce, 2); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -1,3 +1,6 @@
+//go:build linux && cgo
+// +build linux,cgo
+
 /*
 Copyright 2021 The Kubernetes Authors.
 
@@ -87,6 +90,40 @@ func ipvsDestination(epInfo endPointInfo, port *BaseServicePortInfo) ipvs.Destin
 	return ipvs.Destination{
 		Address: net.ParseIP(epInfo.endPointIP),
 		Port:    uint16(targetPort),
-		Weight:  port.weight,
+		Weight:  port.weight * epInfo.weight,
 	}
 }
+
+// ipvsInterface programs the IPVS virtual and real servers, in the kernel or in memory in dry run mode.
+type ipvsInterface interface {
+	AddService(svc ipvs.Service) error
+	UpdateService(svc ipvs.Service) error
+	DeleteService(svc ipvs.Service) error
+	GetService(svc *ipvs.Service) (*ipvs.Service, error)
+	AddDestination(svc ipvs.Service, dst ipvs.Destination) error
+	UpdateDestination(svc ipvs.Service, dst ipvs.Destination) error
+	DeleteDestination(svc ipvs.Service, dst ipvs.Destination) error
+}
+
+// kernelIPVS is the ipvsInterface programming the kernel through netlink.
+type kernelIPVS struct{}
+
+var _ ipvsInterface = kernelIPVS{}
+
+func (kernelIPVS) AddService(svc ipvs.Service) error    { return ipvs.AddService(svc) }
+func (kernelIPVS) UpdateService(svc ipvs.Service) error { return ipvs.UpdateService(svc) }
+func (kernelIPVS) DeleteService(svc ipvs.Service) error { return ipvs.DeleteService(svc) }
+
+func (kernelIPVS) GetService(svc *ipvs.Service) (*ipvs.Service, error) { return ipvs.GetService(svc) }
+
+func (kernelIPVS) AddDestination(svc ipvs.Service, dst ipvs.Destination) error {
+	return ipvs.AddDestination(svc, dst)
+}
+
+func (kernelIPVS) UpdateDestination(svc ipvs.Service, dst ipvs.Destination) error {
+	return ipvs.UpdateDestination(svc, dst)
+}
+
+func (kernelIPVS) DeleteDestination(svc ipvs.Service, dst ipvs.Destination) error {
+	return ipvs.DeleteDestination(svc, dst)
+}
@@ -1,3 +1,6 @@
+//go:build linux && cgo
+// +build linux,cgo
+
 /*
 Copyright 2021 The Kubernetes Authors.
 
@@ -32,7 +35,6 @@ import (
 type proxier struct {
 	ipFamily v1.IPFamily
 
-	dryRun           bool
 	nodeAddresses    []string
 	schedulingMethod string
 	weight           int32
@@ -41,6 +43,9 @@ type proxier struct {
 
 	dummy netlink.Link
 
+	gracefulTermination *gracefulTerminationManager
+
+	ipvs     ipvsInterface
 	iptables util.IPTableInterface
 	ipset    util.Interface
 	exec     exec.Interface
@@ -71,6 +76,7 @@ type proxier struct {
 
 func NewProxier(ipFamily v1.IPFamily,
 	dummy netlink.Link,
+	ipvsHandle ipvsInterface,
 	ipsetInterface util.Interface,
 	iptInterface util.IPTableInterface,
 	nodeIPs []string,
@@ -83,6 +89,7 @@ func NewProxier(ipFamily v1.IPFamily,
 		nodeAddresses:    nodeIPs,
 		schedulingMethod: schedulingMethod,
 		weight:           weight,
+		ipvs:             ipvsHandle,
 		ipset:            ipsetInterface,
 		iptables:         iptInterface,
 		masqueradeMark:   masqueradeMark,
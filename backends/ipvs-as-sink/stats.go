@@ -0,0 +1,167 @@
+//go:build linux && cgo
+// +build linux,cgo
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvssink
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/seesaw/ipvs"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+var (
+	serverLabels     = []string{"namespace", "service", "virtual_server"}
+	realServerLabels = append(append([]string{}, serverLabels...), "real_server")
+
+	vsActiveConnsDesc = prometheus.NewDesc("kpng_ipvs_virtual_server_active_connections",
+		"The number of active connections of the IPVS virtual server (sum of its real servers)", serverLabels, nil)
+	vsInactiveConnsDesc = prometheus.NewDesc("kpng_ipvs_virtual_server_inactive_connections",
+		"The number of inactive connections of the IPVS virtual server (sum of its real servers)", serverLabels, nil)
+	vsConnsDesc = prometheus.NewDesc("kpng_ipvs_virtual_server_connections_total",
+		"The total number of connections scheduled by the IPVS virtual server", serverLabels, nil)
+	vsBytesDesc = prometheus.NewDesc("kpng_ipvs_virtual_server_bytes_total",
+		"The total number of bytes received (in) and sent (out) by the IPVS virtual server", append(serverLabels, "direction"), nil)
+
+	rsActiveConnsDesc = prometheus.NewDesc("kpng_ipvs_real_server_active_connections",
+		"The number of active connections of the IPVS real server", realServerLabels, nil)
+	rsInactiveConnsDesc = prometheus.NewDesc("kpng_ipvs_real_server_inactive_connections",
+		"The number of inactive connections of the IPVS real server", realServerLabels, nil)
+	rsConnsDesc = prometheus.NewDesc("kpng_ipvs_real_server_connections_total",
+		"The total number of connections scheduled to the IPVS real server", realServerLabels, nil)
+	rsBytesDesc = prometheus.NewDesc("kpng_ipvs_real_server_bytes_total",
+		"The total number of bytes received (in) and sent (out) by the IPVS real server", append(realServerLabels, "direction"), nil)
+)
+
+// virtualServerStats are the statistics of a virtual server and its real servers, read from IPVS.
+type virtualServerStats struct {
+	namespace, service string
+	virtualServer      string
+
+	stats                      ipvs.Stats
+	activeConns, inactiveConns uint32
+
+	realServers []realServerStats
+}
+
+type realServerStats struct {
+	realServer string
+
+	stats                      ipvs.Stats
+	activeConns, inactiveConns uint32
+}
+
+// statsCollector exports the connection statistics of the virtual servers, as read on the last sync (see
+// --connection-stats), so the scrapes don't query IPVS.
+type statsCollector struct {
+	mu             sync.Mutex
+	virtualServers []virtualServerStats
+}
+
+var _ prometheus.Collector = &statsCollector{}
+
+func (c *statsCollector) set(virtualServers []virtualServerStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.virtualServers = virtualServers
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		vsActiveConnsDesc, vsInactiveConnsDesc, vsConnsDesc, vsBytesDesc,
+		rsActiveConnsDesc, rsInactiveConnsDesc, rsConnsDesc, rsBytesDesc,
+	} {
+		ch <- desc
+	}
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, vs := range c.virtualServers {
+		labels := []string{vs.namespace, vs.service, vs.virtualServer}
+
+		ch <- prometheus.MustNewConstMetric(vsActiveConnsDesc, prometheus.GaugeValue, float64(vs.activeConns), labels...)
+		ch <- prometheus.MustNewConstMetric(vsInactiveConnsDesc, prometheus.GaugeValue, float64(vs.inactiveConns), labels...)
+		ch <- prometheus.MustNewConstMetric(vsConnsDesc, prometheus.CounterValue, float64(vs.stats.Connections), labels...)
+		ch <- prometheus.MustNewConstMetric(vsBytesDesc, prometheus.CounterValue, float64(vs.stats.BytesIn), append(labels, "in")...)
+		ch <- prometheus.MustNewConstMetric(vsBytesDesc, prometheus.CounterValue, float64(vs.stats.BytesOut), append(labels, "out")...)
+
+		for _, rs := range vs.realServers {
+			labels := append(labels[:len(labels):len(labels)], rs.realServer)
+
+			ch <- prometheus.MustNewConstMetric(rsActiveConnsDesc, prometheus.GaugeValue, float64(rs.activeConns), labels...)
+			ch <- prometheus.MustNewConstMetric(rsInactiveConnsDesc, prometheus.GaugeValue, float64(rs.inactiveConns), labels...)
+			ch <- prometheus.MustNewConstMetric(rsConnsDesc, prometheus.CounterValue, float64(rs.stats.Connections), labels...)
+			ch <- prometheus.MustNewConstMetric(rsBytesDesc, prometheus.CounterValue, float64(rs.stats.BytesIn), append(labels, "in")...)
+			ch <- prometheus.MustNewConstMetric(rsBytesDesc, prometheus.CounterValue, float64(rs.stats.BytesOut), append(labels, "out")...)
+		}
+	}
+}
+
+// readStats reads the statistics of the virtual servers of the proxier from IPVS.
+func (p *proxier) readStats() (virtualServers []virtualServerStats) {
+	for _, sp := range p.servicePorts.GetByPrefix(nil) {
+		portInfo := sp.Value.(BaseServicePortInfo)
+
+		// keys are <namespace>/<service-name>/<ip>/<protocol>:<port>
+		parts := strings.SplitN(string(sp.Key), "/", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		vs := portInfo.GetVirtualServer().ToService()
+		svc, err := p.ipvs.GetService(&vs)
+		if err != nil {
+			klog.V(2).Infof("failed to read the stats of %s: %v", sp.Key, err)
+			continue
+		}
+
+		stats := virtualServerStats{
+			namespace:     parts[0],
+			service:       parts[1],
+			virtualServer: net.JoinHostPort(svc.Address.String(), strconv.Itoa(int(svc.Port))) + "/" + strings.ToLower(portInfo.Protocol().String()),
+		}
+		if svc.Statistics != nil {
+			stats.stats = svc.Statistics.Stats
+		}
+
+		for _, dst := range svc.Destinations {
+			rs := realServerStats{realServer: net.JoinHostPort(dst.Address.String(), strconv.Itoa(int(dst.Port)))}
+			if dst.Statistics != nil {
+				rs.stats = dst.Statistics.Stats
+				rs.activeConns = dst.Statistics.ActiveConns
+				rs.inactiveConns = dst.Statistics.InactiveConns
+			}
+
+			stats.activeConns += rs.activeConns
+			stats.inactiveConns += rs.inactiveConns
+			stats.realServers = append(stats.realServers, rs)
+		}
+
+		virtualServers = append(virtualServers, stats)
+	}
+	return
+}
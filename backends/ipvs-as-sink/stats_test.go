@@ -0,0 +1,104 @@
+//go:build linux && cgo
+// +build linux,cgo
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvssink
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/seesaw/ipvs"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/lightdiffstore"
+)
+
+// statsIPVS is a dry run IPVS returning fixed statistics.
+type statsIPVS struct{ dryRunIPVS }
+
+func (s statsIPVS) GetService(svc *ipvs.Service) (*ipvs.Service, error) {
+	found, err := s.dryRunIPVS.GetService(svc)
+	if err != nil {
+		return nil, err
+	}
+
+	found.Statistics = &ipvs.ServiceStats{Stats: ipvs.Stats{Connections: 10, BytesIn: 1000, BytesOut: 5000}}
+	for i, dst := range found.Destinations {
+		dst.Statistics = &ipvs.DestinationStats{
+			Stats:         ipvs.Stats{Connections: 5, BytesIn: 500, BytesOut: 2500},
+			ActiveConns:   uint32(i + 1),
+			InactiveConns: 1,
+		}
+	}
+	return found, nil
+}
+
+func TestReadStats(t *testing.T) {
+	p := &proxier{
+		schedulingMethod: "rr",
+		ipvs:             statsIPVS{dryRunIPVS{newDryRunState()}},
+		servicePorts:     lightdiffstore.New(),
+	}
+
+	svc := &localnetv1.Service{Namespace: "ns", Name: "web"}
+	port := &localnetv1.PortMapping{Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 8080}
+
+	portInfo := NewBaseServicePortInfo(svc, port, "10.96.0.1", ClusterIPService, p.schedulingMethod, p.weight)
+	p.servicePorts.Set([]byte(getServicePortKey(getServiceKey(svc), "10.96.0.1", port)), 0, *portInfo)
+	p.addVirtualServer(portInfo)
+
+	vs := portInfo.GetVirtualServer().ToService()
+	for _, ip := range []string{"10.1.0.1", "10.1.0.2"} {
+		if err := p.ipvs.AddDestination(vs, ipvs.Destination{Address: net.ParseIP(ip), Port: 8080, Weight: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &statsCollector{}
+	c.set(p.readStats())
+
+	expected := `
+# HELP kpng_ipvs_virtual_server_active_connections The number of active connections of the IPVS virtual server (sum of its real servers)
+# TYPE kpng_ipvs_virtual_server_active_connections gauge
+kpng_ipvs_virtual_server_active_connections{namespace="ns",service="web",virtual_server="10.96.0.1:80/tcp"} 3
+# HELP kpng_ipvs_virtual_server_bytes_total The total number of bytes received (in) and sent (out) by the IPVS virtual server
+# TYPE kpng_ipvs_virtual_server_bytes_total counter
+kpng_ipvs_virtual_server_bytes_total{direction="in",namespace="ns",service="web",virtual_server="10.96.0.1:80/tcp"} 1000
+kpng_ipvs_virtual_server_bytes_total{direction="out",namespace="ns",service="web",virtual_server="10.96.0.1:80/tcp"} 5000
+# HELP kpng_ipvs_real_server_active_connections The number of active connections of the IPVS real server
+# TYPE kpng_ipvs_real_server_active_connections gauge
+kpng_ipvs_real_server_active_connections{namespace="ns",real_server="10.1.0.1:8080",service="web",virtual_server="10.96.0.1:80/tcp"} 1
+kpng_ipvs_real_server_active_connections{namespace="ns",real_server="10.1.0.2:8080",service="web",virtual_server="10.96.0.1:80/tcp"} 2
+# HELP kpng_ipvs_real_server_inactive_connections The number of inactive connections of the IPVS real server
+# TYPE kpng_ipvs_real_server_inactive_connections gauge
+kpng_ipvs_real_server_inactive_connections{namespace="ns",real_server="10.1.0.1:8080",service="web",virtual_server="10.96.0.1:80/tcp"} 1
+kpng_ipvs_real_server_inactive_connections{namespace="ns",real_server="10.1.0.2:8080",service="web",virtual_server="10.96.0.1:80/tcp"} 1
+`
+
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"kpng_ipvs_virtual_server_active_connections",
+		"kpng_ipvs_virtual_server_bytes_total",
+		"kpng_ipvs_real_server_active_connections",
+		"kpng_ipvs_real_server_inactive_connections",
+	); err != nil {
+		t.Error(err)
+	}
+}
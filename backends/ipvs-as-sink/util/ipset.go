@@ -125,6 +125,9 @@ func (set *IPSet) Validate() bool {
 	return true
 }
 
+// DefaultMaxElem is the max number of elements of the sets created without MaxElem.
+const DefaultMaxElem = 65536
+
 //setIPSetDefaults sets some IPSet fields if not present to their default values.
 func (set *IPSet) setIPSetDefaults() {
 	// Setting default values if not present
@@ -132,7 +135,7 @@ func (set *IPSet) setIPSetDefaults() {
 		set.HashSize = 1024
 	}
 	if set.MaxElem == 0 {
-		set.MaxElem = 65536
+		set.MaxElem = DefaultMaxElem
 	}
 	// Default protocol is IPv4
 	if set.HashFamily == "" {
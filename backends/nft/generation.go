@@ -0,0 +1,79 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nft
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+
+	"k8s.io/klog/v2"
+)
+
+// generationChain holds a single rule commented with the generation of the rule set. It's replaced in the same
+// `nft -f` transaction as the rest of the changes, so external tooling can tell which generation is live:
+//
+//	nft list chain ip k8s_svc kpng_generation
+const generationChain = "kpng_generation"
+
+// generation is the generation of the last rule set rendered (applied or not). It's incremented on each apply, and
+// continues from the live generation after a restart.
+var generation uint64
+
+var generationComment = regexp.MustCompile(`comment "kpng generation ([0-9]+)"`)
+
+// renderGeneration writes the generation chain of the table. It must be written in the table's block, after the flush
+// of the previous generation (done when the table isn't recreated).
+func renderGeneration(out io.Writer) {
+	fmt.Fprintf(out, " chain %s {\n  counter comment \"kpng generation %d\"\n }\n", generationChain, generation)
+}
+
+// parseGeneration returns the generation in the listing of the generation chain.
+func parseGeneration(listing []byte) (gen uint64, ok bool) {
+	match := generationComment.FindSubmatch(listing)
+	if match == nil {
+		return 0, false
+	}
+
+	gen, err := strconv.ParseUint(string(match[1]), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return gen, true
+}
+
+// liveGeneration returns the highest generation of the tables in nft, or 0 if none is found (ie: on the first start).
+func liveGeneration() (live uint64) {
+	for _, table := range allTables {
+		listing, err := exec.Command("nft", "list", "chain", table.Family, table.Name, generationChain).Output()
+		if err != nil {
+			// the table (or its generation chain) doesn't exist yet
+			continue
+		}
+
+		if gen, ok := parseGeneration(listing); ok && gen > live {
+			live = gen
+		}
+	}
+
+	if live != 0 {
+		klog.Infof("continuing from the live nft generation %d", live)
+	}
+	return
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nft
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGenerationRoundTrip(t *testing.T) {
+	defer func(prev uint64) { generation = prev }(generation)
+	generation = 42
+
+	buf := new(bytes.Buffer)
+	renderGeneration(buf)
+
+	if expected := " chain kpng_generation {\n  counter comment \"kpng generation 42\"\n }\n"; buf.String() != expected {
+		t.Errorf("rendered %q, expected %q", buf.String(), expected)
+	}
+
+	// as listed by nft
+	listing := "table ip k8s_svc {\n\tchain kpng_generation {\n\t\tcounter packets 0 bytes 0 comment \"kpng generation 42\"\n\t}\n}\n"
+	if gen, ok := parseGeneration([]byte(listing)); !ok || gen != 42 {
+		t.Errorf("parsed %d (%v), expected 42", gen, ok)
+	}
+
+	if gen, ok := parseGeneration([]byte("table ip k8s_svc {\n}\n")); ok {
+		t.Errorf("parsed %d from a listing without generation", gen)
+	}
+}
@@ -21,7 +21,6 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
@@ -37,7 +36,7 @@ import (
 var (
 	flag = &pflag.FlagSet{}
 
-	dryRun          = flag.Bool("dry-run", false, "dry run (do not apply rules)")
+	dryRun          = flag.Bool("dry-run", false, "dry run (print the full nft script of each sync instead of applying it)")
 	hookPrio        = flag.Int("hook-priority", 0, "nftable hooks priority")
 	skipComments    = flag.Bool("skip-comments", false, "don't comment rules")
 	splitBits       = flag.Int("split-bits", 24, "dispatch services in multiple chains, spliting at the nth bit")
@@ -59,10 +58,8 @@ func BindFlags(flags *pflag.FlagSet) {
 	flags.AddFlagSet(flag)
 }
 
-// FIXME atomic delete with references are currently buggy, so defer it
-const deferDelete = true
-
-// FIXME defer delete also is buggy; having to wait ~1s which is not acceptable...
+// FIXME atomic delete with references are currently buggy (and deferring them to another transaction needs to wait
+// ~1s, which is not acceptable), so the removed elements are only flushed
 const canDeleteChains = false
 
 func PreRun() {
@@ -133,19 +130,23 @@ func Callback(ch <-chan *client.ServiceEndpoints) {
 
 	klog.V(1).Infof("nft rules generated (%s)", time.Since(start))
 
-	// render the rule set
-	//retry:
-	cmdIn, pipeOut := io.Pipe()
+	if generation == 0 && !*dryRun {
+		generation = liveGeneration()
+	}
+	generation++
 
-	deferred := new(bytes.Buffer)
-	go renderNftables(pipeOut, deferred)
+	// render the whole rule set before running nft, so it's applied in a single transaction: nft applies all of it
+	// or nothing, and never an incomplete script
+	script := new(bytes.Buffer)
+	renderNftables(script)
 
 	if *dryRun {
-		io.Copy(ioutil.Discard, cmdIn)
+		fmt.Fprintln(os.Stdout, "# nft script (dry run, not applied)")
+		io.Copy(os.Stdout, script)
 		klog.Info("not running nft (dry run mode)")
 	} else {
 		cmd := exec.Command("nft", "-f", "-")
-		cmd.Stdin = cmdIn
+		cmd.Stdin = script
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 
@@ -154,46 +155,21 @@ func Callback(ch <-chan *client.ServiceEndpoints) {
 		elapsed := time.Since(start)
 
 		if err != nil {
-			klog.Errorf("nft failed: %v (%s)", err, elapsed)
-
-			// ensure render is finished
-			io.Copy(ioutil.Discard, cmdIn)
+			klog.Errorf("nft failed, generation %d not applied: %v (%s)", generation, err, elapsed)
 
 			if !fullResync {
 				// failsafe: rebuild everything
 				klog.Infof("doing a full resync after nft failure")
 				fullResync = true
-				//goto retry
 			}
 			return
 		}
 
-		klog.V(1).Infof("nft ok (%s)", elapsed)
-
-		if deferred.Len() != 0 {
-			klog.V(1).Infof("running deferred nft actions")
-
-			// too fast and deletes fail... :(
-			//time.Sleep(100 * time.Millisecond)
-
-			if klog.V(2).Enabled() {
-				os.Stdout.Write(deferred.Bytes())
-			}
-
-			cmd := exec.Command("nft", "-f", "-")
-			cmd.Stdin = deferred
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-
-			err = cmd.Run()
-			if err != nil {
-				klog.Warning("nft deferred script failed: ", err)
-			}
-		}
+		klog.V(1).Infof("nft ok, generation %d applied (%s)", generation, elapsed)
 	}
 
-	if fullResync {
-		// all done, we can valide the first run
+	if fullResync && !*dryRun {
+		// all done, we can valide the first run (in dry run mode, keep printing the full rule set)
 		fullResync = false
 	}
 }
@@ -246,16 +222,25 @@ func addDispatchChains(table *nftable) {
 		"  type filter hook output priority %d;\n  jump z_filter_all\n", *hookPrio)
 }
 
-func addPostroutingChain(table *nftable, clusterCIDRs []string, localEndpointIPs []string) {
+func addPostroutingChain(table *nftable, clusterCIDRs []string, localEndpointIPs []string, forcedMasqIPs []string) {
 	hasCIDRs := len(clusterCIDRs) != 0
 	hasLocalEPs := len(localEndpointIPs) != 0
+	hasForcedMasq := len(forcedMasqIPs) != 0
 
-	if !hasCIDRs && !hasLocalEPs {
+	if !hasCIDRs && !hasLocalEPs && !hasForcedMasq {
 		return
 	}
 
 	chain := table.Chains.Get("zz_hook_nat_postrouting")
 	fmt.Fprintf(chain, "  type nat hook postrouting priority %d;\n", *hookPrio)
+	if hasForcedMasq {
+		chain.Writeln()
+		if !*skipComments {
+			fmt.Fprint(chain, "  # masquerade all traffic to services forcing it\n")
+		}
+		fmt.Fprint(chain, "  ct original ", table.Family, " daddr { ", strings.Join(forcedMasqIPs, ", "), " } masquerade\n")
+	}
+
 	if hasCIDRs {
 		chain.Writeln()
 		if !*skipComments {
@@ -289,13 +274,11 @@ func addPostroutingChain(table *nftable, clusterCIDRs []string, localEndpointIPs
 	}
 }
 
-func renderNftables(output io.WriteCloser, deferred io.Writer) {
-	defer output.Close()
-
+func renderNftables(output io.Writer) {
 	outputs := make([]io.Writer, 0, 2)
 	outputs = append(outputs, output)
 
-	if klog.V(2).Enabled() {
+	if klog.V(2).Enabled() && !*dryRun {
 		outputs = append(outputs, os.Stdout)
 	}
 
@@ -322,6 +305,8 @@ func renderNftables(output io.WriteCloser, deferred io.Writer) {
 					fmt.Fprintf(out, "flush %s %s %s %s\n", ks.Kind, table.Family, table.Name, item.Key())
 				}
 			}
+
+			fmt.Fprintf(out, "flush chain %s %s %s\n", table.Family, table.Name, generationChain)
 		}
 
 		// create/update changed elements
@@ -331,20 +316,14 @@ func renderNftables(output io.WriteCloser, deferred io.Writer) {
 			io.Copy(out, ki.Item.Value())
 			fmt.Fprintln(out, " }")
 		}
+		renderGeneration(out)
 		fmt.Fprintln(out, "}")
 
 		// delete removed elements (already done by deleting the table on fullResync)
-		if !fullResync {
-			// delete
-			if canDeleteChains {
-				var out io.Writer = out
-				if deferDelete {
-					out = deferred
-				}
-				for _, ks := range table.KindStores() {
-					for _, item := range ks.Store.Deleted() {
-						fmt.Fprintf(out, "delete %s %s %s %s\n", ks.Kind, table.Family, table.Name, item.Key())
-					}
+		if !fullResync && canDeleteChains {
+			for _, ks := range table.KindStores() {
+				for _, item := range ks.Store.Deleted() {
+					fmt.Fprintf(out, "delete %s %s %s %s\n", ks.Kind, table.Family, table.Name, item.Key())
 				}
 			}
 		}
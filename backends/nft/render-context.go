@@ -18,10 +18,13 @@ package nft
 
 import (
 	"bytes"
+	"fmt"
 	"net"
 	"strconv"
 	"strings"
 
+	"k8s.io/klog/v2"
+
 	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
 	"sigs.k8s.io/kpng/client/localsink/fullstate"
 )
@@ -43,6 +46,7 @@ type renderContext struct {
 	chainNets        map[string]bool
 	mapOffsets       []uint64
 	localEndpointIPs []string
+	forcedMasqIPs    []string
 }
 
 func newRenderContext(table *nftable, clusterCIDRs []string, ipMask net.IPMask) *renderContext {
@@ -104,6 +108,10 @@ func (ctx *renderContext) addServiceEndpoints(serviceEndpoints *fullstate.Servic
 		return
 	}
 
+	if svc.ForceMasquerade {
+		ctx.forcedMasqIPs = append(ctx.forcedMasqIPs, ips...)
+	}
+
 	for _, i := range []struct {
 		suffix, target string
 	}{
@@ -146,7 +154,7 @@ func (ctx *renderContext) addServiceEndpoints(serviceEndpoints *fullstate.Servic
 func (ctx *renderContext) Finalize() {
 	ctx.table.RunDeferred()
 	addDispatchChains(ctx.table)
-	addPostroutingChain(ctx.table, ctx.clusterCIDRs, ctx.localEndpointIPs)
+	addPostroutingChain(ctx.table, ctx.clusterCIDRs, ctx.localEndpointIPs, ctx.forcedMasqIPs)
 	ctx.table.Done()
 }
 
@@ -176,10 +184,16 @@ func (ctx *renderContext) epIPs(endpoints []*localnetv1.Endpoint) (endpointIPs [
 	return
 }
 
-func (ctx *renderContext) recordNodePort(port *localnetv1.PortMapping, targetChain string) {
+func (ctx *renderContext) recordNodePort(svc *localnetv1.Service, port *localnetv1.PortMapping, targetChain string) {
 	chain := ctx.table.Chains.Get("nodeports_dnat")
 	if strings.HasSuffix(targetChain, "_filter") {
 		chain = ctx.table.Chains.Get("nodeports_filter")
+	} else if limit, err := svc.GetNodePortRateLimit(); err != nil {
+		klog.Errorf("not limiting the node ports of service %s: %v", svc.NamespacedName(), err)
+	} else if limit != nil {
+		// only the first packet of a connection goes through the nat chains, so this limits the new connections
+		fmt.Fprintf(chain, "  %s %d limit rate over %d/second burst %d packets drop\n",
+			protoMatch(port.Protocol), port.NodePort, limit.PerSecond, limit.Burst)
 	}
 
 	chain.WriteString("  ")
@@ -84,7 +84,7 @@ func (ctx *renderContext) addSvcChain(svc *localnetv1.Service, epIPs []EpIP) {
 				chain.WriteString(mDAddrLocal)
 
 				// record this chain is associated to a node port
-				ctx.recordNodePort(port, chainName)
+				ctx.recordNodePort(svc, port, chainName)
 			}
 			chain.WriteString(protoMatch(port.Protocol))
 			chain.WriteByte(' ')
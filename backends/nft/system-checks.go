@@ -31,6 +31,11 @@ func checkMapIndexBug() {
 		return
 	}
 
+	if *dryRun {
+		klog.Info("not checking for NFT hash bug (dry run mode)")
+		return
+	}
+
 	klog.Info("checking for NFT hash bug")
 
 	// check the nft vmap bug (0.9.5 but protect against the whole class)
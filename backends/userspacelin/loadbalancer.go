@@ -32,6 +32,8 @@ type LoadBalancer interface {
 	DeleteService(service iptables.ServicePortName)
 	CleanupStaleStickySessions(service iptables.ServicePortName)
 	ServiceHasEndpoints(service iptables.ServicePortName) bool
+	// ServiceHasEndpoint checks whether the "ip:port" endpoint is still an endpoint of the service-port.
+	ServiceHasEndpoint(service iptables.ServicePortName, endpoint string) bool
 
 	// For userspace because we dont have an EndpointChangeTracker which can auto lookup services behind the scenes,
 	// we need to send this explicitly.
@@ -0,0 +1,57 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userspacelin
+
+import (
+	"encoding/binary"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// originalDestination returns the address the client connected to before it was redirected to the proxy port (the
+// service's cluster IP, an external or load balancer IP, or the node port), or the proxy's address if it's unknown.
+func originalDestination(conn *net.TCPConn) *net.TCPAddr {
+	local := conn.LocalAddr().(*net.TCPAddr)
+	if local.IP.To4() == nil {
+		return local // the redirections are IPv4 only
+	}
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return local
+	}
+
+	var mreq *unix.IPv6Mreq
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		// the sockaddr_in of the original destination, read as the only getsockopt result type large enough
+		mreq, sockErr = unix.GetsockoptIPv6Mreq(int(fd), unix.SOL_IP, unix.SO_ORIGINAL_DST)
+	})
+	if err != nil || sockErr != nil {
+		return local
+	}
+
+	addr := mreq.Multiaddr
+	return &net.TCPAddr{
+		IP:   net.IPv4(addr[4], addr[5], addr[6], addr[7]),
+		Port: int(binary.BigEndian.Uint16(addr[2:4])),
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userspacelin
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+)
+
+const (
+	// proxyProtocolAnnotation selects the PROXY protocol of a service, overriding --proxy-protocol.
+	proxyProtocolAnnotation = "kpng.sigs.k8s.io/userspace-proxy-protocol"
+
+	proxyProtocolNone = "none"
+	proxyProtocolV2   = "v2"
+)
+
+// proxyProtocolV2Signature starts the PROXY protocol v2 headers (see the haproxy's proxy-protocol.txt).
+var proxyProtocolV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+const (
+	proxyProtocolV2Proxy = 0x21 // version 2, PROXY command
+
+	proxyProtocolTCP4 = 0x11 // AF_INET, STREAM
+	proxyProtocolTCP6 = 0x21 // AF_INET6, STREAM
+)
+
+// validateProxyProtocol checks the value of --proxy-protocol.
+func validateProxyProtocol(proxyProtocol string) error {
+	switch proxyProtocol {
+	case proxyProtocolNone, proxyProtocolV2:
+		return nil
+	}
+	return fmt.Errorf("invalid PROXY protocol %q (must be %s or %s)", proxyProtocol, proxyProtocolNone, proxyProtocolV2)
+}
+
+// useProxyProtocol returns true if the connections to the endpoints of the service start with a PROXY protocol
+// header.
+func useProxyProtocol(service *localnetv1.Service, proxyProtocol string) bool {
+	if value, ok := service.Annotations[proxyProtocolAnnotation]; ok {
+		return value == proxyProtocolV2
+	}
+	return proxyProtocol == proxyProtocolV2
+}
+
+// proxyProtocolV2Header returns the PROXY protocol v2 header of a TCP connection from src to dst, so the endpoint
+// gets the client's address instead of the proxy's. The IPv4 addresses are sent as IPv4-mapped IPv6 addresses if
+// the other one is an IPv6 address.
+func proxyProtocolV2Header(src, dst *net.TCPAddr) []byte {
+	family, srcIP, dstIP := byte(proxyProtocolTCP4), src.IP.To4(), dst.IP.To4()
+	if srcIP == nil || dstIP == nil {
+		family, srcIP, dstIP = proxyProtocolTCP6, src.IP.To16(), dst.IP.To16()
+	}
+
+	addressLen := 2*len(srcIP) + 4
+
+	header := make([]byte, 0, len(proxyProtocolV2Signature)+4+addressLen)
+	header = append(header, proxyProtocolV2Signature...)
+	header = append(header, proxyProtocolV2Proxy, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(addressLen))
+	header = append(header, srcIP...)
+	header = append(header, dstIP...)
+	header = binary.BigEndian.AppendUint16(header, uint16(src.Port))
+	header = binary.BigEndian.AppendUint16(header, uint16(dst.Port))
+
+	return header
+}
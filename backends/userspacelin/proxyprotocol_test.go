@@ -0,0 +1,139 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userspacelin
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/backends/iptables"
+)
+
+func TestProxyProtocolV2Header(t *testing.T) {
+	for _, test := range []struct {
+		src, dst *net.TCPAddr
+		expected []byte
+	}{
+		{
+			src: &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 40000},
+			dst: &net.TCPAddr{IP: net.ParseIP("10.96.0.1"), Port: 443},
+			expected: []byte{
+				0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A,
+				0x21, 0x11, 0x00, 12,
+				192, 0, 2, 10,
+				10, 96, 0, 1,
+				0x9C, 0x40, 0x01, 0xBB,
+			},
+		},
+		{
+			src: &net.TCPAddr{IP: net.ParseIP("2001:db8::10"), Port: 40000},
+			dst: &net.TCPAddr{IP: net.ParseIP("10.96.0.1"), Port: 443},
+			expected: []byte{
+				0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A,
+				0x21, 0x21, 0x00, 36,
+				0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x10,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 10, 96, 0, 1,
+				0x9C, 0x40, 0x01, 0xBB,
+			},
+		},
+	} {
+		if header := proxyProtocolV2Header(test.src, test.dst); !bytes.Equal(header, test.expected) {
+			t.Errorf("%v -> %v: expected\n%x\ngot\n%x", test.src, test.dst, test.expected, header)
+		}
+	}
+}
+
+func TestUseProxyProtocol(t *testing.T) {
+	annotated := func(value string) *localnetv1.Service {
+		return &localnetv1.Service{Annotations: map[string]string{proxyProtocolAnnotation: value}}
+	}
+
+	for _, test := range []struct {
+		service       *localnetv1.Service
+		proxyProtocol string
+		expected      bool
+	}{
+		{&localnetv1.Service{}, proxyProtocolNone, false},
+		{&localnetv1.Service{}, proxyProtocolV2, true},
+		{annotated(proxyProtocolV2), proxyProtocolNone, true},
+		{annotated(proxyProtocolNone), proxyProtocolV2, false},
+	} {
+		if use := useProxyProtocol(test.service, test.proxyProtocol); use != test.expected {
+			t.Errorf("%v with --proxy-protocol=%s: expected %v, got %v", test.service.Annotations, test.proxyProtocol, test.expected, use)
+		}
+	}
+
+	if err := validateProxyProtocol("v1"); err == nil {
+		t.Error("expected v1 to be invalid")
+	}
+}
+
+func TestTCPProxyProtocol(t *testing.T) {
+	endpoint, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer endpoint.Close()
+
+	lb := &fixedLoadBalancer{endpoint: endpoint.Addr().String()}
+
+	sock, err := newProxySocket(localnetv1.Protocol_TCP, net.ParseIP("127.0.0.1"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sock.Close()
+
+	info := &ServiceInfo{isAliveAtomic: 1}
+	info.setProxyProtocol(true)
+	service := iptables.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}, Port: "http"}
+
+	go sock.ProxyLoop(service, info, lb)
+
+	client, err := net.Dial("tcp", sock.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := endpoint.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// not redirected, so the original destination is the proxy's address
+	expected := append(proxyProtocolV2Header(client.LocalAddr().(*net.TCPAddr), client.RemoteAddr().(*net.TCPAddr)), "ping"...)
+
+	received := make([]byte, len(expected))
+	if _, err := io.ReadFull(conn, received); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, expected) {
+		t.Errorf("expected\n%x\ngot\n%x", expected, received)
+	}
+}
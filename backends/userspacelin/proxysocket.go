@@ -148,6 +148,15 @@ func (tcp *tcpProxySocket) ProxyLoop(service iptables.ServicePortName, myInfo *S
 			inConn.Close()
 			continue
 		}
+		if myInfo.UsesProxyProtocol() {
+			header := proxyProtocolV2Header(inConn.RemoteAddr().(*net.TCPAddr), originalDestination(inConn.(*net.TCPConn)))
+			if _, err := outConn.Write(header); err != nil {
+				klog.Errorf("Failed to send the PROXY protocol header to %v: %v", outConn.RemoteAddr(), err)
+				inConn.Close()
+				outConn.Close()
+				continue
+			}
+		}
 		// Spin up an async copy loop.
 		go ProxyTCP(inConn.(*net.TCPConn), outConn.(*net.TCPConn))
 	}
@@ -206,7 +215,49 @@ func newClientCache() *ClientCache {
 	return &ClientCache{Clients: map[string]net.Conn{}}
 }
 
+// remove removes the client's association if it is still svrConn (it may have been replaced after a failure).
+func (cache *ClientCache) remove(cliAddr string, svrConn net.Conn) {
+	cache.Mu.Lock()
+	defer cache.Mu.Unlock()
+
+	if cache.Clients[cliAddr] == svrConn {
+		delete(cache.Clients, cliAddr)
+	}
+}
+
+// closeAll breaks all the associations, ending their proxyClient goroutines.
+func (cache *ClientCache) closeAll() {
+	cache.Mu.Lock()
+	defer cache.Mu.Unlock()
+
+	for cliAddr, svrConn := range cache.Clients {
+		svrConn.Close()
+		delete(cache.Clients, cliAddr)
+	}
+}
+
+// closeStale breaks the associations to the endpoints not served anymore, so the next datagrams of their
+// clients are sent to a new endpoint. It returns the number of associations closed.
+func (cache *ClientCache) closeStale(isServed func(endpoint string) bool) (count int) {
+	cache.Mu.Lock()
+	defer cache.Mu.Unlock()
+
+	for cliAddr, svrConn := range cache.Clients {
+		if isServed(svrConn.RemoteAddr().String()) {
+			continue
+		}
+		klog.V(3).Infof("Closing UDP association from %s to stale endpoint %s", cliAddr, svrConn.RemoteAddr())
+		svrConn.Close()
+		delete(cache.Clients, cliAddr)
+		count++
+	}
+	return
+}
+
 func (udp *udpProxySocket) ProxyLoop(service iptables.ServicePortName, myInfo *ServiceInfo, loadBalancer LoadBalancer) {
+	// the socket is closed, so are the associations of its clients
+	defer myInfo.ActiveClients.closeAll()
+
 	var buffer [4096]byte // 4KiB should be enough for most whole-packets
 	for {
 		if !myInfo.IsAlive() {
@@ -224,6 +275,10 @@ func (udp *udpProxySocket) ProxyLoop(service iptables.ServicePortName, myInfo *S
 					continue
 				}
 			}
+			if isClosedError(err) || !myInfo.IsAlive() {
+				// Then the service port was just closed so the read failure is to be expected.
+				break
+			}
 			klog.Errorf("ReadFrom failed, exiting ProxyLoop: %v", err)
 			break
 		}
@@ -232,19 +287,22 @@ func (udp *udpProxySocket) ProxyLoop(service iptables.ServicePortName, myInfo *S
 		if err != nil {
 			continue
 		}
+		// Extend the idle timeout before the write, so the association can't expire while it is active.
+		err = svrConn.SetDeadline(time.Now().Add(myInfo.Timeout))
+		if err != nil {
+			klog.Errorf("SetDeadline failed: %v", err)
+			continue
+		}
 		// TODO: It would be nice to let the goroutine handle this write, but we don't
 		// really want to copy the buffer.  We could do a pool of buffers or something.
 		_, err = svrConn.Write(buffer[0:n])
 		if err != nil {
 			if !logTimeout(err) {
 				klog.Errorf("Write failed: %v", err)
-				// TODO: Maybe tear down the goroutine for this client/server pair?
 			}
-			continue
-		}
-		err = svrConn.SetDeadline(time.Now().Add(myInfo.Timeout))
-		if err != nil {
-			klog.Errorf("SetDeadline failed: %v", err)
+			// Tear down the association, the next datagram of this client will open a new one.
+			svrConn.Close()
+			myInfo.ActiveClients.remove(cliAddr.String(), svrConn)
 			continue
 		}
 	}
@@ -266,6 +324,7 @@ func (udp *udpProxySocket) getBackendConn(activeClients *ClientCache, cliAddr ne
 		}
 		if err = svrConn.SetDeadline(time.Now().Add(timeout)); err != nil {
 			klog.Errorf("SetDeadline failed: %v", err)
+			svrConn.Close()
 			return nil, err
 		}
 		activeClients.Clients[cliAddr.String()] = svrConn
@@ -277,15 +336,18 @@ func (udp *udpProxySocket) getBackendConn(activeClients *ClientCache, cliAddr ne
 	return svrConn, nil
 }
 
-// This function is expected to be called as a goroutine.
-// TODO: Track and log bytes copied, like TCP
+// proxyClient copies the replies of the backend to the client until the association is idle for longer than the
+// timeout or is closed. This function is expected to be called as a goroutine.
 func (udp *udpProxySocket) proxyClient(cliAddr net.Addr, svrConn net.Conn, activeClients *ClientCache, timeout time.Duration) {
 	defer svrConn.Close()
+	defer activeClients.remove(cliAddr.String(), svrConn)
+
 	var buffer [4096]byte
+	copied := 0
 	for {
 		n, err := svrConn.Read(buffer[0:])
 		if err != nil {
-			if !logTimeout(err) {
+			if !logTimeout(err) && !isClosedError(err) {
 				klog.Errorf("Read failed: %v", err)
 			}
 			break
@@ -297,13 +359,12 @@ func (udp *udpProxySocket) proxyClient(cliAddr net.Addr, svrConn net.Conn, activ
 		}
 		_, err = udp.WriteTo(buffer[0:n], cliAddr)
 		if err != nil {
-			if !logTimeout(err) {
+			if !logTimeout(err) && !isClosedError(err) {
 				klog.Errorf("WriteTo failed: %v", err)
 			}
 			break
 		}
+		copied += n
 	}
-	activeClients.Mu.Lock()
-	delete(activeClients.Clients, cliAddr.String())
-	activeClients.Mu.Unlock()
+	klog.V(4).Infof("Copied %d bytes from backend: %s -> %s", copied, svrConn.RemoteAddr(), cliAddr)
 }
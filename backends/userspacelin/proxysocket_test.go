@@ -0,0 +1,164 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userspacelin
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/backends/iptables"
+)
+
+// fixedLoadBalancer always returns the same endpoint.
+type fixedLoadBalancer struct {
+	LoadBalancer
+	mu       sync.Mutex
+	endpoint string
+}
+
+func (lb *fixedLoadBalancer) setEndpoint(endpoint string) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.endpoint = endpoint
+}
+
+func (lb *fixedLoadBalancer) NextEndpoint(iptables.ServicePortName, net.Addr, bool) (string, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.endpoint, nil
+}
+
+func (lb *fixedLoadBalancer) ServiceHasEndpoint(_ iptables.ServicePortName, endpoint string) bool {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return endpoint == lb.endpoint
+}
+
+func udpEchoServer(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		var buffer [4096]byte
+		for {
+			n, addr, err := conn.ReadFrom(buffer[:])
+			if err != nil {
+				return
+			}
+			conn.WriteTo(buffer[:n], addr)
+		}
+	}()
+	return conn
+}
+
+func clientCount(info *ServiceInfo) int {
+	info.ActiveClients.Mu.Lock()
+	defer info.ActiveClients.Mu.Unlock()
+	return len(info.ActiveClients.Clients)
+}
+
+func waitClientCount(t *testing.T, info *ServiceInfo, expected int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for clientCount(info) != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d UDP clients, got %d", expected, clientCount(info))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestUDPProxy(t *testing.T) {
+	echo := udpEchoServer(t)
+	defer echo.Close()
+
+	lb := &fixedLoadBalancer{endpoint: echo.LocalAddr().String()}
+
+	sock, err := newProxySocket(localnetv1.Protocol_UDP, net.ParseIP("127.0.0.1"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := &ServiceInfo{Timeout: 100 * time.Millisecond, ActiveClients: newClientCache(), isAliveAtomic: 1}
+	service := iptables.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "default", Name: "dns"}, Port: "dns"}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sock.ProxyLoop(service, info, lb)
+	}()
+
+	client, err := net.Dial("udp", sock.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	roundTrip := func() {
+		t.Helper()
+		if _, err := client.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var buffer [16]byte
+		n, err := client.Read(buffer[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply := string(buffer[:n]); reply != "ping" {
+			t.Fatalf("unexpected reply %q", reply)
+		}
+	}
+
+	// the association is reused while active
+	roundTrip()
+	roundTrip()
+	waitClientCount(t, info, 1)
+
+	// and cleaned up when idle
+	waitClientCount(t, info, 0)
+
+	// a new association is made on the next datagram, and closed when its endpoint is removed
+	roundTrip()
+	if count := info.ActiveClients.closeStale(func(string) bool { return true }); count != 0 {
+		t.Errorf("closed %d associations to served endpoints", count)
+	}
+	lb.setEndpoint("127.0.0.1:1")
+	if count := info.ActiveClients.closeStale(func(ep string) bool { return lb.ServiceHasEndpoint(service, ep) }); count != 1 {
+		t.Errorf("expected 1 stale association closed, got %d", count)
+	}
+	waitClientCount(t, info, 0)
+
+	// stopping the service ends the loop and its associations
+	lb.setEndpoint(echo.LocalAddr().String())
+	roundTrip()
+
+	info.setAlive(false)
+	sock.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ProxyLoop did not exit")
+	}
+	waitClientCount(t, info, 0)
+}
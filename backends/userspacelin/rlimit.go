@@ -1,4 +1,6 @@
+//go:build !windows
 // +build !windows
+
 /*
 Copyright 2021 The Kubernetes Authors.
 
@@ -79,6 +79,16 @@ func newAffinityPolicy(affinityClientIP *localnetv1.ClientIPAffinity, ttlSeconds
 	}
 }
 
+// hasEndpoint returns true if the "ip:port" endpoint is one of the state's endpoints.
+func (state *balancerState) hasEndpoint(endpoint string) bool {
+	for _, ep := range state.endpoints {
+		if ep == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
 // NewLoadBalancerRR returns a new LoadBalancerRR.
 func NewLoadBalancerRR() *LoadBalancerRR {
 	return &LoadBalancerRR{
@@ -89,7 +99,7 @@ func NewLoadBalancerRR() *LoadBalancerRR {
 func (lb *LoadBalancerRR) NewService(svcPort iptables.ServicePortName, affinityType *localnetv1.ClientIPAffinity, ttlSeconds int) error {
 	klog.V(4).Infof("LoadBalancerRR NewService %q", svcPort)
 	lb.lock.Lock()
-	lb.lock.Unlock()
+	defer lb.lock.Unlock()
 	lb.newServiceInternal(svcPort, affinityType, ttlSeconds)
 	return nil
 }
@@ -100,13 +110,17 @@ func (lb *LoadBalancerRR) newServiceInternal(svcPort iptables.ServicePortName, a
 		ttlSeconds = int(v1.DefaultClientIPServiceAffinitySeconds) //default to 3 hours if not specified.  Should 0 be unlimited instead????
 	}
 
-	if _, exists := lb.services[svcPort]; !exists {
-		lb.services[svcPort] = &balancerState{affinity: *newAffinityPolicy(affinityClientIP, ttlSeconds)}
+	state, exists := lb.services[svcPort]
+	if !exists {
+		state = &balancerState{affinity: *newAffinityPolicy(affinityClientIP, ttlSeconds)}
+		lb.services[svcPort] = state
 		klog.V(4).Infof("LoadBalancerRR service %q did not exist, created", svcPort)
-	} else if affinityClientIP != nil {
-		lb.services[svcPort].affinity.affinityClientIP = true
+	} else if state.affinity.affinityClientIP != (affinityClientIP != nil) || state.affinity.ttlSeconds != ttlSeconds {
+		// the session affinity of the service changed, the clients are balanced again
+		klog.V(4).Infof("LoadBalancerRR service %q session affinity changed: ClientIP=%t, timeout=%ds", svcPort, affinityClientIP != nil, ttlSeconds)
+		state.affinity = *newAffinityPolicy(affinityClientIP, ttlSeconds)
 	}
-	return lb.services[svcPort]
+	return state
 }
 
 func (lb *LoadBalancerRR) DeleteService(svcPort iptables.ServicePortName) {
@@ -135,6 +149,14 @@ func (lb *LoadBalancerRR) ServiceHasEndpoints(svcPort iptables.ServicePortName)
 	return exists && state != nil && len(state.endpoints) > 0
 }
 
+// ServiceHasEndpoint checks whether an endpoint is in a service entry.
+func (lb *LoadBalancerRR) ServiceHasEndpoint(svcPort iptables.ServicePortName, endpoint string) bool {
+	lb.lock.RLock()
+	defer lb.lock.RUnlock()
+	state, exists := lb.services[svcPort]
+	return exists && state != nil && state.hasEndpoint(endpoint)
+}
+
 // NextEndpoint returns a service endpoint.
 // The service endpoint is chosen using the round-robin algorithm.
 func (lb *LoadBalancerRR) NextEndpoint(svcPort iptables.ServicePortName, srcAddr net.Addr, sessionAffinityReset bool) (string, error) {
@@ -164,6 +186,12 @@ func (lb *LoadBalancerRR) NextEndpoint(svcPort iptables.ServicePortName, srcAddr
 		}
 		if !sessionAffinityReset {
 			sessionAffinity, exists := state.affinity.affinityMap[ipaddr]
+			if exists && !state.hasEndpoint(sessionAffinity.endpoint) {
+				// the endpoint disappeared, the client gets a new one
+				klog.V(4).Infof("NextEndpoint for service %q from IP %s: endpoint %s of the session is gone", svcPort, ipaddr, sessionAffinity.endpoint)
+				delete(state.affinity.affinityMap, ipaddr)
+				exists = false
+			}
 			if exists && int(time.Since(sessionAffinity.lastUsed).Seconds()) < state.affinity.ttlSeconds {
 				// Affinity wins.
 				endpoint := sessionAffinity.endpoint
@@ -240,14 +268,18 @@ func (lb *LoadBalancerRR) OnEndpointsAdd(ep *localnetv1.Endpoint, svc *localnetv
 		newEndpoints := portsToEndpoints[portname]
 		state, exists := lb.services[svcPort]
 		if state != nil {
-			newEndpoints = append(newEndpoints, state.endpoints...)
+			for _, ep := range state.endpoints {
+				if !containsString(newEndpoints, ep) {
+					newEndpoints = append(newEndpoints, ep)
+				}
+			}
 		}
 		if !exists || state == nil || len(newEndpoints) > 0 {
 			klog.V(1).Infof("LoadBalancerRR: Setting endpoints for %s to %+v", svcPort, newEndpoints)
 			// OnEndpointsAdd can be called without NewService being called externally.
 			// To be safe we will call it here.  A new service will only be created
 			// if one does not already exist.
-			state = lb.newServiceInternal(svcPort, svc.GetClientIP(), 0)
+			state = lb.newServiceInternal(svcPort, svc.GetClientIP(), int(svc.GetClientIP().GetTimeoutSeconds()))
 			state.endpoints = ShuffleStrings(newEndpoints)
 			// Reset the round-robin index.
 			state.index = 0
@@ -319,18 +351,49 @@ func (lb *LoadBalancerRR) resetService(svcPort iptables.ServicePortName) {
 	}
 }
 
+// OnEndpointsDelete removes the endpoint from the service's ports, and the sessions of the clients it served.
 func (lb *LoadBalancerRR) OnEndpointsDelete(ep *localnetv1.Endpoint, svc *localnetv1.Service) {
 	portsToEndpoints := buildPortsToEndpointsMap(ep, svc)
 
 	lb.lock.Lock()
 	defer lb.lock.Unlock()
 
-	for portname := range portsToEndpoints {
+	for portname, removed := range portsToEndpoints {
 		svcPort := iptables.ServicePortName{NamespacedName: types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}, Port: portname}
-		lb.resetService(svcPort)
+
+		state, exists := lb.services[svcPort]
+		if !exists || state == nil {
+			continue
+		}
+
+		endpoints := make([]string, 0, len(state.endpoints))
+		for _, endpoint := range state.endpoints {
+			if !containsString(removed, endpoint) {
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+
+		if len(endpoints) == 0 {
+			lb.resetService(svcPort)
+			continue
+		}
+
+		klog.V(1).Infof("LoadBalancerRR: Setting endpoints for %s to %+v", svcPort, endpoints)
+		lb.removeStaleAffinity(svcPort, endpoints)
+		state.endpoints = endpoints
+		state.index = state.index % len(endpoints)
 	}
 }
 
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 func (lb *LoadBalancerRR) OnEndpointsSynced() {
 }
 
@@ -0,0 +1,145 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userspacelin
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/backends/iptables"
+)
+
+func affinityService(timeoutSeconds int32) *localnetv1.Service {
+	svc := &localnetv1.Service{
+		Namespace: "default",
+		Name:      "web",
+		Ports:     []*localnetv1.PortMapping{{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 8080}},
+	}
+	if timeoutSeconds != 0 {
+		svc.SessionAffinity = &localnetv1.Service_ClientIP{ClientIP: &localnetv1.ClientIPAffinity{TimeoutSeconds: timeoutSeconds}}
+	}
+	return svc
+}
+
+func endpointIP(ip string) *localnetv1.Endpoint {
+	return &localnetv1.Endpoint{IPs: localnetv1.NewIPSet(ip)}
+}
+
+func nextEndpoint(t *testing.T, lb *LoadBalancerRR, svcPort iptables.ServicePortName, client string) string {
+	t.Helper()
+	ep, err := lb.NextEndpoint(svcPort, &net.TCPAddr{IP: net.ParseIP(client), Port: 40000}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ep
+}
+
+func TestLoadBalancerClientIPAffinity(t *testing.T) {
+	svc := affinityService(60)
+	svcPort := iptables.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}, Port: "http"}
+
+	lb := NewLoadBalancerRR()
+	lb.NewService(svcPort, svc.GetClientIP(), 60)
+	for _, ip := range []string{"10.1.0.1", "10.1.0.2", "10.1.0.3"} {
+		lb.OnEndpointsAdd(endpointIP(ip), svc)
+	}
+
+	// sessions stick to their endpoint
+	first := nextEndpoint(t, lb, svcPort, "192.168.0.1")
+	for i := 0; i < 5; i++ {
+		if ep := nextEndpoint(t, lb, svcPort, "192.168.0.1"); ep != first {
+			t.Fatalf("session moved from %s to %s", first, ep)
+		}
+	}
+
+	// other clients are still balanced
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		seen[nextEndpoint(t, lb, svcPort, "192.168.1."+strconv.Itoa(i+1))] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("expected new clients on the 3 endpoints, got %v", seen)
+	}
+
+	// expired sessions are balanced again
+	lb.services[svcPort].affinity.affinityMap["192.168.0.1"].lastUsed = time.Now().Add(-time.Minute)
+	if ep := nextEndpoint(t, lb, svcPort, "192.168.0.1"); ep == first {
+		t.Errorf("expired session stayed on %s", ep)
+	}
+
+	// sessions on a deleted endpoint are reset, the others are kept
+	current := nextEndpoint(t, lb, svcPort, "192.168.0.1")
+	other := nextEndpoint(t, lb, svcPort, "192.168.0.2")
+	for other == current {
+		delete(lb.services[svcPort].affinity.affinityMap, "192.168.0.2")
+		other = nextEndpoint(t, lb, svcPort, "192.168.0.2")
+	}
+
+	host, _, _ := net.SplitHostPort(current)
+	lb.OnEndpointsDelete(endpointIP(host), svc)
+
+	if lb.ServiceHasEndpoint(svcPort, current) {
+		t.Fatalf("endpoint %s not deleted", current)
+	}
+	if ep := nextEndpoint(t, lb, svcPort, "192.168.0.1"); ep == current {
+		t.Errorf("session stayed on deleted endpoint %s", ep)
+	}
+	if ep := nextEndpoint(t, lb, svcPort, "192.168.0.2"); ep != other {
+		t.Errorf("session moved from %s to %s after another endpoint was deleted", other, ep)
+	}
+}
+
+func TestLoadBalancerAffinityChange(t *testing.T) {
+	svc := affinityService(0)
+	svcPort := iptables.ServicePortName{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"}, Port: "http"}
+
+	lb := NewLoadBalancerRR()
+	lb.NewService(svcPort, nil, 0)
+	lb.OnEndpointsAdd(endpointIP("10.1.0.1"), svc)
+	lb.OnEndpointsAdd(endpointIP("10.1.0.2"), svc)
+
+	if n := len(lb.services[svcPort].endpoints); n != 2 {
+		t.Fatalf("expected 2 endpoints, got %d", n)
+	}
+
+	// without affinity, a client is balanced over the endpoints
+	if nextEndpoint(t, lb, svcPort, "192.168.0.1") == nextEndpoint(t, lb, svcPort, "192.168.0.1") {
+		t.Error("client stuck to an endpoint without session affinity")
+	}
+
+	// enabling the affinity makes the sessions sticky with the service's timeout
+	svc = affinityService(30)
+	lb.NewService(svcPort, svc.GetClientIP(), 30)
+
+	if ttl := lb.services[svcPort].affinity.ttlSeconds; ttl != 30 {
+		t.Errorf("expected a 30s session timeout, got %d", ttl)
+	}
+	if nextEndpoint(t, lb, svcPort, "192.168.0.1") != nextEndpoint(t, lb, svcPort, "192.168.0.1") {
+		t.Error("client not stuck to an endpoint with session affinity")
+	}
+
+	// and disabling it drops the sessions
+	lb.NewService(svcPort, nil, 0)
+	if n := len(lb.services[svcPort].affinity.affinityMap); n != 0 {
+		t.Errorf("expected no session left, got %d", n)
+	}
+}
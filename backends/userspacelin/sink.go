@@ -34,9 +34,11 @@ import (
 	"github.com/spf13/pflag"
 
 	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/backendcmd"
 	"sigs.k8s.io/kpng/client/localsink"
 	"sigs.k8s.io/kpng/client/localsink/decoder"
 	"sigs.k8s.io/kpng/client/localsink/filterreset"
+	"sigs.k8s.io/kpng/client/syncrunner"
 )
 
 type Backend struct {
@@ -49,9 +51,14 @@ type Backend struct {
 
 var wg = sync.WaitGroup{}
 var proxier *UserspaceLinux
+var syncConfig syncrunner.Config
+var udpIdleTimeout time.Duration
+var proxyProtocol string
+var proxyPortRange utilnet.PortRange
 
 // var usImpl map[v1.IPFamily]*UserspaceLinux
 var _ decoder.Interface = &Backend{}
+var _ backendcmd.Resyncer = &Backend{}
 
 func New() *Backend {
 	return &Backend{}
@@ -62,9 +69,23 @@ func (s *Backend) Sink() localsink.Sink {
 }
 
 func (s *Backend) BindFlags(flags *pflag.FlagSet) {
+	syncConfig.BindFlags(flags)
+	flags.Var(&proxyPortRange, "proxy-port-range", "Range of host ports (beginPort-endPort, single port or beginPort+offset, inclusive) the services are proxied on; random ports if empty")
+	flags.DurationVar(&udpIdleTimeout, "udp-idle-timeout", 250*time.Millisecond, "How long an idle UDP association between a client and an endpoint is kept open (must be greater than 0)")
+	flags.StringVar(&proxyProtocol, "proxy-protocol", proxyProtocolNone, "PROXY protocol header sent on the TCP connections to the endpoints, so they get the clients' addresses: "+proxyProtocolNone+" or "+proxyProtocolV2+" (overridden by the "+proxyProtocolAnnotation+" annotation of the services)")
 }
 
 func (s *Backend) Setup() {
+	if err := syncConfig.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if udpIdleTimeout <= 0 {
+		log.Fatal("--udp-idle-timeout must be greater than 0")
+	}
+	if err := validateProxyProtocol(proxyProtocol); err != nil {
+		log.Fatal(err)
+	}
+
 	var err error
 	// hostname = s.NodeName
 	// make a proxier for ipv4
@@ -76,20 +97,31 @@ func (s *Backend) Setup() {
 		netutils.ParseIPSloppy("0.0.0.0"),
 		iptables,
 		execer,
-		utilnet.PortRange{Base: 30000, Size: 2768},
-		time.Duration(15),
-		time.Duration(15),
-		time.Millisecond,
+		proxyPortRange,
+		syncConfig,
+		udpIdleTimeout,
+		proxyProtocol,
 	)
 	if err != nil {
 		log.Fatal("unable to create proxier: ", err)
 	}
+
+	go proxier.SyncLoop()
 }
 
 func (s *Backend) Reset() { /* noop, we're wrapped in filterreset */ }
 
 func (s *Backend) Sync() {
-	proxier.syncProxyRules()
+	proxier.Sync()
+}
+
+// Resync see backendcmd.Resyncer. The sync ensures the jumps to the proxy chains, so it restores them if they were
+// flushed; it's coalesced with the others by the proxier's syncRunner.
+func (s *Backend) Resync() {
+	if proxier == nil {
+		return // not setup yet
+	}
+	proxier.Sync()
 }
 
 func (s *Backend) SetService(svc *localnetv1.Service) {
@@ -17,6 +17,8 @@ limitations under the License.
 package userspacelin
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"reflect"
@@ -27,10 +29,9 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
-	k8snet "k8s.io/apimachinery/pkg/util/net"
-
 	// libcontaineruserns "github.com/opencontainers/runc/libcontainer/userns"
 
 	"k8s.io/apimachinery/pkg/types"
@@ -46,7 +47,9 @@ import (
 	// kubefeatures "k8s.io/kubernetes/pkg/features"
 	// "k8s.io/kubernetes/pkg/proxy/config"
 	"sigs.k8s.io/kpng/backends/iptables"
+	"sigs.k8s.io/kpng/backends/iptables/portopener"
 	iptablesutil "sigs.k8s.io/kpng/backends/iptables/util"
+	"sigs.k8s.io/kpng/client/syncrunner"
 
 	utilexec "k8s.io/utils/exec"
 	netutils "k8s.io/utils/net"
@@ -66,6 +69,7 @@ type ServiceInfo struct {
 	ActiveClients *ClientCache
 
 	isAliveAtomic           int32 // Only access this with atomic ops
+	proxyProtocolAtomic     int32 // non-zero if the connections start with a PROXY protocol header (atomic ops only)
 	portal                  portal
 	protocol                localnetv1.Protocol
 	proxyPort               int
@@ -113,6 +117,19 @@ func (info *ServiceInfo) IsAlive() bool {
 	return atomic.LoadInt32(&info.isAliveAtomic) != 0
 }
 
+func (info *ServiceInfo) setProxyProtocol(b bool) {
+	var i int32
+	if b {
+		i = 1
+	}
+	atomic.StoreInt32(&info.proxyProtocolAtomic, i)
+}
+
+// UsesProxyProtocol returns true if the TCP connections to the endpoints start with a PROXY protocol v2 header.
+func (info *ServiceInfo) UsesProxyProtocol() bool {
+	return atomic.LoadInt32(&info.proxyProtocolAtomic) != 0
+}
+
 func logTimeout(err error) bool {
 	if e, ok := err.(net.Error); ok {
 		if e.Timeout() {
@@ -126,12 +143,10 @@ func logTimeout(err error) bool {
 // ProxySocketFunc is a function which constructs a ProxySocket from a protocol, ip, and port
 type ProxySocketFunc func(protocol localnetv1.Protocol, ip net.IP, port int) (ProxySocket, error)
 
-const numBurstSyncs int = 2
-
 // Interface for async runner; abstracted for testing
 type asyncRunnerInterface interface {
 	Run()
-	Loop(<-chan struct{})
+	Loop(context.Context)
 }
 
 // Proxier is a simple proxy for TCP connections between a localhost:lport
@@ -145,11 +160,10 @@ type UserspaceLinux struct {
 	loadBalancer    LoadBalancer
 	mu              sync.Mutex // protects serviceMap
 	serviceMap      map[iptables.ServicePortName]*ServiceInfo
-	syncPeriod      time.Duration
-	minSyncPeriod   time.Duration
+	syncConfig      syncrunner.Config
 	udpIdleTimeout  time.Duration
-	portMapMutex    sync.Mutex
-	portMap         map[portMapKey]*portMapValue
+	proxyProtocol   string
+	localPorts      *portopener.Manager
 	listenIP        net.IP
 	iptables        iptablesutil.Interface
 	hostIP          net.IP
@@ -168,27 +182,8 @@ type UserspaceLinux struct {
 	serviceChanges     map[types.NamespacedName]*UserspaceServiceChangeTracker // map of service changes, this is the entire state-space of all services in k8s.
 	syncRunner         asyncRunnerInterface                                    // governs calls to syncProxyRules
 
-	stopChan chan struct{}
-}
-
-// A key for the portMap.  The ip has to be a string because slices can't be map
-// keys.
-type portMapKey struct {
-	ip       string
-	port     int
-	protocol localnetv1.Protocol
-}
-
-func (k *portMapKey) String() string {
-	return fmt.Sprintf("%s/%s", net.JoinHostPort(k.ip, strconv.Itoa(k.port)), k.protocol)
-}
-
-// A value for the portMap
-type portMapValue struct {
-	owner  iptables.ServicePortName
-	socket interface {
-		Close() error
-	}
+	stopCtx context.Context
+	stop    context.CancelFunc
 }
 
 var (
@@ -206,15 +201,15 @@ var (
 // created, it will keep iptables up to date in the background and will not
 // terminate if a particular iptables call fails.
 
-func NewUserspaceLinux(loadBalancer LoadBalancer, listenIP net.IP, iptables iptablesutil.Interface, exec utilexec.Interface, pr utilnet.PortRange, syncPeriod, minSyncPeriod, udpIdleTimeout time.Duration) (*UserspaceLinux, error) {
-	return NewCustomProxier(loadBalancer, listenIP, iptables, exec, pr, syncPeriod, minSyncPeriod, udpIdleTimeout, newProxySocket)
+func NewUserspaceLinux(loadBalancer LoadBalancer, listenIP net.IP, iptables iptablesutil.Interface, exec utilexec.Interface, pr utilnet.PortRange, syncConfig syncrunner.Config, udpIdleTimeout time.Duration, proxyProtocol string) (*UserspaceLinux, error) {
+	return NewCustomProxier(loadBalancer, listenIP, iptables, exec, pr, syncConfig, udpIdleTimeout, proxyProtocol, newProxySocket)
 }
 
 // NewCustomProxier functions similarly to NewProxier, returning a new Proxier
 // for the given LoadBalancer and address.  The new proxier is constructed using
 // the ProxySocket constructor provided, however, instead of constructing the
 // default ProxySockets.
-func NewCustomProxier(loadBalancer LoadBalancer, listenIP net.IP, iptables iptablesutil.Interface, exec utilexec.Interface, pr utilnet.PortRange, syncPeriod, minSyncPeriod, udpIdleTimeout time.Duration, makeProxySocket ProxySocketFunc) (*UserspaceLinux, error) {
+func NewCustomProxier(loadBalancer LoadBalancer, listenIP net.IP, iptables iptablesutil.Interface, exec utilexec.Interface, pr utilnet.PortRange, syncConfig syncrunner.Config, udpIdleTimeout time.Duration, proxyProtocol string, makeProxySocket ProxySocketFunc) (*UserspaceLinux, error) {
 
 	// If listenIP is given, assume that is the intended host IP.  Otherwise
 	// try to find a suitable host IP address from network interfaces.
@@ -234,17 +229,17 @@ func NewCustomProxier(loadBalancer LoadBalancer, listenIP net.IP, iptables iptab
 		klog.V(2).InfoS("Failed to set open file handler limit to 64000 (running in UserNS, ignoring)", "err", err)
 	}
 
-	// make a dummy port range, newPortAllocator will make one for us w/ defaults
-	proxyPorts := newPortAllocator(k8snet.PortRange{})
+	// random ports (chosen by the kernel) if the range is empty
+	proxyPorts := newPortAllocator(pr)
 
 	klog.V(2).InfoS("Setting proxy IP and initializing iptables", "ip", hostIP)
 
 	// ... finish implementing these functions ...
-	return createProxier(loadBalancer, hostIP, iptables, exec, hostIP, proxyPorts, syncPeriod, minSyncPeriod, udpIdleTimeout, makeProxySocket)
+	return createProxier(loadBalancer, hostIP, iptables, exec, hostIP, proxyPorts, syncConfig, udpIdleTimeout, proxyProtocol, makeProxySocket)
 }
 
 // createProxier makes a userspace proxier.  It does some iptables actions but it doesn't actually run iptables AS the proxy.
-func createProxier(loadBalancer LoadBalancer, listenIP net.IP, iptablesInterfaceImpl iptablesutil.Interface, exec utilexec.Interface, hostIP net.IP, proxyPorts PortAllocator, syncPeriod, minSyncPeriod, udpIdleTimeout time.Duration, makeProxySocket ProxySocketFunc) (*UserspaceLinux, error) {
+func createProxier(loadBalancer LoadBalancer, listenIP net.IP, iptablesInterfaceImpl iptablesutil.Interface, exec utilexec.Interface, hostIP net.IP, proxyPorts PortAllocator, syncConfig syncrunner.Config, udpIdleTimeout time.Duration, proxyProtocol string, makeProxySocket ProxySocketFunc) (*UserspaceLinux, error) {
 	// Hack: since the userspace proxy is old, we don't expect people to need to replace this loadbalancer. so we hardcode it to round_robin.go.
 
 	// convenient to pass nil for tests..
@@ -264,20 +259,20 @@ func createProxier(loadBalancer LoadBalancer, listenIP net.IP, iptablesInterface
 		loadBalancer:    loadBalancer, // <----
 		serviceMap:      make(map[iptables.ServicePortName]*ServiceInfo),
 		serviceChanges:  make(map[types.NamespacedName]*UserspaceServiceChangeTracker),
-		portMap:         make(map[portMapKey]*portMapValue),
-		syncPeriod:      syncPeriod,
-		minSyncPeriod:   minSyncPeriod,
+		localPorts:      portopener.New(proxySocketOpener(makeProxySocket)),
+		syncConfig:      syncConfig,
 		udpIdleTimeout:  udpIdleTimeout,
+		proxyProtocol:   proxyProtocol,
 		listenIP:        listenIP,
 		iptables:        iptablesInterfaceImpl,
 		hostIP:          hostIP,
 		proxyPorts:      proxyPorts,
 		makeProxySocket: makeProxySocket,
 		exec:            exec,
-		stopChan:        make(chan struct{}),
 	}
-	klog.V(3).InfoS("Record sync param", "minSyncPeriod", minSyncPeriod, "syncPeriod", syncPeriod, "burstSyncs", numBurstSyncs)
-	proxier.syncRunner = newBoundedFrequencyRunner("userspace-proxy-sync-runner", proxier.syncProxyRules, minSyncPeriod, syncPeriod, numBurstSyncs)
+	proxier.stopCtx, proxier.stop = context.WithCancel(context.Background())
+	klog.V(3).InfoS("Record sync param", "minSyncPeriod", syncConfig.MinPeriod, "syncPeriod", syncConfig.Period, "burstSyncs", syncConfig.Burst)
+	proxier.syncRunner = syncConfig.NewRunner("userspace-proxy-sync-runner", proxier.syncProxyRules)
 	return proxier, nil
 }
 
@@ -359,7 +354,7 @@ func (proxier *UserspaceLinux) shutdown() {
 		proxier.stopProxy(serviceName, info)
 	}
 	proxier.cleanupStaleStickySessions()
-	close(proxier.stopChan)
+	proxier.stop()
 }
 
 func (proxier *UserspaceLinux) isInitialized() bool {
@@ -411,11 +406,12 @@ func (proxier *UserspaceLinux) syncProxyRules() {
 
 	proxier.ensurePortals()
 	proxier.cleanupStaleStickySessions()
+	proxier.cleanupStaleUDPClients()
 }
 
 // SyncLoop runs periodic work.  This is expected to run as a goroutine or as the main loop of the app.  It does not return.
 func (proxier *UserspaceLinux) SyncLoop() {
-	proxier.syncRunner.Loop(proxier.stopChan)
+	proxier.syncRunner.Loop(proxier.stopCtx)
 }
 
 // Ensure that portals exist for all services.
@@ -436,15 +432,75 @@ func (proxier *UserspaceLinux) cleanupStaleStickySessions() {
 	}
 }
 
+// close the UDP associations to endpoints which were removed from their service.
+func (proxier *UserspaceLinux) cleanupStaleUDPClients() {
+	for name, info := range proxier.serviceMap {
+		if info.protocol != localnetv1.Protocol_UDP {
+			continue
+		}
+		count := info.ActiveClients.closeStale(func(endpoint string) bool {
+			return proxier.loadBalancer.ServiceHasEndpoint(name, endpoint)
+		})
+		if count != 0 {
+			klog.V(2).InfoS("Closed stale UDP associations", "servicePortName", name, "count", count)
+		}
+	}
+}
+
 func (proxier *UserspaceLinux) stopProxy(service iptables.ServicePortName, info *ServiceInfo) error {
-	delete(proxier.serviceMap, service)
-	info.setAlive(false)
-	err := info.socket.Close()
+	err := proxier.closeProxy(service, info)
 	port := info.socket.ListenPort()
 	proxier.proxyPorts.Release(port)
 	return err
 }
 
+// closeProxy stops the proxy of the service port, keeping its port allocated to restart it on the same port.
+func (proxier *UserspaceLinux) closeProxy(service iptables.ServicePortName, info *ServiceInfo) error {
+	delete(proxier.serviceMap, service)
+	info.setAlive(false)
+	return info.socket.Close()
+}
+
+// maxProxyPortAttempts is the number of proxy ports tried when they're already bound by other processes.
+const maxProxyPortAttempts = 8
+
+// startProxy starts the proxy of the service port on proxyPort if it's not 0, so the iptables redirect rules of a
+// changed service stay the same, or else on the next free port, trying other ports if it's bound by another process.
+func (proxier *UserspaceLinux) startProxy(service iptables.ServicePortName, protocol localnetv1.Protocol, proxyPort int) (*ServiceInfo, error) {
+	if proxyPort != 0 {
+		info, err := proxier.addServiceOnPortInternal(service, protocol, proxyPort, proxier.udpIdleTimeout)
+		if err == nil {
+			return info, nil
+		}
+		// the port stays allocated since something else uses it
+		klog.ErrorS(err, "Failed to restart the proxy on its port, allocating another one", "serviceName", service, "port", proxyPort)
+	}
+
+	var err error
+	for attempt := 0; attempt < maxProxyPortAttempts; attempt++ {
+		proxyPort, err = proxier.proxyPorts.AllocateNext()
+		if err != nil {
+			return nil, err
+		}
+
+		var info *ServiceInfo
+		info, err = proxier.addServiceOnPortInternal(service, protocol, proxyPort, proxier.udpIdleTimeout)
+		if err == nil {
+			return info, nil
+		}
+
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			proxier.proxyPorts.Release(proxyPort)
+			return nil, err
+		}
+
+		// the port stays allocated since something else uses it
+		klog.V(2).InfoS("Proxy port already in use, trying another one", "serviceName", service, "port", proxyPort)
+	}
+
+	return nil, fmt.Errorf("no free proxy port after %d attempts: %w", maxProxyPortAttempts, err)
+}
+
 func (proxier *UserspaceLinux) getServiceInfo(service iptables.ServicePortName) (*ServiceInfo, bool) {
 	proxier.mu.Lock()
 	defer proxier.mu.Unlock()
@@ -518,25 +574,31 @@ func (proxier *UserspaceLinux) mergeService(service *localnetv1.Service) sets.St
 		info, exists := proxier.serviceMap[serviceName]
 		// TODO: check health of the socket? What if ProxyLoop exited?
 		if exists && sameConfig(info, service, *servicePort) {
-			// Nothing changed.
+			// Nothing changed but maybe the session affinity or the PROXY protocol, which don't need a new socket.
+			if !sameAffinity(info, service) {
+				proxier.setAffinity(serviceName, info, service)
+			}
+			info.setProxyProtocol(useProxyProtocol(service, proxier.proxyProtocol))
 			continue
 		}
+		proxyPort := 0
 		if exists {
 			klog.V(4).InfoS("Something changed for service: stopping it", "serviceName", serviceName)
-			if err := proxier.cleanupPortalAndProxy(serviceName, info); err != nil {
-				klog.ErrorS(err, "Failed to cleanup portal and proxy")
+			if err := proxier.closePortal(serviceName, info); err != nil {
+				klog.ErrorS(err, "Failed to close portal", "serviceName", serviceName)
+			}
+			if err := proxier.closeProxy(serviceName, info); err != nil {
+				klog.ErrorS(err, "Failed to stop proxy", "serviceName", serviceName)
 			}
 			info.setFinished()
-		}
-		proxyPort, err := proxier.proxyPorts.AllocateNext()
-		if err != nil {
-			klog.ErrorS(err, "Failed to allocate proxy port", "serviceName", serviceName)
-			continue
+
+			// restart on the same port
+			proxyPort = info.proxyPort
 		}
 
 		serviceIP := net.ParseIP(service.IPs.ClusterIPs.V4[0])
 		klog.V(0).InfoS("Adding new service", "serviceName", serviceName, "addr", net.JoinHostPort(serviceIP.String(), strconv.Itoa(int((*servicePort).Port))), "protocol", (*servicePort).Protocol)
-		info, err = proxier.addServiceOnPortInternal(serviceName, (*servicePort).Protocol, proxyPort, proxier.udpIdleTimeout)
+		info, err := proxier.startProxy(serviceName, (*servicePort).Protocol, proxyPort)
 		if err != nil {
 			klog.ErrorS(err, "Failed to start proxy", "serviceName", serviceName)
 			continue
@@ -561,15 +623,13 @@ func (proxier *UserspaceLinux) mergeService(service *localnetv1.Service) sets.St
 					info.stickyMaxAgeSeconds = int(*service.SessionAffinityConfig.ClientIP.TimeoutSeconds)
 				}
 		**/
-		if service.SessionAffinity != nil {
-			info.stickyMaxAgeSeconds = int(service.GetClientIP().TimeoutSeconds)
-		}
 		klog.V(0).InfoS("Record serviceInfo", "serviceInfo", info)
 
 		if err := proxier.openPortal(serviceName, info); err != nil {
 			klog.ErrorS(err, "Failed to open portal", "serviceName", serviceName)
 		}
-		proxier.loadBalancer.NewService(serviceName, service.GetClientIP(), info.stickyMaxAgeSeconds)
+		proxier.setAffinity(serviceName, info, service)
+		info.setProxyProtocol(useProxyProtocol(service, proxier.proxyProtocol))
 
 		info.setStarted()
 	}
@@ -577,6 +637,15 @@ func (proxier *UserspaceLinux) mergeService(service *localnetv1.Service) sets.St
 	return existingPorts
 }
 
+// setAffinity records the session affinity of the service and sets it in the load balancer, resetting the sessions
+// of the clients if it changed.
+func (proxier *UserspaceLinux) setAffinity(serviceName iptables.ServicePortName, info *ServiceInfo, service *localnetv1.Service) {
+	info.sessionClientIPAffinity = service.GetClientIP()
+	info.stickyMaxAgeSeconds = int(service.GetClientIP().GetTimeoutSeconds())
+
+	proxier.loadBalancer.NewService(serviceName, info.sessionClientIPAffinity, info.stickyMaxAgeSeconds)
+}
+
 func (proxier *UserspaceLinux) unmergeService(service *localnetv1.Service, existingPorts sets.String) {
 	if service == nil {
 		return
@@ -758,13 +827,16 @@ func sameConfig(info *ServiceInfo, service *localnetv1.Service, port *localnetv1
 	// 	return false
 	// }
 
-	// TODO add Session AFfinity to KPNG
-	// if info.sessionAffinityType != service.Spec.SessionAffinity {
-	//	return false
-	//}
 	return true
 }
 
+// sameAffinity returns true if the service's session affinity is the one recorded in info.
+func sameAffinity(info *ServiceInfo, service *localnetv1.Service) bool {
+	clientIP := service.GetClientIP()
+	return (info.sessionClientIPAffinity != nil) == (clientIP != nil) &&
+		info.stickyMaxAgeSeconds == int(clientIP.GetTimeoutSeconds())
+}
+
 func ipsEqual(lhs, rhs []string) bool {
 	if len(lhs) != len(rhs) {
 		return false
@@ -864,55 +936,42 @@ func (proxier *UserspaceLinux) openOnePortal(portal portal, protocol localnetv1.
 // Marks a port as being owned by a particular service, or returns error if already claimed.
 // Idempotent: reclaiming with the same owner is not an error
 func (proxier *UserspaceLinux) claimNodePort(ip net.IP, port int, protocol localnetv1.Protocol, owner iptables.ServicePortName) error {
-	proxier.portMapMutex.Lock()
-	defer proxier.portMapMutex.Unlock()
-
 	// TODO: We could pre-populate some reserved ports into portMap and/or blacklist some well-known ports
 
-	key := portMapKey{ip: ip.String(), port: port, protocol: protocol}
-	existing, found := proxier.portMap[key]
-	if !found {
-		// Hold the actual port open, even though we use iptables to redirect
-		// it.  This ensures that a) it's safe to take and b) that stays true.
-		// NOTE: We should not need to have a real listen()ing socket - bind()
-		// should be enough, but I can't figure out a way to e2e test without
-		// it.  Tools like 'ss' and 'netstat' do not show sockets that are
-		// bind()ed but not listen()ed, and at least the default debian netcat
-		// has no way to avoid about 10 seconds of retries.
-		socket, err := proxier.makeProxySocket(protocol, ip, port)
-		if err != nil {
-			return fmt.Errorf("can't open node port for %s: %v", key.String(), err)
-		}
-		proxier.portMap[key] = &portMapValue{owner: owner, socket: socket}
-		klog.V(2).InfoS("Claimed local port", "port", key.String())
-		return nil
-	}
-	if existing.owner == owner {
-		// We are idempotent
-		return nil
-	}
-	return fmt.Errorf("Port conflict detected on port %s.  %v vs %v", key.String(), owner, existing)
+	// Hold the actual port open, even though we use iptables to redirect
+	// it.  This ensures that a) it's safe to take and b) that stays true.
+	// NOTE: We should not need to have a real listen()ing socket - bind()
+	// should be enough, but I can't figure out a way to e2e test without
+	// it.  Tools like 'ss' and 'netstat' do not show sockets that are
+	// bind()ed but not listen()ed, and at least the default debian netcat
+	// has no way to avoid about 10 seconds of retries.
+	return proxier.localPorts.Claim(localPort(ip, port, protocol, owner), owner.String())
 }
 
 // Release a claim on a port.  Returns an error if the owner does not match the claim.
 // Tolerates release on an unclaimed port, to simplify .
 func (proxier *UserspaceLinux) releaseNodePort(ip net.IP, port int, protocol localnetv1.Protocol, owner iptables.ServicePortName) error {
-	proxier.portMapMutex.Lock()
-	defer proxier.portMapMutex.Unlock()
-
-	key := portMapKey{ip: ip.String(), port: port, protocol: protocol}
-	existing, found := proxier.portMap[key]
-	if !found {
-		// We tolerate this, it happens if we are cleaning up a failed allocation
-		klog.InfoS("Ignoring release on unowned port", "port", key)
-		return nil
+	return proxier.localPorts.Release(localPort(ip, port, protocol, owner), owner.String())
+}
+
+// localPort returns the local port to hold open for the ip (all the addresses if nil).
+func localPort(ip net.IP, port int, protocol localnetv1.Protocol, owner iptables.ServicePortName) netutils.LocalPort {
+	lp := netutils.LocalPort{
+		Description: "nodePort for " + owner.String(),
+		Port:        port,
+		Protocol:    netutils.Protocol(protocol.String()),
 	}
-	if existing.owner != owner {
-		return fmt.Errorf("Port conflict detected on port %v (unowned unlock).  %v vs %v", key, owner, existing)
+	if ip != nil {
+		lp.IP = ip.String()
+	}
+	return lp
+}
+
+// proxySocketOpener opens the local ports with the given ProxySocketFunc.
+func proxySocketOpener(makeProxySocket ProxySocketFunc) portopener.OpenerFunc {
+	return func(lp *netutils.LocalPort) (netutils.Closeable, error) {
+		return makeProxySocket(localnetv1.ParseProtocol(string(lp.Protocol)), net.ParseIP(lp.IP), lp.Port)
 	}
-	delete(proxier.portMap, key)
-	existing.socket.Close()
-	return nil
 }
 
 func (proxier *UserspaceLinux) openNodePort(nodePort int, protocol localnetv1.Protocol, proxyIP net.IP, proxyPort int, name iptables.ServicePortName) error {
@@ -0,0 +1,104 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userspacelin
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/backends/iptables"
+)
+
+// busyPortRange returns a range of two ports on the loopback whose first port is bound by the returned listener.
+func busyPortRange(t *testing.T) (utilnet.PortRange, net.Listener) {
+	for i := 0; i < 10; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+
+		// make sure the next port is free
+		next, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port+1)))
+		if err != nil {
+			l.Close()
+			continue
+		}
+		next.Close()
+
+		return utilnet.PortRange{Base: port, Size: 2}, l
+	}
+	t.Skip("no pair of free consecutive ports")
+	return utilnet.PortRange{}, nil
+}
+
+func TestStartProxySkipsBusyPortsAndKeepsItsPort(t *testing.T) {
+	pr, busy := busyPortRange(t)
+	defer busy.Close()
+
+	proxier := &UserspaceLinux{
+		loadBalancer:    NewLoadBalancerRR(),
+		serviceMap:      make(map[iptables.ServicePortName]*ServiceInfo),
+		listenIP:        net.ParseIP("127.0.0.1"),
+		proxyPorts:      newPortAllocator(pr),
+		makeProxySocket: newProxySocket,
+	}
+	name := iptables.ServicePortName{
+		NamespacedName: types.NamespacedName{Namespace: "default", Name: "web"},
+		Port:           "http",
+		Protocol:       localnetv1.Protocol_TCP,
+	}
+
+	info, err := proxier.startProxy(name, localnetv1.Protocol_TCP, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.proxyPort != pr.Base+1 {
+		t.Fatalf("expected the free port %d, got %d", pr.Base+1, info.proxyPort)
+	}
+
+	// a changed service restarts on the same port
+	if err := proxier.closeProxy(name, info); err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := proxier.startProxy(name, localnetv1.Protocol_TCP, info.proxyPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarted.proxyPort != info.proxyPort {
+		t.Fatalf("expected the proxy to restart on port %d, got %d", info.proxyPort, restarted.proxyPort)
+	}
+
+	// every port of the range is now used
+	other := name
+	other.Name = "api"
+	if _, err := proxier.startProxy(other, localnetv1.Protocol_TCP, 0); err == nil {
+		t.Fatal("expected an error with no free port left")
+	}
+
+	if err := proxier.stopProxy(name, restarted); err != nil {
+		t.Fatal(err)
+	}
+	if len(proxier.serviceMap) != 0 {
+		t.Fatalf("expected no proxied service, got %d", len(proxier.serviceMap))
+	}
+}
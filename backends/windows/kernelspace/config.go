@@ -12,4 +12,7 @@ type KubeProxyWinkernelConfiguration struct {
 	// enableDSR tells kube-proxy whether HNS policies should be created
 	// with DSR
 	EnableDSR bool
+	// enableETW tells kube-proxy whether to emit ETW events about the
+	// HNS policies syncs, alongside the Prometheus metrics
+	EnableETW bool
 }
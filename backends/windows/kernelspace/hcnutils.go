@@ -123,11 +123,12 @@ func (hns hcnutils) getAllEndpointsByNetwork(networkName string) (map[string]*(e
 		// Storing this is expensive in terms of memory, however there is a bug in Windows Server 2019 that can cause two endpoints to be created with the same IP address.
 		// TODO: Store by IP only and remove any lookups by endpoint ID.
 		endpointInfos[ep.Id] = &endpointsInfo{
-			ip:         ep.IpConfigurations[0].IpAddress,
-			isLocal:    uint32(ep.Flags&hcn.EndpointFlagsRemoteEndpoint) == 0,
-			macAddress: ep.MacAddress,
-			hnsID:      ep.Id,
-			hns:        hns,
+			ip:              ep.IpConfigurations[0].IpAddress,
+			isLocal:         uint32(ep.Flags&hcn.EndpointFlagsRemoteEndpoint) == 0,
+			macAddress:      ep.MacAddress,
+			hnsID:           ep.Id,
+			providerAddress: endpointProviderAddress(&ep),
+			hns:             hns,
 			// only ready and not terminating endpoints were added to HNS
 			ready:       true,
 			serving:     true,
@@ -246,15 +247,37 @@ func (hns hcnutils) createEndpoint(ep *endpointsInfo, networkName string) (*endp
 			return nil, err
 		}
 	}
+	providerAddress := endpointProviderAddress(createdEndpoint)
+	if len(providerAddress) == 0 {
+		providerAddress = ep.providerAddress
+	}
 	return &endpointsInfo{
 		ip:              createdEndpoint.IpConfigurations[0].IpAddress,
 		isLocal:         uint32(createdEndpoint.Flags&hcn.EndpointFlagsRemoteEndpoint) == 0,
 		macAddress:      createdEndpoint.MacAddress,
 		hnsID:           createdEndpoint.Id,
-		providerAddress: ep.providerAddress, //TODO get from createdEndpoint
+		providerAddress: providerAddress,
 		hns:             hns,
 	}, nil
 }
+
+// endpointProviderAddress returns the provider address (the node's address on the overlay network) of a remote
+// endpoint, empty if it has none.
+func endpointProviderAddress(ep *hcn.HostComputeEndpoint) string {
+	for _, policy := range ep.Policies {
+		if policy.Type != hcn.NetworkProviderAddress {
+			continue
+		}
+		policySettings := hcn.ProviderAddressEndpointPolicySetting{}
+		if err := json.Unmarshal(policy.Settings, &policySettings); err != nil {
+			klog.ErrorS(err, "Failed to unmarshal the provider address policy settings", "hnsID", ep.Id)
+			continue
+		}
+		return policySettings.ProviderAddress
+	}
+	return ""
+}
+
 func (hns hcnutils) deleteEndpoint(hnsID string) error {
 	hnsendpoint, err := hns.hcninstance.GetEndpointByID(hnsID)
 	if err != nil {
@@ -18,14 +18,39 @@ package kernelspace
 
 import (
 	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
 	// "k8s.io/component-base/metrics/legacyregistry"
 	//	"k8s.io/kubernetes/pkg/proxy/metrics"
 )
 
 var registerMetricsOnce sync.Once
 
+var (
+	hnsPolicies = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kpng_winkernel_hns_policies",
+		Help: "The number of HNS load balancer policies programmed",
+	})
+
+	syncDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kpng_winkernel_sync_duration_seconds",
+		Help:    "The time taken to apply the HNS policies",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+	})
+
+	hnsFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kpng_winkernel_hns_failures_total",
+		Help: "The number of failed HNS operations",
+	}, []string{"operation"})
+)
+
 // RegisterMetrics registers kube-proxy metrics for Windows modes.
 func RegisterMetrics() {
+	registerMetricsOnce.Do(func() {
+		prometheus.MustRegister(hnsPolicies)
+		prometheus.MustRegister(syncDuration)
+		prometheus.MustRegister(hnsFailures)
+	})
 
 	// TODO Jay commenting these out for now
 	/**	registerMetricsOnce.Do(func() {
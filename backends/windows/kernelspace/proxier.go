@@ -20,6 +20,7 @@ limitations under the License.
 package kernelspace
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
@@ -33,13 +34,12 @@ import (
 	v1 "k8s.io/api/core/v1"
 	apiutil "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/apimachinery/pkg/util/sets"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/events"
 	"k8s.io/klog/v2"
-	"k8s.io/kubernetes/pkg/util/async"
 	netutils "k8s.io/utils/net"
 
 	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/syncrunner"
 )
 
 // Provider is a proxy interface enforcing services and windowsEndpoint methods
@@ -97,7 +97,7 @@ type Proxier struct {
 	servicesSynced       bool
 	isIPv6Mode           bool
 	initialized          int32
-	syncRunner           *async.BoundedFrequencyRunner // governs calls to syncProxyRules
+	syncRunner           *syncrunner.BoundedFrequencyRunner // governs calls to syncProxyRules
 	// These are effectively const and do not need the mutex to be held.
 	masqueradeAll  bool
 	masqueradeMark string
@@ -117,6 +117,7 @@ type Proxier struct {
 	hostMac           string
 	isDSR             bool
 	supportedFeatures hcn.SupportedFeatures
+	telemetry         *telemetry
 }
 
 // BaseEndpointInfo contains base information that defines an endpoint.
@@ -261,8 +262,7 @@ func getNetworkInfo(hns HCNUtils, hnsNetworkName string) (*hnsNetworkInfo, error
 
 // NewProxier returns a new Proxier
 func NewProxier(
-	syncPeriod time.Duration, //
-	minSyncPeriod time.Duration, //
+	syncConfig syncrunner.Config,
 	masqueradeAll bool,
 	masqueradeBit int,
 	clusterCIDR string,
@@ -400,6 +400,7 @@ func NewProxier(
 		isDSR:             isDSR,
 		supportedFeatures: supportedFeatures,
 		isIPv6Mode:        isIPv6,
+		telemetry:         newTelemetry(config.EnableETW),
 	}
 
 	ipFamily := v1.IPv4Protocol
@@ -423,9 +424,8 @@ func NewProxier(
 	myProxier.endpointsChanges = endPointChangeTracker
 	myProxier.serviceChanges = serviceChanges
 
-	burstSyncs := 2
-	klog.V(3).InfoS("Record sync param", "minSyncPeriod", minSyncPeriod, "syncPeriod", syncPeriod, "burstSyncs", burstSyncs)
-	myProxier.syncRunner = async.NewBoundedFrequencyRunner("sync-runner", myProxier.syncProxyRules, minSyncPeriod, syncPeriod, burstSyncs)
+	klog.V(3).InfoS("Record sync param", "minSyncPeriod", syncConfig.MinPeriod, "syncPeriod", syncConfig.Period, "burstSyncs", syncConfig.Burst)
+	myProxier.syncRunner = syncConfig.NewRunner("sync-runner", myProxier.syncProxyRules)
 	return myProxier, nil
 }
 
@@ -450,7 +450,7 @@ func (proxier *Proxier) SyncLoop() {
 	//	}
 	// synthesize "last change queued" time as the informers are syncing.
 	//	metrics.SyncProxyRulesLastQueuedTimestamp.SetToCurrentTime()
-	proxier.syncRunner.Loop(wait.NeverStop)
+	proxier.syncRunner.Loop(context.Background())
 }
 
 func (proxier *Proxier) isInitialized() bool {
@@ -476,6 +476,76 @@ func (proxier *Proxier) cleanupAllPolicies() {
 	}
 }
 
+// deleteStaleRemoteEndpoints deletes the remote endpoints of the overlay network whose provider address isn't the
+// one of their remote subnet anymore (the pod IP moved to another node, or the remote subnets changed), and the
+// policies of the services using them, so this sync recreates them: the traffic would be sent to the previous node
+// otherwise.
+func (proxier *Proxier) deleteStaleRemoteEndpoints(queriedEndpoints map[string]*endpointsInfo) {
+	for key, ep := range queriedEndpoints {
+		// the endpoints are indexed by ID and IP, check them once
+		if key != ep.hnsID || ep.GetIsLocal() || len(ep.providerAddress) == 0 {
+			continue
+		}
+
+		// same as the provider address of the remote endpoints created by the sync
+		providerAddress := proxier.network.findRemoteSubnetProviderAddress(ep.IP())
+		if len(providerAddress) == 0 {
+			providerAddress = proxier.nodeIP.String()
+		}
+		if ep.providerAddress == providerAddress {
+			continue
+		}
+
+		klog.InfoS("Remote endpoint has a stale provider address, recreating it", "ip", ep.IP(), "providerAddress", ep.providerAddress, "expectedProviderAddress", providerAddress)
+
+		proxier.deletePoliciesOfEndpoint(ep.IP())
+
+		if err := proxier.hns.deleteEndpoint(ep.hnsID); err != nil {
+			klog.ErrorS(err, "Stale remote endpoint deletion failed", "ip", ep.IP(), "hnsID", ep.hnsID)
+			proxier.telemetry.failure("DeleteEndpoint", err)
+			continue
+		}
+
+		delete(proxier.endPointsRefCount, ep.hnsID)
+		delete(queriedEndpoints, ep.hnsID)
+		if queriedEndpoints[ep.IP()] == ep {
+			delete(queriedEndpoints, ep.IP())
+		}
+	}
+}
+
+// deletePoliciesOfEndpoint deletes the HNS load balancer policies of the services having an endpoint with this IP,
+// so the next sync applies them again.
+func (proxier *Proxier) deletePoliciesOfEndpoint(ip string) {
+	for svcName, svcPortMap := range proxier.serviceMap {
+		endpoints := proxier.endpointsMap[svcName]
+		if endpoints == nil {
+			continue
+		}
+
+		found := false
+		for _, e := range *endpoints {
+			if e.IPs.First() == ip {
+				found = true
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+
+		for _, svc := range svcPortMap {
+			svcInfo, ok := svc.(*serviceInfo)
+			if !ok {
+				klog.ErrorS(nil, "Failed to cast serviceInfo", "serviceName", svcName)
+				continue
+			}
+			svcInfo.deleteAllHnsLoadBalancerPolicy()
+			svcInfo.policyApplied = false
+		}
+	}
+}
+
 type loadBalancerInfo struct {
 	hnsID string
 }
@@ -512,6 +582,17 @@ type remoteSubnetInfo struct {
 	drMacAddress      string
 }
 
+// Service annotations selecting the HNS DSR policies (only sent to the backend if the server includes them, see
+// --with-service-annotations)
+const (
+	// preserveDestinationAnnotation keeps the destination of the LoadBalancer and NodePort traffic, which then
+	// only goes to the local endpoints (with DSR)
+	preserveDestinationAnnotation = "preserve-destination"
+	// dsrAnnotation enables DSR for the NodePort and external traffic of the services with
+	// externalTrafficPolicy: Local
+	dsrAnnotation = "kpng.sigs.k8s.io/winkernel-dsr"
+)
+
 const NETWORK_TYPE_OVERLAY = "overlay"
 const NETWORK_TYPE_L2BRIDGE = "L2Bridge"
 
@@ -531,6 +612,7 @@ func (proxier *Proxier) syncProxyRules() {
 	start := time.Now()
 	defer func() {
 		//metrics.SyncProxyRulesLatency.Observe(metrics.SinceInSeconds(start))
+		proxier.telemetry.syncDone(time.Since(start), proxier.policyCount())
 		klog.V(4).InfoS("Syncing proxy rules complete", "elapsed", time.Since(start))
 	}()
 
@@ -547,6 +629,8 @@ func (proxier *Proxier) syncProxyRules() {
 		}
 		return
 	}
+	// keep the remote subnets up to date
+	proxier.network = *updatedNetwork
 
 	// We assume that if this was called, we really want to sync them,
 	// even if nothing changed in the meantime. In other words, callers are
@@ -567,6 +651,7 @@ func (proxier *Proxier) syncProxyRules() {
 	queriedEndpoints, err := hns.getAllEndpointsByNetwork(hnsNetworkName)
 	if err != nil {
 		klog.ErrorS(err, "Querying HNS for endpoints failed")
+		proxier.telemetry.failure("GetEndpoints", err)
 		return
 	}
 	if queriedEndpoints == nil {
@@ -580,13 +665,17 @@ func (proxier *Proxier) syncProxyRules() {
 	}
 	if err != nil {
 		klog.ErrorS(err, "Querying HNS for load balancers failed")
+		proxier.telemetry.failure("GetLoadBalancers", err)
 		return
 	}
 	if strings.EqualFold(proxier.network.networkType, NETWORK_TYPE_OVERLAY) {
+		proxier.deleteStaleRemoteEndpoints(queriedEndpoints)
+
 		if _, ok := queriedEndpoints[proxier.sourceVip]; !ok {
 			_, err = newSourceVIP(hns, hnsNetworkName, proxier.sourceVip, proxier.hostMac, proxier.nodeIP.String())
 			if err != nil {
 				klog.ErrorS(err, "Source Vip endpoint creation failed")
+				proxier.telemetry.failure("CreateSourceVip", err)
 				return
 			}
 		}
@@ -622,6 +711,7 @@ func (proxier *Proxier) syncProxyRules() {
 					newHnsEndpoint, err := hns.createEndpoint(hnsEndpoint, hnsNetworkName)
 					if err != nil {
 						klog.ErrorS(err, "Remote endpoint creation failed for service VIP")
+						proxier.telemetry.failure("CreateEndpoint", err)
 						continue
 					}
 
@@ -715,6 +805,7 @@ func (proxier *Proxier) syncProxyRules() {
 							newHnsEndpoint, err = hns.createEndpoint(hnsEndpoint, hnsNetworkName)
 							if err != nil {
 								klog.ErrorS(err, "Remote endpoint creation failed", "endpointsInfo", hnsEndpoint)
+								proxier.telemetry.failure("CreateEndpoint", err)
 								continue
 							}
 						} else {
@@ -728,6 +819,7 @@ func (proxier *Proxier) syncProxyRules() {
 							newHnsEndpoint, err = hns.createEndpoint(hnsEndpoint, hnsNetworkName)
 							if err != nil {
 								klog.ErrorS(err, "Remote endpoint creation failed")
+								proxier.telemetry.failure("CreateEndpoint", err)
 								continue
 							}
 						}
@@ -808,6 +900,7 @@ func (proxier *Proxier) syncProxyRules() {
 			)
 			if err != nil {
 				klog.ErrorS(err, "Policy creation failed")
+				proxier.telemetry.failure("CreateLoadBalancer", err)
 				continue
 			}
 
@@ -836,6 +929,7 @@ func (proxier *Proxier) syncProxyRules() {
 					)
 					if err != nil {
 						klog.ErrorS(err, "Policy creation failed")
+						proxier.telemetry.failure("CreateLoadBalancer", err)
 						continue
 					}
 
@@ -868,6 +962,7 @@ func (proxier *Proxier) syncProxyRules() {
 					)
 					if err != nil {
 						klog.ErrorS(err, "Policy creation failed")
+						proxier.telemetry.failure("CreateLoadBalancer", err)
 						continue
 					}
 					externalIP.hnsID = hnsLoadBalancer.hnsID
@@ -897,6 +992,7 @@ func (proxier *Proxier) syncProxyRules() {
 					)
 					if err != nil {
 						klog.ErrorS(err, "Policy creation failed")
+						proxier.telemetry.failure("CreateLoadBalancer", err)
 						continue
 					}
 					lbIngressIP.hnsID = hnsLoadBalancer.hnsID
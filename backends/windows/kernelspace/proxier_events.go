@@ -23,6 +23,7 @@ import (
 	"sync/atomic"
 
 	discovery "k8s.io/api/discovery/v1"
+	"k8s.io/klog/v2"
 	netutils "k8s.io/utils/net"
 
 	"k8s.io/apimachinery/pkg/types"
@@ -171,14 +172,15 @@ func (proxier *Proxier) newEndpointInfo(baseInfo *BaseEndpointInfo, _ *ServicePo
 
 func (proxier *Proxier) newServiceInfo(port *localnetv1.PortMapping, service *localnetv1.Service, baseInfo *BaseServiceInfo) ServicePort {
 	info := &serviceInfo{BaseServiceInfo: baseInfo}
-	preserveDIP := service.Annotations["preserve-destination"] == "true"
-	//localTrafficDSR := service.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyTypeLocal
-	//err := hcn.DSRSupported()
-	//if err != nil {
-	//    preserveDIP = false
-	//    localTrafficDSR := false
-	//}
-	localTrafficDSR := false
+	// DSR needs Windows Server 2019+ (HNS v2), so the annotations are ignored on older versions
+	preserveDIP := service.Annotations[preserveDestinationAnnotation] == "true"
+	localTrafficDSR := RequestsOnlyLocalTraffic(service) && service.Annotations[dsrAnnotation] == "true"
+	if (preserveDIP || localTrafficDSR) && !proxier.supportedFeatures.DSR {
+		klog.InfoS("DSR is not supported on this version of Windows, ignoring the service's annotations",
+			"service", types.NamespacedName{Namespace: service.Namespace, Name: service.Name})
+		preserveDIP = false
+		localTrafficDSR = false
+	}
 	// targetPort is zero if it is specified as a name in port.TargetPort.
 	// Its real value would be got later from endpoints.
 	targetPort := 0
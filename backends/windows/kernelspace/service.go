@@ -235,11 +235,8 @@ func (sct *ServiceChangeTracker) newBaseServiceInfo(port *localnetv1.PortMapping
 	if RequestsOnlyLocalTraffic(service) {
 		nodeLocalExternal = true
 	}
-	nodeLocalInternal := false
-	//TODO : CHECK InternalTrafficPolicy
-	// if utilfeature.DefaultFeatureGate.Enabled(features.ServiceInternalTrafficPolicy) {
-	// 	nodeLocalInternal = apiservice.RequestsOnlyLocalTrafficForInternal(service)
-	// }
+	internalTrafficPolicy := v1.ServiceInternalTrafficPolicyType(service.InternalTrafficPolicy)
+	nodeLocalInternal := internalTrafficPolicy == v1.ServiceInternalTrafficPolicyLocal
 
 	v1Proto := v1.ProtocolTCP
 	if port.Protocol == localnetv1.Protocol_UDP {
@@ -248,14 +245,14 @@ func (sct *ServiceChangeTracker) newBaseServiceInfo(port *localnetv1.PortMapping
 
 	clusterIP := GetClusterIPByFamily(sct.ipFamily, service)
 	info := &BaseServiceInfo{
-		clusterIP:         net.ParseIP(clusterIP),
-		port:              int(port.Port),
-		targetPort:        int(port.TargetPort),
-		protocol:          v1Proto,
-		nodePort:          int(port.NodePort),
-		nodeLocalExternal: nodeLocalExternal,
-		nodeLocalInternal: nodeLocalInternal,
-		// internalTrafficPolicy: service.Spec.InternalTrafficPolicy, //TODO : CHECK InternalTrafficPolicy
+		clusterIP:                net.ParseIP(clusterIP),
+		port:                     int(port.Port),
+		targetPort:               int(port.TargetPort),
+		protocol:                 v1Proto,
+		nodePort:                 int(port.NodePort),
+		nodeLocalExternal:        nodeLocalExternal,
+		nodeLocalInternal:        nodeLocalInternal,
+		internalTrafficPolicy:    &internalTrafficPolicy,
 		hintsAnnotation:          service.Annotations[v1.AnnotationTopologyAwareHints],
 		loadBalancerSourceRanges: getLoadbalancerSourceRanges(service.IPFilters),
 		loadBalancerIPs:          getLoadBalancerIPs(service.IPs.LoadBalancerIPs, sct.ipFamily),
@@ -275,15 +272,14 @@ func (sct *ServiceChangeTracker) newBaseServiceInfo(port *localnetv1.PortMapping
 		klog.V(4).Infof("service change tracker(%v) ignored the following external IPs(%s) for service %v/%v as they don't match IPFamily", sct.ipFamily, strings.Join(ips, ","), service.Namespace, service.Name)
 	}
 
-	//TODO : CHECK service.Spec.HealthCheckNodePort
-	// if apiservice.NeedsHealthCheck(service) {
-	// 	p := service.Spec.HealthCheckNodePort
-	// 	if p == 0 {
-	// 		klog.Errorf("Service %s/%s has no healthcheck nodeport", service.Namespace, service.Name)
-	// 	} else {
-	// 		info.healthCheckNodePort = int(p)
-	// 	}
-	// }
+	if NeedsHealthCheck(service) {
+		p := service.HealthCheckNodePort
+		if p == 0 {
+			klog.Errorf("Service %s/%s has no healthcheck nodeport", service.Namespace, service.Name)
+		} else {
+			info.healthCheckNodePort = int(p)
+		}
+	}
 
 	return info
 }
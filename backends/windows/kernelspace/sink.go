@@ -21,7 +21,6 @@ package kernelspace
 
 import (
 	"os"
-	"time"
 
 	"github.com/spf13/pflag"
 
@@ -34,6 +33,7 @@ import (
 	"sigs.k8s.io/kpng/client/localsink/decoder"
 	"sigs.k8s.io/kpng/client/localsink/filterreset"
 	"sigs.k8s.io/kpng/client/serviceevents"
+	"sigs.k8s.io/kpng/client/syncrunner"
 )
 
 type Backend struct {
@@ -44,10 +44,9 @@ var (
 	_ decoder.Interface = &Backend{}
 	//proxier       Provider
 	//proxierState  Proxier
-	proxier       *Proxier
-	flag          = &pflag.FlagSet{}
-	minSyncPeriod time.Duration
-	syncPeriod    time.Duration
+	proxier    *Proxier
+	flag       = &pflag.FlagSet{}
+	syncConfig syncrunner.Config
 
 	// TODO JAy add this back , avoiding pkg/proxy imports
 	// healthzServer healthcheck.ProxierHealthUpdater
@@ -93,12 +92,18 @@ var (
 		false,
 		"Set this flag to enable DSR")
 
+	enableETW = flag.Bool(
+		"enable-etw",
+		false,
+		"Set this flag to emit ETW events (provider \"kpng-winkernel\") about the HNS policies syncs")
+
 	winkernelConfig KubeProxyWinkernelConfiguration
 )
 
 /* BindFlags will bind the flags */
 func BindFlags(flags *pflag.FlagSet) {
 	flags.AddFlagSet(flag)
+	syncConfig.BindFlags(flags)
 }
 
 func (b *Backend) BindFlags(flags *pflag.FlagSet) {
@@ -152,11 +157,9 @@ func (s *Backend) Reset() {
 func (s *Backend) Setup() {
 	var err error
 
-	flag.DurationVar(
-		&syncPeriod,
-		"sync-period-duration",
-		15*time.Second,
-		"sync period duration")
+	if err = syncConfig.Validate(); err != nil {
+		klog.Fatal(err)
+	}
 
 	klog.Info("Starting Windows Kernel Proxier.")
 	klog.InfoS("  Cluster CIDR", "clusterCIDR", *clusterCIDR)
@@ -174,10 +177,12 @@ func (s *Backend) Setup() {
 	winkernelConfig.EnableDSR = *enableDSR
 	winkernelConfig.NetworkName = "" // remove from config? proxier gets network name from KUBE_NETWORK env var
 	winkernelConfig.SourceVip = *sourceVip
+	winkernelConfig.EnableETW = *enableETW
+
+	RegisterMetrics()
 
 	proxier, err = NewProxier(
-		syncPeriod,
-		minSyncPeriod,
+		syncConfig,
 		*masqueradeAll,
 		*masqueradeBit,
 		*clusterCIDR,
@@ -0,0 +1,128 @@
+//go:build windows
+// +build windows
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kernelspace
+
+import (
+	"time"
+
+	"github.com/Microsoft/go-winio/pkg/etw"
+	klog "k8s.io/klog/v2"
+)
+
+// etwProviderName is the name of the ETW provider (its GUID is derived from the name, as for EventSource providers).
+const etwProviderName = "kpng-winkernel"
+
+// telemetry reports the syncs as Prometheus metrics and, if enabled, as ETW events for Windows-native tooling.
+// It's only used while holding Proxier.mu.
+type telemetry struct {
+	provider *etw.Provider
+
+	// failures of the current sync
+	failures int
+}
+
+func newTelemetry(enableETW bool) *telemetry {
+	t := &telemetry{}
+
+	if !enableETW {
+		return t
+	}
+
+	provider, err := etw.NewProvider(etwProviderName, nil)
+	if err != nil {
+		klog.ErrorS(err, "Failed to register the ETW provider, not emitting ETW events", "provider", etwProviderName)
+		return t
+	}
+
+	klog.InfoS("Emitting ETW events", "provider", etwProviderName, "guid", provider.String())
+	t.provider = provider
+
+	return t
+}
+
+// failure records a failed HNS operation.
+func (t *telemetry) failure(operation string, err error) {
+	t.failures++
+	hnsFailures.WithLabelValues(operation).Inc()
+
+	t.writeEvent("HnsFailure", etw.LevelError,
+		etw.StringField("Operation", operation),
+		etw.StringField("Error", err.Error()),
+	)
+}
+
+// syncDone records the end of a sync, with the number of HNS policies programmed.
+func (t *telemetry) syncDone(duration time.Duration, policies int) {
+	syncDuration.Observe(duration.Seconds())
+	hnsPolicies.Set(float64(policies))
+
+	level := etw.LevelInfo
+	if t.failures != 0 {
+		level = etw.LevelWarning
+	}
+
+	t.writeEvent("SyncProxyRules", level,
+		etw.Float64Field("DurationSeconds", duration.Seconds()),
+		etw.IntField("Policies", policies),
+		etw.IntField("Failures", t.failures),
+	)
+
+	t.failures = 0
+}
+
+func (t *telemetry) writeEvent(name string, level etw.Level, fields ...etw.FieldOpt) {
+	if t.provider == nil || !t.provider.IsEnabledForLevel(level) {
+		return
+	}
+
+	if err := t.provider.WriteEvent(name, etw.WithEventOpts(etw.WithLevel(level)), fields); err != nil {
+		klog.V(4).InfoS("Failed to write an ETW event", "event", name, "err", err)
+	}
+}
+
+// policyCount counts the HNS load balancer policies programmed for the services.
+func (proxier *Proxier) policyCount() (count int) {
+	for _, svcPortMap := range proxier.serviceMap {
+		for _, svc := range svcPortMap {
+			svcInfo, ok := svc.(*serviceInfo)
+			if !ok {
+				continue
+			}
+
+			if svcInfo.hnsID != "" {
+				count++
+			}
+			if svcInfo.nodePorthnsID != "" {
+				count++
+			}
+			for _, externalIP := range svcInfo.externalIPs {
+				if externalIP.hnsID != "" {
+					count++
+				}
+			}
+			for _, lbIngressIP := range svcInfo.loadBalancerIngressIPs {
+				if lbIngressIP.hnsID != "" {
+					count++
+				}
+			}
+		}
+	}
+	return
+}
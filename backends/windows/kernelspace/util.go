@@ -368,6 +368,14 @@ func RequestsOnlyLocalTraffic(service *localnetv1.Service) bool {
 	return service.ExternalTrafficToLocal
 }
 
+// NeedsHealthCheck checks if service needs health check.
+func NeedsHealthCheck(service *localnetv1.Service) bool {
+	if service.Type != string(v1.ServiceTypeLoadBalancer) {
+		return false
+	}
+	return RequestsOnlyLocalTraffic(service)
+}
+
 // MapIPsByIPFamily maps a slice of IPs to their respective IP families (v4 or v6)
 func MapIPsByIPFamily(ips *localnetv1.IPSet) map[v1.IPFamily][]string {
 	ipFamilyMap := map[v1.IPFamily][]string{}
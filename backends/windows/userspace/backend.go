@@ -41,10 +41,10 @@ func init() {
 var (
 	proxier Provider
 
-	bindAddress        string
-	portRange          string
-	syncPeriodDuration time.Duration
-	udpIdleTimeout     time.Duration
+	bindAddress    string
+	portRange      string
+	syncPeriod     time.Duration
+	udpIdleTimeout time.Duration
 )
 
 type userspaceBackend struct {
@@ -58,9 +58,14 @@ type userspaceBackend struct {
 var _ decoder.Interface = &userspaceBackend{}
 
 func (b *userspaceBackend) BindFlags(flags *pflag.FlagSet) {
+	b.Config.BindFlags(flags)
+
 	flags.StringVar(&bindAddress, "bind-address", "0.0.0.0", "bind address")
 	flags.StringVar(&portRange, "port-range", "36000-37000", "port range")
-	flags.DurationVar(&syncPeriodDuration, "sync-period-duration", 15*time.Second, "sync period duration")
+	// only the max interval is honored, the proxier syncs on each change
+	flags.DurationVar(&syncPeriod, "sync-period", 30*time.Second, "max interval between syncs of the rules (they're re-synced at least that often)")
+	flags.DurationVar(&syncPeriod, "sync-period-duration", syncPeriod, "sync period duration")
+	flags.MarkDeprecated("sync-period-duration", "use --sync-period instead")
 	flags.DurationVar(&udpIdleTimeout, "udp-idle-timeout", 10*time.Second, "UDP idle timeout")
 }
 
@@ -71,6 +76,10 @@ func (b *userspaceBackend) Sink() localsink.Sink {
 func (b *userspaceBackend) Setup() {
 	var err error
 
+	if syncPeriod <= 0 {
+		log.Fatalf("sync period must be positive (got %v)", syncPeriod)
+	}
+
 	klog.V(0).InfoS("Using Windows Userspace Proxier. (this is a deprecated mode).")
 
 	execer := exec.New()
@@ -81,13 +90,18 @@ func (b *userspaceBackend) Setup() {
 		netutils.ParseIPSloppy(bindAddress),
 		netshInterface,
 		*utilnet.ParsePortRangeOrDie(portRange),
-		syncPeriodDuration,
+		syncPeriod,
 		udpIdleTimeout,
 	)
 
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	b.services = make(map[string]*service)
+
+	// periodic work (sticky sessions cleanup), as done by the linux userspace backend
+	go proxier.SyncLoop()
 }
 
 // Sync signals an stream sync event
@@ -108,22 +122,40 @@ func (b *userspaceBackend) SetService(svc *localnetv1.Service) {
 	key := svc.NamespacedName()
 	if oldSvc, ok := b.services[key]; ok {
 		proxier.OnServiceUpdate(oldSvc.internalSvc, svc)
-	} else {
-		proxier.OnServiceAdd(svc)
+		// keep known endpoints, they are not resent on service updates
+		oldSvc.internalSvc = svc
+		return
 	}
+
+	proxier.OnServiceAdd(svc)
 	b.services[key] = &service{Name: key, internalSvc: svc}
 }
 
 // DeleteService is called when a service is deleted
 func (b *userspaceBackend) DeleteService(namespace, name string) {
 	key := namespace + "/" + name
-	proxier.OnServiceDelete(b.services[key].internalSvc)
+	svc, ok := b.services[key]
+	if !ok {
+		return
+	}
+
+	proxier.OnServiceDelete(svc.internalSvc)
 	delete(b.services, key)
 }
 
 // SetEndpoint is called when an endpoint is added or updated
 func (b *userspaceBackend) SetEndpoint(namespace, serviceName, epKey string, endpoint *localnetv1.Endpoint) {
-	svc := b.services[namespace+"/"+serviceName]
+	svc, ok := b.services[namespace+"/"+serviceName]
+	if !ok {
+		return
+	}
+
+	// an update is a delete of the previous value followed by an add
+	if ep := svc.GetEndpoint(epKey); ep.key == epKey {
+		proxier.OnEndpointsDelete(ep.internalEp, svc.internalSvc)
+		svc.DeleteEndpoint(epKey)
+	}
+
 	svc.AddEndpoint(epKey, endpoint)
 	proxier.OnEndpointsAdd(endpoint, svc.internalSvc)
 }
@@ -131,7 +163,11 @@ func (b *userspaceBackend) SetEndpoint(namespace, serviceName, epKey string, end
 // DeleteEndpoint is called when an endpoint is deleted
 func (b *userspaceBackend) DeleteEndpoint(namespace, serviceName, epKey string) {
 	key := namespace + "/" + serviceName
-	svc := b.services[key]
+	svc, ok := b.services[key]
+	if !ok {
+		return
+	}
+
 	if ep := svc.GetEndpoint(epKey); ep.key == epKey {
 		proxier.OnEndpointsDelete(ep.internalEp, svc.internalSvc)
 	}
@@ -32,7 +32,7 @@ func buildPortsToEndpointsMap(ep *localnetv1.Endpoint, svc *localnetv1.Service)
 	for _, ip := range ep.IPs.GetV4() {
 		for _, port := range svc.Ports {
 			if isValidEndpoint(ip, int(port.Port)) {
-				portsToEndpoints[port.Name] = append(portsToEndpoints[port.Name], net.JoinHostPort(ip, strconv.Itoa(int(port.TargetPort))))
+				portsToEndpoints[port.Name] = append(portsToEndpoints[port.Name], net.JoinHostPort(ip, strconv.Itoa(int(ep.PortMapping(port)))))
 
 			}
 		}
@@ -25,6 +25,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"google.golang.org/protobuf/proto"
 	"k8s.io/apimachinery/pkg/util/runtime"
 
 	"k8s.io/apimachinery/pkg/types"
@@ -498,7 +499,7 @@ func isClosedError(err error) bool {
 }
 
 func sameConfig(info *serviceInfo, service *localnetv1.Service, protocol localnetv1.Protocol, listenPort int) bool {
-	return info.protocol == protocol && info.portal.port == listenPort && info.sessionClientIPAffinity != service.GetClientIP()
+	return info.protocol == protocol && info.portal.port == listenPort && proto.Equal(info.sessionClientIPAffinity, service.GetClientIP())
 }
 
 func (proxier *Proxier) netshIPv4AddressAddArgs(destIP net.IP) []string {
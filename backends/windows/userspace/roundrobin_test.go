@@ -257,3 +257,29 @@ func TestLoadBalanceWorksWithServiceRemoval(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadBalanceUsesEndpointTargetPorts(t *testing.T) {
+	loadBalancer := NewLoadBalancerRR()
+	svcPortName := ServicePortName{
+		NamespacedName: types.NamespacedName{Namespace: "default", Name: "foo"}, Port: "http",
+	}
+	service := &localnetv1.Service{Namespace: "default", Name: "foo", Ports: []*localnetv1.PortMapping{
+		{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 8080},
+	}}
+
+	// the target port resolved by the server for the endpoint
+	loadBalancer.OnEndpointsAdd(&localnetv1.Endpoint{
+		IPs:         &localnetv1.IPSet{V4: []string{"10.0.0.1"}},
+		TargetPorts: []*localnetv1.PortMapping{{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 9090}},
+	}, service)
+	expectEndpoint(t, loadBalancer, svcPortName, "10.0.0.1:9090", nil)
+
+	loadBalancer.OnEndpointsDelete(&localnetv1.Endpoint{
+		IPs:         &localnetv1.IPSet{V4: []string{"10.0.0.1"}},
+		TargetPorts: []*localnetv1.PortMapping{{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 9090}},
+	}, service)
+
+	// the service's target port otherwise
+	loadBalancer.OnEndpointsAdd(&localnetv1.Endpoint{IPs: &localnetv1.IPSet{V4: []string{"10.0.0.2"}}}, service)
+	expectEndpoint(t, loadBalancer, svcPortName, "10.0.0.2:8080", nil)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit records the diffs applied by a backend (services added, updated or removed, endpoint sets changed),
+// with their time, so operators can reconstruct what was programmed when.
+package audit
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+type EventType string
+
+const (
+	ServiceAdded     EventType = "ServiceAdded"
+	ServiceUpdated   EventType = "ServiceUpdated"
+	ServiceRemoved   EventType = "ServiceRemoved"
+	EndpointsChanged EventType = "EndpointsChanged"
+)
+
+// Event is a change of a service applied by the backend.
+type Event struct {
+	// Time is the time the change was applied.
+	Time time.Time `json:"time"`
+	// Revision is the revision of the last change set applied (see localnetv1.SyncOp).
+	Revision uint64 `json:"revision,omitempty"`
+
+	Type EventType `json:"type"`
+	// Service is the service's namespace/name.
+	Service string `json:"service"`
+
+	// Spec is the service after the change, in its protobuf JSON mapping (ServiceAdded and ServiceUpdated).
+	Spec json.RawMessage `json:"spec,omitempty"`
+	// Endpoints are the service's endpoints after the change, in their protobuf JSON mapping (EndpointsChanged, none
+	// if empty).
+	Endpoints []json.RawMessage `json:"endpoints,omitempty"`
+}
+
+// Sink receives the events of each diff applied, in order.
+type Sink interface {
+	Audit(events []Event) error
+}
+
+type Config struct {
+	// File is the JSON lines file the events are appended to (none if empty).
+	File string
+}
+
+func (c *Config) BindFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.File, "audit-file", "", "append the diffs applied to the dataplane to this file, as JSON lines")
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+// serviceState is the state of a service, as received.
+type serviceState struct {
+	service   []byte            // nil if the service doesn't exist
+	endpoints map[string][]byte // by endpoint path
+}
+
+func (s *serviceState) copy() *serviceState {
+	if s == nil {
+		return nil
+	}
+
+	c := &serviceState{service: s.service, endpoints: make(map[string][]byte, len(s.endpoints))}
+	for path, ep := range s.endpoints {
+		c.endpoints[path] = ep
+	}
+	return c
+}
+
+// LocalSink wraps a sink to audit the diffs it applies.
+type LocalSink struct {
+	sink  localsink.Sink
+	audit Sink
+
+	// WaitApplied delays the audit of the diffs until Applied is called (see backendcmd.StrictReadiness), instead of
+	// auditing them once their change set is sent to the sink without error.
+	WaitApplied bool
+
+	mu       sync.Mutex
+	current  map[string]*serviceState // by service path
+	dirty    map[string]bool          // the services changed since the last change set
+	synced   map[string]*serviceState // the services changed by the change sets not applied yet (nil if removed)
+	applied  map[string]*serviceState // the services as last applied
+	revision uint64
+}
+
+var _ localsink.Sink = &LocalSink{}
+
+func NewLocalSink(sink localsink.Sink, audit Sink) *LocalSink {
+	return &LocalSink{
+		sink:    sink,
+		audit:   audit,
+		current: map[string]*serviceState{},
+		dirty:   map[string]bool{},
+		synced:  map[string]*serviceState{},
+		applied: map[string]*serviceState{},
+	}
+}
+
+func (s *LocalSink) Setup() { s.sink.Setup() }
+
+func (s *LocalSink) WaitRequest() (nodeName string, err error) { return s.sink.WaitRequest() }
+
+func (s *LocalSink) Reset() {
+	s.mu.Lock()
+	// the whole state is sent again, what's not is removed
+	for path := range s.current {
+		s.dirty[path] = true
+	}
+	s.current = map[string]*serviceState{}
+	s.mu.Unlock()
+
+	s.sink.Reset()
+}
+
+func (s *LocalSink) Send(op *localnetv1.OpItem) error {
+	if err := s.sink.Send(op); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch v := op.Op.(type) {
+	case *localnetv1.OpItem_Set:
+		s.set(v.Set.Ref, v.Set.Bytes)
+
+	case *localnetv1.OpItem_Delete:
+		s.set(v.Delete, nil)
+
+	case *localnetv1.OpItem_Sync:
+		s.revision = v.Sync.Revision
+
+		for path := range s.dirty {
+			s.synced[path] = s.current[path].copy()
+		}
+		s.dirty = map[string]bool{}
+
+		if !s.WaitApplied {
+			s.auditApplied()
+		}
+	}
+
+	return nil
+}
+
+// set sets (or deletes if value is nil) a service or an endpoint.
+func (s *LocalSink) set(ref *localnetv1.Ref, value []byte) {
+	if ref.Set != localnetv1.Set_EndpointsSet && ref.Set != localnetv1.Set_ServicesSet {
+		return
+	}
+	path := ref.ServicePath()
+
+	state := s.current[path]
+	if state == nil {
+		state = &serviceState{endpoints: map[string][]byte{}}
+		s.current[path] = state
+	}
+
+	if ref.Set == localnetv1.Set_ServicesSet {
+		state.service = value
+	} else if value == nil {
+		delete(state.endpoints, ref.Path)
+	} else {
+		state.endpoints[ref.Path] = value
+	}
+
+	if state.service == nil && len(state.endpoints) == 0 {
+		delete(s.current, path)
+	}
+	s.dirty[path] = true
+}
+
+// Applied audits the diffs of the change sets sent since the last call, once the backend applied them.
+func (s *LocalSink) Applied() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.auditApplied()
+}
+
+func (s *LocalSink) auditApplied() {
+	if len(s.synced) == 0 {
+		return
+	}
+
+	paths := make([]string, 0, len(s.synced))
+	for path := range s.synced {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	now := time.Now()
+	events := make([]Event, 0, len(paths))
+
+	for _, path := range paths {
+		prev, next := s.applied[path], s.synced[path]
+
+		if next == nil {
+			delete(s.applied, path)
+		} else {
+			s.applied[path] = next
+		}
+
+		for _, event := range diff(prev, next) {
+			event.Time = now
+			event.Revision = s.revision
+			event.Service = path
+			events = append(events, event)
+		}
+	}
+	s.synced = map[string]*serviceState{}
+
+	if len(events) == 0 {
+		return
+	}
+
+	if err := s.audit.Audit(events); err != nil {
+		klog.Error("failed to audit the applied diff: ", err)
+	}
+}
+
+// diff returns the events changing a service from prev to next (nil if it doesn't exist).
+func diff(prev, next *serviceState) (events []Event) {
+	if prev == nil {
+		prev = &serviceState{}
+	}
+	if next == nil {
+		next = &serviceState{}
+	}
+
+	switch {
+	case prev.service == nil && next.service != nil:
+		events = append(events, Event{Type: ServiceAdded, Spec: toJSON(next.service, &localnetv1.Service{})})
+	case prev.service != nil && next.service == nil:
+		events = append(events, Event{Type: ServiceRemoved})
+	case !bytes.Equal(prev.service, next.service):
+		events = append(events, Event{Type: ServiceUpdated, Spec: toJSON(next.service, &localnetv1.Service{})})
+	}
+
+	if endpointsEqual(prev.endpoints, next.endpoints) {
+		return
+	}
+
+	event := Event{Type: EndpointsChanged}
+
+	paths := make([]string, 0, len(next.endpoints))
+	for path := range next.endpoints {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		event.Endpoints = append(event.Endpoints, toJSON(next.endpoints[path], &localnetv1.Endpoint{}))
+	}
+
+	return append(events, event)
+}
+
+func endpointsEqual(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, ep := range a {
+		if other, ok := b[path]; !ok || !bytes.Equal(ep, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// toJSON converts the protobuf encoding of msg to its JSON mapping.
+func toJSON(value []byte, msg proto.Message) json.RawMessage {
+	if err := proto.Unmarshal(value, msg); err != nil {
+		klog.Error("failed to decode the audited value: ", err)
+		return nil
+	}
+
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		klog.Error("failed to encode the audited value: ", err)
+		return nil
+	}
+	return b
+}
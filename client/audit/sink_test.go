@@ -0,0 +1,179 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+type testSink struct {
+	localsink.Config
+}
+
+func (s *testSink) Setup()                           {}
+func (s *testSink) Reset()                           {}
+func (s *testSink) Send(op *localnetv1.OpItem) error { return nil }
+
+func set(set localnetv1.Set, path string, m proto.Message) *localnetv1.OpItem {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Set{Set: &localnetv1.Value{
+		Ref:   &localnetv1.Ref{Set: set, Path: path},
+		Bytes: b,
+	}}}
+}
+
+func setService(path string, port int32) *localnetv1.OpItem {
+	return set(localnetv1.Set_ServicesSet, path, &localnetv1.Service{Ports: []*localnetv1.PortMapping{{Port: port}}})
+}
+
+func setEndpoint(path, ip string) *localnetv1.OpItem {
+	return set(localnetv1.Set_EndpointsSet, path, &localnetv1.Endpoint{IPs: localnetv1.NewIPSet(ip)})
+}
+
+func del(set localnetv1.Set, path string) *localnetv1.OpItem {
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Delete{Delete: &localnetv1.Ref{Set: set, Path: path}}}
+}
+
+func syncOp(revision uint64) *localnetv1.OpItem {
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Sync{Sync: &localnetv1.SyncOp{Revision: revision}}}
+}
+
+// readEvents returns the events of the file, as "type service [endpoints count]"
+func readEvents(t *testing.T, path string) (events []string) {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		event := Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Time.IsZero() || event.Revision == 0 {
+			t.Errorf("expected a time and a revision: %s", scanner.Text())
+		}
+
+		s := string(event.Type) + " " + event.Service
+		if event.Type == EndpointsChanged {
+			s += " " + strconv.Itoa(len(event.Endpoints))
+		}
+		events = append(events, s)
+	}
+	return
+}
+
+func TestLocalSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	file, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	s := NewLocalSink(&testSink{}, file)
+
+	check := func(step string, expected ...string) {
+		t.Helper()
+		if events := readEvents(t, path); !reflect.DeepEqual(events, expected) {
+			t.Errorf("%s: expected events %q, got %q", step, expected, events)
+		}
+	}
+
+	s.Send(setService("ns/a", 80))
+	s.Send(setEndpoint("ns/a/1", "10.1.0.1"))
+	s.Send(setService("ns/b", 80))
+	s.Send(syncOp(1))
+
+	check("initial", "ServiceAdded ns/a", "EndpointsChanged ns/a 1", "ServiceAdded ns/b")
+
+	// no change
+	s.Send(setService("ns/a", 80))
+	s.Send(syncOp(2))
+
+	check("no change", "ServiceAdded ns/a", "EndpointsChanged ns/a 1", "ServiceAdded ns/b")
+
+	s.Send(setService("ns/a", 81))
+	s.Send(setEndpoint("ns/a/2", "10.1.0.2"))
+	s.Send(del(localnetv1.Set_ServicesSet, "ns/b"))
+	s.Send(syncOp(3))
+
+	check("changes", "ServiceAdded ns/a", "EndpointsChanged ns/a 1", "ServiceAdded ns/b",
+		"ServiceUpdated ns/a", "EndpointsChanged ns/a 2", "ServiceRemoved ns/b")
+}
+
+func TestLocalSinkWaitApplied(t *testing.T) {
+	audited := [][]Event{}
+	s := NewLocalSink(&testSink{}, auditFunc(func(events []Event) error {
+		audited = append(audited, events)
+		return nil
+	}))
+	s.WaitApplied = true
+
+	s.Send(setService("ns/a", 80))
+	s.Send(syncOp(1))
+	s.Send(setEndpoint("ns/a/1", "10.1.0.1"))
+	s.Send(syncOp(2))
+
+	if len(audited) != 0 {
+		t.Fatalf("expected no audit before being applied, got %+v", audited)
+	}
+
+	// both change sets are applied at once
+	s.Applied()
+
+	if len(audited) != 1 || len(audited[0]) != 2 || audited[0][0].Type != ServiceAdded || audited[0][1].Type != EndpointsChanged {
+		t.Fatalf("unexpected audit %+v", audited)
+	}
+	if audited[0][0].Revision != 2 {
+		t.Errorf("expected the revision of the last change set applied, got %d", audited[0][0].Revision)
+	}
+
+	// after a reset, what's not sent again is removed
+	s.Reset()
+	s.Send(setService("ns/a", 80))
+	s.Send(syncOp(3))
+	s.Applied()
+
+	if len(audited) != 2 || len(audited[1]) != 1 || audited[1][0].Type != EndpointsChanged || len(audited[1][0].Endpoints) != 0 {
+		t.Fatalf("unexpected audit after reset %+v", audited)
+	}
+}
+
+type auditFunc func(events []Event) error
+
+func (f auditFunc) Audit(events []Event) error { return f(events) }
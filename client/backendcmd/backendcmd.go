@@ -19,6 +19,7 @@ package backendcmd
 import (
 	"github.com/spf13/pflag"
 
+	"sigs.k8s.io/kpng/client/capacity"
 	"sigs.k8s.io/kpng/client/localsink"
 )
 
@@ -27,6 +28,61 @@ type Cmd interface {
 	Sink() localsink.Sink
 }
 
+// StrictReadiness is implemented by backends reporting themselves when their rules are successfully applied,
+// instead of being considered ready once their first change set is synced.
+type StrictReadiness interface {
+	// OnApplied sets the function to call after each successful application of a complete change set.
+	OnApplied(func())
+}
+
+// ServiceFailures is implemented by backends reporting the services they fail to program, so the agent can publish
+// them for the cluster-level view of the services' health (see api2local.NodeAnnotation).
+type ServiceFailures interface {
+	// OnServiceFailures sets the function to call after each sync with the services failing to be programmed, by
+	// "namespace/name" (empty if none).
+	OnServiceFailures(func(failures map[string]string))
+}
+
+// Scoped is implemented by backends handling only some of the services, so they can be combined with other
+// backends (see Multi).
+type Scoped interface {
+	// Scope returns the service types (ClusterIP, NodePort, LoadBalancer) and IP families (IPv4, IPv6) the backend
+	// handles; all of them if empty.
+	Scope() (serviceTypes, families []string)
+}
+
+// CapacityEstimator is implemented by backends describing the size of their dataplane, so it's estimated before the
+// change sets are applied (see the capacity package).
+type CapacityEstimator interface {
+	// Capacity returns the resources of the backend, with their detected limits. It's called after the setup of the
+	// backend's sink.
+	Capacity() []capacity.Resource
+}
+
+// ObjectCounter is implemented by backends counting the objects they programmed, so they can be inspected with
+// kpngctl (see the inspect package).
+type ObjectCounter interface {
+	// ProgrammedObjects returns the number of objects programmed by the last sync, by kind (ie: "ipv4-nat-rules").
+	// It's called concurrently with the syncs.
+	ProgrammedObjects() map[string]int
+}
+
+// Resyncer is implemented by backends able to rebuild their whole dataplane on demand, ie: after the rules were
+// flushed outside of kpng (see the resync package).
+type Resyncer interface {
+	// Resync schedules a full resync from the current state. It's called concurrently with the syncs, and must
+	// coalesce the repeated calls (ie: with the BoundedFrequencyRunner).
+	Resync()
+}
+
+// Cleaner is implemented by backends able to remove everything they programmed, so the node is left without their
+// dataplane when the agent terminates (see the cleanup package).
+type Cleaner interface {
+	// Cleanup removes the backend's rules, sets and programs. It's called once the backend stopped receiving
+	// changes.
+	Cleanup() error
+}
+
 var registry []UseCmd
 
 type UseCmd struct {
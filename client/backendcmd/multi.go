@@ -0,0 +1,216 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backendcmd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/client/localsink"
+	"sigs.k8s.io/kpng/client/localsink/fanout"
+	"sigs.k8s.io/kpng/client/localsink/ipfamily"
+	"sigs.k8s.io/kpng/client/localsink/servicetypes"
+)
+
+// Multi runs multiple registered backends at once (ie: iptables for node ports, ebpf for cluster IPs), sending
+// each one the services in its scope.
+//
+// The backends' flags are merged; a flag declared by multiple backends is set on all of them.
+type Multi struct {
+	// WrapSink wraps the sink of each backend, before it's restricted to its scope (optional, ie: to monitor it).
+	WrapSink func(backend string, cmd Cmd, sink localsink.Sink) localsink.Sink
+
+	backends []UseCmd
+	cmds     map[string]Cmd
+
+	names        []string
+	serviceTypes []string
+	families     []string
+
+	shared []sharedFlag
+}
+
+type sharedFlag struct {
+	from, to *pflag.Flag
+}
+
+var (
+	_ Cmd      = &Multi{}
+	_ Resyncer = &Multi{}
+	_ Cleaner  = &Multi{}
+)
+
+// NewMulti returns a multi-backend command combining the given backends.
+func NewMulti(backends []UseCmd) *Multi {
+	m := &Multi{
+		backends: backends,
+		cmds:     make(map[string]Cmd, len(backends)),
+	}
+
+	for _, b := range backends {
+		m.cmds[b.Use] = b.New()
+	}
+
+	return m
+}
+
+func (m *Multi) BindFlags(flags *pflag.FlagSet) {
+	flags.StringSliceVar(&m.names, "backends", nil, "backends to run (ie: to-iptables,to-ebpf)")
+	flags.StringArrayVar(&m.serviceTypes, "backend-service-types", nil, "service types handled by a backend, overriding its declared scope (ie: to-iptables=NodePort,LoadBalancer)")
+	flags.StringArrayVar(&m.families, "backend-families", nil, "IP families handled by a backend, overriding its declared scope (ie: to-ebpf=IPv4)")
+
+	for _, b := range m.backends {
+		backendFlags := pflag.NewFlagSet(b.Use, pflag.ContinueOnError)
+		m.cmds[b.Use].BindFlags(backendFlags)
+
+		backendFlags.VisitAll(func(f *pflag.Flag) {
+			if existing := flags.Lookup(f.Name); existing != nil {
+				m.shared = append(m.shared, sharedFlag{from: existing, to: f})
+				return
+			}
+			flags.AddFlag(f)
+		})
+	}
+}
+
+// Backends returns the backends to run (see --backends).
+func (m *Multi) Backends() []string {
+	return m.names
+}
+
+func (m *Multi) Sink() localsink.Sink {
+	if len(m.names) == 0 {
+		klog.Fatal("--backends is required")
+	}
+
+	for _, sf := range m.shared {
+		if err := sf.copy(); err != nil {
+			klog.Fatalf("failed to set the shared flag --%s: %v", sf.from.Name, err)
+		}
+	}
+
+	serviceTypes := parseScopes("--backend-service-types", m.serviceTypes)
+	families := parseScopes("--backend-families", m.families)
+
+	sinks := make([]localsink.Sink, 0, len(m.names))
+
+	for _, name := range m.names {
+		cmd, ok := m.cmds[name]
+		if !ok {
+			klog.Fatalf("unknown backend %q", name)
+		}
+
+		var scopeTypes, scopeFamilies []string
+		if scoped, ok := cmd.(Scoped); ok {
+			scopeTypes, scopeFamilies = scoped.Scope()
+		}
+		if v, ok := serviceTypes[name]; ok {
+			scopeTypes = v
+		}
+		if v, ok := families[name]; ok {
+			scopeFamilies = v
+		}
+
+		klog.Infof("backend %s: service types %v, families %v (all if empty)", name, scopeTypes, scopeFamilies)
+
+		sink := cmd.Sink()
+		if m.WrapSink != nil {
+			sink = m.WrapSink(name, cmd, sink)
+		}
+
+		if len(scopeFamilies) != 0 {
+			familySink, err := ipfamily.New(scopeFamilies, sink)
+			if err != nil {
+				klog.Fatalf("backend %s: %v", name, err)
+			}
+			sink = familySink
+		}
+
+		if len(scopeTypes) != 0 {
+			sink = servicetypes.New(&servicetypes.Config{Types: scopeTypes}, sink)
+		}
+
+		sinks = append(sinks, sink)
+	}
+
+	return fanout.New(sinks...)
+}
+
+// Resync resyncs the backends to run that support it (see Resyncer).
+func (m *Multi) Resync() {
+	for _, name := range m.names {
+		resyncer, ok := m.cmds[name].(Resyncer)
+		if !ok {
+			klog.V(1).Infof("backend %s: resync not supported", name)
+			continue
+		}
+		resyncer.Resync()
+	}
+}
+
+// Cleanup cleans the backends to run up, those not supporting it are retained (see Cleaner).
+func (m *Multi) Cleanup() error {
+	var errs []string
+	for _, name := range m.names {
+		cleaner, ok := m.cmds[name].(Cleaner)
+		if !ok {
+			klog.Warningf("backend %s: cleanup not supported, its dataplane is retained", name)
+			continue
+		}
+		if err := cleaner.Cleanup(); err != nil {
+			errs = append(errs, name+": "+err.Error())
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// copy sets the backend's flag to the value given to the merged flag.
+func (sf sharedFlag) copy() error {
+	if !sf.from.Changed {
+		return nil
+	}
+
+	if from, ok := sf.from.Value.(pflag.SliceValue); ok {
+		if to, ok := sf.to.Value.(pflag.SliceValue); ok {
+			return to.Replace(from.GetSlice())
+		}
+	}
+
+	return sf.to.Value.Set(sf.from.Value.String())
+}
+
+// parseScopes parses values like "to-iptables=NodePort,LoadBalancer".
+func parseScopes(flag string, values []string) map[string][]string {
+	scopes := map[string][]string{}
+
+	for _, value := range values {
+		name, list, ok := strings.Cut(value, "=")
+		if !ok {
+			klog.Fatalf("invalid %s value %q (expected <backend>=<value>[,<value>...])", flag, value)
+		}
+		scopes[name] = strings.Split(list, ",")
+	}
+
+	return scopes
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backendcmd
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/protobuf/proto"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+type testBackend struct {
+	cfg      localsink.Config
+	verbose  bool
+	types    []string
+	families []string
+
+	services map[string]*localnetv1.Service
+	resyncs  int
+	cleanups int
+}
+
+func (b *testBackend) BindFlags(flags *pflag.FlagSet) {
+	b.cfg.BindFlags(flags)
+	flags.BoolVar(&b.verbose, "verbose", false, "")
+}
+
+func (b *testBackend) Scope() (serviceTypes, families []string) {
+	return b.types, b.families
+}
+
+func (b *testBackend) Sink() localsink.Sink { return b }
+
+func (b *testBackend) Resync() { b.resyncs++ }
+
+func (b *testBackend) Cleanup() error {
+	b.cleanups++
+	return nil
+}
+
+func (b *testBackend) Setup() {}
+
+func (b *testBackend) WaitRequest() (string, error) { return b.cfg.WaitRequest() }
+
+func (b *testBackend) Reset() {}
+
+func (b *testBackend) Send(op *localnetv1.OpItem) error {
+	if set := op.GetSet(); set != nil && set.Ref.Set == localnetv1.Set_ServicesSet {
+		svc := &localnetv1.Service{}
+		if err := proto.Unmarshal(set.Bytes, svc); err != nil {
+			return err
+		}
+		b.services[set.Ref.Path] = svc
+	}
+	return nil
+}
+
+func TestMulti(t *testing.T) {
+	a := &testBackend{services: map[string]*localnetv1.Service{}}
+	b := &testBackend{services: map[string]*localnetv1.Service{}, types: []string{"ClusterIP"}, families: []string{"IPv4"}}
+	c := &testBackend{services: map[string]*localnetv1.Service{}}
+
+	m := NewMulti([]UseCmd{
+		{Use: "to-a", New: func() Cmd { return a }},
+		{Use: "to-b", New: func() Cmd { return b }},
+		{Use: "to-c", New: func() Cmd { return c }},
+	})
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	m.BindFlags(flags)
+
+	err := flags.Parse([]string{"--backends=to-a,to-b", "--node-name=node-1", "--verbose", "--backend-service-types=to-a=NodePort"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := m.Sink()
+
+	nodeName, err := sink.WaitRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nodeName != "node-1" || !b.verbose {
+		t.Errorf("shared flags not set on all backends: node %q, verbose %v", nodeName, b.verbose)
+	}
+
+	send := func(svc *localnetv1.Service) {
+		bytes, err := proto.Marshal(svc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sink.Send(&localnetv1.OpItem{Op: &localnetv1.OpItem_Set{Set: &localnetv1.Value{
+			Ref:   &localnetv1.Ref{Set: localnetv1.Set_ServicesSet, Path: svc.Namespace + "/" + svc.Name},
+			Bytes: bytes,
+		}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send(&localnetv1.Service{Namespace: "ns", Name: "dual", Type: "ClusterIP",
+		IPs: &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.0.0.1", "fd00::1")}})
+	send(&localnetv1.Service{Namespace: "ns", Name: "v6", Type: "ClusterIP",
+		IPs: &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("fd00::2")}})
+	send(&localnetv1.Service{Namespace: "ns", Name: "np", Type: "NodePort",
+		IPs: &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.0.0.3")}})
+
+	if len(a.services) != 1 || a.services["ns/np"] == nil {
+		t.Errorf("to-a: expected only ns/np, got %v", a.services)
+	}
+
+	if len(b.services) != 1 || b.services["ns/dual"] == nil {
+		t.Errorf("to-b: expected only ns/dual, got %v", b.services)
+	} else if ips := b.services["ns/dual"].IPs.ClusterIPs; len(ips.V6) != 0 || len(ips.V4) != 1 {
+		t.Errorf("to-b: expected only the IPv4 cluster IP, got %v", ips)
+	}
+
+	if len(c.services) != 0 {
+		t.Errorf("to-c: not selected but got %v", c.services)
+	}
+
+	m.Resync()
+	if a.resyncs != 1 || b.resyncs != 1 || c.resyncs != 0 {
+		t.Errorf("expected only to-a and to-b to be resynced, got %d, %d and %d resyncs", a.resyncs, b.resyncs, c.resyncs)
+	}
+
+	if err := m.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if a.cleanups != 1 || b.cleanups != 1 || c.cleanups != 0 {
+		t.Errorf("expected only to-a and to-b to be cleaned up, got %d, %d and %d cleanups", a.cleanups, b.cleanups, c.cleanups)
+	}
+}
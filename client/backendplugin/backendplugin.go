@@ -0,0 +1,127 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backendplugin serves a localsink.Sink as a backend plugin of the to-plugins backend, so out-of-tree
+// dataplanes (ie: OVS, VPP, a ToR controller) receive the node-local state through the same fullstate or diff
+// callbacks as the in-tree backends, without being built into kpng.
+//
+// A plugin registers by listening on a UNIX socket in kpng's plugins directory:
+//
+//	sink := fullstate.New(&localsink.Config{})
+//	sink.Callback = fullstate.ArrayCallback(apply)
+//
+//	err := backendplugin.Serve(ctx, "/run/kpng/plugins/my-dataplane.sock", sink)
+package backendplugin
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"google.golang.org/grpc"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+// Serve listens on the socket and applies the state streamed by kpng to the sink, until the context is done. The
+// sink's Setup is called once, before listening.
+func Serve(ctx context.Context, socket string, sink localsink.Sink) error {
+	sink.Setup()
+
+	if err := os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(socket); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+
+	srv := grpc.NewServer()
+	localnetv1.RegisterPluginServer(srv, &server{sink: sink})
+
+	go func() {
+		<-ctx.Done()
+		srv.Stop()
+	}()
+
+	klog.Info("serving the backend plugin on ", socket)
+
+	err = srv.Serve(lis)
+	if ctx.Err() != nil {
+		// stopped
+		return nil
+	}
+	return err
+}
+
+type server struct {
+	localnetv1.UnimplementedPluginServer
+
+	// mu serializes the streams, so the sink only gets one of them at a time
+	mu   sync.Mutex
+	sink localsink.Sink
+}
+
+// Apply forwards the operations to the sink and answers each sync once the sink returned. A sync ending an empty
+// change set is a liveness check: it's answered without going through the sink.
+func (s *server) Apply(res localnetv1.Plugin_ApplyServer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+
+	for {
+		op, err := res.Recv()
+		if err != nil {
+			return err
+		}
+
+		syncOp := op.GetSync()
+		if syncOp == nil {
+			if _, reset := op.Op.(*localnetv1.OpItem_Reset_); reset {
+				s.sink.Reset()
+			} else if err := s.sink.Send(op); err != nil {
+				return err
+			}
+
+			changed = true
+			continue
+		}
+
+		if changed {
+			if err := s.sink.Send(op); err != nil {
+				return err
+			}
+			changed = false
+		}
+
+		if err := res.Send(syncOp); err != nil {
+			return err
+		}
+
+		klog.V(2).Info("applied revision ", syncOp.Revision)
+	}
+}
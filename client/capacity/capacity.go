@@ -0,0 +1,120 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package capacity estimates the size of the dataplane a backend will program for the local state (rules, ipset
+// entries, IPVS destinations, BPF map entries...) before the change sets are applied, and checks it against the
+// limits of the node, so the operators see the capacity exhaustion coming instead of discovering it when the kernel
+// refuses the rules.
+//
+// The backends describe their resources as functions of the state's statistics (see
+// backendcmd.CapacityEstimator), the estimation itself is backend-agnostic.
+package capacity
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	// ModeOff disables the estimation.
+	ModeOff = "off"
+	// ModeWarn logs a warning when the estimated size of a resource exceeds its limit.
+	ModeWarn = "warn"
+	// ModeRefuse also holds the change sets exceeding the limits, the backend keeping its previous state until the
+	// state fits again.
+	ModeRefuse = "refuse"
+)
+
+type Config struct {
+	Mode string
+
+	// Limits override the limits of the resources detected by the backend, by resource name (0 disables the check).
+	Limits map[string]int
+}
+
+func (c *Config) BindFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.Mode, "capacity-mode", ModeWarn, "when the estimated dataplane size exceeds the limits: warn, refuse (keep the previous state until it fits) or off")
+	flags.StringToIntVar(&c.Limits, "capacity-limits", nil, "limits of the dataplane resources, overriding the detected ones (ie: iptables-rules=200000)")
+}
+
+// Enabled returns true iff the estimation is enabled.
+func (c *Config) Enabled() bool {
+	return c != nil && c.Mode != ModeOff
+}
+
+// Validate checks the mode.
+func (c *Config) Validate() error {
+	switch c.Mode {
+	case ModeOff, ModeWarn, ModeRefuse:
+		return nil
+	default:
+		return fmt.Errorf("invalid capacity mode %q (must be %s, %s or %s)", c.Mode, ModeOff, ModeWarn, ModeRefuse)
+	}
+}
+
+// Stats are the statistics of the local state the resources are estimated from.
+type Stats struct {
+	Services int
+	// Ports are the ports (and port ranges) of the services.
+	Ports int
+	// IPPorts are the ports of the services times their IPs (cluster, external and load-balancer IPs).
+	IPPorts int
+	// NodePorts are the node ports of the services.
+	NodePorts int
+	Endpoints int
+	// PortEndpoints are the ports of the services times their endpoints.
+	PortEndpoints int
+	// IPPortEndpoints are the ports of the services times their IPs and their endpoints.
+	IPPortEndpoints int
+}
+
+// Resource is a dataplane resource of a backend.
+type Resource struct {
+	// Name of the resource (ie: iptables-rules).
+	Name string
+	// Limit is the max size of the resource, as detected by the backend (unlimited if 0).
+	Limit int
+	// Estimate returns the size of the resource for the state.
+	Estimate func(Stats) int
+}
+
+// Estimate is the estimated size of a resource.
+type Estimate struct {
+	Resource string
+	Size     int
+	// Limit is the max size of the resource, unlimited if 0.
+	Limit int
+}
+
+// Exceeded returns true if the estimated size exceeds the limit.
+func (e Estimate) Exceeded() bool {
+	return e.Limit > 0 && e.Size > e.Limit
+}
+
+// EstimateAll estimates the resources for the state, with the limits of the config.
+func (c *Config) EstimateAll(resources []Resource, stats Stats) (estimates []Estimate) {
+	estimates = make([]Estimate, 0, len(resources))
+	for _, r := range resources {
+		limit := r.Limit
+		if override, ok := c.Limits[r.Name]; ok {
+			limit = override
+		}
+
+		estimates = append(estimates, Estimate{Resource: r.Name, Size: r.Estimate(stats), Limit: limit})
+	}
+	return
+}
@@ -0,0 +1,297 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacity
+
+import (
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+// Sink wraps a sink to estimate the resources of the backend before each change set is applied (when its sync is
+// received), warning about the resources exceeding their limits or, in refuse mode, holding the change set.
+type Sink struct {
+	sink      localsink.Sink
+	config    *Config
+	resources func() []Resource
+
+	// OnEstimate is called with the estimates of each change set (optional).
+	OnEstimate func([]Estimate)
+
+	services  map[string]serviceStats
+	endpoints map[string]map[string]bool // service path -> endpoint paths
+
+	// the exceeded resources last reported
+	exceeded string
+
+	// refuse mode: the ops not sent to the wrapped sink yet, and the entries it has
+	pendingReset bool
+	pending      map[opKey]*localnetv1.OpItem
+	applied      map[opKey]bool
+}
+
+type serviceStats struct {
+	ports, ips, nodePorts int
+}
+
+type opKey struct {
+	set  localnetv1.Set
+	path string
+}
+
+var _ localsink.Sink = &Sink{}
+
+// NewSink returns the sink estimating the resources, which are listed once the wrapped sink is set up (so the
+// backends can detect their limits).
+func NewSink(config *Config, resources func() []Resource, sink localsink.Sink) *Sink {
+	s := &Sink{
+		sink:      sink,
+		config:    config,
+		resources: resources,
+		applied:   map[opKey]bool{},
+	}
+	s.clear()
+	return s
+}
+
+func (s *Sink) clear() {
+	s.services = map[string]serviceStats{}
+	s.endpoints = map[string]map[string]bool{}
+	s.pending = map[opKey]*localnetv1.OpItem{}
+}
+
+func (s *Sink) refuseMode() bool {
+	return s.config.Mode == ModeRefuse
+}
+
+func (s *Sink) Setup() { s.sink.Setup() }
+
+func (s *Sink) WaitRequest() (nodeName string, err error) {
+	return s.sink.WaitRequest()
+}
+
+func (s *Sink) Reset() {
+	s.clear()
+
+	if s.refuseMode() {
+		s.pendingReset = true
+		return
+	}
+	s.sink.Reset()
+}
+
+func (s *Sink) Send(op *localnetv1.OpItem) (err error) {
+	switch v := op.Op.(type) {
+	case *localnetv1.OpItem_Reset_:
+		s.clear()
+
+		if s.refuseMode() {
+			s.pendingReset = true
+			return
+		}
+
+	case *localnetv1.OpItem_Set:
+		ref := v.Set.Ref
+
+		switch ref.Set {
+		case localnetv1.Set_ServicesSet:
+			svc := &localnetv1.Service{}
+			if err = proto.Unmarshal(v.Set.Bytes, svc); err != nil {
+				return
+			}
+			s.services[ref.Path] = statsOf(svc)
+
+		case localnetv1.Set_EndpointsSet:
+			svcPath := ref.ServicePath()
+
+			eps := s.endpoints[svcPath]
+			if eps == nil {
+				eps = map[string]bool{}
+				s.endpoints[svcPath] = eps
+			}
+			eps[ref.Path] = true
+		}
+
+		if s.refuseMode() {
+			s.pending[opKey{ref.Set, ref.Path}] = op
+			return
+		}
+
+	case *localnetv1.OpItem_Delete:
+		ref := v.Delete
+
+		switch ref.Set {
+		case localnetv1.Set_ServicesSet:
+			delete(s.services, ref.Path)
+
+		case localnetv1.Set_EndpointsSet:
+			svcPath := ref.ServicePath()
+			delete(s.endpoints[svcPath], ref.Path)
+
+			if len(s.endpoints[svcPath]) == 0 {
+				delete(s.endpoints, svcPath)
+			}
+		}
+
+		if s.refuseMode() {
+			s.pending[opKey{ref.Set, ref.Path}] = op
+			return
+		}
+
+	case *localnetv1.OpItem_Sync:
+		if !s.check() {
+			return // refused, the pending ops are kept
+		}
+
+		if s.refuseMode() {
+			if err = s.flush(); err != nil {
+				return
+			}
+		}
+	}
+
+	return s.sink.Send(op)
+}
+
+func statsOf(svc *localnetv1.Service) (stats serviceStats) {
+	stats.ports = len(svc.Ports) + len(svc.PortRanges)
+
+	if ips := svc.IPs; ips != nil && !ips.Headless {
+		stats.ips = len(ips.All().All())
+	}
+
+	for _, port := range svc.Ports {
+		if port.NodePort != 0 {
+			stats.nodePorts++
+		}
+	}
+	return
+}
+
+// Stats returns the statistics of the state received.
+func (s *Sink) Stats() (stats Stats) {
+	for path, svc := range s.services {
+		endpoints := len(s.endpoints[path])
+
+		stats.Services++
+		stats.Ports += svc.ports
+		stats.IPPorts += svc.ports * svc.ips
+		stats.NodePorts += svc.nodePorts
+		stats.Endpoints += endpoints
+		stats.PortEndpoints += svc.ports * endpoints
+		stats.IPPortEndpoints += svc.ports * svc.ips * endpoints
+	}
+	return
+}
+
+// check estimates the resources of the state received, returning false if the change set is refused.
+func (s *Sink) check() (accepted bool) {
+	estimates := s.config.EstimateAll(s.resources(), s.Stats())
+
+	if s.OnEstimate != nil {
+		s.OnEstimate(estimates)
+	}
+
+	exceeded := make([]string, 0)
+	for _, e := range estimates {
+		if e.Exceeded() {
+			exceeded = append(exceeded, e.Resource)
+		}
+	}
+	sort.Strings(exceeded)
+
+	// only report the changes, not every change set
+	if report := strings.Join(exceeded, ","); report != s.exceeded {
+		s.exceeded = report
+
+		for _, e := range estimates {
+			if e.Exceeded() {
+				klog.Warningf("estimated dataplane size exceeds the limit: %s=%d > %d", e.Resource, e.Size, e.Limit)
+			}
+		}
+		if len(exceeded) == 0 {
+			klog.Info("estimated dataplane size back within the limits")
+		} else if s.refuseMode() {
+			klog.Warning("refusing the change sets until the state fits, keeping the previous one")
+		}
+	}
+
+	return len(exceeded) == 0 || !s.refuseMode()
+}
+
+// flush sends the pending ops to the wrapped sink, in an order valid for the backends: the services are set before
+// their endpoints, and deleted after them.
+func (s *Sink) flush() (err error) {
+	if s.pendingReset {
+		s.pendingReset = false
+		s.applied = map[opKey]bool{}
+		s.sink.Reset()
+	}
+
+	keys := make([]opKey, 0, len(s.pending))
+	for key := range s.pending {
+		keys = append(keys, key)
+	}
+
+	rank := func(key opKey) int {
+		_, isDelete := s.pending[key].Op.(*localnetv1.OpItem_Delete)
+		isService := key.set == localnetv1.Set_ServicesSet
+		switch {
+		case isService && !isDelete:
+			return 0
+		case !isService && isDelete:
+			return 1
+		case !isService:
+			return 2
+		default:
+			return 3
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := rank(keys[i]), rank(keys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return keys[i].path < keys[j].path
+	})
+
+	for _, key := range keys {
+		op := s.pending[key]
+
+		if _, isDelete := op.Op.(*localnetv1.OpItem_Delete); isDelete {
+			if !s.applied[key] {
+				continue // never sent
+			}
+			delete(s.applied, key)
+		} else {
+			s.applied[key] = true
+		}
+
+		if err = s.sink.Send(op); err != nil {
+			return
+		}
+	}
+
+	s.pending = map[opKey]*localnetv1.OpItem{}
+	return
+}
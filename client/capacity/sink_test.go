@@ -0,0 +1,218 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacity
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+type testSink struct {
+	localsink.Config
+	ops []string
+}
+
+func (s *testSink) Setup() {}
+func (s *testSink) Reset() { s.ops = append(s.ops, "reset") }
+
+func (s *testSink) Send(op *localnetv1.OpItem) error {
+	switch v := op.Op.(type) {
+	case *localnetv1.OpItem_Set:
+		s.ops = append(s.ops, "set:"+v.Set.Ref.Path)
+	case *localnetv1.OpItem_Delete:
+		s.ops = append(s.ops, "del:"+v.Delete.Path)
+	case *localnetv1.OpItem_Sync:
+		s.ops = append(s.ops, "sync")
+	}
+	return nil
+}
+
+func (s *testSink) take() string {
+	ops := strings.Join(s.ops, ",")
+	s.ops = nil
+	return ops
+}
+
+func setService(path string, ports int, ips ...string) *localnetv1.OpItem {
+	svc := &localnetv1.Service{IPs: &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet(ips...)}}
+	for i := 0; i < ports; i++ {
+		svc.Ports = append(svc.Ports, &localnetv1.PortMapping{Port: int32(80 + i), NodePort: int32(30080 + i)})
+	}
+
+	b, err := proto.Marshal(svc)
+	if err != nil {
+		panic(err)
+	}
+
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Set{Set: &localnetv1.Value{
+		Ref:   &localnetv1.Ref{Set: localnetv1.Set_ServicesSet, Path: path},
+		Bytes: b,
+	}}}
+}
+
+func setEndpoint(path string) *localnetv1.OpItem {
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Set{Set: &localnetv1.Value{
+		Ref: &localnetv1.Ref{Set: localnetv1.Set_EndpointsSet, Path: path},
+	}}}
+}
+
+func del(set localnetv1.Set, path string) *localnetv1.OpItem {
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Delete{Delete: &localnetv1.Ref{Set: set, Path: path}}}
+}
+
+var syncOp = &localnetv1.OpItem{Op: &localnetv1.OpItem_Sync{Sync: &localnetv1.SyncOp{}}}
+
+// testResources has a resource per endpoint and port, limited to 4.
+func testResources() []Resource {
+	return []Resource{{
+		Name:     "entries",
+		Limit:    4,
+		Estimate: func(stats Stats) int { return stats.PortEndpoints },
+	}}
+}
+
+func TestStats(t *testing.T) {
+	s := NewSink(&Config{Mode: ModeWarn}, testResources, &testSink{})
+
+	s.Send(setService("ns/a", 2, "10.0.0.1", "fd00::1"))
+	s.Send(setEndpoint("ns/a/pod-1"))
+	s.Send(setEndpoint("ns/a/pod-2"))
+	s.Send(setService("ns/b", 1, "10.0.0.2"))
+	s.Send(setEndpoint("ns/orphan/pod-1")) // endpoints of unknown services are not programmed
+
+	expected := Stats{
+		Services:        2,
+		Ports:           3,
+		IPPorts:         5,
+		NodePorts:       3,
+		Endpoints:       2,
+		PortEndpoints:   4,
+		IPPortEndpoints: 8,
+	}
+	if stats := s.Stats(); stats != expected {
+		t.Errorf("expected %+v, got %+v", expected, stats)
+	}
+
+	s.Send(del(localnetv1.Set_EndpointsSet, "ns/a/pod-2"))
+	s.Send(del(localnetv1.Set_ServicesSet, "ns/b"))
+
+	expected = Stats{Services: 1, Ports: 2, IPPorts: 4, NodePorts: 2, Endpoints: 1, PortEndpoints: 2, IPPortEndpoints: 4}
+	if stats := s.Stats(); stats != expected {
+		t.Errorf("after deletes: expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestWarn(t *testing.T) {
+	backend := &testSink{}
+	s := NewSink(&Config{Mode: ModeWarn}, testResources, backend)
+
+	var estimates []Estimate
+	s.OnEstimate = func(e []Estimate) { estimates = e }
+
+	s.Send(setService("ns/a", 1, "10.0.0.1"))
+	for _, ep := range []string{"1", "2", "3", "4", "5"} {
+		s.Send(setEndpoint("ns/a/pod-" + ep))
+	}
+	s.Send(syncOp)
+
+	if ops := backend.take(); ops != "set:ns/a,set:ns/a/pod-1,set:ns/a/pod-2,set:ns/a/pod-3,set:ns/a/pod-4,set:ns/a/pod-5,sync" {
+		t.Errorf("expected all the ops to be passed, got %s", ops)
+	}
+
+	if len(estimates) != 1 || estimates[0] != (Estimate{Resource: "entries", Size: 5, Limit: 4}) || !estimates[0].Exceeded() {
+		t.Errorf("unexpected estimates %+v", estimates)
+	}
+}
+
+func TestRefuse(t *testing.T) {
+	backend := &testSink{}
+	s := NewSink(&Config{Mode: ModeRefuse}, testResources, backend)
+
+	s.Send(setService("ns/a", 1, "10.0.0.1"))
+	s.Send(setEndpoint("ns/a/pod-1"))
+	s.Send(syncOp)
+
+	if ops := backend.take(); ops != "set:ns/a,set:ns/a/pod-1,sync" {
+		t.Errorf("accepted: unexpected ops %s", ops)
+	}
+
+	// exceeding the limit: held
+	s.Send(setService("ns/b", 2, "10.0.0.2"))
+	s.Send(setEndpoint("ns/b/pod-1"))
+	s.Send(setEndpoint("ns/b/pod-2"))
+	s.Send(syncOp)
+
+	if ops := backend.take(); ops != "" {
+		t.Errorf("refused: expected no ops, got %s", ops)
+	}
+
+	// back within the limit: the state is sent, deletes before sets
+	s.Send(del(localnetv1.Set_EndpointsSet, "ns/b/pod-2"))
+	s.Send(del(localnetv1.Set_EndpointsSet, "ns/a/pod-1"))
+	s.Send(syncOp)
+
+	if ops := backend.take(); ops != "set:ns/b,del:ns/a/pod-1,set:ns/b/pod-1,sync" {
+		t.Errorf("accepted again: unexpected ops %s", ops)
+	}
+
+	// a limit of 0 disables the check
+	s.config.Limits = map[string]int{"entries": 0}
+	for _, ep := range []string{"1", "2", "3", "4", "5"} {
+		s.Send(setEndpoint("ns/a/pod-" + ep))
+	}
+	s.Send(syncOp)
+
+	if ops := backend.take(); !strings.HasSuffix(ops, ",sync") {
+		t.Errorf("unlimited: expected the change set to be accepted, got %s", ops)
+	}
+}
+
+func TestRefuseReset(t *testing.T) {
+	backend := &testSink{}
+	s := NewSink(&Config{Mode: ModeRefuse}, testResources, backend)
+
+	s.Send(setService("ns/a", 5, "10.0.0.1"))
+	s.Send(setEndpoint("ns/a/pod-1"))
+	s.Send(syncOp)
+
+	if ops := backend.take(); ops != "" {
+		t.Errorf("refused: expected no ops, got %s", ops)
+	}
+
+	// the held state is replaced
+	s.Reset()
+	s.Send(setService("ns/b", 1, "10.0.0.1"))
+	s.Send(syncOp)
+
+	if ops := backend.take(); ops != "reset,set:ns/b,sync" {
+		t.Errorf("unexpected ops %s", ops)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (&Config{Mode: "maybe"}).Validate(); err == nil {
+		t.Error("expected an error")
+	}
+	if (&Config{Mode: ModeOff}).Enabled() {
+		t.Error("expected disabled")
+	}
+}
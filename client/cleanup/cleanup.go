@@ -0,0 +1,71 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cleanup applies the policy of the dataplane when the node agent terminates: the rules are either retained,
+// so the services keep working while the agent is upgraded or restarted, or flushed, ie: when kpng is uninstalled
+// or replaced by another proxy.
+package cleanup
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Retain leaves the dataplane in place, the next agent resyncs it (the default).
+	Retain = "retain"
+	// Flush removes everything the backend programmed (see backendcmd.Cleaner).
+	Flush = "flush"
+)
+
+type Config struct {
+	// Policy is Retain or Flush.
+	Policy string
+}
+
+func (c *Config) BindFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.Policy, "cleanup-on-exit", Retain, "what to do with the dataplane when terminating: \""+Retain+"\" to leave it in place (ie: for zero-downtime upgrades), or \""+Flush+"\" to remove the chains, ipsets, IPVS services and BPF programs of the backend")
+}
+
+func (c *Config) Validate() error {
+	switch c.Policy {
+	case Retain, Flush:
+		return nil
+	}
+	return fmt.Errorf("cleanup-on-exit must be %q or %q, got %q", Retain, Flush, c.Policy)
+}
+
+// OnExit applies the policy to the backend, once it stopped receiving changes. cleanup is nil if the backend doesn't
+// support the cleanup.
+func (c *Config) OnExit(backend string, cleanup func() error) error {
+	if c.Policy != Flush {
+		klog.Infof("retaining the dataplane of %s", backend)
+		return nil
+	}
+
+	if cleanup == nil {
+		klog.Warningf("%s doesn't support --cleanup-on-exit=%s, its dataplane is retained", backend, Flush)
+		return nil
+	}
+
+	klog.Infof("flushing the dataplane of %s", backend)
+	if err := cleanup(); err != nil {
+		return fmt.Errorf("failed to flush the dataplane of %s: %w", backend, err)
+	}
+	return nil
+}
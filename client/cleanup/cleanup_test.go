@@ -0,0 +1,55 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleanup
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for policy, valid := range map[string]bool{Retain: true, Flush: true, "": false, "delete": false} {
+		if err := (&Config{Policy: policy}).Validate(); (err == nil) != valid {
+			t.Errorf("%q: expected valid=%v, got %v", policy, valid, err)
+		}
+	}
+}
+
+func TestOnExit(t *testing.T) {
+	calls := 0
+	cleanup := func() error {
+		calls++
+		return nil
+	}
+
+	if err := (&Config{Policy: Retain}).OnExit("to-test", cleanup); err != nil || calls != 0 {
+		t.Errorf("retain: expected no cleanup, got %d calls (err: %v)", calls, err)
+	}
+
+	if err := (&Config{Policy: Flush}).OnExit("to-test", cleanup); err != nil || calls != 1 {
+		t.Errorf("flush: expected 1 cleanup, got %d calls (err: %v)", calls, err)
+	}
+
+	if err := (&Config{Policy: Flush}).OnExit("to-test", nil); err != nil {
+		t.Errorf("flush without cleanup: unexpected error %v", err)
+	}
+
+	failure := errors.New("iptables-restore failed")
+	if err := (&Config{Policy: Flush}).OnExit("to-test", func() error { return failure }); !errors.Is(err, failure) {
+		t.Errorf("flush: expected the cleanup error, got %v", err)
+	}
+}
@@ -20,10 +20,12 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
 
 	"k8s.io/klog/v2"
@@ -32,9 +34,13 @@ import (
 	//_ "github.com/Jille/grpc-multi-resolver"
 
 	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/compression"
+	"sigs.k8s.io/kpng/client/connpolicy"
 	"sigs.k8s.io/kpng/client/localsink"
 	"sigs.k8s.io/kpng/client/localsink/fullstate"
+	"sigs.k8s.io/kpng/client/localsink/servicetypes"
 	"sigs.k8s.io/kpng/client/tlsflags"
+	"sigs.k8s.io/kpng/client/tokenfile"
 )
 
 type ServiceEndpoints = fullstate.ServiceEndpoints
@@ -59,18 +65,46 @@ type EndpointsClient struct {
 
 	TLS *tlsflags.Flags
 
-	// ErrorDelay is the delay before retrying after an error.
+	// TokenFile is the file of the token authenticating the calls (none if empty).
+	TokenFile string
+
+	// ErrorDelay is the delay before retrying after an error, multiplied after each consecutive error as configured
+	// by Conn (up to its max delay).
 	ErrorDelay time.Duration
 
+	// Conn configures the keepalive pings and the reconnections.
+	Conn connpolicy.Config
+
+	// OnConnState is called with the states of the connections to the API, ie: to expose them as metrics (optional).
+	OnConnState func(connectivity.State)
+
 	// GRPCBuffer is the max size of a gRPC message
 	MaxMsgSize int
 
+	// Compression is the compressor requested for the stream ("none" or empty to disable).
+	Compression string
+
 	Sink localsink.Sink
 
+	// ServiceTypes restricts the services sent by the API to those types (all types if empty), also enforced by
+	// filtering the Sink's services.
+	ServiceTypes []string
+
+	// serviceTypes is the --service-types flag, the comma separated ServiceTypes
+	serviceTypes string
+	// typesFilter is the sink filtering the services of the Sink set by the user
+	typesFilter *servicetypes.Sink
+
 	conn     *grpc.ClientConn
 	watch    localnetv1.Endpoints_WatchClient
 	watchReq *localnetv1.WatchReq
 
+	// revision is the revision of the last change set fully received, to resume the watch after
+	// reconnecting (0 to receive the whole state).
+	revision uint64
+
+	backoff *connpolicy.Backoff
+
 	ctx    context.Context
 	cancel func()
 }
@@ -79,16 +113,45 @@ type EndpointsClient struct {
 func (epc *EndpointsClient) DefaultFlags(flags FlagSet) {
 	flags.StringVar(&epc.Target, "api", "127.0.0.1:12090", "API to reach (can use multi:///1.0.0.1:1234,1.0.0.2:1234)")
 
-	flags.DurationVar(&epc.ErrorDelay, "error-delay", 1*time.Second, "duration to wait before retrying after errors")
+	flags.DurationVar(&epc.ErrorDelay, "error-delay", 1*time.Second, "duration to wait before retrying after an error (multiplied by --backoff-multiplier after each consecutive error, up to --backoff-max-delay)")
+
+	epc.Conn.Bind(flags, "")
 
 	flags.IntVar(&epc.MaxMsgSize, "max-msg-size", 4<<20, "max gRPC message size")
 
+	flags.StringVar(&epc.Compression, "compression", compression.None, "compression of the stream (none or gzip)")
+
 	epc.TLS.Bind(flags, "")
+
+	flags.StringVar(&epc.TokenFile, "token-file", "", "file of the bearer token authenticating to the API (ie: a projected service account token, requires TLS)")
+
+	flags.StringVar(&epc.serviceTypes, "service-types", "", "only handle services of these comma separated types (ClusterIP, NodePort, LoadBalancer); all types if empty")
+}
+
+// filterServiceTypes wraps the Sink to only pass the services of the ServiceTypes, so they're enforced even if the API
+// doesn't filter them. The Sink is wrapped again if the user replaces it.
+func (epc *EndpointsClient) filterServiceTypes() {
+	if len(epc.ServiceTypes) == 0 && epc.serviceTypes != "" {
+		for _, serviceType := range strings.Split(epc.serviceTypes, ",") {
+			if serviceType = strings.TrimSpace(serviceType); serviceType != "" {
+				epc.ServiceTypes = append(epc.ServiceTypes, serviceType)
+			}
+		}
+	}
+
+	if len(epc.ServiceTypes) == 0 || (epc.typesFilter != nil && epc.Sink == localsink.Sink(epc.typesFilter)) {
+		return
+	}
+
+	epc.typesFilter = servicetypes.New(&servicetypes.Config{Types: epc.ServiceTypes}, epc.Sink)
+	epc.Sink = epc.typesFilter
 }
 
 // Next sends the next diff to the sink, waiting for a new revision as needed.
 // It's designed to never fail, unless canceled.
 func (epc *EndpointsClient) Next() (canceled bool) {
+	epc.filterServiceTypes()
+
 	if epc.watch == nil {
 		epc.dial()
 	}
@@ -107,7 +170,9 @@ retry:
 	}
 
 	err = epc.watch.Send(&localnetv1.WatchReq{
-		NodeName: nodeName,
+		NodeName:     nodeName,
+		ServiceTypes: epc.ServiceTypes,
+		Revision:     epc.revision,
 	})
 	if err != nil {
 		epc.postError()
@@ -123,6 +188,24 @@ retry:
 			goto retry
 		}
 
+		switch v := op.Op; v.(type) {
+		case *localnetv1.OpItem_Reset_:
+			// the watch was not resumed
+			epc.revision = 0
+			epc.Sink.Reset()
+			continue
+
+		case *localnetv1.OpItem_Sync:
+			epc.revision = op.GetSync().GetRevision()
+			if epc.backoff != nil {
+				epc.backoff.Reset()
+			}
+
+		default:
+			// the change set is partially received until the next sync
+			epc.revision = 0
+		}
+
 		// pass the op to the sync
 		epc.Sink.Send(op)
 
@@ -172,14 +255,35 @@ func (epc *EndpointsClient) DialContext(ctx context.Context) (conn *grpc.ClientC
 		grpc.WithMaxMsgSize(epc.MaxMsgSize),
 	)
 
-	tlsCfg := epc.TLS.Config()
+	compressionOpts, err := compression.DialOptions(epc.Compression)
+	if err != nil {
+		return
+	}
+	opts = append(opts, compressionOpts...)
+	opts = append(opts, tokenfile.DialOptions(epc.TokenFile)...)
+	opts = append(opts, epc.Conn.DialOptions()...)
+
+	tlsCfg, err := epc.TLS.ClientConfig()
+	if err != nil {
+		return
+	}
+
 	if tlsCfg == nil {
 		opts = append(opts, grpc.WithInsecure())
 	} else {
 		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))
 	}
 
-	return grpc.DialContext(epc.ctx, epc.Target, opts...)
+	conn, err = grpc.DialContext(epc.ctx, epc.Target, opts...)
+	if err != nil {
+		return
+	}
+
+	if epc.OnConnState != nil {
+		go connpolicy.WatchState(epc.ctx, conn, epc.OnConnState)
+	}
+
+	return
 }
 
 func (epc *EndpointsClient) Dial() (conn *grpc.ClientConn, err error) {
@@ -214,14 +318,27 @@ retry:
 		goto retry
 	}
 
-	epc.Sink.Reset()
+	if epc.revision == 0 {
+		// not resuming, start from an empty state
+		epc.Sink.Reset()
+	}
 
 	//klog.V(1).Info("connected")
 	return false
 }
 
 func (epc *EndpointsClient) errorSleep() {
-	time.Sleep(epc.ErrorDelay)
+	if epc.backoff == nil {
+		epc.backoff = epc.Conn.NewBackoff(epc.ErrorDelay)
+	}
+
+	delay := epc.backoff.Next()
+	klog.V(1).Info("retrying in ", delay)
+
+	select {
+	case <-time.After(delay):
+	case <-epc.ctx.Done():
+	}
 }
 
 func (epc *EndpointsClient) postError() {
@@ -0,0 +1,101 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/protobuf/proto"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+)
+
+type recordSink struct {
+	paths []string
+}
+
+func (s *recordSink) Setup()                       {}
+func (s *recordSink) WaitRequest() (string, error) { return "", nil }
+func (s *recordSink) Reset()                       { s.paths = nil }
+func (s *recordSink) Send(op *localnetv1.OpItem) error {
+	if set := op.GetSet(); set != nil {
+		s.paths = append(s.paths, set.Ref.Path)
+	}
+	return nil
+}
+
+func setService(path, serviceType string) *localnetv1.OpItem {
+	b, _ := proto.Marshal(&localnetv1.Service{Type: serviceType})
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Set{Set: &localnetv1.Value{
+		Ref:   &localnetv1.Ref{Set: localnetv1.Set_ServicesSet, Path: path},
+		Bytes: b,
+	}}}
+}
+
+func TestServiceTypesFlag(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	epc := New(flags)
+	defer epc.Cancel()
+
+	if err := flags.Parse([]string{"--service-types=ClusterIP, LoadBalancer"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recordSink{}
+	epc.Sink = rec
+
+	epc.filterServiceTypes()
+	if len(epc.ServiceTypes) != 2 || epc.ServiceTypes[0] != "ClusterIP" || epc.ServiceTypes[1] != "LoadBalancer" {
+		t.Fatalf("unexpected service types %v", epc.ServiceTypes)
+	}
+
+	// the sink is wrapped once
+	wrapped := epc.Sink
+	epc.filterServiceTypes()
+	if epc.Sink != wrapped {
+		t.Error("the sink was wrapped again")
+	}
+
+	epc.Sink.Send(setService("test/a", "ClusterIP"))
+	epc.Sink.Send(setService("test/b", "NodePort"))
+	epc.Sink.Send(setService("test/c", "LoadBalancer"))
+
+	if len(rec.paths) != 2 || rec.paths[0] != "test/a" || rec.paths[1] != "test/c" {
+		t.Errorf("expected the services test/a and test/c, got %v", rec.paths)
+	}
+
+	// a new sink is wrapped too
+	rec = &recordSink{}
+	epc.Sink = rec
+	epc.filterServiceTypes()
+
+	epc.Sink.Send(setService("test/b", "NodePort"))
+	if len(rec.paths) != 0 {
+		t.Errorf("expected no service, got %v", rec.paths)
+	}
+}
+
+func TestNoServiceTypes(t *testing.T) {
+	rec := &recordSink{}
+	epc := &EndpointsClient{Sink: rec}
+
+	epc.filterServiceTypes()
+	if epc.Sink != rec {
+		t.Error("the sink was wrapped without service types")
+	}
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package compression enables the compression of the watch streams.
+//
+// The compression is negotiated through the gRPC stream metadata: the client sends its requests compressed
+// (grpc-encoding header) and the server answers with the same compressor, if it knows it. Importing this
+// package registers the gzip compressor; others (ie: zstd) can be registered with encoding.RegisterCompressor
+// and selected by name.
+package compression
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // registers "gzip"
+)
+
+// None disables the compression.
+const None = "none"
+
+// DialOptions returns the options to dial with to compress the streams with the given compressor.
+func DialOptions(name string) ([]grpc.DialOption, error) {
+	if name == "" || name == None {
+		return nil, nil
+	}
+
+	if encoding.GetCompressor(name) == nil {
+		return nil, fmt.Errorf("unknown compression %q", name)
+	}
+
+	return []grpc.DialOption{grpc.WithDefaultCallOptions(grpc.UseCompressor(name))}, nil
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package connpolicy configures how the clients keep their connection to the API alive and reconnect: the gRPC
+// keepalive pings detecting the dead connections (ie: on lossy links, or behind NATs dropping idle flows), and the
+// exponential backoff of the connection attempts and of the watches restarted after errors.
+package connpolicy
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/keepalive"
+)
+
+type Config struct {
+	// KeepaliveTime is the interval of the keepalive pings (disabled if 0).
+	KeepaliveTime time.Duration
+	// KeepaliveTimeout is how long to wait for a ping's answer before closing the connection.
+	KeepaliveTimeout time.Duration
+
+	// BackoffBaseDelay is the delay before retrying after the first failure.
+	BackoffBaseDelay time.Duration
+	// BackoffMultiplier is the factor applied to the delay after each consecutive failure.
+	BackoffMultiplier float64
+	// BackoffJitter randomizes the delays by up to this fraction, so the clients don't reconnect all at once.
+	BackoffJitter float64
+	// BackoffMaxDelay is the max delay between retries.
+	BackoffMaxDelay time.Duration
+
+	// MinConnectTimeout is the min time given to a connection attempt.
+	MinConnectTimeout time.Duration
+}
+
+// FlagSet matches flag.FlagSet and pflag.FlagSet
+type FlagSet interface {
+	DurationVar(varPtr *time.Duration, name string, value time.Duration, doc string)
+	Float64Var(varPtr *float64, name string, value float64, doc string)
+}
+
+func (c *Config) Bind(flags FlagSet, prefix string) {
+	flags.DurationVar(&c.KeepaliveTime, prefix+"keepalive-time", 0, "interval of the keepalive pings to the API, detecting dead connections (disabled if 0, the server may refuse pings more frequent than its --keepalive-min-time)")
+	flags.DurationVar(&c.KeepaliveTimeout, prefix+"keepalive-timeout", 20*time.Second, "how long to wait for a keepalive ping's answer before closing the connection")
+	flags.DurationVar(&c.BackoffBaseDelay, prefix+"backoff-base-delay", time.Second, "delay before reconnecting to the API after the first failure")
+	flags.Float64Var(&c.BackoffMultiplier, prefix+"backoff-multiplier", 1.6, "factor applied to the reconnection delay after each consecutive failure")
+	flags.Float64Var(&c.BackoffJitter, prefix+"backoff-jitter", 0.2, "fraction of randomization of the reconnection delays")
+	flags.DurationVar(&c.BackoffMaxDelay, prefix+"backoff-max-delay", 30*time.Second, "max delay between reconnections to the API")
+	flags.DurationVar(&c.MinConnectTimeout, prefix+"min-connect-timeout", 20*time.Second, "min time given to a connection attempt")
+}
+
+// Default returns the configuration of the flags' defaults.
+func Default() Config {
+	return Config{
+		KeepaliveTimeout:  20 * time.Second,
+		BackoffBaseDelay:  time.Second,
+		BackoffMultiplier: 1.6,
+		BackoffJitter:     0.2,
+		BackoffMaxDelay:   30 * time.Second,
+		MinConnectTimeout: 20 * time.Second,
+	}
+}
+
+// DialOptions returns the options to dial with to apply the configuration. The zero values use gRPC's defaults.
+func (c *Config) DialOptions() (opts []grpc.DialOption) {
+	if c == nil {
+		return
+	}
+
+	if c.KeepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                c.KeepaliveTime,
+			Timeout:             c.KeepaliveTimeout,
+			PermitWithoutStream: true,
+		}))
+	}
+
+	params := grpc.ConnectParams{
+		Backoff:           backoff.DefaultConfig,
+		MinConnectTimeout: c.MinConnectTimeout,
+	}
+	if c.BackoffBaseDelay > 0 {
+		params.Backoff.BaseDelay = c.BackoffBaseDelay
+	}
+	if c.BackoffMultiplier > 0 {
+		params.Backoff.Multiplier = c.BackoffMultiplier
+	}
+	if c.BackoffJitter > 0 {
+		params.Backoff.Jitter = c.BackoffJitter
+	}
+	if c.BackoffMaxDelay > 0 {
+		params.Backoff.MaxDelay = c.BackoffMaxDelay
+	}
+	if params.MinConnectTimeout <= 0 {
+		params.MinConnectTimeout = 20 * time.Second // gRPC's default
+	}
+
+	opts = append(opts, grpc.WithConnectParams(params))
+	return
+}
+
+// NewBackoff returns the delays between the retries of a job, starting at baseDelay (the configured base delay if
+// 0).
+func (c *Config) NewBackoff(baseDelay time.Duration) *Backoff {
+	cfg := Default()
+	if c != nil {
+		cfg = *c
+	}
+	if baseDelay > 0 {
+		cfg.BackoffBaseDelay = baseDelay
+	}
+	return &Backoff{cfg: cfg}
+}
+
+// Backoff computes the delays between consecutive retries.
+type Backoff struct {
+	cfg      Config
+	failures int
+}
+
+// Next returns the delay before the next retry.
+func (b *Backoff) Next() time.Duration {
+	delay := float64(b.cfg.BackoffBaseDelay)
+	maxDelay := float64(b.cfg.BackoffMaxDelay)
+
+	for i := 0; i < b.failures && (maxDelay <= 0 || delay < maxDelay); i++ {
+		if b.cfg.BackoffMultiplier <= 1 {
+			break
+		}
+		delay *= b.cfg.BackoffMultiplier
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+
+	b.failures++
+
+	delay *= 1 + b.cfg.BackoffJitter*(rand.Float64()*2-1)
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay)
+}
+
+// Reset restarts the delays from the base delay, after a success.
+func (b *Backoff) Reset() {
+	b.failures = 0
+}
+
+// WatchState calls onState with each state of the connection, until it's closed or the context is done.
+func WatchState(ctx context.Context, conn *grpc.ClientConn, onState func(connectivity.State)) {
+	for {
+		state := conn.GetState()
+		onState(state)
+
+		if state == connectivity.Shutdown || !conn.WaitForStateChange(ctx, state) {
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connpolicy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	cfg := Config{
+		BackoffBaseDelay:  time.Second,
+		BackoffMultiplier: 2,
+		BackoffMaxDelay:   5 * time.Second,
+	}
+
+	b := cfg.NewBackoff(0)
+
+	for i, expected := range []time.Duration{1, 2, 4, 5, 5} {
+		if delay := b.Next(); delay != expected*time.Second {
+			t.Errorf("retry %d: expected %v, got %v", i, expected*time.Second, delay)
+		}
+	}
+
+	b.Reset()
+	if delay := b.Next(); delay != time.Second {
+		t.Errorf("after reset: expected 1s, got %v", delay)
+	}
+
+	// the job's base delay overrides the configured one
+	if delay := cfg.NewBackoff(3 * time.Second).Next(); delay != 3*time.Second {
+		t.Errorf("expected the base delay 3s, got %v", delay)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	cfg := Config{BackoffBaseDelay: time.Second, BackoffJitter: 0.2}
+	b := cfg.NewBackoff(0)
+
+	for i := 0; i < 100; i++ {
+		if delay := b.Next(); delay < 800*time.Millisecond || delay > 1200*time.Millisecond {
+			t.Fatalf("delay %v out of the jitter range", delay)
+		}
+	}
+}
+
+func TestZeroConfig(t *testing.T) {
+	// clients created without flags keep a constant delay
+	b := (&Config{}).NewBackoff(5 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		if delay := b.Next(); delay != 5*time.Millisecond {
+			t.Fatalf("expected a constant delay, got %v", delay)
+		}
+	}
+
+	if opts := (*Config)(nil).DialOptions(); len(opts) != 0 {
+		t.Errorf("expected no options, got %d", len(opts))
+	}
+}
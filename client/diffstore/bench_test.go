@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diffstore
+
+import (
+	"fmt"
+	"testing"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+)
+
+func benchService(i int) *localnetv1.Service {
+	return &localnetv1.Service{
+		Namespace: "default",
+		Name:      fmt.Sprint("svc-", i),
+		Type:      "ClusterIP",
+		Labels:    map[string]string{"app": "web", "tier": "frontend"},
+		IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet(fmt.Sprintf("10.0.%d.%d", i/256, i%256))},
+		Ports: []*localnetv1.PortMapping{
+			{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 8080},
+			{Name: "https", Protocol: localnetv1.Protocol_TCP, Port: 443, TargetPort: 8443},
+		},
+	}
+}
+
+func BenchmarkHashers(b *testing.B) {
+	svc := benchService(1)
+
+	b.Run("proto", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ProtoHash(svc)
+		}
+	})
+	b.Run("json", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			JSONHash(svc)
+		}
+	})
+	b.Run("string", func(b *testing.B) {
+		s := svc.String()
+		for i := 0; i < b.N; i++ {
+			StringHash(s)
+		}
+	})
+}
+
+// BenchmarkStoreDiff fills a store of 1000 services, 1% of them changed, and computes the diff.
+func BenchmarkStoreDiff(b *testing.B) {
+	const count = 1000
+
+	services := make([]*localnetv1.Service, count)
+	changed := make([]*localnetv1.Service, count) // same services with another cluster IP
+	for i := range services {
+		services[i] = benchService(i)
+		changed[i] = benchService(i + count)
+		changed[i].Name = services[i].Name
+	}
+
+	b.Run("proto", func(b *testing.B) {
+		store := NewProtoStore[string, *localnetv1.Service]()
+
+		for n := 0; n < b.N; n++ {
+			store.Reset()
+			for i, svc := range services {
+				if i%100 == n%100 {
+					svc = changed[i]
+				}
+				store.Get(svc.Name).Set(svc)
+			}
+			store.Done()
+			store.Changed()
+			store.Deleted()
+		}
+	})
+
+	b.Run("buffer", func(b *testing.B) {
+		store := NewBufferStore[string]()
+
+		for n := 0; n < b.N; n++ {
+			store.Reset()
+			for i, svc := range services {
+				if i%100 == n%100 {
+					svc = changed[i]
+				}
+				fmt.Fprint(store.Get(svc.Name), svc)
+			}
+			store.Done()
+			store.Changed()
+			store.Deleted()
+		}
+	})
+}
@@ -20,7 +20,6 @@ import (
 	"bytes"
 
 	"golang.org/x/exp/constraints"
-	"github.com/cespare/xxhash"
 )
 
 func NewBufferStore[K constraints.Ordered]() *Store[K, *BufferLeaf] {
@@ -42,7 +41,7 @@ func (l *BufferLeaf) Reset() {
 }
 
 func (l *BufferLeaf) Hash() uint64 {
-	return xxhash.Sum64(l.Bytes())
+	return BytesHash(l.Bytes())
 }
 
 func (l *BufferLeaf) Writeln() {
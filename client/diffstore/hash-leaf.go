@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diffstore
+
+import (
+	"fmt"
+
+	"golang.org/x/exp/constraints"
+	"google.golang.org/protobuf/proto"
+)
+
+// NewHashStore returns a store of values whose changes are detected by the given hasher.
+func NewHashStore[K constraints.Ordered, T any](hash Hasher[T]) *Store[K, *HashLeaf[T]] {
+	return New[K](func() *HashLeaf[T] { return NewHashLeaf(hash) })
+}
+
+// NewProtoStore returns a store of protobuf messages (see ProtoHash).
+func NewProtoStore[K constraints.Ordered, T proto.Message]() *Store[K, *HashLeaf[T]] {
+	return NewHashStore[K](ProtoHash[T])
+}
+
+type HashLeaf[T any] struct {
+	hash  Hasher[T]
+	value T
+}
+
+func NewHashLeaf[T any](hash Hasher[T]) *HashLeaf[T] {
+	return &HashLeaf[T]{hash: hash}
+}
+
+var _ Leaf = NewHashLeaf(StringHash)
+
+func (l *HashLeaf[T]) Get() T {
+	return l.value
+}
+
+func (l *HashLeaf[T]) Set(v T) {
+	l.value = v
+}
+
+func (l *HashLeaf[T]) Reset() {
+	var zero T
+	l.value = zero
+}
+
+func (l *HashLeaf[T]) Hash() uint64 {
+	if h := l.hash(l.value); h != 0 {
+		return h
+	}
+	return 1 // 0 means the item didn't exist
+}
+
+func (l *HashLeaf[T]) String() string {
+	return fmt.Sprint(l.value)
+}
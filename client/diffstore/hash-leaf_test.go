@@ -0,0 +1,59 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diffstore
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+)
+
+func ExampleNewProtoStore() {
+	store := NewProtoStore[string, *localnetv1.Service]()
+
+	fill := func(labels ...map[string]string) {
+		store.Reset()
+		for i, l := range labels {
+			store.Get(fmt.Sprint("svc-", i)).Set(&localnetv1.Service{Name: fmt.Sprint("svc-", i), Labels: l})
+		}
+		store.Done()
+
+		for _, i := range store.Changed() {
+			fmt.Println("changed", i.Key())
+		}
+		for _, i := range store.Deleted() {
+			fmt.Println("deleted", i.Key())
+		}
+		fmt.Println("--")
+	}
+
+	fill(map[string]string{"a": "1", "b": "2"})
+	fill(map[string]string{"b": "2", "a": "1"}) // the map entries are hashed in the keys' order
+	fill(map[string]string{"a": "2"}, nil)
+	fill()
+
+	// Output:
+	// changed svc-0
+	// --
+	// --
+	// changed svc-0
+	// changed svc-1
+	// --
+	// deleted svc-0
+	// deleted svc-1
+	// --
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diffstore
+
+import (
+	"encoding/json"
+
+	"github.com/cespare/xxhash"
+	"google.golang.org/protobuf/proto"
+)
+
+// Hasher returns the hash of a value, used to detect its changes between two fillings of a store. Equal values
+// must have the same hash.
+type Hasher[T any] func(v T) uint64
+
+// BytesHash hashes bytes with xxhash.
+func BytesHash(v []byte) uint64 {
+	return xxhash.Sum64(v)
+}
+
+// StringHash hashes a string with xxhash.
+func StringHash(v string) uint64 {
+	return xxhash.Sum64String(v)
+}
+
+// JSONHash hashes the JSON encoding of a value. It panics if the value can't be encoded.
+func JSONHash[T any](v T) uint64 {
+	ba, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return xxhash.Sum64(ba)
+}
+
+// ProtoHash hashes the deterministic encoding of a protobuf message (map entries sorted by key). It panics if the
+// message can't be encoded.
+func ProtoHash[T proto.Message](v T) uint64 {
+	ba, err := proto.MarshalOptions{Deterministic: true}.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return xxhash.Sum64(ba)
+}
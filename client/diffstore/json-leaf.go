@@ -20,7 +20,6 @@ import (
 	"encoding/json"
 
 	"golang.org/x/exp/constraints"
-	"github.com/cespare/xxhash"
 )
 
 func NewJSONStore[K constraints.Ordered, T any]() *Store[K, *JSONLeaf[T]] {
@@ -50,11 +49,7 @@ func (l *JSONLeaf[T]) Reset() {
 }
 
 func (l *JSONLeaf[T]) Hash() uint64 {
-	ba, err := json.Marshal(l.value)
-	if err != nil {
-		panic(err)
-	}
-	return xxhash.Sum64(ba)
+	return JSONHash(l.value)
 }
 
 func (l *JSONLeaf[T]) String() string {
@@ -0,0 +1,210 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package featuregate holds kpng's feature gates, like k8s.io/component-base/featuregate: the experimental behaviors
+// are declared with their maturity and default (see features.go), and toggled per deployment with --feature-gates
+// (or the featureGates of the configuration file).
+package featuregate
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+)
+
+// Feature is the name of a feature gate.
+type Feature string
+
+// Stage is the maturity of a feature.
+type Stage string
+
+const (
+	Alpha Stage = "ALPHA"
+	Beta  Stage = "BETA"
+	GA    Stage = ""
+
+	// Deprecated features are about to be removed.
+	Deprecated Stage = "DEPRECATED"
+)
+
+// FeatureSpec declares a feature.
+type FeatureSpec struct {
+	// Default is the state of the feature when it's not set.
+	Default bool
+	// LockToDefault rejects the values other than the default (ie: GA features whose gate is kept for compatibility).
+	LockToDefault bool
+	PreRelease    Stage
+}
+
+// FeatureGate is a set of features, enabled or not.
+type FeatureGate struct {
+	lock    sync.RWMutex
+	known   map[Feature]FeatureSpec
+	enabled map[Feature]bool
+}
+
+// New returns an empty feature gate.
+func New() *FeatureGate {
+	return &FeatureGate{
+		known:   map[Feature]FeatureSpec{},
+		enabled: map[Feature]bool{},
+	}
+}
+
+// Default is the feature gate of the process, with kpng's features.
+var Default = New()
+
+// Add declares features. A feature can be declared again with the same spec.
+func (g *FeatureGate) Add(features map[Feature]FeatureSpec) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for name, spec := range features {
+		if existing, ok := g.known[name]; ok && existing != spec {
+			return fmt.Errorf("feature gate %q declared twice with different specs", name)
+		}
+	}
+	for name, spec := range features {
+		g.known[name] = spec
+	}
+	return nil
+}
+
+// Enabled returns true if the feature is enabled. It panics if the feature isn't declared.
+func (g *FeatureGate) Enabled(name Feature) bool {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	spec, ok := g.known[name]
+	if !ok {
+		panic(fmt.Sprintf("feature %q is not declared", name))
+	}
+	if v, ok := g.enabled[name]; ok {
+		return v
+	}
+	return spec.Default
+}
+
+// SetFromMap sets the given features. Nothing is set if a feature isn't declared or is locked to its default.
+func (g *FeatureGate) SetFromMap(values map[string]bool) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for name, v := range values {
+		spec, ok := g.known[Feature(name)]
+		if !ok {
+			return fmt.Errorf("unknown feature gate %q (known: %s)", name, strings.Join(g.knownFeatures(), ", "))
+		}
+		if spec.LockToDefault && v != spec.Default {
+			return fmt.Errorf("feature gate %s is locked to %v", name, spec.Default)
+		}
+	}
+
+	for name, v := range values {
+		g.enabled[Feature(name)] = v
+
+		switch spec := g.known[Feature(name)]; spec.PreRelease {
+		case Deprecated:
+			klog.Warningf("feature gate %s is deprecated and will be removed", name)
+		case GA:
+			klog.Warningf("feature gate %s is GA, it will be removed", name)
+		}
+	}
+	return nil
+}
+
+// Set sets the features of a name=true|false comma separated list (the value of --feature-gates).
+func (g *FeatureGate) Set(value string) error {
+	values := map[string]bool{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("missing value in %q (expected name=true|false)", pair)
+		}
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+		values[strings.TrimSpace(name)] = b
+	}
+	return g.SetFromMap(values)
+}
+
+// String returns the features set, as a name=true|false comma separated list.
+func (g *FeatureGate) String() string {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	pairs := make([]string, 0, len(g.enabled))
+	for name, v := range g.enabled {
+		pairs = append(pairs, string(name)+"="+strconv.FormatBool(v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Type is the type of the --feature-gates flag.
+func (g *FeatureGate) Type() string {
+	return "mapStringBool"
+}
+
+var _ pflag.Value = &FeatureGate{}
+
+// KnownFeatures describes the declared features (ie: "StrictNoMasquerade=true|false (ALPHA - default=false)").
+func (g *FeatureGate) KnownFeatures() []string {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	return g.knownFeatures()
+}
+
+func (g *FeatureGate) knownFeatures() []string {
+	features := make([]string, 0, len(g.known))
+	for name, spec := range g.known {
+		stage := string(spec.PreRelease)
+		if stage == "" {
+			stage = "GA"
+		}
+		features = append(features, fmt.Sprintf("%s=true|false (%s - default=%v)", name, stage, spec.Default))
+	}
+	sort.Strings(features)
+	return features
+}
+
+// BindFlags binds --feature-gates to the gate.
+func (g *FeatureGate) BindFlags(flags *pflag.FlagSet) {
+	flags.Var(g, "feature-gates", "feature gates to set, as name=true|false pairs (ie: A=true,B=false). Options are:\n"+strings.Join(g.KnownFeatures(), "\n"))
+}
+
+// Enabled returns true if the feature is enabled in the Default gate.
+func Enabled(name Feature) bool {
+	return Default.Enabled(name)
+}
+
+// BindFlags binds --feature-gates to the Default gate.
+func BindFlags(flags *pflag.FlagSet) {
+	Default.BindFlags(flags)
+}
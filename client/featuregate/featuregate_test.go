@@ -0,0 +1,77 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuregate
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestFeatureGate(t *testing.T) {
+	g := New()
+	if err := g.Add(map[Feature]FeatureSpec{
+		"TestAlpha":  {Default: false, PreRelease: Alpha},
+		"TestBeta":   {Default: true, PreRelease: Beta},
+		"TestLocked": {Default: true, LockToDefault: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if g.Enabled("TestAlpha") || !g.Enabled("TestBeta") {
+		t.Fatal("expected the defaults before the flag is set")
+	}
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	g.BindFlags(flags)
+
+	if err := flags.Parse([]string{"--feature-gates=TestAlpha=true, TestBeta=false,TestLocked=true"}); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Enabled("TestAlpha") || g.Enabled("TestBeta") || !g.Enabled("TestLocked") {
+		t.Error("expected the gates set by the flag")
+	}
+	if s := flags.Lookup("feature-gates").Value.String(); s != "TestAlpha=true,TestBeta=false,TestLocked=true" {
+		t.Errorf("unexpected flag value %q", s)
+	}
+
+	for _, value := range []string{"TestGamma=true", "TestAlpha", "TestAlpha=maybe", "TestAlpha=false,TestLocked=false"} {
+		if err := flags.Set("feature-gates", value); err == nil {
+			t.Errorf("%q should be rejected", value)
+		}
+	}
+	if !g.Enabled("TestAlpha") {
+		t.Error("a rejected value should leave the gates as they were")
+	}
+
+	if err := g.Add(map[Feature]FeatureSpec{"TestAlpha": {Default: true, PreRelease: Beta}}); err == nil {
+		t.Error("a feature declared again with another spec should be rejected")
+	}
+}
+
+func TestDefaultFeatures(t *testing.T) {
+	known := Default.KnownFeatures()
+	if len(known) != len(defaultFeatures) {
+		t.Fatalf("expected the %d kpng features, got %v", len(defaultFeatures), known)
+	}
+
+	for name, spec := range defaultFeatures {
+		if Enabled(name) != spec.Default {
+			t.Errorf("%s: expected the default %v", name, spec.Default)
+		}
+	}
+}
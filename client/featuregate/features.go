@@ -0,0 +1,43 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuregate
+
+const (
+	// ProxyTerminatingEndpoints sends the traffic of a service to its serving terminating endpoints when it has no
+	// ready ones (for each traffic policy), so the connections of a rolling update aren't dropped. Resolved by the
+	// server.
+	ProxyTerminatingEndpoints Feature = "ProxyTerminatingEndpoints"
+
+	// TopologyAwareHints only sends a node the endpoints hinted for its zone. Resolved by the server.
+	TopologyAwareHints Feature = "TopologyAwareHints"
+
+	// StrictNoMasquerade never masquerades the off-cluster traffic to the cluster IPs (see --detect-local-mode), so
+	// the endpoints see the clients' IPs. --masquerade-all and the kpng.k8s.io/masquerade annotation still apply.
+	StrictNoMasquerade Feature = "StrictNoMasquerade"
+)
+
+var defaultFeatures = map[Feature]FeatureSpec{
+	ProxyTerminatingEndpoints: {Default: false, PreRelease: Alpha},
+	TopologyAwareHints:        {Default: true, PreRelease: Beta},
+	StrictNoMasquerade:        {Default: false, PreRelease: Alpha},
+}
+
+func init() {
+	if err := Default.Add(defaultFeatures); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health reports the health of a node agent on /healthz and /readyz: the last successful sync of each
+// backend and the state of the stream to the server.
+//
+// The agent is ready once all its backends synced a change set. With a staleness threshold, it's not ready anymore
+// when a backend didn't apply the change sets received for longer than the threshold, or when the stream to the
+// server is down for longer than the threshold.
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc/connectivity"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/backendcmd"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+type Config struct {
+	// StaleAfter is the staleness threshold (disabled if 0).
+	StaleAfter time.Duration
+}
+
+func (c *Config) BindFlags(flags *pflag.FlagSet) {
+	flags.DurationVar(&c.StaleAfter, "ready-stale-after", 0, "fail /readyz when a backend didn't apply the received changes, or the stream to the server is down, for this long (0 to disable)")
+}
+
+// ConnectionState returns the state of the stream to the server, and since when it's in this state (ok is false if
+// the agent doesn't connect to a server).
+type ConnectionState func() (state connectivity.State, since time.Time, ok bool)
+
+// Status is the health of the agent, as served on /healthz and /readyz.
+type Status struct {
+	Ready bool `json:"ready"`
+	// Reasons are the reasons the agent is not ready.
+	Reasons []string `json:"reasons,omitempty"`
+
+	Backends map[string]BackendStatus `json:"backends"`
+	// Connection is the stream to the server (none if the agent doesn't connect to a server).
+	Connection *ConnectionStatus `json:"connection,omitempty"`
+}
+
+type BackendStatus struct {
+	// LastSync is the time of the last successful sync (none if not synced yet).
+	LastSync *time.Time `json:"lastSync,omitempty"`
+	// PendingSince is the time of the first change set received and not applied yet (none if up to date).
+	PendingSince *time.Time `json:"pendingSince,omitempty"`
+}
+
+type ConnectionStatus struct {
+	State string    `json:"state"`
+	Since time.Time `json:"since"`
+}
+
+// Checker tracks the health of the agent's backends.
+type Checker struct {
+	Config *Config
+
+	// Connection returns the state of the stream to the server (optional).
+	Connection ConnectionState
+
+	mu       sync.Mutex
+	backends map[string]*backendState
+}
+
+type backendState struct {
+	lastSync, pendingSince time.Time
+}
+
+// NewChecker returns a checker for the given backends.
+func NewChecker(config *Config, backends ...string) *Checker {
+	c := &Checker{
+		Config:   config,
+		backends: make(map[string]*backendState, len(backends)),
+	}
+
+	for _, backend := range backends {
+		c.backends[backend] = &backendState{}
+	}
+
+	return c
+}
+
+// Received records that a change set was received, to be applied by all the backends.
+func (c *Checker) Received() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for _, state := range c.backends {
+		if state.pendingSince.IsZero() {
+			state.pendingSince = now
+		}
+	}
+}
+
+// Synced records a successful sync of the backend.
+func (c *Checker) Synced(backend string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := c.backends[backend]
+	if state == nil {
+		state = &backendState{}
+		c.backends[backend] = state
+	}
+
+	state.lastSync = time.Now()
+	state.pendingSince = time.Time{}
+}
+
+// Status returns the current health of the agent.
+func (c *Checker) Status() (status Status) {
+	now := time.Now()
+	staleAfter := c.Config.StaleAfter
+
+	status.Backends = map[string]BackendStatus{}
+
+	c.mu.Lock()
+
+	names := make([]string, 0, len(c.backends))
+	for name := range c.backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		state := c.backends[name]
+		backendStatus := BackendStatus{}
+
+		if state.lastSync.IsZero() {
+			status.Reasons = append(status.Reasons, fmt.Sprintf("backend %s: not synced yet", name))
+		} else {
+			lastSync := state.lastSync
+			backendStatus.LastSync = &lastSync
+		}
+
+		if !state.pendingSince.IsZero() {
+			pendingSince := state.pendingSince
+			backendStatus.PendingSince = &pendingSince
+
+			if pending := now.Sub(pendingSince); staleAfter != 0 && pending > staleAfter && !state.lastSync.IsZero() {
+				status.Reasons = append(status.Reasons, fmt.Sprintf("backend %s: changes not applied for %v", name, pending.Round(time.Second)))
+			}
+		}
+
+		status.Backends[name] = backendStatus
+	}
+
+	c.mu.Unlock()
+
+	if c.Connection != nil {
+		if state, since, ok := c.Connection(); ok {
+			status.Connection = &ConnectionStatus{State: state.String(), Since: since}
+
+			if down := now.Sub(since); state != connectivity.Ready && staleAfter != 0 && down > staleAfter {
+				status.Reasons = append(status.Reasons, fmt.Sprintf("stream to the server %s for %v", state, down.Round(time.Second)))
+			}
+		}
+	}
+
+	status.Ready = len(status.Reasons) == 0
+	return
+}
+
+// ServeHealthz serves the status of the agent; it's healthy as long as it serves it.
+func (c *Checker) ServeHealthz(w http.ResponseWriter, _ *http.Request) {
+	c.serve(w, c.Status(), http.StatusOK)
+}
+
+// ServeReadyz serves the status of the agent, failing if it's not ready.
+func (c *Checker) ServeReadyz(w http.ResponseWriter, _ *http.Request) {
+	status := c.Status()
+
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	c.serve(w, status, code)
+}
+
+func (c *Checker) serve(w http.ResponseWriter, status Status, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
+
+// ReceiverSink wraps the agent's sink to record the change sets received.
+func (c *Checker) ReceiverSink(sink localsink.Sink) localsink.Sink {
+	return &syncSink{Sink: sink, before: c.Received}
+}
+
+// Sink wraps the sink of a backend to record its syncs, once its change sets are sent to it without error.
+func (c *Checker) Sink(backend string, sink localsink.Sink) localsink.Sink {
+	return &syncSink{Sink: sink, after: func() { c.Synced(backend) }}
+}
+
+// WrapBackend records the syncs of a backend of a backendcmd.Multi (see Multi.WrapSink), once it applied its
+// change sets if it reports it, once they're sent to it without error otherwise.
+func (c *Checker) WrapBackend(backend string, cmd backendcmd.Cmd, sink localsink.Sink) localsink.Sink {
+	if strict, ok := cmd.(backendcmd.StrictReadiness); ok {
+		strict.OnApplied(func() { c.Synced(backend) })
+		return sink
+	}
+	return c.Sink(backend, sink)
+}
+
+// syncSink calls before and after (if not nil) around the syncs sent to the sink, after only if the sync succeeded.
+type syncSink struct {
+	localsink.Sink
+	before, after func()
+}
+
+func (s *syncSink) Send(op *localnetv1.OpItem) error {
+	_, isSync := op.Op.(*localnetv1.OpItem_Sync)
+
+	if isSync && s.before != nil {
+		s.before()
+	}
+
+	if err := s.Sink.Send(op); err != nil {
+		return err
+	}
+
+	if isSync && s.after != nil {
+		s.after()
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+type testSink struct {
+	localsink.Config
+}
+
+func (s *testSink) Setup()                           {}
+func (s *testSink) Reset()                           {}
+func (s *testSink) Send(op *localnetv1.OpItem) error { return nil }
+
+var syncOp = &localnetv1.OpItem{Op: &localnetv1.OpItem_Sync{Sync: &localnetv1.SyncOp{}}}
+
+func readyz(c *Checker) int {
+	rec := httptest.NewRecorder()
+	c.ServeReadyz(rec, httptest.NewRequest("GET", "/readyz", nil))
+	return rec.Code
+}
+
+func TestChecker(t *testing.T) {
+	c := NewChecker(&Config{StaleAfter: time.Minute}, "to-a", "to-b")
+
+	sink := c.ReceiverSink(c.Sink("to-a", &testSink{}))
+	sink.Send(syncOp)
+
+	status := c.Status()
+	if status.Ready || !reflect.DeepEqual(status.Reasons, []string{"backend to-b: not synced yet"}) {
+		t.Errorf("expected to wait for to-b, got %+v", status)
+	}
+	if status.Backends["to-a"].LastSync == nil || status.Backends["to-a"].PendingSince != nil {
+		t.Errorf("expected to-a to be synced, got %+v", status.Backends["to-a"])
+	}
+	if code := readyz(c); code != http.StatusServiceUnavailable {
+		t.Errorf("expected /readyz to fail, got %d", code)
+	}
+
+	c.Synced("to-b")
+
+	if code := readyz(c); code != http.StatusOK {
+		t.Errorf("expected /readyz to succeed, got %d: %+v", code, c.Status())
+	}
+
+	// to-b doesn't apply the next change set
+	c.Received()
+	c.Synced("to-a")
+	c.backends["to-b"].pendingSince = time.Now().Add(-2 * time.Minute)
+
+	status = c.Status()
+	if status.Ready || len(status.Reasons) != 1 || status.Backends["to-b"].PendingSince == nil {
+		t.Errorf("expected to-b to be stale, got %+v", status)
+	}
+
+	c.Synced("to-b")
+
+	// the stream to the server is down
+	since := time.Now().Add(-2 * time.Minute)
+	c.Connection = func() (connectivity.State, time.Time, bool) { return connectivity.TransientFailure, since, true }
+
+	status = c.Status()
+	if status.Ready || status.Connection == nil || status.Connection.State != "TRANSIENT_FAILURE" {
+		t.Errorf("expected the connection to be stale, got %+v", status)
+	}
+
+	// ... without staleness threshold
+	c.Config.StaleAfter = 0
+	if status = c.Status(); !status.Ready {
+		t.Errorf("expected to be ready without threshold, got %+v", status)
+	}
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package inspect exposes the state received by a node agent, and the objects programmed by its backend, for
+// kpngctl.
+package inspect
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+// Path is the path of the agent's state on its metrics server.
+const Path = "/debug/state"
+
+// State is the state of a node agent, as served on Path.
+type State struct {
+	NodeName string `json:"nodeName"`
+	// Syncs is the number of change sets received since the agent started.
+	Syncs int `json:"syncs"`
+	// LastSync is the time the last change set was received.
+	LastSync time.Time `json:"lastSync,omitempty"`
+	// Services are the services received, with their endpoints.
+	Services []ServiceEndpoints `json:"services"`
+	// Changes are the changes of the last change set.
+	Changes []Change `json:"changes"`
+	// Pending are the changes received since the last change set, not synced yet.
+	Pending []Change `json:"pending"`
+	// Objects are the objects programmed by the backend by kind, if it counts them.
+	Objects map[string]int `json:"objects,omitempty"`
+}
+
+// ServiceEndpoints is a service with its endpoints, encoded as their protobuf JSON mapping.
+type ServiceEndpoints struct {
+	Service   *localnetv1.Service
+	Endpoints []*localnetv1.Endpoint
+}
+
+func (s ServiceEndpoints) MarshalJSON() ([]byte, error) {
+	return protojson.Marshal(&localnetv1.ServiceEndpoints{Service: s.Service, Endpoints: s.Endpoints})
+}
+
+func (s *ServiceEndpoints) UnmarshalJSON(data []byte) error {
+	msg := &localnetv1.ServiceEndpoints{}
+	if err := protojson.Unmarshal(data, msg); err != nil {
+		return err
+	}
+	s.Service, s.Endpoints = msg.Service, msg.Endpoints
+	return nil
+}
+
+// Change is a Set or Delete operation received.
+type Change struct {
+	// Op is "set" or "delete".
+	Op   string `json:"op"`
+	Set  string `json:"set"`
+	Path string `json:"path"`
+}
+
+// ObjectCounter returns the number of objects programmed by the backend, by kind.
+type ObjectCounter func() map[string]int
+
+// Sink wraps a sink to record the state it receives, serving it on Path (see State).
+type Sink struct {
+	sink localsink.Sink
+
+	// Objects counts the objects programmed by the backend (optional).
+	Objects ObjectCounter
+
+	mu        sync.Mutex
+	nodeName  string
+	syncs     int
+	lastSync  time.Time
+	services  map[string]*localnetv1.Service
+	endpoints map[string]map[string]*localnetv1.Endpoint // service path -> endpoint path -> endpoint
+	changes   []Change
+	pending   []Change
+}
+
+var (
+	_ localsink.Sink = &Sink{}
+	_ http.Handler   = &Sink{}
+)
+
+func NewSink(sink localsink.Sink) *Sink {
+	s := &Sink{sink: sink}
+	s.clear()
+	return s
+}
+
+func (s *Sink) clear() {
+	s.services = map[string]*localnetv1.Service{}
+	s.endpoints = map[string]map[string]*localnetv1.Endpoint{}
+	s.pending = nil
+}
+
+func (s *Sink) Setup() { s.sink.Setup() }
+
+func (s *Sink) WaitRequest() (nodeName string, err error) {
+	nodeName, err = s.sink.WaitRequest()
+
+	s.mu.Lock()
+	s.nodeName = nodeName
+	s.mu.Unlock()
+
+	return
+}
+
+func (s *Sink) Reset() {
+	s.mu.Lock()
+	s.clear()
+	s.mu.Unlock()
+
+	s.sink.Reset()
+}
+
+func (s *Sink) Send(op *localnetv1.OpItem) error {
+	if err := s.record(op); err != nil {
+		return err
+	}
+	return s.sink.Send(op)
+}
+
+func (s *Sink) record(op *localnetv1.OpItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch v := op.Op.(type) {
+	case *localnetv1.OpItem_Reset_:
+		s.clear()
+
+	case *localnetv1.OpItem_Set:
+		ref := v.Set.Ref
+
+		switch ref.Set {
+		case localnetv1.Set_ServicesSet:
+			svc := &localnetv1.Service{}
+			if err := proto.Unmarshal(v.Set.Bytes, svc); err != nil {
+				return err
+			}
+			s.services[ref.Path] = svc
+
+		case localnetv1.Set_EndpointsSet:
+			ep := &localnetv1.Endpoint{}
+			if err := proto.Unmarshal(v.Set.Bytes, ep); err != nil {
+				return err
+			}
+
+			svcPath := ref.ServicePath()
+			eps := s.endpoints[svcPath]
+			if eps == nil {
+				eps = map[string]*localnetv1.Endpoint{}
+				s.endpoints[svcPath] = eps
+			}
+			eps[ref.Path] = ep
+		}
+
+		s.pending = append(s.pending, Change{Op: "set", Set: ref.Set.String(), Path: ref.Path})
+
+	case *localnetv1.OpItem_Delete:
+		ref := v.Delete
+
+		switch ref.Set {
+		case localnetv1.Set_ServicesSet:
+			delete(s.services, ref.Path)
+
+		case localnetv1.Set_EndpointsSet:
+			svcPath := ref.ServicePath()
+			delete(s.endpoints[svcPath], ref.Path)
+
+			if len(s.endpoints[svcPath]) == 0 {
+				delete(s.endpoints, svcPath)
+			}
+		}
+
+		s.pending = append(s.pending, Change{Op: "delete", Set: ref.Set.String(), Path: ref.Path})
+
+	case *localnetv1.OpItem_Sync:
+		s.syncs++
+		s.lastSync = time.Now()
+		s.changes, s.pending = s.pending, nil
+	}
+
+	return nil
+}
+
+// State returns the state received.
+func (s *Sink) State() (state State) {
+	s.mu.Lock()
+
+	state = State{
+		NodeName: s.nodeName,
+		Syncs:    s.syncs,
+		LastSync: s.lastSync,
+		Services: make([]ServiceEndpoints, 0, len(s.services)),
+		Changes:  append([]Change{}, s.changes...),
+		Pending:  append([]Change{}, s.pending...),
+	}
+
+	paths := make([]string, 0, len(s.services))
+	for path := range s.services {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		eps := s.endpoints[path]
+
+		epPaths := make([]string, 0, len(eps))
+		for epPath := range eps {
+			epPaths = append(epPaths, epPath)
+		}
+		sort.Strings(epPaths)
+
+		se := ServiceEndpoints{Service: s.services[path], Endpoints: make([]*localnetv1.Endpoint, 0, len(eps))}
+		for _, epPath := range epPaths {
+			se.Endpoints = append(se.Endpoints, eps[epPath])
+		}
+		state.Services = append(state.Services, se)
+	}
+
+	s.mu.Unlock()
+
+	// the backend has its own locking
+	if s.Objects != nil {
+		state.Objects = s.Objects()
+	}
+	return
+}
+
+func (s *Sink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.State())
+}
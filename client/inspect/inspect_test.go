@@ -0,0 +1,119 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inspect
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+type testSink struct {
+	localsink.Config
+	ops int
+}
+
+func (s *testSink) Setup() {}
+func (s *testSink) Reset() {}
+
+func (s *testSink) Send(op *localnetv1.OpItem) error {
+	s.ops++
+	return nil
+}
+
+func set(set localnetv1.Set, path string, m proto.Message) *localnetv1.OpItem {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Set{Set: &localnetv1.Value{
+		Ref:   &localnetv1.Ref{Set: set, Path: path},
+		Bytes: b,
+	}}}
+}
+
+func del(set localnetv1.Set, path string) *localnetv1.OpItem {
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Delete{Delete: &localnetv1.Ref{Set: set, Path: path}}}
+}
+
+var syncOp = &localnetv1.OpItem{Op: &localnetv1.OpItem_Sync{Sync: &localnetv1.SyncOp{}}}
+
+func TestSink(t *testing.T) {
+	backend := &testSink{}
+	s := NewSink(backend)
+	s.Objects = func() map[string]int { return map[string]int{"rules": 3} }
+
+	s.Send(set(localnetv1.Set_ServicesSet, "ns/b", &localnetv1.Service{Namespace: "ns", Name: "b"}))
+	s.Send(set(localnetv1.Set_ServicesSet, "ns/a", &localnetv1.Service{Namespace: "ns", Name: "a"}))
+	s.Send(set(localnetv1.Set_EndpointsSet, "ns/a/2", &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.1.0.2")}))
+	s.Send(set(localnetv1.Set_EndpointsSet, "ns/a/1", &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.1.0.1")}))
+	s.Send(syncOp)
+
+	s.Send(del(localnetv1.Set_EndpointsSet, "ns/a/2"))
+
+	if backend.ops != 6 {
+		t.Errorf("expected the 6 ops to be passed, got %d", backend.ops)
+	}
+
+	// served as JSON
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", Path, nil))
+
+	state := State{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Syncs != 1 || state.LastSync.IsZero() {
+		t.Errorf("expected 1 sync, got %d at %v", state.Syncs, state.LastSync)
+	}
+
+	services := []string{}
+	for _, se := range state.Services {
+		svc := se.Service.NamespacedName()
+		for _, ep := range se.Endpoints {
+			svc += " " + ep.IPs.V4[0]
+		}
+		services = append(services, svc)
+	}
+	if expected := []string{"ns/a 10.1.0.1", "ns/b"}; !reflect.DeepEqual(services, expected) {
+		t.Errorf("expected services %q, got %q", expected, services)
+	}
+
+	if len(state.Changes) != 4 || state.Changes[0] != (Change{Op: "set", Set: "ServicesSet", Path: "ns/b"}) {
+		t.Errorf("unexpected changes %+v", state.Changes)
+	}
+	if expected := []Change{{Op: "delete", Set: "EndpointsSet", Path: "ns/a/2"}}; !reflect.DeepEqual(state.Pending, expected) {
+		t.Errorf("expected pending changes %+v, got %+v", expected, state.Pending)
+	}
+	if state.Objects["rules"] != 3 {
+		t.Errorf("unexpected objects %v", state.Objects)
+	}
+
+	// reset
+	s.Send(&localnetv1.OpItem{Op: &localnetv1.OpItem_Reset_{Reset_: &localnetv1.EmptyOp{}}})
+	if state := s.State(); len(state.Services) != 0 || len(state.Pending) != 0 {
+		t.Errorf("expected an empty state after a reset, got %+v", state)
+	}
+}
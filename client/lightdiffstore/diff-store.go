@@ -18,7 +18,9 @@ package lightdiffstore
 
 import (
 	"bytes"
+	"encoding/binary"
 
+	"github.com/cespare/xxhash"
 	"github.com/google/btree"
 )
 
@@ -83,9 +85,12 @@ func (s *DiffStore) Set(key []byte, hash uint64, value interface{}) {
 	v.state = ItemChanged
 }
 
-// Delete an entry from the store
+// Delete an entry from the store, if present
 func (s *DiffStore) Delete(key []byte) {
 	item := s.tree.Get(&storeKV{key: key})
+	if item == nil {
+		return
+	}
 	item.(*storeKV).state = ItemDeleted
 }
 
@@ -152,3 +157,30 @@ func (s *DiffStore) GetByPrefix(prefix []byte) (items []KV) {
 
 	return
 }
+
+// Digest returns a digest of the keys and hashes of the entries in the store, whatever their state.
+// After a Reset, it identifies the content known by the peer receiving the diffs.
+func (s *DiffStore) Digest() uint64 {
+	h := xxhash.New()
+	buf := make([]byte, 8)
+
+	s.tree.Ascend(func(i btree.Item) bool {
+		v := i.(*storeKV)
+
+		binary.BigEndian.PutUint64(buf, uint64(len(v.key)))
+		h.Write(buf)
+		h.Write(v.key)
+
+		binary.BigEndian.PutUint64(buf, v.hash)
+		h.Write(buf)
+
+		return true
+	})
+
+	return h.Sum64()
+}
+
+// Len returns the number of entries in the store, whatever their state.
+func (s *DiffStore) Len() int {
+	return s.tree.Len()
+}
@@ -39,6 +39,15 @@ type EndpointsListener interface {
 	DeleteEndpoint(namespace, serviceName, key string)
 }
 
+// NodeListener is implemented by the decoded sinks wanting the node the state is computed for (its topology and
+// labels), to route by topology for instance.
+type NodeListener interface {
+	// SetNode is called when the node is added or updated
+	SetNode(node *localnetv1.Node)
+	// DeleteNode is called when the node is deleted
+	DeleteNode(name string)
+}
+
 type Interface interface {
 	// Sync signals an stream sync event
 	Sync()
@@ -98,6 +107,21 @@ func (s *Sink) Send(op *localnetv1.OpItem) (err error) {
 			parts := strings.Split(set.Ref.Path, "/")
 			s.SetEndpoint(parts[0], parts[1], parts[2], v)
 
+		case localnetv1.Set_NodeSet:
+			l, ok := s.Interface.(NodeListener)
+			if !ok {
+				return
+			}
+
+			v := &localnetv1.Node{}
+
+			err = proto.Unmarshal(set.Bytes, v)
+			if err != nil {
+				return
+			}
+
+			l.SetNode(v)
+
 		default:
 			return
 		}
@@ -113,6 +137,11 @@ func (s *Sink) Send(op *localnetv1.OpItem) (err error) {
 		case localnetv1.Set_EndpointsSet: // Endpoint: namespace/name/key
 			s.DeleteEndpoint(parts[0], parts[1], parts[2])
 
+		case localnetv1.Set_NodeSet: // Node: name
+			if l, ok := s.Interface.(NodeListener); ok {
+				l.DeleteNode(del.Path)
+			}
+
 		default:
 			// unknown set, ignore
 		}
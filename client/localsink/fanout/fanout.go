@@ -0,0 +1,80 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fanout sends the state to multiple sinks, so multiple backends can run in one process.
+package fanout
+
+import (
+	"fmt"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+type Sink struct {
+	sinks []localsink.Sink
+}
+
+var _ localsink.Sink = &Sink{}
+
+func New(sinks ...localsink.Sink) *Sink {
+	return &Sink{sinks: sinks}
+}
+
+func (s *Sink) Setup() {
+	for _, sink := range s.sinks {
+		sink.Setup()
+	}
+}
+
+// WaitRequest waits for all the sinks, that must request the same node (or not specify it).
+func (s *Sink) WaitRequest() (nodeName string, err error) {
+	for _, sink := range s.sinks {
+		var name string
+		name, err = sink.WaitRequest()
+		if err != nil {
+			return
+		}
+
+		if name == "" {
+			continue
+		}
+
+		if nodeName == "" {
+			nodeName = name
+		} else if name != nodeName {
+			err = fmt.Errorf("sinks requested different nodes (%q and %q)", nodeName, name)
+			return
+		}
+	}
+	return
+}
+
+func (s *Sink) Reset() {
+	for _, sink := range s.sinks {
+		sink.Reset()
+	}
+}
+
+// Send sends the op to each sink, stopping at the first error.
+func (s *Sink) Send(op *localnetv1.OpItem) (err error) {
+	for _, sink := range s.sinks {
+		if err = sink.Send(op); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -39,6 +39,9 @@ type Sink struct {
 	SetupFunc Setup
 
 	data *btree.BTree
+
+	// node is the node the state is computed for (nil if not known)
+	node *localnetv1.Node
 }
 
 func New(config *localsink.Config) *Sink {
@@ -79,6 +82,13 @@ func (s *Sink) WaitRequest() (nodeName string, err error) {
 
 func (s *Sink) Reset() {
 	s.data.Clear(false)
+	s.node = nil
+}
+
+// Node returns the node the state is computed for, with its topology and labels (nil if not known). It's meant to
+// be called from the Callback.
+func (s *Sink) Node() *localnetv1.Node {
+	return s.node
 }
 
 func (s *Sink) Send(op *localnetv1.OpItem) (err error) {
@@ -86,6 +96,15 @@ func (s *Sink) Send(op *localnetv1.OpItem) (err error) {
 	case *localnetv1.OpItem_Set:
 		set := op.GetSet()
 
+		if set.Ref.Set == localnetv1.Set_NodeSet {
+			node := &localnetv1.Node{}
+			if err = proto.Unmarshal(set.Bytes, node); err != nil {
+				return
+			}
+			s.node = node
+			return
+		}
+
 		var v proto.Message
 		switch set.Ref.Set {
 		case localnetv1.Set_ServicesSet:
@@ -105,6 +124,11 @@ func (s *Sink) Send(op *localnetv1.OpItem) (err error) {
 		s.data.ReplaceOrInsert(kv{set.Ref.Path, v})
 
 	case *localnetv1.OpItem_Delete:
+		if op.GetDelete().Set == localnetv1.Set_NodeSet {
+			s.node = nil
+			return
+		}
+
 		s.data.Delete(kv{Path: op.GetDelete().Path})
 
 	case *localnetv1.OpItem_Sync:
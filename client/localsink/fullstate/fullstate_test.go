@@ -24,7 +24,7 @@ import (
 	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
 )
 
-var syncOp = &localnetv1.OpItem{Op: &localnetv1.OpItem_Sync{Sync: &localnetv1.EmptyOp{}}}
+var syncOp = &localnetv1.OpItem{Op: &localnetv1.OpItem_Sync{Sync: &localnetv1.SyncOp{}}}
 
 func TestAddRemoveService(t *testing.T) {
 	var latestSeps []*ServiceEndpoints
@@ -72,3 +72,28 @@ func TestAddRemoveService(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestNode(t *testing.T) {
+	sink := New(nil)
+	sink.Callback = ArrayCallback(func([]*ServiceEndpoints) {})
+
+	nodeRef := &localnetv1.Ref{Set: localnetv1.Set_NodeSet, Path: "node-a"}
+	nodeBytes, _ := proto.Marshal(&localnetv1.Node{
+		Name:     "node-a",
+		Topology: &localnetv1.TopologyInfo{Node: "node-a", Zone: "z1"},
+	})
+
+	sink.Send(&localnetv1.OpItem{Op: &localnetv1.OpItem_Set{Set: &localnetv1.Value{Ref: nodeRef, Bytes: nodeBytes}}})
+	sink.Send(syncOp)
+
+	if zone := sink.Node().GetTopology().GetZone(); zone != "z1" {
+		t.Errorf("expected the node in zone z1, got %q", zone)
+	}
+
+	sink.Send(&localnetv1.OpItem{Op: &localnetv1.OpItem_Delete{Delete: nodeRef}})
+	sink.Send(syncOp)
+
+	if node := sink.Node(); node != nil {
+		t.Errorf("expected no node, got %v", node)
+	}
+}
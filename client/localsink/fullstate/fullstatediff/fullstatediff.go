@@ -0,0 +1,177 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fullstatediff turns the full states of a fullstate.Sink into the add/update/delete events of each
+// service and endpoint, so the backends applying changes can be written against diffs without comparing the
+// states themselves.
+//
+//	sink := fullstate.New(&localsink.Config{})
+//	sink.Callback = fullstatediff.New(listener).Callback
+package fullstatediff
+
+import (
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/diffstore"
+	"sigs.k8s.io/kpng/client/localsink/fullstate"
+)
+
+// Listener receives the changes from one full state to the next.
+//
+// The events are ordered for the changes to be applied as they come: the services are added or updated before
+// their endpoints, and deleted after them. The services are in namespace/name order, and the endpoints of a service
+// in key order.
+type Listener interface {
+	AddService(service *localnetv1.Service)
+	UpdateService(service *localnetv1.Service)
+	DeleteService(namespace, name string)
+
+	AddEndpoint(service *localnetv1.Service, key string, endpoint *localnetv1.Endpoint)
+	UpdateEndpoint(service *localnetv1.Service, key string, endpoint *localnetv1.Endpoint)
+	DeleteEndpoint(namespace, serviceName, key string)
+
+	// Sync is called once the changes of a full state are sent, even if there were none.
+	Sync()
+}
+
+type (
+	serviceStore  = diffstore.Store[string, *diffstore.HashLeaf[*localnetv1.Service]]
+	endpointStore = diffstore.Store[string, *diffstore.HashLeaf[*localnetv1.Endpoint]]
+	endpointItem  = diffstore.Item[string, *diffstore.HashLeaf[*localnetv1.Endpoint]]
+)
+
+// Adapter compares each full state to the previous one.
+type Adapter struct {
+	listener Listener
+
+	services  *serviceStore
+	endpoints *endpointStore
+}
+
+// New returns an adapter sending the changes to the listener.
+func New(listener Listener) *Adapter {
+	return &Adapter{
+		listener:  listener,
+		services:  diffstore.NewProtoStore[string, *localnetv1.Service](),
+		endpoints: diffstore.NewProtoStore[string, *localnetv1.Endpoint](),
+	}
+}
+
+var _ fullstate.Callback = (&Adapter{}).Callback
+
+// Reset forgets the previous state, so the next one is sent as additions. It's meant to be called from the sink's
+// Reset if the listener's state is lost with it.
+func (a *Adapter) Reset() {
+	a.services = diffstore.NewProtoStore[string, *localnetv1.Service]()
+	a.endpoints = diffstore.NewProtoStore[string, *localnetv1.Endpoint]()
+}
+
+// Callback is the fullstate.Callback of the adapter.
+func (a *Adapter) Callback(ch <-chan *fullstate.ServiceEndpoints) {
+	for seps := range ch {
+		svcKey := seps.Service.Namespace + "/" + seps.Service.Name
+		a.services.Get(svcKey).Set(seps.Service)
+
+		seen := make(map[string]int, len(seps.Endpoints))
+		for _, ep := range seps.Endpoints {
+			key := EndpointKey(ep)
+			if n := seen[key]; n != 0 {
+				// same IPs, different port overrides
+				seen[key] = n + 1
+				key += "#" + strconv.Itoa(n+1)
+			} else {
+				seen[key] = 1
+			}
+
+			a.endpoints.Get(svcKey + "/" + key).Set(ep)
+		}
+	}
+
+	a.services.Done()
+	a.endpoints.Done()
+
+	// the endpoints' changes by service, to send them with it
+	changedEndpoints := map[string][]*endpointItem{}
+	for _, item := range a.endpoints.Changed() {
+		svcKey, _ := splitEndpointKey(item.Key())
+		changedEndpoints[svcKey] = append(changedEndpoints[svcKey], item)
+	}
+
+	deletedEndpoints := map[string][]string{}
+	for _, item := range a.endpoints.Deleted() {
+		svcKey, key := splitEndpointKey(item.Key())
+		deletedEndpoints[svcKey] = append(deletedEndpoints[svcKey], key)
+	}
+
+	// added and updated services, with their endpoints' changes
+	for _, item := range a.services.List() {
+		svcKey, svc := item.Key(), item.Value().Get()
+
+		switch {
+		case item.Created():
+			a.listener.AddService(svc)
+		case item.Updated():
+			a.listener.UpdateService(svc)
+		}
+
+		for _, key := range deletedEndpoints[svcKey] {
+			a.listener.DeleteEndpoint(svc.Namespace, svc.Name, key)
+		}
+
+		for _, epItem := range changedEndpoints[svcKey] {
+			_, key := splitEndpointKey(epItem.Key())
+
+			if epItem.Created() {
+				a.listener.AddEndpoint(svc, key, epItem.Value().Get())
+			} else {
+				a.listener.UpdateEndpoint(svc, key, epItem.Value().Get())
+			}
+		}
+	}
+
+	// deleted services, after their endpoints
+	for _, item := range a.services.Deleted() {
+		svcKey := item.Key()
+		namespace, name, _ := strings.Cut(svcKey, "/")
+
+		for _, key := range deletedEndpoints[svcKey] {
+			a.listener.DeleteEndpoint(namespace, name, key)
+		}
+
+		a.listener.DeleteService(namespace, name)
+	}
+
+	a.listener.Sync()
+
+	a.services.Reset()
+	a.endpoints.Reset()
+}
+
+// EndpointKey returns the key identifying an endpoint in its service: its IPs, or its hostname if it has none.
+func EndpointKey(ep *localnetv1.Endpoint) string {
+	if ips := ep.IPs.All(); len(ips) != 0 {
+		return strings.Join(ips, ",")
+	}
+	return ep.Hostname
+}
+
+func splitEndpointKey(k string) (svcKey, key string) {
+	// namespace/name/key, the key has no '/' (IPs or a hostname)
+	idx := strings.LastIndexByte(k, '/')
+	return k[:idx], k[idx+1:]
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fullstatediff
+
+import (
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink/fullstate"
+)
+
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) AddService(svc *localnetv1.Service) {
+	r.events = append(r.events, "add-svc:"+svc.Namespace+"/"+svc.Name)
+}
+func (r *recorder) UpdateService(svc *localnetv1.Service) {
+	r.events = append(r.events, "update-svc:"+svc.Namespace+"/"+svc.Name)
+}
+func (r *recorder) DeleteService(namespace, name string) {
+	r.events = append(r.events, "del-svc:"+namespace+"/"+name)
+}
+func (r *recorder) AddEndpoint(svc *localnetv1.Service, key string, _ *localnetv1.Endpoint) {
+	r.events = append(r.events, "add-ep:"+svc.Name+"/"+key)
+}
+func (r *recorder) UpdateEndpoint(svc *localnetv1.Service, key string, _ *localnetv1.Endpoint) {
+	r.events = append(r.events, "update-ep:"+svc.Name+"/"+key)
+}
+func (r *recorder) DeleteEndpoint(_, serviceName, key string) {
+	r.events = append(r.events, "del-ep:"+serviceName+"/"+key)
+}
+func (r *recorder) Sync() {
+	r.events = append(r.events, "sync")
+}
+
+func service(name string, port int32, ips ...string) *fullstate.ServiceEndpoints {
+	seps := &fullstate.ServiceEndpoints{Service: &localnetv1.Service{
+		Namespace: "ns",
+		Name:      name,
+		Ports:     []*localnetv1.PortMapping{{Port: port}},
+	}}
+	for _, ip := range ips {
+		ep := &localnetv1.Endpoint{}
+		ep.AddAddress(ip)
+		seps.Endpoints = append(seps.Endpoints, ep)
+	}
+	return seps
+}
+
+func TestAdapter(t *testing.T) {
+	r := &recorder{}
+	a := New(r)
+
+	apply := func(state ...*fullstate.ServiceEndpoints) string {
+		ch := make(chan *fullstate.ServiceEndpoints, len(state))
+		for _, seps := range state {
+			ch <- seps
+		}
+		close(ch)
+
+		r.events = nil
+		a.Callback(ch)
+		return strings.Join(r.events, " ")
+	}
+
+	for _, tc := range []struct {
+		state    []*fullstate.ServiceEndpoints
+		expected string
+	}{
+		{
+			state: []*fullstate.ServiceEndpoints{
+				service("a", 80, "10.0.0.2", "10.0.0.1"),
+				service("b", 80, "10.0.1.1"),
+			},
+			expected: "add-svc:ns/a add-ep:a/10.0.0.1 add-ep:a/10.0.0.2 add-svc:ns/b add-ep:b/10.0.1.1 sync",
+		},
+		{
+			// unchanged
+			state: []*fullstate.ServiceEndpoints{
+				service("a", 80, "10.0.0.1", "10.0.0.2"),
+				service("b", 80, "10.0.1.1"),
+			},
+			expected: "sync",
+		},
+		{
+			state: []*fullstate.ServiceEndpoints{
+				service("a", 8080, "10.0.0.1", "10.0.0.3"),
+			},
+			expected: "update-svc:ns/a del-ep:a/10.0.0.2 add-ep:a/10.0.0.3 del-ep:b/10.0.1.1 del-svc:ns/b sync",
+		},
+	} {
+		if events := apply(tc.state...); events != tc.expected {
+			t.Errorf("expected %q, got %q", tc.expected, events)
+		}
+	}
+
+	a.Reset()
+	if events := apply(service("a", 8080, "10.0.0.1")); events != "add-svc:ns/a add-ep:a/10.0.0.1 sync" {
+		t.Errorf("expected additions after a reset, got %q", events)
+	}
+}
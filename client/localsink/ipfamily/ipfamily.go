@@ -0,0 +1,123 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ipfamily restricts the state sent to a sink to some IP families, so single-stack backends can be combined.
+package ipfamily
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+	"sigs.k8s.io/kpng/client/localsink/servicetypes"
+)
+
+const (
+	IPv4 = "IPv4"
+	IPv6 = "IPv6"
+)
+
+// Sink strips the IPs of the other families from the services and endpoints, and filters out the services left
+// without cluster IP (and their endpoints).
+type Sink struct {
+	*servicetypes.Sink
+
+	v4, v6 bool
+}
+
+var _ localsink.Sink = &Sink{}
+
+// New returns a sink passing only the given families (IPv4, IPv6) to the wrapped sink.
+func New(families []string, sink localsink.Sink) (*Sink, error) {
+	s := &Sink{}
+
+	for _, family := range families {
+		switch {
+		case strings.EqualFold(family, IPv4):
+			s.v4 = true
+		case strings.EqualFold(family, IPv6):
+			s.v6 = true
+		default:
+			return nil, fmt.Errorf("unknown IP family %q (expected %s or %s)", family, IPv4, IPv6)
+		}
+	}
+
+	s.Sink = servicetypes.NewFilter(func(service *localnetv1.Service) bool {
+		return service.IPs != nil && !service.IPs.ClusterIPs.IsEmpty()
+	}, sink)
+
+	return s, nil
+}
+
+func (s *Sink) Send(op *localnetv1.OpItem) (err error) {
+	set := op.GetSet()
+	if set == nil {
+		return s.Sink.Send(op)
+	}
+
+	var value proto.Message
+
+	switch set.Ref.Set {
+	case localnetv1.Set_ServicesSet:
+		svc := &localnetv1.Service{}
+		if err = proto.Unmarshal(set.Bytes, svc); err != nil {
+			return
+		}
+		if ips := svc.IPs; ips != nil {
+			s.filter(ips.ClusterIPs)
+			s.filter(ips.ExternalIPs)
+			s.filter(ips.LoadBalancerIPs)
+		}
+		value = svc
+
+	case localnetv1.Set_EndpointsSet:
+		ep := &localnetv1.Endpoint{}
+		if err = proto.Unmarshal(set.Bytes, ep); err != nil {
+			return
+		}
+		s.filter(ep.IPs)
+		value = ep
+
+	default:
+		return s.Sink.Send(op)
+	}
+
+	bytes, err := proto.Marshal(value)
+	if err != nil {
+		return
+	}
+
+	return s.Sink.Send(&localnetv1.OpItem{
+		Op: &localnetv1.OpItem_Set{
+			Set: &localnetv1.Value{Ref: set.Ref, Bytes: bytes},
+		},
+	})
+}
+
+func (s *Sink) filter(set *localnetv1.IPSet) {
+	if set == nil {
+		return
+	}
+	if !s.v4 {
+		set.V4 = nil
+	}
+	if !s.v6 {
+		set.V6 = nil
+	}
+}
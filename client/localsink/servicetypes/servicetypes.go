@@ -0,0 +1,236 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servicetypes
+
+import (
+	"strings"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/protobuf/proto"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+// Config holds the service types an agent is responsible for.
+type Config struct {
+	Types []string
+}
+
+func (c *Config) BindFlags(flags *pflag.FlagSet) {
+	flags.StringSliceVar(&c.Types, "service-types", nil, "only handle services of these types (ClusterIP, NodePort, LoadBalancer); all types if empty")
+}
+
+// Enabled returns true iff the config filters some service types.
+func (c *Config) Enabled() bool {
+	return c != nil && len(c.Types) != 0
+}
+
+// Accept returns true if services of the given type should be handled.
+func (c *Config) Accept(serviceType string) bool {
+	return Accept(c.Types, serviceType)
+}
+
+// Accept returns true if the serviceType is in types (case insensitive) or if types is empty.
+func Accept(types []string, serviceType string) bool {
+	if len(types) == 0 {
+		return true
+	}
+
+	for _, t := range types {
+		if strings.EqualFold(t, serviceType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sink filters out services (and their endpoints) not accepted by the config, or a more general filter, before passing
+// ops to the wrapped sink.
+//
+// Endpoints of filtered services are retained so they can be replayed if the service later becomes accepted (ie: its type changed).
+type Sink struct {
+	sink   localsink.Sink
+	accept func(service *localnetv1.Service) bool
+
+	// OnFiltered is called when a service is filtered out.
+	OnFiltered func(service *localnetv1.Service)
+
+	// services that are currently filtered out
+	filtered map[string]bool
+	// services sent to the wrapped sink
+	sent map[string]bool
+	// endpoints ops by service path
+	endpoints map[string]map[string]*localnetv1.OpItem
+}
+
+var _ localsink.Sink = &Sink{}
+
+func New(config *Config, sink localsink.Sink) *Sink {
+	return NewFilter(func(service *localnetv1.Service) bool {
+		return config.Accept(service.Type)
+	}, sink)
+}
+
+// NewFilter returns a sink passing only the services accepted by the given function (and their endpoints).
+func NewFilter(accept func(service *localnetv1.Service) bool, sink localsink.Sink) *Sink {
+	s := &Sink{
+		sink:   sink,
+		accept: accept,
+	}
+	s.clear()
+	return s
+}
+
+func (s *Sink) clear() {
+	s.filtered = map[string]bool{}
+	s.sent = map[string]bool{}
+	s.endpoints = map[string]map[string]*localnetv1.OpItem{}
+}
+
+// Filtered returns the number of services currently filtered out.
+func (s *Sink) Filtered() int {
+	return len(s.filtered)
+}
+
+func (s *Sink) Setup() { s.sink.Setup() }
+
+func (s *Sink) WaitRequest() (nodeName string, err error) {
+	return s.sink.WaitRequest()
+}
+
+func (s *Sink) Reset() {
+	s.clear()
+	s.sink.Reset()
+}
+
+func (s *Sink) Send(op *localnetv1.OpItem) (err error) {
+	switch v := op.Op; v.(type) {
+	case *localnetv1.OpItem_Set:
+		set := op.GetSet()
+
+		switch set.Ref.Set {
+		case localnetv1.Set_ServicesSet:
+			return s.setService(op, set)
+
+		case localnetv1.Set_EndpointsSet:
+			svcPath := set.Ref.ServicePath()
+
+			eps := s.endpoints[svcPath]
+			if eps == nil {
+				eps = map[string]*localnetv1.OpItem{}
+				s.endpoints[svcPath] = eps
+			}
+			eps[set.Ref.Path] = op
+
+			if s.filtered[svcPath] {
+				return
+			}
+		}
+
+	case *localnetv1.OpItem_Delete:
+		del := op.GetDelete()
+
+		switch del.Set {
+		case localnetv1.Set_ServicesSet:
+			filtered := s.filtered[del.Path]
+			delete(s.filtered, del.Path)
+			delete(s.sent, del.Path)
+
+			if filtered {
+				return
+			}
+
+		case localnetv1.Set_EndpointsSet:
+			svcPath := del.ServicePath()
+			delete(s.endpoints[svcPath], del.Path)
+
+			if len(s.endpoints[svcPath]) == 0 {
+				delete(s.endpoints, svcPath)
+			}
+
+			if s.filtered[svcPath] {
+				return
+			}
+		}
+	}
+
+	return s.sink.Send(op)
+}
+
+func (s *Sink) setService(op *localnetv1.OpItem, set *localnetv1.Value) (err error) {
+	svc := &localnetv1.Service{}
+	if err = proto.Unmarshal(set.Bytes, svc); err != nil {
+		return
+	}
+
+	path := set.Ref.Path
+
+	if !s.accept(svc) {
+		if s.OnFiltered != nil {
+			s.OnFiltered(svc)
+		}
+
+		if s.filtered[path] {
+			return
+		}
+
+		s.filtered[path] = true
+
+		if !s.sent[path] {
+			return
+		}
+
+		// type changed to a filtered one: remove what was sent
+		delete(s.sent, path)
+
+		for epPath := range s.endpoints[path] {
+			if err = s.sink.Send(deleteOp(localnetv1.Set_EndpointsSet, epPath)); err != nil {
+				return
+			}
+		}
+
+		return s.sink.Send(deleteOp(localnetv1.Set_ServicesSet, path))
+	}
+
+	wasFiltered := s.filtered[path]
+	delete(s.filtered, path)
+	s.sent[path] = true
+
+	if err = s.sink.Send(op); err != nil {
+		return
+	}
+
+	if wasFiltered {
+		// replay the retained endpoints
+		for _, epOp := range s.endpoints[path] {
+			if err = s.sink.Send(epOp); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func deleteOp(set localnetv1.Set, path string) *localnetv1.OpItem {
+	return &localnetv1.OpItem{
+		Op: &localnetv1.OpItem_Delete{
+			Delete: &localnetv1.Ref{Set: set, Path: path},
+		},
+	}
+}
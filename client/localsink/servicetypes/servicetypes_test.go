@@ -0,0 +1,104 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servicetypes
+
+import (
+	"fmt"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+)
+
+type recordSink struct {
+	ops []string
+}
+
+func (s *recordSink) Setup()                       {}
+func (s *recordSink) WaitRequest() (string, error) { return "", nil }
+func (s *recordSink) Reset()                       { s.ops = nil }
+func (s *recordSink) Send(op *localnetv1.OpItem) (err error) {
+	switch v := op.Op.(type) {
+	case *localnetv1.OpItem_Set:
+		s.ops = append(s.ops, fmt.Sprintf("set %s %s", v.Set.Ref.Set, v.Set.Ref.Path))
+	case *localnetv1.OpItem_Delete:
+		s.ops = append(s.ops, fmt.Sprintf("del %s %s", v.Delete.Set, v.Delete.Path))
+	}
+	return
+}
+
+func setService(path, serviceType string) *localnetv1.OpItem {
+	b, _ := proto.Marshal(&localnetv1.Service{Type: serviceType})
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Set{Set: &localnetv1.Value{
+		Ref:   &localnetv1.Ref{Set: localnetv1.Set_ServicesSet, Path: path},
+		Bytes: b,
+	}}}
+}
+
+func setEndpoint(path string) *localnetv1.OpItem {
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Set{Set: &localnetv1.Value{
+		Ref: &localnetv1.Ref{Set: localnetv1.Set_EndpointsSet, Path: path},
+	}}}
+}
+
+func TestAccept(t *testing.T) {
+	if !Accept(nil, "NodePort") {
+		t.Error("empty types should accept all")
+	}
+	if !Accept([]string{"clusterip"}, "ClusterIP") {
+		t.Error("types should be case insensitive")
+	}
+	if Accept([]string{"ClusterIP"}, "NodePort") {
+		t.Error("NodePort should be filtered")
+	}
+}
+
+func TestTypeChange(t *testing.T) {
+	rec := &recordSink{}
+	filtered := 0
+
+	sink := New(&Config{Types: []string{"ClusterIP"}}, rec)
+	sink.OnFiltered = func(_ *localnetv1.Service) { filtered++ }
+
+	sink.Send(setService("test/a", "NodePort"))
+	sink.Send(setEndpoint("test/a/ep1"))
+
+	if len(rec.ops) != 0 || filtered != 1 || sink.Filtered() != 1 {
+		t.Fatalf("filtered service leaked: %v (filtered %d)", rec.ops, filtered)
+	}
+
+	// becomes accepted: the service and its retained endpoints are sent
+	sink.Send(setService("test/a", "ClusterIP"))
+
+	expected := "[set ServicesSet test/a set EndpointsSet test/a/ep1]"
+	if s := fmt.Sprint(rec.ops); s != expected {
+		t.Fatalf("expected %s, got %s", expected, s)
+	}
+	if sink.Filtered() != 0 {
+		t.Fatalf("expected no filtered service, got %d", sink.Filtered())
+	}
+
+	// becomes filtered again: the endpoints then the service are deleted
+	rec.ops = nil
+	sink.Send(setService("test/a", "LoadBalancer"))
+
+	expected = "[del EndpointsSet test/a/ep1 del ServicesSet test/a]"
+	if s := fmt.Sprint(rec.ops); s != expected {
+		t.Fatalf("expected %s, got %s", expected, s)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build !linux
+// +build !linux
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conntrack
+
+import (
+	"k8s.io/klog/v2"
+)
+
+// conntrack entries only exist on linux, there's nothing to clean up elsewhere.
+
+func setupConntrack() {
+	klog.Warning("conntrack cleanup is only supported on linux")
+}
+
+func cleanupIPPortEntries(ipp IPPort) {}
+
+func cleanupFlowEntries(flow Flow) {}
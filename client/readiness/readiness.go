@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package readiness signals when a backend's dataplane is ready, so node bootstrap orchestration (ie: kubelet
+// static pods ordering, systemd units) can wait for it before scheduling workloads.
+//
+// The signal is emitted once, after the first complete change set was applied. Backends able to tell when their
+// rules are actually applied implement backendcmd.StrictReadiness; the others are ready once they synced their
+// first change set without error.
+package readiness
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+type Config struct {
+	// File is created when ready (none if empty).
+	File string
+	// Notify sends READY=1 to systemd (see sd_notify(3)) when ready.
+	Notify bool
+}
+
+func (c *Config) BindFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.File, "ready-file", "", "file created once the first change set is applied to the dataplane")
+	flags.BoolVar(&c.Notify, "ready-notify", false, "notify systemd (READY=1) once the first change set is applied to the dataplane")
+}
+
+// Gate emits the readiness signals once.
+type Gate struct {
+	Config *Config
+
+	once sync.Once
+}
+
+func NewGate(config *Config) *Gate {
+	return &Gate{Config: config}
+}
+
+// Ready emits the readiness signals, if not done yet.
+func (g *Gate) Ready() {
+	g.once.Do(func() {
+		klog.Info("dataplane ready")
+
+		if g.Config.File != "" {
+			if err := writeFile(g.Config.File); err != nil {
+				klog.Error("failed to write the ready file: ", err)
+			}
+		}
+
+		if g.Config.Notify {
+			if err := notify("READY=1"); err != nil {
+				klog.Error("failed to notify systemd: ", err)
+			}
+		}
+	})
+}
+
+// writeFile atomically writes the ready file, with the time the dataplane got ready.
+func writeFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.WriteString(time.Now().UTC().Format(time.RFC3339) + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// notify sends the state to systemd, if the process is run by it.
+func notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		klog.Warning("NOTIFY_SOCKET is not set, not notifying systemd")
+		return nil
+	}
+
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:] // abstract namespace
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// Sink wraps a sink to signal the gate once a change set is synced without error.
+func Sink(sink localsink.Sink, gate *Gate) localsink.Sink {
+	return &readySink{Sink: sink, gate: gate}
+}
+
+type readySink struct {
+	localsink.Sink
+	gate *Gate
+}
+
+func (s *readySink) Send(op *localnetv1.OpItem) error {
+	if err := s.Sink.Send(op); err != nil {
+		return err
+	}
+
+	if _, isSync := op.Op.(*localnetv1.OpItem_Sync); isSync {
+		s.gate.Ready()
+	}
+	return nil
+}
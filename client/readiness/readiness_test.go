@@ -0,0 +1,91 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+type testSink struct {
+	localsink.Config
+	err error
+}
+
+func (s *testSink) Setup()                           {}
+func (s *testSink) Reset()                           {}
+func (s *testSink) Send(op *localnetv1.OpItem) error { return s.err }
+
+func TestReadySignals(t *testing.T) {
+	dir := t.TempDir()
+
+	// fake systemd
+	socketPath := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", socketPath)
+
+	readyFile := filepath.Join(dir, "ready")
+
+	backend := &testSink{err: errors.New("failed")}
+	sink := Sink(backend, NewGate(&Config{File: readyFile, Notify: true}))
+
+	setOp := &localnetv1.OpItem{Op: &localnetv1.OpItem_Set{Set: &localnetv1.Value{}}}
+	syncOp := &localnetv1.OpItem{Op: &localnetv1.OpItem_Sync{Sync: &localnetv1.SyncOp{}}}
+
+	// failed sync: not ready
+	sink.Send(setOp)
+	sink.Send(syncOp)
+
+	if _, err := os.Stat(readyFile); !os.IsNotExist(err) {
+		t.Fatal("ready file should not exist after a failed sync")
+	}
+
+	// successful sync: ready
+	backend.err = nil
+	sink.Send(setOp)
+	if _, err := os.Stat(readyFile); !os.IsNotExist(err) {
+		t.Fatal("ready file should not exist before the sync")
+	}
+
+	sink.Send(syncOp)
+
+	if _, err := os.Stat(readyFile); err != nil {
+		t.Fatal("ready file should exist: ", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal("no notification: ", err)
+	}
+	if state := string(buf[:n]); state != "READY=1" {
+		t.Errorf("expected READY=1, got %q", state)
+	}
+}
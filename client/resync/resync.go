@@ -0,0 +1,95 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package resync serves an endpoint forcing a full resync of a node agent's backend, ie: after the rules were
+// flushed by hand or by a restart of the node's firewall. The backend coalesces the repeated requests with its
+// BoundedFrequencyRunner, so they can't make it sync more often than --min-sync-period allows.
+package resync
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Path is the path of the resync endpoint on the agent's metrics server.
+const Path = "/resync"
+
+// Status is the response to a resync request.
+type Status struct {
+	// Requests is the number of resyncs requested since the agent started.
+	Requests int `json:"requests"`
+	// LastRequest is the time of the last resync requested.
+	LastRequest time.Time `json:"lastRequest,omitempty"`
+}
+
+// Handler triggers a resync on POST requests, and serves the resyncs requested on GET requests.
+type Handler struct {
+	resync func()
+
+	mu     sync.Mutex
+	status Status
+}
+
+var _ http.Handler = &Handler{}
+
+// NewHandler returns a handler calling resync (see backendcmd.Resyncer).
+func NewHandler(resync func()) *Handler {
+	return &Handler{resync: resync}
+}
+
+// Trigger requests a resync, returning the resyncs requested so far.
+func (h *Handler) Trigger() Status {
+	h.mu.Lock()
+	h.status.Requests++
+	h.status.LastRequest = time.Now()
+	status := h.status
+	h.mu.Unlock()
+
+	klog.Info("resync requested")
+	h.resync()
+
+	return status
+}
+
+// Status returns the resyncs requested so far.
+func (h *Handler) Status() Status {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.status
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var status Status
+
+	switch r.Method {
+	case http.MethodGet:
+		status = h.Status()
+	case http.MethodPost:
+		status = h.Trigger()
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
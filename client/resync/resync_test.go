@@ -0,0 +1,56 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resync
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	resyncs := 0
+	h := NewHandler(func() { resyncs++ })
+
+	serve := func(method string) (code int, status Status) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, Path, nil))
+
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, status
+	}
+
+	if code, status := serve(http.MethodGet); code != http.StatusOK || status.Requests != 0 || resyncs != 0 {
+		t.Errorf("a GET should not trigger a resync, got %d %+v (%d resyncs)", code, status, resyncs)
+	}
+
+	for i := 1; i <= 2; i++ {
+		code, status := serve(http.MethodPost)
+		if code != http.StatusOK || status.Requests != i || status.LastRequest.IsZero() || resyncs != i {
+			t.Errorf("POST %d: expected a resync, got %d %+v (%d resyncs)", i, code, status, resyncs)
+		}
+	}
+
+	if code, _ := serve(http.MethodDelete); code != http.StatusMethodNotAllowed || resyncs != 2 {
+		t.Errorf("a DELETE should be rejected, got %d (%d resyncs)", code, resyncs)
+	}
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package serviceevents
 
 import (
+	"sort"
+
 	"sigs.k8s.io/kpng/api/localnetv1"
 )
 
@@ -40,11 +42,24 @@ type TrafficPolicyListener interface {
 	DisableTrafficPolicy(svc *localnetv1.Service, policyKind TrafficPolicyKind)
 }
 
+// SessionAffinityListener receives the changes of the ClientIP session affinity of the services.
 type SessionAffinityListener interface {
+	// EnableSessionAffinity is called when the affinity is enabled, or its timeout changed
 	EnableSessionAffinity(svc *localnetv1.Service, sessionAffinity SessionAffinity)
+	// DisableSessionAffinity is called when the affinity is disabled (svc is the previous service)
 	DisableSessionAffinity(svc *localnetv1.Service)
 }
 
+// AnnotationsListener receives the changes of the service annotations, to implement vendor annotations (ie: DSR,
+// rate limits) in a backend without changing the brain. The brain only sends the annotations allowed by its
+// --with-service-annotations flag.
+type AnnotationsListener interface {
+	// SetAnnotation is called when an annotation is added or its value changed
+	SetAnnotation(svc *localnetv1.Service, key, value string)
+	// DeleteAnnotation is called when an annotation is removed (svc is the previous service)
+	DeleteAnnotation(svc *localnetv1.Service, key string)
+}
+
 // ServicesListener analyzes updates to the Service set and produced detailed
 // events about the changes.
 //
@@ -57,6 +72,8 @@ type SessionAffinityListener interface {
 // - AddIP
 // - AddIPPort
 // - DeleteIPPort
+// - SetAnnotation
+// - DeleteAnnotation
 // - DeleteIP
 type ServicesListener struct {
 	PortsListener           PortsListener
@@ -64,6 +81,7 @@ type ServicesListener struct {
 	IPPortsListener         IPPortsListener
 	TrafficPolicyListener   TrafficPolicyListener
 	SessionAffinityListener SessionAffinityListener
+	AnnotationsListener     AnnotationsListener
 
 	services map[string]*localnetv1.Service
 }
@@ -234,7 +252,8 @@ func (sl *ServicesListener) diff(prevSvc, currSvc *localnetv1.Service) {
 		if currSvc != nil {
 			currSessAff = GetSessionAffinity(currSvc.SessionAffinity)
 		}
-		if prevSessAff.ClientIP == nil && currSessAff.ClientIP != nil {
+		if currSessAff.ClientIP != nil && (prevSessAff.ClientIP == nil ||
+			prevSessAff.ClientIP.ClientIP.GetTimeoutSeconds() != currSessAff.ClientIP.ClientIP.GetTimeoutSeconds()) {
 			sl.SessionAffinityListener.EnableSessionAffinity(currSvc, currSessAff)
 		}
 
@@ -243,11 +262,41 @@ func (sl *ServicesListener) diff(prevSvc, currSvc *localnetv1.Service) {
 		}
 	}
 
+	if sl.AnnotationsListener != nil {
+		sl.diffAnnotations(prevSvc, currSvc)
+	}
+
 	for _, deferredCall := range deferredCalls {
 		deferredCall()
 	}
 }
 
+// diffAnnotations calls the AnnotationsListener for the annotations changed, in the keys' order.
+func (sl *ServicesListener) diffAnnotations(prevSvc, currSvc *localnetv1.Service) {
+	prev, curr := prevSvc.GetAnnotations(), currSvc.GetAnnotations()
+
+	for _, key := range sortedKeys(curr) {
+		if value, ok := prev[key]; !ok || value != curr[key] {
+			sl.AnnotationsListener.SetAnnotation(currSvc, key, curr[key])
+		}
+	}
+
+	for _, key := range sortedKeys(prev) {
+		if _, ok := curr[key]; !ok {
+			sl.AnnotationsListener.DeleteAnnotation(prevSvc, key)
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func samePort(p1, p2 *localnetv1.PortMapping) bool {
 	return p1.Name == p2.Name &&
 		p1.Protocol == p2.Protocol &&
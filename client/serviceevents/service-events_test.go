@@ -326,3 +326,89 @@ func Example() {
 	//     ip: 10.1.1.1 (ClusterIP)
 
 }
+
+type annotationsLsnr struct{}
+
+func (_ annotationsLsnr) SetAnnotation(svc *localnetv1.Service, key, value string) {
+	fmt.Print("SET svc: ", svc.Namespace, "/", svc.Name, " annotation: ", key, "=", value, "\n")
+}
+func (_ annotationsLsnr) DeleteAnnotation(svc *localnetv1.Service, key string) {
+	fmt.Print("DEL svc: ", svc.Namespace, "/", svc.Name, " annotation: ", key, "\n")
+}
+
+func ExampleAnnotationsListener() {
+	sl := New()
+	sl.AnnotationsListener = annotationsLsnr{}
+
+	fmt.Println("add svc with annotations")
+	sl.SetService(&localnetv1.Service{
+		Namespace:   "ns",
+		Name:        "svc-1",
+		Annotations: map[string]string{"example.com/dsr": "true", "example.com/rate-limit": "100"},
+	})
+
+	fmt.Println("change the rate limit, remove dsr")
+	sl.SetService(&localnetv1.Service{
+		Namespace:   "ns",
+		Name:        "svc-1",
+		Annotations: map[string]string{"example.com/rate-limit": "200"},
+	})
+
+	fmt.Println("delete svc")
+	sl.DeleteService("ns", "svc-1")
+
+	// Output:
+	// add svc with annotations
+	// SET svc: ns/svc-1 annotation: example.com/dsr=true
+	// SET svc: ns/svc-1 annotation: example.com/rate-limit=100
+	// change the rate limit, remove dsr
+	// SET svc: ns/svc-1 annotation: example.com/rate-limit=200
+	// DEL svc: ns/svc-1 annotation: example.com/dsr
+	// delete svc
+	// DEL svc: ns/svc-1 annotation: example.com/rate-limit
+}
+
+type sessAffTimeoutLsnr struct{}
+
+func (_ sessAffTimeoutLsnr) EnableSessionAffinity(svc *localnetv1.Service, sessionAffinity SessionAffinity) {
+	fmt.Print("ENABLE svc: ", svc.Namespace, "/", svc.Name, " timeout: ", sessionAffinity.ClientIP.ClientIP.TimeoutSeconds, "\n")
+}
+func (_ sessAffTimeoutLsnr) DisableSessionAffinity(svc *localnetv1.Service) {
+	fmt.Print("DISABLE svc: ", svc.Namespace, "/", svc.Name, "\n")
+}
+
+func ExampleSessionAffinityListener() {
+	sl := New()
+	sl.SessionAffinityListener = sessAffTimeoutLsnr{}
+
+	withTimeout := func(timeout int32) *localnetv1.Service {
+		return &localnetv1.Service{
+			Namespace: "ns",
+			Name:      "svc-1",
+			SessionAffinity: &localnetv1.Service_ClientIP{
+				ClientIP: &localnetv1.ClientIPAffinity{TimeoutSeconds: timeout},
+			},
+		}
+	}
+
+	fmt.Println("add svc with session affinity")
+	sl.SetService(withTimeout(10))
+
+	fmt.Println("same timeout")
+	sl.SetService(withTimeout(10))
+
+	fmt.Println("change the timeout")
+	sl.SetService(withTimeout(60))
+
+	fmt.Println("disable session affinity")
+	sl.SetService(&localnetv1.Service{Namespace: "ns", Name: "svc-1"})
+
+	// Output:
+	// add svc with session affinity
+	// ENABLE svc: ns/svc-1 timeout: 10
+	// same timeout
+	// change the timeout
+	// ENABLE svc: ns/svc-1 timeout: 60
+	// disable session affinity
+	// DISABLE svc: ns/svc-1
+}
@@ -29,6 +29,7 @@ type wrapper struct {
 }
 
 var _ decoder.Interface = wrapper{}
+var _ decoder.NodeListener = wrapper{}
 
 // Wrap a decoder so it receives detailled events depending on which interfaces
 // it implements.
@@ -60,6 +61,9 @@ func Wrap(backend decoder.Interface) decoder.Interface {
 	if v, ok := backend.(TrafficPolicyListener); ok {
 		l.TrafficPolicyListener = v
 	}
+	if v, ok := backend.(AnnotationsListener); ok {
+		l.AnnotationsListener = v
+	}
 
 	wrap := wrapper{
 		Interface: backend,
@@ -77,3 +81,17 @@ func (w wrapper) DeleteService(namespace, name string) {
 	w.l.DeleteService(namespace, name)
 	w.Interface.DeleteService(namespace, name)
 }
+
+// SetNode forwards the node to the backend if it's a decoder.NodeListener
+func (w wrapper) SetNode(node *localnetv1.Node) {
+	if l, ok := w.Interface.(decoder.NodeListener); ok {
+		l.SetNode(node)
+	}
+}
+
+// DeleteNode forwards the node deletion to the backend if it's a decoder.NodeListener
+func (w wrapper) DeleteNode(name string) {
+	if l, ok := w.Interface.(decoder.NodeListener); ok {
+		l.DeleteNode(name)
+	}
+}
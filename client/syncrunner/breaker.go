@@ -0,0 +1,118 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncrunner
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Breaker isolates the keys (ie: services) failing repeatedly, so they don't fail the syncs of the others. A failed
+// key is skipped until its backoff expires, then given another chance; its backoff starts at Min and is doubled
+// after each consecutive failure, up to Max. A success closes the breaker of the key.
+type Breaker struct {
+	Min, Max time.Duration
+
+	mu   sync.Mutex
+	open map[string]*breakerState
+
+	now func() time.Time
+}
+
+type breakerState struct {
+	backoff Backoff
+	until   time.Time
+}
+
+func NewBreaker(min, max time.Duration) *Breaker {
+	return &Breaker{
+		Min:  min,
+		Max:  max,
+		open: map[string]*breakerState{},
+		now:  time.Now,
+	}
+}
+
+// Allow returns false if the key failed and its backoff didn't expire yet.
+func (b *Breaker) Allow(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.open[key]
+	return !ok || !b.now().Before(state.until)
+}
+
+// Failed records a failure of the key and returns the delay before it's allowed again.
+func (b *Breaker) Failed(key string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.open[key]
+	if !ok {
+		state = &breakerState{backoff: Backoff{Min: b.Min, Max: b.Max}}
+		b.open[key] = state
+	}
+
+	delay := state.backoff.Failed()
+	state.until = b.now().Add(delay)
+	return delay
+}
+
+// Succeeded records a success of the key, returning true if it had failed before.
+func (b *Breaker) Succeeded(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.open[key]; !ok {
+		return false
+	}
+
+	delete(b.open, key)
+	return true
+}
+
+// Keys returns the keys that failed and didn't succeed since, sorted.
+func (b *Breaker) Keys() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	keys := make([]string, 0, len(b.open))
+	for key := range b.open {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// NextRetry returns the delay until the next failed key is allowed again, and false if there's no failed key.
+func (b *Breaker) NextRetry() (delay time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	for _, state := range b.open {
+		d := state.until.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		if !ok || d < delay {
+			delay, ok = d, true
+		}
+	}
+	return
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncrunner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+
+	b := NewBreaker(time.Second, 4*time.Second)
+	b.now = clock.Now
+
+	if !b.Allow("default/web") {
+		t.Fatal("a key that never failed should be allowed")
+	}
+
+	if delay := b.Failed("default/web"); delay != time.Second {
+		t.Errorf("expected a 1s backoff after the 1st failure, got %v", delay)
+	}
+	if b.Allow("default/web") {
+		t.Error("a failed key should be skipped during its backoff")
+	}
+	if !b.Allow("default/db") {
+		t.Error("the other keys should be allowed")
+	}
+	if delay, ok := b.NextRetry(); !ok || delay != time.Second {
+		t.Errorf("expected the next retry in 1s, got %v (%v)", delay, ok)
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	if !b.Allow("default/web") {
+		t.Error("a failed key should be allowed again after its backoff")
+	}
+
+	for _, expected := range []time.Duration{2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		if delay := b.Failed("default/web"); delay != expected {
+			t.Errorf("expected a %v backoff, got %v", expected, delay)
+		}
+	}
+
+	if keys := b.Keys(); len(keys) != 1 || keys[0] != "default/web" {
+		t.Errorf("expected only default/web to be open, got %v", keys)
+	}
+
+	if !b.Succeeded("default/web") {
+		t.Error("the success of a failed key should be reported")
+	}
+	if b.Succeeded("default/web") {
+		t.Error("the success of a key that didn't fail should not be reported")
+	}
+	if _, ok := b.NextRetry(); ok {
+		t.Error("expected no retry once all the keys succeeded")
+	}
+	if delay := b.Failed("default/web"); delay != time.Second {
+		t.Errorf("expected the backoff to be reset after a success, got %v", delay)
+	}
+}
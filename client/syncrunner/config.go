@@ -0,0 +1,99 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncrunner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+type Config struct {
+	// Period is the max interval between syncs, the rules are re-synced at least that often.
+	Period time.Duration
+	// MinPeriod is the min interval between syncs, modulo bursts.
+	MinPeriod time.Duration
+	// Burst is the number of syncs allowed in a row before MinPeriod applies.
+	Burst int
+}
+
+func (c *Config) BindFlags(flags *pflag.FlagSet) {
+	flags.DurationVar(&c.Period, "sync-period", 30*time.Second, "max interval between syncs of the rules (they're re-synced at least that often)")
+	flags.DurationVar(&c.MinPeriod, "min-sync-period", time.Second, "min interval between syncs of the rules, after the bursts")
+	flags.IntVar(&c.Burst, "sync-burst", 2, "syncs allowed in a row before --min-sync-period applies")
+}
+
+func (c *Config) Validate() error {
+	if c.Period <= 0 {
+		return fmt.Errorf("sync period must be positive (got %v)", c.Period)
+	}
+	if c.MinPeriod < 0 || c.MinPeriod > c.Period {
+		return fmt.Errorf("min sync period must be between 0 and the sync period (%v, got %v)", c.Period, c.MinPeriod)
+	}
+	if c.Burst < 1 {
+		return fmt.Errorf("sync burst must be at least 1 (got %d)", c.Burst)
+	}
+	return nil
+}
+
+// NewRunner returns a BoundedFrequencyRunner running fn with this configuration.
+func (c *Config) NewRunner(name string, fn func()) *BoundedFrequencyRunner {
+	return NewBoundedFrequencyRunner(name, fn, c.MinPeriod, c.Period, c.Burst)
+}
+
+// NewRunnerWithError returns a BoundedFrequencyRunner running fn with this configuration, counting the runs
+// returning an error as failures.
+func (c *Config) NewRunnerWithError(name string, fn func() error) *BoundedFrequencyRunner {
+	return NewBoundedFrequencyRunnerWithError(name, fn, c.MinPeriod, c.Period, c.Burst)
+}
+
+// Backoff returns the retry policy for the failed syncs of this configuration.
+func (c *Config) Backoff() *Backoff {
+	min := c.MinPeriod
+	if min <= 0 {
+		min = time.Second
+	}
+	return &Backoff{Min: min, Max: c.Period}
+}
+
+// Backoff computes the delays before retrying a failed sync (see BoundedFrequencyRunner.RetryAfter):
+// Min after the first failure, doubled after each consecutive failure, up to Max.
+type Backoff struct {
+	Min, Max time.Duration
+
+	failures int
+}
+
+// Failed records a failed sync and returns the delay before retrying.
+func (b *Backoff) Failed() time.Duration {
+	delay := b.Min
+	for i := 0; i < b.failures && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if delay > b.Max {
+		delay = b.Max
+	}
+
+	b.failures++
+	return delay
+}
+
+// Succeeded records a successful sync, resetting the delay to Min.
+func (b *Backoff) Succeeded() {
+	b.failures = 0
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncrunner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func TestConfigFlags(t *testing.T) {
+	c := &Config{}
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	c.BindFlags(flags)
+
+	if err := c.Validate(); err != nil {
+		t.Error("defaults should be valid: ", err)
+	}
+
+	if err := flags.Parse([]string{"--sync-period=10s", "--min-sync-period=20s"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err == nil {
+		t.Error("min sync period above the sync period should be rejected")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c := &Config{Period: 10 * time.Second, MinPeriod: 0, Burst: 2}
+	b := c.Backoff()
+
+	for i, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if delay := b.Failed(); delay != expected {
+			t.Errorf("failure %d: expected a %v delay, got %v", i+1, expected, delay)
+		}
+	}
+
+	b.Succeeded()
+
+	if delay := b.Failed(); delay != time.Second {
+		t.Errorf("expected the delay to be reset after a success, got %v", delay)
+	}
+}
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestTokenBucket(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	tb := newTokenBucket(1, 2, clock)
+
+	accepted := 0
+	for i := 0; i < 5; i++ {
+		if tb.TryAccept() {
+			accepted++
+		}
+	}
+	if accepted != 2 {
+		t.Errorf("expected a burst of 2 runs, got %d", accepted)
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	if !tb.TryAccept() {
+		t.Error("a run should be accepted after the min interval")
+	}
+	if tb.TryAccept() {
+		t.Error("a 2nd run should be rejected before the min interval")
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncrunner
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket is a rate limiter accepting qps runs per second, with bursts of up to burst runs.
+type tokenBucket struct {
+	qps   float64
+	burst float64
+	clock interface{ Now() time.Time }
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+var _ rateLimiter = &tokenBucket{}
+
+func newTokenBucket(qps float32, burst int, clock interface{ Now() time.Time }) *tokenBucket {
+	return &tokenBucket{
+		qps:    float64(qps),
+		burst:  float64(burst),
+		clock:  clock,
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}
+}
+
+func (tb *tokenBucket) TryAccept() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.clock.Now()
+
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.qps
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+
+	if tb.tokens < 1 {
+		return false
+	}
+
+	tb.tokens--
+	return true
+}
+
+func (tb *tokenBucket) Stop() {}
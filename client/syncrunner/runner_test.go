@@ -0,0 +1,88 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncrunner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunnerStats(t *testing.T) {
+	errSync := errors.New("sync failed")
+
+	results := []error{nil, errSync}
+	runs := make(chan RunInfo, len(results))
+
+	bfr := NewBoundedFrequencyRunnerWithError("test", func() error {
+		err := results[0]
+		results = results[1:]
+		return err
+	}, 0, time.Hour, 1)
+	bfr.OnRun(func(run RunInfo) { runs <- run })
+
+	if stats := bfr.Stats(); stats.Runs != 0 || !stats.LastRun.IsZero() {
+		t.Errorf("expected no run yet, got %+v", stats)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bfr.Loop(ctx)
+	}()
+
+	waitRun := func() RunInfo {
+		t.Helper()
+		bfr.Run()
+		select {
+		case run := <-runs:
+			return run
+		case <-time.After(5 * time.Second):
+			t.Fatal("the function didn't run")
+			return RunInfo{}
+		}
+	}
+
+	if run := waitRun(); run.Err != nil || run.Start.IsZero() {
+		t.Errorf("expected a successful run, got %+v", run)
+	}
+	success := bfr.Stats().LastSuccess
+
+	if run := waitRun(); run.Err != errSync {
+		t.Errorf("expected the run to fail with %v, got %+v", errSync, run)
+	}
+
+	bfr.RetryAfter(time.Minute)
+
+	stats := bfr.Stats()
+	if stats.Runs != 2 || stats.Failures != 1 || stats.Retries != 1 {
+		t.Errorf("expected 2 runs, 1 failure and 1 retry, got %+v", stats)
+	}
+	if stats.LastError != errSync || stats.LastSuccess != success || stats.LastRun.Before(success) {
+		t.Errorf("expected the last run to be the failed one, after the last success, got %+v", stats)
+	}
+
+	// the loop ends with its context
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Loop didn't return when the context was canceled")
+	}
+}
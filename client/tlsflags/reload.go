@@ -0,0 +1,155 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tlsflags
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// watchedFiles tells if files changed since they were last loaded, from their content (so the changes within the
+// modification time's precision and the symlink swaps of mounted secrets are seen).
+type watchedFiles struct {
+	paths    []string
+	contents [][]byte
+}
+
+// read returns the contents of the files, and if they changed since the last load.
+func (w *watchedFiles) read() (contents [][]byte, changed bool, err error) {
+	contents = make([][]byte, len(w.paths))
+	for i, path := range w.paths {
+		contents[i], err = os.ReadFile(path)
+		if err != nil {
+			return
+		}
+	}
+
+	if w.contents == nil {
+		return contents, true, nil
+	}
+
+	for i := range contents {
+		if !bytes.Equal(contents[i], w.contents[i]) {
+			return contents, true, nil
+		}
+	}
+	return contents, false, nil
+}
+
+// keyPair holds a key pair, reloaded when its files change. If the reload fails (ie: the files are being
+// rotated), the previous key pair is kept until the files change again.
+type keyPair struct {
+	mu    sync.Mutex
+	files watchedFiles
+	cert  *tls.Certificate
+}
+
+func newKeyPair(certFile, keyFile string) (*keyPair, error) {
+	p := &keyPair{files: watchedFiles{paths: []string{certFile, keyFile}}}
+	if _, err := p.get(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *keyPair) get() (*tls.Certificate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	contents, changed, err := p.files.read()
+	if err == nil && !changed {
+		return p.cert, nil
+	}
+
+	var cert tls.Certificate
+	if err == nil {
+		cert, err = tls.X509KeyPair(contents[0], contents[1])
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to load TLS key pair: %w", err)
+		if p.cert == nil {
+			return nil, err
+		}
+
+		klog.Error(err, " (keeping the previous one)")
+		return p.cert, nil
+	}
+
+	if p.cert != nil {
+		klog.Info("reloaded TLS key pair ", p.files.paths[0])
+	}
+
+	p.cert = &cert
+	p.files.contents = contents
+	return p.cert, nil
+}
+
+// certPool holds a CA certificate pool, reloaded when its file changes. If the reload fails, the previous pool is
+// kept until the file changes again.
+type certPool struct {
+	mu    sync.Mutex
+	files watchedFiles
+	pool  *x509.CertPool
+}
+
+func newCertPool(caFile string) (*certPool, error) {
+	p := &certPool{files: watchedFiles{paths: []string{caFile}}}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *certPool) get() *x509.CertPool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.reload(); err != nil {
+		klog.Error(err, " (keeping the previous one)")
+	}
+
+	return p.pool
+}
+
+func (p *certPool) reload() error {
+	contents, changed, err := p.files.read()
+	if err != nil {
+		return fmt.Errorf("failed to load TLS CA certificate: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(contents[0]) {
+		return fmt.Errorf("failed to parse TLS CA certificate %s", p.files.paths[0])
+	}
+
+	if p.pool != nil {
+		klog.Info("reloaded TLS CA certificate ", p.files.paths[0])
+	}
+
+	p.pool = pool
+	p.files.contents = contents
+	return nil
+}
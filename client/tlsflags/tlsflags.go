@@ -19,9 +19,12 @@ package tlsflags
 import (
 	"crypto/tls"
 	"crypto/x509"
-	"io/ioutil"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
-	// "k8s.io/klog/v2"
+
+	"k8s.io/klog/v2"
 )
 
 func Bind(flags FlagSet) (f *Flags) {
@@ -34,11 +37,19 @@ type Flags struct {
 	KeyFile,
 	CertFile,
 	CAFile string
+
+	// ClientCAFile is the CA validating the client certificates on servers (CAFile if empty).
+	ClientCAFile string
+
+	// SPIFFEIDs are the SPIFFE IDs accepted from the peers, comma separated (any if empty). An ID ending with "/*"
+	// accepts any ID under its path.
+	SPIFFEIDs string
 }
 
 // FlagSet matches flag.FlagSet and pflag.FlagSet
 type FlagSet interface {
 	DurationVar(varPtr *time.Duration, name string, value time.Duration, doc string)
+	Float64Var(varPtr *float64, name string, value float64, doc string)
 	IntVar(varPtr *int, name string, value int, doc string)
 	StringVar(varPtr *string, name, value, doc string)
 	Uint64Var(varPtr *uint64, name string, value uint64, doc string)
@@ -48,38 +59,185 @@ func (f *Flags) Bind(flags FlagSet, prefix string) {
 	flags.StringVar(&f.KeyFile, prefix+"tls-key", "", "TLS key file")
 	flags.StringVar(&f.CertFile, prefix+"tls-crt", "", "TLS certificate file")
 	flags.StringVar(&f.CAFile, prefix+"tls-ca", "", "TLS CA certificate file")
+	flags.StringVar(&f.ClientCAFile, prefix+"tls-client-ca", "", "TLS CA certificate file validating the clients, when serving (defaults to the CA certificate file)")
+	flags.StringVar(&f.SPIFFEIDs, prefix+"tls-spiffe-ids", "", "SPIFFE IDs accepted from the peers, comma separated (any if empty, spiffe://domain/path/* accepts the IDs under a path)")
+}
+
+func (f *Flags) enabled() bool {
+	return f != nil && (f.CAFile != "" || f.KeyFile != "" || f.CertFile != "")
 }
 
+// Config returns the client TLS configuration, or nil if TLS is not enabled.
+//
+// Deprecated: use ClientConfig, which reports the errors.
 func (f *Flags) Config() (cfg *tls.Config) {
-	if f == nil || f.CAFile == "" && f.KeyFile == "" && f.CertFile == "" {
+	cfg, err := f.ClientConfig()
+	if err != nil {
+		klog.Error("invalid TLS configuration: ", err)
+	}
+	return
+}
+
+// ClientConfig returns the TLS configuration of the clients, or nil if TLS is not enabled. The key pair (if any)
+// is presented to the servers, which are validated by the CA (or the system's CAs). The files are reloaded when they
+// change, so the certificates can be rotated without restarting.
+func (f *Flags) ClientConfig() (cfg *tls.Config, err error) {
+	if !f.enabled() {
 		return
 	}
 
 	cfg = &tls.Config{}
 
 	if f.KeyFile != "" || f.CertFile != "" {
-		cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+		pair, err := newKeyPair(f.CertFile, f.KeyFile)
 		if err != nil {
-			//	klog.Fatal("failed to load TLS key pair: ", err)
+			return nil, err
 		}
 
-		cfg.Certificates = []tls.Certificate{cert}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return pair.get()
+		}
 	}
 
+	var roots *certPool
 	if f.CAFile != "" {
-		data, err := ioutil.ReadFile(f.CAFile)
+		roots, err = newCertPool(f.CAFile)
 		if err != nil {
-			//	klog.Fatal("failed to load TLS CA certificate: ", err)
+			return nil, err
+		}
+	}
+
+	spiffeIDs := f.spiffeIDs()
+
+	if roots == nil && len(spiffeIDs) == 0 {
+		return // the default verification is enough
+	}
+
+	// verify the server ourselves, so the CA reloads are taken into account
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		opts := x509.VerifyOptions{
+			DNSName:       cs.ServerName,
+			Intermediates: x509.NewCertPool(),
+		}
+		if roots != nil {
+			opts.Roots = roots.get()
 		}
 
-		pool := x509.NewCertPool()
-		if !pool.AppendCertsFromPEM(data) {
-			//	klog.Fatal("failed to parse CA certificate")
+		if err := verifyPeer(cs, opts); err != nil {
+			return err
 		}
 
-		cfg.ClientCAs = pool
-		cfg.RootCAs = pool
+		return checkSPIFFEID(cs, spiffeIDs)
 	}
 
 	return
 }
+
+// ServerConfig returns the TLS configuration of the servers, or nil if TLS is not enabled. The clients must present
+// a certificate validated by the client CA (mTLS) when there's one. The files are reloaded when they change, so the
+// certificates can be rotated without restarting.
+func (f *Flags) ServerConfig() (cfg *tls.Config, err error) {
+	if !f.enabled() {
+		return
+	}
+
+	if f.KeyFile == "" || f.CertFile == "" {
+		return nil, errors.New("serving TLS requires a key and a certificate")
+	}
+
+	pair, err := newKeyPair(f.CertFile, f.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg = &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return pair.get()
+		},
+	}
+
+	clientCAFile := f.ClientCAFile
+	if clientCAFile == "" {
+		clientCAFile = f.CAFile
+	}
+
+	if clientCAFile == "" {
+		if f.SPIFFEIDs != "" {
+			return nil, errors.New("checking the SPIFFE IDs of the clients requires a client CA")
+		}
+		return
+	}
+
+	clientCAs, err := newCertPool(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	spiffeIDs := f.spiffeIDs()
+
+	// the client certificates are verified by VerifyConnection, against the current client CAs
+	cfg.ClientAuth = tls.RequireAnyClientCert
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		opts := x509.VerifyOptions{
+			Roots:         clientCAs.get(),
+			Intermediates: x509.NewCertPool(),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+
+		if err := verifyPeer(cs, opts); err != nil {
+			return err
+		}
+
+		return checkSPIFFEID(cs, spiffeIDs)
+	}
+
+	return
+}
+
+func (f *Flags) spiffeIDs() (ids []string) {
+	for _, id := range strings.Split(f.SPIFFEIDs, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return
+}
+
+// verifyPeer verifies the certificate chain presented by the peer.
+func verifyPeer(cs tls.ConnectionState, opts x509.VerifyOptions) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no peer certificate")
+	}
+
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// checkSPIFFEID checks the SPIFFE ID (the spiffe:// URI SAN) of the peer's certificate, if IDs are required.
+func checkSPIFFEID(cs tls.ConnectionState, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	for _, uri := range cs.PeerCertificates[0].URIs {
+		if uri.Scheme != "spiffe" {
+			continue
+		}
+
+		peerID := uri.String()
+		for _, id := range ids {
+			if peerID == id || strings.HasSuffix(id, "/*") && strings.HasPrefix(peerID, id[:len(id)-1]) {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("SPIFFE ID %q not accepted", peerID)
+	}
+
+	return errors.New("no SPIFFE ID in the peer certificate")
+}
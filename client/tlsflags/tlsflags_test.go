@@ -0,0 +1,307 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tlsflags
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert, key}
+}
+
+func (ca *testCA) writeCert(t *testing.T, path string) {
+	writePEM(t, path, "CERTIFICATE", ca.cert.Raw)
+}
+
+// writeKeyPair writes a key pair signed by the CA, valid for localhost and the SPIFFE ID (if any).
+func (ca *testCA) writeKeyPair(t *testing.T, certFile, keyFile, spiffeID string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if spiffeID != "" {
+		uri, err := url.Parse(spiffeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.URIs = []*url.URL{uri}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// handshake runs a TLS handshake between the client and server configurations, returning their errors.
+func handshake(t *testing.T, client, server *tls.Config) (clientErr, serverErr error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	clientConn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close()
+
+	serverConn, err := lis.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverConn.Close()
+
+	deadline := time.Now().Add(10 * time.Second)
+	clientConn.SetDeadline(deadline)
+	serverConn.SetDeadline(deadline)
+
+	client = client.Clone()
+	client.ServerName = "localhost"
+
+	done := make(chan error, 1)
+	go func() {
+		conn := tls.Server(serverConn, server)
+		err := conn.Handshake()
+		if err == nil {
+			// TLS 1.3 client certificates are verified after the client's handshake: read its first message
+			_, err = conn.Read(make([]byte, 1))
+		}
+		serverConn.Close()
+		done <- err
+	}()
+
+	conn := tls.Client(clientConn, client)
+	clientErr = conn.Handshake()
+	if clientErr == nil {
+		_, clientErr = conn.Write([]byte{0})
+	}
+	clientConn.Close()
+
+	serverErr = <-done
+	return
+}
+
+type testFiles struct {
+	dir string
+}
+
+func (f testFiles) path(name string) string {
+	return filepath.Join(f.dir, name)
+}
+
+func (f testFiles) flags(name, spiffeIDs string) *Flags {
+	return &Flags{
+		CertFile:  f.path(name + ".crt"),
+		KeyFile:   f.path(name + ".key"),
+		CAFile:    f.path("ca.crt"),
+		SPIFFEIDs: spiffeIDs,
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	files := testFiles{t.TempDir()}
+
+	ca := newTestCA(t, "ca")
+	ca.writeCert(t, files.path("ca.crt"))
+	ca.writeKeyPair(t, files.path("server.crt"), files.path("server.key"), "spiffe://kpng.test/server")
+	ca.writeKeyPair(t, files.path("client.crt"), files.path("client.key"), "spiffe://kpng.test/node/node-1")
+
+	otherCA := newTestCA(t, "other")
+	otherCA.writeKeyPair(t, files.path("other.crt"), files.path("other.key"), "spiffe://kpng.test/node/node-2")
+
+	mustServerConfig := func(f *Flags) *tls.Config {
+		cfg, err := f.ServerConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+	mustClientConfig := func(f *Flags) *tls.Config {
+		cfg, err := f.ClientConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+
+	server := mustServerConfig(files.flags("server", "spiffe://kpng.test/node/*"))
+
+	t.Run("accepted", func(t *testing.T) {
+		clientErr, serverErr := handshake(t, mustClientConfig(files.flags("client", "spiffe://kpng.test/server")), server)
+		if clientErr != nil || serverErr != nil {
+			t.Fatal("handshake failed: ", clientErr, ", ", serverErr)
+		}
+	})
+
+	t.Run("no client certificate", func(t *testing.T) {
+		_, serverErr := handshake(t, mustClientConfig(&Flags{CAFile: files.path("ca.crt")}), server)
+		if serverErr == nil {
+			t.Fatal("client without certificate accepted")
+		}
+	})
+
+	t.Run("client from another CA", func(t *testing.T) {
+		_, serverErr := handshake(t, mustClientConfig(files.flags("other", "")), server)
+		if serverErr == nil {
+			t.Fatal("client from another CA accepted")
+		}
+	})
+
+	t.Run("client SPIFFE ID not accepted", func(t *testing.T) {
+		strictServer := mustServerConfig(files.flags("server", "spiffe://kpng.test/node/node-2"))
+
+		_, serverErr := handshake(t, mustClientConfig(files.flags("client", "")), strictServer)
+		if serverErr == nil {
+			t.Fatal("client with another SPIFFE ID accepted")
+		}
+	})
+
+	t.Run("server SPIFFE ID not accepted", func(t *testing.T) {
+		clientErr, _ := handshake(t, mustClientConfig(files.flags("client", "spiffe://kpng.test/other")), server)
+		if clientErr == nil {
+			t.Fatal("server with another SPIFFE ID accepted")
+		}
+	})
+}
+
+func TestRotation(t *testing.T) {
+	files := testFiles{t.TempDir()}
+
+	ca := newTestCA(t, "ca")
+	ca.writeCert(t, files.path("ca.crt"))
+	ca.writeKeyPair(t, files.path("server.crt"), files.path("server.key"), "")
+	ca.writeKeyPair(t, files.path("client.crt"), files.path("client.key"), "")
+
+	server, err := files.flags("server", "").ServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := files.flags("client", "").ClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if clientErr, serverErr := handshake(t, client, server); clientErr != nil || serverErr != nil {
+		t.Fatal("handshake failed: ", clientErr, ", ", serverErr)
+	}
+
+	// rotate the CA and all the key pairs
+	newCA := newTestCA(t, "new-ca")
+	newCA.writeCert(t, files.path("ca.crt"))
+	newCA.writeKeyPair(t, files.path("server.crt"), files.path("server.key"), "")
+	newCA.writeKeyPair(t, files.path("client.crt"), files.path("client.key"), "")
+
+	if clientErr, serverErr := handshake(t, client, server); clientErr != nil || serverErr != nil {
+		t.Fatal("handshake failed after rotation: ", clientErr, ", ", serverErr)
+	}
+
+	// a broken key pair keeps the previous one
+	if err := os.WriteFile(files.path("server.key"), []byte("rotating"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if clientErr, serverErr := handshake(t, client, server); clientErr != nil || serverErr != nil {
+		t.Fatal("handshake failed with a broken key pair: ", clientErr, ", ", serverErr)
+	}
+}
+
+func TestServerConfigErrors(t *testing.T) {
+	files := testFiles{t.TempDir()}
+
+	if cfg, err := (&Flags{}).ServerConfig(); cfg != nil || err != nil {
+		t.Error("expected no TLS, got ", cfg, ", ", err)
+	}
+
+	if _, err := (&Flags{CAFile: files.path("ca.crt")}).ServerConfig(); err == nil {
+		t.Error("expected an error without a key pair")
+	}
+
+	if _, err := files.flags("missing", "").ServerConfig(); err == nil {
+		t.Error("expected an error with missing files")
+	}
+}
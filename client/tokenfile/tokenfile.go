@@ -0,0 +1,59 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tokenfile authenticates the calls to the API with a bearer token read from a file (ie: a projected
+// service account token, see the server's --node-auth flag). The file is read on each call, so the tokens rotated
+// by the kubelet are used right away.
+package tokenfile
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+)
+
+// DialOptions returns the options to dial with to authenticate the calls with the token of the file.
+func DialOptions(file string) []grpc.DialOption {
+	if file == "" {
+		return nil
+	}
+
+	return []grpc.DialOption{grpc.WithPerRPCCredentials(credentials(file))}
+}
+
+type credentials string
+
+func (c credentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	data, err := os.ReadFile(string(c))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the token: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return nil, fmt.Errorf("empty token in %s", string(c))
+	}
+
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+// RequireTransportSecurity is true: the tokens are never sent in clear text.
+func (c credentials) RequireTransportSecurity() bool {
+	return true
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// eventLinkTTL is how long the watch event of a service is linked to the diffs changing it; the diffs computed later
+// are caused by other changes (ie: the node's zone).
+const eventLinkTTL = 5 * time.Minute
+
+// serviceEvents are the spans of the last watch event of each service, by namespace/name.
+var serviceEvents = struct {
+	sync.Mutex
+	spans      map[string]eventSpan
+	lastPruned time.Time
+}{spans: map[string]eventSpan{}}
+
+type eventSpan struct {
+	ctx trace.SpanContext
+	at  time.Time
+}
+
+// RecordEvent records the span of a watch event of the service (kpng.watch-event), to link it to the diffs changing
+// the service.
+func RecordEvent(namespace, name string, span trace.SpanContext) {
+	if !span.IsSampled() {
+		return
+	}
+
+	now := time.Now()
+
+	serviceEvents.Lock()
+	defer serviceEvents.Unlock()
+
+	serviceEvents.spans[namespace+"/"+name] = eventSpan{ctx: span, at: now}
+
+	if now.Sub(serviceEvents.lastPruned) < eventLinkTTL {
+		return
+	}
+
+	for service, event := range serviceEvents.spans {
+		if now.Sub(event.at) > eventLinkTTL {
+			delete(serviceEvents.spans, service)
+		}
+	}
+	serviceEvents.lastPruned = now
+}
+
+// EventLinks returns the links to the recent watch events of the services (namespace/name), limited to
+// maxServiceAttributes.
+func EventLinks(services map[string]bool) (links []trace.Link) {
+	now := time.Now()
+
+	serviceEvents.Lock()
+	defer serviceEvents.Unlock()
+
+	for service := range services {
+		event, ok := serviceEvents.spans[service]
+		if !ok || now.Sub(event.at) > eventLinkTTL {
+			continue
+		}
+
+		links = append(links, trace.Link{SpanContext: event.ctx})
+		if len(links) == maxServiceAttributes {
+			break
+		}
+	}
+	return
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+// maxServiceAttributes is the maximum number of services listed in the spans' attributes, to bound their size.
+const maxServiceAttributes = 100
+
+// ServicesAttribute lists the services changed (namespace/name), so the spans of a service can be found.
+var ServicesAttribute = attribute.Key("kpng.services")
+
+// Services returns the ServicesAttribute of the services, sorted and limited to maxServiceAttributes.
+func Services(services map[string]bool) attribute.KeyValue {
+	list := make([]string, 0, len(services))
+	for service := range services {
+		list = append(list, service)
+	}
+	sort.Strings(list)
+
+	if len(list) > maxServiceAttributes {
+		list = list[:maxServiceAttributes]
+	}
+	return ServicesAttribute.StringSlice(list)
+}
+
+// Sink wraps a node's sink to trace the change sets it receives (kpng.receive) and their application (kpng.apply),
+// as children of the diff span of the brain sent with the sync.
+func Sink(sink localsink.Sink) localsink.Sink {
+	return &traceSink{Sink: sink, services: map[string]bool{}}
+}
+
+type traceSink struct {
+	localsink.Sink
+
+	// receivedAt is the time the first operation of the change set was received (zero if none yet)
+	receivedAt time.Time
+	ops        int
+	services   map[string]bool
+}
+
+func (s *traceSink) Reset() {
+	s.receivedAt = time.Time{}
+	s.ops = 0
+	s.services = map[string]bool{}
+
+	s.Sink.Reset()
+}
+
+func (s *traceSink) Send(op *localnetv1.OpItem) error {
+	if s.receivedAt.IsZero() {
+		s.receivedAt = time.Now()
+	}
+
+	switch v := op.Op.(type) {
+	case *localnetv1.OpItem_Set:
+		s.record(v.Set.Ref)
+	case *localnetv1.OpItem_Delete:
+		s.record(v.Delete)
+	case *localnetv1.OpItem_Sync:
+		return s.sync(op, v.Sync)
+	}
+
+	return s.Sink.Send(op)
+}
+
+// record records the service changed by the operation
+func (s *traceSink) record(ref *localnetv1.Ref) {
+	s.ops++
+
+	s.services[ref.ServicePath()] = true
+}
+
+func (s *traceSink) sync(op *localnetv1.OpItem, syncOp *localnetv1.SyncOp) (err error) {
+	ctx := WithTraceParent(context.Background(), syncOp.TraceParent)
+
+	attrs := []attribute.KeyValue{
+		attribute.Int("kpng.ops", s.ops),
+		Services(s.services),
+	}
+
+	_, receive := Tracer().Start(ctx, "kpng.receive", trace.WithTimestamp(s.receivedAt), trace.WithAttributes(attrs...))
+	receive.End()
+
+	s.receivedAt = time.Time{}
+	s.ops = 0
+	s.services = map[string]bool{}
+
+	ctx, apply := Tracer().Start(ctx, "kpng.apply", trace.WithAttributes(attrs...))
+	defer apply.End()
+
+	setSyncContext(ctx)
+
+	err = s.Sink.Send(op)
+	if err != nil {
+		apply.RecordError(err)
+		apply.SetStatus(codes.Error, err.Error())
+	}
+	return
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+type testSink struct {
+	localsink.Config
+	syncs int
+}
+
+func (s *testSink) Setup() {}
+func (s *testSink) Reset() {}
+
+func (s *testSink) Send(op *localnetv1.OpItem) error {
+	if _, ok := op.Op.(*localnetv1.OpItem_Sync); ok {
+		s.syncs++
+
+		// the backend traces its sync with the change set's context
+		_, span := Tracer().Start(SyncContext(), "backend.sync")
+		span.End()
+	}
+	return nil
+}
+
+func set(set localnetv1.Set, path string) *localnetv1.OpItem {
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Set{Set: &localnetv1.Value{
+		Ref: &localnetv1.Ref{Set: set, Path: path},
+	}}}
+}
+
+func TestSink(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	// the brain's diff
+	ctx, diff := Tracer().Start(context.Background(), "kpng.diff")
+	diff.End()
+
+	traceParent := TraceParent(ctx)
+	if traceParent == "" {
+		t.Fatal("expected a trace context")
+	}
+
+	// the node
+	backend := &testSink{}
+	sink := Sink(backend)
+
+	sink.Send(set(localnetv1.Set_ServicesSet, "ns/a"))
+	sink.Send(set(localnetv1.Set_EndpointsSet, "ns/a/pod-1"))
+	sink.Send(set(localnetv1.Set_EndpointsSet, "ns/b/pod-1"))
+	sink.Send(&localnetv1.OpItem{Op: &localnetv1.OpItem_Sync{Sync: &localnetv1.SyncOp{TraceParent: traceParent}}})
+
+	if backend.syncs != 1 {
+		t.Fatalf("expected the sync to be sent to the backend")
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	for name, parent := range map[string]string{"kpng.receive": "kpng.diff", "kpng.apply": "kpng.diff", "backend.sync": "kpng.apply"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("expected a %s span", name)
+			continue
+		}
+		if span.Parent().SpanID() != spans[parent].SpanContext().SpanID() {
+			t.Errorf("expected %s to be a child of %s", name, parent)
+		}
+	}
+
+	for _, attr := range spans["kpng.receive"].Attributes() {
+		if attr.Key == ServicesAttribute {
+			if services := attr.Value.AsStringSlice(); !reflect.DeepEqual(services, []string{"ns/a", "ns/b"}) {
+				t.Errorf("unexpected services %v", services)
+			}
+		}
+	}
+}
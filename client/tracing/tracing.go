@@ -0,0 +1,135 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing traces the propagation of the changes with OpenTelemetry, from the watch events received by the
+// brain to the rules installed by the backends, so the latency can be attributed to the brain, the stream or the
+// backend:
+//
+//   - kpng.watch-event: a service or endpoints event from the Kubernetes API, applied to the store (brain);
+//   - kpng.diff: the diff computed for a node, linked to the events of the services it changes (brain);
+//   - kpng.receive: the change set, from its first operation to its sync, as received by the node (agent);
+//   - kpng.apply: the change set sent to the backend, which may trace its own spans (ie: iptables-restore).
+//
+// The trace context of the diff is sent to the node with the change set's sync (see localnetv1.SyncOp), and the
+// spans are exported with OTLP over gRPC.
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "sigs.k8s.io/kpng"
+
+	// traceParentHeader is the W3C trace context header carrying the trace and span IDs
+	traceParentHeader = "traceparent"
+)
+
+type Config struct {
+	// Endpoint is the OTLP gRPC endpoint the spans are exported to (tracing is disabled if empty).
+	Endpoint string
+	// Insecure disables TLS to the endpoint.
+	Insecure bool
+	// SampleRatio is the ratio of the traces sampled.
+	SampleRatio float64
+}
+
+func (c *Config) BindFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.Endpoint, "otlp-endpoint", "", "OTLP gRPC endpoint (host:port) to export the sync latency traces to (disabled if empty)")
+	flags.BoolVar(&c.Insecure, "otlp-insecure", false, "connect to the OTLP endpoint without TLS")
+	flags.Float64Var(&c.SampleRatio, "trace-sample-ratio", 1, "ratio of the changes traced, between 0 and 1")
+}
+
+// Setup exports the spans with OTLP, if enabled. The returned function flushes the spans and stops the export.
+func (c *Config) Setup(ctx context.Context, serviceName string) (shutdown func(context.Context) error, err error) {
+	if c.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(c.Endpoint)}
+	if c.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceNameKey.String(serviceName))),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns kpng's tracer (a no-op one if tracing is not setup).
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+var propagator = propagation.TraceContext{}
+
+// TraceParent returns the trace context of the context's span, to be sent to the node (empty if not sampled).
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier[traceParentHeader]
+}
+
+// WithTraceParent returns a context with the remote span of the trace context, if any.
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier{traceParentHeader: traceParent})
+}
+
+// syncContext is the context of the last change set sent to the backend, see SyncContext.
+var syncContext = struct {
+	sync.Mutex
+	ctx context.Context
+}{ctx: context.Background()}
+
+// SyncContext returns the context of the last change set sent to the backend, for the backends applying the change
+// sets asynchronously to trace their syncs.
+func SyncContext() context.Context {
+	syncContext.Lock()
+	defer syncContext.Unlock()
+
+	return syncContext.ctx
+}
+
+func setSyncContext(ctx context.Context) {
+	syncContext.Lock()
+	defer syncContext.Unlock()
+
+	syncContext.ctx = ctx
+}
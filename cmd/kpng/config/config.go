@@ -0,0 +1,181 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config reads kpng's configuration file (--config), a versioned YAML document like kube-proxy's
+// KubeProxyConfiguration. Its settings are applied to the flags of the command run, so a flag given on the command
+// line overrides the file.
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the version of the configuration file format.
+	APIVersion = "kpng.k8s.io/v1alpha1"
+	// Kind is the kind of the configuration file.
+	Kind = "KPNGConfiguration"
+)
+
+// Configuration is the content of the configuration file.
+type Configuration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Server is the address of the kpng API (--api).
+	Server string `json:"server,omitempty"`
+
+	// Backends are the backends run by to-multi (--backends).
+	Backends []string `json:"backends,omitempty"`
+
+	// SyncPeriod and MinSyncPeriod bound the interval between the syncs of the backends (--sync-period and
+	// --min-sync-period).
+	SyncPeriod    *metav1.Duration `json:"syncPeriod,omitempty"`
+	MinSyncPeriod *metav1.Duration `json:"minSyncPeriod,omitempty"`
+
+	// MasqueradeBit is the bit of the fwmark space marking the packets requiring SNAT (--iptables-masquerade-bit, or
+	// --masquerade-bit on Windows).
+	MasqueradeBit *int32 `json:"masqueradeBit,omitempty"`
+
+	// NodePortAddresses are the CIDRs of the node addresses the node ports are opened on (--nodeport-addresses).
+	NodePortAddresses []string `json:"nodePortAddresses,omitempty"`
+
+	// FeatureGates are the feature gates to set (--feature-gates).
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+
+	// Flags sets other flags of the command, by name (ie: "verify-period": "5m").
+	Flags map[string]string `json:"flags,omitempty"`
+}
+
+// Load reads the configuration file at path.
+func Load(path string) (*Configuration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Configuration{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks the version and the values of the configuration.
+func (c *Configuration) Validate() error {
+	if c.APIVersion != APIVersion || c.Kind != Kind {
+		return fmt.Errorf("unsupported %s/%s (expected %s/%s)", c.APIVersion, c.Kind, APIVersion, Kind)
+	}
+	if c.MasqueradeBit != nil && (*c.MasqueradeBit < 0 || *c.MasqueradeBit > 31) {
+		return fmt.Errorf("masqueradeBit must be within the range [0, 31], got %d", *c.MasqueradeBit)
+	}
+	return nil
+}
+
+// setting is the value of a configuration field, set on the first of its flags the command declares.
+type setting struct {
+	field string
+	flags []string
+	value string
+}
+
+func (c *Configuration) settings() (settings []setting) {
+	add := func(field, value string, flags ...string) {
+		settings = append(settings, setting{field: field, flags: flags, value: value})
+	}
+
+	if c.Server != "" {
+		add("server", c.Server, "api")
+	}
+	if len(c.Backends) != 0 {
+		add("backends", strings.Join(c.Backends, ","), "backends")
+	}
+	if c.SyncPeriod != nil {
+		add("syncPeriod", c.SyncPeriod.Duration.String(), "sync-period")
+	}
+	if c.MinSyncPeriod != nil {
+		add("minSyncPeriod", c.MinSyncPeriod.Duration.String(), "min-sync-period")
+	}
+	if c.MasqueradeBit != nil {
+		add("masqueradeBit", strconv.Itoa(int(*c.MasqueradeBit)), "iptables-masquerade-bit", "masquerade-bit")
+	}
+	if len(c.NodePortAddresses) != 0 {
+		add("nodePortAddresses", strings.Join(c.NodePortAddresses, ","), "nodeport-addresses")
+	}
+	if len(c.FeatureGates) != 0 {
+		pairs := make([]string, 0, len(c.FeatureGates))
+		for name, v := range c.FeatureGates {
+			pairs = append(pairs, name+"="+strconv.FormatBool(v))
+		}
+		sort.Strings(pairs)
+		add("featureGates", strings.Join(pairs, ","), "feature-gates")
+	}
+
+	names := make([]string, 0, len(c.Flags))
+	for name := range c.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		add("flags."+name, c.Flags[name], name)
+	}
+
+	return
+}
+
+// Apply sets the flags of the configuration that weren't given on the command line. The settings without a flag in
+// the command are ignored (ie: backends outside of to-multi), except the ones of Flags.
+func (c *Configuration) Apply(flags *pflag.FlagSet) error {
+	for _, s := range c.settings() {
+		var flag *pflag.Flag
+		for _, name := range s.flags {
+			if flag = flags.Lookup(name); flag != nil {
+				break
+			}
+		}
+
+		if flag == nil {
+			if strings.HasPrefix(s.field, "flags.") {
+				return fmt.Errorf("%s: unknown flag --%s", s.field, s.flags[0])
+			}
+			klog.V(1).Infof("config: %s not applicable to this command, ignored", s.field)
+			continue
+		}
+
+		if flag.Changed {
+			klog.V(1).Infof("config: %s overridden by --%s", s.field, flag.Name)
+			continue
+		}
+
+		if err := flags.Set(flag.Name, s.value); err != nil {
+			return fmt.Errorf("%s: invalid --%s: %w", s.field, flag.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "kpng.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApply(t *testing.T) {
+	path := writeConfig(t, `
+apiVersion: kpng.k8s.io/v1alpha1
+kind: KPNGConfiguration
+server: 10.0.0.1:12090
+backends: [to-iptables, to-ebpf]
+syncPeriod: 1m
+minSyncPeriod: 2s
+masqueradeBit: 12
+nodePortAddresses: [10.0.0.0/8]
+flags:
+  verify-period: 5m
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		api                         string
+		nodePortAddresses, backends []string
+		syncPeriod, minSyncPeriod   time.Duration
+		verifyPeriod                time.Duration
+		masqueradeBit               int
+	)
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.StringVar(&api, "api", "127.0.0.1:12090", "")
+	flags.StringSliceVar(&backends, "backends", nil, "")
+	flags.DurationVar(&syncPeriod, "sync-period", 30*time.Second, "")
+	flags.DurationVar(&minSyncPeriod, "min-sync-period", time.Second, "")
+	flags.IntVar(&masqueradeBit, "iptables-masquerade-bit", 14, "")
+	flags.StringSliceVar(&nodePortAddresses, "nodeport-addresses", nil, "")
+	flags.DurationVar(&verifyPeriod, "verify-period", time.Minute, "")
+
+	// given on the command line
+	if err := flags.Parse([]string{"--min-sync-period=5s"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cfg.Apply(flags); err != nil {
+		t.Fatal(err)
+	}
+
+	if api != "10.0.0.1:12090" || strings.Join(backends, ",") != "to-iptables,to-ebpf" ||
+		strings.Join(nodePortAddresses, ",") != "10.0.0.0/8" {
+		t.Errorf("unexpected api %v, backends %v, node port addresses %v", api, backends, nodePortAddresses)
+	}
+	if syncPeriod != time.Minute || masqueradeBit != 12 || verifyPeriod != 5*time.Minute {
+		t.Errorf("unexpected sync period %v, masquerade bit %d, verify period %v", syncPeriod, masqueradeBit, verifyPeriod)
+	}
+	if minSyncPeriod != 5*time.Second {
+		t.Errorf("the command line should override the file, got min sync period %v", minSyncPeriod)
+	}
+
+	// the settings of Flags must exist in the command, the others are ignored
+	other := pflag.NewFlagSet("other", pflag.ContinueOnError)
+	if err := cfg.Apply(other); err == nil || !strings.Contains(err.Error(), "verify-period") {
+		t.Errorf("expected the unknown flag to be rejected, got %v", err)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"version":       "apiVersion: kpng.k8s.io/v2\nkind: KPNGConfiguration\n",
+		"kind":          "apiVersion: kpng.k8s.io/v1alpha1\nkind: KubeProxyConfiguration\n",
+		"unknown field": "apiVersion: kpng.k8s.io/v1alpha1\nkind: KPNGConfiguration\nmode: iptables\n",
+		"masqueradeBit": "apiVersion: kpng.k8s.io/v1alpha1\nkind: KPNGConfiguration\nmasqueradeBit: 32\n",
+	} {
+		if _, err := Load(writeConfig(t, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
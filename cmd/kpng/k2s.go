@@ -27,9 +27,11 @@ import (
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
 
 	// this depends on the kpng server to run the integrated app
 	"sigs.k8s.io/kpng/server/jobs/kube2store"
+	"sigs.k8s.io/kpng/server/jobs/store2snapshot"
 	"sigs.k8s.io/kpng/server/proxystore"
 )
 
@@ -38,6 +40,7 @@ var (
 	kubeConfig string
 	kubeServer string
 	k2sCfg     = &kube2store.Config{}
+	snapCfg    = &store2snapshot.Config{}
 )
 
 func kube2storeCmd() *cobra.Command {
@@ -52,6 +55,7 @@ func kube2storeCmd() *cobra.Command {
 	flags.StringVar(&kubeServer, "server", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
 
 	k2sCfg.BindFlags(k2sCmd.PersistentFlags())
+	snapCfg.BindFlags(k2sCmd.PersistentFlags())
 	k2sCmd.AddCommand(storecmds.Commands(setupKube2store)...)
 
 	return k2sCmd
@@ -80,6 +84,18 @@ func setupKube2store() (ctx context.Context, store *proxystore.Store, err error)
 	// create the store
 	store = proxystore.New()
 
+	if snapCfg.FilePath != "" {
+		// serve the previous state until the API is listed again
+		if err := store2snapshot.Restore(store, snapCfg.FilePath); err != nil {
+			klog.Warning("failed to restore the snapshot, starting from an empty state: ", err)
+		}
+
+		go (&store2snapshot.Job{
+			Store:  store,
+			Config: snapCfg,
+		}).Run(ctx)
+	}
+
 	// start kube2store
 	go kube2store.Job{
 		Kube:   kubeClient,
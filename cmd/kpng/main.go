@@ -22,9 +22,15 @@ import (
 	"fmt"
 	"os"
 	"runtime/pprof"
+	"strconv"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
+	"sigs.k8s.io/kpng/client/featuregate"
+	"sigs.k8s.io/kpng/client/tracing"
+	"sigs.k8s.io/kpng/cmd/kpng/config"
+	"sigs.k8s.io/kpng/cmd/kpng/migrate"
 	"sigs.k8s.io/kpng/server/pkg/metrics"
 
 	"k8s.io/klog/v2"
@@ -34,7 +40,14 @@ import (
 
 var (
 	cpuprofile    = flag.String("cpuprofile", "", "write cpu profile to file")
-	exportMetrics = flag.String("exportMetrics", "", "start metrics server on the specified IP:PORT")
+	exportMetrics = flag.String("exportMetrics", "", "start metrics server on the specified IP:PORT or unix:///path/to/socket")
+
+	exportMetricsSocketMode = flag.String("exportMetricsSocketMode", "0660", "permissions of the metrics server's unix socket (octal)")
+	exportDebug             = flag.Bool("exportDebug", false, "also serve the /debug/pprof/ endpoints on the metrics server")
+
+	traceConfig = &tracing.Config{}
+
+	configFile string
 
 	version = "(unknown)"
 )
@@ -47,15 +60,41 @@ func main() {
 	}
 
 	cmd.PersistentFlags().AddGoFlagSet(flag.CommandLine)
+	cmd.PersistentFlags().StringVar(&configFile, "config", "", "configuration file (see cmd/kpng/config/README.md), its settings are overridden by the flags")
+	traceConfig.BindFlags(cmd.PersistentFlags())
+	featuregate.BindFlags(cmd.PersistentFlags())
 
 	cmd.AddCommand(
 		kube2storeCmd(), // no-op?
 		file2storeCmd(),
 		api2storeCmd(),
 		local2sinkCmd(),
+		migrate.Cmd(),
+		migrate.CleanupCmd(),
 		versionCmd(),
+		queryCmd(),
 	)
 
+	// the configuration file is applied to the flags of the command run, once they're parsed
+	cobra.OnInitialize(func() {
+		if configFile == "" {
+			return
+		}
+
+		cfg, err := config.Load(configFile)
+		if err != nil {
+			klog.Fatal(err)
+		}
+
+		run, _, err := cmd.Find(os.Args[1:])
+		if err != nil {
+			klog.Fatal(err)
+		}
+		if err := cfg.Apply(run.Flags()); err != nil {
+			klog.Fatal("config: ", err)
+		}
+	})
+
 	if err := cmd.Execute(); err != nil {
 		klog.Fatal(err)
 	}
@@ -67,10 +106,47 @@ func setupGlobal() (ctx context.Context) {
 	if len(*exportMetrics) != 0 {
 		prometheus.MustRegister(metrics.Kpng_k8s_api_events)
 		prometheus.MustRegister(metrics.Kpng_node_local_events)
+		prometheus.MustRegister(metrics.Kpng_filtered_services)
+		prometheus.MustRegister(metrics.Kpng_hidden_services)
+		prometheus.MustRegister(metrics.Kpng_endpoint_port_mismatches)
+		prometheus.MustRegister(metrics.Kpng_service_external_exposure_active)
+		prometheus.MustRegister(metrics.Kpng_namespace_quota_rejected_services)
+		prometheus.MustRegister(metrics.Kpng_store_divergences)
+		prometheus.MustRegister(metrics.Kpng_api_connection_state)
+		prometheus.MustRegister(metrics.Kpng_api_reconnects)
+		prometheus.MustRegister(metrics.Kpng_watch_queued_ops)
+		prometheus.MustRegister(metrics.Kpng_watch_coalesced_revisions)
+		prometheus.MustRegister(metrics.Kpng_dataplane_estimated_size)
+		prometheus.MustRegister(metrics.Kpng_dataplane_limit)
+		prometheus.MustRegister(metrics.Kpng_dataplane_headroom)
+		socketMode, err := strconv.ParseUint(*exportMetricsSocketMode, 8, 32)
+		if err != nil {
+			klog.Fatal("invalid --exportMetricsSocketMode: ", err)
+		}
+
 		klog.Infof("exporting metrics to: %v ", *exportMetrics)
-		metrics.StartMetricsServer(*exportMetrics, ctx.Done())
+		metrics.StartMetricsServer(*exportMetrics, metrics.ServerOptions{
+			SocketMode: os.FileMode(socketMode),
+			Debug:      *exportDebug,
+		}, ctx.Done())
+	}
+
+	shutdownTracing, err := traceConfig.Setup(ctx, "kpng")
+	if err != nil {
+		klog.Fatal("failed to setup tracing: ", err)
 	}
 
+	go func() {
+		<-ctx.Done()
+
+		// flush the last spans
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			klog.Error("failed to stop tracing: ", err)
+		}
+	}()
+
 	// handle exit signals
 	go func() {
 		proxy.WaitForTermSignal()
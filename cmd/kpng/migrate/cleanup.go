@@ -0,0 +1,326 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+// kubeIPVSInterface is the dummy interface kube-proxy's ipvs mode binds the service IPs to.
+const kubeIPVSInterface = "kube-ipvs0"
+
+// kubeProxyChains are the chains created by kube-proxy, in the iptables and ipvs modes.
+var kubeProxyChains = map[string]bool{
+	"KUBE-SERVICES":               true,
+	"KUBE-EXTERNAL-SERVICES":      true,
+	"KUBE-NODEPORTS":              true,
+	"KUBE-POSTROUTING":            true,
+	"KUBE-MARK-MASQ":              true,
+	"KUBE-FORWARD":                true,
+	"KUBE-PROXY-FIREWALL":         true,
+	"KUBE-PROXY-CANARY":           true,
+	"KUBE-LOAD-BALANCER":          true,
+	"KUBE-NODE-PORT":              true,
+	"KUBE-SOURCE-RANGES-FIREWALL": true,
+	"KUBE-IPVS-FILTER":            true,
+	"KUBE-IPVS-OUT-FILTER":        true,
+}
+
+// kubeProxyChainPrefixes are the prefixes of the chains created by kube-proxy for each service and endpoint.
+var kubeProxyChainPrefixes = []string{"KUBE-SVC-", "KUBE-SVL-", "KUBE-SEP-", "KUBE-FW-", "KUBE-XLB-", "KUBE-EXT-"}
+
+// isKubeProxyChain returns true if the chain of the table was created by kube-proxy. The kubelet's chains
+// (KUBE-MARK-DROP, KUBE-KUBELET-CANARY and KUBE-FIREWALL in the filter table) are kept.
+func isKubeProxyChain(table, chain string) bool {
+	if kubeProxyChains[chain] {
+		return true
+	}
+	if chain == "KUBE-FIREWALL" {
+		// the ipvs mode's, the filter table's one is the kubelet's
+		return table == "nat"
+	}
+	for _, prefix := range kubeProxyChainPrefixes {
+		if strings.HasPrefix(chain, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CleanupIPTablesSave returns the `iptables-restore --noflush` input removing kube-proxy's rules from the output of
+// `iptables-save`: in each table, the rules of the other chains jumping to kube-proxy's chains are deleted, then
+// kube-proxy's chains are flushed and deleted. It's nil if there's nothing to remove.
+func CleanupIPTablesSave(r io.Reader) ([]byte, error) {
+	type tableCleanup struct {
+		name   string
+		chains []string
+		jumps  []string
+	}
+
+	var (
+		tables []*tableCleanup
+		table  *tableCleanup
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(line, "*"):
+			table = &tableCleanup{name: line[1:]}
+			tables = append(tables, table)
+
+		case table == nil:
+			continue
+
+		case strings.HasPrefix(line, ":"):
+			chain := strings.Fields(line[1:])[0]
+			if isKubeProxyChain(table.name, chain) {
+				table.chains = append(table.chains, chain)
+			}
+
+		case strings.HasPrefix(line, "-A "):
+			args := splitArgs(line)
+			if len(args) < 2 || isKubeProxyChain(table.name, args[1]) {
+				continue // deleted with its chain
+			}
+			for i, arg := range args[:len(args)-1] {
+				if (arg == "-j" || arg == "-g") && isKubeProxyChain(table.name, args[i+1]) {
+					table.jumps = append(table.jumps, "-D"+line[2:])
+					break
+				}
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	for _, table := range tables {
+		if len(table.chains) == 0 && len(table.jumps) == 0 {
+			continue
+		}
+
+		sort.Strings(table.chains)
+
+		fmt.Fprintf(buf, "*%s\n", table.name)
+		for _, chain := range table.chains {
+			fmt.Fprintf(buf, ":%s - [0:0]\n", chain) // flushes the chain
+		}
+		for _, jump := range table.jumps {
+			buf.WriteString(jump + "\n")
+		}
+		for _, chain := range table.chains {
+			fmt.Fprintf(buf, "-X %s\n", chain)
+		}
+		buf.WriteString("COMMIT\n")
+	}
+
+	if buf.Len() == 0 {
+		return nil, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// KubeProxyIPSets returns the sets created by kube-proxy's ipvs mode (KUBE-*) in the output of `ipset list -n`.
+func KubeProxyIPSets(r io.Reader) (sets []string, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(name, "KUBE-") {
+			sets = append(sets, name)
+		}
+	}
+	return sets, scanner.Err()
+}
+
+// CleanupCmd returns the `cleanup` command.
+func CleanupCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "remove the rules left by kube-proxy on this node, before kpng takes over",
+		Long: `Removes kube-proxy's iptables chains (IPv4 and IPv6), IPVS virtual servers and ipsets from this node, so
+they don't conflict with the rules of kpng's backends. kube-proxy must be stopped first, or it restores them.
+
+The kubelet's chains (KUBE-MARK-DROP, KUBE-KUBELET-CANARY and the filter table's KUBE-FIREWALL) are kept. All the
+IPVS virtual servers are deleted, like kube-proxy's own cleanup.`,
+	}
+
+	c := &cleaner{out: os.Stdout}
+
+	flags := cmd.Flags()
+	flags.BoolVar(&c.iptables, "iptables", true, "remove kube-proxy's iptables and ip6tables chains")
+	flags.BoolVar(&c.ipvs, "ipvs", true, "remove the IPVS virtual servers and the "+kubeIPVSInterface+" interface")
+	flags.BoolVar(&c.ipsets, "ipsets", true, "destroy kube-proxy's ipsets (KUBE-*)")
+	flags.BoolVar(&c.dryRun, "dry-run", false, "print the commands instead of running them")
+
+	cmd.RunE = func(_ *cobra.Command, _ []string) error {
+		return c.run()
+	}
+
+	return cmd
+}
+
+type cleaner struct {
+	iptables, ipvs, ipsets bool
+	dryRun                 bool
+
+	out io.Writer
+}
+
+func (c *cleaner) run() error {
+	var errs []string
+	fail := func(err error) {
+		klog.Error(err)
+		errs = append(errs, err.Error())
+	}
+
+	if c.iptables {
+		for _, iptables := range []string{"iptables", "ip6tables"} {
+			if err := c.cleanupIPTables(iptables); err != nil {
+				fail(err)
+			}
+		}
+	}
+
+	if c.ipvs {
+		if err := c.cleanupIPVS(); err != nil {
+			fail(err)
+		}
+	}
+
+	// after the rules matching them
+	if c.ipsets {
+		if err := c.cleanupIPSets(); err != nil {
+			fail(err)
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (c *cleaner) cleanupIPTables(iptables string) error {
+	save, err := exec.Command(iptables + "-save").Output()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			klog.Warningf("%s-save not found, skipping %s", iptables, iptables)
+			return nil
+		}
+		return fmt.Errorf("%s-save failed: %w", iptables, err)
+	}
+
+	restore, err := CleanupIPTablesSave(bytes.NewReader(save))
+	if err != nil {
+		return err
+	}
+	if restore == nil {
+		klog.Infof("no kube-proxy chain in %s", iptables)
+		return nil
+	}
+
+	return c.apply(restore, iptables+"-restore", "--noflush")
+}
+
+func (c *cleaner) cleanupIPVS() error {
+	save, err := exec.Command("ipvsadm-save", "-n").Output()
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		klog.Warning("ipvsadm-save not found, skipping the IPVS virtual servers")
+	case err != nil:
+		return fmt.Errorf("ipvsadm-save failed: %w", err)
+	case len(bytes.TrimSpace(save)) == 0:
+		klog.Info("no IPVS virtual server")
+	default:
+		if err := c.apply(nil, "ipvsadm", "-C"); err != nil {
+			return err
+		}
+	}
+
+	if err := exec.Command("ip", "link", "show", kubeIPVSInterface).Run(); err != nil {
+		klog.Infof("no %s interface", kubeIPVSInterface)
+		return nil
+	}
+	return c.apply(nil, "ip", "link", "delete", kubeIPVSInterface)
+}
+
+func (c *cleaner) cleanupIPSets() error {
+	list, err := exec.Command("ipset", "list", "-n").Output()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			klog.Warning("ipset not found, skipping the ipsets")
+			return nil
+		}
+		return fmt.Errorf("ipset list failed: %w", err)
+	}
+
+	sets, err := KubeProxyIPSets(bytes.NewReader(list))
+	if err != nil {
+		return err
+	}
+	if len(sets) == 0 {
+		klog.Info("no kube-proxy ipset")
+		return nil
+	}
+
+	// destroyed with one ipset restore
+	input := &bytes.Buffer{}
+	for _, set := range sets {
+		fmt.Fprintf(input, "destroy %s\n", set)
+	}
+	return c.apply(input.Bytes(), "ipset", "restore")
+}
+
+// apply runs the command changing the node, or prints it in dry run.
+func (c *cleaner) apply(stdin []byte, name string, args ...string) error {
+	cmdLine := strings.Join(append([]string{name}, args...), " ")
+
+	if c.dryRun {
+		fmt.Fprintf(c.out, "# %s\n", cmdLine)
+		c.out.Write(stdin)
+		return nil
+	}
+
+	klog.Info("running ", cmdLine)
+
+	cmd := exec.Command(name, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", cmdLine, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
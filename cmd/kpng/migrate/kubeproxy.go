@@ -0,0 +1,256 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migrate
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+)
+
+// VIP is a virtual IP and port programmed for a service, ie "tcp/10.96.0.1:443".
+type VIP string
+
+func newVIP(protocol, ip string, port string) VIP {
+	return VIP(strings.ToLower(protocol) + "/" + net.JoinHostPort(ip, port))
+}
+
+// State maps the programmed VIPs to their (sorted) endpoints.
+type State map[VIP][]string
+
+func (s State) add(vip VIP, endpoints ...string) {
+	s[vip] = append(s[vip], endpoints...)
+}
+
+func (s State) sort() {
+	for vip, eps := range s {
+		sort.Strings(eps)
+		s[vip] = uniq(eps)
+	}
+}
+
+func uniq(values []string) []string {
+	out := values[:0]
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// ParseIPTablesSave reads the state programmed by kube-proxy's iptables mode from the output of `iptables-save -t nat`.
+// The VIPs are the destinations of the KUBE-SERVICES chain, their endpoints the DNAT destinations reachable from them.
+func ParseIPTablesSave(r io.Reader) (State, error) {
+	type rule struct {
+		jump string
+		dnat string
+	}
+
+	type serviceRule struct {
+		vip   VIP
+		chain string
+	}
+
+	chains := map[string][]rule{}
+	services := []serviceRule{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "-A ") {
+			continue
+		}
+
+		args := splitArgs(line)
+		if len(args) < 2 {
+			continue
+		}
+
+		chain := args[1]
+		opts := parseOpts(args[2:])
+
+		if chain == "KUBE-SERVICES" {
+			dst, proto, port, jump := opts["-d"], opts["-p"], opts["--dport"], opts["-j"]
+			if dst == "" || proto == "" || port == "" || !strings.HasPrefix(jump, "KUBE-") || strings.HasPrefix(jump, "KUBE-MARK-") {
+				continue
+			}
+			ip := strings.SplitN(dst, "/", 2)[0]
+			services = append(services, serviceRule{vip: newVIP(proto, ip, port), chain: jump})
+			continue
+		}
+
+		chains[chain] = append(chains[chain], rule{jump: opts["-j"], dnat: opts["--to-destination"]})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// resolve the endpoints of a chain, following the jumps
+	var resolve func(chain string, visited map[string]bool) []string
+	resolve = func(chain string, visited map[string]bool) (endpoints []string) {
+		if visited[chain] {
+			return
+		}
+		visited[chain] = true
+
+		for _, r := range chains[chain] {
+			switch {
+			case r.jump == "DNAT" && r.dnat != "":
+				endpoints = append(endpoints, r.dnat)
+			case strings.HasPrefix(r.jump, "KUBE-") && !strings.HasPrefix(r.jump, "KUBE-MARK-"):
+				endpoints = append(endpoints, resolve(r.jump, visited)...)
+			}
+		}
+		return
+	}
+
+	state := State{}
+	for _, svc := range services {
+		state.add(svc.vip, resolve(svc.chain, map[string]bool{})...)
+	}
+	state.sort()
+
+	return state, nil
+}
+
+// ParseIPVSAdmSave reads the state programmed by kube-proxy's ipvs mode from the output of `ipvsadm-save -n`.
+func ParseIPVSAdmSave(r io.Reader) (State, error) {
+	state := State{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		args := splitArgs(scanner.Text())
+		if len(args) < 3 {
+			continue
+		}
+
+		var proto string
+		switch args[1] {
+		case "-t", "--tcp-service":
+			proto = "tcp"
+		case "-u", "--udp-service":
+			proto = "udp"
+		case "--sctp-service":
+			proto = "sctp"
+		default:
+			continue // ie: firewall marks
+		}
+
+		ip, port, err := net.SplitHostPort(args[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid virtual server %q: %w", args[2], err)
+		}
+		vip := newVIP(proto, ip, port)
+
+		switch args[0] {
+		case "-A":
+			state.add(vip)
+
+		case "-a":
+			opts := parseOpts(args[3:])
+			dst := opts["-r"]
+			if dst == "" {
+				continue
+			}
+			if opts["-w"] == "0" {
+				continue // draining
+			}
+			ip, port, err := net.SplitHostPort(dst)
+			if err != nil {
+				return nil, fmt.Errorf("invalid real server %q: %w", dst, err)
+			}
+			state.add(vip, net.JoinHostPort(ip, port))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	state.sort()
+	return state, nil
+}
+
+// splitArgs splits a command line, honoring double quotes.
+func splitArgs(line string) (args []string) {
+	b := &strings.Builder{}
+	inQuotes, inArg := false, false
+
+	for _, c := range line {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			inArg = true
+		case (c == ' ' || c == '\t') && !inQuotes:
+			if inArg {
+				args = append(args, b.String())
+				b.Reset()
+				inArg = false
+			}
+		default:
+			b.WriteRune(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, b.String())
+	}
+	return
+}
+
+// parseOpts returns the value of each option (first one wins), ignoring negated options.
+func parseOpts(args []string) map[string]string {
+	opts := map[string]string{}
+
+	negated := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "!" {
+			negated = true
+			continue
+		}
+
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		value := ""
+		if i+1 < len(args) && args[i+1] != "!" && !strings.HasPrefix(args[i+1], "-") {
+			value = args[i+1]
+			i++
+		}
+
+		if negated {
+			negated = false
+			continue
+		}
+
+		if _, ok := opts[arg]; !ok {
+			opts[arg] = value
+		}
+	}
+
+	return opts
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package migrate helps moving nodes from kube-proxy to kpng.
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+
+	"sigs.k8s.io/kpng/client"
+	"sigs.k8s.io/kpng/client/localsink"
+	"sigs.k8s.io/kpng/client/localsink/fullstate"
+)
+
+// Cmd returns the `migrate` command.
+func Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "tools to migrate nodes from kube-proxy to kpng",
+	}
+
+	cmd.AddCommand(inspectCmd())
+
+	return cmd
+}
+
+func inspectCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect",
+		Short: "report the delta between the node's kube-proxy state and what kpng would program",
+		Long: `Reads the state programmed by kube-proxy on this node (iptables or ipvs mode), maps it to
+kpng's model and compares it with the node's state from the kpng API. The report is written as
+JSON on stdout; the command fails if the states differ, so it can gate a node's migration.
+
+Only cluster IPs are compared: external IPs, load-balancer IPs and node ports are ignored.`,
+	}
+
+	flags := cmd.Flags()
+
+	var (
+		mode   string
+		input  string
+		strict bool
+	)
+
+	flags.StringVar(&mode, "mode", "iptables", "kube-proxy mode to read the state of (iptables or ipvs)")
+	flags.StringVar(&input, "input", "", "read the output of iptables-save/ipvsadm-save from this file instead of running it (- for stdin)")
+	flags.BoolVar(&strict, "strict", true, "exit with an error when the states differ")
+
+	epc := client.New(flags)
+
+	config := &localsink.Config{}
+	config.BindFlags(flags)
+
+	cmd.RunE = func(_ *cobra.Command, _ []string) error {
+		current, err := readKubeProxyState(mode, input)
+		if err != nil {
+			return err
+		}
+
+		var items []*client.ServiceEndpoints
+
+		sink := fullstate.New(config)
+		sink.Callback = fullstate.ArrayCallback(func(seps []*client.ServiceEndpoints) {
+			items = append(items[:0], seps...)
+		})
+
+		epc.Sink = sink
+		if canceled := epc.Next(); canceled {
+			return fmt.Errorf("failed to get the node's state from %s", epc.Target)
+		}
+		epc.Cancel()
+
+		expected, ignore := Expected(items)
+
+		report := Compare(config.NodeName, mode, current, expected, ignore)
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+
+		if strict && !report.Ready {
+			return fmt.Errorf("node %s: %d of %d VIPs differ", report.Node, report.Compared-report.Matching, report.Compared)
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+func readKubeProxyState(mode, input string) (State, error) {
+	var (
+		parse func(io.Reader) (State, error)
+		args  []string
+	)
+
+	switch mode {
+	case "iptables":
+		parse, args = ParseIPTablesSave, []string{"iptables-save", "-t", "nat"}
+	case "ipvs":
+		parse, args = ParseIPVSAdmSave, []string{"ipvsadm-save", "-n"}
+	default:
+		return nil, fmt.Errorf("unknown mode %q (expected iptables or ipvs)", mode)
+	}
+
+	switch input {
+	case "":
+		out, err := exec.Command(args[0], args[1:]...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("%s failed: %w", args[0], err)
+		}
+		return parse(bytes.NewReader(out))
+
+	case "-":
+		return parse(os.Stdin)
+
+	default:
+		f, err := os.Open(input)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parse(f)
+	}
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client"
+)
+
+const iptablesSave = `# Generated by iptables-save
+*nat
+:KUBE-SERVICES - [0:0]
+-A KUBE-SERVICES ! -s 10.244.0.0/16 -d 10.96.0.1/32 -p tcp -m comment --comment "default/kubernetes:https cluster IP" -m tcp --dport 443 -j KUBE-MARK-MASQ
+-A KUBE-SERVICES -d 10.96.0.1/32 -p tcp -m comment --comment "default/kubernetes:https cluster IP" -m tcp --dport 443 -j KUBE-SVC-NPX46M4PTMTKRN6Y
+-A KUBE-SERVICES -d 10.96.0.10/32 -p udp -m comment --comment "kube-system/kube-dns:dns cluster IP" -m udp --dport 53 -j KUBE-SVC-TCOU7JCQXEZGVUNU
+-A KUBE-SERVICES -d 192.168.1.10/32 -p tcp -m comment --comment "default/web:http external IP" -m tcp --dport 80 -j KUBE-EXT-WEB
+-A KUBE-SERVICES -m comment --comment "kubernetes service nodeports" -m addrtype --dst-type LOCAL -j KUBE-NODEPORTS
+-A KUBE-SVC-NPX46M4PTMTKRN6Y -m comment --comment "default/kubernetes:https" -j KUBE-SEP-A
+-A KUBE-SEP-A -s 172.18.0.2/32 -m comment --comment "default/kubernetes:https" -j KUBE-MARK-MASQ
+-A KUBE-SEP-A -p tcp -m comment --comment "default/kubernetes:https" -m tcp -j DNAT --to-destination 172.18.0.2:6443
+-A KUBE-SVC-TCOU7JCQXEZGVUNU -m comment --comment "kube-system/kube-dns:dns" -m statistic --mode random --probability 0.50000000000 -j KUBE-SEP-B
+-A KUBE-SVC-TCOU7JCQXEZGVUNU -m comment --comment "kube-system/kube-dns:dns" -j KUBE-SEP-C
+-A KUBE-SEP-B -p udp -m comment --comment "kube-system/kube-dns:dns" -m udp -j DNAT --to-destination 10.244.0.2:53
+-A KUBE-SEP-C -p udp -m comment --comment "kube-system/kube-dns:dns" -m udp -j DNAT --to-destination 10.244.0.3:53
+COMMIT
+`
+
+const ipvsadmSave = `-A -t 10.96.0.1:443 -s rr
+-a -t 10.96.0.1:443 -r 172.18.0.2:6443 -m -w 1
+-A -u 10.96.0.10:53 -s rr
+-a -u 10.96.0.10:53 -r 10.244.0.2:53 -m -w 1
+-a -u 10.96.0.10:53 -r 10.244.0.3:53 -m -w 1
+-a -u 10.96.0.10:53 -r 10.244.0.4:53 -m -w 0
+-A -t 172.18.0.5:30080 -s rr
+-a -t 172.18.0.5:30080 -r 10.244.0.7:8080 -m -w 1
+`
+
+func TestParseIPTablesSave(t *testing.T) {
+	state, err := ParseIPTablesSave(strings.NewReader(iptablesSave))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkState(t, state, map[VIP]string{
+		"tcp/10.96.0.1:443":   "172.18.0.2:6443",
+		"udp/10.96.0.10:53":   "10.244.0.2:53,10.244.0.3:53",
+		"tcp/192.168.1.10:80": "",
+	})
+}
+
+func TestParseIPVSAdmSave(t *testing.T) {
+	state, err := ParseIPVSAdmSave(strings.NewReader(ipvsadmSave))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkState(t, state, map[VIP]string{
+		"tcp/10.96.0.1:443":    "172.18.0.2:6443",
+		"udp/10.96.0.10:53":    "10.244.0.2:53,10.244.0.3:53",
+		"tcp/172.18.0.5:30080": "10.244.0.7:8080",
+	})
+}
+
+func checkState(t *testing.T, state State, expected map[VIP]string) {
+	t.Helper()
+
+	if len(state) != len(expected) {
+		t.Errorf("expected %d VIPs, got %d: %v", len(expected), len(state), state)
+	}
+
+	for vip, eps := range expected {
+		if got := strings.Join(state[vip], ","); got != eps {
+			t.Errorf("%s: expected endpoints %q, got %q", vip, eps, got)
+		}
+	}
+}
+
+func ExampleCompare() {
+	current, _ := ParseIPVSAdmSave(strings.NewReader(ipvsadmSave))
+
+	items := []*client.ServiceEndpoints{
+		{
+			Service: &localnetv1.Service{
+				Namespace: "default",
+				Name:      "kubernetes",
+				IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.96.0.1")},
+				Ports:     []*localnetv1.PortMapping{{Protocol: localnetv1.Protocol_TCP, Port: 443, TargetPort: 6443}},
+			},
+			Endpoints: []*localnetv1.Endpoint{{IPs: localnetv1.NewIPSet("172.18.0.2")}},
+		},
+		{
+			Service: &localnetv1.Service{
+				Namespace: "kube-system",
+				Name:      "kube-dns",
+				IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.96.0.10")},
+				Ports:     []*localnetv1.PortMapping{{Protocol: localnetv1.Protocol_UDP, Port: 53, TargetPort: 53}},
+			},
+			Endpoints: []*localnetv1.Endpoint{{IPs: localnetv1.NewIPSet("10.244.0.2")}},
+		},
+		{
+			Service: &localnetv1.Service{
+				Namespace: "default",
+				Name:      "web",
+				IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.96.0.80")},
+				Ports:     []*localnetv1.PortMapping{{Protocol: localnetv1.Protocol_TCP, Port: 80, NodePort: 30080, TargetPort: 8080}},
+			},
+		},
+	}
+
+	expected, ignore := Expected(items)
+
+	report := Compare("node-a", "ipvs", current, expected, ignore)
+
+	out, _ := json.Marshal(report)
+	fmt.Println(string(out))
+
+	// Output:
+	// {"node":"node-a","source":"ipvs","compared":3,"matching":1,"onlyInKubeProxy":[],"onlyInKpng":["tcp/10.96.0.80:80"],"endpointMismatches":[{"vip":"udp/10.96.0.10:53","kubeProxy":["10.244.0.2:53","10.244.0.3:53"],"kpng":["10.244.0.2:53"]}],"ready":false}
+}
+
+func TestCleanupIPTablesSave(t *testing.T) {
+	save := `# Generated by iptables-save
+*mangle
+:PREROUTING ACCEPT [0:0]
+:KUBE-KUBELET-CANARY - [0:0]
+:KUBE-PROXY-CANARY - [0:0]
+COMMIT
+*nat
+:PREROUTING ACCEPT [0:0]
+:OUTPUT ACCEPT [0:0]
+:POSTROUTING ACCEPT [0:0]
+:KUBE-MARK-DROP - [0:0]
+:KUBE-MARK-MASQ - [0:0]
+:KUBE-POSTROUTING - [0:0]
+:KUBE-SERVICES - [0:0]
+:KUBE-SVC-NPX46M4PTMTKRN6Y - [0:0]
+:KUBE-SEP-A - [0:0]
+:CNI-HOSTPORT-DNAT - [0:0]
+-A PREROUTING -m comment --comment "kubernetes service portals" -j KUBE-SERVICES
+-A PREROUTING -m addrtype --dst-type LOCAL -j CNI-HOSTPORT-DNAT
+-A OUTPUT -m comment --comment "kubernetes service portals" -j KUBE-SERVICES
+-A POSTROUTING -m comment --comment "kubernetes postrouting rules" -j KUBE-POSTROUTING
+-A KUBE-MARK-DROP -j MARK --set-xmark 0x8000/0x8000
+-A KUBE-SERVICES -d 10.96.0.1/32 -p tcp -m tcp --dport 443 -j KUBE-SVC-NPX46M4PTMTKRN6Y
+-A KUBE-SVC-NPX46M4PTMTKRN6Y -j KUBE-SEP-A
+-A KUBE-SEP-A -p tcp -m tcp -j DNAT --to-destination 172.18.0.2:6443
+COMMIT
+*filter
+:INPUT ACCEPT [0:0]
+:KUBE-FIREWALL - [0:0]
+-A INPUT -j KUBE-FIREWALL
+COMMIT
+`
+
+	expected := `*mangle
+:KUBE-PROXY-CANARY - [0:0]
+-X KUBE-PROXY-CANARY
+COMMIT
+*nat
+:KUBE-MARK-MASQ - [0:0]
+:KUBE-POSTROUTING - [0:0]
+:KUBE-SEP-A - [0:0]
+:KUBE-SERVICES - [0:0]
+:KUBE-SVC-NPX46M4PTMTKRN6Y - [0:0]
+-D PREROUTING -m comment --comment "kubernetes service portals" -j KUBE-SERVICES
+-D OUTPUT -m comment --comment "kubernetes service portals" -j KUBE-SERVICES
+-D POSTROUTING -m comment --comment "kubernetes postrouting rules" -j KUBE-POSTROUTING
+-X KUBE-MARK-MASQ
+-X KUBE-POSTROUTING
+-X KUBE-SEP-A
+-X KUBE-SERVICES
+-X KUBE-SVC-NPX46M4PTMTKRN6Y
+COMMIT
+`
+
+	restore, err := CleanupIPTablesSave(strings.NewReader(save))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(restore) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, restore)
+	}
+
+	// the kubelet's chains only
+	restore, err = CleanupIPTablesSave(strings.NewReader("*filter\n:INPUT ACCEPT [0:0]\n:KUBE-FIREWALL - [0:0]\n-A INPUT -j KUBE-FIREWALL\nCOMMIT\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restore != nil {
+		t.Errorf("expected nothing to remove, got:\n%s", restore)
+	}
+}
+
+func TestKubeProxyIPSets(t *testing.T) {
+	sets, err := KubeProxyIPSets(strings.NewReader("KUBE-CLUSTER-IP\nKPNG-SRC-ABCD\nKUBE-6-CLUSTER-IP\ncali40all-hosts-net\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"KUBE-CLUSTER-IP", "KUBE-6-CLUSTER-IP"}; fmt.Sprint(sets) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, sets)
+	}
+}
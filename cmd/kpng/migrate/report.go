@@ -0,0 +1,219 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migrate
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/kpng/client"
+)
+
+// Report is the delta between the state programmed by kube-proxy and the state kpng would program on a node.
+type Report struct {
+	Node   string `json:"node"`
+	Source string `json:"source"`
+
+	// Compared is the number of VIPs found on either side.
+	Compared int `json:"compared"`
+	// Matching is the number of VIPs with the same endpoints on both sides.
+	Matching int `json:"matching"`
+
+	// OnlyInKubeProxy are the VIPs kpng would not program.
+	OnlyInKubeProxy []VIP `json:"onlyInKubeProxy"`
+	// OnlyInKpng are the VIPs kube-proxy did not program.
+	OnlyInKpng []VIP `json:"onlyInKpng"`
+	// EndpointMismatches are the VIPs programmed on both sides with different endpoints.
+	EndpointMismatches []EndpointMismatch `json:"endpointMismatches"`
+
+	// Ready is true when kpng would program exactly what kube-proxy did.
+	Ready bool `json:"ready"`
+}
+
+type EndpointMismatch struct {
+	VIP       VIP      `json:"vip"`
+	KubeProxy []string `json:"kubeProxy"`
+	Kpng      []string `json:"kpng"`
+}
+
+// Expected computes the cluster IP VIPs kpng would program from the node's local state. It also returns the
+// VIPs kube-proxy programs for other purposes (external and load-balancer IPs, node ports) to exclude them
+// from the comparison: their endpoints depend on the traffic policies and are not comparable as-is.
+func Expected(items []*client.ServiceEndpoints) (expected State, ignore func(VIP) bool) {
+	expected = State{}
+
+	ignoredIPs := map[string]bool{}
+	ignoredPorts := map[string]bool{}
+
+	for _, item := range items {
+		svc := item.Service
+		if svc.IPs == nil {
+			continue
+		}
+
+		for _, ip := range svc.IPs.ExternalIPs.All() {
+			ignoredIPs[ip] = true
+		}
+		for _, ip := range svc.IPs.LoadBalancerIPs.All() {
+			ignoredIPs[ip] = true
+		}
+
+		for _, port := range svc.Ports {
+			protocol := port.Protocol.String()
+			portStr := strconv.Itoa(int(port.Port))
+
+			if port.NodePort != 0 {
+				ignoredPorts[newVIP(protocol, "", strconv.Itoa(int(port.NodePort))).port()] = true
+			}
+
+			for _, clusterIP := range svc.IPs.ClusterIPs.All() {
+				vip := newVIP(protocol, clusterIP, portStr)
+				expected.add(vip)
+
+				isV4 := net.ParseIP(clusterIP).To4() != nil
+
+				for _, ep := range item.Endpoints {
+					if ep.Scopes != nil && !ep.Scopes.Internal {
+						continue
+					}
+
+					targetPort := ep.PortMapping(port)
+					if targetPort == 0 {
+						continue
+					}
+
+					epIPs := ep.IPs.GetV6()
+					if isV4 {
+						epIPs = ep.IPs.GetV4()
+					}
+
+					for _, epIP := range epIPs {
+						expected.add(vip, net.JoinHostPort(epIP, strconv.Itoa(int(targetPort))))
+					}
+				}
+			}
+		}
+	}
+
+	expected.sort()
+
+	ignore = func(vip VIP) bool {
+		if _, ok := expected[vip]; ok {
+			return false
+		}
+		return ignoredIPs[vip.ip()] || ignoredPorts[vip.port()]
+	}
+
+	return
+}
+
+// Compare builds the report of the delta from the current kube-proxy state to the expected kpng state.
+func Compare(node, source string, current, expected State, ignore func(VIP) bool) (report Report) {
+	report = Report{
+		Node:               node,
+		Source:             source,
+		OnlyInKubeProxy:    []VIP{},
+		OnlyInKpng:         []VIP{},
+		EndpointMismatches: []EndpointMismatch{},
+	}
+
+	for vip, currentEPs := range current {
+		if ignore != nil && ignore(vip) {
+			continue
+		}
+
+		report.Compared++
+
+		expectedEPs, ok := expected[vip]
+		if !ok {
+			report.OnlyInKubeProxy = append(report.OnlyInKubeProxy, vip)
+			continue
+		}
+
+		if !equal(currentEPs, expectedEPs) {
+			report.EndpointMismatches = append(report.EndpointMismatches, EndpointMismatch{
+				VIP:       vip,
+				KubeProxy: nonNil(currentEPs),
+				Kpng:      nonNil(expectedEPs),
+			})
+			continue
+		}
+
+		report.Matching++
+	}
+
+	for vip := range expected {
+		if _, ok := current[vip]; !ok {
+			report.Compared++
+			report.OnlyInKpng = append(report.OnlyInKpng, vip)
+		}
+	}
+
+	sortVIPs(report.OnlyInKubeProxy)
+	sortVIPs(report.OnlyInKpng)
+	sort.Slice(report.EndpointMismatches, func(i, j int) bool {
+		return report.EndpointMismatches[i].VIP < report.EndpointMismatches[j].VIP
+	})
+
+	report.Ready = report.Matching == report.Compared
+
+	return
+}
+
+// ip returns the IP of the VIP.
+func (v VIP) ip() string {
+	_, hostPort := v.split()
+	host, _, _ := net.SplitHostPort(hostPort)
+	return host
+}
+
+// port returns the protocol and port of the VIP, ie "tcp/443".
+func (v VIP) port() string {
+	protocol, hostPort := v.split()
+	_, port, _ := net.SplitHostPort(hostPort)
+	return protocol + "/" + port
+}
+
+func (v VIP) split() (protocol, hostPort string) {
+	protocol, hostPort, _ = strings.Cut(string(v), "/")
+	return
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func sortVIPs(vips []VIP) {
+	sort.Slice(vips, func(i, j int) bool { return vips[i] < vips[j] })
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"sigs.k8s.io/kpng/server/pkg/metrics"
+)
+
+func queryCmd() *cobra.Command {
+	var (
+		address string
+		timeout time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "query <path>",
+		Short: "query an endpoint of a running kpng's metrics server (ie: /healthz, /metrics or /debug/pprof/)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			return metrics.Query(ctx, address, args[0], os.Stdout)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&address, "address", "127.0.0.1:9090", "address of the metrics server, IP:PORT or unix:///path/to/socket (see --exportMetrics)")
+	flags.DurationVar(&timeout, "timeout", 10*time.Second, "timeout of the query")
+
+	return cmd
+}
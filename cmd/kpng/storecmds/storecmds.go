@@ -19,15 +19,31 @@ package storecmds
 import (
 	"context"
 	"errors"
+	"net/http"
 
 	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
 
+	_ "sigs.k8s.io/kpng/backends/api"
+	_ "sigs.k8s.io/kpng/backends/dns"
+	_ "sigs.k8s.io/kpng/backends/file"
+	"sigs.k8s.io/kpng/client/audit"
 	"sigs.k8s.io/kpng/client/backendcmd"
+	"sigs.k8s.io/kpng/client/capacity"
+	"sigs.k8s.io/kpng/client/cleanup"
+	"sigs.k8s.io/kpng/client/health"
+	"sigs.k8s.io/kpng/client/inspect"
 	"sigs.k8s.io/kpng/client/localsink"
+	"sigs.k8s.io/kpng/client/readiness"
+	"sigs.k8s.io/kpng/client/resync"
+	"sigs.k8s.io/kpng/client/tracing"
 
+	"sigs.k8s.io/kpng/server/jobs/api2local"
 	"sigs.k8s.io/kpng/server/jobs/store2api"
+	"sigs.k8s.io/kpng/server/jobs/store2crd"
 	"sigs.k8s.io/kpng/server/jobs/store2file"
 	"sigs.k8s.io/kpng/server/jobs/store2localdiff"
+	"sigs.k8s.io/kpng/server/pkg/metrics"
 	"sigs.k8s.io/kpng/server/proxystore"
 )
 
@@ -37,6 +53,7 @@ func Commands(setup SetupFunc) []*cobra.Command {
 	return []*cobra.Command{
 		setup.ToAPICmd(),
 		setup.ToFileCmd(),
+		setup.ToCRDCmd(),
 		setup.ToLocalCmd(),
 	}
 }
@@ -90,6 +107,31 @@ func (c SetupFunc) ToFileCmd() *cobra.Command {
 	return cmd
 }
 
+func (c SetupFunc) ToCRDCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "to-crd",
+		Short: "mirror the global state to ServiceState custom resources",
+	}
+
+	cfg := &store2crd.Config{}
+	cfg.BindFlags(cmd.Flags())
+
+	cmd.RunE = func(_ *cobra.Command, _ []string) (err error) {
+		ctx, store, err := c()
+		if err != nil {
+			return
+		}
+
+		j := &store2crd.Job{
+			Store:  store,
+			Config: cfg,
+		}
+		return j.Run(ctx)
+	}
+
+	return cmd
+}
+
 // ToLocalCmd sends the incoming events to a local backend, such as IPVS or IPTABLES or NFT.
 // This gives users an out of the box KPNG implementation.
 func (c SetupFunc) ToLocalCmd() (cmd *cobra.Command) {
@@ -100,6 +142,9 @@ func (c SetupFunc) ToLocalCmd() (cmd *cobra.Command) {
 	var ctx context.Context
 	job := &store2localdiff.Job{}
 
+	cmd.PersistentFlags().StringSliceVar(&job.ServiceTypes, "service-types", nil, "only send services of these types (ClusterIP, NodePort, LoadBalancer); all types if empty")
+	cmd.PersistentFlags().IntVar(&job.MaxEndpointsPerService, "max-endpoints-per-service", 0, "max number of endpoints of a service sent to the backend, a consistent subset for the node (unlimited if 0)")
+
 	cmd.PersistentPreRunE = func(_ *cobra.Command, _ []string) (err error) {
 		ctx, job.Store, err = c()
 		return
@@ -116,21 +161,152 @@ func (c SetupFunc) ToLocalCmd() (cmd *cobra.Command) {
 func LocalCmds(run func(sink localsink.Sink) error) (cmds []*cobra.Command) {
 	// sink backends
 	for _, useCmd := range backendcmd.Registered() {
-		backend := useCmd.New()
+		cmds = append(cmds, localCmd(useCmd.Use, useCmd.New(), run))
+	}
 
-		cmd := &cobra.Command{
-			Use: useCmd.Use,
-			RunE: func(_ *cobra.Command, _ []string) error {
-				return run(backend.Sink())
-			},
-		}
+	// all of them, combined
+	cmds = append(cmds, localCmd("to-multi", backendcmd.NewMulti(backendcmd.Registered()), run))
+
+	return
+}
 
-		backend.BindFlags(cmd.Flags())
+func localCmd(use string, backend backendcmd.Cmd, run func(sink localsink.Sink) error) *cobra.Command {
+	readyConfig := &readiness.Config{}
+	auditConfig := &audit.Config{}
+	healthConfig := &health.Config{}
+	capacityConfig := &capacity.Config{}
+	cleanupConfig := &cleanup.Config{}
 
-		cmds = append(cmds, cmd)
+	cmd := &cobra.Command{
+		Use: use,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if err := cleanupConfig.Validate(); err != nil {
+				return err
+			}
+
+			gate := readiness.NewGate(readyConfig)
+
+			// the syncs of each backend, on /healthz and /readyz (on the metrics server, see --exportMetrics)
+			backends := []string{use}
+			multi, isMulti := backend.(*backendcmd.Multi)
+			if isMulti {
+				backends = multi.Backends()
+			}
+
+			checker := health.NewChecker(healthConfig, backends...)
+			checker.Connection = api2local.ConnectionState
+			metrics.SetHealthChecks(http.HandlerFunc(checker.ServeHealthz), http.HandlerFunc(checker.ServeReadyz))
+
+			if isMulti {
+				multi.WrapSink = checker.WrapBackend
+			}
+
+			sink := backend.Sink()
+			applied := gate.Ready
+
+			strict, isStrict := backend.(backendcmd.StrictReadiness)
+
+			if !isMulti {
+				if isStrict {
+					applied = func() {
+						checker.Synced(use)
+						gate.Ready()
+					}
+				} else {
+					sink = checker.Sink(use, sink)
+				}
+			}
+
+			if auditConfig.File != "" {
+				auditFile, err := audit.OpenFile(auditConfig.File)
+				if err != nil {
+					return err
+				}
+				defer auditFile.Close()
+
+				auditSink := audit.NewLocalSink(sink, auditFile)
+				if isStrict {
+					auditSink.WaitApplied = true
+
+					next := applied
+					applied = func() {
+						auditSink.Applied()
+						next()
+					}
+				}
+				sink = auditSink
+			}
+
+			if isStrict {
+				// the revisions published in the node's annotations (kpng local --annotate-node) are the applied ones
+				api2local.WaitBackendApplied()
+
+				next := applied
+				applied = func() {
+					api2local.BackendApplied()
+					next()
+				}
+
+				strict.OnApplied(applied)
+			} else {
+				sink = readiness.Sink(sink, gate)
+			}
+
+			if reporter, ok := backend.(backendcmd.ServiceFailures); ok {
+				// published in the node's annotations by the agent (kpng local --annotate-node)
+				reporter.OnServiceFailures(api2local.SetServiceFailures)
+			}
+
+			if estimator, ok := backend.(backendcmd.CapacityEstimator); ok && capacityConfig.Enabled() {
+				if err := capacityConfig.Validate(); err != nil {
+					return err
+				}
+
+				capacitySink := capacity.NewSink(capacityConfig, estimator.Capacity, sink)
+				capacitySink.OnEstimate = metrics.SetDataplaneEstimates
+				sink = capacitySink
+			}
+
+			sink = checker.ReceiverSink(sink)
+
+			// the state received, for kpngctl (on the metrics server, see --exportMetrics)
+			inspectSink := inspect.NewSink(sink)
+			if counter, ok := backend.(backendcmd.ObjectCounter); ok {
+				inspectSink.Objects = counter.ProgrammedObjects
+			}
+			metrics.Handle(inspect.Path, inspectSink)
+
+			// on-demand full resyncs, for kpngctl resync (on the metrics server, see --exportMetrics)
+			if resyncer, ok := backend.(backendcmd.Resyncer); ok {
+				metrics.Handle(resync.Path, resync.NewHandler(resyncer.Resync))
+			}
+
+			// traced as children of the brain's diffs (see --otlp-endpoint)
+			err := run(tracing.Sink(inspectSink))
+
+			// terminating, the dataplane is retained or flushed (see --cleanup-on-exit)
+			var flush func() error
+			if cleaner, ok := backend.(backendcmd.Cleaner); ok {
+				flush = cleaner.Cleanup
+			}
+			if cleanupErr := cleanupConfig.OnExit(use, flush); cleanupErr != nil {
+				klog.Error(cleanupErr)
+			}
+
+			return err
+		},
 	}
 
-	return
+	backend.BindFlags(cmd.Flags())
+	readyConfig.BindFlags(cmd.Flags())
+	auditConfig.BindFlags(cmd.Flags())
+	healthConfig.BindFlags(cmd.Flags())
+	cleanupConfig.BindFlags(cmd.Flags())
+	if _, ok := backend.(backendcmd.CapacityEstimator); ok {
+		capacityConfig.BindFlags(cmd.Flags())
+	}
+
+	return cmd
 }
 
 func unimplemented(_ *cobra.Command, _ []string) error {
@@ -0,0 +1,228 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kpngctl inspects a running kpng: the state received by a node agent, the changes of its last change set and the
+// objects programmed by its backend, or the state the server sends to a node. It can also force a full resync of the
+// node agent's backend.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"sigs.k8s.io/kpng/client"
+	"sigs.k8s.io/kpng/client/inspect"
+	"sigs.k8s.io/kpng/client/localsink"
+	"sigs.k8s.io/kpng/client/localsink/fullstate"
+	"sigs.k8s.io/kpng/client/resync"
+	"sigs.k8s.io/kpng/server/pkg/metrics"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+var (
+	agent   string
+	output  string
+	timeout time.Duration
+)
+
+func main() {
+	cmd := &cobra.Command{
+		Use:          "kpngctl",
+		Short:        "inspect a running kpng",
+		SilenceUsage: true,
+		PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+			if output != outputTable && output != outputJSON {
+				return fmt.Errorf("invalid output %q (expected %s or %s)", output, outputTable, outputJSON)
+			}
+			return nil
+		},
+	}
+
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&agent, "agent", "127.0.0.1:9090", "metrics server of the node agent, IP:PORT or unix:///path/to/socket (see --exportMetrics)")
+	flags.StringVarP(&output, "output", "o", outputTable, "output format: "+outputTable+" or "+outputJSON)
+	flags.DurationVar(&timeout, "timeout", 10*time.Second, "timeout of the requests")
+
+	cmd.AddCommand(servicesCmd(), changesCmd(), objectsCmd(), resyncCmd())
+
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func servicesCmd() *cobra.Command {
+	var (
+		fromAPI  bool
+		nodeName string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "services",
+		Short: "dump the services and endpoints received by the node agent (or sent by the server with --from-api)",
+		Args:  cobra.NoArgs,
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVar(&fromAPI, "from-api", false, "read the state the server (see --api) sends to --node-name instead of the agent's")
+	flags.StringVar(&nodeName, "node-name", func() string { s, _ := os.Hostname(); return s }(), "node to request the state of, with --from-api")
+
+	epc := client.New(flags)
+
+	cmd.RunE = func(_ *cobra.Command, _ []string) (err error) {
+		var services []inspect.ServiceEndpoints
+		if fromAPI {
+			services, err = apiServices(epc, nodeName)
+		} else {
+			var state inspect.State
+			state, err = agentState()
+			services = state.Services
+		}
+		if err != nil {
+			return
+		}
+
+		if services == nil {
+			services = []inspect.ServiceEndpoints{}
+		}
+		return write(services, func(w io.Writer) { writeServices(w, services) })
+	}
+
+	return cmd
+}
+
+func changesCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "changes",
+		Short: "dump the changes of the node agent's last change set, and the ones received since",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			state, err := agentState()
+			if err != nil {
+				return err
+			}
+
+			changes := struct {
+				Syncs    int              `json:"syncs"`
+				LastSync time.Time        `json:"lastSync,omitempty"`
+				Changes  []inspect.Change `json:"changes"`
+				Pending  []inspect.Change `json:"pending"`
+			}{state.Syncs, state.LastSync, state.Changes, state.Pending}
+
+			return write(changes, func(w io.Writer) { writeChanges(w, state) })
+		},
+	}
+}
+
+func objectsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "objects",
+		Short: "dump the number of objects programmed by the node agent's backend, by kind",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			state, err := agentState()
+			if err != nil {
+				return err
+			}
+
+			if state.Objects == nil {
+				return fmt.Errorf("the backend of %s doesn't count its objects", agent)
+			}
+			return write(state.Objects, func(w io.Writer) { writeObjects(w, state.Objects) })
+		},
+	}
+}
+
+func resyncCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "resync",
+		Short: "force a full resync of the node agent's backend (ie: after a manual iptables flush); repeated resyncs are coalesced",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			buf := &bytes.Buffer{}
+			if err := metrics.Request(ctx, agent, http.MethodPost, resync.Path, buf); err != nil {
+				return fmt.Errorf("failed to request a resync from %s (is it supported by its backend?): %w", agent, err)
+			}
+
+			var status resync.Status
+			if err := json.Unmarshal(buf.Bytes(), &status); err != nil {
+				return err
+			}
+			return write(status, func(w io.Writer) { fmt.Fprintf(w, "resync requested (%d since the agent started)\n", status.Requests) })
+		},
+	}
+}
+
+// agentState fetches the state of the node agent.
+func agentState() (state inspect.State, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	buf := &bytes.Buffer{}
+	if err = metrics.Query(ctx, agent, inspect.Path, buf); err != nil {
+		return
+	}
+
+	err = json.Unmarshal(buf.Bytes(), &state)
+	return
+}
+
+// apiServices fetches the state the server sends to the node.
+func apiServices(epc *client.EndpointsClient, nodeName string) (services []inspect.ServiceEndpoints, err error) {
+	sink := fullstate.New(&localsink.Config{NodeName: nodeName})
+	sink.Callback = fullstate.ArrayCallback(func(items []*fullstate.ServiceEndpoints) {
+		for _, item := range items {
+			services = append(services, inspect.ServiceEndpoints{Service: item.Service, Endpoints: item.Endpoints})
+		}
+	})
+	epc.Sink = sink
+
+	// the client retries until it gets the state
+	timer := time.AfterFunc(timeout, epc.Cancel)
+	defer timer.Stop()
+
+	sink.Setup()
+	if canceled := epc.Next(); canceled {
+		return nil, fmt.Errorf("no state received from %s in %v", epc.Target, timeout)
+	}
+	return
+}
+
+// write writes v as JSON, or as a table.
+func write(v interface{}, table func(w io.Writer)) error {
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	table(os.Stdout)
+	return nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/inspect"
+)
+
+// maxEndpointIPs is the number of endpoint IPs listed in the services table, like kubectl get endpoints.
+const maxEndpointIPs = 3
+
+func writeServices(out io.Writer, services []inspect.ServiceEndpoints) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "SERVICE\tTYPE\tIPS\tPORTS\tENDPOINTS")
+	for _, se := range services {
+		svc := se.Service
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", svc.NamespacedName(), svc.Type,
+			orNone(strings.Join(svc.GetIPs().All().All(), ",")), orNone(ports(svc)), orNone(endpointIPs(se.Endpoints)))
+	}
+}
+
+// ports returns the ports of the service, as "port[:nodePort]/protocol".
+func ports(svc *localnetv1.Service) string {
+	ports := make([]string, 0, len(svc.Ports)+len(svc.PortRanges))
+	for _, port := range svc.Ports {
+		p := strconv.Itoa(int(port.Port))
+		if port.NodePort != 0 {
+			p += ":" + strconv.Itoa(int(port.NodePort))
+		}
+		ports = append(ports, p+"/"+port.Protocol.String())
+	}
+	for _, r := range svc.PortRanges {
+		ports = append(ports, fmt.Sprintf("%d-%d/%s", r.Port, r.EndPort, r.Protocol))
+	}
+	return strings.Join(ports, ",")
+}
+
+// endpointIPs returns the first maxEndpointIPs IPs of the endpoints, followed by the number of the others.
+func endpointIPs(endpoints []*localnetv1.Endpoint) string {
+	ips := make([]string, 0, len(endpoints))
+	for _, ep := range endpoints {
+		ips = append(ips, ep.GetIPs().All()...)
+	}
+	sort.Strings(ips)
+
+	if len(ips) <= maxEndpointIPs {
+		return strings.Join(ips, ",")
+	}
+	return strings.Join(ips[:maxEndpointIPs], ",") + fmt.Sprintf(" + %d more...", len(ips)-maxEndpointIPs)
+}
+
+func writeChanges(out io.Writer, state inspect.State) {
+	if state.Syncs == 0 {
+		fmt.Fprintln(out, "no change set received yet")
+	} else {
+		fmt.Fprintf(out, "change set #%d, received %s ago: %d changes\n", state.Syncs,
+			time.Since(state.LastSync).Round(time.Second), len(state.Changes))
+		writeChangesTable(out, state.Changes)
+	}
+
+	if len(state.Pending) != 0 {
+		fmt.Fprintf(out, "\nreceived since, not synced yet: %d changes\n", len(state.Pending))
+		writeChangesTable(out, state.Pending)
+	}
+}
+
+func writeChangesTable(out io.Writer, changes []inspect.Change) {
+	if len(changes) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "OP\tSET\tPATH")
+	for _, change := range changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", change.Op, change.Set, change.Path)
+	}
+}
+
+func writeObjects(out io.Writer, objects map[string]int) {
+	kinds := make([]string, 0, len(objects))
+	for kind := range objects {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "OBJECTS\tCOUNT")
+	for _, kind := range kinds {
+		fmt.Fprintf(w, "%s\t%d\n", kind, objects[kind])
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
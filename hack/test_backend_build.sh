@@ -45,6 +45,9 @@ case $package in
   "nft")          build_package backends/nft ;;
   "ebpf")         build_package backends/ebpf ;;
   "userspacelin") build_package backends/userspacelin;;
+  "api")          build_package backends/api ;;
+  "dns")          build_package backends/dns ;;
+  "file")         build_package backends/file ;;
   "")         build_all_backends ;;
   *)          echo "invalid argument: '$package'" ;;
 esac
@@ -1198,7 +1198,7 @@ print_report=false
 deployment_model="single-process-per-node"
 export_metrics=false
 
-while getopts "i:b:B:cdD:eE:n:ps:mt:M" flag
+while getopts "i:b:B:cdD:eE:n:ps:m:tM" flag
 do
     case "${flag}" in
         i ) ip_family="${OPTARG}" ;;
@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kpng-load-sim measures how the server scales: it publishes synthetic services and endpoints in the store (without
+// API server), changes them at the configured rates, and runs the local state job of each simulated node in-process,
+// reporting the latency of the nodes' change sets and the memory used. See README.md.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+var (
+	services            = flag.Int("services", 1000, "number of services")
+	endpointsPerService = flag.Int("endpoints-per-service", 10, "number of endpoints of each service")
+	nodes               = flag.Int("nodes", 100, "number of nodes watching their local state")
+	endpointChurn       = flag.Float64("endpoint-churn", 100, "endpoints replaced per second")
+	serviceChurn        = flag.Float64("service-churn", 1, "services updated per second")
+	period              = flag.Duration("period", 100*time.Millisecond, "interval of the store updates, each one applying the churn of the period")
+	duration            = flag.Duration("duration", time.Minute, "duration of the simulation, after the initial sync")
+	reportPeriod        = flag.Duration("report-period", 10*time.Second, "interval of the reports")
+	seed                = flag.Int64("seed", 0, "seed of the churn (the current time if 0)")
+)
+
+func main() {
+	flag.Parse()
+
+	if *nodes < 1 || *services < 0 || *endpointsPerService < 0 || *period <= 0 || *reportPeriod <= 0 {
+		fmt.Fprintln(os.Stderr, "invalid flags: at least 1 node, and positive counts and periods are required")
+		os.Exit(2)
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	s := newSim(config{
+		services:            *services,
+		endpointsPerService: *endpointsPerService,
+		nodes:               *nodes,
+		endpointChurn:       *endpointChurn,
+		serviceChurn:        *serviceChurn,
+		period:              *period,
+		reportPeriod:        *reportPeriod,
+		seed:                *seed,
+	})
+
+	s.run(context.Background(), *duration, os.Stdout)
+}
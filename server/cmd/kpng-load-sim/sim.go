@@ -0,0 +1,359 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/jobs/store2localdiff"
+	"sigs.k8s.io/kpng/server/proxystore"
+)
+
+const (
+	namespace  = "kpng-sim"
+	markerName = "kpng-sim-marker"
+	markerPath = namespace + "/" + markerName
+)
+
+type config struct {
+	services            int
+	endpointsPerService int
+	nodes               int
+	endpointChurn       float64
+	serviceChurn        float64
+	period              time.Duration
+	reportPeriod        time.Duration
+	seed                int64
+}
+
+// sim publishes the services and endpoints in the store, by rounds: each one applies the churn of a period in a
+// single update, with the marker service holding the round number. The nodes measure the latency of a round from
+// its start to the sync of the change set holding its marker.
+type sim struct {
+	config
+
+	store *proxystore.Store
+	rng   *rand.Rand
+
+	serviceIPs  ipGen
+	endpointIPs ipGen
+	svcs        []*localnetv1.Service
+	eps         [][]*localnetv1.EndpointInfo
+	pods        int
+	generation  int
+
+	// fractional changes carried to the next round
+	endpointDebt, serviceDebt float64
+
+	mu            sync.Mutex
+	round         uint64
+	roundStarts   []time.Time // by round
+	window, total window
+	initial       window // the first sync of each node
+	initialSynced chan struct{}
+}
+
+func newSim(cfg config) *sim {
+	return &sim{
+		config:        cfg,
+		store:         proxystore.New(),
+		rng:           rand.New(rand.NewSource(cfg.seed)),
+		serviceIPs:    ipGen(net.ParseIP("10.96.0.0")),
+		endpointIPs:   ipGen(net.ParseIP("10.128.0.0")),
+		roundStarts:   []time.Time{{}},
+		initialSynced: make(chan struct{}),
+	}
+}
+
+// run populates the store, starts the nodes and churns for the duration, writing the reports to out.
+func (s *sim) run(ctx context.Context, duration time.Duration, out io.Writer) {
+	defer s.store.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.populate()
+	baseline := heapInUse()
+
+	fmt.Fprintf(out, "%d services x %d endpoints, %d nodes, churn of %g endpoints/s and %g services/s (seed %d)\n",
+		s.services, s.endpointsPerService, s.nodes, s.endpointChurn, s.serviceChurn, s.seed)
+
+	s.mu.Lock()
+	s.roundStarts[s.round] = time.Now()
+	s.mu.Unlock()
+
+	for i := 0; i < s.nodes; i++ {
+		job := &store2localdiff.Job{Store: s.store, Sink: &nodeSink{sim: s, name: nodeName(i)}}
+		go job.Run(ctx)
+	}
+
+	select {
+	case <-s.initialSynced:
+	case <-ctx.Done():
+		return
+	}
+
+	s.mu.Lock()
+	fmt.Fprintf(out, "initial sync: %s | %s\n", s.initial.String(), memory(baseline, s.nodes))
+	s.mu.Unlock()
+
+	start := time.Now()
+
+	ticker := time.NewTicker(s.period)
+	defer ticker.Stop()
+
+	reports := time.NewTicker(s.reportPeriod)
+	defer reports.Stop()
+
+	end := time.After(duration)
+
+	for {
+		select {
+		case <-ticker.C:
+			s.churn()
+
+		case <-reports.C:
+			s.report(out, fmt.Sprintf("[%v]", time.Since(start).Round(time.Second)), baseline)
+
+		case <-end:
+			s.report(out, fmt.Sprintf("[%v]", time.Since(start).Round(time.Second)), baseline)
+
+			s.mu.Lock()
+			fmt.Fprintf(out, "total: %s\n", s.total.String())
+			s.mu.Unlock()
+			return
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// populate sets the nodes, services and endpoints in the store, with the marker of the first round.
+func (s *sim) populate() {
+	for i := 0; i < s.services; i++ {
+		s.svcs = append(s.svcs, s.service(i, s.serviceIPs.Next().String()))
+
+		eps := make([]*localnetv1.EndpointInfo, 0, s.endpointsPerService)
+		for j := 0; j < s.endpointsPerService; j++ {
+			eps = append(eps, s.newEndpoint(i))
+		}
+		s.eps = append(s.eps, eps)
+	}
+
+	s.round = 1
+	s.roundStarts = append(s.roundStarts, time.Time{})
+
+	s.store.Update(func(tx *proxystore.Tx) {
+		for i := 0; i < s.nodes; i++ {
+			tx.SetNode(&localnetv1.Node{Name: nodeName(i), Topology: &localnetv1.TopologyInfo{Node: nodeName(i)}})
+		}
+
+		for i, svc := range s.svcs {
+			tx.SetService(svc)
+			tx.SetEndpointsOfSource(namespace, sourceName(i), s.eps[i])
+		}
+
+		tx.SetService(marker(s.round))
+
+		for _, set := range []proxystore.Set{proxystore.Services, proxystore.Endpoints, proxystore.Nodes} {
+			tx.SetSync(set)
+		}
+	})
+}
+
+// churn applies the changes of a period: endpoints are replaced (a new pod, with a new IP) and services updated.
+func (s *sim) churn() {
+	s.endpointDebt += s.endpointChurn * s.period.Seconds()
+	s.serviceDebt += s.serviceChurn * s.period.Seconds()
+
+	endpointChanges, serviceChanges := int(s.endpointDebt), int(s.serviceDebt)
+	s.endpointDebt -= float64(endpointChanges)
+	s.serviceDebt -= float64(serviceChanges)
+
+	changedEndpoints := map[int]bool{}
+	changedServices := map[int]bool{}
+
+	if s.services != 0 {
+		for i := 0; i < endpointChanges && s.endpointsPerService != 0; i++ {
+			svc := s.rng.Intn(s.services)
+			s.eps[svc][s.rng.Intn(s.endpointsPerService)] = s.newEndpoint(svc)
+			changedEndpoints[svc] = true
+		}
+
+		for i := 0; i < serviceChanges; i++ {
+			svc := s.rng.Intn(s.services)
+			s.svcs[svc] = s.service(svc, s.svcs[svc].IPs.ClusterIPs.First())
+			changedServices[svc] = true
+		}
+	}
+
+	s.mu.Lock()
+	s.round++
+	round := s.round
+	s.roundStarts = append(s.roundStarts, time.Now())
+	s.window.rounds++
+	s.window.endpointChanges += endpointChanges
+	s.window.serviceChanges += serviceChanges
+	s.mu.Unlock()
+
+	s.store.Update(func(tx *proxystore.Tx) {
+		for svc := range changedServices {
+			tx.SetService(s.svcs[svc])
+		}
+		for svc := range changedEndpoints {
+			tx.SetEndpointsOfSource(namespace, sourceName(svc), s.eps[svc])
+		}
+		tx.SetService(marker(round))
+	})
+}
+
+// synced records the change set of a node, and the latency of its round if it's a new one.
+func (s *sim) synced(n *nodeSink, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := &s.window
+	if n.syncedRound == 0 {
+		w = &s.initial
+	}
+
+	w.syncs++
+	w.ops += n.ops
+	w.bytes += n.bytes
+	n.ops, n.bytes = 0, 0
+
+	if n.round <= n.syncedRound {
+		return
+	}
+
+	w.latencies = append(w.latencies, now.Sub(s.roundStarts[n.round]))
+	if n.syncedRound != 0 {
+		// the rounds updated while the node was computing the previous change set
+		w.skipped += int(n.round - n.syncedRound - 1)
+	}
+
+	if n.syncedRound == 0 && len(s.initial.latencies) == s.nodes {
+		close(s.initialSynced)
+	}
+	n.syncedRound = n.round
+}
+
+func (s *sim) report(out io.Writer, prefix string, baseline uint64) {
+	s.mu.Lock()
+	w := s.window
+	s.window = window{}
+	s.total.add(&w)
+	s.mu.Unlock()
+
+	fmt.Fprintf(out, "%s %s | %s\n", prefix, w.String(), memory(baseline, s.nodes))
+}
+
+func (s *sim) service(i int, clusterIP string) *localnetv1.Service {
+	s.generation++
+
+	return &localnetv1.Service{
+		Namespace: namespace,
+		Name:      serviceName(i),
+		Type:      "ClusterIP",
+		Labels:    map[string]string{"generation": strconv.Itoa(s.generation)},
+		IPs: &localnetv1.ServiceIPs{
+			ClusterIPs:  localnetv1.NewIPSet(clusterIP),
+			ExternalIPs: &localnetv1.IPSet{},
+		},
+		Ports: []*localnetv1.PortMapping{
+			{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPort: 8080},
+		},
+	}
+}
+
+func (s *sim) newEndpoint(svc int) *localnetv1.EndpointInfo {
+	s.pods++
+
+	return &localnetv1.EndpointInfo{
+		Namespace:   namespace,
+		SourceName:  sourceName(svc),
+		ServiceName: serviceName(svc),
+		PodName:     serviceName(svc) + "-" + strconv.Itoa(s.pods),
+		Endpoint:    &localnetv1.Endpoint{IPs: localnetv1.NewIPSet(s.endpointIPs.Next().String())},
+		Conditions:  &localnetv1.EndpointConditions{Ready: true},
+		Topology:    &localnetv1.TopologyInfo{Node: nodeName(s.rng.Intn(s.nodes))},
+	}
+}
+
+// marker returns the marker service of the round, sent to all the nodes.
+func marker(round uint64) *localnetv1.Service {
+	return &localnetv1.Service{
+		Namespace: namespace,
+		Name:      markerName,
+		Type:      "ClusterIP",
+		Labels:    map[string]string{"round": strconv.FormatUint(round, 10)},
+	}
+}
+
+func serviceName(i int) string { return "svc-" + strconv.Itoa(i) }
+func sourceName(i int) string  { return serviceName(i) + "-slice" }
+func nodeName(i int) string    { return "node-" + strconv.Itoa(i) }
+
+func heapInUse() uint64 {
+	runtime.GC()
+
+	stats := &runtime.MemStats{}
+	runtime.ReadMemStats(stats)
+	return stats.HeapInuse
+}
+
+// memory describes the heap in use, and the part of each node over the baseline (the store alone).
+func memory(baseline uint64, nodes int) string {
+	heap := heapInUse()
+
+	perNode := 0.0
+	if heap > baseline && nodes != 0 {
+		perNode = float64(heap-baseline) / float64(nodes)
+	}
+
+	return fmt.Sprintf("heap %s (store %s, %s/node), %d goroutines",
+		bytesString(float64(heap)), bytesString(float64(baseline)), bytesString(perNode), runtime.NumGoroutine())
+}
+
+type ipGen net.IP
+
+func (ip ipGen) Next() net.IP {
+	for i := len(ip) - 1; i != -1; i-- {
+		if ip[i] == 0xff {
+			ip[i] = 0
+			continue
+		}
+
+		ip[i]++
+
+		next := make([]byte, len(ip))
+		copy(next, ip)
+		return net.IP(next)
+	}
+
+	panic("no more IPs!")
+}
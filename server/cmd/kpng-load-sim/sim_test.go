@@ -0,0 +1,59 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSim(t *testing.T) {
+	s := newSim(config{
+		services:            20,
+		endpointsPerService: 3,
+		nodes:               4,
+		endpointChurn:       200,
+		serviceChurn:        50,
+		period:              10 * time.Millisecond,
+		reportPeriod:        time.Hour,
+		seed:                1,
+	})
+
+	out := &bytes.Buffer{}
+	s.run(context.Background(), 300*time.Millisecond, out)
+
+	if !strings.Contains(out.String(), "initial sync: ") || !strings.Contains(out.String(), "total: ") {
+		t.Fatalf("missing reports in the output:\n%s", out)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.initial.latencies) != 4 {
+		t.Errorf("expected the initial sync of the 4 nodes, got %d", len(s.initial.latencies))
+	}
+	if s.total.rounds == 0 || s.total.endpointChanges == 0 || s.total.serviceChanges == 0 {
+		t.Errorf("expected churn, got %d rounds, %d endpoint and %d service changes",
+			s.total.rounds, s.total.endpointChanges, s.total.serviceChanges)
+	}
+	if len(s.total.latencies) == 0 {
+		t.Error("expected the nodes to receive rounds")
+	}
+}
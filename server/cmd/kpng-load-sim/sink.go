@@ -0,0 +1,79 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/localsink"
+)
+
+// nodeSink is the sink of a simulated node, applying nothing: it requests the next change set as soon as one is
+// received, and counts the operations.
+type nodeSink struct {
+	sim  *sim
+	name string
+
+	// round is the round of the last marker received, syncedRound the one of the last change set
+	round, syncedRound uint64
+
+	ops   int
+	bytes int64
+}
+
+var _ localsink.Sink = &nodeSink{}
+
+func (n *nodeSink) Setup() {}
+
+func (n *nodeSink) WaitRequest() (nodeName string, err error) {
+	return n.name, nil
+}
+
+func (n *nodeSink) Reset() {}
+
+func (n *nodeSink) Send(op *localnetv1.OpItem) error {
+	n.ops++
+	n.bytes += int64(proto.Size(op))
+
+	switch v := op.Op.(type) {
+	case *localnetv1.OpItem_Set:
+		if v.Set.Ref.Set != localnetv1.Set_ServicesSet || v.Set.Ref.Path != markerPath {
+			return nil
+		}
+
+		svc := &localnetv1.Service{}
+		if err := proto.Unmarshal(v.Set.Bytes, svc); err != nil {
+			return err
+		}
+
+		round, err := strconv.ParseUint(svc.Labels["round"], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid marker: %w", err)
+		}
+		n.round = round
+
+	case *localnetv1.OpItem_Sync:
+		n.sim.synced(n, time.Now())
+	}
+
+	return nil
+}
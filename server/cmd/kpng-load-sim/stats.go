@@ -0,0 +1,84 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// window holds the measures of a report.
+type window struct {
+	rounds          int
+	endpointChanges int
+	serviceChanges  int
+
+	syncs   int
+	skipped int
+	ops     int
+	bytes   int64
+
+	// latencies are the latencies of the rounds received by the nodes
+	latencies []time.Duration
+}
+
+func (w *window) add(o *window) {
+	w.rounds += o.rounds
+	w.endpointChanges += o.endpointChanges
+	w.serviceChanges += o.serviceChanges
+	w.syncs += o.syncs
+	w.skipped += o.skipped
+	w.ops += o.ops
+	w.bytes += o.bytes
+	w.latencies = append(w.latencies, o.latencies...)
+}
+
+func (w *window) String() string {
+	s := ""
+	if w.rounds != 0 {
+		s = fmt.Sprintf("%d rounds (%d endpoint and %d service changes) | ", w.rounds, w.endpointChanges, w.serviceChanges)
+	}
+
+	return s + fmt.Sprintf("%d syncs, %d rounds skipped | latency %s | %d ops (%s)",
+		w.syncs, w.skipped, percentiles(w.latencies), w.ops, bytesString(float64(w.bytes)))
+}
+
+func percentiles(latencies []time.Duration) string {
+	if len(latencies) == 0 {
+		return "-"
+	}
+
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	p := func(q float64) time.Duration {
+		return sorted[int(q*float64(len(sorted)-1))].Round(10 * time.Microsecond)
+	}
+
+	return fmt.Sprintf("p50 %v, p90 %v, p99 %v, max %v", p(0.5), p(0.9), p(0.99), sorted[len(sorted)-1].Round(10*time.Microsecond))
+}
+
+func bytesString(b float64) string {
+	for _, unit := range []string{"B", "KiB", "MiB"} {
+		if b < 1024 {
+			return fmt.Sprintf("%.1f %s", b, unit)
+		}
+		b /= 1024
+	}
+	return fmt.Sprintf("%.1f GiB", b)
+}
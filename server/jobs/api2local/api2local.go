@@ -18,16 +18,20 @@ package api2local
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/spf13/pflag"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 
 	"k8s.io/klog/v2"
 
 	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/connpolicy"
 	"sigs.k8s.io/kpng/client/localsink"
+	"sigs.k8s.io/kpng/client/localsink/servicetypes"
 	"sigs.k8s.io/kpng/client/tlsflags"
 
 	"sigs.k8s.io/kpng/server/pkg/apiwatch"
@@ -52,6 +56,53 @@ func (c *Config) BindFlags(flags *pflag.FlagSet) {
 type Job struct {
 	apiwatch.Watch
 	Sink localsink.Sink
+
+	// ServiceTypes restricts the services handled by the sink (requested to the API and enforced locally).
+	ServiceTypes servicetypes.Config
+
+	// NodeAnnotation publishes the applied revisions on the node, if enabled.
+	NodeAnnotation NodeAnnotation
+
+	// revision is the revision of the last change set fully sent to the sink, to resume the watch.
+	revision uint64
+
+	// filter is the sink filtering the service types, if enabled.
+	filter *servicetypes.Sink
+
+	backoff *connpolicy.Backoff
+}
+
+// connection is the state of the stream to the API, see ConnectionState.
+var connection struct {
+	sync.Mutex
+	state   connectivity.State
+	since   time.Time
+	watched bool
+}
+
+func setConnectionState(state connectivity.State) {
+	connection.Lock()
+	defer connection.Unlock()
+
+	if connection.watched && connection.state == state {
+		return
+	}
+	connection.state, connection.since, connection.watched = state, time.Now(), true
+}
+
+// ConnectionState returns the state of the stream to the API and since when it's in this state, if a Job runs
+// (see health.ConnectionState).
+func ConnectionState() (state connectivity.State, since time.Time, ok bool) {
+	connection.Lock()
+	defer connection.Unlock()
+
+	return connection.state, connection.since, connection.watched
+}
+
+func (j *Job) BindFlags(flags *pflag.FlagSet) {
+	j.Watch.BindFlags(flags)
+	j.ServiceTypes.BindFlags(flags)
+	j.NodeAnnotation.BindFlags(flags)
 }
 
 func New(sink localsink.Sink) *Job {
@@ -64,8 +115,23 @@ func New(sink localsink.Sink) *Job {
 }
 
 func (j *Job) Run(ctx context.Context) {
+	if j.ServiceTypes.Enabled() {
+		j.filter = servicetypes.New(&j.ServiceTypes, j.Sink)
+		j.Sink = j.filter
+	}
+
+	if j.NodeAnnotation.Enabled {
+		if err := j.NodeAnnotation.Run(ctx); err != nil {
+			klog.Fatal("failed to setup node annotations: ", err)
+		}
+	}
+
+	j.Watch.OnState = setConnectionState
+
 	j.Sink.Setup()
 
+	j.backoff = j.NewBackoff()
+
 	for {
 		err := j.run(ctx)
 
@@ -74,8 +140,10 @@ func (j *Job) Run(ctx context.Context) {
 			return
 		}
 
-		klog.Error("local watch error: ", err)
-		time.Sleep(5 * time.Second) // TODO parameter?
+		delay := j.backoff.Next()
+		klog.Error("local watch error: ", err, ", retrying in ", delay)
+		metrics.Kpng_api_reconnects.Inc()
+		time.Sleep(delay)
 	}
 }
 
@@ -116,7 +184,9 @@ func (j *Job) runLoop(watch localnetv1.Endpoints_WatchClient) (err error) {
 	}
 
 	err = watch.Send(&localnetv1.WatchReq{
-		NodeName: nodeName,
+		NodeName:     nodeName,
+		ServiceTypes: j.ServiceTypes.Types,
+		Revision:     j.revision,
 	})
 	if err != nil {
 		return
@@ -130,19 +200,40 @@ func (j *Job) runLoop(watch localnetv1.Endpoints_WatchClient) (err error) {
 			return
 		}
 
-		switch op.Op.(type) {
+		switch v := op.Op.(type) {
 		case *localnetv1.OpItem_Reset_:
+			j.revision = 0
 			j.Sink.Reset()
+			continue
+
+		case *localnetv1.OpItem_Sync:
+			j.revision = v.Sync.GetRevision()
 
 		default:
-			metrics.Kpng_node_local_events.Inc()
-			err = j.Sink.Send(op)
-			if err != nil {
-				return
-			}
+			// the change set is partially sent until the next sync
+			j.revision = 0
 		}
 
-		if _, isSync := op.Op.(*localnetv1.OpItem_Sync); isSync {
+		syncOp, isSync := op.Op.(*localnetv1.OpItem_Sync)
+		if isSync && j.NodeAnnotation.Enabled {
+			j.NodeAnnotation.Syncing(nodeName, syncOp.Sync.GetRevision())
+		}
+
+		metrics.Kpng_node_local_events.Inc()
+		err = j.Sink.Send(op)
+		if err != nil {
+			j.revision = 0
+			return
+		}
+
+		if isSync {
+			if j.filter != nil {
+				metrics.Kpng_filtered_services.WithLabelValues(nodeName).Set(float64(j.filter.Filtered()))
+			}
+			j.backoff.Reset()
+			if j.NodeAnnotation.Enabled {
+				j.NodeAnnotation.Synced()
+			}
 			return
 		}
 	}
@@ -0,0 +1,267 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api2local
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// AppliedRevisionAnnotation is the revision of the server's state last applied by the node's agent.
+	AppliedRevisionAnnotation = "kpng.sigs.k8s.io/applied-revision"
+	// AppliedAtAnnotation is the time the node's agent last applied a state (RFC 3339).
+	AppliedAtAnnotation = "kpng.sigs.k8s.io/applied-at"
+	// FailingServicesAnnotation are the services the node's backend fails to program, as a JSON object of their
+	// errors by "namespace/name".
+	FailingServicesAnnotation = "kpng.sigs.k8s.io/failing-services"
+
+	// maxReportedFailures is the maximum number of failing services in the annotation, and maxReportedErrorLen
+	// the maximum length of their errors, to keep the node objects small.
+	maxReportedFailures = 50
+	maxReportedErrorLen = 256
+)
+
+// serviceFailures are the services the backend fails to program, see SetServiceFailures.
+var serviceFailures struct {
+	sync.Mutex
+	services map[string]string
+	revision uint64
+}
+
+// SetServiceFailures sets the services the backend fails to program, by "namespace/name", published with the
+// applied revisions (see backendcmd.ServiceFailures).
+func SetServiceFailures(failures map[string]string) {
+	// report the same failures while they don't change
+	keys := make([]string, 0, len(failures))
+	for service := range failures {
+		keys = append(keys, service)
+	}
+	sort.Strings(keys)
+	if len(keys) > maxReportedFailures {
+		keys = keys[:maxReportedFailures]
+	}
+
+	services := make(map[string]string, len(keys))
+	for _, service := range keys {
+		err := failures[service]
+		if len(err) > maxReportedErrorLen {
+			err = err[:maxReportedErrorLen]
+		}
+		services[service] = err
+	}
+
+	serviceFailures.Lock()
+	defer serviceFailures.Unlock()
+
+	if reflect.DeepEqual(services, serviceFailures.services) || len(services) == 0 && len(serviceFailures.services) == 0 {
+		return // no change
+	}
+
+	serviceFailures.services = services
+	serviceFailures.revision++
+}
+
+func currentServiceFailures() (services map[string]string, revision uint64) {
+	serviceFailures.Lock()
+	defer serviceFailures.Unlock()
+
+	return serviceFailures.services, serviceFailures.revision
+}
+
+// backendApplied is set when the backend reports the change sets it applied, see WaitBackendApplied.
+var backendApplied struct {
+	sync.Mutex
+	wait       bool
+	annotation *NodeAnnotation
+}
+
+// WaitBackendApplied makes the published revisions the ones the backend reports as applied with BackendApplied (see
+// backendcmd.StrictReadiness), instead of the ones sent to the backend without error.
+func WaitBackendApplied() {
+	backendApplied.Lock()
+	defer backendApplied.Unlock()
+
+	backendApplied.wait = true
+}
+
+// BackendApplied records that the backend applied the change sets sent so far.
+func BackendApplied() {
+	backendApplied.Lock()
+	a := backendApplied.annotation
+	backendApplied.Unlock()
+
+	if a == nil {
+		return // not publishing
+	}
+
+	a.mu.Lock()
+	nodeName, revision := a.nodeName, a.syncing
+	a.mu.Unlock()
+
+	if revision != 0 {
+		a.Applied(nodeName, revision)
+	}
+}
+
+func waitsBackendApplied() bool {
+	backendApplied.Lock()
+	defer backendApplied.Unlock()
+
+	return backendApplied.wait
+}
+
+// NodeAnnotation publishes the last state applied by the agent in its node's annotations, so
+// dashboards can show the dataplane staleness of each node without scraping the agents.
+// Updates are rate-limited to one per Interval.
+type NodeAnnotation struct {
+	Enabled    bool
+	Kubeconfig string
+	Interval   time.Duration
+
+	mu        sync.Mutex
+	nodeName  string
+	syncing   uint64 // the revision of the last change set sent to the backend
+	revision  uint64 // the last revision applied
+	appliedAt time.Time
+	published uint64
+
+	publishedFailures uint64
+}
+
+func (a *NodeAnnotation) BindFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&a.Enabled, "annotate-node", false, "publish the last applied revision, its time and the services failing to be programmed in the node's annotations")
+	flags.StringVar(&a.Kubeconfig, "annotate-node-kubeconfig", "", "kubeconfig used to annotate the node (in-cluster configuration if empty)")
+	flags.DurationVar(&a.Interval, "annotate-node-interval", 30*time.Second, "minimum interval between node annotation updates")
+}
+
+// Syncing records the revision of the change set being sent to the backend for the node. It's called before the
+// change set's sync is sent, as the backend may apply it before the sync returns.
+func (a *NodeAnnotation) Syncing(nodeName string, revision uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.nodeName = nodeName
+	a.syncing = revision
+}
+
+// Synced records that the change set being sent was sent without error: it's applied, unless the backend reports the
+// change sets it applies (see WaitBackendApplied).
+func (a *NodeAnnotation) Synced() {
+	if waitsBackendApplied() {
+		return
+	}
+
+	a.mu.Lock()
+	nodeName, revision := a.nodeName, a.syncing
+	a.mu.Unlock()
+
+	a.Applied(nodeName, revision)
+}
+
+// Applied records that the revision of the state was applied for the given node.
+func (a *NodeAnnotation) Applied(nodeName string, revision uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.nodeName = nodeName
+	a.revision = revision
+	a.appliedAt = time.Now()
+}
+
+// Run publishes the applied revisions until the context is done.
+func (a *NodeAnnotation) Run(ctx context.Context) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", a.Kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	backendApplied.Lock()
+	backendApplied.annotation = a
+	backendApplied.Unlock()
+
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := a.publish(ctx, client); err != nil {
+			klog.Error("failed to annotate node: ", err)
+		}
+	}, a.Interval)
+
+	return nil
+}
+
+func (a *NodeAnnotation) publish(ctx context.Context, client kubernetes.Interface) error {
+	a.mu.Lock()
+	nodeName, revision, appliedAt := a.nodeName, a.revision, a.appliedAt
+	a.mu.Unlock()
+
+	failures, failuresRevision := currentServiceFailures()
+
+	if nodeName == "" || revision == a.published && failuresRevision == a.publishedFailures {
+		return nil // nothing new
+	}
+
+	if failures == nil {
+		failures = map[string]string{}
+	}
+	failuresJSON, err := json.Marshal(failures)
+	if err != nil {
+		return err
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				AppliedRevisionAnnotation: strconv.FormatUint(revision, 10),
+				AppliedAtAnnotation:       appliedAt.UTC().Format(time.RFC3339),
+				FailingServicesAnnotation: string(failuresJSON),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = client.CoreV1().Nodes().Patch(ctx, nodeName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+
+	klog.V(1).Info("annotated node ", nodeName, " with applied revision ", revision)
+
+	a.published = revision
+	a.publishedFailures = failuresRevision
+	return nil
+}
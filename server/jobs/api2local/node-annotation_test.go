@@ -0,0 +1,80 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api2local
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeAnnotationRevisions(t *testing.T) {
+	ctx := context.Background()
+
+	defer func() {
+		backendApplied.Lock()
+		backendApplied.wait = false
+		backendApplied.annotation = nil
+		backendApplied.Unlock()
+	}()
+
+	for _, wait := range []bool{false, true} {
+		client := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}})
+		a := &NodeAnnotation{}
+
+		backendApplied.Lock()
+		backendApplied.wait = wait
+		backendApplied.annotation = a
+		backendApplied.Unlock()
+
+		expect := func(expected string) {
+			t.Helper()
+
+			if err := a.publish(ctx, client); err != nil {
+				t.Fatal(err)
+			}
+			node, err := client.CoreV1().Nodes().Get(ctx, "node-a", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revision := node.Annotations[AppliedRevisionAnnotation]; revision != expected {
+				t.Errorf("waiting for the backend: %v: expected the applied revision %q, got %q", wait, expected, revision)
+			}
+		}
+
+		a.Syncing("node-a", 42)
+		a.Synced()
+
+		if wait {
+			// not applied by the backend yet
+			expect("")
+			BackendApplied()
+		}
+		expect("42")
+
+		// the backend applies the change set before its sync returns
+		a.Syncing("node-a", 45)
+		if wait {
+			BackendApplied()
+		}
+		a.Synced()
+		expect("45")
+	}
+}
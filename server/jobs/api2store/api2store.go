@@ -27,18 +27,27 @@ import (
 	"k8s.io/klog/v2"
 
 	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/connpolicy"
 	"sigs.k8s.io/kpng/server/pkg/apiwatch"
+	"sigs.k8s.io/kpng/server/pkg/metrics"
 	"sigs.k8s.io/kpng/server/proxystore"
 )
 
 type Job struct {
 	apiwatch.Watch
 	Store *proxystore.Store
+
+	// revision is the revision of the last change set applied to the store, to resume the watch.
+	revision uint64
+
+	backoff *connpolicy.Backoff
 }
 
 func (j *Job) Run(ctx context.Context) {
 	defer j.Store.Close()
 
+	j.backoff = j.NewBackoff()
+
 	for {
 		err := j.run(ctx)
 
@@ -47,8 +56,10 @@ func (j *Job) Run(ctx context.Context) {
 			return
 		}
 
-		klog.Error("global watch error: ", err)
-		time.Sleep(5 * time.Second) // TODO parameter?
+		delay := j.backoff.Next()
+		klog.Error("global watch error: ", err, ", retrying in ", delay)
+		metrics.Kpng_api_reconnects.Inc()
+		time.Sleep(delay)
 	}
 }
 
@@ -74,9 +85,10 @@ func (j *Job) run(ctx context.Context) (err error) {
 			return
 		}
 
-		watch.Send(&localnetv1.GlobalWatchReq{})
+		watch.Send(&localnetv1.GlobalWatchReq{Revision: j.revision})
 
 		todo := make([]func(tx *proxystore.Tx), 0)
+		revision := uint64(0)
 
 	recvLoop:
 		for {
@@ -125,6 +137,8 @@ func (j *Job) run(ctx context.Context) (err error) {
 				}
 
 			case *localnetv1.OpItem_Sync:
+				revision = v.Sync.GetRevision()
+
 				// break on sync
 				break recvLoop
 			}
@@ -149,5 +163,8 @@ func (j *Job) run(ctx context.Context) (err error) {
 				tx.SetSync(proxystore.Nodes)
 			})
 		}
+
+		j.revision = revision
+		j.backoff.Reset()
 	}
 }
@@ -0,0 +1,242 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube2store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/pager"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/server/pkg/metrics"
+)
+
+// The kinds of divergences between the API server and the informer's cache (that the store follows).
+const (
+	// divergenceMissing is an object of the API server not in the cache (its addition was missed).
+	divergenceMissing = "missing"
+	// divergenceStale is an object of the cache older than the API server's (an update was missed).
+	divergenceStale = "stale"
+	// divergenceDeleted is an object of the cache not in the API server anymore (its deletion was missed).
+	divergenceDeleted = "deleted"
+)
+
+// consistencyGrace is the time given to the watch to catch up with the changes seen by a listing, before they're
+// checked again and repaired.
+const consistencyGrace = 10 * time.Second
+
+// listFunc lists the objects of a resource handled by the job, in a namespace (all if empty).
+type listFunc func(ctx context.Context, namespace string, options metav1.ListOptions) (runtime.Object, error)
+
+// consistencyChecker periodically lists the objects of a resource from the API server and compares them to the
+// informer's cache, detecting the watch events that were missed: the divergent objects are checked again after a
+// grace period, as the watch is usually only lagging, then repaired by handling their current state.
+type consistencyChecker struct {
+	resource string
+	informer cache.SharedIndexInformer
+	handler  cache.ResourceEventHandler
+	list     listFunc
+	grace    time.Duration
+}
+
+// divergence is an object whose state in the cache differs from the API server's.
+type divergence struct {
+	kind string
+	key  string
+	// cachedVersion is the resource version of the cached object ("" if not cached)
+	cachedVersion string
+}
+
+// run checks the resource every period, once the informer is synced.
+func (c *consistencyChecker) run(ctx context.Context, period time.Duration) {
+	if !cache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+		return
+	}
+
+	wait.JitterUntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.check(ctx); err != nil && ctx.Err() == nil {
+			klog.Warning("consistency check of the ", c.resource, " failed: ", err)
+		}
+	}, period, 0.1, false)
+}
+
+// check compares the listing of the resource to the cache, and repairs the divergences still there after the grace
+// period.
+func (c *consistencyChecker) check(ctx context.Context) error {
+	divergences, err := c.diff(ctx)
+	if err != nil || len(divergences) == 0 {
+		return err
+	}
+
+	select {
+	case <-time.After(c.grace):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for _, d := range divergences {
+		if err := c.repair(ctx, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diff returns the divergences between the listing of the resource and the cache, sorted by key.
+func (c *consistencyChecker) diff(ctx context.Context) ([]divergence, error) {
+	listed := map[string]string{} // resource version by key
+
+	p := pager.New(func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+		return c.list(ctx, "", options)
+	})
+
+	// an empty resource version is a consistent read, not served from the watch cache of the API server
+	err := p.EachListItem(ctx, metav1.ListOptions{}, func(obj runtime.Object) error {
+		key, err := cache.MetaNamespaceKeyFunc(obj)
+		if err != nil {
+			return err
+		}
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			return err
+		}
+		listed[key] = m.GetResourceVersion()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	divergences := make([]divergence, 0)
+
+	for _, obj := range c.informer.GetStore().List() {
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			continue
+		}
+		key, _ := cache.MetaNamespaceKeyFunc(obj)
+
+		version, ok := listed[key]
+		delete(listed, key)
+
+		switch {
+		case !ok:
+			divergences = append(divergences, divergence{divergenceDeleted, key, m.GetResourceVersion()})
+		case version != m.GetResourceVersion():
+			divergences = append(divergences, divergence{divergenceStale, key, m.GetResourceVersion()})
+		}
+	}
+
+	for key := range listed {
+		divergences = append(divergences, divergence{divergenceMissing, key, ""})
+	}
+
+	sort.Slice(divergences, func(i, j int) bool { return divergences[i].key < divergences[j].key })
+
+	return divergences, nil
+}
+
+// repair gets the current state of a divergent object and, if the cache still doesn't have it, handles it as the
+// missed watch event would have been.
+func (c *consistencyChecker) repair(ctx context.Context, d divergence) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(d.key)
+	if err != nil {
+		return err
+	}
+
+	cached, cachedOK, err := c.informer.GetStore().GetByKey(d.key)
+	if err != nil {
+		return err
+	}
+
+	cachedVersion := ""
+	if cachedOK {
+		m, err := meta.Accessor(cached)
+		if err != nil {
+			return err
+		}
+		cachedVersion = m.GetResourceVersion()
+	}
+
+	if cachedVersion != d.cachedVersion {
+		// the watch delivered an event for the object since the listing, it's not lagging behind
+		return nil
+	}
+
+	// get the object through a listing, to apply the same selectors as the informer
+	list, err := c.list(ctx, namespace, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String(),
+	})
+	if err != nil {
+		return err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+
+	var current runtime.Object
+	if len(items) != 0 {
+		current = items[0]
+	}
+
+	kind := ""
+	switch {
+	case current == nil && cachedOK:
+		kind = divergenceDeleted
+	case current != nil && !cachedOK:
+		kind = divergenceMissing
+	case current != nil:
+		m, err := meta.Accessor(current)
+		if err != nil {
+			return err
+		}
+		if m.GetResourceVersion() != cachedVersion {
+			kind = divergenceStale
+		}
+	}
+
+	if kind == "" {
+		return nil
+	}
+
+	klog.Warningf("%s %s diverged from the API server (%s in the cache), repairing it", c.resource, d.key, kind)
+	metrics.Kpng_store_divergences.WithLabelValues(c.resource, kind).Inc()
+
+	// update the cache too, so the next event of the object is handled from its current state
+	store := c.informer.GetStore()
+
+	switch kind {
+	case divergenceDeleted:
+		c.handler.OnDelete(cached)
+		return store.Delete(cached)
+	case divergenceMissing:
+		c.handler.OnAdd(current)
+		return store.Add(current)
+	default:
+		c.handler.OnUpdate(cached, current)
+		return store.Update(current)
+	}
+}
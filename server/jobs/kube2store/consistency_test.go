@@ -0,0 +1,155 @@
+package kube2store
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+type recordingHandler struct{ events []string }
+
+func (h *recordingHandler) OnAdd(obj interface{}) {
+	h.events = append(h.events, "add "+obj.(*v1.Service).Name)
+}
+func (h *recordingHandler) OnUpdate(_, obj interface{}) {
+	h.events = append(h.events, "update "+obj.(*v1.Service).Name)
+}
+func (h *recordingHandler) OnDelete(obj interface{}) {
+	h.events = append(h.events, "delete "+obj.(*v1.Service).Name)
+}
+
+func testService(name, version string) v1.Service {
+	return v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, ResourceVersion: version}}
+}
+
+// listServices lists the services of the API server, as filtered by the checker's gets.
+func listServices(services []v1.Service, options metav1.ListOptions) *v1.ServiceList {
+	selector := fields.Everything()
+	if options.FieldSelector != "" {
+		selector = fields.ParseSelectorOrDie(options.FieldSelector)
+	}
+
+	list := &v1.ServiceList{}
+	for _, svc := range services {
+		if selector.Matches(fields.Set{"metadata.name": svc.Name}) {
+			list.Items = append(list.Items, svc)
+		}
+	}
+	return list
+}
+
+func TestConsistencyCheck(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the informer's watch never delivers events, so every later change of the API server is missed
+	watched := []v1.Service{testService("deleted", "1"), testService("stale", "2"), testService("same", "3")}
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return &v1.ServiceList{ListMeta: metav1.ListMeta{ResourceVersion: "3"}, Items: watched}, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}, &v1.Service{}, 0, cache.Indexers{})
+
+	go informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		t.Fatal("informer not synced")
+	}
+
+	current := []v1.Service{testService("stale", "4"), testService("same", "3"), testService("missing", "5")}
+
+	handler := &recordingHandler{}
+	checker := &consistencyChecker{
+		resource: "services",
+		informer: informer,
+		handler:  handler,
+		list: func(ctx context.Context, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+			return listServices(current, options), nil
+		},
+	}
+
+	if err := checker.check(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"delete deleted", "add missing", "update stale"}
+	if !reflect.DeepEqual(handler.events, expected) {
+		t.Errorf("expected the repairs %q, got %q", expected, handler.events)
+	}
+
+	versions := map[string]string{}
+	for _, obj := range informer.GetStore().List() {
+		svc := obj.(*v1.Service)
+		versions[svc.Name] = svc.ResourceVersion
+	}
+	if expected := map[string]string{"stale": "4", "same": "3", "missing": "5"}; !reflect.DeepEqual(versions, expected) {
+		t.Errorf("expected the cache to be repaired to %v, got %v", expected, versions)
+	}
+
+	// nothing left to repair
+	handler.events = nil
+	if err := checker.check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(handler.events) != 0 {
+		t.Errorf("expected no repair, got %q", handler.events)
+	}
+}
+
+func TestConsistencyCheckLaggingWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	informer := &fakeInformer{store: store}
+
+	old := testService("svc", "1")
+	store.Add(&old)
+
+	handler := &recordingHandler{}
+	checker := &consistencyChecker{
+		resource: "services",
+		informer: informer,
+		handler:  handler,
+		list: func(ctx context.Context, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+			return listServices([]v1.Service{testService("svc", "2")}, options), nil
+		},
+		grace: time.Millisecond,
+	}
+
+	divergences, err := checker.diff(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the watch delivers the update during the grace period
+	updated := testService("svc", "2")
+	store.Update(&updated)
+
+	for _, d := range divergences {
+		if err := checker.repair(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(handler.events) != 0 {
+		t.Errorf("expected no repair of the lagging watch, got %q", handler.events)
+	}
+}
+
+// fakeInformer is an informer serving a store, without listing or watching.
+type fakeInformer struct {
+	cache.SharedIndexInformer
+	store cache.Store
+}
+
+func (i *fakeInformer) GetStore() cache.Store { return i.store }
@@ -0,0 +1,119 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube2store
+
+import (
+	v1 "k8s.io/api/core/v1"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	proxystore "sigs.k8s.io/kpng/server/proxystore"
+)
+
+// endpointsEventHandler consumes the Endpoints of the clusters not serving the EndpointSlices (see
+// Config.EndpointsSource). The endpoints of a service are the source named after it.
+type endpointsEventHandler struct{ eventHandler }
+
+func (h endpointsEventHandler) OnAdd(obj interface{}) {
+	eps := obj.(*v1.Endpoints)
+
+	if !h.config.handlesNamespace(eps.Namespace) {
+		h.s.Update(func(tx *proxystore.Tx) { h.updateSync(proxystore.Endpoints, tx) })
+		return
+	}
+
+	defer traceEvent("Endpoints", eps.Namespace, eps.Name)()
+
+	h.s.Update(func(tx *proxystore.Tx) {
+		infos := endpointsInfos(tx, eps)
+
+		h.quota.setSlice(tx, eps.Namespace, eps.Name, eps.Name, infos)
+		h.updateSync(proxystore.Endpoints, tx)
+		h.portMismatches.check(tx, eps.Namespace, eps.Name)
+	})
+}
+
+func (h endpointsEventHandler) OnUpdate(oldObj, newObj interface{}) {
+	// same as adding
+	h.OnAdd(newObj)
+}
+
+func (h endpointsEventHandler) OnDelete(oldObj interface{}) {
+	eps := oldObj.(*v1.Endpoints)
+	defer traceEvent("Endpoints", eps.Namespace, eps.Name)()
+
+	h.s.Update(func(tx *proxystore.Tx) {
+		h.quota.delSlice(tx, eps.Namespace, eps.Name)
+		h.updateSync(proxystore.Endpoints, tx)
+		h.portMismatches.check(tx, eps.Namespace, eps.Name)
+	})
+}
+
+// endpointsInfos returns the endpoints of the Endpoints' subsets: the ready addresses, and the not ready ones (not
+// serving either, the Endpoints have no such distinction). The Endpoints have no zone, it's the one of the endpoint's
+// node if it's known.
+func endpointsInfos(tx *proxystore.Tx, eps *v1.Endpoints) []*localnetv1.EndpointInfo {
+	infos := make([]*localnetv1.EndpointInfo, 0)
+
+	for _, subset := range eps.Subsets {
+		ports := make([]*localnetv1.PortName, 0, len(subset.Ports))
+		for _, port := range subset.Ports {
+			ports = append(ports, &localnetv1.PortName{
+				Name:     port.Name,
+				Port:     port.Port,
+				Protocol: localnetv1.ParseProtocol(string(port.Protocol)),
+			})
+		}
+
+		add := func(addr v1.EndpointAddress, ready bool) {
+			info := &localnetv1.EndpointInfo{
+				Namespace:   eps.Namespace,
+				ServiceName: eps.Name,
+				SourceName:  eps.Name,
+				Endpoint:    &localnetv1.Endpoint{Hostname: addr.Hostname},
+				Conditions:  &localnetv1.EndpointConditions{Ready: ready, Serving: ready},
+				Topology:    &localnetv1.TopologyInfo{},
+			}
+
+			if t := addr.TargetRef; t != nil && t.Kind == "Pod" {
+				info.PodName = t.Name
+			}
+
+			if n := addr.NodeName; n != nil {
+				info.Topology.Node = *n
+				info.Topology.Zone = tx.GetNode(*n).GetTopology().GetZone()
+			}
+
+			// make them available to the backends
+			info.Endpoint.Conditions = info.Conditions
+			info.Endpoint.Topology = info.Topology
+
+			info.Endpoint.AddAddress(addr.IP)
+			info.Endpoint.PortOverrides = ports
+
+			infos = append(infos, info)
+		}
+
+		for _, addr := range subset.Addresses {
+			add(addr, true)
+		}
+		for _, addr := range subset.NotReadyAddresses {
+			add(addr, false)
+		}
+	}
+
+	return infos
+}
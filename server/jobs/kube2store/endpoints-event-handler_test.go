@@ -0,0 +1,80 @@
+package kube2store
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/proxystore"
+)
+
+func TestEndpointsEventHandler(t *testing.T) {
+	store := proxystore.New()
+
+	handler := endpointsEventHandler{
+		eventHandler: eventHandler{
+			s:       store,
+			syncSet: true,
+			config:  &Config{},
+		},
+	}
+
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetNode(&localnetv1.Node{Name: "node-a", Topology: &localnetv1.TopologyInfo{Node: "node-a", Zone: "zone-a"}})
+	})
+
+	endpoints := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-svc"},
+		Subsets: []v1.EndpointSubset{{
+			Addresses: []v1.EndpointAddress{{
+				IP:        "10.1.0.1",
+				NodeName:  ref("node-a"),
+				TargetRef: &v1.ObjectReference{Kind: "Pod", Name: "test-pod-a"},
+			}},
+			NotReadyAddresses: []v1.EndpointAddress{{IP: "10.1.0.2", NodeName: ref("node-b")}},
+			Ports:             []v1.EndpointPort{{Name: "http", Port: 8080, Protocol: v1.ProtocolTCP}},
+		}},
+	}
+
+	handler.OnAdd(endpoints)
+
+	infos := map[string]*localnetv1.EndpointInfo{}
+	store.View(0, func(tx *proxystore.Tx) {
+		tx.EachEndpointOfService("default", "test-svc", func(ei *localnetv1.EndpointInfo) {
+			infos[ei.Endpoint.IPs.V4[0]] = ei
+		})
+	})
+
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 endpoints, got %v", infos)
+	}
+
+	ready := infos["10.1.0.1"]
+	if !ready.Conditions.Ready || !ready.Conditions.Serving || ready.PodName != "test-pod-a" {
+		t.Errorf("unexpected ready endpoint %v", ready)
+	}
+	if topo := ready.Topology; topo.Node != "node-a" || topo.Zone != "zone-a" {
+		t.Errorf("expected the topology of node-a, got %v", topo)
+	}
+	if ports := ready.Endpoint.PortOverrides; len(ports) != 1 || ports[0].Name != "http" || ports[0].Port != 8080 {
+		t.Errorf("unexpected ports %v", ports)
+	}
+
+	notReady := infos["10.1.0.2"]
+	if notReady.Conditions.Ready || notReady.Conditions.Serving {
+		t.Errorf("expected a not ready endpoint, got %v", notReady)
+	}
+	if topo := notReady.Topology; topo.Node != "node-b" || topo.Zone != "" {
+		t.Errorf("expected node-b without zone (unknown node), got %v", topo)
+	}
+
+	handler.OnDelete(endpoints)
+
+	store.View(0, func(tx *proxystore.Tx) {
+		tx.EachEndpointOfService("default", "test-svc", func(ei *localnetv1.EndpointInfo) {
+			t.Errorf("unexpected endpoint after delete: %v", ei)
+		})
+	})
+}
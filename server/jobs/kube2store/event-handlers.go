@@ -17,7 +17,14 @@ limitations under the License.
 package kube2store
 
 import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	"sigs.k8s.io/kpng/client/tracing"
 	proxystore "sigs.k8s.io/kpng/server/proxystore"
 )
 
@@ -26,6 +33,13 @@ type eventHandler struct {
 	s        *proxystore.Store
 	informer cache.SharedIndexInformer
 	syncSet  bool
+
+	recorder       record.EventRecorder
+	portMismatches *portMismatches
+	quota          *namespaceQuota
+	exposure       *exposureWindows
+	health         *serviceHealth
+	fqdn           *fqdnResolver
 }
 
 func (h *eventHandler) updateSync(set proxystore.Set, tx *proxystore.Tx) {
@@ -38,3 +52,17 @@ func (h *eventHandler) updateSync(set proxystore.Set, tx *proxystore.Tx) {
 		h.syncSet = true
 	}
 }
+
+// traceEvent traces a watch event of a service or its endpoints (kpng.watch-event) until it's applied to the store,
+// when the returned function is called.
+func traceEvent(kind, namespace, name string) (end func()) {
+	_, span := tracing.Tracer().Start(context.Background(), "kpng.watch-event", trace.WithAttributes(
+		attribute.String("kpng.kind", kind),
+		tracing.ServicesAttribute.StringSlice([]string{namespace + "/" + name}),
+	))
+
+	return func() {
+		span.End()
+		tracing.RecordEvent(namespace, name, span.SpanContext())
+	}
+}
@@ -0,0 +1,407 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube2store
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/pkg/metrics"
+)
+
+// ExposureWindowsAnnotation restricts the external exposure of a service (node ports, external and load balancer IPs)
+// to time windows, separated by ";": "<days> <start>-<end>". Days are "*" or a comma separated list of days and
+// ranges of days, times are "HH:MM" (end may be "24:00", and before start to end on the next day), ie:
+// "Mon-Fri 08:00-20:00; Sat 22:00-02:00". The service stays reachable through its cluster IPs outside of the windows.
+const ExposureWindowsAnnotation = "kpng.k8s.io/exposure-windows"
+
+// ExposureTimezoneAnnotation is the IANA time zone of the exposure windows (UTC if not set), ie: "Europe/Paris".
+const ExposureTimezoneAnnotation = "kpng.k8s.io/exposure-timezone"
+
+// MaxExposureWindows is the maximum number of exposure windows of a service.
+const MaxExposureWindows = 16
+
+const minutesPerDay = 24 * 60
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+type exposureWindow struct {
+	days       [7]bool
+	start, end int // minutes in the day, end <= start if the window ends on the next day
+}
+
+// duration returns the length of the window in minutes.
+func (w exposureWindow) duration() int {
+	if w.end > w.start {
+		return w.end - w.start
+	}
+	return w.end + minutesPerDay - w.start
+}
+
+type exposureSchedule struct {
+	windows  []exposureWindow
+	location *time.Location
+}
+
+// parseExposureSchedule parses the values of the ExposureWindowsAnnotation and ExposureTimezoneAnnotation.
+func parseExposureSchedule(value, timezone string) (*exposureSchedule, error) {
+	schedule := &exposureSchedule{location: time.UTC}
+
+	if timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", timezone, err)
+		}
+		schedule.location = location
+	}
+
+	for _, spec := range strings.Split(value, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		if len(schedule.windows) == MaxExposureWindows {
+			return nil, fmt.Errorf("more than %d exposure windows", MaxExposureWindows)
+		}
+
+		w, err := parseExposureWindow(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exposure window %q: %w", spec, err)
+		}
+
+		schedule.windows = append(schedule.windows, w)
+	}
+
+	if len(schedule.windows) == 0 {
+		return nil, fmt.Errorf("no exposure window")
+	}
+
+	return schedule, nil
+}
+
+func parseExposureWindow(spec string) (w exposureWindow, err error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 2 {
+		err = fmt.Errorf("expected \"<days> <start>-<end>\"")
+		return
+	}
+
+	if w.days, err = parseDays(fields[0]); err != nil {
+		return
+	}
+
+	start, end, ok := strings.Cut(fields[1], "-")
+	if !ok {
+		err = fmt.Errorf("expected a time range, got %q", fields[1])
+		return
+	}
+
+	if w.start, err = parseTimeOfDay(start); err != nil {
+		return
+	}
+	if w.end, err = parseTimeOfDay(end); err != nil {
+		return
+	}
+
+	if w.start == minutesPerDay {
+		err = fmt.Errorf("start can't be 24:00")
+		return
+	}
+	if w.end == w.start {
+		err = fmt.Errorf("empty window")
+		return
+	}
+	if w.end == minutesPerDay {
+		w.end = 0 // midnight on the next day
+	}
+
+	return
+}
+
+func parseDays(spec string) (days [7]bool, err error) {
+	if spec == "*" {
+		for i := range days {
+			days[i] = true
+		}
+		return
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(strings.ToLower(item), "-")
+		if !isRange {
+			to = from
+		}
+
+		first, ok := weekdays[from]
+		if !ok {
+			err = fmt.Errorf("invalid day %q", from)
+			return
+		}
+		last, ok := weekdays[to]
+		if !ok {
+			err = fmt.Errorf("invalid day %q", to)
+			return
+		}
+
+		// ranges may wrap around the week, ie: Fri-Mon
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return
+}
+
+// parseTimeOfDay parses a "HH:MM" time (up to 24:00) in minutes.
+func parseTimeOfDay(s string) (int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	if !ok || len(hh) != 2 || len(mm) != 2 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+
+	h, err := strconv.Atoi(hh)
+	if err != nil || h < 0 || h > 24 {
+		return 0, fmt.Errorf("invalid hour in %q", s)
+	}
+	m, err := strconv.Atoi(mm)
+	if err != nil || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid minute in %q", s)
+	}
+
+	return h*60 + m, nil
+}
+
+// active returns true if t is in one of the windows.
+func (s *exposureSchedule) active(t time.Time) bool {
+	t = t.In(s.location)
+	minute := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+
+	for _, w := range s.windows {
+		if w.days[today] && minute >= w.start && minute < w.start+w.duration() {
+			return true
+		}
+		// the window of the previous day ending today
+		if w.days[yesterday] && w.end <= w.start && minute < w.end {
+			return true
+		}
+	}
+	return false
+}
+
+// nextChange returns the next time after t the activation changes, or the zero time if it never changes.
+func (s *exposureSchedule) nextChange(t time.Time) time.Time {
+	t = t.In(s.location)
+	current := s.active(t)
+
+	boundaries := make([]time.Time, 0, 2*8*len(s.windows))
+	for d := -1; d <= 7; d++ {
+		day := t.AddDate(0, 0, d)
+		for _, w := range s.windows {
+			if !w.days[day.Weekday()] {
+				continue
+			}
+			start := time.Date(day.Year(), day.Month(), day.Day(), 0, w.start, 0, 0, s.location)
+			end := time.Date(day.Year(), day.Month(), day.Day(), 0, w.start+w.duration(), 0, 0, s.location)
+			boundaries = append(boundaries, start, end)
+		}
+	}
+
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i].Before(boundaries[j]) })
+
+	for _, b := range boundaries {
+		if b.After(t) && s.active(b) != current {
+			return b
+		}
+	}
+	return time.Time{}
+}
+
+// suspendExternalExposure removes the node ports, external and load balancer IPs of the service, leaving it
+// reachable through its cluster IPs only.
+func suspendExternalExposure(service *localnetv1.Service) {
+	service.ExternalExposureSuspended = true
+
+	switch v1.ServiceType(service.Type) {
+	case v1.ServiceTypeNodePort, v1.ServiceTypeLoadBalancer:
+		service.Type = string(v1.ServiceTypeClusterIP)
+	}
+
+	service.IPs.ExternalIPs = localnetv1.NewIPSet()
+	service.IPs.LoadBalancerIPs = nil
+	service.IPFilters = nil
+	service.HealthCheckNodePort = 0
+
+	for _, port := range service.Ports {
+		port.NodePort = 0
+	}
+}
+
+// exposureWindows publishes the services having exposure windows with their external exposure activated or
+// suspended, and publishes them again when the activation changes.
+type exposureWindows struct {
+	recorder record.EventRecorder
+	now      func() time.Time
+
+	mu       sync.Mutex
+	services map[string]*exposure // service path -> exposure
+}
+
+type exposure struct {
+	svc      *v1.Service
+	schedule *exposureSchedule
+	service  *localnetv1.Service // with its external exposure
+	publish  func(service *localnetv1.Service)
+	active   bool
+	timer    *time.Timer
+}
+
+func newExposureWindows(recorder record.EventRecorder) *exposureWindows {
+	return &exposureWindows{
+		recorder: recorder,
+		now:      time.Now,
+		services: map[string]*exposure{},
+	}
+}
+
+// apply publishes the service, suspending its external exposure if it's outside of the schedule's windows, and
+// schedules its next activation change.
+func (ew *exposureWindows) apply(svc *v1.Service, schedule *exposureSchedule, service *localnetv1.Service,
+	publish func(service *localnetv1.Service)) {
+	if ew == nil {
+		if !schedule.active(time.Now()) {
+			suspendExternalExposure(service)
+		}
+		publish(service)
+		return
+	}
+
+	path := svc.Namespace + "/" + svc.Name
+
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+
+	e := ew.services[path]
+	if e == nil {
+		e = &exposure{active: true} // services are exposed until they have windows
+		ew.services[path] = e
+	} else if e.timer != nil {
+		e.timer.Stop()
+	}
+
+	e.svc = svc
+	e.schedule = schedule
+	e.service = service
+	e.publish = publish
+
+	ew.update(path, e)
+}
+
+// update publishes the service with its current activation, reporting changes. ew.mu must be held.
+func (ew *exposureWindows) update(path string, e *exposure) {
+	now := ew.now()
+	active := e.schedule.active(now)
+
+	service := e.service
+	if !active {
+		service = proto.Clone(service).(*localnetv1.Service)
+		suspendExternalExposure(service)
+	}
+	e.publish(service)
+
+	value := 0.
+	if active {
+		value = 1
+	}
+	metrics.Kpng_service_external_exposure_active.WithLabelValues(e.svc.Namespace, e.svc.Name).Set(value)
+
+	if active != e.active {
+		e.active = active
+		ew.report(e.svc, active)
+	}
+
+	e.timer = nil
+	if next := e.schedule.nextChange(now); !next.IsZero() {
+		e.timer = time.AfterFunc(next.Sub(now), func() { ew.transition(path, e) })
+	}
+}
+
+// transition publishes the service again when its activation changes.
+func (ew *exposureWindows) transition(path string, e *exposure) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+
+	if ew.services[path] != e {
+		return // forgotten
+	}
+
+	ew.update(path, e)
+}
+
+func (ew *exposureWindows) report(svc *v1.Service, active bool) {
+	reason, msg := "ExternalExposureActivated", "entering an exposure window, the service is exposed outside of the cluster"
+	if !active {
+		reason, msg = "ExternalExposureSuspended", "leaving the exposure windows, the service is only reachable through its cluster IPs"
+	}
+
+	klog.Infof("service %s/%s: %s", svc.Namespace, svc.Name, msg)
+
+	if ew.recorder != nil {
+		ew.recorder.Event(svc, v1.EventTypeNormal, reason, msg)
+	}
+}
+
+// forget clears the state of a service without exposure windows (or deleted).
+func (ew *exposureWindows) forget(namespace, name string) {
+	if ew == nil {
+		return
+	}
+
+	path := namespace + "/" + name
+
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+
+	e := ew.services[path]
+	if e == nil {
+		return
+	}
+
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	delete(ew.services, path)
+
+	metrics.Kpng_service_external_exposure_active.DeleteLabelValues(namespace, name)
+}
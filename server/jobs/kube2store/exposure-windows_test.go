@@ -0,0 +1,212 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube2store
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	proxystore "sigs.k8s.io/kpng/server/proxystore"
+)
+
+// monday is Monday 2022-10-03 00:00 UTC
+var monday = time.Date(2022, 10, 3, 0, 0, 0, 0, time.UTC)
+
+func at(day, hour, minute int) time.Time {
+	return monday.Add(time.Duration(day)*24*time.Hour + time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+}
+
+func TestParseExposureSchedule(t *testing.T) {
+	for _, test := range []struct {
+		value, timezone string
+		err             string
+	}{
+		{value: "Mon-Fri 08:00-20:00; Sat 22:00-02:00"},
+		{value: "* 00:00-24:00", timezone: "Europe/Paris"},
+		{value: "fri-mon,wed 10:00-11:30"},
+		{value: "", err: "no exposure window"},
+		{value: "Mon 08:00", err: "expected a time range"},
+		{value: "Mon", err: `expected "<days> <start>-<end>"`},
+		{value: "Mo 08:00-10:00", err: `invalid day "mo"`},
+		{value: "Mon 8:00-10:00", err: "expected HH:MM"},
+		{value: "Mon 08:00-24:30", err: "invalid minute"},
+		{value: "Mon 25:00-10:00", err: "invalid hour"},
+		{value: "Mon 24:00-10:00", err: "start can't be 24:00"},
+		{value: "Mon 08:00-08:00", err: "empty window"},
+		{value: "Mon 08:00-10:00", timezone: "Mars/Olympus", err: "invalid time zone"},
+		{value: strings.Repeat("Mon 08:00-10:00;", MaxExposureWindows+1), err: "more than 16 exposure windows"},
+	} {
+		_, err := parseExposureSchedule(test.value, test.timezone)
+
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", test.value, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected error %q, got %v", test.value, test.err, err)
+		}
+	}
+}
+
+func TestExposureScheduleActivation(t *testing.T) {
+	if monday.Weekday() != time.Monday {
+		t.Fatal("the reference date is not a monday")
+	}
+
+	schedule, err := parseExposureSchedule("Mon-Fri 08:00-20:00; Sat 22:00-02:00", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		t          time.Time
+		active     bool
+		nextChange time.Time
+	}{
+		{at(0, 7, 59), false, at(0, 8, 0)},
+		{at(0, 8, 0), true, at(0, 20, 0)},
+		{at(0, 19, 59), true, at(0, 20, 0)},
+		{at(0, 20, 0), false, at(1, 8, 0)},
+		{at(4, 20, 0), false, at(5, 22, 0)}, // friday evening
+		{at(5, 23, 0), true, at(6, 2, 0)},   // saturday night
+		{at(6, 1, 59), true, at(6, 2, 0)},   // sunday, in the window of saturday
+		{at(6, 2, 0), false, at(7, 8, 0)},
+	} {
+		if active := schedule.active(test.t); active != test.active {
+			t.Errorf("%v: expected active=%v", test.t, test.active)
+		}
+		if next := schedule.nextChange(test.t); !next.Equal(test.nextChange) {
+			t.Errorf("%v: expected next change at %v, got %v", test.t, test.nextChange, next)
+		}
+	}
+
+	// always active
+	schedule, err = parseExposureSchedule("* 00:00-24:00", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !schedule.active(at(2, 0, 0)) || !schedule.nextChange(at(2, 0, 0)).IsZero() {
+		t.Error("expected an always active schedule")
+	}
+
+	// time zones
+	schedule, err = parseExposureSchedule("Mon 08:00-09:00", "America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule.active(at(0, 8, 30)) || !schedule.active(at(0, 12, 30)) {
+		t.Error("expected the window to be in New York's time zone")
+	}
+}
+
+func TestExposureWindows(t *testing.T) {
+	store := proxystore.New()
+	defer store.Close()
+
+	recorder := record.NewFakeRecorder(10)
+	exposure := newExposureWindows(recorder)
+
+	now := at(0, 12, 0)
+	exposure.now = func() time.Time { return now }
+
+	handler := &serviceEventHandler{eventHandler{
+		s:        store,
+		syncSet:  true,
+		config:   &Config{},
+		exposure: exposure,
+	}}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "batch",
+			Annotations: map[string]string{ExposureWindowsAnnotation: "Mon-Fri 08:00-20:00"},
+		},
+		Spec: v1.ServiceSpec{
+			Type:        v1.ServiceTypeLoadBalancer,
+			ClusterIP:   "10.0.0.1",
+			ExternalIPs: []string{"192.0.2.1"},
+			Ports:       []v1.ServicePort{{Name: "http", Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080}},
+		},
+		Status: v1.ServiceStatus{LoadBalancer: v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "203.0.113.1"}}}},
+	}
+
+	published := func() (service *localnetv1.Service) {
+		store.View(0, func(tx *proxystore.Tx) {
+			service = tx.GetService("default", "batch")
+		})
+		return
+	}
+
+	checkExposed := func(expected bool) {
+		t.Helper()
+		service := published()
+		if service == nil {
+			t.Fatal("service not published")
+		}
+		exposed := service.Type == "LoadBalancer" && service.Ports[0].NodePort == 30080 &&
+			len(service.IPs.ExternalIPs.All()) == 1 && len(service.IPs.LoadBalancerIPs.All()) == 1
+		if exposed != expected || service.ExternalExposureSuspended == expected {
+			t.Errorf("expected exposed=%v, got %v", expected, service)
+		}
+		if ips := service.IPs.ClusterIPs.All(); len(ips) != 1 || ips[0] != "10.0.0.1" {
+			t.Errorf("expected the cluster IP to stay, got %v", service.IPs.ClusterIPs)
+		}
+	}
+
+	// in a window
+	handler.onChange(svc)
+	checkExposed(true)
+
+	// leaving the window
+	now = at(0, 20, 0)
+	exposure.transition("default/batch", exposure.services["default/batch"])
+	checkExposed(false)
+
+	if event := <-recorder.Events; !strings.Contains(event, "ExternalExposureSuspended") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	// updates outside of the windows stay suspended
+	handler.onChange(svc)
+	checkExposed(false)
+
+	// entering the next window
+	now = at(1, 8, 0)
+	exposure.transition("default/batch", exposure.services["default/batch"])
+	checkExposed(true)
+
+	if event := <-recorder.Events; !strings.Contains(event, "ExternalExposureActivated") {
+		t.Errorf("unexpected event: %s", event)
+	}
+
+	// removing the annotation forgets the windows
+	now = at(1, 22, 0)
+	svc.Annotations = nil
+	handler.onChange(svc)
+	checkExposed(true)
+
+	if len(exposure.services) != 0 {
+		t.Errorf("expected no service with exposure windows, got %d", len(exposure.services))
+	}
+}
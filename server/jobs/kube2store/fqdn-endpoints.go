@@ -0,0 +1,247 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube2store
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"k8s.io/klog/v2"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	proxystore "sigs.k8s.io/kpng/server/proxystore"
+)
+
+// fqdnResolveTimeout is the max duration of the resolution of a name.
+const fqdnResolveTimeout = 5 * time.Second
+
+// lookupFunc resolves a name to its addresses (see net.Resolver.LookupIPAddr).
+type lookupFunc func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+// fqdnResolver proxies the endpoints of the FQDN slices to the addresses of their names: the names are resolved when
+// they're first seen, then periodically, and the slices are updated in the store when their addresses change. An
+// endpoint has an endpoint in the store per address (none until its name is resolved), and keeps its last addresses
+// when the resolution fails.
+type fqdnResolver struct {
+	store  *proxystore.Store
+	quota  *namespaceQuota
+	period time.Duration
+	lookup lookupFunc
+
+	// wake triggers a resolution, when new names are seen
+	wake chan struct{}
+
+	mu        sync.Mutex
+	slices    map[string]*fqdnSlice // namespace/slice name -> slice
+	addresses map[string][]string   // name -> sorted addresses, for the resolved names
+}
+
+type fqdnSlice struct {
+	namespace, name, serviceName string
+
+	// infos are the endpoints of the slice, by name
+	infos []*localnetv1.EndpointInfo
+}
+
+// newFQDNResolver returns the resolver of the FQDN slices, or nil if they aren't proxied.
+func newFQDNResolver(config *Config, store *proxystore.Store, quota *namespaceQuota) *fqdnResolver {
+	if config.FQDNResolvePeriod <= 0 {
+		return nil
+	}
+
+	return &fqdnResolver{
+		store:     store,
+		quota:     quota,
+		period:    config.FQDNResolvePeriod,
+		lookup:    net.DefaultResolver.LookupIPAddr,
+		wake:      make(chan struct{}, 1),
+		slices:    map[string]*fqdnSlice{},
+		addresses: map[string][]string{},
+	}
+}
+
+// setSlice records the endpoints (by name) of a FQDN slice, and returns its endpoints to store, with the addresses
+// resolved so far. Called in a store transaction. The endpoints of the FQDN slices aren't proxied if r is nil.
+func (r *fqdnResolver) setSlice(namespace, name, serviceName string, infos []*localnetv1.EndpointInfo) []*localnetv1.EndpointInfo {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	slice := &fqdnSlice{namespace: namespace, name: name, serviceName: serviceName, infos: infos}
+	r.slices[namespace+"/"+name] = slice
+
+	for _, info := range infos {
+		if _, resolved := r.addresses[info.Endpoint.FQDN]; !resolved {
+			r.wakeUp()
+			break
+		}
+	}
+
+	return r.resolved(slice)
+}
+
+// wakeUp triggers a resolution, unless one is already pending.
+func (r *fqdnResolver) wakeUp() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *fqdnResolver) delSlice(namespace, name string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.slices, namespace+"/"+name)
+}
+
+// resolved returns the endpoints of the slice, one per resolved address of their names.
+func (r *fqdnResolver) resolved(slice *fqdnSlice) []*localnetv1.EndpointInfo {
+	infos := make([]*localnetv1.EndpointInfo, 0, len(slice.infos))
+	for _, info := range slice.infos {
+		for _, addr := range r.addresses[info.Endpoint.FQDN] {
+			resolved := proto.Clone(info).(*localnetv1.EndpointInfo)
+			resolved.Endpoint.IPs = nil
+			resolved.Endpoint.AddAddress(addr)
+			infos = append(infos, resolved)
+		}
+	}
+	return infos
+}
+
+func (r *fqdnResolver) run(ctx context.Context) {
+	ticker := time.NewTicker(r.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.wake:
+		case <-ctx.Done():
+			return
+		}
+
+		r.resolve(ctx)
+	}
+}
+
+// resolve resolves the names of the slices, and updates the slices whose addresses changed in the store.
+func (r *fqdnResolver) resolve(ctx context.Context) {
+	r.mu.Lock()
+	names := map[string]bool{}
+	for _, slice := range r.slices {
+		for _, info := range slice.infos {
+			names[info.Endpoint.FQDN] = true
+		}
+	}
+	r.mu.Unlock()
+
+	addresses := make(map[string][]string, len(names))
+	for name := range names {
+		addrs, err := r.resolveName(ctx, name)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			klog.Warning("failed to resolve the endpoint name ", name, ", keeping its last addresses: ", err)
+			continue
+		}
+		addresses[name] = addrs
+	}
+
+	r.store.Update(func(tx *proxystore.Tx) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		changed := map[string]bool{}
+		for name, addrs := range addresses {
+			if previous, resolved := r.addresses[name]; !resolved || !equalStrings(previous, addrs) {
+				changed[name] = true
+			}
+			r.addresses[name] = addrs
+		}
+
+		// forget the names not used anymore
+		used := map[string]bool{}
+		for _, slice := range r.slices {
+			for _, info := range slice.infos {
+				used[info.Endpoint.FQDN] = true
+			}
+		}
+		for name := range r.addresses {
+			if !used[name] {
+				delete(r.addresses, name)
+			}
+		}
+
+		for _, slice := range r.slices {
+			for _, info := range slice.infos {
+				if changed[info.Endpoint.FQDN] {
+					r.quota.setSlice(tx, slice.namespace, slice.name, slice.serviceName, r.resolved(slice))
+					break
+				}
+			}
+		}
+	})
+}
+
+// resolveName returns the sorted addresses of the name.
+func (r *fqdnResolver) resolveName(ctx context.Context, name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, fqdnResolveTimeout)
+	defer cancel()
+
+	ipAddrs, err := r.lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	addrs := make([]string, 0, len(ipAddrs))
+	for _, ipAddr := range ipAddrs {
+		addr := ipAddr.IP.String()
+		if ipAddr.Zone != "" || seen[addr] {
+			continue // link-local addresses can't be proxied to, and duplicates once is enough
+		}
+		seen[addr] = true
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package kube2store
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/proxystore"
+)
+
+func fqdnTestStore() *proxystore.Store {
+	store := proxystore.New()
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetService(&localnetv1.Service{Namespace: "default", Name: "db", Type: "ClusterIP"})
+	})
+	return store
+}
+
+func TestFQDNResolver(t *testing.T) {
+	store := fqdnTestStore()
+
+	dns := map[string][]string{
+		"db.example.com": {"192.0.2.2", "192.0.2.1", "2001:db8::1"},
+	}
+	lookup := func(_ context.Context, host string) ([]net.IPAddr, error) {
+		addrs, ok := dns[host]
+		if !ok {
+			return nil, errors.New("no such host")
+		}
+		ipAddrs := []net.IPAddr{}
+		for _, addr := range addrs {
+			ipAddrs = append(ipAddrs, net.IPAddr{IP: net.ParseIP(addr)})
+		}
+		return ipAddrs, nil
+	}
+
+	config := &Config{FQDNResolvePeriod: time.Minute}
+	resolver := newFQDNResolver(config, store, nil)
+	resolver.lookup = lookup
+
+	h := eventHandler{s: store, syncSet: true, config: config, fqdn: resolver}
+	slices := sliceEventHandler{h}
+
+	slice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "db-abcde",
+			Labels:    map[string]string{discovery.LabelServiceName: "db"},
+		},
+		AddressType: discovery.AddressTypeFQDN,
+		Endpoints:   []discovery.Endpoint{{Addresses: []string{"db.example.com"}}},
+	}
+
+	endpoints := func() string {
+		addrs := []string{}
+		store.View(0, func(tx *proxystore.Tx) {
+			tx.EachEndpointOfService("default", "db", func(ei *localnetv1.EndpointInfo) {
+				if ei.Endpoint.FQDN != "db.example.com" {
+					t.Errorf("endpoint without its name: %v", ei)
+				}
+				addrs = append(addrs, ei.Endpoint.IPs.All()...)
+			})
+		})
+		sort.Strings(addrs)
+		return strings.Join(addrs, " ")
+	}
+
+	expect := func(expected string) {
+		t.Helper()
+		if got := endpoints(); got != expected {
+			t.Errorf("expected endpoints %q, got %q", expected, got)
+		}
+	}
+
+	// no endpoint until the name is resolved
+	slices.OnAdd(slice)
+	expect("")
+
+	select {
+	case <-resolver.wake:
+	default:
+		t.Fatal("a new name didn't trigger a resolution")
+	}
+
+	resolver.resolve(context.Background())
+	expect("192.0.2.1 192.0.2.2 2001:db8::1")
+
+	// the addresses change
+	dns["db.example.com"] = []string{"192.0.2.3"}
+	resolver.resolve(context.Background())
+	expect("192.0.2.3")
+
+	// the last addresses are kept when the resolution fails
+	delete(dns, "db.example.com")
+	resolver.resolve(context.Background())
+	expect("192.0.2.3")
+
+	// an update of the slice keeps the resolved addresses
+	slices.OnUpdate(slice, slice)
+	expect("192.0.2.3")
+
+	slices.OnDelete(slice)
+	expect("")
+
+	resolver.resolve(context.Background())
+	if len(resolver.addresses) != 0 {
+		t.Errorf("the names of the deleted slices are still resolved: %v", resolver.addresses)
+	}
+}
+
+func TestFQDNSlicesNotProxied(t *testing.T) {
+	store := fqdnTestStore()
+
+	h := eventHandler{s: store, syncSet: true, config: &Config{}}
+	slices := sliceEventHandler{h}
+
+	slices.OnAdd(&discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "db-abcde",
+			Labels:    map[string]string{discovery.LabelServiceName: "db"},
+		},
+		AddressType: discovery.AddressTypeFQDN,
+		Endpoints:   []discovery.Endpoint{{Addresses: []string{"db.example.com"}}},
+	})
+
+	store.View(0, func(tx *proxystore.Tx) {
+		tx.EachEndpointOfService("default", "db", func(ei *localnetv1.EndpointInfo) {
+			t.Errorf("unexpected endpoint %v", ei)
+		})
+	})
+}
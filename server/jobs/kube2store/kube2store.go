@@ -22,29 +22,69 @@ import (
 
 	"github.com/spf13/pflag"
 	v1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 
+	"sigs.k8s.io/kpng/server/pkg/metrics"
 	proxystore "sigs.k8s.io/kpng/server/proxystore"
 )
 
 type Config struct {
-	UseSlices     bool
+	// EndpointsSource is the API the endpoints are read from (see the EndpointsSource* values)
+	EndpointsSource string
 
 	ServiceProxyName string
 
+	// ServiceSelector is a label selector the services must match, and Namespaces the namespaces of the services
+	// and endpoints handled (all if empty), so kpng only handles a part of the services (ie: next to another proxy)
+	ServiceSelector string
+	Namespaces      []string
+
+	// NodeName is the only node watched, in node-local mode: the brain runs on each node, with its backend, instead
+	// of in a central server (all the nodes if empty)
+	NodeName string
+
 	ServiceLabelGlobs      []string
 	ServiceAnnonationGlobs []string
 
 	NodeLabelGlobs      []string
 	NodeAnnotationGlobs []string
+
+	// Per-namespace limits of the programmed services, endpoints and node ports (no limit if 0)
+	MaxServicesPerNamespace  int
+	MaxEndpointsPerNamespace int
+	MaxNodePortsPerNamespace int
+
+	// ConsistencyCheckPeriod is the interval of the listings of the services and endpoints comparing them to the
+	// watched state, repairing the missed events (disabled if 0)
+	ConsistencyCheckPeriod time.Duration
+
+	// FQDNResolvePeriod is the interval of the resolutions of the names of the endpoints of the FQDN EndpointSlices,
+	// proxied to their addresses (not proxied if 0)
+	FQDNResolvePeriod time.Duration
 }
 
+const (
+	// EndpointsSourceAuto reads the EndpointSlices if the API server serves them, the Endpoints otherwise.
+	EndpointsSourceAuto = "auto"
+	// EndpointsSourceSlices reads the discovery.k8s.io/v1 EndpointSlices.
+	EndpointsSourceSlices = "slices"
+	// EndpointsSourceEndpoints reads the v1 Endpoints, for the clusters without EndpointSlices (before 1.21).
+	EndpointsSourceEndpoints = "endpoints"
+)
+
 // TODO: need to find a better home for this
 const (
 	// LabelServiceProxyName indicates that an alternative service
@@ -53,32 +93,82 @@ const (
 )
 
 func (c *Config) BindFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.EndpointsSource, "endpoints-source", EndpointsSourceAuto, "the API to read the endpoints from: \""+EndpointsSourceSlices+"\" (discovery.k8s.io/v1 EndpointSlices), \""+EndpointsSourceEndpoints+"\" (v1 Endpoints, for clusters before 1.21) or \""+EndpointsSourceAuto+"\" (the slices if served)")
 	flags.StringVar(&c.ServiceProxyName, "service-proxy-name", "", "the "+LabelServiceProxyName+" match to use (handle normal services if not set)")
+	flags.StringVar(&c.ServiceSelector, "service-selector", "", "label selector of the services to handle (all if not set), ie \"proxy in (kpng)\"")
+	flags.StringSliceVar(&c.Namespaces, "namespaces", nil, "namespaces of the services to handle (all if not set)")
+
+	flags.StringVar(&c.NodeName, "node-scope", "", "only watch this node, when the brain runs on each node with its backend (ie: kpng kube to-local); all the nodes if not set")
 
 	flags.StringSliceVar(&c.ServiceLabelGlobs, "with-service-labels", nil, "service labels to include")
 	flags.StringSliceVar(&c.ServiceAnnonationGlobs, "with-service-annotations", nil, "service annotations to include")
 
 	flags.StringSliceVar(&c.NodeLabelGlobs, "with-node-labels", []string{
 		"kubernetes.io/hostname", "topology.kubernetes.io/zone", "topology.kubernetes.io/region",
-	}, "node labels to include")
+	}, "node labels to include (also sent to the backends with the node)")
 	flags.StringSliceVar(&c.NodeAnnotationGlobs, "with-node-annotations", nil, "node annotations to include")
+
+	flags.IntVar(&c.MaxServicesPerNamespace, "namespace-max-services", 0, "maximum number of services programmed per namespace (no limit if 0)")
+	flags.IntVar(&c.MaxEndpointsPerNamespace, "namespace-max-endpoints", 0, "maximum number of endpoints programmed per namespace (no limit if 0)")
+	flags.IntVar(&c.MaxNodePortsPerNamespace, "namespace-max-node-ports", 0, "maximum number of node ports programmed per namespace (no limit if 0)")
+
+	flags.DurationVar(&c.ConsistencyCheckPeriod, "consistency-check-period", 0, "interval of the listings of the services and endpoints from the API server, repairing the watch events missed (disabled if 0)")
+	flags.DurationVar(&c.FQDNResolvePeriod, "fqdn-resolve-period", 0, "interval of the resolutions of the names of the FQDN EndpointSlices' endpoints, proxied to their addresses (not proxied if 0)")
 }
 
 type Job struct {
 	Kube   *kubernetes.Clientset
 	Store  *proxystore.Store
 	Config *Config
+
+	recorder       record.EventRecorder
+	portMismatches *portMismatches
+	quota          *namespaceQuota
+	exposure       *exposureWindows
+	health         *serviceHealth
+	fqdn           *fqdnResolver
 }
 
 func (j Job) Run(ctx context.Context) {
 	stopCh := ctx.Done()
 
+	// report invalid services, services with endpoints not matching their ports, or exceeding their namespace quota, as events
+	var recorder record.EventRecorder
+	if j.Config.NodeName == "" {
+		eventBroadcaster := record.NewBroadcaster()
+		eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: j.Kube.CoreV1().Events("")})
+		defer eventBroadcaster.Shutdown()
+
+		recorder = eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "kpng"})
+	} else {
+		// every node would emit them
+		klog.Info("node-local mode for node ", j.Config.NodeName, ", the service events aren't emitted")
+	}
+
+	j.recorder = recorder
+	j.portMismatches = newPortMismatches(recorder)
+	j.quota = newNamespaceQuota(j.Config, recorder)
+	j.exposure = newExposureWindows(recorder)
+
+	// aggregate the applied-state reports of the nodes
+	j.health = newServiceHealth()
+	metrics.Handle(ServiceHealthPath, j.health)
+
+	// proxy the endpoints of the FQDN slices to the addresses of their names
+	j.fqdn = newFQDNResolver(j.Config, j.Store, j.quota)
+	if j.fqdn != nil {
+		go j.fqdn.run(ctx)
+	}
+
 	// start informers
 	factory := informers.NewSharedInformerFactoryWithOptions(j.Kube, time.Second*30)
 	factory.Start(stopCh)
 
 	labelSelector := j.getLabelSelector().String()
 	klog.Info("service label selector: ", labelSelector)
+	if len(j.Config.Namespaces) != 0 {
+		klog.Info("namespaces: ", j.Config.Namespaces)
+	}
 	svcFactory := informers.NewSharedInformerFactoryWithOptions(j.Kube, time.Second*30,
 		informers.WithTweakListOptions(func(options *metav1.ListOptions) { options.LabelSelector = labelSelector }))
 	svcFactory.Start(stopCh)
@@ -90,26 +180,147 @@ func (j Job) Run(ctx context.Context) {
 	servicesInformer.AddEventHandler(&serviceEventHandler{j.eventHandler(servicesInformer)})
 	go servicesInformer.Run(stopCh)
 
-	nodesInformer := coreFactory.Nodes().Informer()
+	nodesFactory := factory
+	if j.Config.NodeName != "" {
+		nodesFactory = informers.NewSharedInformerFactoryWithOptions(j.Kube, time.Second*30,
+			informers.WithTweakListOptions(j.Config.tweakNodeListOptions))
+		nodesFactory.Start(stopCh)
+	}
+
+	nodesInformer := nodesFactory.Core().V1().Nodes().Informer()
 	nodesInformer.AddEventHandler(&nodeEventHandler{j.eventHandler(nodesInformer)})
 	go nodesInformer.Run(stopCh)
 
-	slicesInformer := factory.Discovery().V1().EndpointSlices().Informer()
-	slicesInformer.AddEventHandler(&sliceEventHandler{j.eventHandler(slicesInformer)})
-	go slicesInformer.Run(stopCh)
+	var endpointsSourceInformer cache.SharedIndexInformer
+	var endpointsChecker *consistencyChecker
+	if j.useSlices() {
+		slicesInformer := factory.Discovery().V1().EndpointSlices().Informer()
+		slicesInformer.AddEventHandler(&sliceEventHandler{j.eventHandler(slicesInformer)})
+		go slicesInformer.Run(stopCh)
+		endpointsSourceInformer = slicesInformer
+
+		endpointsChecker = &consistencyChecker{
+			resource: "endpointslices",
+			informer: slicesInformer,
+			handler:  &sliceEventHandler{j.syncedEventHandler(slicesInformer)},
+			list: func(ctx context.Context, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+				return j.Kube.DiscoveryV1().EndpointSlices(namespace).List(ctx, options)
+			},
+		}
+	} else {
+		endpointsInformer := coreFactory.Endpoints().Informer()
+		endpointsInformer.AddEventHandler(&endpointsEventHandler{j.eventHandler(endpointsInformer)})
+		go endpointsInformer.Run(stopCh)
+		endpointsSourceInformer = endpointsInformer
+
+		endpointsChecker = &consistencyChecker{
+			resource: "endpoints",
+			informer: endpointsInformer,
+			handler:  &endpointsEventHandler{j.syncedEventHandler(endpointsInformer)},
+			list: func(ctx context.Context, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+				return j.Kube.CoreV1().Endpoints(namespace).List(ctx, options)
+			},
+		}
+	}
+
+	// repair the drift of the store from the API server, if watch events are missed
+	if period := j.Config.ConsistencyCheckPeriod; period > 0 {
+		servicesChecker := &consistencyChecker{
+			resource: "services",
+			informer: servicesInformer,
+			handler:  &serviceEventHandler{j.syncedEventHandler(servicesInformer)},
+			list: func(ctx context.Context, namespace string, options metav1.ListOptions) (runtime.Object, error) {
+				options.LabelSelector = labelSelector
+				return j.Kube.CoreV1().Services(namespace).List(ctx, options)
+			},
+		}
+
+		for _, checker := range []*consistencyChecker{servicesChecker, endpointsChecker} {
+			checker.grace = consistencyGrace
+			go checker.run(ctx, period)
+		}
+	}
+
+	// drop the entries restored from a snapshot whose objects were deleted since (see store2snapshot)
+	go j.pruneWhenSynced(stopCh, proxystore.Services, servicesInformer, func(kv *proxystore.KV) string {
+		return kv.Namespace + "/" + kv.Name
+	})
+	go j.pruneWhenSynced(stopCh, proxystore.Nodes, nodesInformer, func(kv *proxystore.KV) string {
+		return kv.Name
+	})
+	go j.pruneWhenSynced(stopCh, proxystore.Endpoints, endpointsSourceInformer, func(kv *proxystore.KV) string {
+		return kv.Namespace + "/" + kv.Source
+	})
 
 	<-stopCh
 	j.Store.Close()
 }
 
+// pruneWhenSynced deletes the entries of the set whose object (at the informer's key) doesn't exist, once the
+// informer listed them. The entries restored from a snapshot are served until then, and the entries of the objects
+// still there are replaced when their events are handled.
+func (j Job) pruneWhenSynced(stopCh <-chan struct{}, set proxystore.Set, informer cache.SharedIndexInformer,
+	key func(kv *proxystore.KV) string) {
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		return
+	}
+
+	j.Store.Update(func(tx *proxystore.Tx) {
+		pruned := tx.Prune(set, func(kv *proxystore.KV) bool {
+			_, exists, err := informer.GetStore().GetByKey(key(kv))
+			return exists || err != nil
+		})
+
+		if pruned != 0 {
+			klog.Info("pruned ", pruned, " entries of ", set, " deleted since the snapshot")
+		}
+	})
+}
+
+// useSlices returns true if the endpoints are read from the EndpointSlices.
+func (j Job) useSlices() bool {
+	switch j.Config.EndpointsSource {
+	case EndpointsSourceSlices:
+		return true
+	case EndpointsSourceEndpoints:
+		return false
+	case EndpointsSourceAuto, "":
+	default:
+		klog.Exitf("invalid endpoints source %q", j.Config.EndpointsSource)
+	}
+
+	if _, err := j.Kube.Discovery().ServerResourcesForGroupVersion(discovery.SchemeGroupVersion.String()); err != nil {
+		if !apierrors.IsNotFound(err) {
+			klog.Warning("failed to check if the EndpointSlices are served, assuming they are: ", err)
+			return true
+		}
+		klog.Info(discovery.SchemeGroupVersion, " isn't served, reading the endpoints from the v1 Endpoints")
+		return false
+	}
+	return true
+}
+
 func (j Job) eventHandler(informer cache.SharedIndexInformer) eventHandler {
 	return eventHandler{
-		config:   j.Config,
-		s:        j.Store,
-		informer: informer,
+		config:         j.Config,
+		s:              j.Store,
+		informer:       informer,
+		recorder:       j.recorder,
+		portMismatches: j.portMismatches,
+		quota:          j.quota,
+		exposure:       j.exposure,
+		health:         j.health,
+		fqdn:           j.fqdn,
 	}
 }
 
+// syncedEventHandler returns an event handler for the changes after the informer's initial listing.
+func (j Job) syncedEventHandler(informer cache.SharedIndexInformer) eventHandler {
+	h := j.eventHandler(informer)
+	h.syncSet = true
+	return h
+}
+
 func (j Job) getLabelSelector() labels.Selector {
 	labelSelector := labels.NewSelector()
 
@@ -130,5 +341,34 @@ func (j Job) getLabelSelector() labels.Selector {
 
 	addReq(v1.IsHeadlessService, selection.DoesNotExist)
 
+	if j.Config.ServiceSelector != "" {
+		selector, err := labels.Parse(j.Config.ServiceSelector)
+		if err != nil {
+			klog.Exit("invalid service selector: ", err)
+		}
+
+		reqs, _ := selector.Requirements()
+		labelSelector = labelSelector.Add(reqs...)
+	}
+
 	return labelSelector
 }
+
+// tweakNodeListOptions restricts the watch of the nodes to Config.NodeName.
+func (c *Config) tweakNodeListOptions(options *metav1.ListOptions) {
+	options.FieldSelector = fields.OneTermEqualSelector("metadata.name", c.NodeName).String()
+}
+
+// handlesNamespace returns true if the services and endpoints of the namespace are handled (see Config.Namespaces).
+func (c *Config) handlesNamespace(namespace string) bool {
+	if len(c.Namespaces) == 0 {
+		return true
+	}
+
+	for _, ns := range c.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package kube2store
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/kpng/server/proxystore"
+)
+
+func TestServiceSelector(t *testing.T) {
+	for _, test := range []struct {
+		config   Config
+		expected string
+	}{
+		{Config{}, "!service.kubernetes.io/headless,!service.kubernetes.io/service-proxy-name"},
+		{Config{ServiceProxyName: "kpng"}, "!service.kubernetes.io/headless,service.kubernetes.io/service-proxy-name=kpng"},
+		{Config{ServiceSelector: "proxy in (kpng),tier!=legacy"}, "proxy in (kpng),!service.kubernetes.io/headless,!service.kubernetes.io/service-proxy-name,tier!=legacy"},
+	} {
+		if selector := (Job{Config: &test.config}).getLabelSelector().String(); selector != test.expected {
+			t.Errorf("%+v: expected %q, got %q", test.config, test.expected, selector)
+		}
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	store := proxystore.New()
+
+	handler := serviceEventHandler{
+		eventHandler: eventHandler{
+			s:       store,
+			syncSet: true,
+			config:  &Config{Namespaces: []string{"team-a", "team-b"}},
+		},
+	}
+
+	for _, ns := range []string{"team-a", "team-b", "team-c"} {
+		handler.onChange(&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "test-svc"},
+			Spec:       v1.ServiceSpec{Type: v1.ServiceTypeClusterIP},
+		})
+	}
+
+	handled := map[string]bool{}
+	store.View(0, func(tx *proxystore.Tx) {
+		tx.Each(proxystore.Services, func(kv *proxystore.KV) bool {
+			handled[kv.Namespace] = true
+			return true
+		})
+	})
+
+	if len(handled) != 2 || !handled["team-a"] || !handled["team-b"] {
+		t.Errorf("expected the services of team-a and team-b only, got %v", handled)
+	}
+}
+
+func TestNodeScope(t *testing.T) {
+	options := &metav1.ListOptions{}
+	(&Config{NodeName: "node-1"}).tweakNodeListOptions(options)
+
+	if expected := "metadata.name=node-1"; options.FieldSelector != expected {
+		t.Errorf("expected the field selector %q, got %q", expected, options.FieldSelector)
+	}
+}
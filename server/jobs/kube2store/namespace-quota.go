@@ -0,0 +1,303 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube2store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/pkg/metrics"
+	proxystore "sigs.k8s.io/kpng/server/proxystore"
+)
+
+// namespaceQuota limits the dataplane footprint of each namespace, so a single tenant can't exhaust the nodes'
+// rule capacity or the node port space. Services are admitted in creation order while their namespace stays
+// within its limits; the others (and their endpoints) are kept out of the store, and reported as events, until
+// enough room is freed.
+type namespaceQuota struct {
+	recorder record.EventRecorder
+
+	maxServices  int
+	maxEndpoints int
+	maxNodePorts int
+
+	mu         sync.Mutex
+	namespaces map[string]*quotaNamespace
+}
+
+type quotaNamespace struct {
+	services map[string]*quotaService // service name -> service
+	slices   map[string]*quotaSlice   // slice name -> slice
+}
+
+type quotaService struct {
+	service  *localnetv1.Service
+	created  time.Time
+	decided  bool
+	admitted bool
+	reported string // last reported reason
+}
+
+type quotaSlice struct {
+	serviceName string
+	infos       []*localnetv1.EndpointInfo
+}
+
+// newNamespaceQuota returns the quota enforcer, or nil if no limit is configured.
+func newNamespaceQuota(config *Config, recorder record.EventRecorder) *namespaceQuota {
+	if config.MaxServicesPerNamespace <= 0 && config.MaxEndpointsPerNamespace <= 0 && config.MaxNodePortsPerNamespace <= 0 {
+		return nil
+	}
+
+	return &namespaceQuota{
+		recorder:     recorder,
+		maxServices:  config.MaxServicesPerNamespace,
+		maxEndpoints: config.MaxEndpointsPerNamespace,
+		maxNodePorts: config.MaxNodePortsPerNamespace,
+		namespaces:   map[string]*quotaNamespace{},
+	}
+}
+
+func (q *namespaceQuota) namespace(name string) *quotaNamespace {
+	ns := q.namespaces[name]
+	if ns == nil {
+		ns = &quotaNamespace{
+			services: map[string]*quotaService{},
+			slices:   map[string]*quotaSlice{},
+		}
+		q.namespaces[name] = ns
+	}
+	return ns
+}
+
+func (q *namespaceQuota) setService(tx *proxystore.Tx, service *localnetv1.Service, created time.Time) {
+	if q == nil {
+		tx.SetService(service)
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ns := q.namespace(service.Namespace)
+
+	qs := ns.services[service.Name]
+	if qs == nil {
+		qs = &quotaService{}
+		ns.services[service.Name] = qs
+	}
+
+	qs.service = service
+	qs.created = created
+
+	if qs.admitted {
+		tx.SetService(service)
+	}
+
+	q.apply(tx, service.Namespace, ns)
+}
+
+func (q *namespaceQuota) delService(tx *proxystore.Tx, namespace, name string) {
+	if q == nil {
+		tx.DelService(namespace, name)
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ns := q.namespace(namespace)
+	delete(ns.services, name)
+
+	tx.DelService(namespace, name)
+
+	q.apply(tx, namespace, ns)
+}
+
+func (q *namespaceQuota) setSlice(tx *proxystore.Tx, namespace, sliceName, serviceName string, infos []*localnetv1.EndpointInfo) {
+	if q == nil {
+		tx.SetEndpointsOfSource(namespace, sliceName, infos)
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ns := q.namespace(namespace)
+	ns.slices[sliceName] = &quotaSlice{serviceName: serviceName, infos: infos}
+
+	// endpoints of unknown services are not programmed anyway
+	if qs := ns.services[serviceName]; qs == nil || qs.admitted {
+		tx.SetEndpointsOfSource(namespace, sliceName, infos)
+	}
+
+	q.apply(tx, namespace, ns)
+}
+
+func (q *namespaceQuota) delSlice(tx *proxystore.Tx, namespace, sliceName string) {
+	if q == nil {
+		tx.DelEndpointsOfSource(namespace, sliceName)
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ns := q.namespace(namespace)
+	delete(ns.slices, sliceName)
+
+	tx.DelEndpointsOfSource(namespace, sliceName)
+
+	q.apply(tx, namespace, ns)
+}
+
+// apply recomputes the admitted services of a namespace, updating the store for the services changing state.
+func (q *namespaceQuota) apply(tx *proxystore.Tx, namespace string, ns *quotaNamespace) {
+	services := make([]*quotaService, 0, len(ns.services))
+	for _, qs := range ns.services {
+		services = append(services, qs)
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		a, b := services[i], services[j]
+		if !a.created.Equal(b.created) {
+			return a.created.Before(b.created)
+		}
+		return a.service.Name < b.service.Name
+	})
+
+	endpointsOf := map[string]int{}
+	for _, slice := range ns.slices {
+		endpointsOf[slice.serviceName] += len(slice.infos)
+	}
+
+	serviceCount, endpointCount, nodePortCount, rejected := 0, 0, 0, 0
+
+	for _, qs := range services {
+		name := qs.service.Name
+		endpoints := endpointsOf[name]
+		nodePorts := nodePortsOf(qs.service)
+
+		reason := q.exceeded(serviceCount+1, endpointCount+endpoints, nodePortCount+nodePorts)
+
+		if reason == "" {
+			serviceCount++
+			endpointCount += endpoints
+			nodePortCount += nodePorts
+
+			if !qs.admitted {
+				tx.SetService(qs.service)
+				ns.eachSliceOf(name, func(sliceName string, slice *quotaSlice) {
+					tx.SetEndpointsOfSource(namespace, sliceName, slice.infos)
+				})
+			}
+		} else {
+			rejected++
+
+			if qs.admitted || !qs.decided {
+				tx.DelService(namespace, name)
+				ns.eachSliceOf(name, func(sliceName string, _ *quotaSlice) {
+					tx.DelEndpointsOfSource(namespace, sliceName)
+				})
+			}
+		}
+
+		qs.admitted = reason == ""
+		qs.decided = true
+
+		q.report(namespace, qs, reason)
+	}
+
+	if rejected == 0 {
+		metrics.Kpng_namespace_quota_rejected_services.DeleteLabelValues(namespace)
+	} else {
+		metrics.Kpng_namespace_quota_rejected_services.WithLabelValues(namespace).Set(float64(rejected))
+	}
+
+	if len(ns.services) == 0 && len(ns.slices) == 0 {
+		delete(q.namespaces, namespace)
+	}
+}
+
+// exceeded returns the reason the given namespace totals exceed the quota, if they do.
+func (q *namespaceQuota) exceeded(services, endpoints, nodePorts int) string {
+	switch {
+	case q.maxServices > 0 && services > q.maxServices:
+		return fmt.Sprintf("namespace quota of %d services exceeded", q.maxServices)
+	case q.maxEndpoints > 0 && endpoints > q.maxEndpoints:
+		return fmt.Sprintf("namespace quota of %d endpoints exceeded", q.maxEndpoints)
+	case q.maxNodePorts > 0 && nodePorts > q.maxNodePorts:
+		return fmt.Sprintf("namespace quota of %d node ports exceeded", q.maxNodePorts)
+	}
+	return ""
+}
+
+// report logs and records the service's admission when it changes.
+func (q *namespaceQuota) report(namespace string, qs *quotaService, reason string) {
+	if qs.reported == reason {
+		return
+	}
+	qs.reported = reason
+
+	path := namespace + "/" + qs.service.Name
+
+	if reason == "" {
+		klog.Infof("service %s: within the namespace quota, programmed", path)
+		return
+	}
+
+	msg := "not programmed: " + reason
+
+	klog.Warningf("service %s: %s", path, msg)
+
+	if q.recorder != nil {
+		q.recorder.Event(&v1.ObjectReference{
+			Kind:       "Service",
+			APIVersion: "v1",
+			Namespace:  namespace,
+			Name:       qs.service.Name,
+		}, v1.EventTypeWarning, "NamespaceQuotaExceeded", msg)
+	}
+}
+
+func (ns *quotaNamespace) eachSliceOf(serviceName string, callback func(sliceName string, slice *quotaSlice)) {
+	for sliceName, slice := range ns.slices {
+		if slice.serviceName == serviceName {
+			callback(sliceName, slice)
+		}
+	}
+}
+
+// nodePortsOf counts the node ports allocated to a service, including the health check one.
+func nodePortsOf(service *localnetv1.Service) (count int) {
+	for _, port := range service.Ports {
+		if port.NodePort != 0 {
+			count++
+		}
+	}
+	if service.HealthCheckNodePort != 0 {
+		count++
+	}
+	return
+}
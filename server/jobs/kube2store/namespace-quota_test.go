@@ -0,0 +1,112 @@
+package kube2store
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/proxystore"
+)
+
+func TestNamespaceQuota(t *testing.T) {
+	store := proxystore.New()
+	recorder := record.NewFakeRecorder(10)
+
+	config := &Config{MaxServicesPerNamespace: 2, MaxEndpointsPerNamespace: 3}
+
+	h := eventHandler{
+		s:       store,
+		syncSet: true,
+		config:  config,
+		quota:   newNamespaceQuota(config, recorder),
+	}
+	services := &serviceEventHandler{h}
+	slices := sliceEventHandler{h}
+
+	epoch := time.Now()
+
+	service := func(name string, age int) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "tenant",
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(epoch.Add(time.Duration(age) * time.Second)),
+			},
+			Spec: v1.ServiceSpec{Type: v1.ServiceTypeClusterIP, ClusterIP: "10.0.0.1"},
+		}
+	}
+
+	slice := func(serviceName string, addresses ...string) *discovery.EndpointSlice {
+		s := &discovery.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "tenant",
+				Name:      serviceName + "-abcde",
+				Labels:    map[string]string{discovery.LabelServiceName: serviceName},
+			},
+		}
+		for _, addr := range addresses {
+			s.Endpoints = append(s.Endpoints, discovery.Endpoint{Addresses: []string{addr}})
+		}
+		return s
+	}
+
+	programmed := func() string {
+		names := []string{}
+		store.View(0, func(tx *proxystore.Tx) {
+			tx.Each(proxystore.Services, func(kv *proxystore.KV) bool {
+				name := kv.Name
+				count := 0
+				tx.EachEndpointOfService(kv.Namespace, kv.Name, func(_ *localnetv1.EndpointInfo) { count++ })
+				names = append(names, name+":"+strings.Repeat("e", count))
+				return true
+			})
+		})
+		sort.Strings(names)
+		return strings.Join(names, " ")
+	}
+
+	expect := func(expected string) {
+		t.Helper()
+		if got := programmed(); got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	}
+
+	services.OnAdd(service("a", 1))
+	slices.OnAdd(slice("a", "10.1.0.1"))
+	services.OnAdd(service("b", 2))
+	services.OnAdd(service("c", 3))
+
+	expect("a:e b:")
+
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "NamespaceQuotaExceeded") || !strings.Contains(event, "2 services") {
+			t.Errorf("unexpected event: %q", event)
+		}
+	default:
+		t.Error("expected an event for the rejected service")
+	}
+
+	// c's endpoints are kept out while it's rejected
+	slices.OnAdd(slice("c", "10.1.0.3"))
+	expect("a:e b:")
+
+	// deleting b frees room for c
+	services.OnDelete(service("b", 2))
+	expect("a:e c:e")
+
+	// a growing over the endpoints quota pushes c (created after a) out
+	slices.OnUpdate(nil, slice("a", "10.1.0.1", "10.1.0.2", "10.1.0.4"))
+	expect("a:eee")
+
+	slices.OnDelete(slice("a"))
+	expect("a: c:e")
+}
@@ -24,7 +24,8 @@ import (
 )
 
 const (
-	nodeZoneLabel = "topology.kubernetes.io/zone"
+	nodeZoneLabel   = "topology.kubernetes.io/zone"
+	nodeRegionLabel = "topology.kubernetes.io/region"
 )
 
 type nodeEventHandler struct{ eventHandler }
@@ -36,13 +37,16 @@ func (h *nodeEventHandler) OnAdd(obj interface{}) {
 	n := &localnetv1.Node{
 		Name: node.Name,
 		Topology: &localnetv1.TopologyInfo{
-			Node: node.Name,
-			Zone: node.Labels[nodeZoneLabel],
+			Node:   node.Name,
+			Zone:   node.Labels[nodeZoneLabel],
+			Region: node.Labels[nodeRegionLabel],
 		},
 		Labels:      globsFilter(node.Labels, h.config.NodeLabelGlobs),
 		Annotations: globsFilter(node.Annotations, h.config.NodeAnnotationGlobs),
 	}
 
+	h.health.setNode(node)
+
 	h.s.Update(func(tx *proxystore.Tx) {
 		tx.SetNode(n)
 
@@ -58,6 +62,8 @@ func (h *nodeEventHandler) OnUpdate(oldObj, newObj interface{}) {
 func (h *nodeEventHandler) OnDelete(oldObj interface{}) {
 	node := oldObj.(*v1.Node)
 
+	h.health.delNode(node.Name)
+
 	h.s.Update(func(tx *proxystore.Tx) {
 		tx.DelNode(node.Name)
 		h.updateSync(proxystore.Nodes, tx)
@@ -0,0 +1,121 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube2store
+
+import (
+	"fmt"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/pkg/metrics"
+	proxystore "sigs.k8s.io/kpng/server/proxystore"
+)
+
+// portMismatches reports services having endpoints that don't advertise the service's ports (or with another protocol).
+// Backends skip those (service port, endpoint) pairs, this makes it visible to users.
+type portMismatches struct {
+	recorder record.EventRecorder
+
+	mu       sync.Mutex
+	reported map[string]string // service path -> last reported message
+}
+
+func newPortMismatches(recorder record.EventRecorder) *portMismatches {
+	return &portMismatches{
+		recorder: recorder,
+		reported: map[string]string{},
+	}
+}
+
+// check counts the port mismatches of a service, reporting them when they change.
+func (pm *portMismatches) check(tx *proxystore.Tx, namespace, serviceName string) {
+	if pm == nil {
+		return
+	}
+
+	svc := tx.GetService(namespace, serviceName)
+	if svc == nil {
+		return
+	}
+
+	count := 0
+	firstReason := ""
+
+	tx.EachEndpointOfService(namespace, serviceName, func(ei *localnetv1.EndpointInfo) {
+		for _, port := range svc.Ports {
+			reason := ei.Endpoint.PortMismatch(port)
+			if reason == "" {
+				continue
+			}
+			if count == 0 {
+				firstReason = reason
+			}
+			count++
+		}
+	})
+
+	metrics.Kpng_endpoint_port_mismatches.WithLabelValues(namespace, serviceName).Set(float64(count))
+
+	msg := ""
+	if count != 0 {
+		msg = fmt.Sprintf("%d endpoint port(s) not programmed: %s", count, firstReason)
+	}
+
+	path := namespace + "/" + serviceName
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.reported[path] == msg {
+		return
+	}
+
+	if msg == "" {
+		delete(pm.reported, path)
+		return
+	}
+
+	pm.reported[path] = msg
+
+	klog.Warningf("service %s: %s", path, msg)
+
+	if pm.recorder != nil {
+		pm.recorder.Event(&v1.ObjectReference{
+			Kind:       "Service",
+			APIVersion: "v1",
+			Namespace:  namespace,
+			Name:       serviceName,
+		}, v1.EventTypeWarning, "EndpointPortMismatch", msg)
+	}
+}
+
+// forget clears the state of a deleted service.
+func (pm *portMismatches) forget(namespace, serviceName string) {
+	if pm == nil {
+		return
+	}
+
+	metrics.Kpng_endpoint_port_mismatches.DeleteLabelValues(namespace, serviceName)
+
+	pm.mu.Lock()
+	delete(pm.reported, namespace+"/"+serviceName)
+	pm.mu.Unlock()
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube2store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+)
+
+// PortRangesAnnotation maps ranges of ports of the service to ranges of the same size on the endpoints (ie: RTP
+// ranges of media servers), comma separated: "<port>-<endPort>[:<targetPort>][/<protocol>]". The target port
+// defaults to the port and the protocol to TCP, ie: "10000-10999:20000/UDP" maps 10000 to 20000, 10001 to 20001...
+const PortRangesAnnotation = "kpng.k8s.io/port-ranges"
+
+// MaxPortRanges is the maximum number of port ranges of a service.
+const MaxPortRanges = 16
+
+// parsePortRanges parses the value of the PortRangesAnnotation. The ranges must not overlap each other or the
+// service's ports.
+func parsePortRanges(value string, ports []*localnetv1.PortMapping) (ranges []*localnetv1.PortRange, err error) {
+	for _, spec := range strings.Split(value, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		if len(ranges) == MaxPortRanges {
+			return nil, fmt.Errorf("more than %d port ranges", MaxPortRanges)
+		}
+
+		r, err := parsePortRange(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port range %q: %w", spec, err)
+		}
+
+		for _, other := range ranges {
+			if r.Overlaps(other.Protocol, other.Port, other.EndPort) {
+				return nil, fmt.Errorf("port range %q overlaps %s", spec, other.Name())
+			}
+		}
+		for _, port := range ports {
+			if r.Overlaps(port.Protocol, port.Port, port.Port) {
+				return nil, fmt.Errorf("port range %q overlaps port %d", spec, port.Port)
+			}
+		}
+
+		ranges = append(ranges, r)
+	}
+
+	return
+}
+
+func parsePortRange(spec string) (r *localnetv1.PortRange, err error) {
+	r = &localnetv1.PortRange{Protocol: localnetv1.Protocol_TCP}
+
+	spec, protocol, hasProtocol := strings.Cut(spec, "/")
+	if hasProtocol {
+		r.Protocol = localnetv1.ParseProtocol(strings.ToUpper(protocol))
+	}
+
+	spec, target, hasTarget := strings.Cut(spec, ":")
+
+	port, endPort, ok := strings.Cut(spec, "-")
+	if !ok {
+		return nil, fmt.Errorf("expected <port>-<endPort>")
+	}
+
+	if r.Port, err = parsePort(port); err != nil {
+		return
+	}
+	if r.EndPort, err = parsePort(endPort); err != nil {
+		return
+	}
+
+	r.TargetPort = r.Port
+	if hasTarget {
+		if r.TargetPort, err = parsePort(target); err != nil {
+			return
+		}
+	}
+
+	if err = r.Validate(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func parsePort(s string) (int32, error) {
+	port, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return int32(port), nil
+}
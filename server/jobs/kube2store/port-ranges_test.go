@@ -0,0 +1,94 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube2store
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+)
+
+func TestParsePortRanges(t *testing.T) {
+	ports := []*localnetv1.PortMapping{
+		{Name: "sip", Protocol: localnetv1.Protocol_UDP, Port: 5060},
+	}
+
+	for _, test := range []struct {
+		value    string
+		expected []*localnetv1.PortRange
+		err      string
+	}{
+		{
+			value: "10000-10999:20000/UDP, 8000-8099",
+			expected: []*localnetv1.PortRange{
+				{Protocol: localnetv1.Protocol_UDP, Port: 10000, EndPort: 10999, TargetPort: 20000},
+				{Protocol: localnetv1.Protocol_TCP, Port: 8000, EndPort: 8099, TargetPort: 8000},
+			},
+		},
+		{
+			// same ports, other protocols
+			value: "5000-5099/tcp,5000-5099/sctp",
+			expected: []*localnetv1.PortRange{
+				{Protocol: localnetv1.Protocol_TCP, Port: 5000, EndPort: 5099, TargetPort: 5000},
+				{Protocol: localnetv1.Protocol_SCTP, Port: 5000, EndPort: 5099, TargetPort: 5000},
+			},
+		},
+		{value: "", expected: nil},
+		{value: "10000", err: "expected <port>-<endPort>"},
+		{value: "10000-x", err: `invalid port "x"`},
+		{value: "10000-10999/ICMP", err: "unknown protocol"},
+		{value: "10999-10000", err: "invalid end port 10000"},
+		{value: "10000-10999:65000", err: "invalid target port 65000"},
+		{value: "10000-10999,10500-11000", err: "overlaps range-10000-10999"},
+		{value: "5000-5100/UDP", err: "overlaps port 5060"},
+		{value: manyPortRanges(MaxPortRanges + 1), err: "more than 16 port ranges"},
+	} {
+		ranges, err := parsePortRanges(test.value, ports)
+
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: expected error %q, got %v", test.value, test.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.value, err)
+			continue
+		}
+
+		if len(ranges) != len(test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.value, test.expected, ranges)
+			continue
+		}
+		for i := range ranges {
+			if ranges[i].String() != test.expected[i].String() {
+				t.Errorf("%q: range %d: expected %v, got %v", test.value, i, test.expected[i], ranges[i])
+			}
+		}
+	}
+}
+
+func manyPortRanges(n int) string {
+	specs := make([]string, n)
+	for i := range specs {
+		specs[i] = fmt.Sprintf("%d-%d", 30000+10*i, 30009+10*i)
+	}
+	return strings.Join(specs, ",")
+}
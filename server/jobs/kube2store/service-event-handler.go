@@ -17,6 +17,9 @@ limitations under the License.
 package kube2store
 
 import (
+	"strconv"
+	"time"
+
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/klog/v2"
@@ -25,11 +28,38 @@ import (
 	"sigs.k8s.io/kpng/server/proxystore"
 )
 
+// ForceMasqueradeAnnotation requests the backends to always SNAT the traffic to the service (ie: when preserving
+// the client IP breaks asymmetric return paths, with endpoints behind other gateways).
+const ForceMasqueradeAnnotation = "kpng.k8s.io/masquerade"
+
+// TrafficDistributionAnnotation sets the service's traffic distribution, like the trafficDistribution field of
+// newer Kubernetes versions (not known by this API version): "PreferClose" prefers the endpoints in the zone of the
+// node, falling back to all the endpoints when the zone has none.
+const TrafficDistributionAnnotation = "kpng.k8s.io/traffic-distribution"
+
+// LoadBalancerIPModeAnnotation sets the mode of the service's load balancer IPs, like the ipMode field of the
+// load balancer ingresses of newer Kubernetes versions (not known by this API version): with "Proxy", the load
+// balancer isn't transparent (ie: it terminates the connections), so its IPs aren't sent to the backends and the
+// traffic to them always goes through it, instead of being short-circuited by the nodes; "VIP" is the default.
+const LoadBalancerIPModeAnnotation = "kpng.k8s.io/load-balancer-ip-mode"
+
+const (
+	LoadBalancerIPModeVIP   = "VIP"
+	LoadBalancerIPModeProxy = "Proxy"
+)
+
 type serviceEventHandler struct{ eventHandler }
 
 func (h *serviceEventHandler) onChange(obj interface{}) {
 	svc := obj.(*v1.Service)
 
+	if !h.config.handlesNamespace(svc.Namespace) {
+		h.updateServicesSync()
+		return
+	}
+
+	defer traceEvent("Service", svc.Namespace, svc.Name)()
+
 	internalTrafficPolicy := v1.ServiceInternalTrafficPolicyCluster
 	if svc.Spec.InternalTrafficPolicy != nil {
 		internalTrafficPolicy = *svc.Spec.InternalTrafficPolicy
@@ -47,6 +77,10 @@ func (h *serviceEventHandler) onChange(obj interface{}) {
 		},
 		ExternalTrafficToLocal: svc.Spec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyTypeLocal,
 		InternalTrafficToLocal: internalTrafficPolicy == v1.ServiceInternalTrafficPolicyLocal,
+		HealthCheckNodePort:    svc.Spec.HealthCheckNodePort,
+		ExternalTrafficPolicy:  string(svc.Spec.ExternalTrafficPolicy),
+		InternalTrafficPolicy:  string(internalTrafficPolicy),
+		ForceMasquerade:        svc.Annotations[ForceMasqueradeAnnotation] == "true",
 	}
 
 	// extract cluster IPs with backward compatibility (k8s before ClusterIPs)
@@ -79,7 +113,17 @@ func (h *serviceEventHandler) onChange(obj interface{}) {
 	}
 
 	// load balancer IPs
-	if len(svc.Status.LoadBalancer.Ingress) != 0 {
+	ipMode := LoadBalancerIPModeVIP
+	if value, ok := svc.Annotations[LoadBalancerIPModeAnnotation]; ok {
+		if value == LoadBalancerIPModeVIP || value == LoadBalancerIPModeProxy {
+			ipMode = value
+		} else {
+			h.reportInvalidService(svc, "InvalidLoadBalancerIPMode", "ignoring the "+LoadBalancerIPModeAnnotation+
+				" annotation: unsupported value "+strconv.Quote(value)+" (expected "+LoadBalancerIPModeVIP+" or "+LoadBalancerIPModeProxy+")")
+		}
+	}
+
+	if len(svc.Status.LoadBalancer.Ingress) != 0 && ipMode == LoadBalancerIPModeVIP {
 		ips := localnetv1.NewIPSet()
 		for _, ingress := range svc.Status.LoadBalancer.Ingress {
 			if ingress.IP != "" {
@@ -116,13 +160,85 @@ func (h *serviceEventHandler) onChange(obj interface{}) {
 		service.Ports = append(service.Ports, p)
 	}
 
+	// port ranges
+	if value, ok := svc.Annotations[PortRangesAnnotation]; ok {
+		ranges, err := parsePortRanges(value, service.Ports)
+		if err != nil {
+			h.reportInvalidService(svc, "InvalidPortRanges", "ignoring the "+PortRangesAnnotation+" annotation: "+err.Error())
+		} else {
+			service.PortRanges = ranges
+		}
+	}
+
+	// the services of the informer's initial listing have no known change time
+	initial := !h.syncSet
+
+	// traffic distribution
+	if value, ok := svc.Annotations[TrafficDistributionAnnotation]; ok {
+		if value == localnetv1.TrafficDistributionPreferClose {
+			service.TrafficDistribution = value
+		} else {
+			h.reportInvalidService(svc, "InvalidTrafficDistribution", "ignoring the "+TrafficDistributionAnnotation+
+				" annotation: unsupported value "+strconv.Quote(value)+" (expected "+localnetv1.TrafficDistributionPreferClose+")")
+		}
+	}
+
+	// endpoint weights, set by the local state of the nodes
+	if _, err := (&localnetv1.Service{Annotations: svc.Annotations}).GetEndpointWeights(); err != nil {
+		h.reportInvalidService(svc, "InvalidEndpointWeights", "ignoring the "+localnetv1.EndpointWeightsAnnotation+
+			" annotation: "+err.Error())
+	}
+
+	// exposure windows
+	if value, ok := svc.Annotations[ExposureWindowsAnnotation]; ok {
+		schedule, err := parseExposureSchedule(value, svc.Annotations[ExposureTimezoneAnnotation])
+		if err == nil {
+			// the service is published again by the exposure windows when its activation changes
+			h.exposure.apply(svc, schedule, service, func(service *localnetv1.Service) {
+				h.publish(service, svc.CreationTimestamp.Time, initial)
+			})
+			h.updateServicesSync()
+			return
+		}
+
+		h.reportInvalidService(svc, "InvalidExposureWindows", "ignoring the "+ExposureWindowsAnnotation+" annotation: "+err.Error())
+	}
+	h.exposure.forget(svc.Namespace, svc.Name)
+
+	h.publish(service, svc.CreationTimestamp.Time, initial)
+	h.updateServicesSync()
+}
+
+// updateServicesSync marks the services as synced once the informer is.
+func (h *serviceEventHandler) updateServicesSync() {
+	if h.syncSet {
+		return
+	}
+
 	h.s.Update(func(tx *proxystore.Tx) {
-		klog.V(3).Info("service ", service.Namespace, "/", service.Name)
-		tx.SetService(service)
 		h.updateSync(proxystore.Services, tx)
 	})
 }
 
+// publish sets the service in the store.
+func (h *serviceEventHandler) publish(service *localnetv1.Service, created time.Time, initial bool) {
+	h.health.setService(service, initial)
+
+	h.s.Update(func(tx *proxystore.Tx) {
+		klog.V(3).Info("service ", service.Namespace, "/", service.Name)
+		h.quota.setService(tx, service, created)
+		h.portMismatches.check(tx, service.Namespace, service.Name)
+	})
+}
+
+func (h *serviceEventHandler) reportInvalidService(svc *v1.Service, reason, msg string) {
+	klog.Warningf("service %s/%s: %s", svc.Namespace, svc.Name, msg)
+
+	if h.recorder != nil {
+		h.recorder.Event(svc, v1.EventTypeWarning, reason, msg)
+	}
+}
+
 func (h *serviceEventHandler) OnAdd(obj interface{}) {
 	h.onChange(obj)
 }
@@ -133,9 +249,14 @@ func (h *serviceEventHandler) OnUpdate(oldObj, newObj interface{}) {
 
 func (h *serviceEventHandler) OnDelete(oldObj interface{}) {
 	svc := oldObj.(*v1.Service)
+	defer traceEvent("Service", svc.Namespace, svc.Name)()
+
+	h.exposure.forget(svc.Namespace, svc.Name)
+	h.health.delService(svc.Namespace, svc.Name)
 
 	h.s.Update(func(tx *proxystore.Tx) {
-		tx.DelService(svc.Namespace, svc.Name)
+		h.quota.delService(tx, svc.Namespace, svc.Name)
 		h.updateSync(proxystore.Services, tx)
+		h.portMismatches.forget(svc.Namespace, svc.Name)
 	})
 }
@@ -28,7 +28,8 @@ func TestServiceEventHandlerTrafficPolicy(t *testing.T) {
 			Name:      "test-svc",
 		},
 		Spec: v1.ServiceSpec{
-			Type: v1.ServiceTypeClusterIP,
+			Type:                v1.ServiceTypeClusterIP,
+			HealthCheckNodePort: 30123,
 		},
 	}
 
@@ -56,6 +57,15 @@ func TestServiceEventHandlerTrafficPolicy(t *testing.T) {
 				if kv.Service.Service.ExternalTrafficToLocal != test.ExpectedExternal {
 					t.Errorf("test[%d]: external: expected %v, got %v", testIdx, test.ExpectedExternal, kv.Service.Service.ExternalTrafficToLocal)
 				}
+				if p := kv.Service.Service.InternalTrafficPolicy; p != string(test.InternalPolicy) {
+					t.Errorf("test[%d]: internal policy: expected %v, got %v", testIdx, test.InternalPolicy, p)
+				}
+				if p := kv.Service.Service.ExternalTrafficPolicy; p != string(test.ExternalPolicy) {
+					t.Errorf("test[%d]: external policy: expected %v, got %v", testIdx, test.ExternalPolicy, p)
+				}
+				if p := kv.Service.Service.HealthCheckNodePort; p != 30123 {
+					t.Errorf("test[%d]: health check node port: expected 30123, got %v", testIdx, p)
+				}
 				return true
 			})
 		})
@@ -65,3 +75,55 @@ func TestServiceEventHandlerTrafficPolicy(t *testing.T) {
 func ref[T any](v T) *T {
 	return &v
 }
+
+func TestServiceEventHandlerLoadBalancerIPMode(t *testing.T) {
+	store := proxystore.New()
+
+	handler := serviceEventHandler{
+		eventHandler: eventHandler{
+			s:       store,
+			syncSet: true,
+			config:  &Config{},
+		},
+	}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test-svc",
+		},
+		Spec: v1.ServiceSpec{
+			Type: v1.ServiceTypeLoadBalancer,
+		},
+		Status: v1.ServiceStatus{
+			LoadBalancer: v1.LoadBalancerStatus{
+				Ingress: []v1.LoadBalancerIngress{{IP: "203.0.113.10"}, {Hostname: "lb.example.com"}},
+			},
+		},
+	}
+
+	for _, test := range []struct {
+		annotations map[string]string
+		expectedIPs []string
+	}{
+		{nil, []string{"203.0.113.10"}},
+		{map[string]string{LoadBalancerIPModeAnnotation: LoadBalancerIPModeVIP}, []string{"203.0.113.10"}},
+		{map[string]string{LoadBalancerIPModeAnnotation: LoadBalancerIPModeProxy}, nil},
+		// invalid values are ignored
+		{map[string]string{LoadBalancerIPModeAnnotation: "proxy"}, []string{"203.0.113.10"}},
+	} {
+		svc.Annotations = test.annotations
+
+		handler.onChange(svc)
+
+		store.View(0, func(tx *proxystore.Tx) {
+			tx.Each(proxystore.Services, func(kv *proxystore.KV) bool {
+				ips := kv.Service.Service.IPs.LoadBalancerIPs.GetV4()
+				if len(ips) != len(test.expectedIPs) || (len(ips) != 0 && ips[0] != test.expectedIPs[0]) {
+					t.Errorf("%v: expected load balancer IPs %v, got %v", test.annotations, test.expectedIPs, ips)
+				}
+				return true
+			})
+		})
+	}
+}
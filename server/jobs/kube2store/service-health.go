@@ -0,0 +1,292 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube2store
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/jobs/api2local"
+)
+
+// ServiceHealthPath is the path of the services' health on the metrics server (see --exportMetrics). The
+// namespace and name query parameters select the services, and unhealthy=true only returns the services not
+// programmed on all the reporting nodes.
+const ServiceHealthPath = "/services/health"
+
+// serviceHealth aggregates the applied-state reports of the node agents (published in their node's annotations,
+// see api2local.NodeAnnotation) into a per-service view, so the propagation of a service can be checked without
+// logging into the nodes.
+//
+// A service is programmed on a node if the node's agent applied a state since the service last changed, and
+// doesn't report it as failing. The nodes without report (agents not started with --annotate-node) are ignored.
+type serviceHealth struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	nodes    map[string]*nodeReport
+	services map[types.NamespacedName]*serviceVersion
+}
+
+// nodeReport is the last applied-state report of a node's agent.
+type nodeReport struct {
+	reported  bool
+	appliedAt time.Time
+	failures  map[string]string
+}
+
+// serviceVersion is the last published version of a service.
+type serviceVersion struct {
+	service   *localnetv1.Service
+	changedAt time.Time
+}
+
+func newServiceHealth() *serviceHealth {
+	return &serviceHealth{
+		now:      time.Now,
+		nodes:    map[string]*nodeReport{},
+		services: map[types.NamespacedName]*serviceVersion{},
+	}
+}
+
+// setNode records the report of the node's agent.
+func (sh *serviceHealth) setNode(node *v1.Node) {
+	if sh == nil {
+		return
+	}
+
+	report := &nodeReport{}
+
+	if value, ok := node.Annotations[api2local.AppliedAtAnnotation]; ok {
+		appliedAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			klog.V(1).Infof("node %s: invalid %s annotation: %v", node.Name, api2local.AppliedAtAnnotation, err)
+		} else {
+			report.reported = true
+			report.appliedAt = appliedAt
+		}
+	}
+
+	if value, ok := node.Annotations[api2local.FailingServicesAnnotation]; ok && value != "" {
+		if err := json.Unmarshal([]byte(value), &report.failures); err != nil {
+			klog.V(1).Infof("node %s: invalid %s annotation: %v", node.Name, api2local.FailingServicesAnnotation, err)
+		}
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	sh.nodes[node.Name] = report
+}
+
+func (sh *serviceHealth) delNode(name string) {
+	if sh == nil {
+		return
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	delete(sh.nodes, name)
+}
+
+// setService records the change time of the service, if it changed. The services of the initial listing have no
+// change time (the nodes having applied any state are considered up to date).
+func (sh *serviceHealth) setService(service *localnetv1.Service, initial bool) {
+	if sh == nil {
+		return
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	key := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+
+	prev, ok := sh.services[key]
+	if ok && proto.Equal(prev.service, service) {
+		return // resync
+	}
+
+	version := &serviceVersion{service: service}
+	if ok || !initial {
+		version.changedAt = sh.now()
+	}
+	sh.services[key] = version
+}
+
+func (sh *serviceHealth) delService(namespace, name string) {
+	if sh == nil {
+		return
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	delete(sh.services, types.NamespacedName{Namespace: namespace, Name: name})
+}
+
+// serviceHealthReport is the health of a service across the reporting nodes.
+type serviceHealthReport struct {
+	Namespace  string        `json:"namespace"`
+	Name       string        `json:"name"`
+	ChangedAt  *time.Time    `json:"changedAt,omitempty"`
+	Nodes      int           `json:"nodes"`
+	Programmed int           `json:"programmed"`
+	Pending    []string      `json:"pending,omitempty"`
+	Failing    []nodeFailure `json:"failing,omitempty"`
+	Summary    string        `json:"summary"`
+}
+
+type nodeFailure struct {
+	Node  string `json:"node"`
+	Error string `json:"error"`
+}
+
+// healthReport is the response of the ServiceHealthPath endpoint.
+type healthReport struct {
+	// Nodes is the number of reporting nodes, and UnreportedNodes the others.
+	Nodes           int                   `json:"nodes"`
+	UnreportedNodes []string              `json:"unreportedNodes,omitempty"`
+	Services        []serviceHealthReport `json:"services"`
+}
+
+// healthy returns true if the service is programmed on all the reporting nodes.
+func (r *serviceHealthReport) healthy() bool {
+	return r.Programmed == r.Nodes
+}
+
+// maxSummaryFailures is the number of failing nodes detailed in the summaries.
+const maxSummaryFailures = 3
+
+func (r *serviceHealthReport) summarize() {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "programmed on %d/%d nodes", r.Programmed, r.Nodes)
+
+	for i, failure := range r.Failing {
+		if i == maxSummaryFailures {
+			fmt.Fprintf(b, " and %d more", len(r.Failing)-maxSummaryFailures)
+			break
+		}
+		if i == 0 {
+			b.WriteString(", failing on ")
+		} else {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(b, "%s with error %q", failure.Node, failure.Error)
+	}
+
+	if len(r.Pending) != 0 {
+		fmt.Fprintf(b, ", pending on %d nodes", len(r.Pending))
+	}
+
+	r.Summary = b.String()
+}
+
+// report returns the health of the services of the namespace and name (all if empty).
+func (sh *serviceHealth) report(namespace, name string, unhealthyOnly bool) *healthReport {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	report := &healthReport{Services: []serviceHealthReport{}}
+
+	nodeNames := make([]string, 0, len(sh.nodes))
+	for nodeName, node := range sh.nodes {
+		if node.reported {
+			nodeNames = append(nodeNames, nodeName)
+		} else {
+			report.UnreportedNodes = append(report.UnreportedNodes, nodeName)
+		}
+	}
+	sort.Strings(nodeNames)
+	sort.Strings(report.UnreportedNodes)
+	report.Nodes = len(nodeNames)
+
+	for key, version := range sh.services {
+		if namespace != "" && key.Namespace != namespace || name != "" && key.Name != name {
+			continue
+		}
+
+		r := serviceHealthReport{
+			Namespace: key.Namespace,
+			Name:      key.Name,
+			Nodes:     len(nodeNames),
+		}
+		if !version.changedAt.IsZero() {
+			changedAt := version.changedAt.UTC()
+			r.ChangedAt = &changedAt
+		}
+
+		serviceKey := key.String()
+		for _, nodeName := range nodeNames {
+			node := sh.nodes[nodeName]
+
+			if err, failing := node.failures[serviceKey]; failing {
+				r.Failing = append(r.Failing, nodeFailure{Node: nodeName, Error: err})
+				continue
+			}
+
+			// the annotations have a precision of a second
+			if node.appliedAt.Before(version.changedAt.Truncate(time.Second)) {
+				r.Pending = append(r.Pending, nodeName)
+				continue
+			}
+
+			r.Programmed++
+		}
+
+		if unhealthyOnly && r.healthy() {
+			continue
+		}
+
+		r.summarize()
+		report.Services = append(report.Services, r)
+	}
+
+	sort.Slice(report.Services, func(i, j int) bool {
+		a, b := report.Services[i], report.Services[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	return report
+}
+
+func (sh *serviceHealth) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	report := sh.report(query.Get("namespace"), query.Get("name"), query.Get("unhealthy") == "true")
+
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		klog.V(1).Info("failed to write the services' health: ", err)
+	}
+}
@@ -0,0 +1,98 @@
+package kube2store
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/jobs/api2local"
+)
+
+func reportingNode(name string, appliedAt time.Time, failures string) *v1.Node {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{
+		api2local.AppliedAtAnnotation: appliedAt.UTC().Format(time.RFC3339),
+	}}}
+	if failures != "" {
+		node.Annotations[api2local.FailingServicesAnnotation] = failures
+	}
+	return node
+}
+
+func TestServiceHealth(t *testing.T) {
+	start := time.Date(2022, 10, 3, 12, 0, 0, 0, time.UTC)
+	now := start
+
+	health := newServiceHealth()
+	health.now = func() time.Time { return now }
+
+	web := &localnetv1.Service{Namespace: "default", Name: "web", Type: "ClusterIP"}
+	health.setService(web, true)
+	health.setService(&localnetv1.Service{Namespace: "kube-system", Name: "dns"}, true)
+
+	health.setNode(reportingNode("node-a", start.Add(-time.Minute), ""))
+	health.setNode(reportingNode("node-b", start.Add(-time.Minute), `{"default/web":"iptables-restore failed: line 12"}`))
+	health.setNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-c"}}) // no agent report
+
+	report := health.report("", "", false)
+	if report.Nodes != 2 || len(report.UnreportedNodes) != 1 || report.UnreportedNodes[0] != "node-c" {
+		t.Fatalf("expected 2 reporting nodes and node-c unreported, got %d and %v", report.Nodes, report.UnreportedNodes)
+	}
+	if len(report.Services) != 2 || report.Services[0].Name != "web" || report.Services[1].Name != "dns" {
+		t.Fatalf("expected the services sorted by namespace, got %+v", report.Services)
+	}
+	expected := `programmed on 1/2 nodes, failing on node-b with error "iptables-restore failed: line 12"`
+	if summary := report.Services[0].Summary; summary != expected {
+		t.Errorf("expected summary %q, got %q", expected, summary)
+	}
+
+	// resyncs don't change the service
+	now = start.Add(time.Minute)
+	health.setService(&localnetv1.Service{Namespace: "default", Name: "web", Type: "ClusterIP"}, false)
+	if r := health.report("default", "web", false).Services[0]; r.ChangedAt != nil || r.Programmed != 1 {
+		t.Errorf("expected no change, got %+v", r)
+	}
+
+	// a change is pending until the nodes apply a newer state
+	health.setService(&localnetv1.Service{Namespace: "default", Name: "web", Type: "NodePort"}, false)
+	if r := health.report("default", "web", false).Services[0]; len(r.Pending) != 1 || r.Pending[0] != "node-a" ||
+		r.Summary != `programmed on 0/2 nodes, failing on node-b with error "iptables-restore failed: line 12", pending on 1 nodes` {
+		t.Errorf("expected the change pending on node-a, got %+v", r)
+	}
+
+	health.setNode(reportingNode("node-a", now.Add(time.Second), ""))
+	health.setNode(reportingNode("node-b", now.Add(time.Second), "{}"))
+	if r := health.report("default", "web", false).Services[0]; r.Programmed != 2 || r.Summary != "programmed on 2/2 nodes" {
+		t.Errorf("expected the service programmed on all the nodes, got %+v", r)
+	}
+
+	// new services are pending until applied
+	now = start.Add(2 * time.Minute)
+	health.setService(&localnetv1.Service{Namespace: "default", Name: "api"}, false)
+
+	rec := httptest.NewRecorder()
+	health.ServeHTTP(rec, httptest.NewRequest("GET", ServiceHealthPath+"?unhealthy=true", nil))
+
+	served := &healthReport{}
+	if err := json.Unmarshal(rec.Body.Bytes(), served); err != nil {
+		t.Fatal(err)
+	}
+	if len(served.Services) != 1 || served.Services[0].Name != "api" || len(served.Services[0].Pending) != 2 {
+		t.Errorf("expected only the unhealthy api service, got %s", rec.Body.String())
+	}
+
+	health.delService("default", "api")
+	health.delNode("node-b")
+	if report := health.report("default", "", true); report.Nodes != 1 || len(report.Services) != 0 {
+		t.Errorf("expected no unhealthy service on node-a, got %+v", report)
+	}
+
+	if !strings.Contains(rec.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("expected a JSON response, got %q", rec.Header().Get("Content-Type"))
+	}
+}
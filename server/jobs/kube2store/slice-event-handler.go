@@ -19,6 +19,7 @@ package kube2store
 import (
 	"sort"
 
+	v1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
 	"k8s.io/klog/v2"
 
@@ -45,6 +46,51 @@ func (h sliceEventHandler) OnAdd(obj interface{}) {
 		return
 	}
 
+	if !h.config.handlesNamespace(eps.Namespace) {
+		h.s.Update(func(tx *proxystore.Tx) { h.updateSync(proxystore.Endpoints, tx) })
+		return
+	}
+	defer traceEvent("EndpointSlice", eps.Namespace, serviceName)()
+
+	infos := sliceEndpointInfos(eps, serviceName)
+
+	h.s.Update(func(tx *proxystore.Tx) {
+		if eps.AddressType == discovery.AddressTypeFQDN {
+			// only the resolved addresses of the names are proxied
+			infos = h.fqdn.setSlice(eps.Namespace, eps.Name, serviceName, infos)
+		}
+
+		h.quota.setSlice(tx, eps.Namespace, eps.Name, serviceName, infos)
+		h.updateSync(proxystore.Endpoints, tx)
+		h.portMismatches.check(tx, eps.Namespace, serviceName)
+
+		if log := klog.V(3); log.Enabled() {
+			log.Info("endpoints of ", eps.Namespace, "/", serviceName, ":")
+			tx.EachEndpointOfService(eps.Namespace, serviceName, func(ei *localnetv1.EndpointInfo) {
+				log.Info("- ", ei.Endpoint.IPs, " | topo: ", ei.Topology)
+			})
+		}
+	})
+}
+
+// sliceEndpointInfos returns the endpoints of a slice. The endpoints of the FQDN slices have their name (Endpoint.FQDN)
+// instead of IPs, that the fqdnResolver resolves.
+func sliceEndpointInfos(eps *discovery.EndpointSlice, serviceName string) []*localnetv1.EndpointInfo {
+	ports := make([]*localnetv1.PortName, 0, len(eps.Ports))
+	for _, port := range eps.Ports {
+		portName := &localnetv1.PortName{}
+		if port.Name != nil {
+			portName.Name = *port.Name
+		}
+		if port.Port != nil {
+			portName.Port = *port.Port
+		}
+		if port.Protocol != nil {
+			portName.Protocol = localnetv1.ParseProtocol(string(*port.Protocol))
+		}
+		ports = append(ports, portName)
+	}
+
 	// compute endpoints
 	infos := make([]*localnetv1.EndpointInfo, 0, len(eps.Endpoints))
 
@@ -68,9 +114,14 @@ func (h sliceEventHandler) OnAdd(obj interface{}) {
 
 		if n := sliceEndpoint.NodeName; n != nil {
 			info.Topology.Node = *n
+		} else {
+			// slices written through the v1beta1 API only have the topology labels
+			info.Topology.Node = sliceEndpoint.DeprecatedTopology[hostNameLabel]
 		}
 		if z := sliceEndpoint.Zone; z != nil {
 			info.Topology.Zone = *z
+		} else {
+			info.Topology.Zone = sliceEndpoint.DeprecatedTopology[v1.LabelTopologyZone]
 		}
 
 		if hints := sliceEndpoint.Hints; hints != nil {
@@ -87,31 +138,39 @@ func (h sliceEventHandler) OnAdd(obj interface{}) {
 		if r := sliceEndpoint.Conditions.Ready; r != nil && *r {
 			info.Conditions.Ready = true
 		}
-
-		for _, addr := range sliceEndpoint.Addresses {
-			info.Endpoint.AddAddress(addr)
+		if s := sliceEndpoint.Conditions.Serving; s != nil {
+			info.Conditions.Serving = *s
+		} else {
+			// unset means the same as ready
+			info.Conditions.Serving = info.Conditions.Ready
 		}
+		if t := sliceEndpoint.Conditions.Terminating; t != nil && *t {
+			info.Conditions.Terminating = true
+		}
+
+		// make them available to the backends
+		info.Endpoint.Conditions = info.Conditions
+		info.Endpoint.Topology = info.Topology
+		info.Endpoint.Hints = info.Hints
 
-		ports := make([]*localnetv1.PortName, 0, len(eps.Ports))
-		for _, port := range eps.Ports {
-			ports = append(ports, &localnetv1.PortName{Name: *port.Name, Port: *port.Port})
+		if eps.AddressType == discovery.AddressTypeFQDN {
+			if len(sliceEndpoint.Addresses) == 0 {
+				continue
+			}
+			// FQDN endpoints have a single address
+			info.Endpoint.FQDN = sliceEndpoint.Addresses[0]
+		} else {
+			for _, addr := range sliceEndpoint.Addresses {
+				info.Endpoint.AddAddress(addr)
+			}
 		}
+
 		info.Endpoint.PortOverrides = ports
 
 		infos = append(infos, info)
 	}
 
-	h.s.Update(func(tx *proxystore.Tx) {
-		tx.SetEndpointsOfSource(eps.Namespace, eps.Name, infos)
-		h.updateSync(proxystore.Endpoints, tx)
-
-		if log := klog.V(3); log.Enabled() {
-			log.Info("endpoints of ", eps.Namespace, "/", serviceName, ":")
-			tx.EachEndpointOfService(eps.Namespace, serviceName, func(ei *localnetv1.EndpointInfo) {
-				log.Info("- ", ei.Endpoint.IPs, " | topo: ", ei.Topology)
-			})
-		}
-	})
+	return infos
 }
 
 func (h sliceEventHandler) OnUpdate(oldObj, newObj interface{}) {
@@ -121,9 +180,17 @@ func (h sliceEventHandler) OnUpdate(oldObj, newObj interface{}) {
 
 func (h sliceEventHandler) OnDelete(oldObj interface{}) {
 	eps := oldObj.(*discovery.EndpointSlice)
+	if serviceName := serviceNameFrom(eps); serviceName != "" {
+		defer traceEvent("EndpointSlice", eps.Namespace, serviceName)()
+	}
 
 	h.s.Update(func(tx *proxystore.Tx) {
-		tx.DelEndpointsOfSource(eps.Namespace, eps.Name)
+		h.fqdn.delSlice(eps.Namespace, eps.Name)
+		h.quota.delSlice(tx, eps.Namespace, eps.Name)
 		h.updateSync(proxystore.Endpoints, tx)
+
+		if serviceName := serviceNameFrom(eps); serviceName != "" {
+			h.portMismatches.check(tx, eps.Namespace, serviceName)
+		}
 	})
 }
@@ -0,0 +1,115 @@
+package kube2store
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/proxystore"
+)
+
+func TestSliceEventHandlerConditions(t *testing.T) {
+	store := proxystore.New()
+
+	handler := sliceEventHandler{
+		eventHandler: eventHandler{
+			s:       store,
+			syncSet: true,
+			config:  &Config{
+				// defaults
+			},
+		},
+	}
+
+	slice := &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test-svc-abcde",
+			Labels:    map[string]string{discovery.LabelServiceName: "test-svc"},
+		},
+	}
+
+	for testIdx, test := range []struct {
+		Conditions discovery.EndpointConditions
+		Expected   *localnetv1.EndpointConditions
+	}{
+		{discovery.EndpointConditions{}, &localnetv1.EndpointConditions{}},
+		{discovery.EndpointConditions{Ready: ref(true)}, &localnetv1.EndpointConditions{Ready: true, Serving: true}},
+		{discovery.EndpointConditions{Ready: ref(false), Serving: ref(true), Terminating: ref(true)},
+			&localnetv1.EndpointConditions{Serving: true, Terminating: true}},
+	} {
+		slice.Endpoints = []discovery.Endpoint{{
+			Addresses:  []string{"10.1.0.1"},
+			Conditions: test.Conditions,
+			NodeName:   ref("node-a"),
+			Zone:       ref("zone-a"),
+			Hints:      &discovery.EndpointHints{ForZones: []discovery.ForZone{{Name: "zone-a"}}},
+		}}
+
+		handler.OnAdd(slice)
+
+		count := 0
+		store.View(0, func(tx *proxystore.Tx) {
+			tx.EachEndpointOfService("default", "test-svc", func(ei *localnetv1.EndpointInfo) {
+				count++
+
+				c := ei.Endpoint.Conditions
+				if c.Ready != test.Expected.Ready || c.Serving != test.Expected.Serving || c.Terminating != test.Expected.Terminating {
+					t.Errorf("test[%d]: expected conditions %v, got %v", testIdx, test.Expected, c)
+				}
+				if topo := ei.Endpoint.Topology; topo.Node != "node-a" || topo.Zone != "zone-a" {
+					t.Errorf("test[%d]: wrong topology: %v", testIdx, topo)
+				}
+				if hints := ei.Endpoint.Hints; len(hints.Zones) != 1 || hints.Zones[0] != "zone-a" {
+					t.Errorf("test[%d]: wrong hints: %v", testIdx, hints)
+				}
+			})
+		})
+
+		if count != 1 {
+			t.Errorf("test[%d]: expected 1 endpoint, got %d", testIdx, count)
+		}
+	}
+}
+
+func TestSliceEndpointInfos(t *testing.T) {
+	slice := &discovery.EndpointSlice{
+		ObjectMeta:  metav1.ObjectMeta{Namespace: "default", Name: "test-svc-abcde"},
+		AddressType: discovery.AddressTypeIPv4,
+		Endpoints: []discovery.Endpoint{{
+			Addresses: []string{"10.1.0.1"},
+			// written through the v1beta1 API
+			DeprecatedTopology: map[string]string{hostNameLabel: "node-a", v1.LabelTopologyZone: "zone-a"},
+		}, {
+			Addresses:          []string{"10.1.0.2"},
+			NodeName:           ref("node-b"),
+			Zone:               ref("zone-b"),
+			DeprecatedTopology: map[string]string{hostNameLabel: "node-a", v1.LabelTopologyZone: "zone-a"},
+		}},
+		Ports: []discovery.EndpointPort{{Port: ref(int32(8080))}}, // no name
+	}
+
+	infos := sliceEndpointInfos(slice, "test-svc")
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 endpoints, got %d", len(infos))
+	}
+	for i, expected := range []*localnetv1.TopologyInfo{{Node: "node-a", Zone: "zone-a"}, {Node: "node-b", Zone: "zone-b"}} {
+		if topo := infos[i].Topology; topo.Node != expected.Node || topo.Zone != expected.Zone {
+			t.Errorf("endpoint %d: expected topology %v, got %v", i, expected, topo)
+		}
+	}
+	if ports := infos[0].Endpoint.PortOverrides; len(ports) != 1 || ports[0].Name != "" || ports[0].Port != 8080 {
+		t.Errorf("unexpected ports %v", ports)
+	}
+
+	slice.AddressType = discovery.AddressTypeFQDN
+	slice.Endpoints[0].Addresses = []string{"db.example.com"}
+	slice.Endpoints[1].Addresses = nil
+	infos = sliceEndpointInfos(slice, "test-svc")
+	if len(infos) != 1 || infos[0].Endpoint.FQDN != "db.example.com" || infos[0].Endpoint.IPs != nil {
+		t.Errorf("expected the endpoint of db.example.com only from a FQDN slice, got %v", infos)
+	}
+}
@@ -18,16 +18,22 @@ package store2api
 
 import (
 	"context"
-	"crypto/tls"
+	"time"
 
 	"github.com/spf13/pflag"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 
+	_ "sigs.k8s.io/kpng/client/compression" // answer compressed streams
 	"sigs.k8s.io/kpng/client/tlsflags"
+	"sigs.k8s.io/kpng/server/pkg/election"
+	"sigs.k8s.io/kpng/server/pkg/nodeauth"
 	"sigs.k8s.io/kpng/server/pkg/server"
 	"sigs.k8s.io/kpng/server/pkg/server/endpoints"
 	"sigs.k8s.io/kpng/server/pkg/server/global"
+	"sigs.k8s.io/kpng/server/pkg/server/journal"
+	"sigs.k8s.io/kpng/server/pkg/visibility"
 	"sigs.k8s.io/kpng/server/proxystore"
 )
 
@@ -36,18 +42,63 @@ type Config struct {
 	GlobalAPI bool
 	LocalAPI  bool
 	TLS       *tlsflags.Flags
+
+	// JournalAPI serves the journal of the recent revisions of the global state, keeping up to JournalMaxRevisions
+	// revisions for up to JournalMaxAge.
+	JournalAPI          bool
+	JournalMaxRevisions int
+	JournalMaxAge       time.Duration
+
+	// Election serves only while leading, if enabled.
+	Election *election.Config
+
+	// NodeAuth authorizes the clients with their service account tokens, if enabled.
+	NodeAuth *nodeauth.Config
+
+	// KeepaliveMinTime is the min interval of the clients' keepalive pings, the connections of clients pinging more
+	// often are closed.
+	KeepaliveMinTime time.Duration
+	// KeepaliveTime is the interval of the server's keepalive pings (gRPC's default if 0).
+	KeepaliveTime time.Duration
+
+	// VisibilityPolicy is the file of the policy restricting the services visible to the nodes (see the visibility
+	// package), all the services are visible if empty.
+	VisibilityPolicy string
+
+	// MaxEndpointsPerService caps the endpoints sent to a node for each service, selecting a consistent subset for
+	// each node (see endpoints.Subset); unlimited if 0.
+	MaxEndpointsPerService int
 }
 
 func (c *Config) BindFlags(flags *pflag.FlagSet) {
 	flags.StringVar(&c.BindSpec, "listen", "tcp://:12090", "serve global API")
 	flags.BoolVar(&c.GlobalAPI, "global-api", true, "serve global API")
 	flags.BoolVar(&c.LocalAPI, "local-api", true, "serve local API")
+	flags.BoolVar(&c.JournalAPI, "journal-api", true, "serve the journal of the recent revisions of the global state")
+	flags.IntVar(&c.JournalMaxRevisions, "journal-max-revisions", 1000, "max number of revisions kept in the journal (unbounded if 0)")
+	flags.DurationVar(&c.JournalMaxAge, "journal-max-age", 15*time.Minute, "max age of the revisions kept in the journal (unbounded if 0)")
+	flags.DurationVar(&c.KeepaliveMinTime, "keepalive-min-time", 10*time.Second, "min interval of the clients' keepalive pings (clients pinging more often are disconnected)")
+	flags.DurationVar(&c.KeepaliveTime, "keepalive-time", 0, "interval of the keepalive pings to the clients, detecting dead connections (gRPC's default if 0)")
+	flags.StringVar(&c.VisibilityPolicy, "visibility-policy", "", "policy file restricting the namespaces and services visible to the nodes in the local API (all visible if empty)")
+	flags.IntVar(&c.MaxEndpointsPerService, "max-endpoints-per-service", 0, "max number of endpoints of a service sent to each node in the local API, a consistent subset for each node (unlimited if 0)")
 
 	if c.TLS == nil {
 		c.TLS = &tlsflags.Flags{}
 	}
 
 	c.TLS.Bind(flags, "listen-")
+
+	if c.Election == nil {
+		c.Election = &election.Config{}
+	}
+
+	c.Election.BindFlags(flags)
+
+	if c.NodeAuth == nil {
+		c.NodeAuth = &nodeauth.Config{}
+	}
+
+	c.NodeAuth.BindFlags(flags)
 }
 
 type Job struct {
@@ -56,26 +107,62 @@ type Job struct {
 }
 
 func (j *Job) Run(ctx context.Context) error {
+	if j.Config.Election == nil {
+		return j.serve(ctx)
+	}
+
+	return j.Config.Election.Run(ctx, j.serve)
+}
+
+// serve serves the APIs until the context is done.
+func (j *Job) serve(ctx context.Context) error {
 	lis := server.MustListen(j.Config.BindSpec)
 
 	// setup gRPC server
-	var srv *grpc.Server
-	if tlsCfg := j.Config.TLS.Config(); tlsCfg == nil {
-		srv = grpc.NewServer()
-	} else {
-		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
-		tlsCfg.ClientCAs = tlsCfg.RootCAs
-
-		creds := credentials.NewTLS(tlsCfg)
-		srv = grpc.NewServer(grpc.Creds(creds))
+	tlsCfg, err := j.Config.TLS.ServerConfig()
+	if err != nil {
+		return err
 	}
 
+	opts := []grpc.ServerOption{
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             j.Config.KeepaliveMinTime,
+			PermitWithoutStream: true,
+		}),
+	}
+	if j.Config.KeepaliveTime > 0 {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{Time: j.Config.KeepaliveTime}))
+	}
+	if tlsCfg != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+
+	authorizer, err := j.Config.NodeAuth.Authorizer()
+	if err != nil {
+		return err
+	}
+	if authorizer != nil {
+		opts = append(opts, authorizer.ServerOptions()...)
+	}
+
+	var policy *visibility.Policy
+	if j.Config.VisibilityPolicy != "" {
+		if policy, err = visibility.Load(j.Config.VisibilityPolicy); err != nil {
+			return err
+		}
+	}
+
+	srv := grpc.NewServer(opts...)
+
 	// setup server
 	if j.Config.GlobalAPI {
 		global.Setup(srv, j.Store)
 	}
 	if j.Config.LocalAPI {
-		endpoints.Setup(srv, j.Store)
+		endpoints.Setup(srv, j.Store, policy, j.Config.MaxEndpointsPerService)
+	}
+	if j.Config.JournalAPI {
+		journal.Setup(ctx, srv, j.Store, j.Config.JournalMaxRevisions, j.Config.JournalMaxAge)
 	}
 
 	// handle exit
@@ -0,0 +1,255 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package store2crd mirrors the global state into ServiceState custom resources, one per service in its
+// namespace, so operators can inspect kpng's view with kubectl and other controllers can consume it without
+// speaking kpng's gRPC protocol.
+package store2crd
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/proxystore"
+)
+
+const (
+	// Kind is the kind of the custom resources mirroring the services (see hack/kpng-servicestate-crd.yaml).
+	Kind = "ServiceState"
+
+	// ManagedByLabel marks the ServiceStates written by kpng, the others are left alone.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	managedBy      = "kpng"
+
+	fieldManager = "kpng"
+)
+
+// Resource is the resource of the ServiceStates.
+var Resource = schema.GroupVersionResource{Group: "kpng.sigs.k8s.io", Version: "v1alpha1", Resource: "servicestates"}
+
+type Config struct {
+	Kubeconfig string
+}
+
+func (c *Config) BindFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.Kubeconfig, "crd-kubeconfig", "", "kubeconfig used to write the ServiceStates (in-cluster configuration if empty)")
+}
+
+type Job struct {
+	Store  *proxystore.Store
+	Config *Config
+
+	client dynamic.NamespaceableResourceInterface
+
+	// written holds the specs written, by namespace/name
+	written map[string]string
+}
+
+func (j *Job) Run(ctx context.Context) (err error) {
+	cfg, err := clientcmd.BuildConfigFromFlags("", j.Config.Kubeconfig)
+	if err != nil {
+		return
+	}
+
+	client, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return
+	}
+
+	j.client = client.Resource(Resource)
+
+	if err = j.loadWritten(ctx); err != nil {
+		return
+	}
+
+	var (
+		rev    uint64
+		closed = false
+	)
+
+	for !closed {
+		var specs map[string]map[string]interface{}
+
+		rev, closed = j.Store.View(rev, func(tx *proxystore.Tx) {
+			if !tx.AllSynced() {
+				return
+			}
+
+			specs, err = serviceSpecs(tx)
+		})
+
+		if err != nil {
+			return
+		}
+
+		if specs == nil {
+			continue
+		}
+
+		j.mirror(ctx, specs)
+	}
+
+	return
+}
+
+// loadWritten lists the ServiceStates written by a previous run, so the ones of the deleted services are removed.
+func (j *Job) loadWritten(ctx context.Context) error {
+	list, err := j.client.List(ctx, metav1.ListOptions{LabelSelector: ManagedByLabel + "=" + managedBy})
+	if err != nil {
+		return err
+	}
+
+	j.written = make(map[string]string, len(list.Items))
+	for _, item := range list.Items {
+		j.written[item.GetNamespace()+"/"+item.GetName()] = "" // unknown spec, will be rewritten
+	}
+
+	return nil
+}
+
+// serviceSpecs returns the specs of the ServiceStates, by namespace/name.
+func serviceSpecs(tx *proxystore.Tx) (specs map[string]map[string]interface{}, err error) {
+	specs = map[string]map[string]interface{}{}
+
+	tx.Each(proxystore.Services, func(kv *proxystore.KV) bool {
+		var service interface{}
+		if service, err = toJSONValue(kv.Service.Service); err != nil {
+			return false
+		}
+
+		endpoints := make([]interface{}, 0)
+		tx.EachEndpointOfService(kv.Namespace, kv.Name, func(ep *localnetv1.EndpointInfo) {
+			if err != nil {
+				return
+			}
+
+			var endpoint interface{}
+			if endpoint, err = toJSONValue(ep); err != nil {
+				return
+			}
+			endpoints = append(endpoints, endpoint)
+		})
+
+		if err != nil {
+			return false
+		}
+
+		specs[kv.Namespace+"/"+kv.Name] = map[string]interface{}{
+			"service":   service,
+			"endpoints": endpoints,
+		}
+		return true
+	})
+
+	return
+}
+
+// toJSONValue converts a message to its JSON value, as stored in an unstructured object.
+func toJSONValue(msg proto.Message) (v interface{}, err error) {
+	ba, err := protojson.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(ba, &v)
+	return
+}
+
+// mirror writes the changed ServiceStates and deletes the ones of the deleted services. Failures are logged and
+// retried with the next revision.
+func (j *Job) mirror(ctx context.Context, specs map[string]map[string]interface{}) {
+	applied, deleted := 0, 0
+
+	for key, spec := range specs {
+		ba, err := json.Marshal(spec)
+		if err != nil {
+			klog.Error("failed to encode the ServiceState of ", key, ": ", err)
+			continue
+		}
+
+		if written, ok := j.written[key]; ok && written == string(ba) {
+			continue // unchanged
+		}
+
+		if err := j.apply(ctx, key, spec); err != nil {
+			klog.Error("failed to write the ServiceState of ", key, ": ", err)
+			delete(j.written, key)
+			continue
+		}
+
+		j.written[key] = string(ba)
+		applied++
+	}
+
+	for key := range j.written {
+		if _, ok := specs[key]; ok {
+			continue
+		}
+
+		namespace, name := splitKey(key)
+		err := j.client.Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			klog.Error("failed to delete the ServiceState of ", key, ": ", err)
+			continue
+		}
+
+		delete(j.written, key)
+		deleted++
+	}
+
+	if applied != 0 || deleted != 0 {
+		klog.V(1).Infof("mirrored the global state: %d ServiceStates written, %d deleted", applied, deleted)
+	}
+}
+
+func (j *Job) apply(ctx context.Context, key string, spec map[string]interface{}) error {
+	namespace, name := splitKey(key)
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": Resource.GroupVersion().String(),
+		"kind":       Kind,
+		"metadata": map[string]interface{}{
+			"namespace": namespace,
+			"name":      name,
+			"labels": map[string]interface{}{
+				ManagedByLabel: managedBy,
+			},
+		},
+		"spec": spec,
+	}}
+
+	_, err := j.client.Namespace(namespace).Apply(ctx, name, obj, metav1.ApplyOptions{FieldManager: fieldManager, Force: true})
+	return err
+}
+
+func splitKey(key string) (namespace, name string) {
+	namespace, name, _ = strings.Cut(key, "/")
+	return
+}
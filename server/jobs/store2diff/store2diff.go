@@ -20,6 +20,8 @@ import (
 	"context"
 
 	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/lightdiffstore"
+	"sigs.k8s.io/kpng/server/pkg/metrics"
 	"sigs.k8s.io/kpng/server/pkg/server/watchstate"
 	"sigs.k8s.io/kpng/server/proxystore"
 )
@@ -28,6 +30,9 @@ type Job struct {
 	Store *proxystore.Store
 	Sets  []localnetv1.Set
 	Sink  Sink
+
+	// Sessions keeps the state of closed watches so they can be resumed (optional).
+	Sessions *watchstate.Sessions
 }
 
 type Sink interface {
@@ -38,34 +43,61 @@ type Sink interface {
 	SendDiff(w *watchstate.WatchState) (updated bool)
 }
 
+// RevisionRequester is implemented by sinks receiving the revision to resume from with their requests.
+type RevisionRequester interface {
+	RequestedRevision() uint64
+}
+
 func (j *Job) Run(ctx context.Context) (err error) {
 	w := watchstate.New(j.Sink, j.Sets)
 
 	var (
 		rev    uint64
 		closed bool
+
+		// sentRev is the store revision of the last change set sent
+		sentRev uint64
 	)
 
 	for {
 		if err = ctx.Err(); err != nil {
 			// check the context is still active; we expect the wtachstate/sink to fail fast in this case
+			j.Sessions.Save(w)
 			return
 		}
 
 		// wait
 		err = j.Sink.Wait()
 		if err != nil {
+			// the client has the last change set sent, keep it in case it comes back
+			j.Sessions.Save(w)
 			return
 		}
 
+		// on the first request, resume the watch if possible
+		var requested uint64
 		if rev == 0 {
-			w.SendReset()
+			if req, ok := j.Sink.(RevisionRequester); ok {
+				requested = req.RequestedRevision()
+			}
+
+			if j.Sessions.Resume(w, requested) {
+				requested = 0 // resumed, the diff is computed from the saved state
+			} else if requested == 0 {
+				w.SendReset()
+			}
 		}
 
+		// a change set is sent even without changes to a resumed watch, and to a client requesting a revision: it
+		// confirms the client's state, or resets it
+		mustSync := rev == 0 && requested == 0 && w.Revision != 0
+
 		updated := false
 		for !updated {
 			// update the state
+			synced := false
 			rev, closed = j.Store.View(rev, func(tx *proxystore.Tx) {
+				synced = tx.AllSynced()
 				j.Sink.Update(tx, w)
 			})
 
@@ -77,9 +109,31 @@ func (j *Job) Run(ctx context.Context) (err error) {
 				return w.Err
 			}
 
+			if requested != 0 {
+				if !synced {
+					continue // state not available yet
+				}
+
+				if w.Digest() == requested {
+					// the client already has this state (ie: the server restarted without changes)
+					w.Reset(lightdiffstore.ItemUnchanged)
+				} else {
+					// the state may be empty, the reset is the whole change set
+					w.SendReset()
+				}
+				mustSync = true
+				requested = 0
+			}
+
 			// send the diff
-			updated = j.Sink.SendDiff(w)
+			updated = j.Sink.SendDiff(w) || mustSync
+		}
+
+		// the change set has the latest state, whatever the number of revisions since the previous one
+		if sentRev != 0 {
+			metrics.Kpng_watch_coalesced_revisions.Observe(float64(rev - sentRev))
 		}
+		sentRev = rev
 
 		// signal the change set is fully sent
 		w.SendSync()
@@ -35,6 +35,9 @@ type Sink interface {
 type Job struct {
 	Store *proxystore.Store
 	Sink  Sink
+
+	// Sessions keeps the state of closed watches so they can be resumed (optional).
+	Sessions *watchstate.Sessions
 }
 
 var sets = []localnetv1.Set{
@@ -45,9 +48,10 @@ var sets = []localnetv1.Set{
 
 func (j *Job) Run(ctx context.Context) error {
 	job := &store2diff.Job{
-		Store: j.Store,
-		Sets:  sets,
-		Sink:  j,
+		Store:    j.Store,
+		Sets:     sets,
+		Sink:     j,
+		Sessions: j.Sessions,
 	}
 
 	return job.Run(ctx)
@@ -57,6 +61,13 @@ func (j *Job) Wait() (err error) {
 	return j.Sink.Wait()
 }
 
+func (j *Job) RequestedRevision() uint64 {
+	if req, ok := j.Sink.(store2diff.RevisionRequester); ok {
+		return req.RequestedRevision()
+	}
+	return 0
+}
+
 func (j *Job) Update(tx *proxystore.Tx, w *watchstate.WatchState) {
 	if !tx.AllSynced() {
 		return
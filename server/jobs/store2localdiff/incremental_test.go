@@ -0,0 +1,274 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store2localdiff
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/pkg/server/watchstate"
+	"sigs.k8s.io/kpng/server/pkg/visibility"
+	"sigs.k8s.io/kpng/server/proxystore"
+)
+
+func TestIncrementalUpdate(t *testing.T) {
+	store := proxystore.New()
+	defer store.Close()
+
+	setService(store, "a")
+	setService(store, "b")
+
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetNode(&localnetv1.Node{Name: "node-a", Topology: &localnetv1.TopologyInfo{Node: "node-a", Zone: "z1"}})
+		tx.SetEndpointsOfSource("default", "b-abcde", []*localnetv1.EndpointInfo{{
+			Namespace:   "default",
+			SourceName:  "b-abcde",
+			ServiceName: "b",
+			PodName:     "b-1",
+			Endpoint:    &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.2.0.1")},
+			Topology:    &localnetv1.TopologyInfo{Node: "node-b", Zone: "z2"},
+			Conditions:  &localnetv1.EndpointConditions{Ready: true},
+			Hints:       &localnetv1.TopologyHints{Zones: []string{"z2"}},
+		}})
+	})
+
+	sink := &testSink{}
+	run := &jobRun{Sink: sink, nodeName: "node-a"}
+	w := watchstate.New(sink, localSets)
+
+	var (
+		rev     uint64
+		changed []string
+	)
+	step := func(name string, expected ...string) {
+		t.Helper()
+
+		rev, _ = store.View(rev, func(tx *proxystore.Tx) {
+			changed = changed[:0]
+			for key := range run.changedServices(tx, "z1") {
+				changed = append(changed, key.String())
+			}
+			sort.Strings(changed)
+
+			run.Update(tx, w)
+		})
+		run.SendDiff(w)
+
+		ops, _ := sink.summary()
+		sink.ops = nil
+
+		if strings.Join(ops, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s: expected ops %v, got %v", name, expected, ops)
+		}
+	}
+
+	step("initial", "set:node-a", "set:default/a", "set:default/b")
+	if run.rev != rev {
+		t.Errorf("expected the state computed at revision %d, got %d", rev, run.rev)
+	}
+
+	// only the changed service is updated
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetService(&localnetv1.Service{Namespace: "default", Name: "a", Type: "NodePort"})
+	})
+	step("changed", "set:default/a")
+	if strings.Join(changed, ",") != "default/a" {
+		t.Errorf("expected only default/a to be updated, got %v", changed)
+	}
+
+	store.Update(func(tx *proxystore.Tx) {
+		tx.DelService("default", "a")
+	})
+	step("deleted", "del:default/a")
+
+	// the node moved to the zone the endpoint of b is hinted for
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetNode(&localnetv1.Node{Name: "node-a", Topology: &localnetv1.TopologyInfo{Node: "node-a", Zone: "z2"}})
+	})
+	step("zone changed", "set:node-a", "set:default/b/b-1")
+	if strings.Join(changed, ",") != "" {
+		t.Errorf("expected no service changed, got %v", changed)
+	}
+
+	// services preferring close endpoints are updated when the zone changes
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetService(&localnetv1.Service{Namespace: "default", Name: "b", TrafficDistribution: localnetv1.TrafficDistributionPreferClose})
+	})
+	step("prefer close", "set:default/b")
+
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetNode(&localnetv1.Node{Name: "node-a", Topology: &localnetv1.TopologyInfo{Node: "node-a", Zone: "z1"}})
+	})
+	step("zone changed back", "set:node-a", "del:default/b/b-1")
+	if strings.Join(changed, ",") != "default/b" {
+		t.Errorf("expected default/b to be updated, got %v", changed)
+	}
+
+	// a reset of the store computes the whole state again
+	store.Update(func(tx *proxystore.Tx) {
+		tx.Reset()
+		tx.SetService(&localnetv1.Service{Namespace: "default", Name: "c"})
+		for _, set := range []proxystore.Set{proxystore.Services, proxystore.Endpoints, proxystore.Nodes} {
+			tx.SetSync(set)
+		}
+	})
+	step("reset", "set:default/c", "del:default/b", "del:node-a")
+}
+
+func TestChangedServicesUnknownRevision(t *testing.T) {
+	run := &jobRun{}
+	if changed := run.changedServices(nil, ""); changed != nil {
+		t.Errorf("expected a full update, got %v", changed)
+	}
+}
+
+func TestVisibilityPolicy(t *testing.T) {
+	store := proxystore.New()
+	defer store.Close()
+
+	setService(store, "a")
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetService(&localnetv1.Service{Namespace: "tenant-b", Name: "b", Type: "ClusterIP"})
+		tx.SetNode(&localnetv1.Node{Name: "node-a"})
+	})
+
+	policy, err := visibility.Parse([]byte("groups: [{name: tenant-b, nodeSelector: tenant=b, namespaces: [tenant-b]}]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &testSink{}
+	run := &jobRun{Sink: sink, nodeName: "node-a", policy: policy}
+	w := watchstate.New(sink, localSets)
+
+	var rev uint64
+	step := func(name string, expected ...string) {
+		t.Helper()
+
+		rev, _ = store.View(rev, func(tx *proxystore.Tx) {
+			run.Update(tx, w)
+		})
+		run.SendDiff(w)
+
+		ops, _ := sink.summary()
+		sink.ops = nil
+
+		if strings.Join(ops, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s: expected ops %v, got %v", name, expected, ops)
+		}
+	}
+
+	step("no group", "set:node-a", "set:default/a", "set:tenant-b/b")
+
+	// the node joined the group of tenant b, only seeing its namespace
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetNode(&localnetv1.Node{Name: "node-a", Labels: map[string]string{"tenant": "b"}})
+	})
+	step("in group", "set:node-a", "del:default/a")
+
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetService(&localnetv1.Service{Namespace: "default", Name: "c", Type: "ClusterIP"})
+	})
+	step("hidden service")
+}
+
+func TestNodeSent(t *testing.T) {
+	store := proxystore.New()
+	defer store.Close()
+
+	setService(store, "a")
+
+	node := &localnetv1.Node{
+		Name:     "node-a",
+		Topology: &localnetv1.TopologyInfo{Node: "node-a", Zone: "z1", Region: "r1"},
+		Labels:   map[string]string{"rack": "r1-a"},
+	}
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetNode(node)
+	})
+
+	sink := &testSink{}
+	run := &jobRun{Sink: sink, nodeName: "node-a"}
+	w := watchstate.New(sink, localSets)
+
+	store.View(0, func(tx *proxystore.Tx) {
+		run.Update(tx, w)
+	})
+	run.SendDiff(w)
+
+	var sent *localnetv1.Node
+	for _, op := range sink.ops {
+		if set := op.GetSet(); set != nil && set.Ref.Set == localnetv1.Set_NodeSet {
+			sent = &localnetv1.Node{}
+			if err := proto.Unmarshal(set.Bytes, sent); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if !proto.Equal(sent, node) {
+		t.Errorf("expected node %v, got %v", node, sent)
+	}
+}
+
+func TestCoalescedRevisions(t *testing.T) {
+	store := proxystore.New()
+	defer store.Close()
+
+	setService(store, "a")
+	setService(store, "b")
+
+	sink := &testSink{}
+	run := &jobRun{Sink: sink, nodeName: "node-a"}
+	w := watchstate.New(sink, localSets)
+
+	var rev uint64
+	step := func(name string, expected ...string) {
+		t.Helper()
+
+		rev, _ = store.View(rev, func(tx *proxystore.Tx) {
+			run.Update(tx, w)
+		})
+		run.SendDiff(w)
+
+		ops, _ := sink.summary()
+		sink.ops = nil
+
+		if strings.Join(ops, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s: expected ops %v, got %v", name, expected, ops)
+		}
+	}
+
+	step("initial", "set:default/a", "set:default/b")
+
+	// a slow client only gets the latest value of each service changed since its previous change set
+	for _, svcType := range []string{"NodePort", "LoadBalancer", "NodePort"} {
+		store.Update(func(tx *proxystore.Tx) {
+			tx.SetService(&localnetv1.Service{Namespace: "default", Name: "a", Type: svcType})
+		})
+	}
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetService(&localnetv1.Service{Namespace: "default", Name: "b", Type: "NodePort"})
+	})
+	setService(store, "b") // back to its previous value
+
+	step("coalesced", "set:default/a")
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store2localdiff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/pkg/server/watchstate"
+	"sigs.k8s.io/kpng/server/proxystore"
+)
+
+// testSink answers one request, then fails as a closed connection would.
+type testSink struct {
+	revision uint64
+	requests int
+	ops      []*localnetv1.OpItem
+}
+
+func (s *testSink) Setup() {}
+
+func (s *testSink) WaitRequest() (string, error) {
+	if s.requests == 0 {
+		return "", errors.New("closed")
+	}
+	s.requests--
+	return "node-a", nil
+}
+
+func (s *testSink) Reset() {}
+
+func (s *testSink) Send(op *localnetv1.OpItem) error {
+	s.ops = append(s.ops, op)
+	return nil
+}
+
+func (s *testSink) RequestedRevision() uint64 { return s.revision }
+
+// summary returns the ops received as "reset", "set:<path>", "del:<path>" and the sync revision.
+func (s *testSink) summary() (ops []string, revision uint64) {
+	for _, op := range s.ops {
+		switch v := op.Op.(type) {
+		case *localnetv1.OpItem_Reset_:
+			ops = append(ops, "reset")
+		case *localnetv1.OpItem_Set:
+			ops = append(ops, "set:"+v.Set.Ref.Path)
+		case *localnetv1.OpItem_Delete:
+			ops = append(ops, "del:"+v.Delete.Path)
+		case *localnetv1.OpItem_Sync:
+			revision = v.Sync.Revision
+		}
+	}
+	return
+}
+
+func setService(store *proxystore.Store, name string) {
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetService(&localnetv1.Service{
+			Namespace: "default",
+			Name:      name,
+			Type:      "ClusterIP",
+			IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.0.0.1")},
+		})
+		for _, set := range []proxystore.Set{proxystore.Services, proxystore.Endpoints, proxystore.Nodes} {
+			tx.SetSync(set)
+		}
+	})
+}
+
+func TestResumeWatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	store := proxystore.New()
+	defer store.Close()
+
+	setService(store, "a")
+
+	sessions := watchstate.NewSessions(time.Minute)
+
+	watch := func(sessions *watchstate.Sessions, revision uint64) ([]string, uint64) {
+		sink := &testSink{revision: revision, requests: 1}
+		job := &Job{Store: store, Sink: sink, Sessions: sessions}
+		job.Run(ctx)
+		return sink.summary()
+	}
+
+	check := func(name string, ops []string, expected ...string) {
+		t.Helper()
+		if len(ops) != len(expected) {
+			t.Fatalf("%s: expected ops %v, got %v", name, expected, ops)
+		}
+		for i := range ops {
+			if ops[i] != expected[i] {
+				t.Fatalf("%s: expected ops %v, got %v", name, expected, ops)
+			}
+		}
+	}
+
+	// new watch
+	ops, rev1 := watch(sessions, 0)
+	check("new", ops, "reset", "set:default/a")
+	if rev1 == 0 {
+		t.Fatal("no revision in sync")
+	}
+
+	// resumed without changes
+	ops, rev := watch(sessions, rev1)
+	check("resumed", ops)
+	if rev != rev1 {
+		t.Errorf("resumed: expected revision %d, got %d", rev1, rev)
+	}
+
+	// resumed with changes
+	setService(store, "b")
+
+	ops, rev2 := watch(sessions, rev1)
+	check("resumed with changes", ops, "set:default/b")
+	if rev2 == rev1 {
+		t.Error("revision should change with the state")
+	}
+
+	// server restarted (no sessions), same state
+	ops, rev = watch(watchstate.NewSessions(time.Minute), rev2)
+	check("restarted", ops)
+	if rev != rev2 {
+		t.Errorf("restarted: expected revision %d, got %d", rev2, rev)
+	}
+
+	// unknown revision
+	ops, rev = watch(sessions, rev1)
+	check("unknown", ops, "reset", "set:default/a", "set:default/b")
+	if rev != rev2 {
+		t.Errorf("unknown: expected revision %d, got %d", rev2, rev)
+	}
+}
+
+func TestResumeEmptyState(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	store := proxystore.New()
+	defer store.Close()
+
+	store.Update(func(tx *proxystore.Tx) {
+		for _, set := range []proxystore.Set{proxystore.Services, proxystore.Endpoints, proxystore.Nodes} {
+			tx.SetSync(set)
+		}
+	})
+
+	// the client had services, all deleted while it was away: its state is reset
+	sink := &testSink{revision: 1234, requests: 1}
+	job := &Job{Store: store, Sink: sink, Sessions: watchstate.NewSessions(time.Minute)}
+	job.Run(ctx)
+
+	ops, rev := sink.summary()
+	if len(ops) != 1 || ops[0] != "reset" {
+		t.Fatalf("expected a reset, got %v", ops)
+	}
+	if rev == 0 {
+		t.Error("no sync after the reset")
+	}
+}
@@ -20,123 +20,355 @@ import (
 	"context"
 	"runtime/trace"
 	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/types"
 
 	"sigs.k8s.io/kpng/api/localnetv1"
 	"sigs.k8s.io/kpng/client/lightdiffstore"
 	"sigs.k8s.io/kpng/client/localsink"
+	"sigs.k8s.io/kpng/client/localsink/servicetypes"
+	"sigs.k8s.io/kpng/client/tracing"
 	"sigs.k8s.io/kpng/server/jobs/store2diff"
 	"sigs.k8s.io/kpng/server/pkg/endpoints"
+	"sigs.k8s.io/kpng/server/pkg/metrics"
 	"sigs.k8s.io/kpng/server/pkg/server/watchstate"
+	"sigs.k8s.io/kpng/server/pkg/visibility"
 	"sigs.k8s.io/kpng/server/proxystore"
 	"sigs.k8s.io/kpng/server/serde"
 )
 
+// localSets are the sets of the local state.
+var localSets = []localnetv1.Set{
+	localnetv1.Set_ServicesSet,
+	localnetv1.Set_EndpointsSet,
+	localnetv1.Set_EndpointsSet, // 2nd endpoints set for endpoints which do not have a corresponding pod name
+	localnetv1.Set_NodeSet,
+}
+
 type Job struct {
 	Store *proxystore.Store
 	Sink  localsink.Sink
+
+	// ServiceTypes restricts the services sent to the sink (all types if empty).
+	// Overridden by the sink's request if it implements ServiceTypesRequester.
+	ServiceTypes []string
+
+	// Sessions keeps the state of closed watches so they can be resumed (optional).
+	Sessions *watchstate.Sessions
+
+	// Policy restricts the services visible to the node (optional).
+	Policy *visibility.Policy
+
+	// MaxEndpointsPerService caps the endpoints sent for each service (unlimited if 0, see endpoints.Subset).
+	MaxEndpointsPerService int
+}
+
+// ServiceTypesRequester is implemented by sinks receiving the service types to send with their requests.
+type ServiceTypesRequester interface {
+	RequestedServiceTypes() []string
 }
 
 func (j *Job) Run(ctx context.Context) error {
 	run := &jobRun{
-		Sink: j.Sink,
+		Sink:         j.Sink,
+		serviceTypes: j.ServiceTypes,
+		policy:       j.Policy,
+		maxEndpoints: j.MaxEndpointsPerService,
 	}
 
 	job := &store2diff.Job{
-		Store: j.Store,
-		Sets: []localnetv1.Set{
-			localnetv1.Set_ServicesSet,
-			localnetv1.Set_EndpointsSet,
-			localnetv1.Set_EndpointsSet, // 2nd endpoints set for endpoints which do not have a corresponding pod name
-		},
-		Sink: run,
+		Store:    j.Store,
+		Sets:     localSets,
+		Sink:     run,
+		Sessions: j.Sessions,
 	}
 
 	j.Sink.Setup()
 
+	defer func() {
+		if run.nodeName != "" {
+			deleteNodeMetrics(run.nodeName)
+		}
+	}()
+
 	return job.Run(ctx)
 }
 
 type jobRun struct {
 	localsink.Sink
-	nodeName string
+	nodeName     string
+	serviceTypes []string
+	policy       *visibility.Policy
+	maxEndpoints int
+
+	// rev is the revision of the store the watch state was computed from, 0 if it must be computed from scratch
+	rev uint64
+	// zone is the zone of the node the endpoints were filtered for
+	zone string
+	// filter is the visibility of the services for the node
+	filter *visibility.Filter
+
+	// diffStart is the time the diff started to be computed, and diffServices the services it updates, for the
+	// diff span (see SendDiff)
+	diffStart    time.Time
+	diffServices map[string]bool
+
+	// filtered are the services of the state filtered out because of their type, and hidden the ones hidden from
+	// the node by the visibility policy
+	filtered map[string]bool
+	hidden   map[string]bool
 }
 
 func (s *jobRun) Wait() (err error) {
+	nodeName := s.nodeName
+	serviceTypes := s.serviceTypes
+
 	s.nodeName, err = s.WaitRequest()
+
+	if req, ok := s.Sink.(ServiceTypesRequester); ok {
+		s.serviceTypes = req.RequestedServiceTypes()
+	}
+
+	if s.nodeName != nodeName || !sameStrings(s.serviceTypes, serviceTypes) {
+		s.rev = 0 // the request changed, compute the state again
+	}
+	if nodeName != "" && s.nodeName != nodeName {
+		deleteNodeMetrics(nodeName)
+	}
 	return
 }
 
+// setNodeMetrics sets the metrics of the node's state, once computed.
+func (s *jobRun) setNodeMetrics() {
+	metrics.Kpng_filtered_services.WithLabelValues(s.nodeName).Set(float64(len(s.filtered)))
+	metrics.Kpng_hidden_services.WithLabelValues(s.nodeName).Set(float64(len(s.hidden)))
+}
+
+// deleteNodeMetrics deletes the metrics of the node's state, when it's not watched anymore.
+func deleteNodeMetrics(nodeName string) {
+	metrics.Kpng_filtered_services.DeleteLabelValues(nodeName)
+	metrics.Kpng_hidden_services.DeleteLabelValues(nodeName)
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *jobRun) RequestedRevision() uint64 {
+	if req, ok := s.Sink.(store2diff.RevisionRequester); ok {
+		return req.RequestedRevision()
+	}
+	return 0
+}
+
 func (s *jobRun) Update(tx *proxystore.Tx, w *watchstate.WatchState) {
 	if !tx.AllSynced() {
 		return
 	}
 
-	nodeName := s.nodeName
-
 	ctx, task := trace.NewTask(context.Background(), "LocalState.Update")
 	defer task.End()
 
+	node := tx.GetNode(s.nodeName)
+	zone := node.GetTopology().GetZone()
+	filter := s.policy.ForNode(node)
+
+	changed := s.changedServices(tx, zone)
+	if s.rev != 0 && filter.Key() != s.filter.Key() {
+		changed = nil // the node's groups changed, so did the visible services
+	}
+
+	s.rev = tx.Revision()
+	s.zone = zone
+	s.filter = filter
+
+	s.diffStart = time.Now()
+	s.diffServices = map[string]bool{}
+
+	if changed == nil {
+		// compute the whole state: entries not set again are deleted
+		w.Reset(lightdiffstore.ItemDeleted)
+		s.filtered = map[string]bool{}
+		s.hidden = map[string]bool{}
+	}
+
+	s.updateNode(w, node)
+
+	if changed == nil {
+		tx.Each(proxystore.Services, func(kv *proxystore.KV) bool {
+			s.diffServices[kv.Namespace+"/"+kv.Name] = true
+			s.updateService(ctx, tx, w, kv.Namespace, kv.Name, kv.Service)
+			return true
+		})
+	} else {
+		// only update the changed services (from the store's change index)
+		for key := range changed {
+			s.diffServices[key.String()] = true
+			s.updateService(ctx, tx, w, key.Namespace, key.Name, tx.GetServiceInfo(key.Namespace, key.Name))
+		}
+	}
+
+	s.setNodeMetrics()
+}
+
+// changedServices returns the services to update since the last revision computed, or nil if the whole state
+// must be computed.
+func (s *jobRun) changedServices(tx *proxystore.Tx, zone string) (changed map[types.NamespacedName]bool) {
+	if s.rev == 0 {
+		return nil
+	}
+
+	changed = map[types.NamespacedName]bool{}
+	add := func(namespace, name string) {
+		changed[types.NamespacedName{Namespace: namespace, Name: name}] = true
+	}
+
+	if !tx.EachServiceChangedSince(s.rev, add) {
+		return nil
+	}
+
+	if zone != s.zone {
+		// the services with topology hints for the previous or the new zone are filtered differently, and so are
+		// the ones preferring close endpoints
+		tx.EachServiceHintedForZone(s.zone, add)
+		tx.EachServiceHintedForZone(zone, add)
+		tx.EachServicePreferringClose(add)
+	}
+
+	return
+}
+
+// updateNode sets the node the state is computed for, so the backends get its topology and labels. The node is
+// nil if it's not known (yet).
+func (s *jobRun) updateNode(w *watchstate.WatchState, node *localnetv1.Node) {
+	nodes := w.StoreFor(localnetv1.Set_NodeSet)
+
+	key := []byte(s.nodeName)
+	if node == nil {
+		nodes.Delete(key)
+		return
+	}
+
+	nodes.Set(key, serde.Hash(node), node)
+}
+
+// updateService sets the local state of a service and its endpoints, deleting its entries not set again. The
+// service is nil if it was deleted.
+func (s *jobRun) updateService(ctx context.Context, tx *proxystore.Tx, w *watchstate.WatchState, namespace, name string,
+	service *localnetv1.ServiceInfo) {
 	svcs := w.StoreFor(localnetv1.Set_ServicesSet)
 	seps := w.StoreFor(localnetv1.Set_EndpointsSet)
 	sepsAnonymous := w.StoreForN(localnetv1.Set_EndpointsSet, 1)
 
-	// set all new values
-	tx.Each(proxystore.Services, func(kv *proxystore.KV) bool {
-		key := []byte(kv.Namespace + "/" + kv.Name)
+	key := []byte(namespace + "/" + name)
 
-		if trace.IsEnabled() {
-			trace.Log(ctx, "service", string(key))
+	// entries set again below are kept, the others are deleted
+	svcs.Delete(key)
+	prefix := append(key[:len(key):len(key)], '/')
+	seps.DeleteByPrefix(prefix)
+	sepsAnonymous.DeleteByPrefix(prefix)
+	delete(s.filtered, string(key))
+	delete(s.hidden, string(key))
+
+	if service == nil {
+		return
+	}
+
+	if !servicetypes.Accept(s.serviceTypes, service.Service.Type) {
+		s.filtered[string(key)] = true
+		return
+	}
+
+	if !s.filter.Visible(namespace, name) {
+		s.hidden[string(key)] = true
+		return
+	}
+
+	if trace.IsEnabled() {
+		trace.Log(ctx, "service", string(key))
+	}
+	svcs.Set(key, service.Hash, service.Service)
+
+	// filter endpoints for this node
+	endpointInfos := endpoints.ForNode(tx, service, s.nodeName)
+	endpointInfos = endpoints.Subset(endpointInfos, s.nodeName, s.maxEndpoints)
+
+	for _, ei := range endpointInfos {
+		// hash only the endpoint
+		hash := serde.Hash(ei.Endpoint)
+
+		var epKey []byte
+		var set *lightdiffstore.DiffStore
+
+		if ei.PodName == "" {
+			set = sepsAnonymous
+			// key is service key + endpoint hash (64 bits, in hex)
+			epKey = append(make([]byte, 0, len(key)+1+64/8*2), key...)
+			epKey = append(epKey, '/')
+			epKey = strconv.AppendUint(epKey, hash, 16)
+		} else {
+			set = seps
+			// key is service key + podName
+			epKey = append(make([]byte, 0, len(key)+1+len(ei.PodName)), key...)
+			epKey = append(epKey, '/')
+			epKey = append(epKey, []byte(ei.PodName)...)
 		}
-		svcs.Set(key, kv.Service.Hash, kv.Service.Service)
-
-		// filter endpoints for this node
-		endpointInfos := endpoints.ForNode(tx, kv.Service, nodeName)
-
-		for _, ei := range endpointInfos {
-			// hash only the endpoint
-			hash := serde.Hash(ei.Endpoint)
-
-			var epKey []byte
-			var set *lightdiffstore.DiffStore
-
-			if ei.PodName == "" {
-				set = sepsAnonymous
-				// key is service key + endpoint hash (64 bits, in hex)
-				epKey = append(make([]byte, 0, len(key)+1+64/8*2), key...)
-				epKey = append(epKey, '/')
-				epKey = strconv.AppendUint(epKey, hash, 16)
-			} else {
-				set = seps
-				// key is service key + podName
-				epKey = append(make([]byte, 0, len(key)+1+len(ei.PodName)), key...)
-				epKey = append(epKey, '/')
-				epKey = append(epKey, []byte(ei.PodName)...)
-			}
-
-			if trace.IsEnabled() {
-				trace.Log(ctx, "endpoint", string(epKey))
-			}
-
-			set.Set(epKey, hash, ei.Endpoint)
+
+		if trace.IsEnabled() {
+			trace.Log(ctx, "endpoint", string(epKey))
 		}
 
-		return true
-	})
+		set.Set(epKey, hash, ei.Endpoint)
+	}
 }
 
-func (*jobRun) SendDiff(w *watchstate.WatchState) (updated bool) {
+func (s *jobRun) SendDiff(w *watchstate.WatchState) (updated bool) {
 	_, task := trace.NewTask(context.Background(), "LocalState.SendDiff")
 	defer task.End()
 
 	count := 0
+	count += w.SendUpdates(localnetv1.Set_NodeSet)
 	count += w.SendUpdates(localnetv1.Set_ServicesSet)
 	count += w.SendDeletesN(localnetv1.Set_EndpointsSet, 1)
 	count += w.SendUpdates(localnetv1.Set_EndpointsSet)
 	count += w.SendDeletes(localnetv1.Set_EndpointsSet)
 	count += w.SendUpdatesN(localnetv1.Set_EndpointsSet, 1)
 	count += w.SendDeletes(localnetv1.Set_ServicesSet)
+	count += w.SendDeletes(localnetv1.Set_NodeSet)
 
-	w.Reset(lightdiffstore.ItemDeleted)
+	// the next updates only change the state of the changed services (see Update)
+	w.Reset(lightdiffstore.ItemUnchanged)
+
+	if count != 0 {
+		w.TraceParent = s.traceDiff(count)
+	}
 
 	return count != 0
 }
+
+// traceDiff traces the diff sent (kpng.diff), from the start of its computation, linked to the watch events of the
+// services it updates. It returns the trace context to send to the node.
+func (s *jobRun) traceDiff(ops int) string {
+	ctx, span := tracing.Tracer().Start(context.Background(), "kpng.diff",
+		oteltrace.WithTimestamp(s.diffStart),
+		oteltrace.WithLinks(tracing.EventLinks(s.diffServices)...),
+		oteltrace.WithAttributes(
+			attribute.String("kpng.node", s.nodeName),
+			attribute.Int("kpng.ops", ops),
+			tracing.Services(s.diffServices),
+		))
+	span.End()
+
+	return tracing.TraceParent(ctx)
+}
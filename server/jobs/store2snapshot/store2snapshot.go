@@ -0,0 +1,136 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package store2snapshot persists the global state to a local file, so a restarted brain serves it right away
+// while its sources are listed again.
+package store2snapshot
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/server/proxystore"
+)
+
+type Config struct {
+	FilePath string
+	Interval time.Duration
+}
+
+func (c *Config) BindFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.FilePath, "snapshot", "", "file to persist the global state to, and to restore it from on start (disabled if empty)")
+	flags.DurationVar(&c.Interval, "snapshot-interval", 10*time.Second, "min interval between two writes of the snapshot")
+}
+
+// Restore restores the store from the snapshot, if it exists.
+func Restore(store *proxystore.Store, path string) (err error) {
+	in, err := os.Open(path)
+	if os.IsNotExist(err) {
+		klog.Info("no snapshot to restore at ", path)
+		return nil
+	} else if err != nil {
+		return
+	}
+	defer in.Close()
+
+	count := 0
+	store.Update(func(tx *proxystore.Tx) {
+		count, err = tx.RestoreSnapshot(in)
+	})
+	if err != nil {
+		return
+	}
+
+	klog.Info("restored ", count, " entries from ", path)
+	return
+}
+
+type Job struct {
+	Store  *proxystore.Store
+	Config *Config
+}
+
+// Run writes the snapshot when the store changes, at most once per interval.
+func (j *Job) Run(ctx context.Context) {
+	var (
+		rev    uint64
+		closed bool
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(j.Config.Interval):
+		}
+
+		// encode in memory so the store isn't locked while writing the file
+		var (
+			snapshot bytes.Buffer
+			err      error
+			ok       bool
+		)
+		rev, closed = j.Store.View(rev, func(tx *proxystore.Tx) {
+			if !tx.AllSynced() {
+				return // not a complete state
+			}
+			err = tx.WriteSnapshot(&snapshot)
+			ok = err == nil
+		})
+
+		if closed {
+			return
+		}
+
+		if ok {
+			err = j.write(snapshot.Bytes())
+		}
+		if err != nil {
+			klog.Error("failed to write the snapshot: ", err)
+		}
+	}
+}
+
+// write writes the snapshot to a temporary file, then replaces the previous snapshot with it so it's never
+// partially written.
+func (j *Job) write(snapshot []byte) (err error) {
+	path := j.Config.FilePath
+
+	out, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(out.Name()) // noop once renamed
+
+	_, err = out.Write(snapshot)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+
+	return os.Rename(out.Name(), path)
+}
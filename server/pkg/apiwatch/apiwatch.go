@@ -17,28 +17,62 @@ limitations under the License.
 package apiwatch
 
 import (
+	"context"
+
 	"github.com/spf13/pflag"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
 
+	"sigs.k8s.io/kpng/client/compression"
+	"sigs.k8s.io/kpng/client/connpolicy"
 	"sigs.k8s.io/kpng/client/tlsflags"
+	"sigs.k8s.io/kpng/client/tokenfile"
+	"sigs.k8s.io/kpng/server/pkg/metrics"
 )
 
 type Watch struct {
-	Server   string
-	TLSFlags *tlsflags.Flags
+	Server      string
+	TLSFlags    *tlsflags.Flags
+	Compression string
+	TokenFile   string
+
+	// Conn configures the keepalive pings and the reconnections.
+	Conn connpolicy.Config
+
+	// OnState is called with the states of the connections to the API, in addition to the metrics (optional).
+	OnState func(connectivity.State)
 }
 
 func (w *Watch) BindFlags(flags *pflag.FlagSet) {
 	flags.StringVar(&w.Server, "api", "127.0.0.1:12090", "Remote API server to query")
 	w.TLSFlags.Bind(flags, "api-client-")
+	flags.StringVar(&w.Compression, "api-compression", compression.None, "compression of the API streams (none or gzip)")
+	flags.StringVar(&w.TokenFile, "api-client-token-file", "", "file of the bearer token authenticating to the API (ie: a projected service account token, requires TLS)")
+	w.Conn.Bind(flags, "api-")
+}
+
+// NewBackoff returns the delays between the retries of the watches.
+func (w *Watch) NewBackoff() *connpolicy.Backoff {
+	return w.Conn.NewBackoff(0)
 }
 
 func (w *Watch) Dial() (conn *grpc.ClientConn, err error) {
 	// connect to API
-	opts := []grpc.DialOption{}
+	opts, err := compression.DialOptions(w.Compression)
+	if err != nil {
+		return
+	}
+
+	opts = append(opts, tokenfile.DialOptions(w.TokenFile)...)
+	opts = append(opts, w.Conn.DialOptions()...)
 
-	if cfg := w.TLSFlags.Config(); cfg == nil {
+	cfg, err := w.TLSFlags.ClientConfig()
+	if err != nil {
+		return
+	}
+
+	if cfg == nil {
 		opts = append(opts, grpc.WithInsecure())
 	} else {
 		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(cfg)))
@@ -49,5 +83,12 @@ func (w *Watch) Dial() (conn *grpc.ClientConn, err error) {
 		return
 	}
 
+	go connpolicy.WatchState(context.Background(), conn, func(state connectivity.State) {
+		metrics.SetAPIConnectionState(state)
+		if w.OnState != nil {
+			w.OnState(state)
+		}
+	})
+
 	return
 }
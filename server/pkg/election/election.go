@@ -0,0 +1,140 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package election runs a job only while the replica is the leader, elected with a Lease. The replicas not leading
+// are hot standbys: they keep their global state up to date, so a new leader serves it right away, and its clients
+// resume their watches from the revision they have instead of replaying the full state (see watchstate.Sessions).
+package election
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+type Config struct {
+	Enabled    bool
+	Kubeconfig string
+	// Lease is the namespace/name of the Lease.
+	Lease    string
+	Identity string
+
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+func (c *Config) BindFlags(flags *pflag.FlagSet) {
+	hostname, _ := os.Hostname()
+
+	flags.BoolVar(&c.Enabled, "leader-elect", false, "only serve while being the leader, elected with a Lease, so multiple replicas can run")
+	flags.StringVar(&c.Kubeconfig, "leader-elect-kubeconfig", "", "kubeconfig used to manage the Lease (in-cluster configuration if empty)")
+	flags.StringVar(&c.Lease, "leader-elect-lease", "kube-system/kpng", "namespace/name of the Lease")
+	flags.StringVar(&c.Identity, "leader-elect-identity", hostname, "identity of this replica in the Lease")
+	flags.DurationVar(&c.LeaseDuration, "leader-elect-lease-duration", 15*time.Second, "duration the standbys wait before taking over a Lease not renewed")
+	flags.DurationVar(&c.RenewDeadline, "leader-elect-renew-deadline", 10*time.Second, "duration the leader retries to renew the Lease before stepping down")
+	flags.DurationVar(&c.RetryPeriod, "leader-elect-retry-period", 2*time.Second, "interval between the tries to acquire or renew the Lease")
+}
+
+// Run runs the job while leading, until the context is done or the job fails. The job's context is canceled when
+// the leadership is lost, then the replica campaigns again. Without election, the job is simply run.
+func (c *Config) Run(ctx context.Context, job func(ctx context.Context) error) (err error) {
+	if !c.Enabled {
+		return job(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lock, err := c.lock()
+	if err != nil {
+		return err
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   c.LeaseDuration,
+		RenewDeadline:   c.RenewDeadline,
+		RetryPeriod:     c.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            c.Lease,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				klog.Info("leading ", c.Lease, " as ", c.Identity)
+				if jobErr := job(ctx); jobErr != nil {
+					err = jobErr
+					cancel() // releases the lease
+				}
+			},
+			OnStoppedLeading: func() {
+				klog.Info("not leading ", c.Lease, " anymore")
+			},
+			OnNewLeader: func(identity string) {
+				if identity != c.Identity {
+					klog.Info("standing by, ", c.Lease, " is led by ", identity)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// campaign again after losing the leadership, the state is still kept up to date
+	for ctx.Err() == nil {
+		elector.Run(ctx)
+	}
+
+	return
+}
+
+func (c *Config) lock() (resourcelock.Interface, error) {
+	namespace, name, ok := strings.Cut(c.Lease, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("invalid lease %q, expected namespace/name", c.Lease)
+	}
+
+	if c.Identity == "" {
+		return nil, fmt.Errorf("no leader election identity")
+	}
+
+	cfg, err := clientcmd.BuildConfigFromFlags("", c.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Client:     client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: c.Identity},
+	}, nil
+}
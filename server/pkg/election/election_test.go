@@ -0,0 +1,46 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package election
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRunWithoutElection(t *testing.T) {
+	jobErr := errors.New("failed")
+
+	err := (&Config{}).Run(context.Background(), func(context.Context) error { return jobErr })
+	if err != jobErr {
+		t.Errorf("expected the job's error, got %v", err)
+	}
+}
+
+func TestInvalidLease(t *testing.T) {
+	for _, lease := range []string{"kpng", "/kpng", "kube-system/"} {
+		c := &Config{Enabled: true, Lease: lease, Identity: "node-a"}
+
+		err := c.Run(context.Background(), func(context.Context) error {
+			t.Fatal("the job shouldn't run")
+			return nil
+		})
+		if err == nil {
+			t.Errorf("expected an error for lease %q", lease)
+		}
+	}
+}
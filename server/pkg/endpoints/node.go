@@ -17,9 +17,13 @@ limitations under the License.
 package endpoints
 
 import (
+	"strconv"
+	"strings"
+
 	"google.golang.org/protobuf/proto"
 
 	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/featuregate"
 	proxystore "sigs.k8s.io/kpng/server/proxystore"
 )
 
@@ -40,17 +44,26 @@ func ForNode(tx *proxystore.Tx, si *localnetv1.ServiceInfo, nodeName string) (en
 
 	svc := si.Service
 
+	proxyTerminating := featuregate.Enabled(featuregate.ProxyTerminatingEndpoints)
+
 	infos := make([]*localnetv1.EndpointInfo, 0)
-	tx.EachEndpointOfService(svc.Namespace, svc.Name, func(info *localnetv1.EndpointInfo) {
+	seen := map[string]bool{}
+	add := func(info *localnetv1.EndpointInfo) {
+		// an endpoint moved between the slices of a service is briefly in both
+		if key := endpointKey(info.Endpoint); key != "" {
+			if seen[key] {
+				return
+			}
+			seen[key] = true
+		}
+
 		info = proto.Clone(info).(*localnetv1.EndpointInfo)
 
+		// computed here, so the backends don't depend on the endpoint IPs being the node's addresses
+		info.Endpoint.NodeName = info.Topology.Node
 		info.Endpoint.Local = info.Topology.Node == nodeName
 
-		if !info.Conditions.Ready {
-			return
-		}
-
-		if hints := info.Hints; hints != nil {
+		if hints := info.Hints; hints != nil && featuregate.Enabled(featuregate.TopologyAwareHints) {
 			if len(hints.Zones) != 0 {
 				// filter by zone
 				isForNodeZone := false
@@ -68,22 +81,108 @@ func ForNode(tx *proxystore.Tx, si *localnetv1.ServiceInfo, nodeName string) (en
 		}
 
 		infos = append(infos, info)
+	}
+
+	var terminating []*localnetv1.EndpointInfo
+	tx.EachEndpointOfService(svc.Namespace, svc.Name, func(info *localnetv1.EndpointInfo) {
+		if info.Conditions.Ready {
+			add(info)
+		} else if proxyTerminating && isServingTerminating(info) {
+			terminating = append(terminating, info)
+		}
 	})
 
+	// added last, so the ready copy of an endpoint moved between slices is kept
+	for _, info := range terminating {
+		add(info)
+	}
+
+	if svc.PrefersClose() {
+		infos = preferZone(infos, node.GetTopology().GetZone())
+	}
+
 	endpoints = make([]*localnetv1.EndpointInfo, 0, len(infos))
 
+	// invalid weights are reported by the service's event handler, and ignored
+	weights, _ := svc.GetEndpointWeights()
+
 	// select endpoints for this service
 
+	hasReady := localnetv1.EndpointScopes{}
 	for _, info := range infos {
 		info.Endpoint.Scopes = &localnetv1.EndpointScopes{
 			Internal: info.Endpoint.Local || !si.Service.InternalTrafficToLocal,
 			External: info.Endpoint.Local || !si.Service.ExternalTrafficToLocal,
 		}
 
-		if info.Endpoint.Scopes.Any() {
-			endpoints = append(endpoints, info)
+		if info.Conditions.Ready {
+			hasReady.Internal = hasReady.Internal || info.Endpoint.Scopes.Internal
+			hasReady.External = hasReady.External || info.Endpoint.Scopes.External
 		}
 	}
 
+	for _, info := range infos {
+		if !info.Conditions.Ready {
+			// serving terminating endpoints are only used in the scopes without ready endpoints
+			info.Endpoint.Scopes.Internal = info.Endpoint.Scopes.Internal && !hasReady.Internal
+			info.Endpoint.Scopes.External = info.Endpoint.Scopes.External && !hasReady.External
+		}
+
+		if !info.Endpoint.Scopes.Any() {
+			continue
+		}
+
+		// named target ports are resolved here, so the backends get numeric ports
+		info.Endpoint.ResolvePorts(svc.Ports)
+
+		info.Endpoint.Weight = weights.Of(info.PodName)
+
+		endpoints = append(endpoints, info)
+	}
+
 	return
 }
+
+// isServingTerminating returns true if the endpoint is terminating but still serving (see ProxyTerminatingEndpoints).
+func isServingTerminating(info *localnetv1.EndpointInfo) bool {
+	return info.Conditions.Serving && info.Conditions.Terminating
+}
+
+// preferZone returns the endpoints in the zone, or all of them if the zone is unknown or has no ready one.
+func preferZone(infos []*localnetv1.EndpointInfo, zone string) []*localnetv1.EndpointInfo {
+	if zone == "" {
+		return infos
+	}
+
+	inZone := make([]*localnetv1.EndpointInfo, 0, len(infos))
+	hasReady := false
+	for _, info := range infos {
+		if info.GetTopology().GetZone() == zone {
+			inZone = append(inZone, info)
+			hasReady = hasReady || info.Conditions.Ready
+		}
+	}
+
+	// the terminating endpoints of the zone don't replace the ready ones of the others
+	if !hasReady {
+		return infos
+	}
+	return inZone
+}
+
+// endpointKey identifies an endpoint across the slices of a service, by its IPs and ports ("" without IPs).
+func endpointKey(ep *localnetv1.Endpoint) string {
+	if len(ep.IPs.All()) == 0 {
+		return ""
+	}
+
+	b := &strings.Builder{}
+	for _, ip := range ep.IPs.All() {
+		b.WriteString(ip)
+		b.WriteByte(',')
+	}
+	for _, port := range ep.PortOverrides {
+		b.WriteString("|" + port.Name + "/" + port.Protocol.String() + ":" + strconv.Itoa(int(port.Port)))
+	}
+	return b.String()
+}
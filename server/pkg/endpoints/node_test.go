@@ -18,8 +18,12 @@ package endpoints
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"testing"
 
 	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/featuregate"
 	proxystore "sigs.k8s.io/kpng/server/proxystore"
 )
 
@@ -94,3 +98,334 @@ func ExampleForNodeWithTopology() {
 	//   - service test:
 	//     - ep V4:"10.2.1.1"
 }
+
+func TestForNodePreferClose(t *testing.T) {
+	store := proxystore.New()
+
+	service := &localnetv1.Service{
+		Namespace:           "test",
+		Name:                "test",
+		Type:                "ClusterIP",
+		IPs:                 &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.1.2.3")},
+		Ports:               []*localnetv1.PortMapping{{Port: 1234}},
+		TrafficDistribution: localnetv1.TrafficDistributionPreferClose,
+	}
+
+	endpoint := func(ip, node, zone string) *localnetv1.EndpointInfo {
+		return &localnetv1.EndpointInfo{
+			Namespace:   "test",
+			SourceName:  "test-abcde",
+			ServiceName: "test",
+			Endpoint:    &localnetv1.Endpoint{IPs: localnetv1.NewIPSet(ip)},
+			Topology:    &localnetv1.TopologyInfo{Node: node, Zone: zone},
+			Conditions:  &localnetv1.EndpointConditions{Ready: true},
+		}
+	}
+
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetService(service)
+		tx.SetEndpointsOfSource("test", "test-abcde", []*localnetv1.EndpointInfo{
+			endpoint("10.2.0.1", "host-a", "zone-a"),
+			endpoint("10.2.0.2", "host-a", "zone-a"),
+			endpoint("10.2.1.1", "host-b", "zone-b"),
+		})
+
+		for host, zone := range map[string]string{"host-a": "zone-a", "host-b": "zone-b", "host-c": "zone-c", "host-d": ""} {
+			tx.SetNode(&localnetv1.Node{Name: host, Topology: &localnetv1.TopologyInfo{Node: host, Zone: zone}})
+		}
+	})
+
+	endpointsOf := func(host string) (ips string) {
+		store.View(0, func(tx *proxystore.Tx) {
+			var list []string
+			for _, epi := range ForNode(tx, tx.GetServiceInfo("test", "test"), host) {
+				list = append(list, epi.Endpoint.IPs.V4...)
+			}
+			sort.Strings(list)
+			ips = strings.Join(list, ",")
+		})
+		return
+	}
+
+	for host, expected := range map[string]string{
+		"host-a": "10.2.0.1,10.2.0.2",
+		"host-b": "10.2.1.1",
+		"host-c": "10.2.0.1,10.2.0.2,10.2.1.1", // no endpoint in the zone
+		"host-d": "10.2.0.1,10.2.0.2,10.2.1.1", // unknown zone
+	} {
+		if ips := endpointsOf(host); ips != expected {
+			t.Errorf("%s: expected endpoints %s, got %s", host, expected, ips)
+		}
+	}
+
+	// no preference
+	store.Update(func(tx *proxystore.Tx) {
+		service.TrafficDistribution = ""
+		tx.SetService(service)
+	})
+
+	if ips := endpointsOf("host-b"); ips != "10.2.0.1,10.2.0.2,10.2.1.1" {
+		t.Errorf("expected all the endpoints without preference, got %s", ips)
+	}
+}
+
+func TestForNodeMultipleSlices(t *testing.T) {
+	store := proxystore.New()
+
+	endpoint := func(slice, ip string, ready bool) *localnetv1.EndpointInfo {
+		return &localnetv1.EndpointInfo{
+			Namespace:   "test",
+			SourceName:  slice,
+			ServiceName: "test",
+			Endpoint: &localnetv1.Endpoint{
+				IPs:           localnetv1.NewIPSet(ip),
+				PortOverrides: []*localnetv1.PortName{{Name: "http", Port: 8080}},
+			},
+			Topology:   &localnetv1.TopologyInfo{Node: "host-a"},
+			Conditions: &localnetv1.EndpointConditions{Ready: ready},
+		}
+	}
+
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetService(&localnetv1.Service{
+			Namespace: "test",
+			Name:      "test",
+			Type:      "ClusterIP",
+			IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.1.2.3")},
+			Ports:     []*localnetv1.PortMapping{{Name: "http", Port: 80}},
+		})
+
+		// 10.2.0.2 is moving from test-abcde to test-fghij, and not ready yet in test-fghij
+		tx.SetEndpointsOfSource("test", "test-abcde", []*localnetv1.EndpointInfo{
+			endpoint("test-abcde", "10.2.0.1", true),
+			endpoint("test-abcde", "10.2.0.2", true),
+		})
+		tx.SetEndpointsOfSource("test", "test-fghij", []*localnetv1.EndpointInfo{
+			endpoint("test-fghij", "10.2.0.2", false),
+			endpoint("test-fghij", "10.2.0.3", true),
+		})
+	})
+
+	store.View(0, func(tx *proxystore.Tx) {
+		var list []string
+		for _, epi := range ForNode(tx, tx.GetServiceInfo("test", "test"), "host-a") {
+			list = append(list, epi.Endpoint.IPs.V4...)
+		}
+		sort.Strings(list)
+
+		if ips := strings.Join(list, ","); ips != "10.2.0.1,10.2.0.2,10.2.0.3" {
+			t.Errorf("expected each endpoint once, got %s", ips)
+		}
+	})
+
+	// once ready in both slices
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetEndpointsOfSource("test", "test-fghij", []*localnetv1.EndpointInfo{
+			endpoint("test-fghij", "10.2.0.2", true),
+			endpoint("test-fghij", "10.2.0.3", true),
+		})
+	})
+
+	store.View(0, func(tx *proxystore.Tx) {
+		if n := len(ForNode(tx, tx.GetServiceInfo("test", "test"), "host-a")); n != 3 {
+			t.Errorf("expected 3 endpoints, got %d", n)
+		}
+	})
+}
+
+func TestForNodeLocalEndpoints(t *testing.T) {
+	store := proxystore.New()
+
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetService(&localnetv1.Service{
+			Namespace: "test",
+			Name:      "test",
+			Type:      "ClusterIP",
+			IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.1.2.3")},
+			Ports:     []*localnetv1.PortMapping{{Port: 80}},
+		})
+
+		tx.SetEndpointsOfSource("test", "test-abcde", []*localnetv1.EndpointInfo{
+			{
+				Namespace:   "test",
+				SourceName:  "test-abcde",
+				ServiceName: "test",
+				Endpoint:    &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.2.0.1")},
+				Topology:    &localnetv1.TopologyInfo{Node: "host-a"},
+				Conditions:  &localnetv1.EndpointConditions{Ready: true},
+			},
+			{
+				Namespace:   "test",
+				SourceName:  "test-abcde",
+				ServiceName: "test",
+				Endpoint:    &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.2.1.1")},
+				Topology:    &localnetv1.TopologyInfo{Node: "host-b"},
+				Conditions:  &localnetv1.EndpointConditions{Ready: true},
+			},
+		})
+	})
+
+	store.View(0, func(tx *proxystore.Tx) {
+		var list []string
+		for _, epi := range ForNode(tx, tx.GetServiceInfo("test", "test"), "host-a") {
+			list = append(list, fmt.Sprintf("%s@%s:%v", epi.Endpoint.IPs.First(), epi.Endpoint.NodeName, epi.Endpoint.Local))
+		}
+		sort.Strings(list)
+
+		if eps := strings.Join(list, ","); eps != "10.2.0.1@host-a:true,10.2.1.1@host-b:false" {
+			t.Errorf("unexpected endpoints: %s", eps)
+		}
+	})
+}
+
+func TestForNodeResolvesNamedPorts(t *testing.T) {
+	store := proxystore.New()
+
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetService(&localnetv1.Service{
+			Namespace: "test",
+			Name:      "test",
+			Type:      "ClusterIP",
+			IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.1.2.3")},
+			Ports: []*localnetv1.PortMapping{
+				{Name: "http", Protocol: localnetv1.Protocol_TCP, Port: 80, TargetPortName: "web"},
+				{Name: "dns", Protocol: localnetv1.Protocol_UDP, Port: 53, TargetPortName: "dns"},
+				{Name: "metrics", Protocol: localnetv1.Protocol_TCP, Port: 9090, TargetPort: 9090},
+			},
+		})
+
+		tx.SetEndpointsOfSource("test", "test-abcde", []*localnetv1.EndpointInfo{{
+			Namespace:   "test",
+			SourceName:  "test-abcde",
+			ServiceName: "test",
+			Endpoint: &localnetv1.Endpoint{
+				IPs: localnetv1.NewIPSet("10.2.0.1"),
+				PortOverrides: []*localnetv1.PortName{
+					{Name: "http", Port: 8080, Protocol: localnetv1.Protocol_TCP},
+					{Name: "dns", Port: 5353, Protocol: localnetv1.Protocol_TCP},
+				},
+			},
+			Topology:   &localnetv1.TopologyInfo{Node: "host-a"},
+			Conditions: &localnetv1.EndpointConditions{Ready: true},
+		}})
+	})
+
+	store.View(0, func(tx *proxystore.Tx) {
+		endpoints := ForNode(tx, tx.GetServiceInfo("test", "test"), "host-b")
+		if len(endpoints) != 1 {
+			t.Fatalf("expected 1 endpoint, got %d", len(endpoints))
+		}
+
+		var resolved []string
+		for _, port := range endpoints[0].Endpoint.TargetPorts {
+			resolved = append(resolved, fmt.Sprintf("%s:%d->%d(%s)", port.Name, port.Port, port.TargetPort, port.TargetPortName))
+		}
+
+		// dns is advertised with another protocol
+		if s := strings.Join(resolved, ","); s != "http:80->8080(web),dns:53->0(dns),metrics:9090->9090()" {
+			t.Errorf("unexpected target ports: %s", s)
+		}
+	})
+}
+
+func TestForNodeEndpointWeights(t *testing.T) {
+	store := proxystore.New()
+
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetService(&localnetv1.Service{
+			Namespace:   "test",
+			Name:        "test",
+			Type:        "ClusterIP",
+			Annotations: map[string]string{localnetv1.EndpointWeightsAnnotation: "web-canary-*=1,web-*=9"},
+			IPs:         &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.1.2.3")},
+			Ports:       []*localnetv1.PortMapping{{Port: 80}},
+		})
+
+		var infos []*localnetv1.EndpointInfo
+		for i, pod := range []string{"web-canary-abcde", "web-7d9f8c-fghij", "other"} {
+			infos = append(infos, &localnetv1.EndpointInfo{
+				Namespace:   "test",
+				SourceName:  "test-abcde",
+				ServiceName: "test",
+				PodName:     pod,
+				Endpoint:    &localnetv1.Endpoint{IPs: localnetv1.NewIPSet(fmt.Sprintf("10.2.0.%d", i+1))},
+				Topology:    &localnetv1.TopologyInfo{Node: "host-a"},
+				Conditions:  &localnetv1.EndpointConditions{Ready: true},
+			})
+		}
+		tx.SetEndpointsOfSource("test", "test-abcde", infos)
+	})
+
+	store.View(0, func(tx *proxystore.Tx) {
+		var list []string
+		for _, epi := range ForNode(tx, tx.GetServiceInfo("test", "test"), "host-a") {
+			list = append(list, fmt.Sprintf("%s:%d/%d", epi.PodName, epi.Endpoint.Weight, epi.Endpoint.BalancingWeight()))
+		}
+		sort.Strings(list)
+
+		if eps := strings.Join(list, ","); eps != "other:0/1,web-7d9f8c-fghij:9/9,web-canary-abcde:1/1" {
+			t.Errorf("unexpected weights: %s", eps)
+		}
+	})
+}
+
+func TestForNodeTerminatingEndpoints(t *testing.T) {
+	store := proxystore.New()
+
+	service := &localnetv1.Service{
+		Namespace:              "test",
+		Name:                   "test",
+		Type:                   "ClusterIP",
+		IPs:                    &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.1.2.3")},
+		Ports:                  []*localnetv1.PortMapping{{Port: 1234}},
+		ExternalTrafficToLocal: true,
+	}
+
+	endpoint := func(ip, node string, ready bool) *localnetv1.EndpointInfo {
+		return &localnetv1.EndpointInfo{
+			Namespace:   "test",
+			SourceName:  "test-abcde",
+			ServiceName: "test",
+			Endpoint:    &localnetv1.Endpoint{IPs: localnetv1.NewIPSet(ip)},
+			Topology:    &localnetv1.TopologyInfo{Node: node},
+			Conditions:  &localnetv1.EndpointConditions{Ready: ready, Serving: true, Terminating: !ready},
+		}
+	}
+
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetService(service)
+		tx.SetEndpointsOfSource("test", "test-abcde", []*localnetv1.EndpointInfo{
+			endpoint("10.2.0.1", "host-a", true),
+			endpoint("10.2.0.2", "host-b", false),
+		})
+	})
+
+	endpointsOf := func(node string) string {
+		var list []string
+		store.View(0, func(tx *proxystore.Tx) {
+			for _, epi := range ForNode(tx, tx.GetServiceInfo("test", "test"), node) {
+				scopes := epi.Endpoint.Scopes
+				list = append(list, fmt.Sprintf("%s(internal=%v,external=%v)", epi.Endpoint.IPs.V4[0], scopes.Internal, scopes.External))
+			}
+		})
+		sort.Strings(list)
+		return strings.Join(list, ",")
+	}
+
+	if eps := endpointsOf("host-b"); eps != "10.2.0.1(internal=true,external=false)" {
+		t.Errorf("expected only the ready endpoint without ProxyTerminatingEndpoints, got %s", eps)
+	}
+
+	if err := featuregate.Default.SetFromMap(map[string]bool{string(featuregate.ProxyTerminatingEndpoints): true}); err != nil {
+		t.Fatal(err)
+	}
+	defer featuregate.Default.SetFromMap(map[string]bool{string(featuregate.ProxyTerminatingEndpoints): false})
+
+	// host-b has no ready local endpoint for its external traffic, but a serving terminating one
+	if eps := endpointsOf("host-b"); eps != "10.2.0.1(internal=true,external=false),10.2.0.2(internal=false,external=true)" {
+		t.Errorf("expected the terminating endpoint for the external traffic only, got %s", eps)
+	}
+	if eps := endpointsOf("host-a"); eps != "10.2.0.1(internal=true,external=true)" {
+		t.Errorf("expected only the ready endpoint, got %s", eps)
+	}
+}
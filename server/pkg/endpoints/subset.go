@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"sort"
+
+	"github.com/cespare/xxhash"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+)
+
+// Subset returns up to maxEndpoints endpoints of a service for the node (all of them if maxEndpoints is 0), selected
+// by rendezvous hashing: each endpoint is ranked by the hash of the node name and the endpoint, so a node keeps the
+// same subset while the endpoints change (only the added and removed ones move in or out) and the endpoints are
+// spread evenly across the nodes. The node's own endpoints are always kept, as the traffic policies may only use
+// them, then the ready ones are preferred. The order of the endpoints is kept.
+func Subset(infos []*localnetv1.EndpointInfo, nodeName string, maxEndpoints int) []*localnetv1.EndpointInfo {
+	if maxEndpoints <= 0 || len(infos) <= maxEndpoints {
+		return infos
+	}
+
+	type ranked struct {
+		idx   int
+		info  *localnetv1.EndpointInfo
+		score uint64
+	}
+
+	candidates := make([]ranked, len(infos))
+	for i, info := range infos {
+		candidates[i] = ranked{idx: i, info: info, score: xxhash.Sum64String(nodeName + "/" + subsetKey(info))}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.info.Endpoint.Local != b.info.Endpoint.Local {
+			return a.info.Endpoint.Local
+		}
+		if a.info.Conditions.Ready != b.info.Conditions.Ready {
+			return a.info.Conditions.Ready
+		}
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		return a.idx < b.idx
+	})
+
+	keep := make([]bool, len(infos))
+	for i, c := range candidates {
+		if i >= maxEndpoints && !c.info.Endpoint.Local {
+			break
+		}
+		keep[c.idx] = true
+	}
+
+	subset := make([]*localnetv1.EndpointInfo, 0, maxEndpoints)
+	for i, info := range infos {
+		if keep[i] {
+			subset = append(subset, info)
+		}
+	}
+	return subset
+}
+
+// subsetKey identifies an endpoint in the rendezvous hashing, by its pod or its IPs.
+func subsetKey(info *localnetv1.EndpointInfo) string {
+	if info.PodName != "" {
+		return info.Namespace + "/" + info.PodName
+	}
+	return endpointKey(info.Endpoint)
+}
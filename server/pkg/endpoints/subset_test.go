@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"strconv"
+	"testing"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+)
+
+func subsetTestEndpoints(n int, node func(i int) string) []*localnetv1.EndpointInfo {
+	infos := make([]*localnetv1.EndpointInfo, 0, n)
+	for i := 0; i < n; i++ {
+		infos = append(infos, &localnetv1.EndpointInfo{
+			Namespace: "test",
+			PodName:   "pod-" + strconv.Itoa(i),
+			Endpoint: &localnetv1.Endpoint{
+				IPs:   localnetv1.NewIPSet("10.2." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256)),
+				Local: node(i) == "host-a",
+			},
+			Conditions: &localnetv1.EndpointConditions{Ready: true},
+		})
+	}
+	return infos
+}
+
+func podNames(infos []*localnetv1.EndpointInfo) map[string]bool {
+	names := map[string]bool{}
+	for _, info := range infos {
+		names[info.PodName] = true
+	}
+	return names
+}
+
+func TestSubset(t *testing.T) {
+	remote := func(int) string { return "host-b" }
+
+	infos := subsetTestEndpoints(100, remote)
+
+	if subset := Subset(infos, "host-a", 0); len(subset) != 100 {
+		t.Errorf("expected all the endpoints without max, got %d", len(subset))
+	}
+
+	subset := Subset(infos, "host-a", 10)
+	if len(subset) != 10 {
+		t.Fatalf("expected 10 endpoints, got %d", len(subset))
+	}
+
+	// deterministic, whatever the order of the endpoints
+	reversed := make([]*localnetv1.EndpointInfo, len(infos))
+	for i, info := range infos {
+		reversed[len(infos)-1-i] = info
+	}
+	same := podNames(Subset(reversed, "host-a", 10))
+	for name := range podNames(subset) {
+		if !same[name] {
+			t.Errorf("subset changed with the order of the endpoints: %s missing", name)
+		}
+	}
+
+	// consistent: removing an endpoint out of the subset doesn't change it, removing one in it replaces only it
+	selected := podNames(subset)
+	for i, info := range infos {
+		others := append(append([]*localnetv1.EndpointInfo{}, infos[:i]...), infos[i+1:]...)
+		changed := 0
+		for name := range podNames(Subset(others, "host-a", 10)) {
+			if !selected[name] {
+				changed++
+			}
+		}
+
+		expected := 0
+		if selected[info.PodName] {
+			expected = 1
+		}
+		if changed != expected {
+			t.Errorf("removing %s: expected %d new endpoints in the subset, got %d", info.PodName, expected, changed)
+		}
+	}
+
+	// the nodes get different subsets
+	if other := podNames(Subset(infos, "host-c", 10)); len(other) == len(selected) {
+		common := 0
+		for name := range other {
+			if selected[name] {
+				common++
+			}
+		}
+		if common == len(selected) {
+			t.Error("expected different subsets on different nodes")
+		}
+	}
+}
+
+func TestSubsetKeepsLocalAndReadyEndpoints(t *testing.T) {
+	infos := subsetTestEndpoints(20, func(i int) string {
+		if i < 3 {
+			return "host-a"
+		}
+		return "host-b"
+	})
+
+	// only 5 ready remote endpoints
+	for _, info := range infos[3:15] {
+		info.Conditions.Ready = false
+	}
+
+	subset := Subset(infos, "host-a", 2)
+	if len(subset) != 3 {
+		t.Fatalf("expected the 3 local endpoints, got %d", len(subset))
+	}
+	for _, info := range subset {
+		if !info.Endpoint.Local {
+			t.Errorf("unexpected remote endpoint %s", info.PodName)
+		}
+	}
+
+	subset = Subset(infos, "host-a", 8)
+	if len(subset) != 8 {
+		t.Fatalf("expected 8 endpoints, got %d", len(subset))
+	}
+	for _, info := range subset {
+		if !info.Conditions.Ready {
+			t.Errorf("unexpected not ready endpoint %s", info.PodName)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const unixPrefix = "unix://"
+
+// socketPath returns the path of the unix socket of the address, if it's one.
+func socketPath(address string) (path string, ok bool) {
+	if !strings.HasPrefix(address, unixPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(address, unixPrefix), true
+}
+
+// listen listens on the address, an IP:PORT or a unix socket created with the given permissions.
+func listen(address string, mode os.FileMode) (net.Listener, error) {
+	path, ok := socketPath(address)
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+
+	// remove the socket left by a previous run
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	return listener, nil
+}
+
+// Query writes the response to a GET of the path (ie: /healthz) on the metrics server at the address, an IP:PORT
+// or a unix socket (unix:///path/to/socket).
+func Query(ctx context.Context, address, path string, out io.Writer) error {
+	return Request(ctx, address, http.MethodGet, path, out)
+}
+
+// Request is Query with another method, ie: to POST to an endpoint triggering an action.
+func Request(ctx context.Context, address, method, path string, out io.Writer) error {
+	client := http.DefaultClient
+	host := address
+
+	if socket, ok := socketPath(address); ok {
+		host = "localhost"
+		client = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		}}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, "http://"+host+path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.sock")
+	address := "unix://" + path
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	StartMetricsServer(address, ServerOptions{SocketMode: 0600}, stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out := &bytes.Buffer{}
+	for {
+		out.Reset()
+		err := Query(ctx, address, "/healthz", out)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatal("metrics server not ready: ", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if out.String() != "ok" {
+		t.Errorf("expected ok from /healthz, got %q", out.String())
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("expected the socket mode to be 0600, got %o", mode)
+	}
+
+	if err := Query(ctx, address, "/debug/pprof/", &bytes.Buffer{}); err == nil {
+		t.Error("expected the debug endpoints to be disabled")
+	}
+}
@@ -3,16 +3,22 @@ package metrics
 import (
 	"context"
 	"fmt"
+	"os"
+	"sync"
 	"time"
 
 	"net/http"
+	"net/http/pprof"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc/connectivity"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	utilwait "k8s.io/apimachinery/pkg/util/wait"
 
 	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/client/capacity"
 )
 
 var Kpng_k8s_api_events = prometheus.NewCounter(prometheus.CounterOpts{
@@ -25,26 +31,195 @@ var Kpng_node_local_events = prometheus.NewCounter(prometheus.CounterOpts{
 	Help: "The total number of received events from the Kubernetes API for a given node",
 })
 
-// StartMetricsServer runs the prometheus listener so that KPNG metrics can be collected
+var Kpng_filtered_services = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kpng_filtered_services",
+	Help: "The number of services filtered out of the node's state because of their type",
+}, []string{"node"})
+
+var Kpng_hidden_services = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kpng_hidden_services",
+	Help: "The number of services hidden from the node's state by the visibility policy",
+}, []string{"node"})
+
+var Kpng_endpoint_port_mismatches = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kpng_endpoint_port_mismatches",
+	Help: "The number of (service port, endpoint) pairs not programmed because the endpoint doesn't advertise the port, or with another protocol",
+}, []string{"namespace", "service"})
+
+var Kpng_service_external_exposure_active = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kpng_service_external_exposure_active",
+	Help: "1 if the service with exposure windows is exposed outside of the cluster, 0 if its external exposure is suspended",
+}, []string{"namespace", "service"})
+
+var Kpng_namespace_quota_rejected_services = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kpng_namespace_quota_rejected_services",
+	Help: "The number of services not programmed because their namespace exceeds its quota",
+}, []string{"namespace"})
+
+var Kpng_store_divergences = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "kpng_store_divergences_total",
+	Help: "The total number of objects found diverging from the API server by the consistency checks (missed watch events), and repaired",
+}, []string{"resource", "kind"})
+
+var Kpng_api_connection_state = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kpng_api_connection_state",
+	Help: "The state of the connection to the API (1 for the current state, 0 for the others)",
+}, []string{"state"})
+
+var Kpng_api_reconnects = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "kpng_api_reconnects_total",
+	Help: "The total number of watches of the API restarted after an error",
+})
+
+var Kpng_watch_queued_ops = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "kpng_watch_queued_ops",
+	Help: "The number of operations computed for the watches and not yet accepted by their streams (high when clients are slow to read)",
+})
+
+var Kpng_watch_coalesced_revisions = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "kpng_watch_coalesced_revisions",
+	Help:    "The number of store revisions merged in each change set sent to a watch (slow clients get the latest value of the objects changed by many revisions at once)",
+	Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+})
+
+var apiConnectionStates = []connectivity.State{
+	connectivity.Idle,
+	connectivity.Connecting,
+	connectivity.Ready,
+	connectivity.TransientFailure,
+	connectivity.Shutdown,
+}
+
+// SetAPIConnectionState sets the current state of the connection to the API.
+func SetAPIConnectionState(state connectivity.State) {
+	for _, s := range apiConnectionStates {
+		value := 0.
+		if s == state {
+			value = 1
+		}
+		Kpng_api_connection_state.WithLabelValues(s.String()).Set(value)
+	}
+}
+
+var Kpng_dataplane_estimated_size = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kpng_dataplane_estimated_size",
+	Help: "The estimated size of the backend's dataplane resources (rules, ipset entries, IPVS destinations, BPF map entries...) for the local state",
+}, []string{"resource"})
+
+var Kpng_dataplane_limit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kpng_dataplane_limit",
+	Help: "The limit of the backend's dataplane resources (only for the limited resources)",
+}, []string{"resource"})
+
+var Kpng_dataplane_headroom = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kpng_dataplane_headroom",
+	Help: "The estimated size left before reaching the limit of the backend's dataplane resources (negative if exceeded)",
+}, []string{"resource"})
+
+// SetDataplaneEstimates sets the estimated sizes of the dataplane resources, and their headroom.
+func SetDataplaneEstimates(estimates []capacity.Estimate) {
+	for _, e := range estimates {
+		Kpng_dataplane_estimated_size.WithLabelValues(e.Resource).Set(float64(e.Size))
+
+		if e.Limit <= 0 {
+			Kpng_dataplane_limit.DeleteLabelValues(e.Resource)
+			Kpng_dataplane_headroom.DeleteLabelValues(e.Resource)
+			continue
+		}
+
+		Kpng_dataplane_limit.WithLabelValues(e.Resource).Set(float64(e.Limit))
+		Kpng_dataplane_headroom.WithLabelValues(e.Resource).Set(float64(e.Limit - e.Size))
+	}
+}
+
+// handlers are the endpoints registered by the jobs, served along the metrics (see Handle).
+var handlers = http.NewServeMux()
+
+// Handle registers an endpoint of a job on the metrics server, ie: the aggregated views of the brain. It can be
+// called before or after the server is started.
+func Handle(pattern string, handler http.Handler) {
+	handlers.Handle(pattern, handler)
+}
+
+// healthCheck serves a health check endpoint, "ok" until replaced (see SetHealthChecks).
+type healthCheck struct {
+	mu      sync.RWMutex
+	handler http.Handler
+}
+
+func (c *healthCheck) set(handler http.Handler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.handler = handler
+}
+
+func (c *healthCheck) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.RLock()
+	handler := c.handler
+	c.mu.RUnlock()
+
+	if handler == nil {
+		w.Write([]byte("ok"))
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+var healthz, readyz = &healthCheck{}, &healthCheck{}
+
+// SetHealthChecks replaces the handlers of /healthz and /readyz, ie: with the node agent's checks (see the health
+// package). It can be called before or after the server is started.
+func SetHealthChecks(healthzHandler, readyzHandler http.Handler) {
+	healthz.set(healthzHandler)
+	readyz.set(readyzHandler)
+}
+
+// ServerOptions are the options of the metrics server.
+type ServerOptions struct {
+	// SocketMode is the permissions of the unix socket, when listening on one.
+	SocketMode os.FileMode
+	// Debug enables the /debug/pprof/ endpoints.
+	Debug bool
+}
+
+// StartMetricsServer runs the prometheus listener so that KPNG metrics can be collected, along with the /healthz and
+// /readyz endpoints, the endpoints registered with Handle (and /debug/pprof/ if enabled). The bind address is an IP:PORT or
+// a unix socket (unix:///path/to/socket), for nodes where opening TCP ports is restricted.
 // TODO add TLS Auth if configured
-func StartMetricsServer(bindAddress string,
+func StartMetricsServer(bindAddress string, opts ServerOptions,
 	stopChan <-chan struct{}) {
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/healthz", healthz)
+	mux.Handle("/readyz", readyz)
+	if opts.Debug {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	mux.Handle("/", handlers)
 	klog.Infof("Starting metrics server at %s", bindAddress)
 
+	server := &http.Server{
+		Addr:    bindAddress,
+		Handler: mux,
+	}
+
 	go func() {
-		var server *http.Server
 		go utilwait.Until(func() {
-			var err error
-			server = &http.Server{
-				Addr:    bindAddress,
-				Handler: mux,
+			listener, err := listen(bindAddress, opts.SocketMode)
+			if err != nil {
+				utilruntime.HandleError(fmt.Errorf("starting metrics server failed: %v", err))
+				return
 			}
-			err = server.ListenAndServe()
+
+			err = server.Serve(listener)
 
 			if err != nil && err != http.ErrServerClosed {
-				utilruntime.HandleError(fmt.Errorf("starting metrics server failed: %v", err))
+				utilruntime.HandleError(fmt.Errorf("metrics server failed: %v", err))
 			}
 		}, 5*time.Second, stopChan)
 
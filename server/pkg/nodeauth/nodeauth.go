@@ -0,0 +1,313 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package nodeauth authorizes the clients of the API server with their Kubernetes service account tokens, validated
+// by TokenReview: the node agents can only watch the local state of their own node (the node of the pod the token is
+// bound to), and only the allowed service accounts can watch the global state.
+package nodeauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// the extra fields of the TokenReviews of the tokens bound to a pod
+	podNameExtra  = "authentication.kubernetes.io/pod-name"
+	podUIDExtra   = "authentication.kubernetes.io/pod-uid"
+	nodeNameExtra = "authentication.kubernetes.io/node-name"
+
+	serviceAccountPrefix = "system:serviceaccount:"
+
+	// localMethods is the prefix of the local API's methods, the other ones serve the global state
+	localMethods = "/localnetv1.Endpoints/"
+)
+
+type Config struct {
+	Enabled    bool
+	Kubeconfig string
+	// Audiences are the audiences the tokens must be issued for, comma separated (the API server's if empty).
+	Audiences string
+	// GlobalServiceAccounts are the namespace/name of the service accounts allowed to watch the global state, comma
+	// separated.
+	GlobalServiceAccounts string
+	// CacheTTL is how long the reviewed tokens are cached.
+	CacheTTL time.Duration
+}
+
+func (c *Config) BindFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&c.Enabled, "node-auth", false, "authorize the clients with their service account tokens, the node agents only watching their own node")
+	flags.StringVar(&c.Kubeconfig, "node-auth-kubeconfig", "", "kubeconfig used to review the tokens (in-cluster configuration if empty)")
+	flags.StringVar(&c.Audiences, "node-auth-audiences", "", "audiences the tokens must be issued for, comma separated (the API server's if empty)")
+	flags.StringVar(&c.GlobalServiceAccounts, "node-auth-global-service-accounts", "", "namespace/name of the service accounts allowed to watch the global state, comma separated")
+	flags.DurationVar(&c.CacheTTL, "node-auth-cache-ttl", time.Minute, "how long the reviewed tokens are cached")
+}
+
+// Authorizer returns the authorizer of the clients, or nil if not enabled.
+func (c *Config) Authorizer() (*Authorizer, error) {
+	if c == nil || !c.Enabled {
+		return nil, nil
+	}
+
+	cfg, err := clientcmd.BuildConfigFromFlags("", c.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAuthorizer(client, splitList(c.Audiences), splitList(c.GlobalServiceAccounts), c.CacheTTL), nil
+}
+
+func splitList(s string) (values []string) {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return
+}
+
+// Identity is the identity of a client.
+type Identity struct {
+	// ServiceAccount is the namespace/name of the client's service account.
+	ServiceAccount string
+	// NodeName is the node of the pod the client's token is bound to, empty if it's not bound to a pod.
+	NodeName string
+}
+
+type Authorizer struct {
+	client         kubernetes.Interface
+	audiences      []string
+	globalAccounts map[string]bool
+	ttl            time.Duration
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cachedIdentity
+	now   func() time.Time
+}
+
+type cachedIdentity struct {
+	identity *Identity
+	expires  time.Time
+}
+
+func NewAuthorizer(client kubernetes.Interface, audiences, globalServiceAccounts []string, cacheTTL time.Duration) *Authorizer {
+	globalAccounts := make(map[string]bool, len(globalServiceAccounts))
+	for _, sa := range globalServiceAccounts {
+		globalAccounts[sa] = true
+	}
+
+	return &Authorizer{
+		client:         client,
+		audiences:      audiences,
+		globalAccounts: globalAccounts,
+		ttl:            cacheTTL,
+		cache:          map[[sha256.Size]byte]cachedIdentity{},
+		now:            time.Now,
+	}
+}
+
+// Authenticate returns the identity of the token's bearer.
+func (a *Authorizer) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	key := sha256.Sum256([]byte(token))
+	now := a.now()
+
+	a.mu.Lock()
+	cached, ok := a.cache[key]
+	if ok && now.After(cached.expires) {
+		delete(a.cache, key)
+		ok = false
+	}
+	a.mu.Unlock()
+
+	if ok {
+		return cached.identity, nil
+	}
+
+	identity, err := a.review(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	a.expireCache(now)
+	a.cache[key] = cachedIdentity{identity, now.Add(a.ttl)}
+	a.mu.Unlock()
+
+	return identity, nil
+}
+
+// expireCache removes the expired entries, so the cache doesn't grow with the rotated tokens. a.mu must be held.
+func (a *Authorizer) expireCache(now time.Time) {
+	for key, cached := range a.cache {
+		if now.After(cached.expires) {
+			delete(a.cache, key)
+		}
+	}
+}
+
+func (a *Authorizer) review(ctx context.Context, token string) (*Identity, error) {
+	review, err := a.client.AuthenticationV1().TokenReviews().Create(ctx, &authnv1.TokenReview{
+		Spec: authnv1.TokenReviewSpec{Token: token, Audiences: a.audiences},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to review the token: %v", err)
+	}
+
+	if !review.Status.Authenticated {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid token: %s", review.Status.Error)
+	}
+
+	user := review.Status.User
+
+	if !strings.HasPrefix(user.Username, serviceAccountPrefix) {
+		return nil, status.Errorf(codes.PermissionDenied, "%s is not a service account", user.Username)
+	}
+	namespace, name, _ := strings.Cut(strings.TrimPrefix(user.Username, serviceAccountPrefix), ":")
+
+	identity := &Identity{ServiceAccount: namespace + "/" + name}
+
+	if nodeName := extra(user, nodeNameExtra); nodeName != "" {
+		identity.NodeName = nodeName
+		return identity, nil
+	}
+
+	podName := extra(user, podNameExtra)
+	if podName == "" {
+		return identity, nil // not bound to a pod
+	}
+
+	pod, err := a.client.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to get the pod %s/%s of the token: %v", namespace, podName, err)
+	}
+
+	if string(pod.UID) != extra(user, podUIDExtra) {
+		return nil, status.Errorf(codes.Unauthenticated, "the pod %s/%s of the token was replaced", namespace, podName)
+	}
+
+	identity.NodeName = pod.Spec.NodeName
+	return identity, nil
+}
+
+func extra(user authnv1.UserInfo, key string) string {
+	if values := user.Extra[key]; len(values) == 1 {
+		return values[0]
+	}
+	return ""
+}
+
+// authorize authenticates the bearer of the context's token, and checks it can call the method.
+func (a *Authorizer) authorize(ctx context.Context, method string) (*Identity, error) {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) == 1 {
+			token = strings.TrimPrefix(values[0], "Bearer ")
+		}
+	}
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "no bearer token")
+	}
+
+	identity, err := a.Authenticate(ctx, token)
+	if err != nil {
+		klog.V(1).Info("denied ", method, ": ", err)
+		return nil, err
+	}
+
+	if strings.HasPrefix(method, localMethods) {
+		if identity.NodeName == "" {
+			return nil, status.Errorf(codes.PermissionDenied, "the token of %s is not bound to a pod on a node", identity.ServiceAccount)
+		}
+	} else if !a.globalAccounts[identity.ServiceAccount] {
+		return nil, status.Errorf(codes.PermissionDenied, "%s is not allowed to watch the global state", identity.ServiceAccount)
+	}
+
+	return identity, nil
+}
+
+// ServerOptions returns the options of the gRPC server authorizing the calls.
+func (a *Authorizer) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainStreamInterceptor(a.streamInterceptor),
+		grpc.ChainUnaryInterceptor(a.unaryInterceptor),
+	}
+}
+
+func (a *Authorizer) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	identity, err := a.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &identityStream{ss, context.WithValue(ss.Context(), identityKey{}, identity)})
+}
+
+func (a *Authorizer) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	identity, err := a.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(context.WithValue(ctx, identityKey{}, identity), req)
+}
+
+type identityKey struct{}
+
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
+
+// IdentityFromContext returns the identity of the client, nil if the calls aren't authorized.
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey{}).(*Identity)
+	return identity
+}
+
+// AuthorizeNode checks the client can watch the local state of the node. All the nodes are allowed if the calls
+// aren't authorized.
+func AuthorizeNode(ctx context.Context, nodeName string) error {
+	identity := IdentityFromContext(ctx)
+	if identity == nil || identity.NodeName == nodeName {
+		return nil
+	}
+
+	return status.Errorf(codes.PermissionDenied, "%s can't watch node %q, only %q", identity.ServiceAccount, nodeName, identity.NodeName)
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodeauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newTestAuthorizer returns an authorizer reviewing the tokens with the given users, counting the reviews.
+func newTestAuthorizer(users map[string]authnv1.UserInfo, reviews *int) *Authorizer {
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "kpng-abcde", UID: "uid-1"},
+		Spec:       v1.PodSpec{NodeName: "node-1"},
+	})
+
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		*reviews++
+
+		review := action.(k8stesting.CreateAction).GetObject().(*authnv1.TokenReview)
+		if user, ok := users[review.Spec.Token]; ok {
+			review.Status = authnv1.TokenReviewStatus{Authenticated: true, User: user}
+		} else {
+			review.Status = authnv1.TokenReviewStatus{Error: "unknown token"}
+		}
+		return true, review, nil
+	})
+
+	return NewAuthorizer(client, nil, []string{"kube-system/kpng-brain"}, time.Minute)
+}
+
+func podUser(name, podName, podUID string) authnv1.UserInfo {
+	return authnv1.UserInfo{
+		Username: "system:serviceaccount:kube-system:" + name,
+		Extra: map[string]authnv1.ExtraValue{
+			podNameExtra: {podName},
+			podUIDExtra:  {podUID},
+		},
+	}
+}
+
+func withToken(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestAuthorize(t *testing.T) {
+	reviews := 0
+	a := newTestAuthorizer(map[string]authnv1.UserInfo{
+		"node-1":   podUser("kpng", "kpng-abcde", "uid-1"),
+		"replaced": podUser("kpng", "kpng-abcde", "uid-0"),
+		"node-2": {
+			Username: "system:serviceaccount:kube-system:kpng",
+			Extra:    map[string]authnv1.ExtraValue{nodeNameExtra: {"node-2"}},
+		},
+		"brain": {Username: "system:serviceaccount:kube-system:kpng-brain"},
+		"user":  {Username: "admin"},
+	}, &reviews)
+
+	const (
+		local  = "/localnetv1.Endpoints/Watch"
+		global = "/localnetv1.Global/Watch"
+	)
+
+	for _, test := range []struct {
+		token, method string
+		code          codes.Code
+		nodeName      string
+	}{
+		{"node-1", local, codes.OK, "node-1"},
+		{"node-2", local, codes.OK, "node-2"},
+		{"node-1", global, codes.PermissionDenied, ""},
+		{"brain", global, codes.OK, ""},
+		{"brain", "/localnetv1.Journal/Diff", codes.OK, ""},
+		{"brain", local, codes.PermissionDenied, ""}, // not bound to a node
+		{"replaced", local, codes.Unauthenticated, ""},
+		{"user", local, codes.PermissionDenied, ""},
+		{"unknown", local, codes.Unauthenticated, ""},
+		{"", local, codes.Unauthenticated, ""},
+	} {
+		identity, err := a.authorize(withToken(test.token), test.method)
+
+		if code := status.Code(err); code != test.code {
+			t.Errorf("%q %s: expected %v, got %v", test.token, test.method, test.code, err)
+			continue
+		}
+		if err == nil && identity.NodeName != test.nodeName {
+			t.Errorf("%q %s: expected node %q, got %q", test.token, test.method, test.nodeName, identity.NodeName)
+		}
+	}
+}
+
+func TestAuthenticateCache(t *testing.T) {
+	reviews := 0
+	a := newTestAuthorizer(map[string]authnv1.UserInfo{"node-1": podUser("kpng", "kpng-abcde", "uid-1")}, &reviews)
+
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := a.Authenticate(context.Background(), "node-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reviews != 1 {
+		t.Errorf("expected 1 review, got %d", reviews)
+	}
+
+	// failures are not cached
+	for i := 0; i < 2; i++ {
+		if _, err := a.Authenticate(context.Background(), "unknown"); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+	if reviews != 3 {
+		t.Errorf("expected 3 reviews, got %d", reviews)
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	if _, err := a.Authenticate(context.Background(), "node-1"); err != nil {
+		t.Fatal(err)
+	}
+	if reviews != 4 {
+		t.Errorf("expected the token to be reviewed again after the cache TTL, got %d reviews", reviews)
+	}
+}
+
+func TestAuthorizeNode(t *testing.T) {
+	if err := AuthorizeNode(context.Background(), "node-1"); err != nil {
+		t.Errorf("expected all the nodes to be allowed without authorization, got %v", err)
+	}
+
+	ctx := context.WithValue(context.Background(), identityKey{}, &Identity{ServiceAccount: "kube-system/kpng", NodeName: "node-1"})
+
+	if err := AuthorizeNode(ctx, "node-1"); err != nil {
+		t.Errorf("expected node-1 to be allowed, got %v", err)
+	}
+	if err := AuthorizeNode(ctx, "node-2"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected node-2 to be denied, got %v", err)
+	}
+}
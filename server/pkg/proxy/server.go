@@ -17,7 +17,6 @@ limitations under the License.
 package proxy
 
 import (
-	"crypto/tls"
 	"flag"
 	"fmt"
 	"os"
@@ -110,14 +109,15 @@ func NewServer() (srv *Server, err error) {
 	}
 
 	// setup gRPC server
-	if tlsCfg := tlsFlags.Config(); tlsCfg == nil {
+	tlsCfg, err := tlsFlags.ServerConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Error building TLS configuration: %s", err.Error())
+	}
+
+	if tlsCfg == nil {
 		srv.GRPC = grpc.NewServer()
 	} else {
-		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
-		tlsCfg.ClientCAs = tlsCfg.RootCAs
-
-		creds := credentials.NewTLS(tlsCfg)
-		srv.GRPC = grpc.NewServer(grpc.Creds(creds))
+		srv.GRPC = grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsCfg)))
 	}
 
 	return
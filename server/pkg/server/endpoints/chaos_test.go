@@ -0,0 +1,347 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client"
+	"sigs.k8s.io/kpng/client/localsink"
+	"sigs.k8s.io/kpng/client/localsink/fullstate"
+	proxystore "sigs.k8s.io/kpng/server/proxystore"
+)
+
+const chaosNamespace = "chaos"
+
+// chaosModel is the reference state of the brain's store. It records every state the store had so
+// agents can be checked to only ever apply complete states.
+type chaosModel struct {
+	mu        sync.Mutex
+	rng       *rand.Rand
+	services  map[string]bool
+	endpoints map[string][]string // endpoints by source (=service) name, may exist without their service
+	states    map[string]bool
+}
+
+func newChaosModel(seed int64) *chaosModel {
+	// the base service is never changed; the brain sends nothing for an empty state so
+	// the agent always has something to sync.
+	return &chaosModel{
+		rng:       rand.New(rand.NewSource(seed)),
+		services:  map[string]bool{"base": true},
+		endpoints: map[string][]string{"base": {"10.2.0.1"}},
+		states:    map[string]bool{},
+	}
+}
+
+// fingerprint returns the state as seen by an agent (services and their endpoints IPs). m.mu must be held.
+func (m *chaosModel) fingerprint() string {
+	names := make([]string, 0, len(m.services))
+	for name := range m.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fp := make([]string, 0, len(names))
+	for _, name := range names {
+		ips := append([]string{}, m.endpoints[name]...)
+		sort.Strings(ips)
+		fp = append(fp, name+"="+strings.Join(ips, ","))
+	}
+	return strings.Join(fp, ";")
+}
+
+func (m *chaosModel) current() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fingerprint()
+}
+
+func (m *chaosModel) hadState(fp string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.states[fp]
+}
+
+func endpointsOfSource(name string, ips []string) []*localnetv1.EndpointInfo {
+	infos := make([]*localnetv1.EndpointInfo, 0, len(ips))
+	for _, ip := range ips {
+		infos = append(infos, &localnetv1.EndpointInfo{
+			Namespace:   chaosNamespace,
+			SourceName:  name,
+			ServiceName: name,
+			Endpoint:    &localnetv1.Endpoint{IPs: localnetv1.NewIPSet(ip)},
+			Conditions:  &localnetv1.EndpointConditions{Ready: true},
+			Topology:    &localnetv1.TopologyInfo{},
+		})
+	}
+	return infos
+}
+
+func chaosService(name string) *localnetv1.Service {
+	return &localnetv1.Service{
+		Namespace: chaosNamespace,
+		Name:      name,
+		Type:      "ClusterIP",
+		IPs:       &localnetv1.ServiceIPs{ClusterIPs: localnetv1.NewIPSet("10.0.0.1")},
+	}
+}
+
+// mutate applies a random change to the store and the model. Services and endpoints are changed
+// independently, so endpoints may come before their service (reordered updates).
+func (m *chaosModel) mutate(store *proxystore.Store) {
+	store.Update(func(tx *proxystore.Tx) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		name := "svc" + strconv.Itoa(m.rng.Intn(5))
+
+		switch m.rng.Intn(4) {
+		case 0:
+			m.services[name] = true
+			tx.SetService(chaosService(name))
+
+		case 1:
+			delete(m.services, name)
+			tx.DelService(chaosNamespace, name)
+
+		case 2:
+			ips := make([]string, 0, 3)
+			for i, n := 0, 1+m.rng.Intn(3); i < n; i++ {
+				ips = append(ips, "10.1."+strconv.Itoa(m.rng.Intn(4))+"."+strconv.Itoa(i+1))
+			}
+			m.endpoints[name] = ips
+			tx.SetEndpointsOfSource(chaosNamespace, name, endpointsOfSource(name, ips))
+
+		case 3:
+			delete(m.endpoints, name)
+			tx.DelEndpointsOfSource(chaosNamespace, name)
+		}
+
+		m.states[m.fingerprint()] = true
+	})
+}
+
+// newStore returns a new store with the model's state, as a restarted brain would rebuild it.
+func (m *chaosModel) newStore() *proxystore.Store {
+	store := proxystore.New()
+
+	store.Update(func(tx *proxystore.Tx) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		for name := range m.services {
+			tx.SetService(chaosService(name))
+		}
+		for name, ips := range m.endpoints {
+			tx.SetEndpointsOfSource(chaosNamespace, name, endpointsOfSource(name, ips))
+		}
+
+		for _, set := range []proxystore.Set{proxystore.Services, proxystore.Endpoints, proxystore.Nodes} {
+			tx.SetSync(set)
+		}
+
+		m.states[m.fingerprint()] = true
+	})
+
+	return store
+}
+
+// flakyStream fails sends when drop returns true, breaking the stream mid-snapshot.
+type flakyStream struct {
+	grpc.ServerStream
+	drop func() bool
+}
+
+func (s *flakyStream) SendMsg(m interface{}) error {
+	if s.drop() {
+		return errors.New("chaos: stream dropped")
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+type chaosBrain struct {
+	t        *testing.T
+	addr     string
+	dropRate atomic.Value // float64
+	rngMu    sync.Mutex
+	rng      *rand.Rand
+
+	store  *proxystore.Store
+	server *grpc.Server
+}
+
+func (b *chaosBrain) drop() bool {
+	rate := b.dropRate.Load().(float64)
+	if rate == 0 {
+		return false
+	}
+
+	b.rngMu.Lock()
+	defer b.rngMu.Unlock()
+	return b.rng.Float64() < rate
+}
+
+func (b *chaosBrain) start(store *proxystore.Store) {
+	var (
+		lis net.Listener
+		err error
+	)
+
+	// the previous listener's port may take a moment to be released
+	for i := 0; i < 100; i++ {
+		if lis, err = net.Listen("tcp", b.addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		b.t.Fatal("failed to listen: ", err)
+	}
+	b.addr = lis.Addr().String()
+
+	b.store = store
+	b.server = grpc.NewServer(grpc.StreamInterceptor(
+		func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			return handler(srv, &flakyStream{ServerStream: ss, drop: b.drop})
+		}))
+
+	Setup(b.server, store, nil, 0)
+
+	go b.server.Serve(lis)
+}
+
+func (b *chaosBrain) stop() {
+	b.server.Stop()
+	b.store.Close()
+}
+
+func TestAgentConvergesThroughChaos(t *testing.T) {
+	seed := time.Now().UnixNano()
+	t.Log("seed: ", seed)
+
+	rounds := 500
+	if testing.Short() {
+		rounds = 100
+	}
+
+	model := newChaosModel(seed)
+
+	brain := &chaosBrain{t: t, addr: "127.0.0.1:0", rng: rand.New(rand.NewSource(seed))}
+	brain.dropRate.Store(float64(0))
+	brain.start(model.newStore())
+	defer func() { brain.stop() }()
+
+	// agent
+	var (
+		applied     atomic.Value // string
+		appliedOnce = make(chan struct{})
+		once        sync.Once
+	)
+
+	sink := fullstate.New(&localsink.Config{NodeName: "node-a"})
+	sink.Callback = fullstate.ArrayCallback(func(items []*fullstate.ServiceEndpoints) {
+		fp := make([]string, 0, len(items))
+		for _, seps := range items {
+			ips := make([]string, 0, len(seps.Endpoints))
+			for _, ep := range seps.Endpoints {
+				ips = append(ips, ep.IPs.V4...)
+			}
+			sort.Strings(ips)
+			fp = append(fp, seps.Service.Name+"="+strings.Join(ips, ","))
+		}
+		state := strings.Join(fp, ";")
+
+		if !model.hadState(state) {
+			t.Errorf("agent applied a state the brain never had: %q", state)
+		}
+
+		applied.Store(state)
+		once.Do(func() { close(appliedOnce) })
+	})
+
+	epc := client.New(pflag.NewFlagSet("agent", pflag.ContinueOnError))
+	epc.Target = brain.addr
+	epc.ErrorDelay = 5 * time.Millisecond
+	epc.Sink = sink
+
+	agentDone := make(chan struct{})
+	go func() {
+		defer close(agentDone)
+		for !epc.Next() {
+		}
+	}()
+	defer func() {
+		epc.Cancel()
+		<-agentDone
+	}()
+
+	select {
+	case <-appliedOnce:
+	case <-time.After(10 * time.Second):
+		t.Fatal("agent never received a state")
+	}
+
+	// chaos
+	for i := 0; i < rounds; i++ {
+		model.mutate(brain.store)
+
+		switch r := model.rng.Intn(100); {
+		case r < 3:
+			// brain restart: the store is rebuilt, all streams are lost
+			brain.stop()
+			brain.start(model.newStore())
+
+		case r < 10:
+			// toggle stream drops (ie: mid-snapshot)
+			if brain.dropRate.Load().(float64) == 0 {
+				brain.dropRate.Store(0.05)
+			} else {
+				brain.dropRate.Store(float64(0))
+			}
+		}
+
+		time.Sleep(time.Duration(model.rng.Intn(1000)) * time.Microsecond)
+	}
+
+	// calm: the agent must converge to the brain's state
+	brain.dropRate.Store(float64(0))
+	model.mutate(brain.store)
+
+	expected := model.current()
+	deadline := time.Now().Add(10 * time.Second)
+
+	for applied.Load().(string) != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("agent did not converge:\n expected: %q\n got:      %q", expected, applied.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
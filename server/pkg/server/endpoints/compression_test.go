@@ -0,0 +1,115 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package endpoints
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client"
+	"sigs.k8s.io/kpng/client/localsink"
+	"sigs.k8s.io/kpng/client/localsink/fullstate"
+	"sigs.k8s.io/kpng/server/proxystore"
+)
+
+func TestCompressedWatch(t *testing.T) {
+	store := proxystore.New()
+	defer store.Close()
+
+	store.Update(func(tx *proxystore.Tx) {
+		tx.SetService(&localnetv1.Service{Namespace: "default", Name: "web", Type: "ClusterIP"})
+		for _, set := range []proxystore.Set{proxystore.Services, proxystore.Endpoints, proxystore.Nodes} {
+			tx.SetSync(set)
+		}
+	})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoding := &encodingRecorder{}
+
+	srv := grpc.NewServer(grpc.StatsHandler(encoding))
+	Setup(srv, store, nil, 0)
+
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	received := 0
+
+	sink := fullstate.New(&localsink.Config{NodeName: "node-a"})
+	sink.Callback = fullstate.ArrayCallback(func(items []*fullstate.ServiceEndpoints) {
+		received = len(items)
+	})
+
+	epc := client.New(pflag.NewFlagSet("agent", pflag.ContinueOnError))
+	epc.Target = lis.Addr().String()
+	epc.Compression = "gzip"
+	epc.ErrorDelay = 5 * time.Millisecond
+	epc.Sink = sink
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		epc.Next()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no state received")
+	}
+	epc.Cancel()
+
+	if received != 1 {
+		t.Errorf("expected 1 service, got %d", received)
+	}
+
+	if enc, _ := encoding.Load().(string); enc != "gzip" {
+		t.Errorf("expected a gzip stream, got encoding %q", enc)
+	}
+}
+
+// encodingRecorder records the compression negotiated by the client.
+type encodingRecorder struct {
+	atomic.Value // string
+}
+
+func (r *encodingRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (r *encodingRecorder) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if h, ok := s.(*stats.InHeader); ok {
+		r.Store(h.Compression)
+	}
+}
+
+func (r *encodingRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (r *encodingRecorder) HandleConn(context.Context, stats.ConnStats) {}
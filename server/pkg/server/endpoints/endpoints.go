@@ -20,9 +20,19 @@ import (
 	"google.golang.org/grpc"
 
 	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/pkg/server/watchstate"
+	"sigs.k8s.io/kpng/server/pkg/visibility"
 	proxystore "sigs.k8s.io/kpng/server/proxystore"
 )
 
-func Setup(s grpc.ServiceRegistrar, store *proxystore.Store) {
-	localnetv1.RegisterEndpointsServer(s, &Server{Store: store})
+// Setup registers the local API, restricting the services visible to the nodes with the policy (if not nil), and
+// their endpoints sent to each node to maxEndpointsPerService (if not 0).
+func Setup(s grpc.ServiceRegistrar, store *proxystore.Store, policy *visibility.Policy, maxEndpointsPerService int) {
+	localnetv1.RegisterEndpointsServer(s, &Server{
+		Store:    store,
+		Sessions: watchstate.NewSessions(watchstate.DefaultSessionTTL),
+		Policy:   policy,
+
+		MaxEndpointsPerService: maxEndpointsPerService,
+	})
 }
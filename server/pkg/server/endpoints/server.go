@@ -25,6 +25,9 @@ import (
 
 	"sigs.k8s.io/kpng/api/localnetv1"
 	"sigs.k8s.io/kpng/server/jobs/store2localdiff"
+	"sigs.k8s.io/kpng/server/pkg/nodeauth"
+	"sigs.k8s.io/kpng/server/pkg/server/watchstate"
+	"sigs.k8s.io/kpng/server/pkg/visibility"
 	"sigs.k8s.io/kpng/server/proxystore"
 )
 
@@ -32,6 +35,15 @@ type Server struct {
 	localnetv1.UnimplementedEndpointsServer
 
 	Store *proxystore.Store
+
+	// Sessions keeps the state of closed watches so they can be resumed (optional).
+	Sessions *watchstate.Sessions
+
+	// Policy restricts the services visible to the nodes (optional).
+	Policy *visibility.Policy
+
+	// MaxEndpointsPerService caps the endpoints sent to a node for each service (unlimited if 0).
+	MaxEndpointsPerService int
 }
 
 var syncItem = &localnetv1.OpItem{Op: &localnetv1.OpItem_Sync{}}
@@ -47,8 +59,12 @@ func (s *Server) Watch(res localnetv1.Endpoints_WatchServer) error {
 	defer klog.Info("connection from ", remote, " closed")
 
 	job := &store2localdiff.Job{
-		Store: s.Store,
-		Sink:  serverSink{res, remote},
+		Store:    s.Store,
+		Sink:     &serverSink{Endpoints_WatchServer: res, remote: remote},
+		Sessions: s.Sessions,
+		Policy:   s.Policy,
+
+		MaxEndpointsPerService: s.MaxEndpointsPerService,
 	}
 
 	return job.Run(res.Context())
@@ -56,12 +72,16 @@ func (s *Server) Watch(res localnetv1.Endpoints_WatchServer) error {
 
 type serverSink struct {
 	localnetv1.Endpoints_WatchServer
-	remote string
+	remote       string
+	serviceTypes []string
+	revision     uint64
 }
 
-func (s serverSink) Setup() { /* noop */ }
+var _ store2localdiff.ServiceTypesRequester = &serverSink{}
+
+func (s *serverSink) Setup() { /* noop */ }
 
-func (s serverSink) WaitRequest() (nodeName string, err error) {
+func (s *serverSink) WaitRequest() (nodeName string, err error) {
 	req, err := s.Recv()
 
 	if err != nil {
@@ -71,8 +91,23 @@ func (s serverSink) WaitRequest() (nodeName string, err error) {
 
 	klog.V(1).Info("remote ", s.remote, " requested node ", req.NodeName)
 
+	if err = nodeauth.AuthorizeNode(s.Context(), req.NodeName); err != nil {
+		klog.Info("remote ", s.remote, " denied: ", err)
+		return
+	}
+
 	nodeName = req.NodeName
+	s.serviceTypes = req.ServiceTypes
+	s.revision = req.Revision
 	return
 }
 
-func (s serverSink) Reset() {}
+func (s *serverSink) RequestedServiceTypes() []string {
+	return s.serviceTypes
+}
+
+func (s *serverSink) RequestedRevision() uint64 {
+	return s.revision
+}
+
+func (s *serverSink) Reset() {}
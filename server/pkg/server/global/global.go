@@ -20,9 +20,13 @@ import (
 	"google.golang.org/grpc"
 
 	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/pkg/server/watchstate"
 	proxystore "sigs.k8s.io/kpng/server/proxystore"
 )
 
 func Setup(s grpc.ServiceRegistrar, store *proxystore.Store) {
-	localnetv1.RegisterGlobalServer(s, &Server{Store: store})
+	localnetv1.RegisterGlobalServer(s, &Server{
+		Store:    store,
+		Sessions: watchstate.NewSessions(watchstate.DefaultSessionTTL),
+	})
 }
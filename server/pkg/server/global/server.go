@@ -19,6 +19,7 @@ package global
 import (
 	"sigs.k8s.io/kpng/api/localnetv1"
 	"sigs.k8s.io/kpng/server/jobs/store2globaldiff"
+	"sigs.k8s.io/kpng/server/pkg/server/watchstate"
 	"sigs.k8s.io/kpng/server/proxystore"
 )
 
@@ -26,16 +27,20 @@ type Server struct {
 	localnetv1.UnimplementedGlobalServer
 
 	Store *proxystore.Store
+
+	// Sessions keeps the state of closed watches so they can be resumed (optional).
+	Sessions *watchstate.Sessions
 }
 
 var syncItem = &localnetv1.OpItem{Op: &localnetv1.OpItem_Sync{}}
 
 func (s *Server) Watch(res localnetv1.Global_WatchServer) error {
-	w := resWrap{res}
+	w := &resWrap{Global_WatchServer: res}
 
 	job := &store2globaldiff.Job{
-		Store: s.Store,
-		Sink:  w,
+		Store:    s.Store,
+		Sink:     w,
+		Sessions: s.Sessions,
 	}
 
 	return job.Run(res.Context())
@@ -43,9 +48,19 @@ func (s *Server) Watch(res localnetv1.Global_WatchServer) error {
 
 type resWrap struct {
 	localnetv1.Global_WatchServer
+	revision uint64
+}
+
+func (w *resWrap) Wait() error {
+	req, err := w.Recv()
+	if err != nil {
+		return err
+	}
+
+	w.revision = req.Revision
+	return nil
 }
 
-func (w resWrap) Wait() error {
-	_, err := w.Recv()
-	return err
+func (w *resWrap) RequestedRevision() uint64 {
+	return w.revision
 }
@@ -0,0 +1,255 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package journal keeps a bounded journal of the recent revisions of the global state, with their changes, so
+// operators can see what changed recently and agents can get the changes from an older revision they hold.
+package journal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/jobs/store2globaldiff"
+	"sigs.k8s.io/kpng/server/proxystore"
+)
+
+// ErrUnknownRevision is returned when diffing from a revision not in the journal (anymore).
+var ErrUnknownRevision = errors.New("revision not in the journal")
+
+// Journal records the revisions of the global state. It's a store2globaldiff.Sink.
+type Journal struct {
+	// MaxRevisions is the max number of revisions kept (unbounded if 0).
+	MaxRevisions int
+	// MaxAge is the max age of the revisions kept (unbounded if 0). The latest revision is always kept.
+	MaxAge time.Duration
+
+	mu      sync.Mutex
+	entries []*localnetv1.JournalEntry
+	pending *localnetv1.JournalEntry
+
+	now func() time.Time
+}
+
+var _ store2globaldiff.Sink = &Journal{}
+
+func New(maxRevisions int, maxAge time.Duration) *Journal {
+	return &Journal{
+		MaxRevisions: maxRevisions,
+		MaxAge:       maxAge,
+		now:          time.Now,
+	}
+}
+
+// Run records the revisions of the store until the context is done.
+func (j *Journal) Run(ctx context.Context, store *proxystore.Store) error {
+	job := &store2globaldiff.Job{
+		Store: store,
+		Sink:  j,
+	}
+
+	return job.Run(ctx)
+}
+
+// Wait is part of the store2globaldiff.Sink interface; the journal records every revision.
+func (j *Journal) Wait() error {
+	return nil
+}
+
+// Send is part of the store2globaldiff.Sink interface.
+func (j *Journal) Send(op *localnetv1.OpItem) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.pending == nil {
+		j.pending = &localnetv1.JournalEntry{}
+	}
+
+	switch v := op.Op.(type) {
+	case *localnetv1.OpItem_Reset_:
+		j.pending = &localnetv1.JournalEntry{FullState: true}
+
+	case *localnetv1.OpItem_Set, *localnetv1.OpItem_Delete:
+		j.pending.Ops = append(j.pending.Ops, op)
+
+	case *localnetv1.OpItem_Sync:
+		entry := j.pending
+		j.pending = nil
+
+		entry.Revision = v.Sync.Revision
+		entry.Time = j.now().UnixNano()
+
+		j.entries = append(j.entries, entry)
+		j.trim()
+	}
+
+	return nil
+}
+
+// trim drops the revisions exceeding the limits. The lock must be held.
+func (j *Journal) trim() {
+	drop := 0
+
+	if j.MaxRevisions > 0 && len(j.entries) > j.MaxRevisions {
+		drop = len(j.entries) - j.MaxRevisions
+	}
+
+	if j.MaxAge > 0 {
+		minTime := j.now().Add(-j.MaxAge).UnixNano()
+		for drop < len(j.entries)-1 && j.entries[drop].Time < minTime {
+			drop++
+		}
+	}
+
+	if drop == 0 {
+		return
+	}
+
+	// don't keep references to the dropped entries
+	n := copy(j.entries, j.entries[drop:])
+	for i := n; i < len(j.entries); i++ {
+		j.entries[i] = nil
+	}
+	j.entries = j.entries[:n]
+}
+
+// Revisions returns the revisions recorded after the given time, restricted to the changes of a service if not
+// empty (namespace/name). The revisions without changes to the service are skipped.
+func (j *Journal) Revisions(since time.Time, service string) (entries []*localnetv1.JournalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, entry := range j.entries {
+		if entry.Time <= since.UnixNano() {
+			continue
+		}
+
+		if service != "" {
+			ops := filterOps(entry.Ops, service)
+			if len(ops) == 0 {
+				continue
+			}
+
+			entry = &localnetv1.JournalEntry{
+				Revision:  entry.Revision,
+				Time:      entry.Time,
+				FullState: entry.FullState,
+				Ops:       ops,
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return
+}
+
+// Diff returns the changes from a revision to a more recent one (the latest if 0), restricted to the changes of a
+// service if not empty (namespace/name). Only the last operation on each ref is kept, the sets being before the
+// deletes.
+func (j *Journal) Diff(from, to uint64, service string) (revision uint64, ops []*localnetv1.OpItem, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	start := -1
+	for i, entry := range j.entries {
+		if entry.Revision == from {
+			start = i + 1 // the last match, revisions are digests and may repeat
+		}
+	}
+
+	if start == -1 {
+		err = ErrUnknownRevision
+		return
+	}
+
+	revision = from
+
+	type refKey struct {
+		set  localnetv1.Set
+		path string
+	}
+
+	lastOps := map[refKey]*localnetv1.OpItem{}
+	order := make([]refKey, 0)
+
+	found := to == 0 || to == from
+	for _, entry := range j.entries[start:] {
+		if found && to != 0 {
+			break
+		}
+
+		for _, op := range entry.Ops {
+			ref := op.GetSet().GetRef()
+			if ref == nil {
+				ref = op.GetDelete()
+			}
+
+			key := refKey{ref.Set, ref.Path}
+			if _, seen := lastOps[key]; !seen {
+				order = append(order, key)
+			}
+			lastOps[key] = op
+		}
+
+		revision = entry.Revision
+		if revision == to {
+			found = true
+		}
+	}
+
+	if !found {
+		err = ErrUnknownRevision
+		return
+	}
+
+	deletes := make([]*localnetv1.OpItem, 0)
+	for _, key := range order {
+		op := lastOps[key]
+		if op.GetDelete() != nil {
+			deletes = append(deletes, op)
+		} else {
+			ops = append(ops, op)
+		}
+	}
+	ops = append(ops, deletes...)
+
+	if service != "" {
+		ops = filterOps(ops, service)
+	}
+
+	return
+}
+
+// filterOps returns the operations on the refs of the given service (namespace/name).
+func filterOps(ops []*localnetv1.OpItem, service string) (filtered []*localnetv1.OpItem) {
+	prefix := strings.Replace(service, "/", "|", 1) + "|"
+
+	for _, op := range ops {
+		ref := op.GetSet().GetRef()
+		if ref == nil {
+			ref = op.GetDelete()
+		}
+
+		if ref != nil && strings.HasPrefix(ref.Path, prefix) {
+			filtered = append(filtered, op)
+		}
+	}
+	return
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+)
+
+func setOp(path, value string) *localnetv1.OpItem {
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Set{Set: &localnetv1.Value{
+		Ref:   &localnetv1.Ref{Set: localnetv1.Set_GlobalServiceInfos, Path: path},
+		Bytes: []byte(value),
+	}}}
+}
+
+func deleteOp(path string) *localnetv1.OpItem {
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Delete{Delete: &localnetv1.Ref{Set: localnetv1.Set_GlobalServiceInfos, Path: path}}}
+}
+
+func syncOp(revision uint64) *localnetv1.OpItem {
+	return &localnetv1.OpItem{Op: &localnetv1.OpItem_Sync{Sync: &localnetv1.SyncOp{Revision: revision}}}
+}
+
+func opsString(ops []*localnetv1.OpItem) string {
+	s := make([]string, 0, len(ops))
+	for _, op := range ops {
+		if set := op.GetSet(); set != nil {
+			s = append(s, "set "+set.Ref.Path+"="+string(set.Bytes))
+		} else {
+			s = append(s, "delete "+op.GetDelete().Path)
+		}
+	}
+	return strings.Join(s, ", ")
+}
+
+func testJournal(maxRevisions int, maxAge time.Duration) (j *Journal, now *time.Time) {
+	now = new(time.Time)
+	*now = time.Unix(1000, 0)
+
+	j = New(maxRevisions, maxAge)
+	j.now = func() time.Time { return *now }
+
+	j.Send(&localnetv1.OpItem{Op: &localnetv1.OpItem_Reset_{}})
+	j.Send(setOp("default|web||", "v1"))
+	j.Send(setOp("default|db||", "v1"))
+	j.Send(syncOp(1))
+
+	*now = now.Add(time.Minute)
+	j.Send(setOp("default|web||", "v2"))
+	j.Send(syncOp(2))
+
+	*now = now.Add(time.Minute)
+	j.Send(deleteOp("default|db||"))
+	j.Send(setOp("default|web||", "v3"))
+	j.Send(syncOp(3))
+
+	return
+}
+
+func TestDiff(t *testing.T) {
+	j, _ := testJournal(0, 0)
+
+	for _, test := range []struct {
+		from, to uint64
+		service  string
+		expected string
+	}{
+		{1, 0, "", "rev 3: set default|web||=v3, delete default|db||"},
+		{1, 2, "", "rev 2: set default|web||=v2"},
+		{2, 0, "default/db", "rev 3: delete default|db||"},
+		{3, 0, "", "rev 3: "},
+		{3, 3, "", "rev 3: "},
+		{4, 0, "", "error: revision not in the journal"},
+		{2, 1, "", "error: revision not in the journal"},
+	} {
+		revision, ops, err := j.Diff(test.from, test.to, test.service)
+
+		result := fmt.Sprintf("rev %d: %s", revision, opsString(ops))
+		if err != nil {
+			result = "error: " + err.Error()
+		}
+
+		if result != test.expected {
+			t.Errorf("diff from %d to %d (service %q): expected %q, got %q", test.from, test.to, test.service, test.expected, result)
+		}
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	j, now := testJournal(0, 0)
+
+	entries := j.Revisions(time.Time{}, "")
+	if len(entries) != 3 || !entries[0].FullState || entries[1].FullState {
+		t.Fatalf("expected 3 revisions, the 1st with the full state, got %v", entries)
+	}
+
+	entries = j.Revisions(now.Add(-30*time.Second), "")
+	if len(entries) != 1 || entries[0].Revision != 3 {
+		t.Errorf("expected only the revision 3 in the last 30s, got %v", entries)
+	}
+
+	entries = j.Revisions(time.Time{}, "default/db")
+	if len(entries) != 2 || entries[0].Revision != 1 || entries[1].Revision != 3 {
+		t.Fatalf("expected the revisions 1 and 3 for default/db, got %v", entries)
+	}
+	if s := opsString(entries[1].Ops); s != "delete default|db||" {
+		t.Errorf("expected only the changes of default/db, got %q", s)
+	}
+}
+
+func TestTrim(t *testing.T) {
+	j, _ := testJournal(2, 0)
+
+	if entries := j.Revisions(time.Time{}, ""); len(entries) != 2 || entries[0].Revision != 2 {
+		t.Errorf("expected the revisions 2 and 3, got %v", entries)
+	}
+	if _, _, err := j.Diff(1, 0, ""); err != ErrUnknownRevision {
+		t.Errorf("expected the revision 1 to be dropped, got %v", err)
+	}
+
+	j, now := testJournal(0, 90*time.Second)
+
+	if entries := j.Revisions(time.Time{}, ""); len(entries) != 2 || entries[0].Revision != 2 {
+		t.Errorf("expected the revisions 2 and 3, got %v", entries)
+	}
+
+	// the latest revision is always kept
+	*now = now.Add(time.Hour)
+	j.Send(syncOp(4))
+	*now = now.Add(time.Hour)
+	j.trim()
+
+	if entries := j.Revisions(time.Time{}, ""); len(entries) != 1 || entries[0].Revision != 4 {
+		t.Errorf("expected only the revision 4, got %v", entries)
+	}
+}
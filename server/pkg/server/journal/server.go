@@ -0,0 +1,69 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journal
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/server/proxystore"
+)
+
+type Server struct {
+	localnetv1.UnimplementedJournalServer
+
+	Journal *Journal
+}
+
+// Setup registers the journal API, recording the revisions of the store until the context is done.
+func Setup(ctx context.Context, s grpc.ServiceRegistrar, store *proxystore.Store, maxRevisions int, maxAge time.Duration) {
+	journal := New(maxRevisions, maxAge)
+
+	go func() {
+		if err := journal.Run(ctx, store); err != nil {
+			klog.Error("journal stopped: ", err)
+		}
+	}()
+
+	localnetv1.RegisterJournalServer(s, &Server{Journal: journal})
+}
+
+func (s *Server) Revisions(ctx context.Context, req *localnetv1.JournalRevisionsReq) (*localnetv1.JournalRevisionsReply, error) {
+	return &localnetv1.JournalRevisionsReply{
+		Entries: s.Journal.Revisions(time.Unix(0, req.Since), req.Service),
+	}, nil
+}
+
+func (s *Server) Diff(ctx context.Context, req *localnetv1.JournalDiffReq) (*localnetv1.JournalDiffReply, error) {
+	revision, ops, err := s.Journal.Diff(req.From, req.To, req.Service)
+	if err == ErrUnknownRevision {
+		return nil, status.Errorf(codes.NotFound, "diff from %d to %d: %v", req.From, req.To, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &localnetv1.JournalDiffReply{
+		Revision: revision,
+		Ops:      ops,
+	}, nil
+}
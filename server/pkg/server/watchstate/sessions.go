@@ -0,0 +1,110 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watchstate
+
+import (
+	"sync"
+	"time"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+	"sigs.k8s.io/kpng/client/lightdiffstore"
+)
+
+// DefaultSessionTTL is the default time the state of a closed watch is kept.
+const DefaultSessionTTL = time.Minute
+
+// Sessions keeps the states of closed watches for a while, so a client reconnecting with its last revision
+// receives only the changes since then.
+type Sessions struct {
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[uint64]*session
+}
+
+type session struct {
+	sets    []localnetv1.Set
+	diffs   []*lightdiffstore.DiffStore
+	expires time.Time
+}
+
+func NewSessions(ttl time.Duration) *Sessions {
+	return &Sessions{
+		TTL:     ttl,
+		entries: map[uint64]*session{},
+	}
+}
+
+// Save keeps the state of a closed watch. The watch state must not be used after this call.
+func (s *Sessions) Save(w *WatchState) {
+	if s == nil || w.Revision == 0 || w.Err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for rev, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, rev)
+		}
+	}
+
+	s.entries[w.Revision] = &session{
+		sets:    w.sets,
+		diffs:   w.diffs,
+		expires: now.Add(s.TTL),
+	}
+}
+
+// Resume restores the state saved for the given revision in w, returning false if there's none.
+func (s *Sessions) Resume(w *WatchState, revision uint64) bool {
+	if s == nil || revision == 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[revision]
+	if !ok {
+		return false
+	}
+
+	delete(s.entries, revision)
+
+	if time.Now().After(e.expires) || !sameSets(e.sets, w.sets) {
+		return false
+	}
+
+	w.diffs = e.diffs
+	w.Revision = revision
+	return true
+}
+
+func sameSets(a, b []localnetv1.Set) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -17,8 +17,11 @@ limitations under the License.
 package watchstate
 
 import (
+	"encoding/binary"
 	"fmt"
 
+	"github.com/cespare/xxhash"
+
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/protobuf/proto"
@@ -33,6 +36,12 @@ type WatchState struct {
 	sets  []localnetv1.Set
 	diffs []*lightdiffstore.DiffStore
 	Err   error
+
+	// Revision is the revision of the last change set sent (0 if none).
+	Revision uint64
+
+	// TraceParent is the trace context sent with the next sync (see the tracing package).
+	TraceParent string
 }
 
 func New(res localnetv1.OpSink, sets []localnetv1.Set) *WatchState {
@@ -79,8 +88,10 @@ func (w *WatchState) SendUpdatesN(set localnetv1.Set, setN int) (count int) {
 
 	updated := store.Updated()
 
+	metrics.Kpng_watch_queued_ops.Add(float64(len(updated)))
 	for _, kv := range updated {
 		w.sendSet(set, string(kv.Key), kv.Value.(proto.Message))
+		metrics.Kpng_watch_queued_ops.Dec()
 	}
 
 	return len(updated)
@@ -99,8 +110,10 @@ func (w *WatchState) SendDeletesN(set localnetv1.Set, setN int) (count int) {
 
 	deleted := store.Deleted()
 
+	metrics.Kpng_watch_queued_ops.Add(float64(len(deleted)))
 	for _, kv := range deleted {
 		w.sendDelete(set, string(kv.Key))
+		metrics.Kpng_watch_queued_ops.Dec()
 	}
 
 	return len(deleted)
@@ -147,10 +160,42 @@ func (w *WatchState) Reset(state lightdiffstore.ItemState) {
 	}
 }
 
-var syncItem = &localnetv1.OpItem{Op: &localnetv1.OpItem_Sync{}}
+// Digest returns the revision of the state in the stores. A revision is never 0.
+func (w *WatchState) Digest() uint64 {
+	h := xxhash.New()
+	buf := make([]byte, 8)
+
+	for _, s := range w.diffs {
+		binary.BigEndian.PutUint64(buf, s.Digest())
+		h.Write(buf)
+	}
+
+	if d := h.Sum64(); d != 0 {
+		return d
+	}
+	return 1
+}
+
+// Empty returns true if the stores have no entries.
+func (w *WatchState) Empty() bool {
+	for _, s := range w.diffs {
+		if s.Len() != 0 {
+			return false
+		}
+	}
+	return true
+}
 
+// SendSync signals the change set is complete, with its revision. It must be called after the stores were Reset.
 func (w *WatchState) SendSync() {
-	w.send(syncItem)
+	w.Revision = w.Digest()
+
+	w.send(&localnetv1.OpItem{
+		Op: &localnetv1.OpItem_Sync{
+			Sync: &localnetv1.SyncOp{Revision: w.Revision, TraceParent: w.TraceParent},
+		},
+	})
+	w.TraceParent = ""
 }
 
 var resetItem = &localnetv1.OpItem{Op: &localnetv1.OpItem_Reset_{}}
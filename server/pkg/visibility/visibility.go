@@ -0,0 +1,183 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package visibility restricts the services the node agents receive from the local API, with a policy mapping
+// groups of nodes (selected by their labels) to the namespaces and services they can see, so the nodes dedicated to
+// a tenant never receive the service topology of the other tenants.
+package visibility
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+)
+
+const (
+	Allow = "Allow"
+	Deny  = "Deny"
+)
+
+// Policy maps groups of nodes to the services they can see. A node sees the services visible to all the groups it
+// belongs to.
+type Policy struct {
+	// Default is the visibility of the services for the nodes in no group: Allow (the default) or Deny.
+	Default string `yaml:"default"`
+
+	Groups []*Group `yaml:"groups"`
+}
+
+// Group is a group of nodes, and the services they can see.
+type Group struct {
+	Name string `yaml:"name"`
+
+	// NodeSelector is the label selector of the nodes of the group (ie: "tenant=a"), all the nodes if empty.
+	NodeSelector string `yaml:"nodeSelector"`
+
+	// Namespaces are the namespaces the nodes see all the services of, as shell patterns (ie: "tenant-a-*").
+	Namespaces []string `yaml:"namespaces"`
+
+	// Services are the other services the nodes see, as namespace/name shell patterns (ie: "default/kubernetes").
+	Services []string `yaml:"services"`
+
+	selector labels.Selector
+}
+
+// Load reads the policy from a YAML file.
+func Load(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid visibility policy %s: %w", file, err)
+	}
+	return p, nil
+}
+
+// Parse parses and validates a YAML policy.
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, err
+	}
+
+	switch p.Default {
+	case "":
+		p.Default = Allow
+	case Allow, Deny:
+	default:
+		return nil, fmt.Errorf("invalid default %q (must be %s or %s)", p.Default, Allow, Deny)
+	}
+
+	names := map[string]bool{}
+	for i, g := range p.Groups {
+		if g == nil || g.Name == "" {
+			return nil, fmt.Errorf("group %d has no name", i)
+		}
+		if names[g.Name] {
+			return nil, fmt.Errorf("duplicate group %q", g.Name)
+		}
+		names[g.Name] = true
+
+		selector, err := labels.Parse(g.NodeSelector)
+		if err != nil {
+			return nil, fmt.Errorf("group %q: invalid node selector: %w", g.Name, err)
+		}
+		g.selector = selector
+
+		for _, pattern := range g.Namespaces {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("group %q: invalid namespace pattern %q", g.Name, pattern)
+			}
+		}
+		for _, pattern := range g.Services {
+			if _, err := path.Match(pattern, ""); err != nil || !strings.Contains(pattern, "/") {
+				return nil, fmt.Errorf("group %q: invalid namespace/name service pattern %q", g.Name, pattern)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// ForNode returns the filter of the services visible to a node (nil if unknown, matching the selectors as a node
+// without labels). A nil policy returns a nil filter, seeing all the services.
+func (p *Policy) ForNode(node *localnetv1.Node) *Filter {
+	if p == nil {
+		return nil
+	}
+
+	nodeLabels := labels.Set(node.GetLabels())
+
+	f := &Filter{}
+	names := make([]string, 0, len(p.Groups))
+	for _, g := range p.Groups {
+		if g.selector.Matches(nodeLabels) {
+			f.groups = append(f.groups, g)
+			names = append(names, g.Name)
+		}
+	}
+
+	f.key = strings.Join(names, ",")
+	f.all = len(f.groups) == 0 && p.Default == Allow
+
+	return f
+}
+
+// Filter tells if services are visible to a node.
+type Filter struct {
+	groups []*Group
+	all    bool
+	key    string
+}
+
+// Key identifies the groups of the node: filters with the same key see the same services.
+func (f *Filter) Key() string {
+	if f == nil || f.all {
+		return "*"
+	}
+	return f.key
+}
+
+// Visible tells if the service is visible to the node.
+func (f *Filter) Visible(namespace, name string) bool {
+	if f == nil || f.all {
+		return true
+	}
+
+	service := namespace + "/" + name
+	for _, g := range f.groups {
+		for _, pattern := range g.Namespaces {
+			if ok, _ := path.Match(pattern, namespace); ok {
+				return true
+			}
+		}
+		for _, pattern := range g.Services {
+			if ok, _ := path.Match(pattern, service); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
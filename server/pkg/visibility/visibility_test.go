@@ -0,0 +1,137 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package visibility
+
+import (
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/kpng/api/localnetv1"
+)
+
+const testPolicy = `
+default: Deny
+groups:
+- name: tenant-a
+  nodeSelector: tenant=a
+  namespaces: [tenant-a, "tenant-a-*"]
+  services: [default/kubernetes]
+- name: shared
+  nodeSelector: tenant in (a, b)
+  namespaces: [monitoring]
+`
+
+func TestVisible(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := func(labels map[string]string) *localnetv1.Node {
+		return &localnetv1.Node{Name: "node", Labels: labels}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		node    *localnetv1.Node
+		key     string
+		visible []string
+		hidden  []string
+	}{
+		{
+			name:    "tenant a",
+			node:    node(map[string]string{"tenant": "a"}),
+			key:     "tenant-a,shared",
+			visible: []string{"tenant-a/web", "tenant-a-dev/web", "default/kubernetes", "monitoring/prometheus"},
+			hidden:  []string{"tenant-b/web", "default/other"},
+		},
+		{
+			name:    "tenant b",
+			node:    node(map[string]string{"tenant": "b"}),
+			key:     "shared",
+			visible: []string{"monitoring/prometheus"},
+			hidden:  []string{"tenant-a/web", "default/kubernetes"},
+		},
+		{
+			name:   "no group",
+			node:   node(nil),
+			key:    "",
+			hidden: []string{"tenant-a/web", "monitoring/prometheus"},
+		},
+		{
+			name:   "unknown node",
+			node:   nil,
+			key:    "",
+			hidden: []string{"tenant-a/web"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := p.ForNode(tc.node)
+
+			if key := f.Key(); key != tc.key {
+				t.Errorf("expected key %q, got %q", tc.key, key)
+			}
+
+			check := func(services []string, expected bool) {
+				for _, svc := range services {
+					ns, name, _ := strings.Cut(svc, "/")
+					if f.Visible(ns, name) != expected {
+						t.Errorf("%s: expected visible=%v", svc, expected)
+					}
+				}
+			}
+			check(tc.visible, true)
+			check(tc.hidden, false)
+		})
+	}
+}
+
+func TestDefaultAllow(t *testing.T) {
+	p, err := Parse([]byte("groups: [{name: a, nodeSelector: tenant=a, namespaces: [a]}]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f := p.ForNode(&localnetv1.Node{}); !f.Visible("b", "web") {
+		t.Error("nodes in no group should see all the services by default")
+	}
+
+	if f := p.ForNode(&localnetv1.Node{Labels: map[string]string{"tenant": "a"}}); f.Visible("b", "web") {
+		t.Error("nodes in a group should only see its services")
+	}
+
+	var nilPolicy *Policy
+	if f := nilPolicy.ForNode(nil); !f.Visible("b", "web") {
+		t.Error("a nil policy should see all the services")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, policy := range []string{
+		"default: Maybe",
+		"groups: [{namespaces: [a]}]",
+		"groups: [{name: a}, {name: a}]",
+		"groups: [{name: a, nodeSelector: 'tenant in a'}]",
+		"groups: [{name: a, namespaces: ['[a']}]",
+		"groups: [{name: a, services: [kubernetes]}]",
+		"groups: [{name: a, unknown: field}]",
+	} {
+		if _, err := Parse([]byte(policy)); err == nil {
+			t.Errorf("%q: expected an error", policy)
+		}
+	}
+}
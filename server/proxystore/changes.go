@@ -0,0 +1,213 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxystore
+
+import (
+	"sort"
+
+	"github.com/google/btree"
+)
+
+// changeIndex indexes the store by revision, node name and topology zone, so the views of the store (ie: the
+// per-node local state) can be updated from the objects changed since their last revision, instead of being
+// computed again from all the objects on every change.
+type changeIndex struct {
+	// resetRev is the revision of the last reset: the changes before it aren't known.
+	resetRev uint64
+
+	// services holds the revision of the last change of each service or of its endpoints (deletions included).
+	services map[serviceKey]uint64
+	// log holds the changes of the services in revision order. A service may appear more than once, only its
+	// entry matching services is current.
+	log []serviceChange
+
+	// nodes holds the revision of the last change of each node, by name.
+	nodes map[string]uint64
+
+	// zones holds the number of endpoints hinted for each zone, by service.
+	zones map[string]map[serviceKey]int
+
+	// preferClose holds the services preferring the endpoints in the zone of the node.
+	preferClose map[serviceKey]bool
+}
+
+type serviceKey struct {
+	namespace, name string
+}
+
+type serviceChange struct {
+	rev uint64
+	key serviceKey
+}
+
+func newChangeIndex() *changeIndex {
+	return &changeIndex{
+		services: map[serviceKey]uint64{},
+		nodes:    map[string]uint64{},
+		zones:    map[string]map[serviceKey]int{},
+
+		preferClose: map[serviceKey]bool{},
+	}
+}
+
+func (c *changeIndex) reset(rev uint64) {
+	*c = *newChangeIndex()
+	c.resetRev = rev
+}
+
+// changed records the change of an entry at the given revision; prev or next is nil on insertion or deletion.
+func (c *changeIndex) changed(prev, next *KV, rev uint64) {
+	kv := next
+	if kv == nil {
+		kv = prev
+	}
+
+	switch kv.Set {
+	case Services:
+		key := serviceKey{kv.Namespace, kv.Name}
+		c.serviceChanged(key, rev)
+
+		if next != nil && next.Service.GetService().PrefersClose() {
+			c.preferClose[key] = true
+		} else {
+			delete(c.preferClose, key)
+		}
+
+	case Endpoints:
+		if kv.Name == "" {
+			return // indexed by source only, the entry indexed by service is also changed
+		}
+
+		key := serviceKey{kv.Namespace, kv.Name}
+		c.serviceChanged(key, rev)
+
+		if prev != nil {
+			c.indexZones(key, prev, -1)
+		}
+		if next != nil {
+			c.indexZones(key, next, 1)
+		}
+
+	case Nodes:
+		c.nodes[kv.Name] = rev
+	}
+}
+
+func (c *changeIndex) serviceChanged(key serviceKey, rev uint64) {
+	if c.services[key] == rev {
+		return // already recorded in this revision
+	}
+
+	c.services[key] = rev
+	c.log = append(c.log, serviceChange{rev, key})
+
+	if len(c.log) > 2*len(c.services)+64 {
+		c.compact()
+	}
+}
+
+// compact removes the outdated entries of the log.
+func (c *changeIndex) compact() {
+	c.log = c.log[:0]
+	for key, rev := range c.services {
+		c.log = append(c.log, serviceChange{rev, key})
+	}
+
+	sort.Slice(c.log, func(i, j int) bool { return c.log[i].rev < c.log[j].rev })
+}
+
+func (c *changeIndex) indexZones(key serviceKey, kv *KV, delta int) {
+	hints := kv.Endpoint.GetHints()
+	if hints == nil {
+		return
+	}
+
+	for _, zone := range hints.Zones {
+		services := c.zones[zone]
+		if services == nil {
+			services = map[serviceKey]int{}
+			c.zones[zone] = services
+		}
+
+		services[key] += delta
+		if services[key] <= 0 {
+			delete(services, key)
+		}
+		if len(services) == 0 {
+			delete(c.zones, zone)
+		}
+	}
+}
+
+func (tx *Tx) changed(prev, next btree.Item) {
+	var prevKV, nextKV *KV
+	if prev != nil {
+		prevKV = prev.(*KV)
+	}
+	if next != nil {
+		nextKV = next.(*KV)
+	}
+
+	// the revision created by this transaction
+	tx.s.changes.changed(prevKV, nextKV, tx.s.rev+1)
+}
+
+// Revision returns the revision of the store seen by the transaction.
+func (tx *Tx) Revision() uint64 {
+	return tx.s.rev
+}
+
+// EachServiceChangedSince calls the callback with each service that changed after the given revision, itself or
+// its endpoints, including the deleted ones. Returns false if the changes since that revision aren't known (the
+// store was reset since), in which case the callback isn't called and all the services must be considered.
+func (tx *Tx) EachServiceChangedSince(rev uint64, callback func(namespace, name string)) bool {
+	c := tx.s.changes
+	if rev < c.resetRev {
+		return false
+	}
+
+	first := sort.Search(len(c.log), func(i int) bool { return c.log[i].rev > rev })
+
+	for _, change := range c.log[first:] {
+		if c.services[change.key] != change.rev {
+			continue // changed again later
+		}
+		callback(change.key.namespace, change.key.name)
+	}
+
+	return true
+}
+
+// NodeChangedSince returns true if the node changed after the given revision (or if it's not known).
+func (tx *Tx) NodeChangedSince(name string, rev uint64) bool {
+	c := tx.s.changes
+	return rev < c.resetRev || c.nodes[name] > rev
+}
+
+// EachServiceHintedForZone calls the callback with each service having endpoints hinted for the given zone.
+func (tx *Tx) EachServiceHintedForZone(zone string, callback func(namespace, name string)) {
+	for key := range tx.s.changes.zones[zone] {
+		callback(key.namespace, key.name)
+	}
+}
+
+// EachServicePreferringClose calls the callback with each service preferring the endpoints in the zone of the node.
+func (tx *Tx) EachServicePreferringClose(callback func(namespace, name string)) {
+	for key := range tx.s.changes.preferClose {
+		callback(key.namespace, key.name)
+	}
+}
@@ -38,6 +38,8 @@ type Store struct {
 
 	// set sync info
 	sync map[Set]bool
+
+	changes *changeIndex
 }
 
 type Set = localnetv1.Set
@@ -56,9 +58,10 @@ type Hashed interface {
 
 func New() *Store {
 	return &Store{
-		c:    sync.NewCond(&sync.Mutex{}),
-		tree: btree.New(2),
-		sync: map[Set]bool{},
+		c:       sync.NewCond(&sync.Mutex{}),
+		tree:    btree.New(2),
+		sync:    map[Set]bool{},
+		changes: newChangeIndex(),
 	}
 }
 
@@ -105,18 +108,19 @@ func (s *Store) View(afterRev uint64, view func(tx *Tx)) (rev uint64, closed boo
 	for s.rev <= afterRev && !s.closed {
 		s.c.Wait()
 	}
+	closed = s.closed
 	s.c.L.Unlock()
 
+	if closed {
+		return 0, closed
+	}
+
 	s.RLock()
 	defer s.RUnlock()
 
-	if s.closed {
-		return 0, s.closed
-	}
-
 	view(&Tx{s: s, ro: true})
 
-	return s.rev, s.closed
+	return s.rev, false
 }
 
 type Tx struct {
@@ -151,6 +155,7 @@ func (tx *Tx) Reset() {
 	if tx.s.tree.Len() != 0 {
 		tx.s.tree.Clear(false)
 		tx.changes++
+		tx.s.changes.reset(tx.s.rev + 1)
 	}
 
 	for set, isSync := range tx.s.sync {
@@ -171,6 +176,7 @@ func (tx *Tx) set(kv *KV) {
 
 	tx.s.tree.ReplaceOrInsert(kv)
 	tx.changes++
+	tx.changed(prev, kv)
 }
 
 func (tx *Tx) del(kv *KV) {
@@ -178,6 +184,7 @@ func (tx *Tx) del(kv *KV) {
 	i := tx.s.tree.Delete(kv)
 	if i != nil {
 		tx.changes++
+		tx.changed(i, nil)
 	}
 }
 
@@ -237,6 +244,26 @@ func (tx *Tx) SetSync(set Set) {
 
 // Services funcs
 
+func (tx *Tx) GetService(namespace, name string) *localnetv1.Service {
+	i := tx.s.tree.Get(&KV{Set: Services, Namespace: namespace, Name: name})
+
+	if i == nil {
+		return nil
+	}
+
+	return i.(*KV).Service.Service
+}
+
+func (tx *Tx) GetServiceInfo(namespace, name string) *localnetv1.ServiceInfo {
+	i := tx.s.tree.Get(&KV{Set: Services, Namespace: namespace, Name: name})
+
+	if i == nil {
+		return nil
+	}
+
+	return i.(*KV).Service
+}
+
 func (tx *Tx) SetService(s *localnetv1.Service) {
 	si := &localnetv1.ServiceInfo{
 		Service: s,
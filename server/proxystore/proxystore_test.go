@@ -120,3 +120,66 @@ func TestSessionAffinitySetClientIP(t *testing.T) {
 		})
 	})
 }
+
+func TestChangeIndex(t *testing.T) {
+	s := New()
+
+	changedSince := func(rev uint64) (changed []string, known bool) {
+		s.View(0, func(tx *Tx) {
+			known = tx.EachServiceChangedSince(rev, func(namespace, name string) {
+				changed = append(changed, namespace+"/"+name)
+			})
+		})
+		return
+	}
+
+	setService := func(name string, port int32) {
+		s.Update(func(tx *Tx) {
+			tx.SetService(&localnetv1.Service{Namespace: "default", Name: name, Ports: []*localnetv1.PortMapping{{Port: port}}})
+		})
+	}
+
+	setService("a", 80)
+	setService("b", 80)
+	rev := s.rev
+
+	// enough changes to compact the log
+	for i := int32(0); i < 100; i++ {
+		setService("a", 81+i)
+	}
+	s.Update(func(tx *Tx) {
+		tx.SetEndpointsOfSource("default", "c-abcde", []*localnetv1.EndpointInfo{{
+			Namespace:   "default",
+			SourceName:  "c-abcde",
+			ServiceName: "c",
+			Endpoint:    &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.2.0.1")},
+			Hints:       &localnetv1.TopologyHints{Zones: []string{"z1"}},
+		}})
+	})
+
+	changed, known := changedSince(rev)
+	if !known || fmt.Sprint(changed) != "[default/a default/c]" {
+		t.Errorf("expected a and c changed, got %v (known: %v)", changed, known)
+	}
+
+	s.View(0, func(tx *Tx) {
+		hinted := make([]string, 0)
+		tx.EachServiceHintedForZone("z1", func(namespace, name string) { hinted = append(hinted, name) })
+		if fmt.Sprint(hinted) != "[c]" {
+			t.Errorf("expected c hinted for z1, got %v", hinted)
+		}
+	})
+
+	s.Update(func(tx *Tx) { tx.DelEndpointsOfSource("default", "c-abcde") })
+	if n := len(s.changes.zones); n != 0 {
+		t.Errorf("expected no hinted zone left, got %d", n)
+	}
+
+	s.Update(func(tx *Tx) { tx.Reset() })
+	if _, known := changedSince(rev); known {
+		t.Error("expected the changes before the reset to be unknown")
+	}
+	if changed, known := changedSince(s.rev); !known || len(changed) != 0 {
+		t.Errorf("expected no change since the reset, got %v (known: %v)", changed, known)
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxystore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/btree"
+	"google.golang.org/protobuf/proto"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+)
+
+// snapshotHeader starts the snapshots, to detect other files and format changes.
+const snapshotHeader = "kpng-snapshot/v1\n"
+
+// maxSnapshotEntrySize is the max size of an entry of a snapshot, to detect corrupted files.
+const maxSnapshotEntrySize = 64 << 20
+
+// WriteSnapshot writes the entries of the store, to be restored by RestoreSnapshot. Each entry is written as a
+// Value prefixed by its size (uvarint).
+func (tx *Tx) WriteSnapshot(w io.Writer) (err error) {
+	if _, err = io.WriteString(w, snapshotHeader); err != nil {
+		return
+	}
+
+	var (
+		buf  []byte
+		size [binary.MaxVarintLen64]byte
+	)
+
+	tx.s.tree.Ascend(func(i btree.Item) bool {
+		kv := i.(*KV)
+
+		var value []byte
+		value, err = proto.Marshal(kv.Value.(proto.Message))
+		if err != nil {
+			return false
+		}
+
+		buf, err = proto.MarshalOptions{}.MarshalAppend(buf[:0], &localnetv1.Value{
+			Ref:   &localnetv1.Ref{Set: kv.Set, Path: kv.Path()},
+			Bytes: value,
+		})
+		if err != nil {
+			return false
+		}
+
+		n := binary.PutUvarint(size[:], uint64(len(buf)))
+		if _, err = w.Write(size[:n]); err != nil {
+			return false
+		}
+		_, err = w.Write(buf)
+		return err == nil
+	})
+
+	return
+}
+
+// RestoreSnapshot replaces the entries of the store with the ones of a snapshot written by WriteSnapshot, and
+// marks all the sets as synced so the state can be served before the sources are listed again. The sources must
+// Prune their entries once listed, as the objects deleted since the snapshot are still there.
+func (tx *Tx) RestoreSnapshot(r io.Reader) (count int, err error) {
+	tx.roPanic()
+
+	in := bufio.NewReader(r)
+
+	header := make([]byte, len(snapshotHeader))
+	if _, err = io.ReadFull(in, header); err != nil || string(header) != snapshotHeader {
+		return 0, errors.New("not a snapshot")
+	}
+
+	// read everything before changing the store, so a corrupted snapshot changes nothing
+	type entry struct {
+		set   Set
+		path  string
+		value Hashed
+	}
+	entries := make([]entry, 0)
+
+	for {
+		var size uint64
+		size, err = binary.ReadUvarint(in)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return
+		}
+
+		if size > maxSnapshotEntrySize {
+			return 0, fmt.Errorf("entry %d too large (%d bytes)", len(entries), size)
+		}
+
+		buf := make([]byte, size)
+		if _, err = io.ReadFull(in, buf); err != nil {
+			return
+		}
+
+		value := &localnetv1.Value{}
+		if err = proto.Unmarshal(buf, value); err != nil {
+			return
+		}
+
+		var v Hashed
+		switch value.Ref.GetSet() {
+		case Services:
+			v = &localnetv1.ServiceInfo{}
+		case Endpoints:
+			v = &localnetv1.EndpointInfo{}
+		case Nodes:
+			v = &localnetv1.NodeInfo{}
+		default:
+			return 0, fmt.Errorf("entry %d: unknown set %v", len(entries), value.Ref.GetSet())
+		}
+
+		if err = proto.Unmarshal(value.Bytes, v.(proto.Message)); err != nil {
+			return
+		}
+
+		entries = append(entries, entry{value.Ref.Set, value.Ref.Path, v})
+	}
+
+	tx.Reset()
+
+	for _, e := range entries {
+		tx.SetRaw(e.set, e.path, e.value)
+	}
+
+	for _, set := range AllSets {
+		tx.SetSync(set)
+	}
+
+	return len(entries), nil
+}
+
+// Prune deletes the entries of the set not kept, ie: the entries restored from a snapshot whose objects were
+// deleted since, once their source is listed. It returns the number of entries deleted.
+func (tx *Tx) Prune(set Set, keep func(kv *KV) bool) int {
+	toDel := make([]*KV, 0)
+
+	tx.Each(set, func(kv *KV) bool {
+		if !keep(kv) {
+			toDel = append(toDel, kv)
+		}
+		return true
+	})
+
+	for _, kv := range toDel {
+		tx.del(kv)
+	}
+
+	return len(toDel)
+}
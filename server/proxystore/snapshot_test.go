@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxystore
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	localnetv1 "sigs.k8s.io/kpng/api/localnetv1"
+)
+
+func TestSnapshot(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	s.Update(func(tx *Tx) {
+		tx.SetService(&localnetv1.Service{Namespace: "default", Name: "a", Type: "ClusterIP"})
+		tx.SetService(&localnetv1.Service{Namespace: "default", Name: "b", Type: "NodePort"})
+		tx.SetEndpointsOfSource("default", "a-abcde", []*localnetv1.EndpointInfo{{
+			Namespace:   "default",
+			SourceName:  "a-abcde",
+			ServiceName: "a",
+			Endpoint:    &localnetv1.Endpoint{IPs: localnetv1.NewIPSet("10.1.0.1")},
+		}})
+		tx.SetNode(&localnetv1.Node{Name: "node-a"})
+	})
+
+	snapshot := &bytes.Buffer{}
+	s.View(0, func(tx *Tx) {
+		if err := tx.WriteSnapshot(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	restored := New()
+	defer restored.Close()
+
+	restored.Update(func(tx *Tx) {
+		count, err := tx.RestoreSnapshot(bytes.NewReader(snapshot.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 5 { // 2 services, 1 endpoint indexed twice, 1 node
+			t.Errorf("expected 5 entries restored, got %d", count)
+		}
+	})
+
+	restored.View(0, func(tx *Tx) {
+		if !tx.AllSynced() {
+			t.Error("expected the restored sets to be synced")
+		}
+
+		if svc := tx.GetService("default", "b"); svc.GetType() != "NodePort" {
+			t.Errorf("expected default/b restored, got %v", svc)
+		}
+
+		var ips []string
+		tx.EachEndpointOfService("default", "a", func(ei *localnetv1.EndpointInfo) {
+			ips = append(ips, ei.Endpoint.IPs.All()...)
+		})
+		if len(ips) != 1 || ips[0] != "10.1.0.1" {
+			t.Errorf("expected the endpoint of default/a restored, got %v", ips)
+		}
+
+		if node := tx.GetNode("node-a"); node == nil {
+			t.Error("expected node-a restored")
+		}
+	})
+
+	// the objects deleted since the snapshot are pruned once listed
+	restored.Update(func(tx *Tx) {
+		pruned := tx.Prune(Services, func(kv *KV) bool { return kv.Name == "a" })
+		if pruned != 1 {
+			t.Errorf("expected 1 service pruned, got %d", pruned)
+		}
+	})
+
+	restored.View(0, func(tx *Tx) {
+		if svc := tx.GetService("default", "b"); svc != nil {
+			t.Errorf("expected default/b pruned, got %v", svc)
+		}
+		if svc := tx.GetService("default", "a"); !proto.Equal(svc, &localnetv1.Service{Namespace: "default", Name: "a", Type: "ClusterIP"}) {
+			t.Errorf("expected default/a kept, got %v", svc)
+		}
+	})
+}
+
+func TestRestoreInvalidSnapshot(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	s.Update(func(tx *Tx) {
+		tx.SetService(&localnetv1.Service{Namespace: "default", Name: "a"})
+	})
+
+	for name, snapshot := range map[string]string{
+		"not a snapshot": "services: []\n",
+		"truncated":      snapshotHeader + "\x20abc",
+	} {
+		s.Update(func(tx *Tx) {
+			if _, err := tx.RestoreSnapshot(bytes.NewReader([]byte(snapshot))); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		})
+
+		s.View(0, func(tx *Tx) {
+			if tx.GetService("default", "a") == nil {
+				t.Errorf("%s: expected the store unchanged", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package e2e validates the backends against real clusters: run with `go test -tags e2e`, it creates a kind
+// cluster per backend and IP family of the matrix (see hack/test_e2e.sh), deploys kpng, runs the upstream service
+// conformance suites or checks the traffic to echo servers, and collects the rules of the nodes on failure. See
+// README.md.
+package e2e
@@ -0,0 +1,222 @@
+//go:build e2e
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	backends        = flag.String("e2e.backends", "iptables,ipvs,nft", "backends to test, comma separated")
+	ipFamilies      = flag.String("e2e.ip-families", "ipv4", "IP families to test (ipv4, ipv6, dual), comma separated")
+	deploymentModel = flag.String("e2e.deployment-model", "split-process-per-node", "kpng deployment model (split-process-per-node or single-process-per-node)")
+	e2eDir          = flag.String("e2e.dir", "", "directory of the binaries and artifacts (hack/temp/e2e-matrix if empty)")
+	focus           = flag.String("e2e.focus", `\[Conformance\]|\[sig-network\]`, "ginkgo focus of the upstream tests")
+	skip            = flag.String("e2e.skip", "machinery|Feature|Federation|PerformanceDNS|Disruptive|Serial|LoadBalancer|KubeProxy|GCE|Netpol|NetworkPolicy", "ginkgo skip of the upstream tests")
+	ginkgoNodes     = flag.Int("e2e.ginkgo-nodes", 25, "number of parallel ginkgo nodes")
+	keepClusters    = flag.Bool("e2e.keep-clusters", false, "keep the kind clusters after the tests")
+	containerEngine = flag.String("e2e.container-engine", "docker", "container engine running the kind nodes")
+)
+
+// ruleDumps are the commands run on each node to collect the rules of the backends when their tests fail.
+var ruleDumps = map[string][][]string{
+	"iptables": {{"iptables-save"}, {"ip6tables-save"}},
+	"ipvs":     {{"iptables-save"}, {"ip6tables-save"}, {"ipvsadm", "-Ln"}, {"ip", "addr", "show", "kube-ipvs0"}},
+	"nft":      {{"nft", "list", "ruleset"}},
+}
+
+func TestBackends(t *testing.T) {
+	forEachCluster(t, func(c *cluster) {
+		if err := c.runTests(); err != nil {
+			c.t.Error(err)
+			c.collectArtifacts()
+		}
+	})
+}
+
+// forEachCluster sets up a cluster for each backend and IP family of the matrix, and runs test in it.
+func forEachCluster(t *testing.T, test func(c *cluster)) {
+	repo, err := filepath.Abs("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseDir := *e2eDir
+	if baseDir == "" {
+		baseDir = filepath.Join(repo, "hack", "temp", "e2e-matrix")
+	}
+	binDir := filepath.Join(baseDir, "bin")
+
+	os.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	for _, backend := range strings.Split(*backends, ",") {
+		for _, ipFamily := range strings.Split(*ipFamilies, ",") {
+			backend, ipFamily := backend, ipFamily
+
+			t.Run(ipFamily+"-"+backend, func(t *testing.T) {
+				c := &cluster{
+					t:        t,
+					repo:     repo,
+					backend:  backend,
+					ipFamily: ipFamily,
+					name:     "kpng-e2e-" + ipFamily + "-" + backend,
+					dir:      filepath.Join(baseDir, ipFamily+"-"+backend),
+					binDir:   binDir,
+				}
+
+				c.setup()
+				if !*keepClusters {
+					t.Cleanup(c.delete)
+				}
+
+				test(c)
+			})
+		}
+	}
+}
+
+type cluster struct {
+	t *testing.T
+
+	repo     string
+	backend  string
+	ipFamily string
+	name     string
+	dir      string
+	binDir   string
+
+	// workers are the nodes running the echo servers and clients of the traffic tests.
+	workers []string
+}
+
+func (c *cluster) artifacts(elem ...string) string {
+	return filepath.Join(append([]string{c.dir, "artifacts"}, elem...)...)
+}
+
+// run runs the command, writing its output to the log file (in the cluster's directory).
+func (c *cluster) run(log string, name string, args ...string) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+
+	out, err := os.Create(filepath.Join(c.dir, log))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	cmd := exec.Command(name, args...)
+	cmd.Dir = c.repo
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed (see %s): %w", name, out.Name(), err)
+	}
+	return nil
+}
+
+// setup creates the kind cluster and deploys kpng with the backend, using hack/test_e2e.sh in devel mode.
+func (c *cluster) setup() {
+	c.t.Log("creating cluster ", c.name)
+
+	err := c.run("setup.log", filepath.Join(c.repo, "hack", "test_e2e.sh"),
+		"-i", c.ipFamily,
+		"-b", c.backend,
+		"-m", *deploymentModel,
+		"-E", c.dir,
+		"-B", c.binDir,
+		"-d")
+	if err != nil {
+		c.collectArtifacts()
+		c.t.Fatal(err)
+	}
+}
+
+// runTests runs the upstream tests (see run_tests in hack/test_e2e.sh).
+func (c *cluster) runTests() error {
+	c.t.Log("running the upstream tests on ", c.name)
+
+	// setting this env prevents ginkgo e2e from trying to run provider setup
+	os.Setenv("KUBERNETES_CONFORMANCE_TEST", "y")
+	// setting these is required to make RuntimeClass tests work
+	os.Setenv("KUBE_CONTAINER_RUNTIME", "remote")
+	os.Setenv("KUBE_CONTAINER_RUNTIME_ENDPOINT", "unix:///run/containerd/containerd.sock")
+	os.Setenv("KUBE_CONTAINER_RUNTIME_NAME", "containerd")
+
+	return c.run("tests.log", filepath.Join(c.binDir, "ginkgo"),
+		fmt.Sprintf("--nodes=%d", *ginkgoNodes),
+		"--focus="+*focus,
+		"--skip="+*skip,
+		filepath.Join(c.binDir, "e2e.test"),
+		"--",
+		"--kubeconfig="+c.artifacts("kubeconfig_tests.conf"),
+		"--provider=local",
+		"--dump-logs-on-failure=false",
+		"--report-dir="+c.artifacts("reports"),
+		"--disable-log-dump=true")
+}
+
+// collectArtifacts dumps the rules of each node and exports the logs of the cluster.
+func (c *cluster) collectArtifacts() {
+	rulesDir := c.artifacts("rules")
+	if err := os.MkdirAll(rulesDir, 0755); err != nil {
+		c.t.Error(err)
+		return
+	}
+
+	nodes, err := exec.Command("kind", "get", "nodes", "--name", c.name).Output()
+	if err != nil {
+		c.t.Error("failed to list the nodes of ", c.name, ": ", err)
+		return
+	}
+
+	for _, node := range strings.Fields(string(nodes)) {
+		for _, dump := range ruleDumps[c.backend] {
+			args := append([]string{"exec", node}, dump...)
+			out, err := exec.Command(*containerEngine, args...).CombinedOutput()
+			if err != nil {
+				out = append(out, fmt.Sprintf("\n# %s failed: %v\n", strings.Join(dump, " "), err)...)
+			}
+
+			file := filepath.Join(rulesDir, node+"_"+strings.Join(dump, "_")+".txt")
+			if err := os.WriteFile(file, out, 0644); err != nil {
+				c.t.Error(err)
+			}
+		}
+	}
+
+	if err := exec.Command("kind", "export", "logs", "--name", c.name, c.artifacts("logs")).Run(); err != nil {
+		c.t.Error("failed to export the logs of ", c.name, ": ", err)
+	}
+
+	c.t.Log("rules and logs collected in ", c.artifacts())
+}
+
+func (c *cluster) delete() {
+	if err := exec.Command("kind", "delete", "cluster", "--name", c.name).Run(); err != nil {
+		c.t.Error("failed to delete ", c.name, ": ", err)
+	}
+}
@@ -0,0 +1,3 @@
+module sigs.k8s.io/kpng/test/e2e
+
+go 1.19
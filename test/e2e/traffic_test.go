@@ -0,0 +1,442 @@
+//go:build e2e
+
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+var (
+	trafficImage   = flag.String("e2e.traffic-image", "registry.k8s.io/e2e-test-images/agnhost:2.39", "image of the echo servers and clients of the traffic tests")
+	trafficTimeout = flag.Duration("e2e.traffic-timeout", 2*time.Minute, "how long a traffic check is retried before failing")
+)
+
+const trafficNamespace = "kpng-traffic"
+
+// trafficManifests are the echo servers (agnhost netexec, answering /hostname with their pod name) and the services
+// of the traffic tests. The echo deployment serves the cluster-wide services; the echo-local pod, on the first
+// worker, serves the ones with a Local traffic policy. The clients, one per worker, are netexec too: their /dial
+// endpoint, reached through the API server, makes the requests from inside the cluster.
+var trafficManifests = template.Must(template.New("traffic").Parse(`
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{ .Namespace }}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: echo
+  namespace: {{ .Namespace }}
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: echo
+  template:
+    metadata:
+      labels:
+        app: echo
+    spec:
+      containers:
+      - name: echo
+        image: {{ .Image }}
+        args: ["netexec", "--http-port=8080"]
+        readinessProbe:
+          httpGet:
+            path: /healthz
+            port: 8080
+{{- range $i, $node := .Workers }}
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: client-{{ $i }}
+  namespace: {{ $.Namespace }}
+spec:
+  nodeName: {{ $node }}
+  containers:
+  - name: client
+    image: {{ $.Image }}
+    args: ["netexec", "--http-port=8080"]
+{{- end }}
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: echo-local
+  namespace: {{ .Namespace }}
+  labels:
+    app: echo-local
+spec:
+  nodeName: {{ index .Workers 0 }}
+  containers:
+  - name: echo
+    image: {{ .Image }}
+    args: ["netexec", "--http-port=8080"]
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: echo-clusterip
+  namespace: {{ .Namespace }}
+spec:
+  selector:
+    app: echo
+  ports:
+  - port: 80
+    targetPort: 8080
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: echo-nodeport
+  namespace: {{ .Namespace }}
+spec:
+  type: NodePort
+  selector:
+    app: echo
+  ports:
+  - port: 80
+    targetPort: 8080
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: echo-lb
+  namespace: {{ .Namespace }}
+spec:
+  type: LoadBalancer
+  selector:
+    app: echo
+  ports:
+  - port: 80
+    targetPort: 8080
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: echo-affinity
+  namespace: {{ .Namespace }}
+spec:
+  selector:
+    app: echo
+  sessionAffinity: ClientIP
+  ports:
+  - port: 80
+    targetPort: 8080
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: echo-external-local
+  namespace: {{ .Namespace }}
+spec:
+  type: NodePort
+  externalTrafficPolicy: Local
+  selector:
+    app: echo-local
+  ports:
+  - port: 80
+    targetPort: 8080
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: echo-internal-local
+  namespace: {{ .Namespace }}
+spec:
+  internalTrafficPolicy: Local
+  selector:
+    app: echo-local
+  ports:
+  - port: 80
+    targetPort: 8080
+`))
+
+// loadBalancerIPs are set in the status of the LoadBalancer service, kind having no load balancer: the traffic to
+// them is only handled by the backends' rules.
+var loadBalancerIPs = map[string]string{
+	"ipv4": "203.0.113.10",
+	"ipv6": "fd6d:706e:6703::10",
+	"dual": "203.0.113.10",
+}
+
+func TestTraffic(t *testing.T) {
+	forEachCluster(t, func(c *cluster) {
+		if err := c.deployEchoServers(); err != nil {
+			c.t.Fatal(err)
+		}
+
+		c.runTrafficTests()
+
+		if c.t.Failed() {
+			c.collectArtifacts()
+		}
+	})
+}
+
+// kubectl runs kubectl on the cluster, returning its output.
+func (c *cluster) kubectl(stdin string, args ...string) (string, error) {
+	args = append([]string{"--kubeconfig", c.artifacts("kubeconfig_tests.conf")}, args...)
+
+	cmd := exec.Command(filepath.Join(c.binDir, "kubectl"), args...)
+	cmd.Stdin = strings.NewReader(stdin)
+
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("kubectl %s failed: %w: %s", strings.Join(args[2:], " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (c *cluster) jsonpath(resource, path string) (string, error) {
+	return c.kubectl("", "-n", trafficNamespace, "get", resource, "-o", "jsonpath={"+path+"}")
+}
+
+// deployEchoServers deploys the echo servers, clients and services, and waits for them to be ready.
+func (c *cluster) deployEchoServers() error {
+	workers, err := c.kubectl("", "get", "nodes",
+		"-l", "!node-role.kubernetes.io/control-plane,!node-role.kubernetes.io/master",
+		"-o", "jsonpath={.items[*].metadata.name}")
+	if err != nil {
+		return err
+	}
+
+	nodes := strings.Fields(workers)
+	if len(nodes) < 2 {
+		return fmt.Errorf("the traffic tests need 2 workers, found %q", nodes)
+	}
+	sort.Strings(nodes)
+	c.workers = nodes[:2]
+
+	manifests := &bytes.Buffer{}
+	err = trafficManifests.Execute(manifests, map[string]interface{}{
+		"Namespace": trafficNamespace,
+		"Image":     *trafficImage,
+		"Workers":   c.workers,
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.kubectl(manifests.String(), "apply", "-f", "-"); err != nil {
+		return err
+	}
+
+	lbIP := loadBalancerIPs[c.ipFamily]
+	if _, err := c.kubectl("", "-n", trafficNamespace, "patch", "service", "echo-lb", "--subresource=status", "--type=merge",
+		"-p", fmt.Sprintf(`{"status":{"loadBalancer":{"ingress":[{"ip":%q}]}}}`, lbIP)); err != nil {
+		return err
+	}
+
+	if _, err := c.kubectl("", "-n", trafficNamespace, "rollout", "status", "deployment/echo", "--timeout=5m"); err != nil {
+		return err
+	}
+	_, err = c.kubectl("", "-n", trafficNamespace, "wait", "pods", "--all", "--for=condition=Ready", "--timeout=5m")
+	return err
+}
+
+// runTrafficTests checks the services from the clients, retrying each check until the rules are programmed.
+func (c *cluster) runTrafficTests() {
+	echoPods, err := c.kubectl("", "-n", trafficNamespace, "get", "pods", "-l", "app=echo", "-o", "jsonpath={.items[*].metadata.name}")
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	allEcho := strings.Fields(echoPods)
+	sort.Strings(allEcho)
+
+	nodeIPs := make([]string, len(c.workers))
+	for i, node := range c.workers {
+		addresses, err := c.kubectl("", "get", "node", node, "-o", `jsonpath={.status.addresses[?(@.type=="InternalIP")].address}`)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if nodeIPs[i] = c.familyIP(strings.Fields(addresses)); nodeIPs[i] == "" {
+			c.t.Fatalf("node %s has no %s address: %q", node, c.ipFamily, addresses)
+		}
+	}
+
+	clusterIP := func(svc string) string {
+		ip, err := c.jsonpath("service/"+svc, ".spec.clusterIP")
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		return ip
+	}
+	nodePort := func(svc string) int {
+		port, err := c.jsonpath("service/"+svc, ".spec.ports[0].nodePort")
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			c.t.Fatalf("invalid node port of %s: %q", svc, port)
+		}
+		return p
+	}
+
+	const tries = 20
+
+	checks := []struct {
+		name   string
+		client int
+		host   string
+		port   int
+		expect func(responses []string) error
+	}{
+		{"cluster IP", 1, clusterIP("echo-clusterip"), 80, reachesAll(allEcho)},
+		{"node port on the first worker", 1, nodeIPs[0], nodePort("echo-nodeport"), reachesAll(allEcho)},
+		{"node port on the second worker", 0, nodeIPs[1], nodePort("echo-nodeport"), reachesAll(allEcho)},
+		{"load balancer IP", 1, loadBalancerIPs[c.ipFamily], 80, reachesAll(allEcho)},
+		{"session affinity", 1, clusterIP("echo-affinity"), 80, sticksTo(allEcho, tries)},
+		{"external local policy with a local endpoint", 1, nodeIPs[0], nodePort("echo-external-local"), reachesAll([]string{"echo-local"})},
+		{"external local policy without local endpoints", 1, nodeIPs[1], nodePort("echo-external-local"), reachesNone},
+		{"internal local policy with a local endpoint", 0, clusterIP("echo-internal-local"), 80, reachesAll([]string{"echo-local"})},
+		{"internal local policy without local endpoints", 1, clusterIP("echo-internal-local"), 80, reachesNone},
+	}
+
+	for _, check := range checks {
+		client := fmt.Sprintf("client-%d", check.client)
+
+		deadline := time.Now().Add(*trafficTimeout)
+		for {
+			responses, err := c.dial(client, check.host, check.port, tries)
+			if err == nil {
+				err = check.expect(responses)
+			}
+			if err == nil {
+				c.t.Logf("%s: ok", check.name)
+				break
+			}
+
+			if time.Now().After(deadline) {
+				c.t.Errorf("%s (%s to %s): %v", check.name, client, net.JoinHostPort(check.host, strconv.Itoa(check.port)), err)
+				break
+			}
+			time.Sleep(5 * time.Second)
+		}
+	}
+}
+
+// familyIP returns the address of the cluster's IP family (IPv4 for dual-stack clusters).
+func (c *cluster) familyIP(addresses []string) string {
+	for _, address := range addresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			continue
+		}
+		if (ip.To4() == nil) == (c.ipFamily == "ipv6") {
+			return address
+		}
+	}
+	return ""
+}
+
+// dial makes the client request the hostname of the echo server behind host:port, tries times, through the netexec
+// /dial endpoint. It returns the responses, the failed tries being left out.
+func (c *cluster) dial(client, host string, port, tries int) ([]string, error) {
+	query := url.Values{
+		"request":  {"hostname"},
+		"protocol": {"http"},
+		"host":     {host},
+		"port":     {strconv.Itoa(port)},
+		"tries":    {strconv.Itoa(tries)},
+	}
+
+	out, err := c.kubectl("", "get", "--raw",
+		fmt.Sprintf("/api/v1/namespaces/%s/pods/%s:8080/proxy/dial?%s", trafficNamespace, client, query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	result := struct {
+		Responses []string `json:"responses"`
+	}{}
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		return nil, fmt.Errorf("invalid dial result %q: %w", out, err)
+	}
+	return result.Responses, nil
+}
+
+// reachesAll expects the responses to come from all the pods, and only from them.
+func reachesAll(pods []string) func(responses []string) error {
+	return func(responses []string) error {
+		if got := distinct(responses); strings.Join(got, ",") != strings.Join(pods, ",") {
+			return fmt.Errorf("expected responses from %q, got %q", pods, responses)
+		}
+		return nil
+	}
+}
+
+// sticksTo expects all the tries to reach the same pod, one of the given ones.
+func sticksTo(pods []string, tries int) func(responses []string) error {
+	return func(responses []string) error {
+		got := distinct(responses)
+		if len(responses) != tries || len(got) != 1 || !contains(pods, got[0]) {
+			return fmt.Errorf("expected %d responses from one of %q, got %q", tries, pods, responses)
+		}
+		return nil
+	}
+}
+
+func reachesNone(responses []string) error {
+	if len(responses) != 0 {
+		return fmt.Errorf("expected no responses, got %q", responses)
+	}
+	return nil
+}
+
+func distinct(values []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}